@@ -1422,7 +1422,43 @@ func newAuditCmd() *cobra.Command {
 	}
 	listCmd.Flags().Int("limit", 50, "Number of entries to show")
 
-	cmd.AddCommand(listCmd)
+	verifyCmd := &cobra.Command{
+		Use:   "verify",
+		Short: "Verify the audit log hash chain has not been altered",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			since, _ := cmd.Flags().GetString("since")
+			until, _ := cmd.Flags().GetString("until")
+
+			ctx := context.Background()
+			report, anchors, err := client.VerifyAuditChain(ctx, since, until)
+			if err != nil {
+				return err
+			}
+			if outputFormat != "table" {
+				return outputSingle(map[string]interface{}{"report": report, "anchors": anchors})
+			}
+
+			if report.Valid {
+				fmt.Printf("Audit chain intact: %d records checked (seq %d-%d)\n", report.Checked, report.FirstSeq, report.LastSeq)
+			} else {
+				fmt.Printf("Audit chain BROKEN at seq %d: %s\n", report.BrokenAt, report.Reason)
+			}
+			if report.Unchained > 0 {
+				fmt.Printf("%d records predate chaining and were not checked\n", report.Unchained)
+			}
+			for _, a := range anchors {
+				fmt.Printf("Anchor seq %d (%s): %s\n", a.Seq, a.CreatedAt.Format("2006-01-02 15:04:05"), a.Status)
+			}
+			if !report.Valid {
+				return fmt.Errorf("audit chain verification failed")
+			}
+			return nil
+		},
+	}
+	verifyCmd.Flags().String("since", "", "Start of range (RFC3339)")
+	verifyCmd.Flags().String("until", "", "End of range (RFC3339)")
+
+	cmd.AddCommand(listCmd, verifyCmd)
 	return cmd
 }
 
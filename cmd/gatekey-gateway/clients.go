@@ -0,0 +1,114 @@
+package main
+
+import "sync"
+
+// clientRegistry tracks connected VPN clients and the fingerprint of the rules
+// applied for each. The refresh loop updates it while the heartbeat loop reads
+// the client count, so all access goes through the mutex.
+type clientRegistry struct {
+	mu         sync.RWMutex
+	clients    map[string]ConnectedClient      // VPN IP -> client info
+	ruleHashes map[string]string               // VPN IP -> fingerprint of applied rules
+	rules      map[string]*ClientRulesResponse // VPN IP -> last applied rules
+}
+
+func newClientRegistry() *clientRegistry {
+	return &clientRegistry{
+		clients:    make(map[string]ConnectedClient),
+		ruleHashes: make(map[string]string),
+		rules:      make(map[string]*ClientRulesResponse),
+	}
+}
+
+// Add records a connected client and reports whether it was new.
+func (r *clientRegistry) Add(vpnIP string, client ConnectedClient) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.clients[vpnIP]; exists {
+		return false
+	}
+	r.clients[vpnIP] = client
+	return true
+}
+
+// Remove forgets a client and its applied rules fingerprint.
+func (r *clientRegistry) Remove(vpnIP string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.clients, vpnIP)
+	delete(r.ruleHashes, vpnIP)
+	delete(r.rules, vpnIP)
+}
+
+// Client returns a connected client's info.
+func (r *clientRegistry) Client(vpnIP string) (ConnectedClient, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	client, ok := r.clients[vpnIP]
+	return client, ok
+}
+
+// Snapshot returns a copy of the connected clients, safe to iterate while the
+// registry changes.
+func (r *clientRegistry) Snapshot() map[string]ConnectedClient {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	clients := make(map[string]ConnectedClient, len(r.clients))
+	for vpnIP, client := range r.clients {
+		clients[vpnIP] = client
+	}
+	return clients
+}
+
+// Count returns the number of connected clients.
+func (r *clientRegistry) Count() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.clients)
+}
+
+// RuleHash returns the fingerprint of the rules applied for a client.
+func (r *clientRegistry) RuleHash(vpnIP string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.ruleHashes[vpnIP]
+}
+
+// SetRuleHash records the fingerprint of the rules applied for a client; an empty
+// fingerprint forces the next refresh to re-apply them. It is ignored for clients
+// that disconnected while their rules were being applied.
+func (r *clientRegistry) SetRuleHash(vpnIP, fingerprint string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, connected := r.clients[vpnIP]; !connected {
+		return
+	}
+	if fingerprint == "" {
+		delete(r.ruleHashes, vpnIP)
+		return
+	}
+	r.ruleHashes[vpnIP] = fingerprint
+}
+
+// Rules returns the rules last applied for a client, or nil if none were.
+func (r *clientRegistry) Rules(vpnIP string) *ClientRulesResponse {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.rules[vpnIP]
+}
+
+// SetRules records the rules applied for a client, so they can be re-applied
+// without asking the control plane. It is ignored for disconnected clients.
+func (r *clientRegistry) SetRules(vpnIP string, rules *ClientRulesResponse) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, connected := r.clients[vpnIP]; !connected {
+		return
+	}
+	r.rules[vpnIP] = rules
+}
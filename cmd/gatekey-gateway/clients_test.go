@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// TestClientRegistryConcurrentAccess exercises connect/disconnect, rule refresh and
+// heartbeat reads at the same time; run with -race to catch unsynchronized access.
+func TestClientRegistryConcurrentAccess(t *testing.T) {
+	r := newClientRegistry()
+	var wg sync.WaitGroup
+
+	// Connect and disconnect events from the hooks
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				vpnIP := fmt.Sprintf("10.8.%d.%d", w, i%20)
+				if !r.Add(vpnIP, ConnectedClient{VPNIP: vpnIP, UserID: "user"}) {
+					r.Remove(vpnIP)
+				}
+			}
+		}(w)
+	}
+
+	// Rule refresh over the connected clients
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			for vpnIP := range r.Snapshot() {
+				if r.RuleHash(vpnIP) == "" {
+					r.SetRuleHash(vpnIP, "fingerprint")
+				} else {
+					r.SetRuleHash(vpnIP, "")
+				}
+			}
+		}
+	}()
+
+	// Heartbeats reading the client count and config version
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			_ = r.Count()
+			configVerMu.Lock()
+			currentConfigVer = fmt.Sprintf("v%d", i)
+			configVerMu.Unlock()
+			_ = getConfigVersion()
+		}
+	}()
+
+	wg.Wait()
+
+	if n := len(r.Snapshot()); n != r.Count() {
+		t.Errorf("snapshot has %d clients, count is %d", n, r.Count())
+	}
+}
+
+func TestClientRegistryRuleHashes(t *testing.T) {
+	r := newClientRegistry()
+	client := ConnectedClient{VPNIP: "10.8.0.2"}
+
+	if !r.Add("10.8.0.2", client) {
+		t.Fatal("expected first Add to report a new client")
+	}
+	if r.Add("10.8.0.2", client) {
+		t.Error("expected second Add to report an existing client")
+	}
+
+	r.SetRuleHash("10.8.0.2", "abc")
+	if got := r.RuleHash("10.8.0.2"); got != "abc" {
+		t.Errorf("RuleHash = %q, want abc", got)
+	}
+
+	r.Remove("10.8.0.2")
+	if got := r.RuleHash("10.8.0.2"); got != "" {
+		t.Errorf("RuleHash after Remove = %q, want empty", got)
+	}
+
+	// Rules applied after the client disconnected must not be remembered
+	r.SetRuleHash("10.8.0.2", "stale")
+	if got := r.RuleHash("10.8.0.2"); got != "" {
+		t.Errorf("RuleHash for disconnected client = %q, want empty", got)
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/gatekey-project/gatekey/internal/agent"
+	"github.com/gatekey-project/gatekey/internal/openvpn"
+)
+
+const (
+	// configProxyMaxRequest bounds request bodies; config requests are tiny.
+	configProxyMaxRequest = 64 << 10
+	// configProxyMaxResponse bounds what is relayed back; a config is a few KB.
+	configProxyMaxResponse = 4 << 20
+)
+
+// configProxyHeaders are the client request headers forwarded to the control plane.
+var configProxyHeaders = []string{"Authorization", "Cookie", "Content-Type", "Accept", "User-Agent"}
+
+// configProxyResponseHeaders are the control plane response headers relayed back.
+var configProxyResponseHeaders = []string{"Content-Type", "Content-Disposition", "Cache-Control"}
+
+// configProxy forwards config requests from clients that can reach this gateway
+// but not the control plane. Only the allowlisted config endpoints are forwarded,
+// and only with the user's own credentials, so the gateway can't be used as an
+// open relay and requests carry no more authority than the user has. The gateway
+// token is added so the control plane knows which gateway forwarded the request.
+type configProxy struct {
+	target *url.URL
+	token  string
+	client *http.Client
+}
+
+func newConfigProxy(controlPlaneURL, token string) (*configProxy, error) {
+	target, err := url.Parse(controlPlaneURL)
+	if err != nil || target.Host == "" {
+		return nil, fmt.Errorf("invalid control plane URL %q", controlPlaneURL)
+	}
+	return &configProxy{
+		target: target,
+		token:  token,
+		client: &http.Client{
+			Timeout:   60 * time.Second,
+			Transport: agent.ControlPlaneTransport,
+			// Relay redirects to the client instead of following them from the gateway
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+	}, nil
+}
+
+func (p *configProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !openvpn.ConfigProxyAllowed(r.Method, r.URL.Path) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if r.Header.Get("Authorization") == "" && r.Header.Get("Cookie") == "" {
+		http.Error(w, "authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	target := *p.target
+	target.Path = strings.TrimSuffix(target.Path, "/") + r.URL.Path
+	target.RawQuery = r.URL.RawQuery
+
+	body := http.MaxBytesReader(w, r.Body, configProxyMaxRequest)
+	req, err := http.NewRequestWithContext(r.Context(), r.Method, target.String(), body)
+	if err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	for _, header := range configProxyHeaders {
+		if v := r.Header.Get(header); v != "" {
+			req.Header.Set(header, v)
+		}
+	}
+	req.Header.Set(openvpn.GatewayProxyHeader, p.token)
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		req.Header.Set("X-Forwarded-For", host)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		logger.Warn("Config proxy request failed", zap.String("path", r.URL.Path), zap.Error(err))
+		http.Error(w, "control plane unreachable", http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	for _, header := range configProxyResponseHeaders {
+		if v := resp.Header.Get(header); v != "" {
+			w.Header().Set(header, v)
+		}
+	}
+	if loc := resp.Header.Get("Location"); loc != "" {
+		w.Header().Set("Location", loc)
+	}
+	w.WriteHeader(resp.StatusCode)
+	_, _ = io.Copy(w, io.LimitReader(resp.Body, configProxyMaxResponse))
+
+	logger.Info("Proxied config request",
+		zap.String("method", r.Method),
+		zap.String("path", r.URL.Path),
+		zap.String("client", r.RemoteAddr),
+		zap.Int("status", resp.StatusCode))
+}
+
+// newConfigProxyServer returns the HTTP server for the config proxy on addr. When
+// certFile and keyFile are set the server uses TLS, re-reading the files on each
+// handshake so a reprovisioned server certificate is picked up without a restart.
+func newConfigProxyServer(addr string, proxy *configProxy, certFile, keyFile string) *http.Server {
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           proxy,
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       30 * time.Second,
+		WriteTimeout:      90 * time.Second,
+	}
+	if certFile != "" && keyFile != "" {
+		srv.TLSConfig = &tls.Config{
+			MinVersion: tls.VersionTLS12,
+			GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+				cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+				if err != nil {
+					return nil, err
+				}
+				return &cert, nil
+			},
+		}
+	}
+	return srv
+}
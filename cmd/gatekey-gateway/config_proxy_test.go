@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/gatekey-project/gatekey/internal/openvpn"
+)
+
+func TestConfigProxy(t *testing.T) {
+	logger = zap.NewNop()
+
+	var gotToken, gotAuth string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotToken = r.Header.Get(openvpn.GatewayProxyHeader)
+		gotAuth = r.Header.Get("Authorization")
+		w.Header().Set("Content-Disposition", `attachment; filename="gw.ovpn"`)
+		_, _ = w.Write([]byte("client\n"))
+	}))
+	defer upstream.Close()
+
+	proxy, err := newConfigProxy(upstream.URL, "gw-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		path string
+		auth string
+		want int
+	}{
+		{"allowed", "/api/v1/configs/download/abc", "Bearer user", http.StatusOK},
+		{"no credentials", "/api/v1/configs/download/abc", "", http.StatusUnauthorized},
+		{"not allowlisted", "/api/v1/admin/users", "Bearer user", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		gotToken, gotAuth = "", ""
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		if tt.auth != "" {
+			req.Header.Set("Authorization", tt.auth)
+		}
+		rec := httptest.NewRecorder()
+		proxy.ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, rec.Code, tt.want)
+			continue
+		}
+		if tt.want != http.StatusOK {
+			if gotToken != "" {
+				t.Errorf("%s: request was forwarded", tt.name)
+			}
+			continue
+		}
+		if gotToken != "gw-token" || gotAuth != tt.auth {
+			t.Errorf("%s: forwarded token %q auth %q", tt.name, gotToken, gotAuth)
+		}
+		if rec.Header().Get("Content-Disposition") == "" || rec.Body.String() != "client\n" {
+			t.Errorf("%s: response not relayed: %v %q", tt.name, rec.Header(), rec.Body.String())
+		}
+	}
+}
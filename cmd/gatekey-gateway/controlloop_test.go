@@ -0,0 +1,382 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/gatekey-project/gatekey/internal/agent"
+	"github.com/gatekey-project/gatekey/internal/agent/agenttest"
+	"github.com/gatekey-project/gatekey/internal/config"
+	"github.com/gatekey-project/gatekey/internal/firewall"
+	"github.com/gatekey-project/gatekey/internal/openvpn"
+	"github.com/gatekey-project/gatekey/internal/pki"
+)
+
+const clientRulesPath = "/api/v1/gateway/client-rules"
+
+// fakeBackend records which connections have rules installed.
+type fakeBackend struct {
+	rules map[string]int // Installed rules per connection, including the drop rule
+}
+
+func (b *fakeBackend) Initialize(ctx context.Context) error { return nil }
+
+func (b *fakeBackend) AddRules(ctx context.Context, rules []firewall.Rule) error {
+	for _, r := range rules {
+		b.rules[r.ConnectionID]++
+	}
+	return nil
+}
+
+func (b *fakeBackend) AddDefaultDropRule(ctx context.Context, connectionID string, sourceIP net.IP) error {
+	b.rules[connectionID]++
+	return nil
+}
+
+func (b *fakeBackend) RemoveRules(ctx context.Context, connectionID string) error {
+	delete(b.rules, connectionID)
+	return nil
+}
+
+func (b *fakeBackend) FlushAllRules(ctx context.Context) error {
+	b.rules = make(map[string]int)
+	return nil
+}
+
+func (b *fakeBackend) ListRules(ctx context.Context) ([]firewall.Rule, error) { return nil, nil }
+
+func (b *fakeBackend) Cleanup(ctx context.Context) error { return b.FlushAllRules(ctx) }
+
+func (b *fakeBackend) Close() error { return nil }
+
+// newTestAgent points the agent's globals at a fake control plane, a fake firewall
+// and a temporary state directory, and restores them when the test ends.
+func newTestAgent(t *testing.T) (*GatewayConfig, *agenttest.ControlPlane, *fakeBackend) {
+	t.Helper()
+
+	saved := struct {
+		logger                                          *zap.Logger
+		firewallMgr                                     *firewall.Manager
+		connectedUsers                                  *clientRegistry
+		controlPlane                                    *agent.ControlPlaneClient
+		configVersionFile, fingerprintsFile, clientsDir string
+		provisionSignedFile, currentCAFile              string
+		currentConfigVer                                string
+	}{logger, firewallMgr, connectedUsers, controlPlane, configVersionFile, fingerprintsFile, clientsDir,
+		provisionSignedFile, currentCAFile, currentConfigVer}
+	t.Cleanup(func() {
+		logger, firewallMgr, connectedUsers, controlPlane = saved.logger, saved.firewallMgr, saved.connectedUsers, saved.controlPlane
+		configVersionFile, fingerprintsFile, clientsDir = saved.configVersionFile, saved.fingerprintsFile, saved.clientsDir
+		provisionSignedFile, currentCAFile = saved.provisionSignedFile, saved.currentCAFile
+		currentConfigVer = saved.currentConfigVer
+	})
+
+	dir := t.TempDir()
+	backend := &fakeBackend{rules: make(map[string]int)}
+	logger = zap.NewNop()
+	firewallMgr = firewall.NewManager(backend)
+	connectedUsers = newClientRegistry()
+	controlPlane = agent.NewControlPlaneClient(time.Second)
+	configVersionFile = filepath.Join(dir, ".config_version")
+	fingerprintsFile = filepath.Join(dir, ".fingerprints")
+	clientsDir = filepath.Join(dir, "clients")
+	provisionSignedFile = filepath.Join(dir, ".provision_signed")
+	currentCAFile = filepath.Join(dir, "ca.crt")
+	currentConfigVer = ""
+
+	cp := agenttest.NewControlPlane(t)
+	return &GatewayConfig{ControlPlaneURL: cp.URL, Token: "gw-token"}, cp, backend
+}
+
+func TestNeedsReprovision(t *testing.T) {
+	tests := []struct {
+		name    string
+		local   string
+		resp    openvpn.HeartbeatResponse
+		initial bool
+		want    bool
+	}{
+		{"first start, never provisioned", "", openvpn.HeartbeatResponse{ConfigVersion: "v1"}, true, true},
+		{"first start, control plane has no version", "", openvpn.HeartbeatResponse{}, true, false},
+		{"restart with persisted version", "v1", openvpn.HeartbeatResponse{ConfigVersion: "v2", NeedsReprovision: true}, true, false},
+		{"signaled", "v1", openvpn.HeartbeatResponse{ConfigVersion: "v2", NeedsReprovision: true}, false, true},
+		{"up to date", "v2", openvpn.HeartbeatResponse{ConfigVersion: "v2"}, false, false},
+		{"version differs but not signaled", "v1", openvpn.HeartbeatResponse{ConfigVersion: "v2"}, false, false},
+	}
+	for _, tt := range tests {
+		if got := needsReprovision(tt.local, &tt.resp, tt.initial); got != tt.want {
+			t.Errorf("%s: needsReprovision() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestReprovisionScopeFor(t *testing.T) {
+	previous := map[string]string{"ca": "a", "tls": "b", "session": "c", "endpoints": "d", "network": "e"}
+	with := func(name, fp string) map[string]string {
+		current := make(map[string]string, len(previous))
+		for k, v := range previous {
+			current[k] = v
+		}
+		current[name] = fp
+		return current
+	}
+
+	tests := []struct {
+		name     string
+		previous map[string]string
+		current  map[string]string
+		want     reprovisionScope
+	}{
+		{"nothing changed", previous, previous, scopeNone},
+		{"endpoints only", previous, with("endpoints", "x"), scopeNone},
+		{"CA rotated", previous, with("ca", "x"), scopeReload},
+		{"session lifetime", previous, with("session", "x"), scopeReload},
+		{"network changed", previous, with("network", "x"), scopeRestart},
+		{"no previous fingerprints", nil, previous, scopeRestart},
+		{"control plane sent none", previous, nil, scopeRestart},
+	}
+	for _, tt := range tests {
+		if got, _ := reprovisionScopeFor(tt.previous, tt.current, "v2"); got != tt.want {
+			t.Errorf("%s: reprovisionScopeFor() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	// An admin's reprovision rewrites the server certificate even when nothing else changed
+	if got, _ := reprovisionScopeFor(previous, previous, openvpn.ReprovisionVersionPrefix+"1700000000"); got != scopeRestart {
+		t.Errorf("requested reprovision: reprovisionScopeFor() = %v, want restart", got)
+	}
+}
+
+func TestConfigVersionPersistence(t *testing.T) {
+	newTestAgent(t)
+
+	if v := loadConfigVersion(); v != "" {
+		t.Errorf("loadConfigVersion() with no file = %q, want empty", v)
+	}
+
+	setConfigVersion("v2")
+	if v := getConfigVersion(); v != "v2" {
+		t.Errorf("getConfigVersion() = %q, want v2", v)
+	}
+	if v := loadConfigVersion(); v != "v2" {
+		t.Errorf("loadConfigVersion() after restart = %q, want v2", v)
+	}
+
+	if err := os.WriteFile(configVersionFile, []byte("v3\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if v := loadConfigVersion(); v != "v3" {
+		t.Errorf("loadConfigVersion() = %q, want v3", v)
+	}
+
+	fps := map[string]string{"ca": "a", "network": "b"}
+	if err := saveFingerprints(fps); err != nil {
+		t.Fatal(err)
+	}
+	if got := loadFingerprints(); len(got) != 2 || got["ca"] != "a" {
+		t.Errorf("loadFingerprints() = %v, want %v", got, fps)
+	}
+	if err := os.WriteFile(fingerprintsFile, []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if got := loadFingerprints(); got != nil {
+		t.Errorf("loadFingerprints() with a corrupt file = %v, want nil", got)
+	}
+}
+
+func TestFetchClientRules(t *testing.T) {
+	tests := []struct {
+		name     string
+		response agenttest.Response
+		timeout  time.Duration
+		wantErr  string
+	}{
+		{"ok", agenttest.JSON(ClientRulesResponse{Allowed: []AllowedDestination{{Type: "cidr", Value: "10.0.0.0/24"}}, Default: "deny"}), 0, ""},
+		{"rejected token", agenttest.Response{Status: http.StatusUnauthorized, Body: `{"error":"invalid token"}`}, 0, "returned 401"},
+		{"malformed JSON", agenttest.Response{Body: `{"allowed":[`}, 0, "failed to decode"},
+		{"timeout", agenttest.Response{Body: `{}`, Delay: 5 * time.Second}, 50 * time.Millisecond, "failed to send request"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, cp, _ := newTestAgent(t)
+			cp.Handle(clientRulesPath, tt.response)
+			if tt.timeout > 0 {
+				controlPlane.SetTimeout(tt.timeout)
+			}
+
+			rules, err := fetchClientRules(cfg, "user-1", "alice@example.com", []string{"eng"}, "10.8.0.2")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("fetchClientRules() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("fetchClientRules() error = %v", err)
+			}
+			if len(rules.Allowed) != 1 || rules.Default != "deny" {
+				t.Errorf("fetchClientRules() = %+v", rules)
+			}
+
+			var sent struct {
+				Token      string   `json:"token"`
+				UserEmail  string   `json:"user_email"`
+				UserGroups []string `json:"user_groups"`
+				ClientIP   string   `json:"client_ip"`
+			}
+			if err := cp.Requests(clientRulesPath)[0].Decode(&sent); err != nil {
+				t.Fatal(err)
+			}
+			if sent.Token != "gw-token" || sent.UserEmail != "alice@example.com" || len(sent.UserGroups) != 1 || sent.ClientIP != "10.8.0.2" {
+				t.Errorf("client-rules request = %+v", sent)
+			}
+		})
+	}
+}
+
+func TestSyncConnectedClients(t *testing.T) {
+	cfg, cp, backend := newTestAgent(t)
+	cp.Handle(clientRulesPath, agenttest.JSON(ClientRulesResponse{
+		Allowed: []AllowedDestination{
+			{Type: "cidr", Value: "10.0.0.0/24", Port: "443", Protocol: "tcp"},
+			{Type: "ip", Value: "10.0.1.5"},
+		},
+	}))
+	const connID = "client-10-8-0-2"
+
+	// Connect: the hook writes a client file and the daemon applies its rules
+	if err := writeClientFile("10.8.0.2", ConnectedClient{UserID: "user-1", UserEmail: "alice@example.com", VPNIP: "10.8.0.2"}); err != nil {
+		t.Fatal(err)
+	}
+	syncConnectedClients(cfg)
+	if n := len(firewallMgr.ConnectionRules(connID)); n != 2 {
+		t.Errorf("applied %d allow rules, want 2", n)
+	}
+	if backend.rules[connID] != 3 {
+		t.Errorf("backend has %d rules for the client, want 2 allow and 1 drop", backend.rules[connID])
+	}
+	if connectedUsers.RuleHash("10.8.0.2") == "" {
+		t.Error("applied rules weren't recorded for the client")
+	}
+
+	// A second sync doesn't fetch rules again for a known client
+	syncConnectedClients(cfg)
+	if n := cp.Calls(clientRulesPath); n != 1 {
+		t.Errorf("client rules fetched %d times, want 1", n)
+	}
+
+	// Disconnect: the hook removes the file and the daemon removes the rules
+	removeClientFile("10.8.0.2")
+	syncConnectedClients(cfg)
+	if n := len(firewallMgr.ConnectionRules(connID)); n != 0 {
+		t.Errorf("%d rules left after disconnect", n)
+	}
+	if _, ok := backend.rules[connID]; ok {
+		t.Error("backend still has rules for the disconnected client")
+	}
+	if n := connectedUsers.Count(); n != 0 {
+		t.Errorf("%d clients still tracked after disconnect", n)
+	}
+}
+
+func TestSyncConnectedClientsRecoversFromFailedFetch(t *testing.T) {
+	cfg, cp, backend := newTestAgent(t)
+	cp.Handle(clientRulesPath,
+		agenttest.Response{Body: "<html>bad gateway</html>"},
+		agenttest.JSON(ClientRulesResponse{Allowed: []AllowedDestination{{Type: "cidr", Value: "10.0.0.0/24"}}}))
+	const connID = "client-10-8-0-3"
+
+	if err := writeClientFile("10.8.0.3", ConnectedClient{UserID: "user-2", VPNIP: "10.8.0.3"}); err != nil {
+		t.Fatal(err)
+	}
+	syncConnectedClients(cfg)
+	if _, ok := backend.rules[connID]; ok {
+		t.Fatal("rules applied from a malformed response")
+	}
+	if connectedUsers.Count() != 1 || connectedUsers.RuleHash("10.8.0.3") != "" {
+		t.Fatal("client should be tracked with no applied rules")
+	}
+
+	// The next full refresh picks up the client that has no rules yet
+	if !refreshAllClientRules(cfg) {
+		t.Fatal("refreshAllClientRules() reported a failure")
+	}
+	if n := len(firewallMgr.ConnectionRules(connID)); n != 1 {
+		t.Errorf("applied %d allow rules after refresh, want 1", n)
+	}
+	if connectedUsers.RuleHash("10.8.0.3") == "" {
+		t.Error("refreshed rules weren't recorded for the client")
+	}
+}
+
+func TestApplyFirewallRulesProtocolWithoutPort(t *testing.T) {
+	cfg, _, _ := newTestAgent(t)
+	const connID = "client-10-8-0-4"
+
+	rules := &ClientRulesResponse{Allowed: []AllowedDestination{{Type: "cidr", Value: "10.0.0.0/24", Protocol: "icmp"}}}
+	if err := applyFirewallRules(cfg, "10.8.0.4", "user-3", rules); err != nil {
+		t.Fatal(err)
+	}
+	applied := firewallMgr.ConnectionRules(connID)
+	if len(applied) != 1 {
+		t.Fatalf("applied %d allow rules, want 1", len(applied))
+	}
+	// An ICMP-only grant must not open TCP or UDP to the destination
+	if r := applied[0]; r.Protocol != firewall.ProtocolICMP || r.DestPort != 0 {
+		t.Errorf("applied rule protocol %q port %d, want icmp with no port", r.Protocol, r.DestPort)
+	}
+}
+
+func TestVerifyProvisionPolicy(t *testing.T) {
+	newTestAgent(t)
+	unsigned := &openvpn.ProvisionResponse{GatewayID: "gw-1", Payload: []byte(`{"gateway_id":"gw-1"}`)}
+
+	if err := verifyProvision(&GatewayConfig{}, unsigned, "abc"); err != nil {
+		t.Errorf("verifyProvision() rejected an unsigned response without require_signed_provisioning: %v", err)
+	}
+	if err := verifyProvision(&GatewayConfig{RequireSignedProvisioning: true}, unsigned, "abc"); err == nil {
+		t.Error("verifyProvision() accepted an unsigned response with require_signed_provisioning")
+	}
+
+	// Once a signed response has been verified, unsigned ones are downgrades
+	ca, err := pki.NewCA(config.PKIConfig{KeyAlgorithm: "ecdsa256", Organization: "Test Org", CertValidity: time.Hour, CAValidity: 24 * time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload := []byte(`{"gateway_id":"gw-1"}`)
+	signature, err := ca.Sign(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed := &openvpn.ProvisionResponse{GatewayID: "gw-1", CACert: string(ca.CertificatePEM()), Payload: payload, Signature: signature}
+
+	if err := verifyProvision(&GatewayConfig{}, signed, "forged"); err == nil {
+		t.Error("verifyProvision() trusted a CA that doesn't match the heartbeat on first provision")
+	}
+	if err := verifyProvision(&GatewayConfig{}, signed, pki.Fingerprint(ca.Certificate())); err != nil {
+		t.Fatalf("verifyProvision() first signed provision error = %v", err)
+	}
+	if err := verifyProvision(&GatewayConfig{}, unsigned, "abc"); err == nil {
+		t.Error("verifyProvision() accepted an unsigned response after a signed one")
+	}
+
+	// With a CA on disk, the heartbeat's fingerprint no longer decides trust
+	other, err := pki.NewCA(config.PKIConfig{KeyAlgorithm: "ecdsa256", Organization: "Test Org", CertValidity: time.Hour, CAValidity: 24 * time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(currentCAFile, other.CertificatePEM(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyProvision(&GatewayConfig{}, signed, pki.Fingerprint(ca.Certificate())); err == nil {
+		t.Error("verifyProvision() trusted the heartbeat over the gateway's current CA")
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/gatekey-project/gatekey/internal/firewall"
+	"github.com/gatekey-project/gatekey/internal/openvpn"
+)
+
+// With deny_log set, each client's default drop rule logs what it drops to the
+// kernel log (rate limited per client). The gateway reads those entries back
+// from /dev/kmsg, counts them per client and destination, and periodically logs
+// a summary and reports it to the control plane, so a blocked connection shows
+// up as "blocked trying to reach 10.2.0.5:5432" rather than a timeout.
+
+// kmsgPath is the kernel log device.
+const kmsgPath = "/dev/kmsg"
+
+// maxDeniedEntries bounds how many distinct blocked destinations are kept
+// between reports; packets to further destinations are only counted.
+const maxDeniedEntries = 10000
+
+// deniedKey identifies a blocked destination for one client.
+type deniedKey struct {
+	clientIP string
+	destIP   string
+	protocol string
+	destPort int
+}
+
+// deniedEntry counts the packets a client sent to a blocked destination.
+type deniedEntry struct {
+	packets   int64
+	firstSeen time.Time
+	lastSeen  time.Time
+}
+
+// deniedTraffic aggregates denied packets between reports.
+type deniedTraffic struct {
+	mu      sync.Mutex
+	entries map[deniedKey]*deniedEntry
+	dropped int64 // packets not recorded because entries was full
+}
+
+func newDeniedTraffic() *deniedTraffic {
+	return &deniedTraffic{entries: make(map[deniedKey]*deniedEntry)}
+}
+
+var denied = newDeniedTraffic()
+
+// Record counts a denied packet.
+func (d *deniedTraffic) Record(pkt firewall.DeniedPacket, now time.Time) {
+	key := deniedKey{
+		clientIP: pkt.SourceIP.String(),
+		destIP:   pkt.DestIP.String(),
+		protocol: pkt.Protocol,
+		destPort: pkt.DestPort,
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	entry, ok := d.entries[key]
+	if !ok {
+		if len(d.entries) >= maxDeniedEntries {
+			d.dropped++
+			return
+		}
+		entry = &deniedEntry{firstSeen: now}
+		d.entries[key] = entry
+	}
+	entry.packets++
+	entry.lastSeen = now
+}
+
+// Drain returns the denied traffic recorded since the last call, most packets
+// first, along with the number of packets that didn't fit.
+func (d *deniedTraffic) Drain() ([]openvpn.DeniedTraffic, int64) {
+	d.mu.Lock()
+	entries, dropped := d.entries, d.dropped
+	d.entries, d.dropped = make(map[deniedKey]*deniedEntry), 0
+	d.mu.Unlock()
+
+	result := make([]openvpn.DeniedTraffic, 0, len(entries))
+	for key, entry := range entries {
+		result = append(result, openvpn.DeniedTraffic{
+			ClientIP:  key.clientIP,
+			DestIP:    key.destIP,
+			Protocol:  key.protocol,
+			DestPort:  key.destPort,
+			Packets:   entry.packets,
+			FirstSeen: entry.firstSeen,
+			LastSeen:  entry.lastSeen,
+		})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Packets != result[j].Packets {
+			return result[i].Packets > result[j].Packets
+		}
+		return result[i].LastSeen.After(result[j].LastSeen)
+	})
+	return result, dropped
+}
+
+// watchDenyLog records denied packets from the kernel log until ctx is done.
+// Only entries logged after it starts are read.
+func watchDenyLog(ctx context.Context) error {
+	f, err := os.Open(kmsgPath)
+	if err != nil {
+		return fmt.Errorf("failed to open kernel log: %w", err)
+	}
+	if _, err := f.Seek(0, io.SeekEnd); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to seek kernel log: %w", err)
+	}
+
+	go func() {
+		<-ctx.Done()
+		f.Close()
+	}()
+
+	// Each read of /dev/kmsg returns one record
+	buf := make([]byte, 8192)
+	for {
+		n, err := f.Read(buf)
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, io.EOF) {
+				return nil
+			}
+			// The kernel overwrote records before they were read; carry on
+			if errors.Is(err, syscall.EPIPE) {
+				continue
+			}
+			return fmt.Errorf("failed to read kernel log: %w", err)
+		}
+		record, _, _ := bytes.Cut(buf[:n], []byte("\n"))
+		if pkt, ok := firewall.ParseDenyLog(string(record)); ok {
+			denied.Record(pkt, time.Now())
+		}
+	}
+}
+
+// denyLogLoop reads denied packets and summarizes them every interval, or every
+// minute if reporting to the control plane is off.
+func denyLogLoop(ctx context.Context, cfg *GatewayConfig) {
+	go func() {
+		if err := watchDenyLog(ctx); err != nil {
+			logger.Warn("Denied traffic won't be summarized", zap.Error(err))
+		}
+	}()
+
+	interval := cfg.DenyLogReportInterval
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	client := openvpn.NewHookClient(cfg.ControlPlaneURL, cfg.Token)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reportDeniedTraffic(cfg, client)
+		}
+	}
+}
+
+// reportDeniedTraffic logs the traffic denied since the last report, attributed
+// to the connected users, and sends it to the control plane if enabled.
+func reportDeniedTraffic(cfg *GatewayConfig, client *openvpn.HookClient) {
+	entries, dropped := denied.Drain()
+	if len(entries) == 0 {
+		return
+	}
+
+	for i := range entries {
+		if c, ok := connectedUsers.Client(entries[i].ClientIP); ok {
+			entries[i].UserEmail = c.UserEmail
+		}
+		logger.Info("Blocked traffic",
+			zap.String("user", entries[i].UserEmail),
+			zap.String("client_ip", entries[i].ClientIP),
+			zap.String("destination", entries[i].Destination()),
+			zap.Int64("packets", entries[i].Packets))
+	}
+	if dropped > 0 {
+		logger.Warn("Too many blocked destinations to track; some weren't summarized", zap.Int64("packets", dropped))
+	}
+
+	if cfg.DenyLogReportInterval <= 0 {
+		return
+	}
+	// Older control planes don't accept reports, so failures aren't worth a warning
+	if err := client.ReportDeniedTraffic(entries); err != nil {
+		logger.Debug("Failed to report denied traffic", zap.Error(err))
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/gatekey-project/gatekey/internal/firewall"
+)
+
+func TestDeniedTraffic(t *testing.T) {
+	d := newDeniedTraffic()
+	start := time.Now()
+	pkt := func(dst string, port int) firewall.DeniedPacket {
+		return firewall.DeniedPacket{SourceIP: net.ParseIP("10.8.0.6"), DestIP: net.ParseIP(dst), Protocol: "tcp", DestPort: port}
+	}
+
+	d.Record(pkt("10.2.0.5", 22), start)
+	for i := range 3 {
+		d.Record(pkt("10.2.0.5", 5432), start.Add(time.Duration(i)*time.Second))
+	}
+
+	entries, dropped := d.Drain()
+	if dropped != 0 || len(entries) != 2 {
+		t.Fatalf("Drain() = %d entries, %d dropped; want 2, 0", len(entries), dropped)
+	}
+	top := entries[0]
+	if top.Destination() != "10.2.0.5:5432" || top.Packets != 3 || !top.FirstSeen.Equal(start) || !top.LastSeen.Equal(start.Add(2*time.Second)) {
+		t.Errorf("top entry = %+v, want 3 packets to 10.2.0.5:5432 over 2s", top)
+	}
+
+	if entries, _ := d.Drain(); len(entries) != 0 {
+		t.Errorf("second Drain() = %d entries, want 0", len(entries))
+	}
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/net/dns/dnsmessage"
+
+	"github.com/gatekey-project/gatekey/internal/firewall"
+)
+
+// Hostname wildcard rules can't be resolved up front: there is no way to list
+// every name under *.example.com. Instead the gateway can act as its clients' DNS
+// server. It forwards queries upstream and, when an answer is for a name that
+// matches one of the querying client's wildcard rules, it allows the returned
+// addresses for that client before passing the answer on, so the connection that
+// follows the lookup gets through.
+
+const (
+	// dnsUpstreamTimeout bounds how long a query waits for the upstream server.
+	dnsUpstreamTimeout = 5 * time.Second
+	// Learned addresses are kept for the answer's TTL, within these bounds, so a
+	// very short TTL doesn't cut off connections that are still being set up.
+	minLearnedTTL = time.Minute
+	maxLearnedTTL = time.Hour
+)
+
+// wildcardHosts holds addresses learned from DNS answers for names matching
+// hostname wildcard rules.
+var wildcardHosts = newLearnedHosts()
+
+// learnedHosts maps hostnames to the addresses DNS answered with and when each
+// expires.
+type learnedHosts struct {
+	mu    sync.Mutex
+	hosts map[string]map[string]time.Time // hostname -> IP -> expiry
+}
+
+func newLearnedHosts() *learnedHosts {
+	return &learnedHosts{hosts: make(map[string]map[string]time.Time)}
+}
+
+// Learn records addresses for a hostname and reports whether any were new, which
+// means the client's firewall rules must be re-applied to allow them.
+func (l *learnedHosts) Learn(name string, ips []net.IP, ttl time.Duration, now time.Time) bool {
+	ttl = min(max(ttl, minLearnedTTL), maxLearnedTTL)
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	addrs, ok := l.hosts[name]
+	if !ok {
+		addrs = make(map[string]time.Time)
+		l.hosts[name] = addrs
+	}
+	added := false
+	for _, ip := range ips {
+		key := ip.String()
+		if expiry, ok := addrs[key]; !ok || now.After(expiry) {
+			added = true
+		}
+		addrs[key] = now.Add(ttl)
+	}
+	return added
+}
+
+// Match returns the unexpired addresses of learned hostnames matching a wildcard
+// pattern and none of except, and forgets expired ones.
+func (l *learnedHosts) Match(pattern string, except []string, singleLabel bool, now time.Time) []net.IP {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var ips []net.IP
+	for name, addrs := range l.hosts {
+		for addr, expiry := range addrs {
+			if now.After(expiry) {
+				delete(addrs, addr)
+			}
+		}
+		if len(addrs) == 0 {
+			delete(l.hosts, name)
+			continue
+		}
+		if !matchesWildcard(pattern, except, name, singleLabel) {
+			continue
+		}
+		for addr := range addrs {
+			ips = append(ips, net.ParseIP(addr))
+		}
+	}
+	return ips
+}
+
+// matchesWildcard reports whether a hostname matches a wildcard pattern without
+// being one of the hostnames, or under one of the wildcards, the user's
+// exceptions take out of it.
+func matchesWildcard(pattern string, except []string, name string, singleLabel bool) bool {
+	if !firewall.MatchHostnameWildcard(pattern, name, singleLabel) {
+		return false
+	}
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	for _, e := range except {
+		e = strings.ToLower(strings.TrimSuffix(e, "."))
+		if e == name || (strings.HasPrefix(e, "*.") && strings.HasSuffix(name, e[1:])) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchesWildcardRule reports whether a hostname matches any of a client's
+// hostname wildcard rules.
+func matchesWildcardRule(rules *ClientRulesResponse, name string) bool {
+	for _, dest := range rules.Allowed {
+		if dest.Type == "hostname_wildcard" && matchesWildcard(dest.Value, dest.Except, name, rules.WildcardSingleLabel) {
+			return true
+		}
+	}
+	return false
+}
+
+// dnsProxy forwards clients' DNS queries to an upstream server and passes each
+// answer to onAnswer before returning it to the client.
+type dnsProxy struct {
+	upstream string
+	conn     net.PacketConn
+	onAnswer func(clientIP, name string, ips []net.IP, ttl time.Duration)
+}
+
+// newDNSProxy listens for DNS queries on addr. An empty upstream uses the first
+// nameserver in /etc/resolv.conf.
+func newDNSProxy(addr, upstream string, onAnswer func(clientIP, name string, ips []net.IP, ttl time.Duration)) (*dnsProxy, error) {
+	if upstream == "" {
+		var err error
+		if upstream, err = systemNameserver("/etc/resolv.conf"); err != nil {
+			return nil, err
+		}
+	}
+	if _, _, err := net.SplitHostPort(upstream); err != nil {
+		upstream = net.JoinHostPort(upstream, "53")
+	}
+
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &dnsProxy{upstream: upstream, conn: conn, onAnswer: onAnswer}, nil
+}
+
+// Serve handles queries until the proxy is closed.
+func (p *dnsProxy) Serve() error {
+	buf := make([]byte, 4096)
+	for {
+		n, client, err := p.conn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		query := append([]byte(nil), buf[:n]...)
+		go p.handle(query, client)
+	}
+}
+
+// Close stops the proxy.
+func (p *dnsProxy) Close() error {
+	return p.conn.Close()
+}
+
+// handle forwards one query and relays the answer.
+func (p *dnsProxy) handle(query []byte, client net.Addr) {
+	resp, err := p.exchange(query)
+	if err != nil {
+		logger.Debug("DNS proxy: upstream query failed", zap.Error(err))
+		return
+	}
+
+	if clientAddr, ok := client.(*net.UDPAddr); ok {
+		if name, ips, ttl, ok := parseDNSAnswer(resp); ok {
+			p.onAnswer(clientAddr.IP.String(), name, ips, ttl)
+		}
+	}
+
+	if _, err := p.conn.WriteTo(resp, client); err != nil {
+		logger.Debug("DNS proxy: failed to reply to client", zap.Error(err))
+	}
+}
+
+// exchange sends a query upstream and returns the response.
+func (p *dnsProxy) exchange(query []byte) ([]byte, error) {
+	conn, err := net.DialTimeout("udp", p.upstream, dnsUpstreamTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	_ = conn.SetDeadline(time.Now().Add(dnsUpstreamTimeout))
+	if _, err := conn.Write(query); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 4096)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf[:n], nil
+}
+
+// parseDNSAnswer returns the question name and the IPv4 addresses in a DNS
+// response, with the lowest TTL among them. Addresses reached through a CNAME
+// chain are attributed to the question name, which is what rules match on.
+func parseDNSAnswer(msg []byte) (string, []net.IP, time.Duration, bool) {
+	var p dnsmessage.Parser
+	header, err := p.Start(msg)
+	if err != nil || !header.Response || header.RCode != dnsmessage.RCodeSuccess {
+		return "", nil, 0, false
+	}
+	question, err := p.Question()
+	if err != nil {
+		return "", nil, 0, false
+	}
+	if err := p.SkipAllQuestions(); err != nil {
+		return "", nil, 0, false
+	}
+
+	var ips []net.IP
+	var ttl uint32
+	for {
+		h, err := p.AnswerHeader()
+		if err == dnsmessage.ErrSectionDone {
+			break
+		}
+		if err != nil {
+			return "", nil, 0, false
+		}
+		if h.Type != dnsmessage.TypeA {
+			if err := p.SkipAnswer(); err != nil {
+				return "", nil, 0, false
+			}
+			continue
+		}
+		a, err := p.AResource()
+		if err != nil {
+			return "", nil, 0, false
+		}
+		ips = append(ips, net.IPv4(a.A[0], a.A[1], a.A[2], a.A[3]))
+		if ttl == 0 || h.TTL < ttl {
+			ttl = h.TTL
+		}
+	}
+	if len(ips) == 0 {
+		return "", nil, 0, false
+	}
+	return question.Name.String(), ips, time.Duration(ttl) * time.Second, true
+}
+
+// systemNameserver returns the first nameserver in a resolv.conf file.
+func systemNameserver(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "nameserver" {
+			return fields[1], nil
+		}
+	}
+	return "", errors.New("no nameserver in " + path + "; set dns_proxy_upstream")
+}
+
+// handleWildcardAnswer allows a client the addresses of a name it looked up when
+// the name matches one of its hostname wildcard rules.
+func handleWildcardAnswer(cfg *GatewayConfig, clientIP, name string, ips []net.IP, ttl time.Duration) {
+	rules := connectedUsers.Rules(clientIP)
+	if rules == nil || !matchesWildcardRule(rules, name) {
+		return
+	}
+	if !wildcardHosts.Learn(name, ips, ttl, time.Now()) {
+		return
+	}
+	client, ok := connectedUsers.Client(clientIP)
+	if !ok {
+		return
+	}
+	if err := applyFirewallRules(cfg, clientIP, client.UserID, rules); err != nil {
+		logger.Warn("Failed to allow wildcard host for client",
+			zap.String("vpn_ip", clientIP),
+			zap.String("host", name),
+			zap.Error(err))
+		return
+	}
+	logger.Debug("Allowed wildcard host for client",
+		zap.String("vpn_ip", clientIP),
+		zap.String("host", name),
+		zap.Int("addresses", len(ips)))
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestLearnedHosts(t *testing.T) {
+	l := newLearnedHosts()
+	now := time.Now()
+	ip := net.ParseIP("10.0.0.5")
+
+	if !l.Learn("API.example.com.", []net.IP{ip}, 5*time.Minute, now) {
+		t.Fatal("expected first answer to add an address")
+	}
+	if l.Learn("api.example.com", []net.IP{ip}, 5*time.Minute, now) {
+		t.Error("expected repeated answer not to add an address")
+	}
+
+	if got := l.Match("*.example.com", nil, false, now); len(got) != 1 || !got[0].Equal(ip) {
+		t.Errorf("Match() = %v, want [%s]", got, ip)
+	}
+	if got := l.Match("*.example.org", nil, false, now); len(got) != 0 {
+		t.Errorf("Match() for another domain = %v, want none", got)
+	}
+	if got := l.Match("*.example.com", []string{"api.example.com"}, false, now); len(got) != 0 {
+		t.Errorf("Match() for an excepted host = %v, want none", got)
+	}
+
+	// A short TTL is raised to the minimum, then the address expires
+	if got := l.Match("*.example.com", nil, false, now.Add(4*time.Minute)); len(got) != 1 {
+		t.Errorf("Match() before expiry = %v, want 1 address", got)
+	}
+	if got := l.Match("*.example.com", nil, false, now.Add(6*time.Minute)); len(got) != 0 {
+		t.Errorf("Match() after expiry = %v, want none", got)
+	}
+}
+
+func TestParseDNSAnswer(t *testing.T) {
+	name := dnsmessage.MustNewName("app.example.com.")
+	target := dnsmessage.MustNewName("lb.example.net.")
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{Response: true})
+	_ = b.StartQuestions()
+	_ = b.Question(dnsmessage.Question{Name: name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET})
+	_ = b.StartAnswers()
+	_ = b.CNAMEResource(dnsmessage.ResourceHeader{Name: name, Class: dnsmessage.ClassINET, TTL: 300}, dnsmessage.CNAMEResource{CNAME: target})
+	_ = b.AResource(dnsmessage.ResourceHeader{Name: target, Class: dnsmessage.ClassINET, TTL: 60}, dnsmessage.AResource{A: [4]byte{10, 0, 0, 7}})
+	msg, err := b.Finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gotName, ips, ttl, ok := parseDNSAnswer(msg)
+	if !ok || gotName != "app.example.com." || len(ips) != 1 || !ips[0].Equal(net.ParseIP("10.0.0.7")) || ttl != time.Minute {
+		t.Errorf("parseDNSAnswer() = %q, %v, %s, %v", gotName, ips, ttl, ok)
+	}
+}
+
+func TestMatchesWildcardRule(t *testing.T) {
+	rules := &ClientRulesResponse{Allowed: []AllowedDestination{
+		{Type: "hostname", Value: "wiki.example.com"},
+		{Type: "hostname_wildcard", Value: "*.corp.example.com"},
+	}}
+	if !matchesWildcardRule(rules, "a.b.corp.example.com") {
+		t.Error("expected a nested name to match")
+	}
+	if matchesWildcardRule(rules, "wiki.example.com") {
+		t.Error("expected an exact hostname rule not to count as a wildcard")
+	}
+	rules.Allowed[1].Except = []string{"db.corp.example.com", "*.prod.corp.example.com"}
+	if matchesWildcardRule(rules, "DB.corp.example.com.") {
+		t.Error("expected an excepted hostname not to match")
+	}
+	if matchesWildcardRule(rules, "a.prod.corp.example.com") {
+		t.Error("expected a name under an excepted wildcard not to match")
+	}
+	if !matchesWildcardRule(rules, "prod.corp.example.com") {
+		t.Error("expected the excepted wildcard's own domain to still match")
+	}
+	rules.WildcardSingleLabel = true
+	if matchesWildcardRule(rules, "a.b.corp.example.com") {
+		t.Error("expected a nested name not to match with single-label wildcards")
+	}
+}
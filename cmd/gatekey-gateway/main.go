@@ -5,7 +5,12 @@ package main
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
 	"encoding/json"
+	"encoding/pem"
+	"errors"
 	"fmt"
 	"io"
 	"net"
@@ -13,17 +18,19 @@ import (
 	"os"
 	"os/exec"
 	"os/signal"
-	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
+	"github.com/fsnotify/fsnotify"
 	"github.com/google/uuid"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	"go.uber.org/zap"
 
 	"github.com/gatekey-project/gatekey/internal/agent"
+	"github.com/gatekey-project/gatekey/internal/agentlog"
 	"github.com/gatekey-project/gatekey/internal/firewall"
 	"github.com/gatekey-project/gatekey/internal/openvpn"
 	"github.com/gatekey-project/gatekey/internal/session"
@@ -33,11 +40,37 @@ var (
 	configPath       string
 	logger           *zap.Logger
 	firewallMgr      *firewall.Manager
-	connectedUsers   map[string]ConnectedClient // VPN IP -> client info
-	currentConfigVer string                     // Current config version from control plane
+	connectedUsers   = newClientRegistry() // Connected clients and their applied rules
+	configVerMu      sync.RWMutex
+	currentConfigVer string // Current config version from control plane, guarded by configVerMu
+
+	// Rules change detection. The heartbeat records the control plane's rules hash
+	// and the refresh loop only re-fetches rules when it differs from the applied one.
+	rulesHashMu      sync.Mutex
+	latestRulesHash  string    // Rules hash last reported by the control plane
+	appliedRulesHash string    // Rules hash the current firewall state was built from
+	lastFullRefresh  time.Time // Last time rules were refreshed for all clients
+	rulesChanged     = make(chan struct{}, 1)
+	clientsChanged   = make(chan struct{}, 1) // Signaled when files in clientsDir change
+
+	// controlPlane makes the agent's own requests to the control plane.
+	controlPlane = agent.NewControlPlaneClient(0)
+
+	// openvpnService is the primary OpenVPN server, resolved from the config by runAgent.
+	openvpnService = &openvpn.Service{ServiceConfig: openvpn.ServiceConfig{ConfigFile: openvpnServerDir + "/server.conf"}}
 )
 
-const configVersionFile = "/etc/gatekey/.config_version"
+// Agent state on disk; variables so tests can point them at a temporary directory.
+var (
+	configVersionFile = "/etc/gatekey/.config_version"
+	fingerprintsFile  = "/etc/gatekey/.fingerprints"
+	clientsDir        = "/var/run/gatekey/clients"
+	// provisionSignedFile records that the control plane has sent a verified
+	// signed provisioning response, after which unsigned ones are rejected
+	provisionSignedFile = "/etc/gatekey/.provision_signed"
+	// currentCAFile is the CA the gateway was last provisioned with
+	currentCAFile = openvpnServerDir + "/ca.crt"
+)
 
 // loadConfigVersion loads the persisted config version from disk
 func loadConfigVersion() string {
@@ -53,6 +86,63 @@ func saveConfigVersion(version string) error {
 	return os.WriteFile(configVersionFile, []byte(version), 0600)
 }
 
+// getConfigVersion returns the config version the gateway is running
+func getConfigVersion() string {
+	configVerMu.RLock()
+	defer configVerMu.RUnlock()
+	return currentConfigVer
+}
+
+// setConfigVersion records and persists a new config version
+func setConfigVersion(version string) {
+	configVerMu.Lock()
+	currentConfigVer = version
+	configVerMu.Unlock()
+
+	if err := saveConfigVersion(version); err != nil {
+		logger.Warn("Failed to save config version", zap.Error(err))
+	}
+}
+
+// loadFingerprints loads the provisioning fingerprints persisted after the last provision
+func loadFingerprints() map[string]string {
+	data, err := os.ReadFile(fingerprintsFile)
+	if err != nil {
+		return nil
+	}
+	var fps map[string]string
+	if err := json.Unmarshal(data, &fps); err != nil {
+		return nil
+	}
+	return fps
+}
+
+// saveFingerprints persists the provisioning fingerprints to disk
+func saveFingerprints(fps map[string]string) error {
+	data, err := json.Marshal(fps)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(fingerprintsFile, data, 0600)
+}
+
+// logChangedArtifacts asks the control plane which provisioning inputs changed
+// since the last provision and logs them, so operators can see why a reprovision
+// is happening.
+func logChangedArtifacts(client *openvpn.HookClient) {
+	versionResp, err := client.ConfigVersion()
+	if err != nil {
+		logger.Debug("Could not fetch provisioning fingerprints", zap.Error(err))
+		return
+	}
+	previous := loadFingerprints()
+	if previous == nil {
+		return
+	}
+	logger.Info("Provisioning inputs changed",
+		zap.Strings("artifacts", openvpn.ChangedArtifacts(previous, versionResp.Fingerprints)))
+}
+
 func main() {
 	rootCmd := &cobra.Command{
 		Use:   "gatekey-gateway",
@@ -90,15 +180,75 @@ func main() {
 
 // GatewayConfig holds gateway agent configuration.
 type GatewayConfig struct {
-	Name                string        `mapstructure:"name"`
-	ControlPlaneURL     string        `mapstructure:"control_plane_url"`
-	Token               string        `mapstructure:"token"`
+	Name            string `mapstructure:"name"`
+	ControlPlaneURL string `mapstructure:"control_plane_url"`
+	Token           string `mapstructure:"token"`
+	// ControlPlanePins are SHA-256 hashes of the control plane's public keys; when
+	// set, HTTPS connections to a control plane presenting none of them fail
+	ControlPlanePins    []string      `mapstructure:"control_plane_pins"`
 	HeartbeatInterval   time.Duration `mapstructure:"heartbeat_interval"`
 	RuleRefreshInterval time.Duration `mapstructure:"rule_refresh_interval"`
-	LogLevel            string        `mapstructure:"log_level"`
-	AgentListenAddr     string        `mapstructure:"agent_listen_addr"` // Agent API listen address (e.g., ":9443")
-	AgentEnabled        bool          `mapstructure:"agent_enabled"`     // Enable remote execution agent
-	SessionEnabled      bool          `mapstructure:"session_enabled"`   // Enable remote session support
+	// IntervalJitter moves each heartbeat and rule refresh by up to this fraction of
+	// its interval, so agents started together don't call the control plane in step
+	IntervalJitter float64 `mapstructure:"interval_jitter"`
+	// RuleFullRefreshInterval forces a full rule refresh even if the rules hash is unchanged
+	RuleFullRefreshInterval time.Duration `mapstructure:"rule_full_refresh_interval"`
+	// FirewallReconcileInterval is how often nftables is read back and repaired if it drifted
+	FirewallReconcileInterval time.Duration `mapstructure:"firewall_reconcile_interval"`
+	// HookTimeout bounds how long a hook waits for the control plane before denying
+	HookTimeout time.Duration `mapstructure:"hook_timeout"`
+	// VerifyCacheTTL caches successful verify results so rapid reconnects skip the control plane; 0 disables
+	VerifyCacheTTL  time.Duration `mapstructure:"verify_cache_ttl"`
+	AgentListenAddr string        `mapstructure:"agent_listen_addr"` // Agent API listen address (e.g., ":9443")
+	AgentEnabled    bool          `mapstructure:"agent_enabled"`     // Enable remote execution agent
+	SessionEnabled  bool          `mapstructure:"session_enabled"`   // Enable remote session support
+	// ProvisioningCAFingerprints pins the CAs provisioning responses may be signed
+	// with; when empty, the CA the gateway was last provisioned with is trusted,
+	// and the heartbeat's CA fingerprint only for the first provision
+	ProvisioningCAFingerprints []string `mapstructure:"provisioning_ca_fingerprints"`
+	// RequireSignedProvisioning rejects unsigned provisioning responses, which
+	// control planes that predate signing send. They're rejected anyway once the
+	// control plane has sent a signed one.
+	RequireSignedProvisioning bool `mapstructure:"require_signed_provisioning"`
+	// ListenAddress is the interface the agent API and metrics bind to when their
+	// addresses have no host; anything but loopback requires ListenPublic
+	ListenAddress string `mapstructure:"listen_address"`
+	ListenPublic  bool   `mapstructure:"listen_public"`
+	// MetricsListenAddr serves Prometheus metrics at /metrics; empty disables it
+	MetricsListenAddr string `mapstructure:"metrics_listen_addr"`
+	// ConfigProxyListenAddr serves a config download proxy for clients that can reach
+	// this gateway but not the control plane; empty disables it
+	ConfigProxyListenAddr string `mapstructure:"config_proxy_listen_addr"`
+	// TLS certificate and key for the config proxy, by default the OpenVPN server
+	// certificate; set both to "" to serve plain HTTP
+	ConfigProxyTLSCert string `mapstructure:"config_proxy_tls_cert"`
+	ConfigProxyTLSKey  string `mapstructure:"config_proxy_tls_key"`
+	// DNSProxyListenAddr serves DNS for clients so hostname wildcard rules can be
+	// enforced from their lookups; empty disables it
+	DNSProxyListenAddr string `mapstructure:"dns_proxy_listen_addr"`
+	// DNSProxyUpstream is where the DNS proxy forwards queries; empty uses the
+	// first nameserver in /etc/resolv.conf
+	DNSProxyUpstream string `mapstructure:"dns_proxy_upstream"`
+	// RuleResolver is the DNS server, an IP or IP:port, hostname access rules are
+	// resolved with; empty uses the system resolver
+	RuleResolver string `mapstructure:"rule_resolver"`
+	// DenyLog logs packets dropped by the default deny policy, up to DenyLogRate
+	// per second per client, and summarizes the blocked destinations
+	DenyLog     bool `mapstructure:"deny_log"`
+	DenyLogRate int  `mapstructure:"deny_log_rate"`
+	// DenyLogReportInterval is how often blocked destinations are summarized and
+	// reported to the control plane; 0 logs them each minute without reporting
+	DenyLogReportInterval time.Duration `mapstructure:"deny_log_report_interval"`
+	// PublicIPSources are where the public IP reported in heartbeats is looked up,
+	// in order: env (PUBLIC_IP), aws, gcp, azure and echo; empty turns detection off
+	PublicIPSources []string `mapstructure:"public_ip_sources"`
+	// PublicIPEchoURL returns the caller's address as plain text, for the echo source
+	PublicIPEchoURL string `mapstructure:"public_ip_echo_url"`
+	// PublicIPRefresh is how often the public IP is looked up again; 0 only looks it up at startup
+	PublicIPRefresh time.Duration `mapstructure:"public_ip_refresh"`
+
+	OpenVPN openvpn.ServiceConfig `mapstructure:",squash"` // openvpn_unit, openvpn_pid_file, openvpn_config_file
+	Logging agentlog.Config       `mapstructure:",squash"` // log_level, log_format, log_file, sampling
 }
 
 // ConnectedClient holds info about a connected VPN client.
@@ -116,6 +266,8 @@ type ClientRulesResponse struct {
 	ClientIP string               `json:"client_ip"`
 	Allowed  []AllowedDestination `json:"allowed"`
 	Default  string               `json:"default"`
+	// WildcardSingleLabel makes *.example.com match one label only
+	WildcardSingleLabel bool `json:"wildcard_single_label"`
 }
 
 // AllowedDestination represents an allowed destination.
@@ -124,18 +276,49 @@ type AllowedDestination struct {
 	Value    string `json:"value"`
 	Port     string `json:"port"`
 	Protocol string `json:"protocol"`
+	// Rule and Description identify the access rule that allows it
+	Rule        string `json:"rule"`
+	Description string `json:"description"`
+	// Except lists hostnames and wildcards a hostname wildcard must not match
+	Except []string `json:"except,omitempty"`
 }
 
 func loadConfig() (*GatewayConfig, error) {
 	v := viper.New()
 	v.SetConfigFile(configPath)
 
+	v.SetDefault("control_plane_pins", []string{})
+	v.SetDefault("provisioning_ca_fingerprints", []string{})
+	v.SetDefault("require_signed_provisioning", false)
 	v.SetDefault("heartbeat_interval", "30s")
 	v.SetDefault("rule_refresh_interval", "10s")
-	v.SetDefault("log_level", "info")
+	v.SetDefault("interval_jitter", agent.DefaultJitter)
+	v.SetDefault("rule_full_refresh_interval", "5m")
+	v.SetDefault("firewall_reconcile_interval", "1m")
+	v.SetDefault("hook_timeout", "10s")
+	v.SetDefault("verify_cache_ttl", "0s")
+	agentlog.SetDefaults(v.SetDefault)
 	v.SetDefault("agent_listen_addr", ":9443")
 	v.SetDefault("agent_enabled", true)
+	v.SetDefault("listen_address", agent.DefaultListenAddress)
+	v.SetDefault("listen_public", false)
 	v.SetDefault("session_enabled", true)
+	v.SetDefault("metrics_listen_addr", ":9102")
+	v.SetDefault("config_proxy_listen_addr", "")
+	v.SetDefault("config_proxy_tls_cert", "/etc/openvpn/server/server.crt")
+	v.SetDefault("config_proxy_tls_key", "/etc/openvpn/server/server.key")
+	v.SetDefault("dns_proxy_listen_addr", "")
+	v.SetDefault("dns_proxy_upstream", "")
+	v.SetDefault("rule_resolver", "")
+	v.SetDefault("deny_log", false)
+	v.SetDefault("deny_log_rate", firewall.DefaultDenyLogRate)
+	v.SetDefault("deny_log_report_interval", "1m")
+	v.SetDefault("public_ip_sources", agent.DefaultPublicIPSources)
+	v.SetDefault("public_ip_echo_url", agent.DefaultPublicIPEchoURL)
+	v.SetDefault("public_ip_refresh", agent.DefaultPublicIPRefresh)
+	v.SetDefault("openvpn_unit", "")
+	v.SetDefault("openvpn_pid_file", "/run/openvpn/server.pid")
+	v.SetDefault("openvpn_config_file", openvpnServerDir+"/server.conf")
 
 	if err := v.ReadInConfig(); err != nil {
 		return nil, fmt.Errorf("failed to read config: %w", err)
@@ -143,21 +326,39 @@ func loadConfig() (*GatewayConfig, error) {
 
 	v.SetEnvPrefix("GATEX")
 	v.AutomaticEnv()
+	if err := agent.LoadCredentials(v, "token", "control_plane_url"); err != nil {
+		return nil, err
+	}
 
 	var cfg GatewayConfig
 	if err := v.Unmarshal(&cfg); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
 	}
 
-	return &cfg, nil
-}
-
-func initLogger(level string) (*zap.Logger, error) {
-	cfg := zap.NewProductionConfig()
-	if level == "debug" {
-		cfg = zap.NewDevelopmentConfig()
+	// The config and DNS proxies serve VPN clients, so only the agent's own
+	// services are held to the listen address
+	var err error
+	if cfg.AgentListenAddr, err = agent.BindAddr(cfg.AgentListenAddr, cfg.ListenAddress, cfg.ListenPublic); err != nil {
+		return nil, fmt.Errorf("agent_listen_addr: %w", err)
+	}
+	if cfg.MetricsListenAddr, err = agent.BindAddr(cfg.MetricsListenAddr, cfg.ListenAddress, cfg.ListenPublic); err != nil {
+		return nil, fmt.Errorf("metrics_listen_addr: %w", err)
+	}
+	if err := agent.PinControlPlane(cfg.ControlPlaneURL, cfg.ControlPlanePins); err != nil {
+		return nil, err
+	}
+	if cfg.RuleResolver != "" {
+		if cfg.RuleResolver, err = parseResolverAddr(cfg.RuleResolver); err != nil {
+			return nil, fmt.Errorf("rule_resolver: %w", err)
+		}
+	}
+	for _, source := range cfg.PublicIPSources {
+		if !agent.ValidPublicIPSource(source) {
+			return nil, fmt.Errorf("public_ip_sources: unknown source %q", source)
+		}
 	}
-	return cfg.Build()
+
+	return &cfg, nil
 }
 
 func runAgent(cmd *cobra.Command, args []string) error {
@@ -166,7 +367,7 @@ func runAgent(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	logger, err = initLogger(cfg.LogLevel)
+	logger, err = agentlog.New(cfg.Logging)
 	if err != nil {
 		return err
 	}
@@ -176,13 +377,20 @@ func runAgent(cmd *cobra.Command, args []string) error {
 		zap.String("control_plane", cfg.ControlPlaneURL),
 	)
 
-	// Initialize connected users map
-	connectedUsers = make(map[string]ConnectedClient)
+	openvpnService, err = openvpn.NewService(cfg.OpenVPN, "openvpn-server@server", "openvpn@server")
+	if err != nil {
+		return err
+	}
+	if !openvpnService.Found() {
+		logger.Warn("No OpenVPN systemd unit found; set openvpn_unit if OpenVPN is installed under another name",
+			zap.String("unit", openvpnService.Unit))
+	}
 
 	// Initialize firewall manager
 	nftBackend, err := firewall.NewNFTablesBackend(firewall.NFTablesConfig{
 		TableName: "gatekey",
 		ChainName: "forward",
+		DenyLog:   firewall.DenyLogConfig{Enabled: cfg.DenyLog, Rate: cfg.DenyLogRate},
 	})
 	if err != nil {
 		logger.Warn("Failed to create nftables backend, firewall rules will not be enforced", zap.Error(err))
@@ -228,6 +436,67 @@ func runAgent(cmd *cobra.Command, args []string) error {
 		}()
 	}
 
+	// Serve local Prometheus metrics so each gateway can be scraped directly
+	var metricsServer *http.Server
+	if cfg.MetricsListenAddr != "" {
+		metricsServer = newMetricsServer(cfg.MetricsListenAddr)
+		go func() {
+			logger.Info("Starting metrics server", zap.String("addr", cfg.MetricsListenAddr))
+			if err := metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				logger.Error("Metrics server failed", zap.Error(err))
+			}
+		}()
+	}
+
+	// Forward config requests for clients that can't reach the control plane
+	var configProxyServer *http.Server
+	if cfg.ConfigProxyListenAddr != "" {
+		proxy, err := newConfigProxy(cfg.ControlPlaneURL, cfg.Token)
+		if err != nil {
+			return err
+		}
+		configProxyServer = newConfigProxyServer(cfg.ConfigProxyListenAddr, proxy, cfg.ConfigProxyTLSCert, cfg.ConfigProxyTLSKey)
+		go func() {
+			var err error
+			if configProxyServer.TLSConfig != nil {
+				logger.Info("Starting config proxy", zap.String("addr", cfg.ConfigProxyListenAddr))
+				err = configProxyServer.ListenAndServeTLS("", "")
+			} else {
+				logger.Warn("Starting config proxy without TLS; user credentials cross the network in cleartext",
+					zap.String("addr", cfg.ConfigProxyListenAddr))
+				err = configProxyServer.ListenAndServe()
+			}
+			if err != nil && err != http.ErrServerClosed {
+				logger.Error("Config proxy failed", zap.Error(err))
+			}
+		}()
+	}
+
+	if cfg.RuleResolver != "" {
+		ruleResolver = newPinnedResolver(cfg.RuleResolver)
+		logger.Info("Resolving hostname rules with pinned resolver", zap.String("server", cfg.RuleResolver))
+	}
+
+	// Serve DNS for clients so wildcard hostname rules follow their lookups
+	var dnsProxyServer *dnsProxy
+	if cfg.DNSProxyListenAddr != "" {
+		dnsProxyServer, err = newDNSProxy(cfg.DNSProxyListenAddr, cfg.DNSProxyUpstream,
+			func(clientIP, name string, ips []net.IP, ttl time.Duration) {
+				handleWildcardAnswer(cfg, clientIP, name, ips, ttl)
+			})
+		if err != nil {
+			return fmt.Errorf("failed to start DNS proxy: %w", err)
+		}
+		go func() {
+			logger.Info("Starting DNS proxy",
+				zap.String("addr", cfg.DNSProxyListenAddr),
+				zap.String("upstream", dnsProxyServer.upstream))
+			if err := dnsProxyServer.Serve(); err != nil {
+				logger.Error("DNS proxy failed", zap.Error(err))
+			}
+		}()
+	}
+
 	// Start remote session client (connects outbound to control plane)
 	var sessionClient *session.AgentClient
 	if cfg.SessionEnabled {
@@ -238,6 +507,7 @@ func runAgent(cmd *cobra.Command, args []string) error {
 			NodeID:          nodeName, // Use name as unique ID
 			NodeName:        nodeName,
 			Logger:          logger,
+			TLSConfig:       agent.ControlPlaneTLSConfig(),
 		})
 		sessionClient.Start(ctx)
 		logger.Info("Remote session client started")
@@ -249,6 +519,11 @@ func runAgent(cmd *cobra.Command, args []string) error {
 	// Start rule refresh loop
 	go ruleRefreshLoop(ctx, cfg)
 
+	// Summarize traffic denied by the default deny policy
+	if cfg.DenyLog && firewallMgr != nil {
+		go denyLogLoop(ctx, cfg)
+	}
+
 	// Wait for shutdown signal
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
@@ -265,6 +540,16 @@ func runAgent(cmd *cobra.Command, args []string) error {
 		}
 	}
 
+	if metricsServer != nil {
+		_ = metricsServer.Close()
+	}
+	if configProxyServer != nil {
+		_ = configProxyServer.Close()
+	}
+	if dnsProxyServer != nil {
+		_ = dnsProxyServer.Close()
+	}
+
 	// Stop session client
 	if sessionClient != nil {
 		sessionClient.Stop()
@@ -282,41 +567,45 @@ func runAgent(cmd *cobra.Command, args []string) error {
 
 func heartbeatLoop(ctx context.Context, cfg *GatewayConfig) {
 	client := openvpn.NewHookClient(cfg.ControlPlaneURL, cfg.Token)
-	ticker := time.NewTicker(cfg.HeartbeatInterval)
+	ticker := agent.NewTicker(cfg.HeartbeatInterval, cfg.IntervalJitter)
 	defer ticker.Stop()
 
 	// Load persisted config version from disk
+	configVerMu.Lock()
 	currentConfigVer = loadConfigVersion()
-	if currentConfigVer != "" {
-		logger.Info("Loaded config version from disk", zap.String("config_version", currentConfigVer))
+	configVerMu.Unlock()
+	if version := getConfigVersion(); version != "" {
+		logger.Info("Loaded config version from disk", zap.String("config_version", version))
 	}
 
-	// Get public IP on startup
-	publicIP := getPublicIP()
+	// Get public IP on startup and keep it current
+	publicIP := detectPublicIP(ctx, cfg.PublicIPSources, cfg.PublicIPEchoURL, cfg.PublicIPRefresh)
 
 	// Send initial heartbeat immediately
-	resp, err := client.Heartbeat(publicIP, 0, isOpenVPNRunning(), currentConfigVer)
+	resp, err := client.Heartbeat(publicIP.IP(), 0, isOpenVPNRunning(), getConfigVersion(), metrics.heartbeatMetrics())
+	metrics.heartbeat(err)
 	if err != nil {
 		logger.Warn("Initial heartbeat failed", zap.Error(err))
 	} else {
 		logger.Info("Initial heartbeat sent successfully",
 			zap.String("config_version", resp.ConfigVersion))
-		// If we have no config version, we need to reprovision to ensure our local files
-		// match what the server expects. Don't just adopt the server's version blindly.
-		if currentConfigVer == "" && resp.ConfigVersion != "" {
+		applyHeartbeatInterval(ticker, cfg, resp.MinHeartbeatInterval)
+		noteRulesHash(resp.RulesHash)
+		invalidateVerifyCache(resp)
+		if needsReprovision(getConfigVersion(), resp, true) {
 			logger.Info("No local config version - triggering initial provision",
 				zap.String("server_version", resp.ConfigVersion))
-			if err := handleReprovision(ctx, cfg, client); err != nil {
+			err := handleReprovision(ctx, cfg, client, resp.CAFingerprint, resp.ConfigVersion)
+			metrics.reprovision(err)
+			if err != nil {
 				logger.Error("Initial provision failed", zap.Error(err))
 			} else {
-				currentConfigVer = resp.ConfigVersion
-				if err := saveConfigVersion(currentConfigVer); err != nil {
-					logger.Warn("Failed to save config version", zap.Error(err))
-				}
+				setConfigVersion(resp.ConfigVersion)
 				logger.Info("Initial provision completed",
-					zap.String("config_version", currentConfigVer))
+					zap.String("config_version", resp.ConfigVersion))
 			}
 		}
+		reportServerConfigs(client)
 	}
 
 	for {
@@ -328,36 +617,116 @@ func heartbeatLoop(ctx context.Context, cfg *GatewayConfig) {
 			openvpnRunning := isOpenVPNRunning()
 			activeClients := getActiveClientCount()
 
-			resp, err := client.Heartbeat(publicIP, activeClients, openvpnRunning, currentConfigVer)
+			resp, err := client.Heartbeat(publicIP.IP(), activeClients, openvpnRunning, getConfigVersion(), metrics.heartbeatMetrics())
+			metrics.heartbeat(err)
 			if err != nil {
 				logger.Warn("Heartbeat failed", zap.Error(err))
 				continue
 			}
 
-			// Check if we need to reprovision
-			if resp.NeedsReprovision {
+			applyHeartbeatInterval(ticker, cfg, resp.MinHeartbeatInterval)
+			noteRulesHash(resp.RulesHash)
+			invalidateVerifyCache(resp)
+
+			if needsReprovision(getConfigVersion(), resp, false) {
 				logger.Info("Control plane signaled reprovision needed",
-					zap.String("current_version", currentConfigVer),
+					zap.String("current_version", getConfigVersion()),
 					zap.String("server_version", resp.ConfigVersion))
+				logChangedArtifacts(client)
 
-				if err := handleReprovision(ctx, cfg, client); err != nil {
+				err := handleReprovision(ctx, cfg, client, resp.CAFingerprint, resp.ConfigVersion)
+				metrics.reprovision(err)
+				if err != nil {
 					logger.Error("Reprovision failed", zap.Error(err))
 				} else {
 					// Update our config version after successful reprovision
-					currentConfigVer = resp.ConfigVersion
-					if err := saveConfigVersion(currentConfigVer); err != nil {
-						logger.Warn("Failed to save config version", zap.Error(err))
-					}
+					setConfigVersion(resp.ConfigVersion)
 					logger.Info("Reprovision completed successfully",
-						zap.String("new_config_version", currentConfigVer))
+						zap.String("new_config_version", resp.ConfigVersion))
 				}
 			}
+			reportServerConfigs(client)
+		}
+	}
+}
+
+// applyHeartbeatInterval slows heartbeats down to the minimum interval the control
+// plane asks for, or back to the configured interval once it stops asking.
+func applyHeartbeatInterval(ticker *agent.Ticker, cfg *GatewayConfig, minimumSeconds int) {
+	if ticker.SetInterval(agent.HeartbeatInterval(cfg.HeartbeatInterval, minimumSeconds)) {
+		logger.Info("Heartbeat interval changed", zap.Duration("interval", ticker.Interval()))
+	}
+}
+
+// needsReprovision reports whether a heartbeat response calls for a reprovision.
+// Later heartbeats follow the control plane's signal. On the first heartbeat after
+// startup, a gateway with no local config version provisions so its files match
+// what the server expects, rather than adopting the server's version blindly.
+func needsReprovision(localVersion string, resp *openvpn.HeartbeatResponse, initial bool) bool {
+	if initial {
+		return localVersion == "" && resp.ConfigVersion != ""
+	}
+	return resp.NeedsReprovision
+}
+
+// verifyProvision checks a provisioning response's signature before any of it is
+// written. The CA it was issued with must be pinned, be the CA the gateway runs
+// with or be endorsed by it; the heartbeat's caFingerprint is only trusted for a
+// gateway's first provision, as nothing else is available then. Unsigned
+// responses from older control planes are accepted with a warning, unless
+// require_signed_provisioning is set or the control plane has signed before.
+func verifyProvision(cfg *GatewayConfig, provResp *openvpn.ProvisionResponse, caFingerprint string) error {
+	trust := openvpn.ProvisionTrust{Pinned: cfg.ProvisioningCAFingerprints, Bootstrap: caFingerprint}
+	current, err := loadCurrentCA()
+	if err != nil {
+		return fmt.Errorf("rejected provisioning response: %w", err)
+	}
+	trust.Current = current
+
+	err = openvpn.VerifyProvision(provResp, trust)
+	if errors.Is(err, openvpn.ErrProvisionUnsigned) && !cfg.RequireSignedProvisioning && !provisionSigned() {
+		logger.Warn("Provisioning response is not signed; set require_signed_provisioning once the control plane is upgraded")
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("rejected provisioning response: %w", err)
+	}
+	if !provisionSigned() {
+		if err := os.WriteFile(provisionSignedFile, nil, 0600); err != nil {
+			logger.Warn("Failed to record that provisioning is signed", zap.Error(err))
 		}
 	}
+	return nil
+}
+
+// loadCurrentCA returns the CA the gateway was last provisioned with, or nil
+// before its first provision.
+func loadCurrentCA() (*x509.Certificate, error) {
+	data, err := os.ReadFile(currentCAFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read current CA: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("current CA %s is not PEM", currentCAFile)
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// provisionSigned reports whether the control plane has sent a verified signed
+// provisioning response, so an unsigned one now means it was tampered with.
+func provisionSigned() bool {
+	_, err := os.Stat(provisionSignedFile)
+	return err == nil
 }
 
 // handleReprovision fetches new certificates and config, updates files, and restarts OpenVPN.
-func handleReprovision(ctx context.Context, cfg *GatewayConfig, client *openvpn.HookClient) error {
+// caFingerprint and configVersion are the active CA and config version from the
+// heartbeat that triggered it.
+func handleReprovision(ctx context.Context, cfg *GatewayConfig, client *openvpn.HookClient, caFingerprint, configVersion string) error {
 	logger.Info("Starting reprovision...")
 
 	// Fetch new certificates and config from control plane
@@ -365,10 +734,24 @@ func handleReprovision(ctx context.Context, cfg *GatewayConfig, client *openvpn.
 	if err != nil {
 		return fmt.Errorf("failed to provision: %w", err)
 	}
+	if err := verifyProvision(cfg, provResp, caFingerprint); err != nil {
+		return err
+	}
+
+	// Work out the least disruptive way to apply what changed
+	scope, changed := reprovisionScopeFor(loadFingerprints(), provResp.Fingerprints, configVersion)
+	openvpnDir := openvpnServerDir
+
+	if scope == scopeNone {
+		logger.Info("No provisioning inputs changed, keeping OpenVPN running")
+		if err := syncListenEndpoints(openvpnDir, provResp.AdditionalEndpoints, false); err != nil {
+			return fmt.Errorf("failed to sync additional endpoints: %w", err)
+		}
+		return saveProvisionFingerprints(provResp)
+	}
 
 	// Update certificate files
 	// Note: Certs need 0644 for OpenVPN to read them (runs as openvpn user)
-	openvpnDir := "/etc/openvpn/server"
 	if err := os.WriteFile(openvpnDir+"/ca.crt", []byte(provResp.CACert), 0644); err != nil {
 		return fmt.Errorf("failed to write CA cert: %w", err)
 	}
@@ -384,97 +767,445 @@ func handleReprovision(ctx context.Context, cfg *GatewayConfig, client *openvpn.
 		if err := os.WriteFile(openvpnDir+"/ta.key", []byte(provResp.TLSAuthKey), 0600); err != nil {
 			return fmt.Errorf("failed to write TLS-Auth key: %w", err)
 		}
+
+		// Switch the control channel between tls-auth and tls-crypt if it changed
+		if conf, err := os.ReadFile(openvpnService.ConfigFile); err == nil {
+			updated := openvpn.SetServerTLSMode(conf, provResp.TLSMode, openvpnDir+"/ta.key")
+			if !bytes.Equal(conf, updated) {
+				if err := os.WriteFile(openvpnService.ConfigFile, updated, 0644); err != nil {
+					return fmt.Errorf("failed to update server config TLS mode: %w", err)
+				}
+				logger.Info("Updated server config TLS mode", zap.String("tls_mode", provResp.TLSMode))
+			}
+		}
+	}
+
+	// Issue session tokens on reconnect so clients aren't re-verified against the
+	// control plane until the token expires
+	if conf, err := os.ReadFile(openvpnService.ConfigFile); err == nil {
+		updated := openvpn.SetServerAuthGenToken(conf, provResp.AuthGenTokenLifetime)
+		if !bytes.Equal(conf, updated) {
+			if err := os.WriteFile(openvpnService.ConfigFile, updated, 0644); err != nil {
+				return fmt.Errorf("failed to update server config auth-gen-token: %w", err)
+			}
+			logger.Info("Updated server config auth-gen-token", zap.Int("lifetime_seconds", provResp.AuthGenTokenLifetime))
+		}
+	}
+
+	// Match the compression used in client configs; a mismatch stops clients
+	// connecting. Gateways on an older control plane don't send it.
+	if provResp.Compression != "" {
+		if conf, err := os.ReadFile(openvpnService.ConfigFile); err == nil {
+			updated := openvpn.SetServerCompression(conf, provResp.Compression)
+			if !bytes.Equal(conf, updated) {
+				if err := os.WriteFile(openvpnService.ConfigFile, updated, 0644); err != nil {
+					return fmt.Errorf("failed to update server config compression: %w", err)
+				}
+				logger.Info("Updated server config compression", zap.String("compression", provResp.Compression))
+			}
+		}
+	}
+
+	// Keepalive and MTU settings have to match client configs too
+	if provResp.LinkTuning != nil {
+		if conf, err := os.ReadFile(openvpnService.ConfigFile); err == nil {
+			updated := openvpn.SetServerLinkTuning(conf, *provResp.LinkTuning)
+			if !bytes.Equal(conf, updated) {
+				if err := os.WriteFile(openvpnService.ConfigFile, updated, 0644); err != nil {
+					return fmt.Errorf("failed to update server config link tuning: %w", err)
+				}
+				logger.Info("Updated server config keepalive and MTU settings")
+			}
+		}
+	}
+
+	if scope == scopeReload {
+		// CA and TLS key changes only need OpenVPN to re-read its files; SIGHUP does
+		// that without restarting the process, though clients still reconnect
+		logger.Info("Certificates updated, reloading OpenVPN...", zap.Strings("changed", changed))
+		if err := reloadOpenVPN(); err != nil {
+			logger.Warn("Reload failed, falling back to restart", zap.Error(err))
+			if err := restartOpenVPN(); err != nil {
+				return fmt.Errorf("failed to restart OpenVPN: %w", err)
+			}
+		}
+	} else {
+		logger.Info("Certificates updated, restarting OpenVPN...", zap.Strings("changed", changed))
+
+		// Restart OpenVPN to pick up new config
+		if err := restartOpenVPN(); err != nil {
+			return fmt.Errorf("failed to restart OpenVPN: %w", err)
+		}
 	}
 
-	logger.Info("Certificates updated, restarting OpenVPN...")
+	// Bring additional listen endpoints in line with the control plane
+	if err := syncListenEndpoints(openvpnDir, provResp.AdditionalEndpoints, true); err != nil {
+		return fmt.Errorf("failed to sync additional endpoints: %w", err)
+	}
+
+	return saveProvisionFingerprints(provResp)
+}
+
+// reprovisionScope is how much of OpenVPN a reprovision has to disturb.
+type reprovisionScope int
 
-	// Restart OpenVPN to pick up new config
-	if err := restartOpenVPN(); err != nil {
-		return fmt.Errorf("failed to restart OpenVPN: %w", err)
+const (
+	scopeNone    reprovisionScope = iota // nothing the primary server reads changed
+	scopeReload                          // only files or directives OpenVPN re-reads on SIGHUP changed
+	scopeRestart                         // listener or crypto settings changed
+)
+
+// reprovisionScopeFor compares fingerprints from the last provision with the new
+// ones and returns the required scope and the changed artifacts. Without fingerprints
+// on either side, or when an admin asked for the reprovision, it falls back to a
+// full restart, which also writes the newly issued server certificate.
+func reprovisionScopeFor(previous, current map[string]string, configVersion string) (reprovisionScope, []string) {
+	if len(previous) == 0 || len(current) == 0 || strings.HasPrefix(configVersion, openvpn.ReprovisionVersionPrefix) {
+		return scopeRestart, nil
 	}
 
+	changed := openvpn.ChangedArtifacts(previous, current)
+	scope := scopeNone
+	for _, name := range changed {
+		switch name {
+		case "endpoints":
+			// Handled by syncListenEndpoints without touching the primary instance
+		case "ca", "tls", "session":
+			if scope < scopeReload {
+				scope = scopeReload
+			}
+		default:
+			scope = scopeRestart
+		}
+	}
+	return scope, changed
+}
+
+// saveProvisionFingerprints records the fingerprints of a completed provision.
+func saveProvisionFingerprints(provResp *openvpn.ProvisionResponse) error {
+	if len(provResp.Fingerprints) == 0 {
+		return nil
+	}
+	if err := saveFingerprints(provResp.Fingerprints); err != nil {
+		logger.Warn("Failed to save provisioning fingerprints", zap.Error(err))
+	}
 	return nil
 }
 
-// restartOpenVPN restarts the OpenVPN service.
-func restartOpenVPN() error {
-	// Try systemctl first (most common)
-	cmd := exec.Command("systemctl", "restart", "openvpn-server@server")
-	if err := cmd.Run(); err != nil {
-		// Try alternative service name
-		cmd = exec.Command("systemctl", "restart", "openvpn@server")
-		if err := cmd.Run(); err != nil {
-			return fmt.Errorf("failed to restart OpenVPN service: %w", err)
+// syncListenEndpoints runs one OpenVPN instance per additional endpoint (e.g. TCP 443
+// fallback), each derived from the primary server config, and stops instances for
+// endpoints that were removed. Instances whose config is unchanged are left running,
+// or sent SIGHUP when reload is set because shared certificates changed.
+func syncListenEndpoints(openvpnDir string, endpoints []openvpn.ProvisionEndpoint, reload bool) error {
+	base, err := os.ReadFile(openvpnService.ConfigFile)
+	if err != nil {
+		if len(endpoints) == 0 {
+			return nil
+		}
+		return fmt.Errorf("failed to read primary server config: %w", err)
+	}
+
+	wanted := make(map[string]bool)
+	for i, ep := range endpoints {
+		name := openvpn.EndpointInstanceName(ep.Protocol, ep.Port)
+		wanted[name] = true
+
+		// Each instance needs its own management port; the primary uses 7505
+		conf := openvpn.DeriveEndpointServerConfig(base, ep.Protocol, ep.Port, ep.VPNNetwork, ep.VPNNetmask, 7506+i)
+		service := openvpnService.InstanceUnit(name)
+		if existing, err := os.ReadFile(openvpnDir + "/" + name + ".conf"); err == nil && bytes.Equal(existing, conf) &&
+			exec.Command("systemctl", "is-active", "--quiet", service).Run() == nil {
+			if reload {
+				if err := exec.Command("systemctl", "kill", "--signal=HUP", service).Run(); err != nil {
+					logger.Warn("Failed to reload endpoint instance", zap.String("instance", name), zap.Error(err))
+				}
+			}
+			continue
+		}
+		if err := os.WriteFile(openvpnDir+"/"+name+".conf", conf, 0644); err != nil {
+			return fmt.Errorf("failed to write config for %s: %w", name, err)
+		}
+		if err := exec.Command("systemctl", "enable", service).Run(); err != nil {
+			logger.Warn("Failed to enable endpoint service", zap.String("instance", name), zap.Error(err))
+		}
+		if err := exec.Command("systemctl", "restart", service).Run(); err != nil {
+			return fmt.Errorf("failed to start OpenVPN instance %s: %w", name, err)
+		}
+		logger.Info("Additional endpoint running",
+			zap.String("instance", name),
+			zap.String("protocol", ep.Protocol),
+			zap.Int("port", ep.Port),
+			zap.String("subnet", ep.VPNSubnet))
+	}
+
+	// Stop and remove instances for endpoints that are no longer configured
+	entries, err := os.ReadDir(openvpnDir)
+	if err != nil {
+		return nil
+	}
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry.Name(), ".conf")
+		if name == entry.Name() || name == "server" || wanted[name] {
+			continue
+		}
+		path := openvpnDir + "/" + entry.Name()
+		data, err := os.ReadFile(path)
+		if err != nil || !strings.HasPrefix(string(data), openvpn.EndpointConfigHeader) {
+			continue
 		}
+		_ = exec.Command("systemctl", "disable", "--now", openvpnService.InstanceUnit(name)).Run()
+		if err := os.Remove(path); err != nil {
+			logger.Warn("Failed to remove endpoint config", zap.String("path", path), zap.Error(err))
+		}
+		logger.Info("Removed additional endpoint", zap.String("instance", name))
 	}
 	return nil
 }
 
-// getPublicIP attempts to determine the public IP address
-func getPublicIP() string {
-	// Try to get from environment first (set by cloud metadata)
-	if ip := os.Getenv("PUBLIC_IP"); ip != "" {
-		return ip
+// reloadOpenVPN sends SIGHUP to the OpenVPN service so it re-reads its config,
+// certificates, and keys without the process restarting.
+func reloadOpenVPN() error {
+	return openvpnService.Reload()
+}
+
+// restartOpenVPN restarts the OpenVPN service.
+func restartOpenVPN() error {
+	return openvpnService.Restart()
+}
+
+// detectPublicIP looks up the public IP reported in heartbeats and refreshes it
+// in the background every refresh.
+func detectPublicIP(ctx context.Context, sources []string, echoURL string, refresh time.Duration) *agent.PublicIPDetector {
+	detector := agent.NewPublicIPDetector(sources, echoURL)
+	if len(sources) == 0 {
+		return detector
+	}
+	if ip, source, _, err := detector.Refresh(ctx); err != nil {
+		logger.Warn("Could not detect public IP; set PUBLIC_IP or public_ip_sources", zap.Error(err))
+	} else {
+		logger.Info("Detected public IP", zap.String("ip", ip), zap.String("source", source))
 	}
-	// Could also query a metadata service or external IP service
-	return ""
+	go detector.Run(ctx, refresh, func(ip, source string, err error) {
+		if err != nil {
+			logger.Warn("Public IP refresh failed", zap.Error(err))
+			return
+		}
+		logger.Info("Public IP changed", zap.String("ip", ip), zap.String("source", source))
+	})
+	return detector
 }
 
 // isOpenVPNRunning checks if OpenVPN process is running
 func isOpenVPNRunning() bool {
-	// Check if openvpn process exists by looking for pid file or process
-	if _, err := os.Stat("/run/openvpn/server.pid"); err == nil {
-		return true
-	}
-	if _, err := os.Stat("/var/run/openvpn/server.pid"); err == nil {
-		return true
-	}
-	return false
+	return openvpnService.Running()
 }
 
 // getActiveClientCount returns the number of active OpenVPN clients
 func getActiveClientCount() int {
 	// Could parse OpenVPN status file or management interface
 	// For now return count of connected users
-	return len(connectedUsers)
+	return connectedUsers.Count()
 }
 
 // ruleRefreshLoop periodically refreshes firewall rules for connected clients.
 func ruleRefreshLoop(ctx context.Context, cfg *GatewayConfig) {
-	ticker := time.NewTicker(cfg.RuleRefreshInterval)
+	ticker := agent.NewTicker(cfg.RuleRefreshInterval, cfg.IntervalJitter)
 	defer ticker.Stop()
 
 	// Ensure clients directory exists
 	_ = os.MkdirAll(clientsDir, 0750)
 
+	// Apply and remove rules as soon as clients connect or disconnect; the ticker
+	// remains as a fallback when inotify isn't available
+	go watchClientsDir(ctx)
+
+	// Read back nftables periodically in case rules were changed outside gatekey
+	var reconcileC <-chan time.Time
+	if cfg.FirewallReconcileInterval > 0 {
+		reconcileTicker := time.NewTicker(cfg.FirewallReconcileInterval)
+		defer reconcileTicker.Stop()
+		reconcileC = reconcileTicker.C
+	}
+
 	logger.Info("Started rule refresh loop", zap.Duration("interval", cfg.RuleRefreshInterval))
 
 	for {
 		select {
 		case <-ctx.Done():
 			return
+		case <-reconcileC:
+			reconcileFirewall(ctx)
+			continue
 		case <-ticker.C:
-			// Sync connected clients from files
-			syncConnectedClients(cfg)
+		case <-rulesChanged:
+		case <-clientsChanged:
+		}
 
-			// Refresh rules for all connected clients
-			refreshAllClientRules(cfg)
+		// Sync connected clients from files
+		syncConnectedClients(cfg)
+
+		// Refresh rules for all connected clients, unless nothing changed
+		hash, refresh := rulesRefreshNeeded(cfg)
+		if !refresh {
+			continue
+		}
+		if refreshAllClientRules(cfg) {
+			markRulesApplied(hash)
+		} else {
+			metrics.ruleRefreshFailures.Add(1)
 		}
 	}
 }
 
-// refreshAllClientRules refreshes firewall rules for all connected clients.
-func refreshAllClientRules(cfg *GatewayConfig) {
+// reconcileFirewall compares the nftables ruleset with the rules applied for
+// connected clients and repairs any drift.
+func reconcileFirewall(ctx context.Context) {
 	if firewallMgr == nil {
 		return
 	}
 
-	for vpnIP, client := range connectedUsers {
+	drift, err := firewallMgr.Reconcile(ctx)
+	if err != nil {
+		logger.Error("Failed to reconcile firewall rules", zap.Error(err))
+	}
+	if drift == nil || drift.Empty() {
+		return
+	}
+
+	logger.Warn("Firewall drift detected, rules may have been modified outside gatekey",
+		zap.Strings("repaired", drift.Repaired),
+		zap.Strings("orphaned", drift.Orphaned),
+		zap.Int("unknown_rules", drift.Unknown))
+}
+
+// watchClientsDir signals clientsChanged whenever the connect/disconnect hooks
+// write or remove a client file. If the watcher can't be set up, the refresh loop
+// keeps polling on its interval.
+func watchClientsDir(ctx context.Context) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		logger.Warn("File watcher unavailable, falling back to polling for client changes", zap.Error(err))
+		return
+	}
+	defer watcher.Close()
+
+	if err := watcher.Add(clientsDir); err != nil {
+		logger.Warn("Failed to watch clients directory, falling back to polling",
+			zap.String("dir", clientsDir), zap.Error(err))
+		return
+	}
+	logger.Info("Watching clients directory for connect/disconnect events", zap.String("dir", clientsDir))
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if !strings.HasSuffix(event.Name, ".json") || event.Op == fsnotify.Chmod {
+				continue
+			}
+			// Coalesce bursts; the refresh loop re-reads the whole directory
+			select {
+			case clientsChanged <- struct{}{}:
+			default:
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			logger.Warn("Clients directory watcher error", zap.Error(err))
+		}
+	}
+}
+
+// noteRulesHash records the rules hash reported by the control plane and wakes
+// the refresh loop if it differs from the applied one.
+func noteRulesHash(hash string) {
+	rulesHashMu.Lock()
+	latestRulesHash = hash
+	changed := hash == "" || hash != appliedRulesHash
+	rulesHashMu.Unlock()
+
+	if !changed {
+		metrics.ruleSynced()
+	}
+
+	if changed {
+		select {
+		case rulesChanged <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// rulesRefreshNeeded reports whether rules must be re-fetched for all clients and
+// returns the hash that the refresh will bring the firewall up to.
+// Control planes that don't report a hash fall back to refreshing every interval.
+func rulesRefreshNeeded(cfg *GatewayConfig) (string, bool) {
+	rulesHashMu.Lock()
+	defer rulesHashMu.Unlock()
+
+	if latestRulesHash == "" || latestRulesHash != appliedRulesHash {
+		return latestRulesHash, true
+	}
+	if cfg.RuleFullRefreshInterval > 0 && time.Since(lastFullRefresh) >= cfg.RuleFullRefreshInterval {
+		return latestRulesHash, true
+	}
+	return latestRulesHash, false
+}
+
+// markRulesApplied records that the firewall reflects the given rules hash.
+func markRulesApplied(hash string) {
+	rulesHashMu.Lock()
+	appliedRulesHash = hash
+	lastFullRefresh = time.Now()
+	rulesHashMu.Unlock()
+
+	metrics.ruleSynced()
+}
+
+// rulesFingerprint returns a stable digest of a client's rules, used to skip
+// re-applying firewall rules that haven't changed. Rule names and descriptions
+// are left out, since renaming a rule doesn't change what it allows.
+func rulesFingerprint(rules *ClientRulesResponse) string {
+	allowed := make([]AllowedDestination, len(rules.Allowed))
+	for i, dest := range rules.Allowed {
+		dest.Rule, dest.Description = "", ""
+		allowed[i] = dest
+	}
+	data, _ := json.Marshal(struct {
+		Allowed             []AllowedDestination `json:"allowed"`
+		Default             string               `json:"default"`
+		WildcardSingleLabel bool                 `json:"wildcard_single_label"`
+	}{allowed, rules.Default, rules.WildcardSingleLabel})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// refreshAllClientRules refreshes firewall rules for all connected clients.
+// Rules are only re-applied for clients whose rules actually changed.
+// Returns false if any client could not be refreshed.
+func refreshAllClientRules(cfg *GatewayConfig) bool {
+	if firewallMgr == nil {
+		return true
+	}
+
+	ok := true
+	for vpnIP, client := range connectedUsers.Snapshot() {
 		rules, err := fetchClientRules(cfg, client.UserID, client.UserEmail, client.UserGroups, vpnIP)
 		if err != nil {
 			logger.Warn("Failed to refresh rules for client",
 				zap.String("vpn_ip", vpnIP),
 				zap.Error(err))
+			ok = false
+			continue
+		}
+
+		fingerprint := rulesFingerprint(rules)
+		if connectedUsers.RuleHash(vpnIP) == fingerprint {
 			continue
 		}
 
@@ -483,8 +1214,16 @@ func refreshAllClientRules(cfg *GatewayConfig) {
 			logger.Warn("Failed to apply refreshed rules",
 				zap.String("vpn_ip", vpnIP),
 				zap.Error(err))
+			connectedUsers.SetRuleHash(vpnIP, "")
+			ok = false
+			continue
 		}
+		connectedUsers.SetRuleHash(vpnIP, fingerprint)
+		logger.Debug("Applied changed rules for client",
+			zap.String("vpn_ip", vpnIP),
+			zap.Int("rule_count", len(rules.Allowed)))
 	}
+	return ok
 }
 
 // fetchClientRules fetches access rules for a client from the control plane.
@@ -509,7 +1248,7 @@ func fetchClientRules(cfg *GatewayConfig, userID, userEmail string, userGroups [
 	}
 
 	url := strings.TrimSuffix(cfg.ControlPlaneURL, "/") + "/api/v1/gateway/client-rules"
-	resp, err := http.Post(url, "application/json", bytes.NewReader(body))
+	resp, err := controlPlane.PostIdempotent(context.Background(), url, body)
 	if err != nil {
 		return nil, fmt.Errorf("failed to send request: %w", err)
 	}
@@ -539,6 +1278,35 @@ func applyFirewallRules(cfg *GatewayConfig, clientIP, userID string, rules *Clie
 	var ports []firewall.PortRange
 
 	for _, dest := range rules.Allowed {
+		// Parse port and protocol first; a destination with an invalid restriction is
+		// skipped entirely so it can't fall back to allowing all ports.
+		protocol, err := firewall.ParseProtocol(dest.Protocol)
+		if err != nil {
+			logger.Warn("Skipping destination with invalid protocol",
+				zap.String("rule", dest.Rule),
+				zap.String("value", dest.Value),
+				zap.Error(err))
+			continue
+		}
+		var portRange *firewall.PortRange
+		if dest.Port != "" && dest.Port != "*" {
+			start, end, err := firewall.ParsePortRange(dest.Port)
+			if err != nil {
+				logger.Warn("Skipping destination with invalid port range",
+					zap.String("rule", dest.Rule),
+					zap.String("value", dest.Value),
+					zap.Error(err))
+				continue
+			}
+			portRange = &firewall.PortRange{Protocol: protocol, Port: start}
+			if end != start {
+				portRange.PortEnd = end
+			}
+		} else if protocol != firewall.ProtocolAny {
+			// A protocol without a port still restricts the destination to that protocol
+			portRange = &firewall.PortRange{Protocol: protocol}
+		}
+
 		switch dest.Type {
 		case "ip":
 			// Single IP - convert to /32
@@ -554,53 +1322,38 @@ func applyFirewallRules(cfg *GatewayConfig, clientIP, userID string, rules *Clie
 			if err == nil && ipnet != nil {
 				networks = append(networks, *ipnet)
 			}
-		case "hostname", "hostname_wildcard":
-			// Resolve hostname to IP
-			ips, err := net.LookupIP(dest.Value)
-			if err == nil {
-				for _, ip := range ips {
-					if ip4 := ip.To4(); ip4 != nil {
-						networks = append(networks, net.IPNet{
-							IP:   ip4,
-							Mask: net.CIDRMask(32, 32),
-						})
-					}
-				}
-			}
-		}
-
-		// Parse port if specified
-		if dest.Port != "" && dest.Port != "*" {
-			protocol := firewall.ProtocolAny
-			switch dest.Protocol {
-			case "tcp":
-				protocol = firewall.ProtocolTCP
-			case "udp":
-				protocol = firewall.ProtocolUDP
-			}
-
-			if strings.Contains(dest.Port, "-") {
-				// Port range
-				parts := strings.Split(dest.Port, "-")
-				if len(parts) == 2 {
-					start, _ := strconv.Atoi(parts[0])
-					end, _ := strconv.Atoi(parts[1])
-					ports = append(ports, firewall.PortRange{
-						Protocol: protocol,
-						Port:     start,
-						PortEnd:  end,
+		case "hostname_wildcard":
+			// Addresses learned from the client's DNS lookups through the DNS proxy
+			for _, ip := range wildcardHosts.Match(dest.Value, dest.Except, rules.WildcardSingleLabel, time.Now()) {
+				if ip4 := ip.To4(); ip4 != nil {
+					networks = append(networks, net.IPNet{
+						IP:   ip4,
+						Mask: net.CIDRMask(32, 32),
 					})
 				}
-			} else {
-				port, _ := strconv.Atoi(dest.Port)
-				if port > 0 {
-					ports = append(ports, firewall.PortRange{
-						Protocol: protocol,
-						Port:     port,
+			}
+		case "hostname":
+			// Resolve hostname to IP
+			ips, err := resolveRuleHostname(context.Background(), ruleResolver, dest.Value)
+			if err != nil {
+				logger.Warn("Failed to resolve hostname rule",
+					zap.String("rule", dest.Rule),
+					zap.String("hostname", dest.Value),
+					zap.Error(err))
+			}
+			for _, ip := range ips {
+				if ip4 := ip.To4(); ip4 != nil {
+					networks = append(networks, net.IPNet{
+						IP:   ip4,
+						Mask: net.CIDRMask(32, 32),
 					})
 				}
 			}
 		}
+
+		if portRange != nil {
+			ports = append(ports, *portRange)
+		}
 	}
 
 	// Parse client's VPN IP
@@ -620,7 +1373,11 @@ func applyFirewallRules(cfg *GatewayConfig, clientIP, userID string, rules *Clie
 
 	// Apply rules
 	ctx := context.Background()
-	return firewallMgr.ApplyRules(ctx, connectionID, uid, sourceIP, networks, ports)
+	if err := firewallMgr.ApplyRules(ctx, connectionID, uid, sourceIP, networks, ports); err != nil {
+		return err
+	}
+	connectedUsers.SetRules(clientIP, rules)
+	return nil
 }
 
 // removeFirewallRules removes firewall rules for a disconnected client.
@@ -649,6 +1406,7 @@ func handleHook(cmd *cobra.Command, args []string) error {
 	}
 
 	client := openvpn.NewHookClient(cfg.ControlPlaneURL, cfg.Token)
+	client.SetTimeout(cfg.HookTimeout)
 	req := openvpn.BuildHookRequest(openvpn.HookType(hookType))
 
 	// Handle file-based credentials for auth-user-pass-verify
@@ -666,15 +1424,32 @@ func handleHook(cmd *cobra.Command, args []string) error {
 
 	switch openvpn.HookType(hookType) {
 	case openvpn.HookAuthUserPassVerify, openvpn.HookTLSVerify:
+		if cfg.VerifyCacheTTL > 0 && verifyCached(req) {
+			fmt.Println("Access granted (cached)")
+			os.Exit(0)
+		}
 		resp, err := client.Verify(req)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Verification failed: %v\n", err)
+			if openvpn.IsTimeout(err) {
+				fmt.Fprintf(os.Stderr, "Access denied: control plane did not respond within %s\n", cfg.HookTimeout)
+			} else {
+				fmt.Fprintf(os.Stderr, "Verification failed: %v\n", err)
+			}
 			os.Exit(1)
 		}
 		if !resp.Allow {
-			fmt.Fprintf(os.Stderr, "Access denied: %s\n", resp.Message)
+			message := openvpn.DenialMessage(resp.ReasonCode, resp.Message)
+			fmt.Fprintf(os.Stderr, "Access denied for %s: %s\n", req.CommonName, message)
+			if err := openvpn.WriteAuthFailedReason(message); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: failed to write auth failure reason: %v\n", err)
+			}
 			os.Exit(1)
 		}
+		if cfg.VerifyCacheTTL > 0 {
+			if err := cacheVerifyResult(req, cfg.VerifyCacheTTL); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: failed to cache verify result: %v\n", err)
+			}
+		}
 		fmt.Println("Access granted")
 		os.Exit(0)
 
@@ -684,6 +1459,10 @@ func handleHook(cmd *cobra.Command, args []string) error {
 			fmt.Fprintf(os.Stderr, "Connect notification failed: %v\n", err)
 			os.Exit(1)
 		}
+		if !resp.Allow {
+			fmt.Fprintf(os.Stderr, "Connection denied for %s: %s\n", req.CommonName, openvpn.DenialMessage(resp.ReasonCode, resp.Message))
+			os.Exit(1)
+		}
 
 		// Write client config if provided
 		if len(resp.ClientConfig) > 0 && len(args) > 0 {
@@ -733,8 +1512,6 @@ func printJSON(v interface{}) {
 	fmt.Println(string(data))
 }
 
-const clientsDir = "/var/run/gatekey/clients"
-
 // writeClientFile writes client info to a file for the daemon.
 func writeClientFile(vpnIP string, client ConnectedClient) error {
 	if err := os.MkdirAll(clientsDir, 0750); err != nil {
@@ -791,9 +1568,8 @@ func syncConnectedClients(cfg *GatewayConfig) {
 
 	// Check for new connections
 	for vpnIP, client := range fileClients {
-		if _, exists := connectedUsers[vpnIP]; !exists {
+		if connectedUsers.Add(vpnIP, client) {
 			// New client connected
-			connectedUsers[vpnIP] = client
 			logger.Info("New client detected",
 				zap.String("vpn_ip", vpnIP),
 				zap.String("user_id", client.UserID))
@@ -812,6 +1588,7 @@ func syncConnectedClients(cfg *GatewayConfig) {
 					zap.String("vpn_ip", vpnIP),
 					zap.Error(err))
 			} else {
+				connectedUsers.SetRuleHash(vpnIP, rulesFingerprint(rules))
 				logger.Info("Applied firewall rules for client",
 					zap.String("vpn_ip", vpnIP),
 					zap.Int("rule_count", len(rules.Allowed)))
@@ -820,7 +1597,7 @@ func syncConnectedClients(cfg *GatewayConfig) {
 	}
 
 	// Check for disconnections
-	for vpnIP := range connectedUsers {
+	for vpnIP := range connectedUsers.Snapshot() {
 		if _, exists := fileClients[vpnIP]; !exists {
 			// Client disconnected
 			logger.Info("Client disconnected",
@@ -833,7 +1610,7 @@ func syncConnectedClients(cfg *GatewayConfig) {
 					zap.Error(err))
 			}
 
-			delete(connectedUsers, vpnIP)
+			connectedUsers.Remove(vpnIP)
 		}
 	}
 }
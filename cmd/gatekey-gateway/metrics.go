@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gatekey-project/gatekey/internal/openvpn"
+)
+
+// openvpnServerDir holds the OpenVPN server configs the agent manages.
+const openvpnServerDir = "/etc/openvpn/server"
+
+// agentMetrics counts rule enforcement and provisioning events for the local
+// /metrics endpoint and the heartbeat. Fields are updated from the heartbeat and
+// refresh loops, so they are all atomic.
+type agentMetrics struct {
+	lastRuleSync        atomic.Int64 // Unix nanoseconds; last time the firewall was confirmed current
+	ruleRefreshFailures atomic.Int64
+	reprovisions        atomic.Int64
+	reprovisionFailures atomic.Int64
+	lastHeartbeat       atomic.Int64 // Unix nanoseconds of the last successful heartbeat
+	heartbeatFailures   atomic.Int64
+}
+
+var metrics = &agentMetrics{}
+
+// ruleSynced records that the applied rules match the control plane, either after
+// a refresh or because a heartbeat reported an unchanged rules hash.
+func (m *agentMetrics) ruleSynced() {
+	m.lastRuleSync.Store(time.Now().UnixNano())
+}
+
+// heartbeat records the outcome of a heartbeat.
+func (m *agentMetrics) heartbeat(err error) {
+	if err != nil {
+		m.heartbeatFailures.Add(1)
+		return
+	}
+	m.lastHeartbeat.Store(time.Now().UnixNano())
+}
+
+// reprovision records the outcome of a reprovision.
+func (m *agentMetrics) reprovision(err error) {
+	if err != nil {
+		m.reprovisionFailures.Add(1)
+		return
+	}
+	m.reprovisions.Add(1)
+}
+
+// firewallRuleCount returns the number of allow rules applied, or 0 without a
+// firewall backend.
+func firewallRuleCount() int {
+	if firewallMgr == nil {
+		return 0
+	}
+	return firewallMgr.RuleCount()
+}
+
+// heartbeatMetrics returns the metrics reported to the control plane.
+func (m *agentMetrics) heartbeatMetrics() *openvpn.HeartbeatMetrics {
+	hm := &openvpn.HeartbeatMetrics{
+		FirewallRules:       firewallRuleCount(),
+		RuleRefreshFailures: m.ruleRefreshFailures.Load(),
+		Reprovisions:        m.reprovisions.Load(),
+	}
+	if ns := m.lastRuleSync.Load(); ns != 0 {
+		t := time.Unix(0, ns)
+		hm.LastRuleSync = &t
+	}
+	hm.IPPools = ipPoolUsage(openvpnServerDir, openvpnService.ConfigFile)
+	return hm
+}
+
+// ipPoolUsage returns the address pool usage of the primary OpenVPN server and
+// each additional endpoint instance in openvpnDir.
+func ipPoolUsage(openvpnDir, primary string) []openvpn.PoolUsage {
+	var pools []openvpn.PoolUsage
+	if conf, err := os.ReadFile(primary); err == nil {
+		if usage := openvpn.ServerPoolUsage(conf); usage != nil {
+			pools = append(pools, *usage)
+		}
+	}
+	entries, err := os.ReadDir(openvpnDir)
+	if err != nil {
+		return pools
+	}
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), ".conf") {
+			continue
+		}
+		conf, err := os.ReadFile(filepath.Join(openvpnDir, entry.Name()))
+		if err != nil || !bytes.HasPrefix(conf, []byte(openvpn.EndpointConfigHeader)) {
+			continue
+		}
+		if usage := openvpn.ServerPoolUsage(conf); usage != nil {
+			pools = append(pools, *usage)
+		}
+	}
+	return pools
+}
+
+// write renders the metrics in the Prometheus text format.
+func (m *agentMetrics) write(w io.Writer, now time.Time) {
+	gauge := func(name, help string, value float64) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %g\n", name, help, name, name, value)
+	}
+	counter := func(name, help string, value int64) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n%s %d\n", name, help, name, name, value)
+	}
+	timestamp := func(ns int64) float64 {
+		if ns == 0 {
+			return 0
+		}
+		return float64(ns) / float64(time.Second)
+	}
+
+	gauge("gatekey_gateway_active_clients", "Connected VPN clients.", float64(getActiveClientCount()))
+	gauge("gatekey_gateway_firewall_rules", "Firewall allow rules applied for connected clients.", float64(firewallRuleCount()))
+
+	lastSync := m.lastRuleSync.Load()
+	gauge("gatekey_gateway_rule_sync_timestamp_seconds", "Last time the applied rules were confirmed current with the control plane.", timestamp(lastSync))
+	// Without a sync yet, report staleness as -1 rather than time since the epoch
+	age := -1.0
+	if lastSync != 0 {
+		age = now.Sub(time.Unix(0, lastSync)).Seconds()
+	}
+	gauge("gatekey_gateway_rule_sync_age_seconds", "Seconds since the applied rules were last confirmed current; -1 before the first sync.", age)
+	counter("gatekey_gateway_rule_refresh_failures_total", "Rule refreshes that failed for at least one client.", m.ruleRefreshFailures.Load())
+
+	fmt.Fprintf(w, "# HELP gatekey_gateway_reprovisions_total Reprovisions by result.\n# TYPE gatekey_gateway_reprovisions_total counter\n")
+	fmt.Fprintf(w, "gatekey_gateway_reprovisions_total{result=\"success\"} %d\n", m.reprovisions.Load())
+	fmt.Fprintf(w, "gatekey_gateway_reprovisions_total{result=\"failure\"} %d\n", m.reprovisionFailures.Load())
+
+	if pools := ipPoolUsage(openvpnServerDir, openvpnService.ConfigFile); len(pools) > 0 {
+		fmt.Fprintf(w, "# HELP gatekey_gateway_ip_pool_size Client addresses each OpenVPN server's pool can hand out.\n# TYPE gatekey_gateway_ip_pool_size gauge\n")
+		for _, p := range pools {
+			fmt.Fprintf(w, "gatekey_gateway_ip_pool_size{subnet=%q} %d\n", p.Subnet, p.Size)
+		}
+		fmt.Fprintf(w, "# HELP gatekey_gateway_ip_pool_used Pool addresses taken by connected clients or static assignments.\n# TYPE gatekey_gateway_ip_pool_used gauge\n")
+		for _, p := range pools {
+			fmt.Fprintf(w, "gatekey_gateway_ip_pool_used{subnet=%q} %d\n", p.Subnet, p.Used)
+		}
+	}
+
+	gauge("gatekey_gateway_heartbeat_timestamp_seconds", "Last successful heartbeat to the control plane.", timestamp(m.lastHeartbeat.Load()))
+	counter("gatekey_gateway_heartbeat_failures_total", "Heartbeats that failed.", m.heartbeatFailures.Load())
+}
+
+// metricsHandler serves the agent's metrics.
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	metrics.write(w, time.Now())
+}
+
+// newMetricsServer returns the HTTP server for /metrics on addr.
+func newMetricsServer(addr string) *http.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", metricsHandler)
+	return &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+}
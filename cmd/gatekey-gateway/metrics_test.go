@@ -0,0 +1,38 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAgentMetricsWrite(t *testing.T) {
+	m := &agentMetrics{}
+	now := time.Now()
+
+	var out strings.Builder
+	m.write(&out, now)
+	if !strings.Contains(out.String(), "gatekey_gateway_rule_sync_age_seconds -1\n") {
+		t.Errorf("expected -1 staleness before the first sync:\n%s", out.String())
+	}
+
+	m.lastRuleSync.Store(now.Add(-90 * time.Second).UnixNano())
+	m.ruleRefreshFailures.Add(2)
+	m.reprovision(nil)
+	m.reprovision(errors.New("provision failed"))
+
+	out.Reset()
+	m.write(&out, now)
+	for _, want := range []string{
+		"gatekey_gateway_rule_sync_age_seconds 90\n",
+		"gatekey_gateway_rule_refresh_failures_total 2\n",
+		`gatekey_gateway_reprovisions_total{result="success"} 1` + "\n",
+		`gatekey_gateway_reprovisions_total{result="failure"} 1` + "\n",
+		"# TYPE gatekey_gateway_active_clients gauge\n",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("metrics missing %q:\n%s", want, out.String())
+		}
+	}
+}
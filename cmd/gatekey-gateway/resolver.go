@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+)
+
+// Hostname access rules are resolved on the gateway each time they're applied. By
+// default that goes through the system resolver, which on a VPN gateway may itself
+// be routed through a tunnel, answer differently per interface or be tampered
+// with. rule_resolver pins these lookups to one trusted server instead, so every
+// gateway resolves a rule to the same addresses.
+
+// ruleResolver resolves hostname access rules; set from rule_resolver by runAgent.
+var ruleResolver = net.DefaultResolver
+
+// ruleResolveTimeout bounds one hostname rule lookup.
+const ruleResolveTimeout = 5 * time.Second
+
+// parseResolverAddr returns a resolver address as host:port, defaulting to port
+// 53. The host must be an IP address, since resolving the resolver's own name
+// would go through the system resolver it's meant to replace.
+func parseResolverAddr(addr string) (string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		host, port = addr, "53"
+	}
+	if net.ParseIP(host) == nil {
+		return "", fmt.Errorf("%q is not an IP address or IP:port", addr)
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+// newPinnedResolver returns a resolver that sends every DNS query to server,
+// a host:port, instead of the nameservers in /etc/resolv.conf.
+func newPinnedResolver(server string) *net.Resolver {
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, server)
+		},
+	}
+}
+
+// resolveRuleHostname returns the IPv4 addresses of a hostname rule's target.
+func resolveRuleHostname(ctx context.Context, resolver *net.Resolver, host string) ([]net.IP, error) {
+	ctx, cancel := context.WithTimeout(ctx, ruleResolveTimeout)
+	defer cancel()
+	return resolver.LookupIP(ctx, "ip4", host)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestParseResolverAddr(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"10.0.0.2", "10.0.0.2:53"},
+		{"10.0.0.2:5353", "10.0.0.2:5353"},
+		{"[2001:db8::53]:53", "[2001:db8::53]:53"},
+		{"2001:db8::53", "[2001:db8::53]:53"},
+		{"dns.example.com", ""},
+		{"dns.example.com:53", ""},
+	}
+	for _, tt := range tests {
+		got, err := parseResolverAddr(tt.in)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("parseResolverAddr(%q) = %q, want error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("parseResolverAddr(%q) = %q, %v, want %q", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+// TestPinnedResolver checks hostname rules are resolved through the pinned server.
+func TestPinnedResolver(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			var p dnsmessage.Parser
+			hdr, err := p.Start(buf[:n])
+			if err != nil {
+				continue
+			}
+			q, err := p.Question()
+			if err != nil {
+				continue
+			}
+			b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: hdr.ID, Response: true, Authoritative: true})
+			_ = b.StartQuestions()
+			_ = b.Question(q)
+			_ = b.StartAnswers()
+			if q.Type == dnsmessage.TypeA {
+				_ = b.AResource(dnsmessage.ResourceHeader{Name: q.Name, Class: dnsmessage.ClassINET, TTL: 60}, dnsmessage.AResource{A: [4]byte{10, 0, 0, 9}})
+			}
+			msg, err := b.Finish()
+			if err != nil {
+				continue
+			}
+			_, _ = conn.WriteTo(msg, addr)
+		}
+	}()
+
+	resolver := newPinnedResolver(conn.LocalAddr().String())
+	ips, err := resolveRuleHostname(context.Background(), resolver, "app.gatekey-test.invalid")
+	if err != nil {
+		t.Fatalf("resolveRuleHostname() error = %v", err)
+	}
+	if len(ips) != 1 || !ips[0].Equal(net.ParseIP("10.0.0.9")) {
+		t.Errorf("resolveRuleHostname() = %v, want [10.0.0.9]", ips)
+	}
+}
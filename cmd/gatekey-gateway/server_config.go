@@ -0,0 +1,71 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/gatekey-project/gatekey/internal/openvpn"
+)
+
+// reportedServerConfigs is a hash of the server configs last reported to the
+// control plane, so unchanged configs aren't resent on every heartbeat. Only the
+// heartbeat loop uses it.
+var reportedServerConfigs string
+
+// serverConfigs reads the primary server config, reported as "server", and those
+// of additional endpoints in openvpnDir, keyed by OpenVPN instance name, with key
+// material redacted.
+func serverConfigs(openvpnDir, primary string) map[string]string {
+	configs := make(map[string]string)
+	if data, err := os.ReadFile(primary); err == nil {
+		configs["server"] = string(openvpn.RedactConfig(data))
+	}
+	entries, err := os.ReadDir(openvpnDir)
+	if err != nil {
+		return configs
+	}
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), ".conf")
+		if !ok {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(openvpnDir, entry.Name()))
+		if err != nil {
+			continue
+		}
+		if strings.HasPrefix(string(data), openvpn.EndpointConfigHeader) {
+			configs[name] = string(openvpn.RedactConfig(data))
+		}
+	}
+	return configs
+}
+
+// reportServerConfigs sends the gateway's server configs to the control plane if
+// they changed since the last report, whether through a reprovision or by hand.
+func reportServerConfigs(client *openvpn.HookClient) {
+	configs := serverConfigs(openvpnServerDir, openvpnService.ConfigFile)
+	if len(configs) == 0 {
+		return
+	}
+	data, err := json.Marshal(configs)
+	if err != nil {
+		return
+	}
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	if hash == reportedServerConfigs {
+		return
+	}
+	// Older control planes don't accept reports, so failures aren't worth a warning
+	if err := client.ReportServerConfigs(configs); err != nil {
+		logger.Debug("Failed to report server configs", zap.Error(err))
+		return
+	}
+	reportedServerConfigs = hash
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/gatekey-project/gatekey/internal/openvpn"
+)
+
+// verifyCacheDir holds successful verify results. Each hook runs in its own
+// process, so the cache lives on disk; the agent daemon clears it whenever the
+// control plane signals a revocation or a rules change.
+var verifyCacheDir = "/var/run/gatekey/verify-cache"
+
+type verifyCacheEntry struct {
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// verifyCacheKey identifies a verify request by everything the control plane
+// decides on, hashed so credentials never reach the disk.
+func verifyCacheKey(req openvpn.HookRequest) string {
+	h := sha256.New()
+	for _, part := range []string{string(req.Type), req.CommonName, req.Username, req.Password, req.TLSSerial, req.UntrustedIP} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// verifyCached reports whether an unexpired successful result is cached for req.
+func verifyCached(req openvpn.HookRequest) bool {
+	path := filepath.Join(verifyCacheDir, verifyCacheKey(req))
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	var entry verifyCacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil || time.Now().After(entry.ExpiresAt) {
+		_ = os.Remove(path)
+		return false
+	}
+	return true
+}
+
+// cacheVerifyResult records a successful verify result for ttl.
+func cacheVerifyResult(req openvpn.HookRequest, ttl time.Duration) error {
+	if err := os.MkdirAll(verifyCacheDir, 0700); err != nil {
+		return err
+	}
+	data, err := json.Marshal(verifyCacheEntry{ExpiresAt: time.Now().Add(ttl)})
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(verifyCacheDir, verifyCacheKey(req))
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// clearVerifyCache drops all cached verify results.
+func clearVerifyCache() error {
+	entries, err := os.ReadDir(verifyCacheDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			_ = os.Remove(filepath.Join(verifyCacheDir, entry.Name()))
+		}
+	}
+	return nil
+}
+
+// verifyCacheSignal is the revocation epoch and rules hash the cached results were
+// issued under. Only the heartbeat loop touches it.
+var verifyCacheSignal string
+
+// invalidateVerifyCache clears cached verify results when a heartbeat reports a
+// revocation or a rules change since the last one. The first heartbeat always
+// clears, since results may predate an agent restart.
+func invalidateVerifyCache(resp *openvpn.HeartbeatResponse) {
+	signal := resp.RevocationEpoch + "/" + resp.RulesHash
+	if signal == verifyCacheSignal {
+		return
+	}
+	verifyCacheSignal = signal
+	if err := clearVerifyCache(); err != nil {
+		logger.Warn("Failed to clear verify cache", zap.Error(err))
+	}
+}
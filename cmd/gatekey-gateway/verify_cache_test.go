@@ -0,0 +1,58 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/gatekey-project/gatekey/internal/openvpn"
+)
+
+func TestVerifyCache(t *testing.T) {
+	verifyCacheDir = t.TempDir()
+	logger = zap.NewNop()
+	verifyCacheSignal = ""
+
+	req := openvpn.HookRequest{Type: openvpn.HookAuthUserPassVerify, CommonName: "alice", Password: "token", UntrustedIP: "203.0.113.5"}
+	if verifyCached(req) {
+		t.Fatal("expected empty cache")
+	}
+
+	if err := cacheVerifyResult(req, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if !verifyCached(req) {
+		t.Fatal("expected cached result")
+	}
+
+	other := req
+	other.Password = "other-token"
+	if verifyCached(other) {
+		t.Error("a different auth token must not hit the cache")
+	}
+
+	// The first heartbeat clears results that may predate an agent restart
+	invalidateVerifyCache(&openvpn.HeartbeatResponse{RulesHash: "r1"})
+	if verifyCached(req) {
+		t.Error("expected first heartbeat to clear the cache")
+	}
+
+	_ = cacheVerifyResult(req, time.Minute)
+	invalidateVerifyCache(&openvpn.HeartbeatResponse{RulesHash: "r1"})
+	if !verifyCached(req) {
+		t.Error("unchanged heartbeat should keep cached results")
+	}
+
+	invalidateVerifyCache(&openvpn.HeartbeatResponse{RulesHash: "r1", RevocationEpoch: "1"})
+	if verifyCached(req) {
+		t.Error("expected a revocation to clear the cache")
+	}
+
+	if err := cacheVerifyResult(req, -time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if verifyCached(req) {
+		t.Error("expected expired result to be ignored")
+	}
+}
@@ -4,7 +4,6 @@
 package main
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -14,7 +13,7 @@ import (
 	"os"
 	"os/exec"
 	"os/signal"
-	"strconv"
+	"path/filepath"
 	"strings"
 	"sync"
 	"syscall"
@@ -26,7 +25,9 @@ import (
 	"go.uber.org/zap"
 
 	"github.com/gatekey-project/gatekey/internal/agent"
+	"github.com/gatekey-project/gatekey/internal/agentlog"
 	"github.com/gatekey-project/gatekey/internal/firewall"
+	"github.com/gatekey-project/gatekey/internal/openvpn"
 	"github.com/gatekey-project/gatekey/internal/session"
 )
 
@@ -35,6 +36,12 @@ var (
 	logger           *zap.Logger
 	currentConfigVer string
 	firewallMgr      *firewall.Manager
+
+	// controlPlane makes the hub's requests to the control plane.
+	controlPlane = agent.NewControlPlaneClient(0)
+
+	// openvpnService is the hub's OpenVPN server, resolved by loadConfig.
+	openvpnService *openvpn.Service
 )
 
 const configVersionFile = "/etc/gatekey-hub/.config_version"
@@ -83,16 +90,29 @@ The hub communicates with the GateKey control plane to:
 
 // HubConfig holds hub configuration
 type HubConfig struct {
-	Name              string        `mapstructure:"name"`
-	ControlPlaneURL   string        `mapstructure:"control_plane_url"`
-	APIToken          string        `mapstructure:"api_token"`
+	Name            string `mapstructure:"name"`
+	ControlPlaneURL string `mapstructure:"control_plane_url"`
+	APIToken        string `mapstructure:"api_token"`
+	// ControlPlanePins are SHA-256 hashes of the control plane's public keys; when
+	// set, HTTPS connections to a control plane presenting none of them fail
+	ControlPlanePins  []string      `mapstructure:"control_plane_pins"`
 	VPNPort           int           `mapstructure:"vpn_port"`
 	VPNProtocol       string        `mapstructure:"vpn_protocol"`
 	HeartbeatInterval time.Duration `mapstructure:"heartbeat_interval"`
-	LogLevel          string        `mapstructure:"log_level"`
 	AgentListenAddr   string        `mapstructure:"agent_listen_addr"` // Agent API listen address (e.g., ":9443")
 	AgentEnabled      bool          `mapstructure:"agent_enabled"`     // Enable remote execution agent
 	SessionEnabled    bool          `mapstructure:"session_enabled"`   // Enable remote session support
+	// ListenAddress is the interface the agent API binds to when its address has
+	// no host; anything but loopback requires ListenPublic
+	ListenAddress string `mapstructure:"listen_address"`
+	ListenPublic  bool   `mapstructure:"listen_public"`
+	// IntervalJitter moves each heartbeat and control plane poll by up to this
+	// fraction of its interval, so hubs started together don't call the control
+	// plane in step
+	IntervalJitter float64 `mapstructure:"interval_jitter"`
+
+	OpenVPN openvpn.ServiceConfig `mapstructure:",squash"` // openvpn_unit, openvpn_pid_file, openvpn_config_file
+	Logging agentlog.Config       `mapstructure:",squash"` // log_level, log_format, log_file, sampling
 }
 
 // ProvisionResponse from control plane
@@ -103,6 +123,7 @@ type ProvisionResponse struct {
 	DHParams       string `json:"dhparams"`
 	TLSAuthEnabled bool   `json:"tlsauthenabled"`
 	TLSAuthKey     string `json:"tlsauthkey"`
+	TLSMode        string `json:"tlsmode"`
 	VPNPort        int    `json:"vpnport"`
 	VPNProtocol    string `json:"vpnprotocol"`
 	VPNSubnet      string `json:"vpnsubnet"`
@@ -115,19 +136,29 @@ type HeartbeatResponse struct {
 	OK               bool   `json:"ok"`
 	NeedsReprovision bool   `json:"needsReprovision"`
 	ConfigVersion    string `json:"configVersion"`
+	// MinHeartbeatInterval is the shortest heartbeat interval in seconds the control
+	// plane wants agents to use; 0 leaves it to the hub
+	MinHeartbeatInterval int `json:"minHeartbeatInterval,omitempty"`
 }
 
 func loadConfig() (*HubConfig, error) {
 	v := viper.New()
 	v.SetConfigFile(configPath)
 
+	v.SetDefault("control_plane_pins", []string{})
 	v.SetDefault("vpn_port", 1194)
 	v.SetDefault("vpn_protocol", "udp")
 	v.SetDefault("heartbeat_interval", "30s")
-	v.SetDefault("log_level", "info")
+	v.SetDefault("interval_jitter", agent.DefaultJitter)
+	agentlog.SetDefaults(v.SetDefault)
 	v.SetDefault("agent_listen_addr", ":9443")
 	v.SetDefault("agent_enabled", true)
+	v.SetDefault("listen_address", agent.DefaultListenAddress)
+	v.SetDefault("listen_public", false)
 	v.SetDefault("session_enabled", true)
+	v.SetDefault("openvpn_unit", "")
+	v.SetDefault("openvpn_pid_file", "")
+	v.SetDefault("openvpn_config_file", "/etc/openvpn/server/hub.conf")
 
 	if err := v.ReadInConfig(); err != nil {
 		return nil, fmt.Errorf("failed to read config: %w", err)
@@ -135,21 +166,27 @@ func loadConfig() (*HubConfig, error) {
 
 	v.SetEnvPrefix("GATEKEY_HUB")
 	v.AutomaticEnv()
+	if err := agent.LoadCredentials(v, "api_token", "control_plane_url"); err != nil {
+		return nil, err
+	}
 
 	var cfg HubConfig
 	if err := v.Unmarshal(&cfg); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
 	}
 
-	return &cfg, nil
-}
-
-func initLogger(level string) (*zap.Logger, error) {
-	cfg := zap.NewProductionConfig()
-	if level == "debug" {
-		cfg = zap.NewDevelopmentConfig()
+	var err error
+	if cfg.AgentListenAddr, err = agent.BindAddr(cfg.AgentListenAddr, cfg.ListenAddress, cfg.ListenPublic); err != nil {
+		return nil, fmt.Errorf("agent_listen_addr: %w", err)
+	}
+	if openvpnService, err = openvpn.NewService(cfg.OpenVPN, "openvpn-server@hub", "openvpn@hub"); err != nil {
+		return nil, err
 	}
-	return cfg.Build()
+	if err := agent.PinControlPlane(cfg.ControlPlaneURL, cfg.ControlPlanePins); err != nil {
+		return nil, err
+	}
+
+	return &cfg, nil
 }
 
 func loadConfigVersion() string {
@@ -170,7 +207,7 @@ func runHub(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	logger, err = initLogger(cfg.LogLevel)
+	logger, err = agentlog.New(cfg.Logging)
 	if err != nil {
 		return err
 	}
@@ -181,6 +218,10 @@ func runHub(cmd *cobra.Command, args []string) error {
 		zap.String("control_plane", cfg.ControlPlaneURL),
 		zap.Int("vpn_port", cfg.VPNPort),
 	)
+	if !openvpnService.Found() {
+		logger.Warn("No OpenVPN systemd unit found; set openvpn_unit if OpenVPN is installed under another name",
+			zap.String("unit", openvpnService.Unit))
+	}
 
 	// Load persisted config version
 	currentConfigVer = loadConfigVersion()
@@ -251,6 +292,7 @@ func runHub(cmd *cobra.Command, args []string) error {
 			NodeID:          cfg.Name, // Use name as unique ID
 			NodeName:        cfg.Name,
 			Logger:          logger,
+			TLSConfig:       agent.ControlPlaneTLSConfig(),
 		})
 		sessionClient.Start(ctx)
 		logger.Info("Remote session client started")
@@ -297,11 +339,13 @@ func runHub(cmd *cobra.Command, args []string) error {
 }
 
 func heartbeatLoop(ctx context.Context, cfg *HubConfig) {
-	ticker := time.NewTicker(cfg.HeartbeatInterval)
+	ticker := agent.NewTicker(cfg.HeartbeatInterval, cfg.IntervalJitter)
 	defer ticker.Stop()
 
 	// Send initial heartbeat
-	sendHeartbeat(ctx, cfg)
+	if resp, err := sendHeartbeat(ctx, cfg); err == nil {
+		applyHeartbeatInterval(ticker, cfg, resp.MinHeartbeatInterval)
+	}
 
 	for {
 		select {
@@ -313,6 +357,7 @@ func heartbeatLoop(ctx context.Context, cfg *HubConfig) {
 				logger.Warn("Heartbeat failed", zap.Error(err))
 				continue
 			}
+			applyHeartbeatInterval(ticker, cfg, resp.MinHeartbeatInterval)
 
 			if resp.NeedsReprovision {
 				logger.Info("Control plane signaled reprovision needed",
@@ -338,6 +383,14 @@ func heartbeatLoop(ctx context.Context, cfg *HubConfig) {
 	}
 }
 
+// applyHeartbeatInterval slows heartbeats down to the minimum interval the control
+// plane asks for, or back to the configured interval once it stops asking.
+func applyHeartbeatInterval(ticker *agent.Ticker, cfg *HubConfig, minimumSeconds int) {
+	if ticker.SetInterval(agent.HeartbeatInterval(cfg.HeartbeatInterval, minimumSeconds)) {
+		logger.Info("Heartbeat interval changed", zap.Duration("interval", ticker.Interval()))
+	}
+}
+
 func sendHeartbeat(ctx context.Context, cfg *HubConfig) (*HeartbeatResponse, error) {
 	reqBody := struct {
 		Token             string `json:"token"`
@@ -359,7 +412,7 @@ func sendHeartbeat(ctx context.Context, cfg *HubConfig) (*HeartbeatResponse, err
 	}
 
 	url := strings.TrimSuffix(cfg.ControlPlaneURL, "/") + "/api/v1/mesh-hub/heartbeat"
-	resp, err := http.Post(url, "application/json", bytes.NewReader(body))
+	resp, err := controlPlane.PostIdempotent(ctx, url, body)
 	if err != nil {
 		return nil, fmt.Errorf("failed to send request: %w", err)
 	}
@@ -384,7 +437,7 @@ func provisionHub(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	logger, err = initLogger(cfg.LogLevel)
+	logger, err = agentlog.New(cfg.Logging)
 	if err != nil {
 		return err
 	}
@@ -409,7 +462,7 @@ func doProvision(ctx context.Context, cfg *HubConfig) error {
 	}
 
 	url := strings.TrimSuffix(cfg.ControlPlaneURL, "/") + "/api/v1/mesh-hub/provision"
-	resp, err := http.Post(url, "application/json", bytes.NewReader(body))
+	resp, err := controlPlane.Post(ctx, url, body)
 	if err != nil {
 		return fmt.Errorf("failed to send request: %w", err)
 	}
@@ -442,16 +495,6 @@ func doProvision(ctx context.Context, cfg *HubConfig) error {
 		return fmt.Errorf("failed to write server key: %w", err)
 	}
 
-	// Generate DH params if needed
-	dhPath := openvpnDir + "/dh.pem"
-	if _, err := os.Stat(dhPath); os.IsNotExist(err) {
-		logger.Info("Generating DH parameters (this may take a while)...")
-		cmd := exec.Command("openssl", "dhparam", "-out", dhPath, "2048")
-		if err := cmd.Run(); err != nil {
-			return fmt.Errorf("failed to generate DH params: %w", err)
-		}
-	}
-
 	// Write TLS-Auth key if enabled
 	if provResp.TLSAuthEnabled && provResp.TLSAuthKey != "" {
 		if err := os.WriteFile(openvpnDir+"/ta.key", []byte(provResp.TLSAuthKey), 0600); err != nil {
@@ -461,7 +504,7 @@ func doProvision(ctx context.Context, cfg *HubConfig) error {
 
 	// Generate OpenVPN server config
 	serverConfig := generateServerConfig(provResp)
-	if err := os.WriteFile(openvpnDir+"/hub.conf", []byte(serverConfig), 0644); err != nil {
+	if err := os.WriteFile(openvpnService.ConfigFile, []byte(serverConfig), 0644); err != nil {
 		return fmt.Errorf("failed to write server config: %w", err)
 	}
 
@@ -493,10 +536,17 @@ func generateServerConfig(prov ProvisionResponse) string {
 	sb.WriteString("# Certificate files\n")
 	sb.WriteString("ca /etc/openvpn/server/ca.crt\n")
 	sb.WriteString("cert /etc/openvpn/server/server.crt\n")
-	sb.WriteString("key /etc/openvpn/server/server.key\n")
-	sb.WriteString("dh /etc/openvpn/server/dh.pem\n\n")
+	sb.WriteString("key /etc/openvpn/server/server.key\n\n")
 
-	if prov.TLSAuthEnabled {
+	// ECDHE key exchange needs no DH parameters, which took minutes to generate
+	// with openssl on first provision. Every gateway's OpenVPN (2.4+) supports it.
+	sb.WriteString("# ECDHE key exchange\n")
+	sb.WriteString("dh none\n\n")
+
+	if prov.TLSAuthEnabled && prov.TLSMode == "crypt" {
+		sb.WriteString("# TLS-Crypt encrypts the control channel as well\n")
+		sb.WriteString("tls-crypt /etc/openvpn/server/ta.key\n\n")
+	} else if prov.TLSAuthEnabled {
 		sb.WriteString("# TLS-Auth for additional security\n")
 		sb.WriteString("tls-auth /etc/openvpn/server/ta.key 0\n\n")
 	}
@@ -521,8 +571,11 @@ func generateServerConfig(prov ProvisionResponse) string {
 	sb.WriteString("# Client configuration directory for spoke routes\n")
 	sb.WriteString("client-config-dir /etc/openvpn/server/ccd\n\n")
 
-	sb.WriteString("# Enable routing between clients (hub-and-spoke)\n")
-	sb.WriteString("client-to-client\n\n")
+	// No client-to-client: OpenVPN would route traffic between clients and to
+	// spoke networks internally, where the per-client firewall never sees it.
+	// Through the kernel, clients reach spokes via the routes updateGatewayRoutes
+	// adds and OpenVPN's iroutes, subject to the user's access rules.
+	sb.WriteString("# Client and spoke traffic is routed by the kernel so the per-client firewall applies\n\n")
 
 	sb.WriteString("# Keep connections alive\n")
 	sb.WriteString("keepalive 10 120\n\n")
@@ -566,7 +619,7 @@ func generateServerConfig(prov ProvisionResponse) string {
 }
 
 func gatewayMonitorLoop(ctx context.Context, cfg *HubConfig) {
-	ticker := time.NewTicker(30 * time.Second)
+	ticker := agent.NewTicker(30*time.Second, cfg.IntervalJitter)
 	defer ticker.Stop()
 
 	// CRITICAL: Create CCD files immediately on startup, before any spokes connect
@@ -587,7 +640,7 @@ func gatewayMonitorLoop(ctx context.Context, cfg *HubConfig) {
 
 func updateGatewayRoutes(ctx context.Context, cfg *HubConfig) {
 	url := strings.TrimSuffix(cfg.ControlPlaneURL, "/") + "/api/v1/mesh-hub/spokes?token=" + cfg.APIToken
-	resp, err := http.Get(url)
+	resp, err := controlPlane.Get(ctx, url)
 	if err != nil {
 		logger.Warn("Failed to fetch spokes", zap.Error(err))
 		return
@@ -617,7 +670,7 @@ func updateGatewayRoutes(ctx context.Context, cfg *HubConfig) {
 	ccdDir := "/etc/openvpn/server/ccd"
 	_ = os.MkdirAll(ccdDir, 0755)
 
-	needsRestart := false
+	needsReload := false
 
 	// Update CCD files and kernel routes for each spoke
 	for _, spoke := range result.Spokes {
@@ -625,12 +678,21 @@ func updateGatewayRoutes(ctx context.Context, cfg *HubConfig) {
 			logger.Debug("Skipping spoke without tunnel IP", zap.String("spoke", spoke.Name))
 			continue
 		}
+		// The control plane's data ends up in a file path, the CCD file and ip
+		// commands, so don't trust it to be well formed
+		if ip := net.ParseIP(spoke.TunnelIP); ip == nil || ip.To4() == nil {
+			logger.Warn("Skipping spoke with invalid tunnel IP",
+				zap.String("spoke", spoke.Name), zap.String("tunnel_ip", spoke.TunnelIP))
+			continue
+		}
+		networks := validSpokeNetworks(spoke.Name, spoke.LocalNetworks)
+		ccdName := agent.CCDFileName("mesh-gateway-" + spoke.Name)
 
 		// CCD file content: iroute directives for this spoke's networks
 		var sb strings.Builder
-		sb.WriteString(fmt.Sprintf("# Spoke: %s\n", spoke.Name))
+		sb.WriteString(fmt.Sprintf("# Spoke: %s\n", ccdName))
 		sb.WriteString(fmt.Sprintf("ifconfig-push %s 255.255.0.0\n", spoke.TunnelIP))
-		for _, network := range spoke.LocalNetworks {
+		for _, network := range networks {
 			netIP, mask := cidrToNetmask(network)
 			if netIP != "" && mask != "" {
 				sb.WriteString(fmt.Sprintf("iroute %s %s\n", netIP, mask))
@@ -639,8 +701,8 @@ func updateGatewayRoutes(ctx context.Context, cfg *HubConfig) {
 
 		newContent := sb.String()
 
-		// Write CCD file (use spoke certificate CN as filename)
-		ccdFile := fmt.Sprintf("%s/mesh-gateway-%s", ccdDir, spoke.Name)
+		// Write CCD file, named as OpenVPN looks it up from the spoke certificate CN
+		ccdFile := filepath.Join(ccdDir, ccdName)
 
 		// Check if CCD file content changed
 		existingContent, readErr := os.ReadFile(ccdFile)
@@ -649,26 +711,47 @@ func updateGatewayRoutes(ctx context.Context, cfg *HubConfig) {
 				logger.Warn("Failed to write CCD file", zap.String("spoke", spoke.Name), zap.Error(err))
 			} else {
 				logger.Info("Updated CCD file", zap.String("spoke", spoke.Name), zap.String("file", ccdFile))
-				// If file existed and content was different, flag for restart
+				// OpenVPN reads a CCD file when the spoke connects, so a new spoke
+				// needs nothing more. A changed one only applies once the spoke
+				// reconnects.
 				if readErr == nil && string(existingContent) != newContent {
-					needsRestart = true
+					needsReload = true
 				}
 			}
 		}
 
 		// Add kernel routes for each spoke network via the spoke's tunnel IP
-		for _, network := range spoke.LocalNetworks {
+		for _, network := range networks {
 			addKernelRoute(network, spoke.TunnelIP)
 		}
 	}
 
-	// If CCD files changed, restart OpenVPN so clients reconnect with correct IPs
-	if needsRestart {
-		logger.Info("CCD files changed, restarting OpenVPN to apply new configurations...")
-		if err := restartOpenVPN(); err != nil {
-			logger.Warn("Failed to restart OpenVPN", zap.Error(err))
+	// If CCD files changed, reload OpenVPN so spokes reconnect with their new
+	// iroutes. Certificates and crypto didn't change, so the process, its keys,
+	// and the tun device can stay up; a restart is only the fallback.
+	if needsReload {
+		logger.Info("CCD files changed, reloading OpenVPN to apply new configurations...")
+		if err := reloadOpenVPN(); err != nil {
+			logger.Warn("Reload failed, falling back to restart", zap.Error(err))
+			if err := restartOpenVPN(); err != nil {
+				logger.Warn("Failed to restart OpenVPN", zap.Error(err))
+			}
+		}
+	}
+}
+
+// validSpokeNetworks returns a spoke's local networks that are valid IPv4 CIDRs,
+// logging and dropping the rest.
+func validSpokeNetworks(spoke string, networks []string) []string {
+	valid := make([]string, 0, len(networks))
+	for _, network := range networks {
+		if _, ipNet, err := net.ParseCIDR(network); err != nil || ipNet.IP.To4() == nil {
+			logger.Warn("Ignoring invalid spoke network", zap.String("spoke", spoke), zap.String("network", network))
+			continue
 		}
+		valid = append(valid, network)
 	}
+	return valid
 }
 
 // cidrToNetmask converts CIDR notation to network IP and netmask
@@ -760,31 +843,23 @@ func showStatus(cmd *cobra.Command, args []string) error {
 }
 
 func isOpenVPNRunning() bool {
-	if _, err := os.Stat("/run/openvpn/server.pid"); err == nil {
-		return true
-	}
-	if _, err := os.Stat("/var/run/openvpn/server.pid"); err == nil {
-		return true
-	}
-	return false
+	return openvpnService.Running()
 }
 
 func startOpenVPN() error {
-	cmd := exec.Command("systemctl", "start", "openvpn-server@hub")
-	if err := cmd.Run(); err != nil {
-		cmd = exec.Command("systemctl", "start", "openvpn@hub")
-		return cmd.Run()
-	}
-	return nil
+	return openvpnService.Start()
 }
 
+// restartOpenVPN restarts the OpenVPN service, for certificate and crypto
+// changes.
 func restartOpenVPN() error {
-	cmd := exec.Command("systemctl", "restart", "openvpn-server@hub")
-	if err := cmd.Run(); err != nil {
-		cmd = exec.Command("systemctl", "restart", "openvpn@hub")
-		return cmd.Run()
-	}
-	return nil
+	return openvpnService.Restart()
+}
+
+// reloadOpenVPN sends SIGHUP to the OpenVPN service so it re-reads its config and
+// client-config-dir without the process restarting.
+func reloadOpenVPN() error {
+	return openvpnService.Reload()
 }
 
 func getConnectedGatewayCount() int {
@@ -852,6 +927,7 @@ type AccessRule struct {
 
 // clientFirewallState tracks firewall rules for a client
 type clientFirewallState struct {
+	tunnelIP string
 	rules    []AccessRule
 	rulesSet bool
 }
@@ -868,7 +944,7 @@ func firewallEnforcementLoop(ctx context.Context, cfg *HubConfig) {
 		return
 	}
 
-	ticker := time.NewTicker(10 * time.Second)
+	ticker := agent.NewTicker(10*time.Second, cfg.IntervalJitter)
 	defer ticker.Stop()
 
 	// Run initial sync
@@ -954,15 +1030,16 @@ func getConnectedClients() []ConnectedClient {
 	return clients
 }
 
+// syncFirewallRules brings each connected client's firewall rules in line with
+// its access rules. Like gateways, the hub fails closed: a client whose rules
+// can't be fetched reaches nothing until they can, and a client keeps the rules
+// it has while the control plane is unreachable.
 func syncFirewallRules(ctx context.Context, cfg *HubConfig) {
 	if firewallMgr == nil {
 		return
 	}
 
 	clients := getConnectedClients()
-	if len(clients) == 0 {
-		return
-	}
 
 	// Build list of client emails
 	var emails []string
@@ -973,9 +1050,9 @@ func syncFirewallRules(ctx context.Context, cfg *HubConfig) {
 	}
 
 	// Fetch rules from control plane
-	clientRules := fetchClientRules(ctx, cfg, emails)
-	if clientRules == nil {
-		return
+	var clientRules map[string][]AccessRule
+	if len(emails) > 0 {
+		clientRules = fetchClientRules(ctx, cfg, emails)
 	}
 
 	clientFirewallMutex.Lock()
@@ -988,9 +1065,9 @@ func syncFirewallRules(ctx context.Context, cfg *HubConfig) {
 	}
 
 	// Remove firewall rules for disconnected clients
-	for cn := range clientFirewallStates {
+	for cn, state := range clientFirewallStates {
 		if !activeClients[cn] {
-			removeClientFirewallRules(ctx, cn)
+			removeClientFirewallRules(ctx, cn, state.tunnelIP)
 			delete(clientFirewallStates, cn)
 		}
 	}
@@ -1001,22 +1078,43 @@ func syncFirewallRules(ctx context.Context, cfg *HubConfig) {
 			continue
 		}
 
-		rules, ok := clientRules[client.CN]
-		if !ok {
-			// No rules = no access (zero trust)
-			rules = []AccessRule{}
-		}
-
 		state, exists := clientFirewallStates[client.CN]
 		if !exists {
 			state = &clientFirewallState{}
 			clientFirewallStates[client.CN] = state
 		}
 
-		// Check if rules changed
-		rulesChanged := !state.rulesSet || !rulesEqual(state.rules, rules)
-		if rulesChanged {
-			applyClientFirewallRules(ctx, client, rules)
+		var rules []AccessRule
+		switch {
+		case clientRules != nil:
+			// No rules = no access (zero trust)
+			rules = clientRules[client.CN]
+			if rules == nil {
+				rules = []AccessRule{}
+			}
+		case state.rulesSet && state.tunnelIP == client.TunnelIP:
+			// Control plane unreachable; keep the rules already applied
+			continue
+		default:
+			// Never had rules at this address; deny until they can be fetched
+			rules = []AccessRule{}
+		}
+
+		// A client that reconnected with another address needs rules there
+		if state.rulesSet && state.tunnelIP != client.TunnelIP {
+			removeClientFirewallRules(ctx, client.CN, state.tunnelIP)
+			state.rulesSet = false
+		}
+
+		if !state.rulesSet || !rulesEqual(state.rules, rules) {
+			if err := applyClientFirewallRules(ctx, client, rules); err != nil {
+				logger.Warn("Failed to apply firewall rules",
+					zap.String("client", client.CN),
+					zap.Error(err))
+				state.rulesSet = false
+				continue
+			}
+			state.tunnelIP = client.TunnelIP
 			state.rules = rules
 			state.rulesSet = true
 		}
@@ -1039,7 +1137,7 @@ func fetchClientRules(ctx context.Context, cfg *HubConfig, emails []string) map[
 	}
 
 	url := strings.TrimSuffix(cfg.ControlPlaneURL, "/") + "/api/v1/mesh-hub/all-client-rules"
-	resp, err := http.Post(url, "application/json", bytes.NewReader(body))
+	resp, err := controlPlane.PostIdempotent(ctx, url, body)
 	if err != nil {
 		logger.Warn("Failed to fetch client rules", zap.Error(err))
 		return nil
@@ -1074,36 +1172,75 @@ func rulesEqual(a, b []AccessRule) bool {
 	return true
 }
 
-func applyClientFirewallRules(ctx context.Context, client ConnectedClient, rules []AccessRule) {
+// clientConnectionID names the firewall rules for a client's tunnel address.
+func clientConnectionID(tunnelIP string) string {
+	return fmt.Sprintf("mesh-client-%s", strings.ReplaceAll(tunnelIP, ".", "-"))
+}
+
+func applyClientFirewallRules(ctx context.Context, client ConnectedClient, rules []AccessRule) error {
 	if firewallMgr == nil {
-		return
+		return nil
 	}
 
-	// Remove existing rules for this client first
-	connectionID := fmt.Sprintf("mesh-client-%s", strings.ReplaceAll(client.TunnelIP, ".", "-"))
-	_ = firewallMgr.RemoveRules(ctx, connectionID)
+	// Parse source IP
+	sourceIP := net.ParseIP(client.TunnelIP)
+	if sourceIP == nil {
+		return fmt.Errorf("invalid tunnel IP: %s", client.TunnelIP)
+	}
 
 	logger.Info("Applying firewall rules",
 		zap.String("client", client.CN),
 		zap.String("tunnelIP", client.TunnelIP),
 		zap.Int("ruleCount", len(rules)))
 
-	// Parse source IP
-	sourceIP := net.ParseIP(client.TunnelIP)
-	if sourceIP == nil {
-		logger.Warn("Invalid tunnel IP", zap.String("tunnelIP", client.TunnelIP))
-		return
-	}
+	networks, ports := accessRuleTargets(rules, net.LookupIP)
 
-	// Convert access rules to firewall networks and ports
+	// Generate a UUID from client email for firewall tracking
+	// Use namespace UUID to generate deterministic UUID from email
+	userUUID := uuid.NewSHA1(uuid.NameSpaceURL, []byte(client.CN))
+
+	// ApplyRules replaces any rules the connection already has
+	return firewallMgr.ApplyRules(ctx, clientConnectionID(client.TunnelIP), userUUID, sourceIP, networks, ports)
+}
+
+// accessRuleTargets converts access rules to the networks and ports the firewall
+// allows, as gateways do. A rule with an invalid port or protocol is skipped
+// entirely so it can't fall back to allowing all ports. Wildcard hostnames are
+// enforced from DNS lookups on gateways; the hub has no DNS proxy to learn them
+// from, so they allow nothing here.
+func accessRuleTargets(rules []AccessRule, lookupIP func(string) ([]net.IP, error)) ([]net.IPNet, []firewall.PortRange) {
 	var networks []net.IPNet
 	var ports []firewall.PortRange
 
 	for _, rule := range rules {
+		protocol, err := firewall.ParseProtocol(rule.Protocol)
+		if err != nil {
+			logger.Warn("Skipping access rule with invalid protocol",
+				zap.String("value", rule.Value),
+				zap.Error(err))
+			continue
+		}
+		var portRange *firewall.PortRange
+		if rule.Port != "" && rule.Port != "*" {
+			start, end, err := firewall.ParsePortRange(rule.Port)
+			if err != nil {
+				logger.Warn("Skipping access rule with invalid port range",
+					zap.String("value", rule.Value),
+					zap.Error(err))
+				continue
+			}
+			portRange = &firewall.PortRange{Protocol: protocol, Port: start}
+			if end != start {
+				portRange.PortEnd = end
+			}
+		} else if protocol != firewall.ProtocolAny {
+			// A protocol without a port still restricts the destination to that protocol
+			portRange = &firewall.PortRange{Protocol: protocol}
+		}
+
 		switch rule.Type {
 		case "ip":
-			ip := net.ParseIP(rule.Value)
-			if ip != nil {
+			if ip := net.ParseIP(rule.Value); ip != nil {
 				networks = append(networks, net.IPNet{IP: ip, Mask: net.CIDRMask(32, 32)})
 			}
 		case "cidr":
@@ -1111,9 +1248,9 @@ func applyClientFirewallRules(ctx context.Context, client ConnectedClient, rules
 			if err == nil && ipnet != nil {
 				networks = append(networks, *ipnet)
 			}
-		case "hostname", "hostname_wildcard":
+		case "hostname":
 			// Resolve hostname to IP
-			ips, err := net.LookupIP(rule.Value)
+			ips, err := lookupIP(rule.Value)
 			if err != nil || len(ips) == 0 {
 				logger.Debug("Failed to resolve hostname",
 					zap.String("hostname", rule.Value),
@@ -1128,72 +1265,19 @@ func applyClientFirewallRules(ctx context.Context, client ConnectedClient, rules
 			}
 		}
 
-		// Parse port if specified
-		if rule.Port != "" && rule.Port != "*" {
-			protocol := firewall.ProtocolAny
-			switch rule.Protocol {
-			case "tcp":
-				protocol = firewall.ProtocolTCP
-			case "udp":
-				protocol = firewall.ProtocolUDP
-			}
-
-			if strings.Contains(rule.Port, "-") {
-				// Port range
-				parts := strings.Split(rule.Port, "-")
-				if len(parts) == 2 {
-					start, _ := strconv.Atoi(parts[0])
-					end, _ := strconv.Atoi(parts[1])
-					ports = append(ports, firewall.PortRange{
-						Protocol: protocol,
-						Port:     start,
-						PortEnd:  end,
-					})
-				}
-			} else {
-				port, _ := strconv.Atoi(rule.Port)
-				if port > 0 {
-					ports = append(ports, firewall.PortRange{
-						Protocol: protocol,
-						Port:     port,
-					})
-				}
-			}
+		if portRange != nil {
+			ports = append(ports, *portRange)
 		}
 	}
-
-	// Generate a UUID from client email for firewall tracking
-	// Use namespace UUID to generate deterministic UUID from email
-	userUUID := uuid.NewSHA1(uuid.NameSpaceURL, []byte(client.CN))
-
-	// Apply rules using firewall manager
-	if err := firewallMgr.ApplyRules(ctx, connectionID, userUUID, sourceIP, networks, ports); err != nil {
-		logger.Warn("Failed to apply firewall rules",
-			zap.String("client", client.CN),
-			zap.Error(err))
-	}
+	return networks, ports
 }
 
-func removeClientFirewallRules(ctx context.Context, cn string) {
-	if firewallMgr == nil {
-		return
-	}
-
-	// Find client's tunnel IP from connected clients
-	clients := getConnectedClients()
-	var tunnelIP string
-	for _, c := range clients {
-		if c.CN == cn {
-			tunnelIP = c.TunnelIP
-			break
-		}
-	}
-	if tunnelIP == "" {
+func removeClientFirewallRules(ctx context.Context, cn, tunnelIP string) {
+	if firewallMgr == nil || tunnelIP == "" {
 		return
 	}
 
-	connectionID := fmt.Sprintf("mesh-client-%s", strings.ReplaceAll(tunnelIP, ".", "-"))
-	if err := firewallMgr.RemoveRules(ctx, connectionID); err != nil {
+	if err := firewallMgr.RemoveRules(ctx, clientConnectionID(tunnelIP)); err != nil {
 		logger.Debug("Error removing firewall rules", zap.String("cn", cn), zap.Error(err))
 	}
 }
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/gatekey-project/gatekey/internal/agent"
+	"github.com/gatekey-project/gatekey/internal/agent/agenttest"
+	"github.com/gatekey-project/gatekey/internal/firewall"
+)
+
+func TestAccessRuleTargets(t *testing.T) {
+	logger = zap.NewNop()
+	lookup := func(host string) ([]net.IP, error) {
+		return []net.IP{net.ParseIP("192.0.2.10"), net.ParseIP("2001:db8::1")}, nil
+	}
+
+	networks, ports := accessRuleTargets([]AccessRule{
+		{Type: "cidr", Value: "10.0.0.0/24", Port: "443", Protocol: "tcp"},
+		{Type: "ip", Value: "10.0.1.5", Port: "*"},
+		{Type: "hostname", Value: "db.internal", Port: "5432-5433", Protocol: "tcp"},
+		{Type: "hostname_wildcard", Value: "*.internal"},
+		{Type: "cidr", Value: "10.9.0.0/16", Port: "http", Protocol: "tcp"},
+		{Type: "cidr", Value: "10.8.0.0/16", Port: "22", Protocol: "icmpv9"},
+		{Type: "cidr", Value: "10.7.0.0/16", Protocol: "icmp"},
+	}, lookup)
+
+	var got []string
+	for _, n := range networks {
+		got = append(got, n.String())
+	}
+	if want := "10.0.0.0/24 10.0.1.5/32 192.0.2.10/32 10.7.0.0/16"; strings.Join(got, " ") != want {
+		t.Errorf("networks = %v, want %s", got, want)
+	}
+
+	wantPorts := []firewall.PortRange{
+		{Protocol: firewall.ProtocolTCP, Port: 443},
+		{Protocol: firewall.ProtocolTCP, Port: 5432, PortEnd: 5433},
+		{Protocol: firewall.ProtocolICMP},
+	}
+	if len(ports) != len(wantPorts) {
+		t.Fatalf("ports = %v, want %v", ports, wantPorts)
+	}
+	for i := range ports {
+		if ports[i] != wantPorts[i] {
+			t.Errorf("ports[%d] = %v, want %v", i, ports[i], wantPorts[i])
+		}
+	}
+}
+
+func TestServerConfigRoutesClientsThroughKernel(t *testing.T) {
+	conf := generateServerConfig(ProvisionResponse{VPNPort: 1194, VPNProtocol: "udp", VPNSubnet: "172.30.0.0/16"})
+	for _, line := range strings.Split(conf, "\n") {
+		if strings.TrimSpace(line) == "client-to-client" {
+			t.Fatal("client-to-client bypasses the per-client firewall")
+		}
+	}
+}
+
+func TestSendHeartbeat(t *testing.T) {
+	tests := []struct {
+		name     string
+		response agenttest.Response
+		wantErr  string
+	}{
+		{"reprovision signaled", agenttest.JSON(HeartbeatResponse{OK: true, NeedsReprovision: true, ConfigVersion: "v2"}), ""},
+		{"unknown hub", agenttest.Response{Status: http.StatusUnauthorized, Body: `{"error":"invalid token"}`}, "returned 401"},
+		{"malformed JSON", agenttest.Response{Body: `{"ok":tru`}, "failed to decode"},
+		{"timeout", agenttest.Response{Body: `{}`, Delay: 5 * time.Second}, "failed to send request"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			saved := controlPlane
+			t.Cleanup(func() { controlPlane, currentConfigVer = saved, "" })
+			controlPlane = agent.NewControlPlaneClient(50 * time.Millisecond)
+			currentConfigVer = "v1"
+
+			cp := agenttest.NewControlPlane(t)
+			cp.Handle("/api/v1/mesh-hub/heartbeat", tt.response)
+
+			resp, err := sendHeartbeat(context.Background(), &HubConfig{ControlPlaneURL: cp.URL, APIToken: "hub-token"})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("sendHeartbeat() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("sendHeartbeat() error = %v", err)
+			}
+			if !resp.NeedsReprovision || resp.ConfigVersion != "v2" {
+				t.Errorf("sendHeartbeat() = %+v", resp)
+			}
+
+			var sent struct {
+				Token         string `json:"token"`
+				ConfigVersion string `json:"configVersion"`
+			}
+			if err := cp.Requests("/api/v1/mesh-hub/heartbeat")[0].Decode(&sent); err != nil {
+				t.Fatal(err)
+			}
+			if sent.Token != "hub-token" || sent.ConfigVersion != "v1" {
+				t.Errorf("heartbeat request = %+v", sent)
+			}
+		})
+	}
+}
@@ -4,7 +4,6 @@
 package main
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -13,6 +12,8 @@ import (
 	"os"
 	"os/exec"
 	"os/signal"
+	"path/filepath"
+	"regexp"
 	"strings"
 	"syscall"
 	"time"
@@ -21,6 +22,9 @@ import (
 	"github.com/spf13/viper"
 	"go.uber.org/zap"
 
+	"github.com/gatekey-project/gatekey/internal/agent"
+	"github.com/gatekey-project/gatekey/internal/agentlog"
+	"github.com/gatekey-project/gatekey/internal/openvpn"
 	"github.com/gatekey-project/gatekey/internal/session"
 )
 
@@ -29,6 +33,12 @@ var (
 	logger           *zap.Logger
 	currentConfigVer string
 	provisionedName  string // Name from control plane provisioning
+
+	// controlPlane makes the gateway's requests to the control plane.
+	controlPlane = agent.NewControlPlaneClient(0)
+
+	// openvpnService is the OpenVPN client connected to the hub, resolved by loadConfig.
+	openvpnService *openvpn.Service
 )
 
 const (
@@ -80,14 +90,29 @@ The gateway:
 
 // GatewayConfig holds gateway configuration
 type GatewayConfig struct {
-	Name              string        `mapstructure:"name"`
-	ControlPlaneURL   string        `mapstructure:"control_plane_url"`
-	GatewayToken      string        `mapstructure:"gateway_token"`
+	Name            string `mapstructure:"name"`
+	ControlPlaneURL string `mapstructure:"control_plane_url"`
+	GatewayToken    string `mapstructure:"gateway_token"`
+	// ControlPlanePins are SHA-256 hashes of the control plane's public keys; when
+	// set, HTTPS connections to a control plane presenting none of them fail
+	ControlPlanePins  []string      `mapstructure:"control_plane_pins"`
 	HubEndpoint       string        `mapstructure:"hub_endpoint"`
 	LocalNetworks     []string      `mapstructure:"local_networks"`
 	HeartbeatInterval time.Duration `mapstructure:"heartbeat_interval"`
-	LogLevel          string        `mapstructure:"log_level"`
 	SessionEnabled    bool          `mapstructure:"session_enabled"`
+	// IntervalJitter moves each heartbeat by up to this fraction of the interval,
+	// so spokes started together don't call the control plane in step
+	IntervalJitter float64 `mapstructure:"interval_jitter"`
+	// PublicIPSources are where the public IP reported in heartbeats is looked up,
+	// in order: env (PUBLIC_IP), aws, gcp, azure and echo; empty turns detection off
+	PublicIPSources []string `mapstructure:"public_ip_sources"`
+	// PublicIPEchoURL returns the caller's address as plain text, for the echo source
+	PublicIPEchoURL string `mapstructure:"public_ip_echo_url"`
+	// PublicIPRefresh is how often the public IP is looked up again; 0 only looks it up at startup
+	PublicIPRefresh time.Duration `mapstructure:"public_ip_refresh"`
+
+	OpenVPN openvpn.ServiceConfig `mapstructure:",squash"` // openvpn_unit, openvpn_pid_file, openvpn_config_file
+	Logging agentlog.Config       `mapstructure:",squash"` // log_level, log_format, log_file, sampling
 }
 
 // ProvisionResponse from control plane
@@ -104,6 +129,7 @@ type ProvisionResponse struct {
 	LocalNetworks  []string `json:"localNetworks"`
 	TLSAuthEnabled bool     `json:"tlsAuthEnabled"`
 	TLSAuthKey     string   `json:"tlsAuthKey"`
+	TLSMode        string   `json:"tlsMode"`
 	CryptoProfile  string   `json:"cryptoProfile"`
 	ConfigVersion  string   `json:"configVersion"`
 }
@@ -112,9 +138,17 @@ func loadConfig() (*GatewayConfig, error) {
 	v := viper.New()
 	v.SetConfigFile(configPath)
 
+	v.SetDefault("control_plane_pins", []string{})
 	v.SetDefault("heartbeat_interval", "30s")
-	v.SetDefault("log_level", "info")
+	v.SetDefault("interval_jitter", agent.DefaultJitter)
+	agentlog.SetDefaults(v.SetDefault)
 	v.SetDefault("session_enabled", true)
+	v.SetDefault("public_ip_sources", agent.DefaultPublicIPSources)
+	v.SetDefault("public_ip_echo_url", agent.DefaultPublicIPEchoURL)
+	v.SetDefault("public_ip_refresh", agent.DefaultPublicIPRefresh)
+	v.SetDefault("openvpn_unit", "")
+	v.SetDefault("openvpn_pid_file", "")
+	v.SetDefault("openvpn_config_file", "/etc/openvpn/client/mesh-hub.conf")
 
 	if err := v.ReadInConfig(); err != nil {
 		return nil, fmt.Errorf("failed to read config: %w", err)
@@ -122,21 +156,29 @@ func loadConfig() (*GatewayConfig, error) {
 
 	v.SetEnvPrefix("GATEKEY_MESH")
 	v.AutomaticEnv()
+	if err := agent.LoadCredentials(v, "gateway_token", "control_plane_url"); err != nil {
+		return nil, err
+	}
 
 	var cfg GatewayConfig
 	if err := v.Unmarshal(&cfg); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
 	}
 
-	return &cfg, nil
-}
-
-func initLogger(level string) (*zap.Logger, error) {
-	cfg := zap.NewProductionConfig()
-	if level == "debug" {
-		cfg = zap.NewDevelopmentConfig()
+	var err error
+	if openvpnService, err = openvpn.NewService(cfg.OpenVPN, "openvpn-client@mesh-hub"); err != nil {
+		return nil, err
+	}
+	if err := agent.PinControlPlane(cfg.ControlPlaneURL, cfg.ControlPlanePins); err != nil {
+		return nil, err
+	}
+	for _, source := range cfg.PublicIPSources {
+		if !agent.ValidPublicIPSource(source) {
+			return nil, fmt.Errorf("public_ip_sources: unknown source %q", source)
+		}
 	}
-	return cfg.Build()
+
+	return &cfg, nil
 }
 
 func loadConfigVersion() string {
@@ -156,7 +198,11 @@ func loadGatewayName() string {
 	if err != nil {
 		return ""
 	}
-	return strings.TrimSpace(string(data))
+	name := strings.TrimSpace(string(data))
+	if !agent.ValidNodeName(name) {
+		return ""
+	}
+	return name
 }
 
 func saveGatewayName(name string) error {
@@ -169,7 +215,7 @@ func runGateway(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	logger, err = initLogger(cfg.LogLevel)
+	logger, err = agentlog.New(cfg.Logging)
 	if err != nil {
 		return err
 	}
@@ -180,6 +226,10 @@ func runGateway(cmd *cobra.Command, args []string) error {
 		zap.String("control_plane", cfg.ControlPlaneURL),
 		zap.Strings("local_networks", cfg.LocalNetworks),
 	)
+	if !openvpnService.Found() {
+		logger.Warn("No OpenVPN systemd unit found; OpenVPN will be started directly. Set openvpn_unit if it is installed under another name",
+			zap.String("unit", openvpnService.Unit))
+	}
 
 	// Load persisted config version and gateway name
 	currentConfigVer = loadConfigVersion()
@@ -226,6 +276,7 @@ func runGateway(cmd *cobra.Command, args []string) error {
 			NodeID:          effectiveName,
 			NodeName:        effectiveName,
 			Logger:          logger,
+			TLSConfig:       agent.ControlPlaneTLSConfig(),
 		})
 		sessionClient.Start(ctx)
 		logger.Info("Remote session client started")
@@ -255,31 +306,51 @@ func runGateway(cmd *cobra.Command, args []string) error {
 }
 
 func heartbeatLoop(ctx context.Context, cfg *GatewayConfig) {
-	ticker := time.NewTicker(cfg.HeartbeatInterval)
+	ticker := agent.NewTicker(cfg.HeartbeatInterval, cfg.IntervalJitter)
 	defer ticker.Stop()
 
+	// Get public IP on startup and keep it current
+	publicIP := detectPublicIP(ctx, cfg.PublicIPSources, cfg.PublicIPEchoURL, cfg.PublicIPRefresh)
+
 	// Send initial heartbeat
-	sendHeartbeat(ctx, cfg)
+	applyHeartbeatInterval(ticker, cfg, sendHeartbeat(ctx, cfg, publicIP.IP()))
 
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
-			sendHeartbeat(ctx, cfg)
+			applyHeartbeatInterval(ticker, cfg, sendHeartbeat(ctx, cfg, publicIP.IP()))
 		}
 	}
 }
 
+// applyHeartbeatInterval slows heartbeats down to the minimum interval the control
+// plane asks for, or back to the configured interval once it stops asking. Nothing
+// changes when the heartbeat failed.
+func applyHeartbeatInterval(ticker *agent.Ticker, cfg *GatewayConfig, resp *HeartbeatResponse) {
+	if resp == nil {
+		return
+	}
+	if ticker.SetInterval(agent.HeartbeatInterval(cfg.HeartbeatInterval, resp.MinHeartbeatInterval)) {
+		logger.Info("Heartbeat interval changed", zap.Duration("interval", ticker.Interval()))
+	}
+}
+
 // HeartbeatResponse from control plane
 type HeartbeatResponse struct {
 	OK               bool   `json:"ok"`
 	ConfigVersion    string `json:"configVersion"`
 	NeedsReprovision bool   `json:"needsReprovision"`
 	TLSAuthEnabled   bool   `json:"tlsAuthEnabled"`
+	// MinHeartbeatInterval is the shortest heartbeat interval in seconds the control
+	// plane wants agents to use; 0 leaves it to the spoke
+	MinHeartbeatInterval int `json:"minHeartbeatInterval,omitempty"`
 }
 
-func sendHeartbeat(ctx context.Context, cfg *GatewayConfig) {
+// sendHeartbeat reports to the control plane, reprovisioning if it asks, and
+// returns its response, or nil if the heartbeat failed.
+func sendHeartbeat(ctx context.Context, cfg *GatewayConfig, publicIP string) *HeartbeatResponse {
 	status := "disconnected"
 	if isOpenVPNConnected() {
 		status = "connected"
@@ -295,7 +366,7 @@ func sendHeartbeat(ctx context.Context, cfg *GatewayConfig) {
 	}{
 		Token:         cfg.GatewayToken,
 		Status:        status,
-		RemoteIP:      getPublicIP(),
+		RemoteIP:      publicIP,
 		BytesSent:     getBytesSent(),
 		BytesReceived: getBytesReceived(),
 		ConfigVersion: currentConfigVer,
@@ -304,14 +375,14 @@ func sendHeartbeat(ctx context.Context, cfg *GatewayConfig) {
 	body, err := json.Marshal(reqBody)
 	if err != nil {
 		logger.Warn("Failed to marshal heartbeat", zap.Error(err))
-		return
+		return nil
 	}
 
 	url := strings.TrimSuffix(cfg.ControlPlaneURL, "/") + "/api/v1/mesh-gateway/heartbeat"
-	resp, err := http.Post(url, "application/json", bytes.NewReader(body))
+	resp, err := controlPlane.PostIdempotent(ctx, url, body)
 	if err != nil {
 		logger.Warn("Heartbeat failed", zap.Error(err))
-		return
+		return nil
 	}
 	defer resp.Body.Close()
 
@@ -320,14 +391,14 @@ func sendHeartbeat(ctx context.Context, cfg *GatewayConfig) {
 		logger.Warn("Heartbeat returned error",
 			zap.Int("status", resp.StatusCode),
 			zap.String("body", string(respBody)))
-		return
+		return nil
 	}
 
 	// Parse heartbeat response
 	var hbResp HeartbeatResponse
 	if err := json.NewDecoder(resp.Body).Decode(&hbResp); err != nil {
 		logger.Warn("Failed to decode heartbeat response", zap.Error(err))
-		return
+		return nil
 	}
 
 	// Check if we need to reprovision (config changed on control plane)
@@ -339,7 +410,7 @@ func sendHeartbeat(ctx context.Context, cfg *GatewayConfig) {
 		// Reprovision from control plane
 		if err := doProvision(ctx, cfg); err != nil {
 			logger.Error("Failed to reprovision", zap.Error(err))
-			return
+			return &hbResp
 		}
 
 		// Update local config version
@@ -356,6 +427,8 @@ func sendHeartbeat(ctx context.Context, cfg *GatewayConfig) {
 			logger.Info("OpenVPN restarted successfully")
 		}
 	}
+
+	return &hbResp
 }
 
 func connectionMonitorLoop(ctx context.Context) {
@@ -381,7 +454,7 @@ func provisionGateway(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	logger, err = initLogger(cfg.LogLevel)
+	logger, err = agentlog.New(cfg.Logging)
 	if err != nil {
 		return err
 	}
@@ -406,7 +479,7 @@ func doProvision(ctx context.Context, cfg *GatewayConfig) error {
 	}
 
 	url := strings.TrimSuffix(cfg.ControlPlaneURL, "/") + "/api/v1/mesh-gateway/provision"
-	resp, err := http.Post(url, "application/json", bytes.NewReader(body))
+	resp, err := controlPlane.Post(ctx, url, body)
 	if err != nil {
 		return fmt.Errorf("failed to send request: %w", err)
 	}
@@ -454,7 +527,7 @@ func doProvision(ctx context.Context, cfg *GatewayConfig) error {
 
 	// Generate OpenVPN client config
 	clientConfig := generateClientConfig(provResp, hubEndpoint)
-	if err := os.WriteFile(openvpnDir+"/mesh-hub.conf", []byte(clientConfig), 0644); err != nil {
+	if err := os.WriteFile(openvpnService.ConfigFile, []byte(clientConfig), 0644); err != nil {
 		return fmt.Errorf("failed to write client config: %w", err)
 	}
 
@@ -468,8 +541,11 @@ func doProvision(ctx context.Context, cfg *GatewayConfig) error {
 		logger.Warn("Failed to save config version", zap.Error(err))
 	}
 
-	// Save gateway name for session authentication
-	if provResp.GatewayName != "" {
+	// Save gateway name for session authentication. It's used as the session
+	// node ID, so ignore a name that isn't safe to pass around.
+	if provResp.GatewayName != "" && !agent.ValidNodeName(provResp.GatewayName) {
+		logger.Warn("Ignoring invalid gateway name from control plane", zap.String("name", provResp.GatewayName))
+	} else if provResp.GatewayName != "" {
 		provisionedName = provResp.GatewayName
 		if err := saveGatewayName(provResp.GatewayName); err != nil {
 			logger.Warn("Failed to save gateway name", zap.Error(err))
@@ -515,7 +591,10 @@ func generateClientConfig(prov ProvisionResponse, hubEndpoint string) string {
 	sb.WriteString("cert /etc/openvpn/client/client.crt\n")
 	sb.WriteString("key /etc/openvpn/client/client.key\n\n")
 
-	if prov.TLSAuthEnabled {
+	if prov.TLSAuthEnabled && prov.TLSMode == "crypt" {
+		sb.WriteString("# TLS-Crypt encrypts the control channel as well\n")
+		sb.WriteString("tls-crypt /etc/openvpn/client/ta.key\n\n")
+	} else if prov.TLSAuthEnabled {
 		sb.WriteString("# TLS-Auth for additional security\n")
 		sb.WriteString("tls-auth /etc/openvpn/client/ta.key 1\n\n")
 	}
@@ -596,8 +675,13 @@ func showStatus(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+// isOpenVPNRunning checks the unit, or for an OpenVPN started directly when
+// systemd couldn't start it.
 func isOpenVPNRunning() bool {
-	cmd := exec.Command("pgrep", "-f", "openvpn.*mesh-hub")
+	if openvpnService.Running() {
+		return true
+	}
+	cmd := exec.Command("pgrep", "-f", "openvpn.*"+regexp.QuoteMeta(filepath.Base(openvpnService.ConfigFile)))
 	return cmd.Run() == nil
 }
 
@@ -612,10 +696,9 @@ func isOpenVPNConnected() bool {
 }
 
 func startOpenVPN() error {
-	cmd := exec.Command("systemctl", "start", "openvpn-client@mesh-hub")
-	if err := cmd.Run(); err != nil {
+	if err := openvpnService.Start(); err != nil {
 		// Try direct openvpn start
-		cmd = exec.Command("openvpn", "--daemon", "--config", "/etc/openvpn/client/mesh-hub.conf")
+		cmd := exec.Command("openvpn", "--daemon", "--config", openvpnService.ConfigFile)
 		return cmd.Run()
 	}
 	return nil
@@ -623,28 +706,41 @@ func startOpenVPN() error {
 
 func restartOpenVPN() error {
 	// Try systemctl restart first
-	cmd := exec.Command("systemctl", "restart", "openvpn-client@mesh-hub")
-	if err := cmd.Run(); err != nil {
+	if err := openvpnService.Restart(); err != nil {
 		// Fall back to killing and restarting manually
-		stopCmd := exec.Command("pkill", "-f", "openvpn.*mesh-hub")
+		stopCmd := exec.Command("pkill", "-f", "openvpn.*"+regexp.QuoteMeta(filepath.Base(openvpnService.ConfigFile)))
 		stopCmd.Run() // Ignore error, process might not exist
 
 		// Wait a moment for process to die
 		time.Sleep(time.Second)
 
 		// Start again
-		startCmd := exec.Command("openvpn", "--daemon", "--config", "/etc/openvpn/client/mesh-hub.conf")
+		startCmd := exec.Command("openvpn", "--daemon", "--config", openvpnService.ConfigFile)
 		return startCmd.Run()
 	}
 	return nil
 }
 
-func getPublicIP() string {
-	if ip := os.Getenv("PUBLIC_IP"); ip != "" {
-		return ip
-	}
-	// Could query external IP service
-	return ""
+// detectPublicIP looks up the public IP reported in heartbeats and refreshes it
+// in the background every refresh.
+func detectPublicIP(ctx context.Context, sources []string, echoURL string, refresh time.Duration) *agent.PublicIPDetector {
+	detector := agent.NewPublicIPDetector(sources, echoURL)
+	if len(sources) == 0 {
+		return detector
+	}
+	if ip, source, _, err := detector.Refresh(ctx); err != nil {
+		logger.Warn("Could not detect public IP; set PUBLIC_IP or public_ip_sources", zap.Error(err))
+	} else {
+		logger.Info("Detected public IP", zap.String("ip", ip), zap.String("source", source))
+	}
+	go detector.Run(ctx, refresh, func(ip, source string, err error) {
+		if err != nil {
+			logger.Warn("Public IP refresh failed", zap.Error(err))
+			return
+		}
+		logger.Info("Public IP changed", zap.String("ip", ip), zap.String("source", source))
+	})
+	return detector
 }
 
 func getBytesSent() int64 {
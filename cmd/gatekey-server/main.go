@@ -25,8 +25,8 @@ import (
 var migrationsFS embed.FS
 
 var (
-	configPath string
-	logger     *zap.Logger
+	configPaths []string
+	logger      *zap.Logger
 )
 
 func main() {
@@ -39,7 +39,9 @@ short-lived certificates, and policy-based access control.`,
 		RunE: run,
 	}
 
-	rootCmd.PersistentFlags().StringVarP(&configPath, "config", "c", "", "config file path")
+	rootCmd.PersistentFlags().StringArrayVarP(&configPaths, "config", "c", nil,
+		"config file or directory of .yaml files; repeat to layer overlays, later ones taking precedence")
+	rootCmd.AddCommand(newSecretsCmd())
 
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
@@ -49,7 +51,7 @@ short-lived certificates, and policy-based access control.`,
 
 func run(cmd *cobra.Command, args []string) error {
 	// Load configuration
-	cfg, err := config.Load(configPath)
+	cfg, err := config.Load(configPaths...)
 	if err != nil {
 		return fmt.Errorf("failed to load config: %w", err)
 	}
@@ -65,6 +67,11 @@ func run(cmd *cobra.Command, args []string) error {
 		zap.String("version", "0.1.0"),
 		zap.Bool("tls_enabled", cfg.Server.TLSEnabled),
 	)
+	// Later files override earlier ones, and environment variables override files
+	logger.Info("Loaded configuration",
+		zap.Strings("files", cfg.Files),
+		zap.Strings("env_overrides", cfg.EnvOverrides),
+	)
 
 	// Run database migrations
 	logger.Info("Running database migrations...")
@@ -0,0 +1,9 @@
+-- Track consecutive reprovision signals per gateway so a gateway stuck in a
+-- reprovision loop can be detected and surfaced to admins.
+CREATE TABLE IF NOT EXISTS gateway_reprovision_status (
+    gateway_id UUID PRIMARY KEY REFERENCES gateways(id) ON DELETE CASCADE,
+    consecutive_signals INTEGER NOT NULL DEFAULT 0,
+    first_signaled_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    last_signaled_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    alerted_at TIMESTAMP WITH TIME ZONE
+);
@@ -0,0 +1 @@
+ALTER TABLE gateways DROP COLUMN IF EXISTS push_options;
@@ -0,0 +1,2 @@
+-- Custom allowlisted push options (e.g. block-outside-dns) sent to clients on connect.
+ALTER TABLE gateways ADD COLUMN IF NOT EXISTS push_options TEXT[] NOT NULL DEFAULT '{}';
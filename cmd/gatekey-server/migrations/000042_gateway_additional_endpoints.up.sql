@@ -0,0 +1,3 @@
+-- Additional listen endpoints per gateway (e.g. TCP 443 fallback alongside UDP 1194).
+-- Each entry is {"protocol": "tcp", "port": 443, "subnet": "172.31.254.0/24"}.
+ALTER TABLE gateways ADD COLUMN IF NOT EXISTS additional_endpoints JSONB NOT NULL DEFAULT '[]';
@@ -0,0 +1,2 @@
+ALTER TABLE mesh_hubs DROP COLUMN IF EXISTS tls_mode;
+ALTER TABLE gateways DROP COLUMN IF EXISTS tls_mode;
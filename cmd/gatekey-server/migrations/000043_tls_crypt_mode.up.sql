@@ -0,0 +1,4 @@
+-- Control channel protection mode: 'auth' (tls-auth) or 'crypt' (tls-crypt).
+-- Only applies when tls_auth_enabled is true; the stored static key is used for either mode.
+ALTER TABLE gateways ADD COLUMN IF NOT EXISTS tls_mode VARCHAR(10) NOT NULL DEFAULT 'auth';
+ALTER TABLE mesh_hubs ADD COLUMN IF NOT EXISTS tls_mode VARCHAR(10) NOT NULL DEFAULT 'auth';
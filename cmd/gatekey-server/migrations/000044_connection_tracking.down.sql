@@ -0,0 +1,3 @@
+-- The connections table predates connection tracking, so only the indexes are removed.
+DROP INDEX IF EXISTS idx_connections_open;
+DROP INDEX IF EXISTS idx_connections_connected_at;
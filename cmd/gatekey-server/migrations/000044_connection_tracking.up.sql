@@ -0,0 +1,24 @@
+-- Record VPN connections reported by gateway agents so admins can search and
+-- export connection history.
+CREATE TABLE IF NOT EXISTS connections (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    session_id UUID,
+    certificate_id UUID,
+    gateway_id UUID REFERENCES gateways(id) ON DELETE CASCADE,
+    client_ip INET,
+    vpn_ipv4 INET,
+    vpn_ipv6 INET,
+    bytes_sent BIGINT NOT NULL DEFAULT 0,
+    bytes_received BIGINT NOT NULL DEFAULT 0,
+    connected_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    disconnected_at TIMESTAMP WITH TIME ZONE,
+    disconnect_reason VARCHAR(100)
+);
+
+-- Gateways report connections without a GateKey session or certificate record
+ALTER TABLE connections ALTER COLUMN session_id DROP NOT NULL;
+ALTER TABLE connections ALTER COLUMN certificate_id DROP NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_connections_connected_at ON connections(connected_at DESC);
+CREATE INDEX IF NOT EXISTS idx_connections_open ON connections(gateway_id, user_id) WHERE disconnected_at IS NULL;
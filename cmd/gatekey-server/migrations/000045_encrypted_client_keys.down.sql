@@ -0,0 +1 @@
+ALTER TABLE gateways DROP COLUMN IF EXISTS encrypt_client_keys;
@@ -0,0 +1,3 @@
+-- When enabled, generated client configs embed a passphrase-encrypted private key.
+-- The passphrase is shown once at generation time and is not stored.
+ALTER TABLE gateways ADD COLUMN IF NOT EXISTS encrypt_client_keys BOOLEAN NOT NULL DEFAULT false;
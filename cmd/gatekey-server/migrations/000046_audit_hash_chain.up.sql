@@ -0,0 +1,33 @@
+-- Admin audit trail. Each record carries the hash of the previous record, so any
+-- later edit, deletion, or reordering breaks the chain.
+CREATE TABLE IF NOT EXISTS audit_logs (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    timestamp TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    event VARCHAR(100) NOT NULL,
+    actor_id UUID,
+    actor_email VARCHAR(255),
+    actor_ip INET,
+    resource_type VARCHAR(50),
+    resource_id UUID,
+    details JSONB,
+    success BOOLEAN NOT NULL DEFAULT true
+);
+
+-- Chain order; existing rows are numbered in table order and left unchained
+ALTER TABLE audit_logs ADD COLUMN IF NOT EXISTS seq BIGSERIAL;
+ALTER TABLE audit_logs ADD COLUMN IF NOT EXISTS prev_hash VARCHAR(64);
+ALTER TABLE audit_logs ADD COLUMN IF NOT EXISTS hash VARCHAR(64);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_audit_logs_seq ON audit_logs(seq);
+CREATE INDEX IF NOT EXISTS idx_audit_logs_timestamp ON audit_logs(timestamp DESC);
+
+-- Periodic checkpoints of the chain head, signed with the CA key
+CREATE TABLE IF NOT EXISTS audit_anchors (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    seq BIGINT NOT NULL,
+    hash VARCHAR(64) NOT NULL,
+    signature TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_anchors_seq ON audit_anchors(seq);
@@ -0,0 +1,22 @@
+-- LDAP / Active Directory authentication providers
+CREATE TABLE IF NOT EXISTS ldap_providers (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name VARCHAR(255) NOT NULL UNIQUE,
+    display_name VARCHAR(255) NOT NULL,
+    url VARCHAR(1024) NOT NULL,
+    bind_dn VARCHAR(1024) NOT NULL DEFAULT '',
+    bind_password TEXT NOT NULL DEFAULT '',
+    base_dn VARCHAR(1024) NOT NULL,
+    user_filter TEXT NOT NULL DEFAULT '',
+    group_filter TEXT NOT NULL DEFAULT '',
+    group_attribute VARCHAR(255) NOT NULL DEFAULT '',
+    email_attribute VARCHAR(255) NOT NULL DEFAULT '',
+    name_attribute VARCHAR(255) NOT NULL DEFAULT '',
+    start_tls BOOLEAN NOT NULL DEFAULT false,
+    insecure_skip_verify BOOLEAN NOT NULL DEFAULT false,
+    ca_cert TEXT NOT NULL DEFAULT '',
+    admin_group VARCHAR(255),
+    is_enabled BOOLEAN NOT NULL DEFAULT true,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
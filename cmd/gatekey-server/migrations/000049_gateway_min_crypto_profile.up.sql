@@ -0,0 +1,3 @@
+-- Per-gateway minimum crypto profile, e.g. to require FIPS on one gateway while
+-- others use the modern profile. Empty means no per-gateway minimum.
+ALTER TABLE gateways ADD COLUMN IF NOT EXISTS min_crypto_profile VARCHAR(20) NOT NULL DEFAULT '';
@@ -0,0 +1,19 @@
+-- Deleted rows would otherwise reappear once the column is gone
+DELETE FROM gateways WHERE deleted_at IS NOT NULL;
+DELETE FROM networks WHERE deleted_at IS NOT NULL;
+DELETE FROM local_users WHERE deleted_at IS NOT NULL;
+
+DROP INDEX IF EXISTS idx_gateways_deleted_at;
+DROP INDEX IF EXISTS idx_networks_deleted_at;
+DROP INDEX IF EXISTS idx_local_users_deleted_at;
+
+DROP INDEX IF EXISTS gateways_name_key;
+DROP INDEX IF EXISTS networks_name_key;
+DROP INDEX IF EXISTS local_users_username_key;
+ALTER TABLE gateways ADD CONSTRAINT gateways_name_key UNIQUE (name);
+ALTER TABLE networks ADD CONSTRAINT networks_name_key UNIQUE (name);
+ALTER TABLE local_users ADD CONSTRAINT local_users_username_key UNIQUE (username);
+
+ALTER TABLE gateways DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE networks DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE local_users DROP COLUMN IF EXISTS deleted_at;
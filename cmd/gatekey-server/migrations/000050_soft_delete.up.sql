@@ -0,0 +1,19 @@
+-- Soft delete for gateways, networks and local users. Deleted rows keep their
+-- assignments so they can be restored until the retention window passes.
+ALTER TABLE gateways ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE networks ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE local_users ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP WITH TIME ZONE;
+
+-- Names only need to be unique among rows that haven't been deleted
+ALTER TABLE gateways DROP CONSTRAINT IF EXISTS gateways_name_key;
+CREATE UNIQUE INDEX IF NOT EXISTS gateways_name_key ON gateways(name) WHERE deleted_at IS NULL;
+
+ALTER TABLE networks DROP CONSTRAINT IF EXISTS networks_name_key;
+CREATE UNIQUE INDEX IF NOT EXISTS networks_name_key ON networks(name) WHERE deleted_at IS NULL;
+
+ALTER TABLE local_users DROP CONSTRAINT IF EXISTS local_users_username_key;
+CREATE UNIQUE INDEX IF NOT EXISTS local_users_username_key ON local_users(username) WHERE deleted_at IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_gateways_deleted_at ON gateways(deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_networks_deleted_at ON networks(deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_local_users_deleted_at ON local_users(deleted_at) WHERE deleted_at IS NOT NULL;
@@ -0,0 +1,21 @@
+-- Admin changes held for a second admin's approval (maker-checker). The original
+-- request is stored as-is and replayed when the change is approved.
+CREATE TABLE IF NOT EXISTS pending_changes (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    category VARCHAR(50) NOT NULL,
+    method VARCHAR(10) NOT NULL,
+    path TEXT NOT NULL,
+    body TEXT NOT NULL DEFAULT '',
+    status VARCHAR(20) NOT NULL DEFAULT 'pending', -- pending, approved, applied, failed, rejected
+    requested_by VARCHAR(255) NOT NULL,
+    requested_by_email VARCHAR(255) NOT NULL DEFAULT '',
+    reviewed_by VARCHAR(255),
+    reviewed_by_email VARCHAR(255),
+    review_comment TEXT NOT NULL DEFAULT '',
+    result_status INTEGER,
+    result_body TEXT,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    reviewed_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS idx_pending_changes_status ON pending_changes(status, created_at);
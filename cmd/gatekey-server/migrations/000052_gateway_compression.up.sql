@@ -0,0 +1,3 @@
+-- Data channel compression: 'none', 'lz4' or 'lzo'. Emitted in both the gateway's
+-- server config and generated client configs so the two always agree.
+ALTER TABLE gateways ADD COLUMN IF NOT EXISTS compression VARCHAR(10) NOT NULL DEFAULT 'none';
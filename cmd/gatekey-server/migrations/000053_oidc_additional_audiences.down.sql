@@ -0,0 +1 @@
+ALTER TABLE oidc_providers DROP COLUMN IF EXISTS additional_audiences;
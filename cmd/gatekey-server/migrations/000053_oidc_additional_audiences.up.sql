@@ -0,0 +1,4 @@
+-- Other client IDs whose ID tokens an OIDC provider accepts, for organisations
+-- with several OAuth clients (e.g. web and mobile) on the same IdP. The code
+-- exchange still uses client_id.
+ALTER TABLE oidc_providers ADD COLUMN IF NOT EXISTS additional_audiences JSONB NOT NULL DEFAULT '[]';
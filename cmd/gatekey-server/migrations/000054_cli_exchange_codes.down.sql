@@ -0,0 +1 @@
+DROP TABLE IF EXISTS cli_exchange_codes;
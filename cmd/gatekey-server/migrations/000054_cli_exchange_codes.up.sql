@@ -0,0 +1,11 @@
+-- Single-use codes the CLI exchanges for its session token after a browser login,
+-- so the token never appears in a redirect URL. Only a SHA-256 hash of each code
+-- is stored, and codes expire after a minute.
+CREATE TABLE IF NOT EXISTS cli_exchange_codes (
+    code_hash VARCHAR(64) PRIMARY KEY,
+    session_token TEXT NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_cli_exchange_codes_expires ON cli_exchange_codes(expires_at);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_users_common_name;
+ALTER TABLE users DROP COLUMN IF EXISTS common_name;
+ALTER TABLE oidc_providers DROP COLUMN IF EXISTS cn_source;
@@ -0,0 +1,8 @@
+-- Where an OIDC provider takes users' VPN certificate common name from: the
+-- email (default), the immutable subject, or a custom claim (claim:<name>).
+ALTER TABLE oidc_providers ADD COLUMN IF NOT EXISTS cn_source VARCHAR(100) NOT NULL DEFAULT 'email';
+
+-- The common name resolved at login for users whose provider doesn't use the
+-- email. NULL means the email is the common name.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS common_name VARCHAR(255);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_common_name ON users(common_name) WHERE common_name IS NOT NULL;
@@ -0,0 +1,15 @@
+DROP INDEX IF EXISTS idx_users_tenant_id;
+DROP INDEX IF EXISTS idx_access_rules_tenant_id;
+DROP INDEX IF EXISTS idx_networks_tenant_id;
+DROP INDEX IF EXISTS idx_gateways_tenant_id;
+
+ALTER TABLE local_users DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE users DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE ldap_providers DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE saml_providers DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE oidc_providers DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE access_rules DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE networks DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE gateways DROP COLUMN IF EXISTS tenant_id;
+
+DROP TABLE IF EXISTS tenants;
@@ -0,0 +1,4 @@
+-- Per-gateway keepalive and MTU settings (keepalive_interval, keepalive_timeout,
+-- tun_mtu, mssfix, fragment), emitted in both the gateway's server config and
+-- generated client configs. Missing keys keep the OpenVPN defaults.
+ALTER TABLE gateways ADD COLUMN IF NOT EXISTS link_tuning JSONB NOT NULL DEFAULT '{}';
@@ -0,0 +1,13 @@
+-- Recent group sets reported for each SSO user, kept for debugging IdP group
+-- claims. "received" is what the identity provider sent; "groups" is what was
+-- stored, which differs when an empty set was ignored (auth.empty_groups: retain).
+CREATE TABLE IF NOT EXISTS user_group_history (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    groups JSONB NOT NULL DEFAULT '[]',
+    received JSONB NOT NULL DEFAULT '[]',
+    anomaly BOOLEAN NOT NULL DEFAULT false,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_group_history_user ON user_group_history(user_id, created_at DESC);
@@ -0,0 +1,16 @@
+-- "This wasn't me" links sent in new sign-in emails. Using one signs the user out
+-- everywhere and revokes their VPN configs. Only a SHA-256 hash of each token is
+-- stored; used_at enforces single use.
+CREATE TABLE IF NOT EXISTS sign_in_alerts (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id VARCHAR(255) NOT NULL,
+    user_email VARCHAR(255) NOT NULL,
+    provider VARCHAR(50) NOT NULL,
+    ip_address VARCHAR(45),
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    used_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_sign_in_alerts_expires ON sign_in_alerts(expires_at);
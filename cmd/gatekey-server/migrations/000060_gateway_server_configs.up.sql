@@ -0,0 +1,10 @@
+-- OpenVPN server configs gateways report running, one row per instance ("server"
+-- for the primary, plus one per additional endpoint). Key material is redacted by
+-- the gateway before it is sent.
+CREATE TABLE IF NOT EXISTS gateway_server_configs (
+    gateway_id UUID NOT NULL REFERENCES gateways(id) ON DELETE CASCADE,
+    instance VARCHAR(100) NOT NULL,
+    config TEXT NOT NULL,
+    reported_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (gateway_id, instance)
+);
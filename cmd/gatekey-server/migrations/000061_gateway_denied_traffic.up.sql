@@ -0,0 +1,18 @@
+-- Traffic gateways' default deny policy dropped, as summarized and reported by
+-- gateways with deny_log enabled. Packet counts for the same user and destination
+-- are added up across reports.
+CREATE TABLE IF NOT EXISTS gateway_denied_traffic (
+    gateway_id UUID NOT NULL REFERENCES gateways(id) ON DELETE CASCADE,
+    user_email VARCHAR(255) NOT NULL DEFAULT '',
+    client_ip VARCHAR(45) NOT NULL,
+    dest_ip VARCHAR(45) NOT NULL,
+    protocol VARCHAR(16) NOT NULL,
+    dest_port INTEGER NOT NULL DEFAULT 0,
+    packets BIGINT NOT NULL,
+    first_seen TIMESTAMP WITH TIME ZONE NOT NULL,
+    last_seen TIMESTAMP WITH TIME ZONE NOT NULL,
+    PRIMARY KEY (gateway_id, user_email, dest_ip, protocol, dest_port)
+);
+
+CREATE INDEX IF NOT EXISTS idx_gateway_denied_traffic_user ON gateway_denied_traffic(user_email, last_seen DESC);
+CREATE INDEX IF NOT EXISTS idx_gateway_denied_traffic_last_seen ON gateway_denied_traffic(last_seen);
@@ -0,0 +1,2 @@
+ALTER TABLE policies DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE policies DROP COLUMN IF EXISTS constraints;
@@ -0,0 +1,4 @@
+-- Connection constraints a policy sets for its subjects: certificate validity,
+-- allowed time windows, a concurrent session limit and a required crypto profile.
+ALTER TABLE policies ADD COLUMN IF NOT EXISTS constraints JSONB;
+ALTER TABLE policies ADD COLUMN IF NOT EXISTS tenant_id UUID NOT NULL DEFAULT '00000000-0000-0000-0000-000000000001' REFERENCES tenants(id);
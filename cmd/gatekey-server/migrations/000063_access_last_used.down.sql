@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_users_last_vpn_auth_at;
+ALTER TABLE users DROP COLUMN IF EXISTS last_vpn_auth_at;
+ALTER TABLE generated_configs DROP COLUMN IF EXISTS last_used_at;
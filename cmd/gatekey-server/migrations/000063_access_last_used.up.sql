@@ -0,0 +1,7 @@
+-- When a config, and its user, last passed gateway verification, so access that
+-- is no longer used can be found and reclaimed. Configs expire quickly, so the
+-- user's timestamp is what dormancy reviews rely on.
+ALTER TABLE generated_configs ADD COLUMN IF NOT EXISTS last_used_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS last_vpn_auth_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX IF NOT EXISTS idx_users_last_vpn_auth_at ON users(last_vpn_auth_at);
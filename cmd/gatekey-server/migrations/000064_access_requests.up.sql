@@ -0,0 +1,29 @@
+-- Users' requests for access to a gateway or network they can't reach. Approved
+-- requests become a gateway assignment or access rule assignment, removed again
+-- at access_expires_at when the approval was time-bounded.
+CREATE TABLE IF NOT EXISTS access_requests (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    tenant_id UUID NOT NULL DEFAULT '00000000-0000-0000-0000-000000000001' REFERENCES tenants(id),
+    user_id VARCHAR(255) NOT NULL,
+    user_email VARCHAR(255) NOT NULL,
+    resource_type VARCHAR(20) NOT NULL CHECK (resource_type IN ('gateway', 'network')),
+    resource_id UUID NOT NULL,
+    resource_name VARCHAR(255) NOT NULL,
+    justification TEXT NOT NULL,
+    duration_hours INTEGER,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    reviewed_by VARCHAR(255),
+    reviewed_by_email VARCHAR(255),
+    review_comment TEXT NOT NULL DEFAULT '',
+    granted_rule_id UUID,
+    granted BOOLEAN NOT NULL DEFAULT FALSE, -- The approval created the assignment, so expiry removes it
+    access_expires_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    reviewed_at TIMESTAMP WITH TIME ZONE
+);
+
+-- One open request per user and resource
+CREATE UNIQUE INDEX IF NOT EXISTS idx_access_requests_pending
+    ON access_requests(user_id, resource_type, resource_id) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_access_requests_status ON access_requests(status, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_access_requests_expiry ON access_requests(access_expires_at) WHERE status = 'approved';
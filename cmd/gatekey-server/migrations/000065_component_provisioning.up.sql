@@ -0,0 +1,13 @@
+-- What each gateway, mesh hub and mesh spoke last reported and was last
+-- provisioned with, so a reprovision rollout (typically after a CA rotation) can
+-- be followed until every component has converged.
+CREATE TABLE IF NOT EXISTS component_provisioning (
+    component_type VARCHAR(10) NOT NULL CHECK (component_type IN ('gateway', 'hub', 'spoke')),
+    component_id UUID NOT NULL,
+    reported_config_version VARCHAR(255) NOT NULL DEFAULT '',
+    reported_at TIMESTAMP WITH TIME ZONE, -- When the reported version was first seen
+    provisioned_ca_fingerprint VARCHAR(64) NOT NULL DEFAULT '',
+    provisioned_at TIMESTAMP WITH TIME ZONE,
+    reprovision_requested_at TIMESTAMP WITH TIME ZONE,
+    PRIMARY KEY (component_type, component_id)
+);
@@ -0,0 +1,19 @@
+-- Email and other notifications waiting to be delivered, so request handlers
+-- only record them and a slow or unreachable destination can't hold up logins.
+-- Delivered notifications are deleted; ones that ran out of attempts keep
+-- failed_at set for a while for troubleshooting.
+CREATE TABLE IF NOT EXISTS notification_queue (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    kind VARCHAR(50) NOT NULL,
+    payload JSONB NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    max_attempts INTEGER NOT NULL,
+    next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    locked_until TIMESTAMP WITH TIME ZONE, -- Lease held by the server delivering it
+    last_error TEXT NOT NULL DEFAULT '',
+    failed_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_notification_queue_due ON notification_queue(next_attempt_at) WHERE failed_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_notification_queue_failed ON notification_queue(failed_at) WHERE failed_at IS NOT NULL;
@@ -0,0 +1,2 @@
+-- PKCE code verifier for OIDC logins, sent with the authorization code
+ALTER TABLE oauth_states ADD COLUMN IF NOT EXISTS code_verifier VARCHAR(128) NOT NULL DEFAULT '';
@@ -0,0 +1,4 @@
+ALTER TABLE saml_providers DROP COLUMN IF EXISTS sp_private_key;
+ALTER TABLE saml_providers DROP COLUMN IF EXISTS sp_certificate;
+ALTER TABLE saml_providers DROP COLUMN IF EXISTS name_id_format;
+ALTER TABLE saml_providers DROP COLUMN IF EXISTS sign_requests;
@@ -0,0 +1,5 @@
+-- Per-provider SP signing key pair, generated on first use, and request options
+ALTER TABLE saml_providers ADD COLUMN IF NOT EXISTS sign_requests BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE saml_providers ADD COLUMN IF NOT EXISTS name_id_format VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE saml_providers ADD COLUMN IF NOT EXISTS sp_certificate TEXT;
+ALTER TABLE saml_providers ADD COLUMN IF NOT EXISTS sp_private_key TEXT;
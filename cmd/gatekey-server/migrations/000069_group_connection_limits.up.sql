@@ -0,0 +1,10 @@
+-- Caps on how many of a group's members may be connected at once. A user in
+-- several limited groups must fit under every one of them.
+CREATE TABLE IF NOT EXISTS group_connection_limits (
+    tenant_id UUID NOT NULL DEFAULT '00000000-0000-0000-0000-000000000001' REFERENCES tenants(id),
+    group_name VARCHAR(255) NOT NULL,
+    max_users INTEGER NOT NULL CHECK (max_users > 0),
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (tenant_id, group_name)
+);
@@ -0,0 +1,20 @@
+-- Lifecycle history of mesh hubs and spokes: provisioning, reprovision signals,
+-- status changes, spoke connects and disconnects, and route changes. hub_id is
+-- the hub itself for hub events and the spoke's hub for spoke events, so a
+-- hub's whole mesh can be followed in one query.
+CREATE TABLE IF NOT EXISTS mesh_events (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    component_type VARCHAR(10) NOT NULL CHECK (component_type IN ('hub', 'spoke')),
+    component_id UUID NOT NULL,
+    component_name VARCHAR(255) NOT NULL,
+    hub_id UUID NOT NULL,
+    event_type VARCHAR(50) NOT NULL,
+    outcome VARCHAR(10) NOT NULL CHECK (outcome IN ('success', 'failure')),
+    message TEXT NOT NULL DEFAULT '',
+    remote_ip VARCHAR(64) NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_mesh_events_component ON mesh_events(component_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_mesh_events_hub ON mesh_events(hub_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_mesh_events_created ON mesh_events(created_at);
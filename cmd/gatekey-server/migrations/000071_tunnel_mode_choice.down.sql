@@ -0,0 +1,3 @@
+ALTER TABLE connections DROP COLUMN IF EXISTS tunnel_mode;
+ALTER TABLE generated_configs DROP COLUMN IF EXISTS tunnel_mode;
+ALTER TABLE gateways DROP COLUMN IF EXISTS allow_tunnel_choice;
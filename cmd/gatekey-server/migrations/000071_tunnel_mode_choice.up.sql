@@ -0,0 +1,6 @@
+-- Lets users pick full or split tunnel per config on gateways that allow it.
+-- The gateway's full_tunnel_mode stays the default. The chosen mode is kept on
+-- the config, applied when it connects and recorded on the connection.
+ALTER TABLE gateways ADD COLUMN IF NOT EXISTS allow_tunnel_choice BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE generated_configs ADD COLUMN IF NOT EXISTS tunnel_mode VARCHAR(10) NOT NULL DEFAULT '';
+ALTER TABLE connections ADD COLUMN IF NOT EXISTS tunnel_mode VARCHAR(10) NOT NULL DEFAULT '';
@@ -0,0 +1,7 @@
+ALTER TABLE local_users DROP COLUMN IF EXISTS inactivity_warned_at;
+ALTER TABLE local_users DROP COLUMN IF EXISTS reactivated_at;
+ALTER TABLE local_users DROP COLUMN IF EXISTS deactivated_at;
+ALTER TABLE users DROP COLUMN IF EXISTS inactivity_warned_at;
+ALTER TABLE users DROP COLUMN IF EXISTS reactivated_at;
+ALTER TABLE users DROP COLUMN IF EXISTS deactivation_reason;
+ALTER TABLE users DROP COLUMN IF EXISTS deactivated_at;
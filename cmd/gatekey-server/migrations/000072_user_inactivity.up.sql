@@ -0,0 +1,10 @@
+-- Deactivates users who haven't been active for user_inactivity_days, after
+-- warning them. reactivated_at counts as activity so a user an admin brings back
+-- isn't deactivated again at once.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS deactivated_at TIMESTAMPTZ;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS deactivation_reason VARCHAR(50);
+ALTER TABLE users ADD COLUMN IF NOT EXISTS reactivated_at TIMESTAMPTZ;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS inactivity_warned_at TIMESTAMPTZ;
+ALTER TABLE local_users ADD COLUMN IF NOT EXISTS deactivated_at TIMESTAMPTZ;
+ALTER TABLE local_users ADD COLUMN IF NOT EXISTS reactivated_at TIMESTAMPTZ;
+ALTER TABLE local_users ADD COLUMN IF NOT EXISTS inactivity_warned_at TIMESTAMPTZ;
@@ -0,0 +1,3 @@
+ALTER TABLE generated_configs DROP COLUMN IF EXISTS purpose;
+ALTER TABLE generated_configs DROP COLUMN IF EXISTS device_os;
+ALTER TABLE generated_configs DROP COLUMN IF EXISTS device_name;
@@ -0,0 +1,6 @@
+-- Lets clients label generated configs with the device they're for and why, so
+-- admins can tell a user's configs apart. The gatekey client fills in the device
+-- name and OS itself.
+ALTER TABLE generated_configs ADD COLUMN IF NOT EXISTS device_name VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE generated_configs ADD COLUMN IF NOT EXISTS device_os VARCHAR(100) NOT NULL DEFAULT '';
+ALTER TABLE generated_configs ADD COLUMN IF NOT EXISTS purpose VARCHAR(255) NOT NULL DEFAULT '';
@@ -0,0 +1,22 @@
+-- CA activations scheduled for a maintenance window. At scheduled_at the server
+-- activates the pending CA and reprovisions every component, then waits up to
+-- converge_minutes for them to converge; if more than max_failed_percent haven't,
+-- it re-activates previous_ca_id. Only one window can be open at a time.
+CREATE TABLE IF NOT EXISTS maintenance_windows (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    ca_id VARCHAR(255) NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    scheduled_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    converge_minutes INTEGER NOT NULL,
+    max_failed_percent INTEGER NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'scheduled', -- scheduled, running, completed, rolled_back, failed, cancelled
+    previous_ca_id VARCHAR(255) NOT NULL DEFAULT '',
+    outcome TEXT NOT NULL DEFAULT '',
+    created_by VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    started_at TIMESTAMP WITH TIME ZONE,
+    finished_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_maintenance_windows_open ON maintenance_windows((TRUE)) WHERE status IN ('scheduled', 'running');
+CREATE INDEX IF NOT EXISTS idx_maintenance_windows_created ON maintenance_windows(created_at);
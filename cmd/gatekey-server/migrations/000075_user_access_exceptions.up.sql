@@ -0,0 +1,18 @@
+-- Per-user exceptions to access granted directly or through groups. An exception
+-- names either an access rule or a destination; a destination excludes every
+-- rule whose destination falls within it. Exceptions always win over grants.
+CREATE TABLE IF NOT EXISTS user_access_exceptions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    access_rule_id UUID REFERENCES access_rules(id) ON DELETE CASCADE,
+    destination_type VARCHAR(50) NOT NULL DEFAULT '', -- ip, cidr, hostname or hostname_wildcard
+    destination VARCHAR(255) NOT NULL DEFAULT '',
+    reason TEXT NOT NULL DEFAULT '',
+    created_by VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    CHECK ((access_rule_id IS NULL) <> (destination = ''))
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_access_exceptions_user ON user_access_exceptions(user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_user_access_exceptions_rule ON user_access_exceptions(user_id, access_rule_id) WHERE access_rule_id IS NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_user_access_exceptions_destination ON user_access_exceptions(user_id, destination_type, destination) WHERE access_rule_id IS NULL;
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_audit_logs_tenant_id;
+DROP INDEX IF EXISTS idx_login_logs_tenant_id;
+
+ALTER TABLE audit_logs DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE login_logs DROP COLUMN IF EXISTS tenant_id;
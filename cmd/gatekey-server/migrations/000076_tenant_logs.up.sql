@@ -0,0 +1,13 @@
+-- Login and audit logs belong to a tenant, so tenant admins only see their own.
+-- They don't reference tenants: records outlive a deleted tenant, and the audit
+-- trail can't be deleted from without breaking its hash chain.
+ALTER TABLE login_logs ADD COLUMN IF NOT EXISTS tenant_id UUID NOT NULL DEFAULT '00000000-0000-0000-0000-000000000001';
+ALTER TABLE audit_logs ADD COLUMN IF NOT EXISTS tenant_id UUID NOT NULL DEFAULT '00000000-0000-0000-0000-000000000001';
+
+UPDATE login_logs l SET tenant_id = u.tenant_id FROM users u WHERE u.id::text = l.user_id::text;
+UPDATE login_logs l SET tenant_id = u.tenant_id FROM local_users u WHERE u.id::text = l.user_id::text;
+UPDATE audit_logs a SET tenant_id = u.tenant_id FROM users u WHERE u.id::text = a.actor_id::text;
+UPDATE audit_logs a SET tenant_id = u.tenant_id FROM local_users u WHERE u.id::text = a.actor_id::text;
+
+CREATE INDEX IF NOT EXISTS idx_login_logs_tenant_id ON login_logs(tenant_id);
+CREATE INDEX IF NOT EXISTS idx_audit_logs_tenant_id ON audit_logs(tenant_id);
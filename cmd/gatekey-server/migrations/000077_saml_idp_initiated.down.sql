@@ -0,0 +1 @@
+ALTER TABLE saml_providers DROP COLUMN IF EXISTS allow_idp_initiated;
@@ -0,0 +1,3 @@
+-- Whether a SAML provider accepts IdP-initiated logins, which don't answer an
+-- AuthnRequest. Off by default: logins have always needed a stored relay state.
+ALTER TABLE saml_providers ADD COLUMN IF NOT EXISTS allow_idp_initiated BOOLEAN NOT NULL DEFAULT false;
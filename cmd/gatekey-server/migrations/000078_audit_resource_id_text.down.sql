@@ -0,0 +1,4 @@
+-- Resource IDs that aren't UUIDs are cleared
+UPDATE audit_logs SET resource_id = NULL
+WHERE resource_id !~* '^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$';
+ALTER TABLE audit_logs ALTER COLUMN resource_id TYPE UUID USING resource_id::uuid;
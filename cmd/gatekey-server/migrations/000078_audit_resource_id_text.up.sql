@@ -0,0 +1,4 @@
+-- Audit records name resources that have no UUID, such as groups and CA
+-- certificates by fingerprint. Existing UUIDs keep their text form, so record
+-- hashes still verify.
+ALTER TABLE audit_logs ALTER COLUMN resource_id TYPE TEXT USING resource_id::text;
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_pending_changes_tenant_id;
+
+ALTER TABLE pending_changes DROP COLUMN IF EXISTS tenant_id;
@@ -0,0 +1,10 @@
+-- Pending changes belong to the tenant they were requested in, so only that
+-- tenant's admins see and review them, and approved changes are replayed there.
+-- Like the logs they don't reference tenants, so a tenant's change history
+-- doesn't stop it being deleted.
+ALTER TABLE pending_changes ADD COLUMN IF NOT EXISTS tenant_id UUID NOT NULL DEFAULT '00000000-0000-0000-0000-000000000001';
+
+UPDATE pending_changes p SET tenant_id = u.tenant_id FROM users u WHERE u.id::text = p.requested_by;
+UPDATE pending_changes p SET tenant_id = u.tenant_id FROM local_users u WHERE u.id::text = p.requested_by;
+
+CREATE INDEX IF NOT EXISTS idx_pending_changes_tenant_id ON pending_changes(tenant_id);
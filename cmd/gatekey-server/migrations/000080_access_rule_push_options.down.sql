@@ -0,0 +1 @@
+ALTER TABLE access_rules DROP COLUMN IF EXISTS push_options;
@@ -0,0 +1,2 @@
+-- Allowlisted push options sent to users granted the rule, on top of the gateway's.
+ALTER TABLE access_rules ADD COLUMN IF NOT EXISTS push_options TEXT[] NOT NULL DEFAULT '{}';
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/gatekey-project/gatekey/internal/config"
+	"github.com/gatekey-project/gatekey/internal/db"
+	"github.com/gatekey-project/gatekey/internal/secrets"
+)
+
+func newSecretsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "secrets",
+		Short: "Manage encryption of secrets stored in the database",
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "generate-key",
+		Short: "Generate a key for database.encryption.keys",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			key, err := secrets.GenerateKey()
+			if err != nil {
+				return err
+			}
+			fmt.Println(key)
+			return nil
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "status",
+		Short: "Show how stored secrets are encrypted",
+		Long: `Counts the values in every secret column that are plaintext or encrypted
+with each key. Exits with an error if any value isn't encrypted with the
+primary key, so it can be used to verify a rekey.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			database, err := openSecretsDB(cmd.Context())
+			if err != nil {
+				return err
+			}
+			defer database.Close()
+
+			statuses, err := database.SecretStatus(cmd.Context())
+			if err != nil {
+				return err
+			}
+			primary := database.Secrets.Primary()
+			stale := 0
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "COLUMN\tPLAINTEXT\tENCRYPTED")
+			for _, st := range statuses {
+				ids := make([]string, 0, len(st.ByKey))
+				for id, n := range st.ByKey {
+					ids = append(ids, fmt.Sprintf("%s=%d", id, n))
+					if id != primary {
+						stale += n
+					}
+				}
+				sort.Strings(ids)
+				stale += st.Plaintext
+				fmt.Fprintf(w, "%s.%s\t%d\t%s\n", st.Table, st.Column, st.Plaintext, strings.Join(ids, " "))
+			}
+			w.Flush()
+
+			if primary == "" {
+				fmt.Println("\nNo encryption keys are configured; new secrets are stored as plaintext.")
+			}
+			if stale > 0 {
+				return fmt.Errorf("%d secrets are not encrypted with the primary key; run \"gatekey-server secrets rekey\"", stale)
+			}
+			return nil
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "rekey",
+		Short: "Re-encrypt every stored secret with the primary key",
+		Long: `Decrypts every secret column value with the key it was encrypted with and
+encrypts it again with database.encryption.key_id. Plaintext values are encrypted
+for the first time. Every key that encrypted an existing value must still be in
+database.encryption.keys. The rekey runs in one transaction, so a failure leaves
+every value as it was.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			database, err := openSecretsDB(cmd.Context())
+			if err != nil {
+				return err
+			}
+			defer database.Close()
+
+			n, err := database.RekeySecrets(cmd.Context())
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Rekeyed %d secrets with key %q\n", n, database.Secrets.Primary())
+			return nil
+		},
+	})
+
+	return cmd
+}
+
+// openSecretsDB connects to the configured database with the configured keyring.
+func openSecretsDB(ctx context.Context) (*db.DB, error) {
+	cfg, err := config.Load(configPaths...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	database, err := db.New(ctx, cfg.Database.URL)
+	if err != nil {
+		return nil, err
+	}
+	if database.Secrets, err = cfg.Database.Encryption.Keyring(); err != nil {
+		database.Close()
+		return nil, fmt.Errorf("invalid database.encryption: %w", err)
+	}
+	return database, nil
+}
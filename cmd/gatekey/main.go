@@ -42,7 +42,10 @@ Quick start:
 		connectCmd(),
 		disconnectCmd(),
 		statusCmd(),
+		verifyCmd(),
+		doctorCmd(),
 		listCmd(),
+		reachableCmd(),
 		configCmd(),
 		versionCmd(),
 		fipsCheckCmd(),
@@ -119,6 +122,8 @@ func logoutCmd() *cobra.Command {
 func connectCmd() *cobra.Command {
 	var gateway string
 	var mesh string
+	var tunnel string
+	var purpose string
 
 	cmd := &cobra.Command{
 		Use:   "connect [gateway]",
@@ -133,6 +138,9 @@ For mesh hubs:
   gatekey connect --mesh <hub>
 
 If no gateway is specified and only one is available, it connects to that one.
+The gateway can be given by name (case-insensitive) or ID. The command exits
+non-zero if the gateway is not accessible, or if the name is ambiguous or
+omitted while several gateways are available.
 
 This command:
 1. Checks your authentication status
@@ -150,6 +158,13 @@ This command:
 			}
 
 			vpn := client.NewVPNManager(cfg)
+			switch tunnel {
+			case "", "full", "split":
+				vpn.TunnelMode = tunnel
+			default:
+				return fmt.Errorf("--tunnel must be 'full' or 'split'")
+			}
+			vpn.Purpose = purpose
 
 			// If --mesh flag is provided, connect to mesh hub
 			if mesh != "" {
@@ -167,6 +182,8 @@ This command:
 
 	cmd.Flags().StringVarP(&gateway, "gateway", "g", "", "Gateway name to connect to")
 	cmd.Flags().StringVarP(&mesh, "mesh", "m", "", "Mesh hub name to connect to")
+	cmd.Flags().StringVar(&tunnel, "tunnel", "", "Tunnel mode, full or split, on gateways that let you choose (default: the gateway's)")
+	cmd.Flags().StringVar(&purpose, "purpose", "", "Why you need this config, shown to admins alongside this device's name and OS")
 
 	return cmd
 }
@@ -236,10 +253,100 @@ func statusCmd() *cobra.Command {
 	return cmd
 }
 
+func verifyCmd() *cobra.Command {
+	var gateway, probe, domain string
+	var jsonOutput bool
+
+	cmd := &cobra.Command{
+		Use:   "verify",
+		Short: "Check routes and DNS on an active connection",
+		Long: `Check that an active connection works as intended.
+
+Checks that the routes pushed by the gateway go through the tunnel, that an
+internal host is reachable (--probe), that internal names resolve via the
+tunnel DNS servers (--domain, default the pushed search domain) and, in
+full-tunnel mode, that DNS queries don't leak to a resolver outside the tunnel.
+
+Set defaults for --probe and --domain with 'gatekey config set verify_probe'
+and 'gatekey config set verify_domain'. Exits non-zero if any check fails.
+
+Examples:
+  gatekey verify
+  gatekey verify --gateway us-east --probe git.internal:443 --domain git.internal
+  gatekey verify --json`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := client.LoadConfig(cfgFile)
+			if err != nil {
+				return fmt.Errorf("failed to load config: %w", err)
+			}
+
+			vpn := client.NewVPNManager(cfg)
+			opts := client.VerifyOptions{Probe: probe, Domain: domain}
+			return vpn.Verify(cmd.Context(), gateway, opts, jsonOutput)
+		},
+	}
+
+	cmd.Flags().StringVarP(&gateway, "gateway", "g", "", "Gateway to verify (default: the only active connection)")
+	cmd.Flags().StringVar(&probe, "probe", "", "Internal host:port to connect to through the tunnel")
+	cmd.Flags().StringVar(&domain, "domain", "", "Internal name that should resolve via the tunnel DNS")
+	cmd.Flags().BoolVar(&jsonOutput, "json", false, "Output in JSON format")
+
+	return cmd
+}
+
+func doctorCmd() *cobra.Command {
+	var jsonOutput bool
+
+	cmd := &cobra.Command{
+		Use:   "doctor",
+		Short: "Diagnose connection problems",
+		Long: `Run the checks needed to connect and report how to fix any that fail.
+
+Checks that the server is reachable with a valid TLS certificate, that your
+session or API key is accepted, that OpenVPN is installed and recent enough,
+and that you can download configs. If you're connected, also runs the route
+and DNS checks from 'gatekey verify' on each connection.
+
+Include the output when reporting a problem. Exits non-zero if any check fails.
+
+Examples:
+  gatekey doctor
+  gatekey doctor --json`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := client.LoadConfig(cfgFile)
+			if err != nil {
+				return fmt.Errorf("failed to load config: %w", err)
+			}
+
+			if serverURL != "" {
+				cfg.ServerURL = serverURL
+			}
+
+			vpn := client.NewVPNManager(cfg)
+			return vpn.Doctor(cmd.Context(), jsonOutput)
+		},
+	}
+
+	cmd.Flags().BoolVar(&jsonOutput, "json", false, "Output in JSON format")
+
+	return cmd
+}
+
 func listCmd() *cobra.Command {
-	return &cobra.Command{
+	var jsonOutput bool
+
+	cmd := &cobra.Command{
 		Use:   "list",
 		Short: "List available gateways",
+		Long: `List the gateways you have access to.
+
+Use --json for machine-readable output in scripts. Each entry has id, name,
+hostname, public_ip, vpn_port, vpn_protocol, status ("online" or "offline"),
+last_heartbeat, and connected.
+
+Examples:
+  gatekey list
+  gatekey list --json | jq -r '.gateways[] | select(.status == "online") | .name'`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			cfg, err := client.LoadConfig(cfgFile)
 			if err != nil {
@@ -251,9 +358,54 @@ func listCmd() *cobra.Command {
 			}
 
 			vpn := client.NewVPNManager(cfg)
-			return vpn.ListGateways(cmd.Context())
+			return vpn.ListGateways(cmd.Context(), jsonOutput)
 		},
 	}
+
+	cmd.Flags().BoolVar(&jsonOutput, "json", false, "Output in JSON format")
+
+	return cmd
+}
+
+func reachableCmd() *cobra.Command {
+	var jsonOutput bool
+
+	cmd := &cobra.Command{
+		Use:   "reachable [gateway]",
+		Short: "Show what you can reach through a gateway",
+		Long: `Show the networks and hosts you can reach through a gateway, computed by
+the server from your access rules and the gateway's networks. Run it before
+connecting to check you'll be able to reach what you need.
+
+The gateway is selected the same way as for 'gatekey connect'.
+
+Examples:
+  gatekey reachable office
+  gatekey reachable office --json`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := client.LoadConfig(cfgFile)
+			if err != nil {
+				return fmt.Errorf("failed to load config: %w", err)
+			}
+
+			if serverURL != "" {
+				cfg.ServerURL = serverURL
+			}
+
+			var gateway string
+			if len(args) > 0 {
+				gateway = args[0]
+			}
+
+			vpn := client.NewVPNManager(cfg)
+			return vpn.ShowReachable(cmd.Context(), gateway, jsonOutput)
+		},
+	}
+
+	cmd.Flags().BoolVar(&jsonOutput, "json", false, "Output in JSON format")
+
+	return cmd
 }
 
 func configCmd() *cobra.Command {
@@ -352,7 +504,9 @@ Use 'gatekey connect --mesh <hub>' to connect (recommended).`,
 }
 
 func meshListCmd() *cobra.Command {
-	return &cobra.Command{
+	var jsonOutput bool
+
+	cmd := &cobra.Command{
 		Use:   "list",
 		Short: "List available mesh hubs",
 		RunE: func(cmd *cobra.Command, args []string) error {
@@ -366,9 +520,13 @@ func meshListCmd() *cobra.Command {
 			}
 
 			vpn := client.NewVPNManager(cfg)
-			return vpn.ListMeshHubs(cmd.Context())
+			return vpn.ListMeshHubs(cmd.Context(), jsonOutput)
 		},
 	}
+
+	cmd.Flags().BoolVar(&jsonOutput, "json", false, "Output in JSON format")
+
+	return cmd
 }
 
 func meshConnectCmd() *cobra.Command {
@@ -376,7 +534,8 @@ func meshConnectCmd() *cobra.Command {
 		Use:   "connect [hub]",
 		Short: "Connect to a mesh hub",
 		Long: `Connects to a mesh VPN hub. If no hub is specified and only one
-is available, it connects to that one. Otherwise, prompts for selection.
+is available, it connects to that one. Otherwise, it lists the available hubs
+and exits non-zero.
 
 This command:
 1. Checks your authentication status
@@ -3,6 +3,7 @@ package adminclient
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
@@ -10,8 +11,9 @@ import (
 	"os"
 	"os/exec"
 	"runtime"
-	"strings"
 	"time"
+
+	"github.com/gatekey-project/gatekey/internal/apiclient"
 )
 
 // AuthManager handles authentication for the admin client.
@@ -41,47 +43,17 @@ func (a *AuthManager) LoginAPIKey(ctx context.Context, apiKey string) error {
 	}
 
 	// Validate the API key by calling the server
-	validateURL, err := url.Parse(a.config.ServerURL)
+	api, err := apiclient.New(a.config.ServerURL, apiclient.APIKey(apiKey))
 	if err != nil {
-		return fmt.Errorf("invalid server URL: %w", err)
+		return err
 	}
-	validateURL.Path = "/api/v1/auth/api-key/validate"
-
-	client := &http.Client{Timeout: 30 * time.Second}
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, validateURL.String(), nil)
-	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+	result, err := api.ValidateAPIKey(ctx)
+	if errors.Is(err, apiclient.ErrUnauthorized) {
+		return fmt.Errorf("invalid API key")
 	}
-	req.Header.Set("Authorization", "Bearer "+apiKey)
-
-	resp, err := client.Do(req)
 	if err != nil {
 		return fmt.Errorf("failed to validate API key: %w", err)
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode == http.StatusUnauthorized {
-		return fmt.Errorf("invalid API key")
-	}
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("API key validation failed with status %d", resp.StatusCode)
-	}
-
-	// Parse the response to get user info
-	var result struct {
-		IsAdmin bool `json:"is_admin"`
-		User    struct {
-			Email string `json:"email"`
-			Name  string `json:"name"`
-		} `json:"user"`
-		APIKey struct {
-			Name   string   `json:"name"`
-			Scopes []string `json:"scopes"`
-		} `json:"api_key"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return fmt.Errorf("failed to decode response: %w", err)
-	}
 
 	if !result.IsAdmin {
 		return fmt.Errorf("API key does not belong to an admin user")
@@ -224,7 +196,16 @@ func (a *AuthManager) handleCallback(w http.ResponseWriter, r *http.Request, tok
 			errChan <- fmt.Errorf("failed to decode token: %w", err)
 			return
 		}
+	} else if code := r.URL.Query().Get("code"); code != "" {
+		exchanged, err := a.exchangeCode(r.Context(), code)
+		if err != nil {
+			a.writeCallbackPage(w, false, "Could not complete login with the server")
+			errChan <- err
+			return
+		}
+		token = *exchanged
 	} else {
+		// Servers without exchange codes send the token itself
 		token.AccessToken = r.URL.Query().Get("token")
 		token.RefreshToken = r.URL.Query().Get("refresh_token")
 		token.UserEmail = r.URL.Query().Get("email")
@@ -248,6 +229,26 @@ func (a *AuthManager) handleCallback(w http.ResponseWriter, r *http.Request, tok
 	tokenChan <- &token
 }
 
+// exchangeCode trades the single-use code from the login redirect for the
+// session token, which the server only returns in a response body.
+func (a *AuthManager) exchangeCode(ctx context.Context, code string) (*TokenData, error) {
+	api, err := apiclient.New(a.config.ServerURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	result, err := api.ExchangeCLICode(ctx, code)
+	if err != nil {
+		return nil, fmt.Errorf("failed to exchange login code: %w", err)
+	}
+	return &TokenData{
+		AccessToken: result.Token,
+		UserEmail:   result.Email,
+		UserName:    result.Name,
+		IsAdmin:     result.IsAdmin,
+		ExpiresAt:   time.Now().Add(time.Duration(result.ExpiresIn) * time.Second),
+	}, nil
+}
+
 // writeCallbackPage writes an HTML response for the callback.
 func (a *AuthManager) writeCallbackPage(w http.ResponseWriter, success bool, errMsg string) {
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
@@ -423,35 +424,20 @@ func (a *AuthManager) RefreshToken(ctx context.Context) error {
 		return fmt.Errorf("no refresh token available")
 	}
 
-	// Build refresh URL
-	refreshURL, err := url.Parse(a.config.ServerURL)
+	api, err := apiclient.New(a.config.ServerURL, nil)
 	if err != nil {
-		return fmt.Errorf("invalid server URL: %w", err)
-	}
-	refreshURL.Path = "/api/v1/auth/refresh"
-
-	// Make refresh request
-	client := &http.Client{Timeout: 30 * time.Second}
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, refreshURL.String(),
-		strings.NewReader(fmt.Sprintf(`{"refresh_token":"%s"}`, token.RefreshToken)))
-	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		return err
 	}
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := client.Do(req)
+	refreshed, err := api.RefreshToken(ctx, token.RefreshToken)
 	if err != nil {
-		return fmt.Errorf("refresh request failed: %w", err)
+		return fmt.Errorf("refresh failed: %w", err)
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("refresh failed with status %d", resp.StatusCode)
-	}
-
-	var newToken TokenData
-	if err := json.NewDecoder(resp.Body).Decode(&newToken); err != nil {
-		return fmt.Errorf("failed to decode response: %w", err)
+	newToken := TokenData{
+		AccessToken:  refreshed.AccessToken,
+		RefreshToken: refreshed.RefreshToken,
+		ExpiresAt:    refreshed.ExpiresAt,
+		UserEmail:    refreshed.UserEmail,
+		UserName:     refreshed.UserName,
 	}
 
 	// Preserve user info if not in response
@@ -493,3 +479,13 @@ func openBrowser(url string) error {
 
 	return cmd.Start()
 }
+
+// Apply authenticates an API request as the logged-in admin.
+func (a *AuthManager) Apply(req *http.Request) error {
+	header, err := a.GetAuthHeader()
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", header)
+	return nil
+}
@@ -1,32 +1,32 @@
 package adminclient
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
 	"net/url"
 	"time"
+
+	"github.com/gatekey-project/gatekey/internal/apiclient"
 )
 
-// Client provides admin API access.
+// Client provides admin API access. Requests go through an apiclient.Client,
+// which handles authentication, retries and error responses.
 type Client struct {
-	config     *Config
-	auth       *AuthManager
-	httpClient *http.Client
-	baseURL    string
+	config *Config
+	auth   *AuthManager
+	api    *apiclient.Client
+	apiErr error // Set if config.ServerURL is invalid; returned by every request
 }
 
 // NewClient creates a new admin API client.
 func NewClient(config *Config) *Client {
-	return &Client{
-		config:     config,
-		auth:       NewAuthManager(config),
-		httpClient: &http.Client{Timeout: 30 * time.Second},
-		baseURL:    config.ServerURL,
+	c := &Client{
+		config: config,
+		auth:   NewAuthManager(config),
 	}
+	c.api, c.apiErr = apiclient.New(config.ServerURL, c.auth)
+	return c
 }
 
 // Auth returns the authentication manager.
@@ -34,81 +34,12 @@ func (c *Client) Auth() *AuthManager {
 	return c.auth
 }
 
-// request makes an authenticated HTTP request.
-func (c *Client) request(ctx context.Context, method, path string, body interface{}) (*http.Response, error) {
-	fullURL, err := url.Parse(c.baseURL)
-	if err != nil {
-		return nil, fmt.Errorf("invalid base URL: %w", err)
-	}
-	fullURL.Path = path
-
-	var bodyReader io.Reader
-	if body != nil {
-		jsonBody, err := json.Marshal(body)
-		if err != nil {
-			return nil, fmt.Errorf("failed to marshal body: %w", err)
-		}
-		bodyReader = bytes.NewReader(jsonBody)
-	}
-
-	req, err := http.NewRequestWithContext(ctx, method, fullURL.String(), bodyReader)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
-
-	authHeader, err := c.auth.GetAuthHeader()
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Set("Authorization", authHeader)
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Accept", "application/json")
-
-	return c.httpClient.Do(req)
-}
-
-// doJSON makes a request and decodes JSON response.
+// doJSON makes a request and decodes the JSON response into result, if not nil.
 func (c *Client) doJSON(ctx context.Context, method, path string, body interface{}, result interface{}) error {
-	resp, err := c.request(ctx, method, path, body)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode >= 400 {
-		return c.handleError(resp)
-	}
-
-	if result != nil {
-		if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
-			return fmt.Errorf("failed to decode response: %w", err)
-		}
+	if c.apiErr != nil {
+		return c.apiErr
 	}
-
-	return nil
-}
-
-// handleError extracts error message from response.
-func (c *Client) handleError(resp *http.Response) error {
-	var errBody struct {
-		Error   string `json:"error"`
-		Message string `json:"message"`
-	}
-	body, _ := io.ReadAll(resp.Body)
-	json.Unmarshal(body, &errBody)
-
-	msg := errBody.Error
-	if msg == "" {
-		msg = errBody.Message
-	}
-	if msg == "" {
-		msg = string(body)
-	}
-	if msg == "" {
-		msg = resp.Status
-	}
-
-	return fmt.Errorf("API error (%d): %s", resp.StatusCode, msg)
+	return c.api.Do(ctx, method, path, body, result)
 }
 
 // === Gateway Operations ===
@@ -585,14 +516,17 @@ func (c *Client) RevokeCA(ctx context.Context, id string) error {
 
 type AuditLog struct {
 	ID         string                 `json:"id"`
-	Action     string                 `json:"action"`
-	Resource   string                 `json:"resource"`
+	Seq        int64                  `json:"seq"`
+	Action     string                 `json:"event"`
+	Resource   string                 `json:"resource_type"`
 	ResourceID string                 `json:"resource_id,omitempty"`
-	UserID     string                 `json:"user_id,omitempty"`
-	UserEmail  string                 `json:"user_email,omitempty"`
-	IPAddress  string                 `json:"ip_address,omitempty"`
+	UserID     string                 `json:"actor_id,omitempty"`
+	UserEmail  string                 `json:"actor_email,omitempty"`
+	IPAddress  string                 `json:"actor_ip,omitempty"`
 	Details    map[string]interface{} `json:"details,omitempty"`
-	CreatedAt  time.Time              `json:"created_at"`
+	Success    bool                   `json:"success"`
+	CreatedAt  time.Time              `json:"timestamp"`
+	Hash       string                 `json:"hash,omitempty"`
 }
 
 func (c *Client) ListAuditLogs(ctx context.Context, limit int) ([]AuditLog, error) {
@@ -607,6 +541,50 @@ func (c *Client) ListAuditLogs(ctx context.Context, limit int) ([]AuditLog, erro
 	return result.Logs, err
 }
 
+// AuditChainReport is the result of verifying the audit log hash chain.
+type AuditChainReport struct {
+	Valid     bool   `json:"valid"`
+	Checked   int    `json:"checked"`
+	Unchained int    `json:"unchained"`
+	FirstSeq  int64  `json:"first_seq"`
+	LastSeq   int64  `json:"last_seq"`
+	HeadHash  string `json:"head_hash"`
+	BrokenAt  int64  `json:"broken_at"`
+	Reason    string `json:"reason"`
+}
+
+// AuditAnchor is a CA-signed checkpoint of the audit chain and its check result.
+type AuditAnchor struct {
+	Seq       int64     `json:"seq"`
+	Hash      string    `json:"hash"`
+	CreatedAt time.Time `json:"created_at"`
+	Status    string    `json:"status"`
+}
+
+// VerifyAuditChain verifies the audit log hash chain. since and until are optional
+// RFC3339 timestamps limiting the range.
+func (c *Client) VerifyAuditChain(ctx context.Context, since, until string) (*AuditChainReport, []AuditAnchor, error) {
+	query := url.Values{}
+	if since != "" {
+		query.Set("start", since)
+	}
+	if until != "" {
+		query.Set("end", until)
+	}
+	path := "/api/v1/admin/audit/verify"
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	var result struct {
+		Report  AuditChainReport `json:"report"`
+		Anchors []AuditAnchor    `json:"anchors"`
+	}
+	if err := c.doJSON(ctx, http.MethodGet, path, nil, &result); err != nil {
+		return nil, nil, err
+	}
+	return &result.Report, result.Anchors, nil
+}
+
 // === Connection Operations ===
 
 type Connection struct {
@@ -775,7 +753,7 @@ func (c *Client) ListRemoteSessionAgents(ctx context.Context) ([]RemoteSessionAg
 
 // GetWebSocketURL returns the WebSocket URL for remote sessions
 func (c *Client) GetWebSocketURL() (string, error) {
-	u, err := url.Parse(c.baseURL)
+	u, err := url.Parse(c.config.ServerURL)
 	if err != nil {
 		return "", fmt.Errorf("invalid base URL: %w", err)
 	}
@@ -0,0 +1,137 @@
+// Package agenttest provides a fake control plane for testing the gateway, hub and
+// mesh gateway agents' control loops without a database or a running server.
+package agenttest
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Response is a canned control plane response.
+type Response struct {
+	Status int    // Defaults to 200
+	Body   string // Sent as-is, so tests can return malformed JSON
+	Header http.Header
+	// Delay holds the response back, to exercise agent timeouts. It ends early
+	// if the agent gives up on the request.
+	Delay time.Duration
+}
+
+// JSON returns a 200 response with v encoded as the body.
+func JSON(v any) Response {
+	body, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return Response{Body: string(body)}
+}
+
+// Request is a request received by the fake control plane.
+type Request struct {
+	Method string
+	Path   string
+	Header http.Header
+	Body   []byte
+}
+
+// Decode unmarshals the request body into v.
+func (r Request) Decode(v any) error {
+	return json.Unmarshal(r.Body, v)
+}
+
+// ControlPlane is a fake control plane. Each path serves its responses in order
+// and keeps repeating the last one; unknown paths get a 404.
+type ControlPlane struct {
+	URL string
+
+	server    *httptest.Server
+	mu        sync.Mutex
+	responses map[string][]Response
+	requests  []Request
+}
+
+// NewControlPlane starts a fake control plane that is shut down when the test ends.
+func NewControlPlane(t testing.TB) *ControlPlane {
+	cp := &ControlPlane{responses: make(map[string][]Response)}
+	cp.server = httptest.NewServer(http.HandlerFunc(cp.serve))
+	cp.URL = cp.server.URL
+	t.Cleanup(cp.server.Close)
+	return cp
+}
+
+// Handle sets the responses for a path, replacing any set before.
+func (cp *ControlPlane) Handle(path string, responses ...Response) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	cp.responses[path] = responses
+}
+
+// Requests returns the requests received for a path, oldest first.
+func (cp *ControlPlane) Requests(path string) []Request {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+
+	var requests []Request
+	for _, r := range cp.requests {
+		if r.Path == path {
+			requests = append(requests, r)
+		}
+	}
+	return requests
+}
+
+// Calls returns how many requests were received for a path.
+func (cp *ControlPlane) Calls(path string) int {
+	return len(cp.Requests(path))
+}
+
+func (cp *ControlPlane) serve(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	cp.mu.Lock()
+	cp.requests = append(cp.requests, Request{Method: r.Method, Path: r.URL.Path, Header: r.Header.Clone(), Body: body})
+	queue, ok := cp.responses[r.URL.Path]
+	var resp Response
+	if ok && len(queue) > 0 {
+		resp = queue[0]
+		if len(queue) > 1 {
+			cp.responses[r.URL.Path] = queue[1:]
+		}
+	}
+	cp.mu.Unlock()
+
+	if !ok || len(queue) == 0 {
+		http.Error(w, `{"error":"not found"}`, http.StatusNotFound)
+		return
+	}
+
+	if resp.Delay > 0 {
+		timer := time.NewTimer(resp.Delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	for key, values := range resp.Header {
+		for _, v := range values {
+			w.Header().Add(key, v)
+		}
+	}
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	status := resp.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	w.WriteHeader(status)
+	_, _ = io.WriteString(w, resp.Body)
+}
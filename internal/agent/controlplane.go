@@ -0,0 +1,231 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Gateway, hub and mesh gateway agents report to and fetch config from the
+// control plane on a timer. ControlPlaneClient gives those calls a timeout,
+// retries idempotent ones with jittered backoff, and stops calling for a while
+// once the control plane has failed several times in a row, so a restarting or
+// overloaded control plane isn't hammered by every agent at once.
+
+const (
+	// DefaultControlPlaneTimeout bounds a single request to the control plane.
+	DefaultControlPlaneTimeout = 15 * time.Second
+
+	controlPlaneAttempts = 3
+	retryBaseDelay       = 500 * time.Millisecond
+	retryMaxDelay        = 5 * time.Second
+
+	// The circuit opens after breakerThreshold consecutive failures and stays
+	// open for breakerCooldown, doubling each time a trial request fails, up to
+	// breakerMaxCooldown.
+	breakerThreshold   = 5
+	breakerCooldown    = 30 * time.Second
+	breakerMaxCooldown = 5 * time.Minute
+)
+
+// ErrCircuitOpen is returned without contacting the control plane while it's
+// considered down.
+var ErrCircuitOpen = errors.New("control plane unavailable, backing off")
+
+// ControlPlaneClient makes agent requests to the control plane.
+type ControlPlaneClient struct {
+	httpClient *http.Client
+	breaker    *circuitBreaker
+	// sleep waits between retries; tests replace it.
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+// NewControlPlaneClient creates a control plane client. A zero timeout uses
+// DefaultControlPlaneTimeout.
+func NewControlPlaneClient(timeout time.Duration) *ControlPlaneClient {
+	if timeout <= 0 {
+		timeout = DefaultControlPlaneTimeout
+	}
+	return &ControlPlaneClient{
+		httpClient: &http.Client{Timeout: timeout, Transport: ControlPlaneTransport},
+		breaker:    newCircuitBreaker(),
+		sleep:      sleepContext,
+	}
+}
+
+// SetTimeout sets how long a single request may take.
+func (c *ControlPlaneClient) SetTimeout(timeout time.Duration) {
+	if timeout > 0 {
+		c.httpClient.Timeout = timeout
+	}
+}
+
+// Get fetches a URL, retrying on failure.
+func (c *ControlPlaneClient) Get(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.do(req, true)
+}
+
+// Post sends a JSON body once. Use it for calls that change state on the control
+// plane, where a retry could apply the change twice.
+func (c *ControlPlaneClient) Post(ctx context.Context, url string, body []byte) (*http.Response, error) {
+	return c.post(ctx, url, body, false)
+}
+
+// PostIdempotent sends a JSON body, retrying on failure. Use it for heartbeats
+// and lookups that are safe to repeat.
+func (c *ControlPlaneClient) PostIdempotent(ctx context.Context, url string, body []byte) (*http.Response, error) {
+	return c.post(ctx, url, body, true)
+}
+
+func (c *ControlPlaneClient) post(ctx context.Context, url string, body []byte, retry bool) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return c.do(req, retry)
+}
+
+// Do sends a request. GET and HEAD requests are retried on failure.
+func (c *ControlPlaneClient) Do(req *http.Request) (*http.Response, error) {
+	return c.do(req, req.Method == http.MethodGet || req.Method == http.MethodHead)
+}
+
+func (c *ControlPlaneClient) do(req *http.Request, retry bool) (*http.Response, error) {
+	attempts := 1
+	if retry {
+		attempts = controlPlaneAttempts
+	}
+
+	var lastErr error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			if err := c.sleep(req.Context(), backoff(attempt)); err != nil {
+				return nil, lastErr
+			}
+			if req.GetBody != nil {
+				body, err := req.GetBody()
+				if err != nil {
+					return nil, err
+				}
+				req.Body = body
+			}
+		}
+
+		if err := c.breaker.allow(time.Now()); err != nil {
+			if lastErr != nil {
+				return nil, lastErr
+			}
+			return nil, err
+		}
+
+		resp, err := c.httpClient.Do(req)
+		if err == nil && !retryableStatus(resp.StatusCode) {
+			c.breaker.record(true, time.Now())
+			return resp, nil
+		}
+		c.breaker.record(false, time.Now())
+
+		if err != nil {
+			lastErr = err
+			if req.Context().Err() != nil {
+				return nil, err
+			}
+			continue
+		}
+		if attempt == attempts-1 {
+			return resp, nil
+		}
+		lastErr = fmt.Errorf("control plane returned %d", resp.StatusCode)
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+	return nil, lastErr
+}
+
+// retryableStatus reports whether a response means the control plane is failing
+// or overloaded, rather than rejecting the request.
+func retryableStatus(code int) bool {
+	return code >= 500 || code == http.StatusTooManyRequests
+}
+
+// backoff returns a random delay before a retry, with full jitter over an
+// exponentially growing window so agents don't retry in lockstep.
+func backoff(attempt int) time.Duration {
+	window := min(retryBaseDelay<<(attempt-1), retryMaxDelay)
+	return time.Duration(rand.Int64N(int64(window))) + time.Millisecond
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// circuitBreaker tracks consecutive control plane failures. Once open it rejects
+// requests until its cooldown passes, then lets a single trial request through:
+// success closes it, failure reopens it for longer.
+type circuitBreaker struct {
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	cooldown  time.Duration
+	trial     bool
+}
+
+func newCircuitBreaker() *circuitBreaker {
+	return &circuitBreaker{cooldown: breakerCooldown}
+}
+
+// allow returns ErrCircuitOpen if a request shouldn't be sent now.
+func (b *circuitBreaker) allow(now time.Time) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures < breakerThreshold {
+		return nil
+	}
+	if now.Before(b.openUntil) || b.trial {
+		return ErrCircuitOpen
+	}
+	b.trial = true
+	return nil
+}
+
+// record notes the outcome of a request.
+func (b *circuitBreaker) record(ok bool, now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if ok {
+		b.failures = 0
+		b.trial = false
+		b.cooldown = breakerCooldown
+		return
+	}
+
+	b.failures++
+	if b.failures < breakerThreshold {
+		return
+	}
+	if b.trial {
+		b.cooldown = min(b.cooldown*2, breakerMaxCooldown)
+		b.trial = false
+	}
+	b.openUntil = now.Add(b.cooldown)
+}
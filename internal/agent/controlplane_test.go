@@ -0,0 +1,95 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestClient() *ControlPlaneClient {
+	c := NewControlPlaneClient(time.Second)
+	c.sleep = func(context.Context, time.Duration) error { return nil }
+	return c
+}
+
+func TestControlPlaneClientRetriesIdempotentCalls(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	resp, err := newTestClient().PostIdempotent(context.Background(), srv.URL, []byte(`{}`))
+	if err != nil {
+		t.Fatalf("PostIdempotent: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || calls.Load() != 3 {
+		t.Errorf("got status %d after %d calls, want 200 after 3", resp.StatusCode, calls.Load())
+	}
+}
+
+func TestControlPlaneClientDoesNotRetryPost(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	resp, err := newTestClient().Post(context.Background(), srv.URL, []byte(`{}`))
+	if err != nil {
+		t.Fatalf("Post: %v", err)
+	}
+	resp.Body.Close()
+	if calls.Load() != 1 {
+		t.Errorf("got %d calls, want 1", calls.Load())
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	b := newCircuitBreaker()
+	now := time.Now()
+
+	for i := 0; i < breakerThreshold; i++ {
+		if err := b.allow(now); err != nil {
+			t.Fatalf("request %d rejected before threshold: %v", i, err)
+		}
+		b.record(false, now)
+	}
+	if err := b.allow(now); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("allow after %d failures = %v, want ErrCircuitOpen", breakerThreshold, err)
+	}
+
+	// After the cooldown a single trial goes through
+	now = now.Add(breakerCooldown)
+	if err := b.allow(now); err != nil {
+		t.Fatalf("trial rejected after cooldown: %v", err)
+	}
+	if err := b.allow(now); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatal("second request allowed while trial in flight")
+	}
+
+	// A failed trial reopens the circuit for longer
+	b.record(false, now)
+	if err := b.allow(now.Add(breakerCooldown)); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatal("circuit closed too soon after failed trial")
+	}
+	now = now.Add(2 * breakerCooldown)
+	if err := b.allow(now); err != nil {
+		t.Fatalf("trial rejected after doubled cooldown: %v", err)
+	}
+
+	b.record(true, now)
+	if err := b.allow(now); err != nil {
+		t.Fatalf("circuit still open after successful trial: %v", err)
+	}
+}
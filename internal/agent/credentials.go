@@ -0,0 +1,33 @@
+package agent
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// LoadCredentials binds each credential key, and its "<key>_file" option, to
+// the environment so they can come from it alone, then reads each credential
+// from its file when one is set. Tokens can then be mounted as Kubernetes or
+// Docker secrets instead of stored in the config file. A file takes precedence
+// over an inline value. Call it after setting the environment prefix.
+func LoadCredentials(v *viper.Viper, keys ...string) error {
+	for _, key := range keys {
+		_ = v.BindEnv(key)
+		_ = v.BindEnv(key + "_file")
+	}
+	for _, key := range keys {
+		path := v.GetString(key + "_file")
+		if path == "" {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read %s_file: %w", key, err)
+		}
+		v.Set(key, strings.TrimSpace(string(data)))
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package agent
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestLoadCredentials(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("from-file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GATEKEY_TEST_TOKEN_FILE", tokenFile)
+	t.Setenv("GATEKEY_TEST_CONTROL_PLANE_URL", "https://cp.example.com")
+
+	v := viper.New()
+	v.SetEnvPrefix("GATEKEY_TEST")
+	v.Set("token", "inline")
+	if err := LoadCredentials(v, "token", "control_plane_url"); err != nil {
+		t.Fatal(err)
+	}
+	if got := v.GetString("token"); got != "from-file" {
+		t.Errorf("token = %q, want the file's contents over the inline value", got)
+	}
+	if got := v.GetString("control_plane_url"); got != "https://cp.example.com" {
+		t.Errorf("control_plane_url = %q, want it from the environment", got)
+	}
+
+	v = viper.New()
+	v.Set("token_file", filepath.Join(t.TempDir(), "missing"))
+	if err := LoadCredentials(v, "token"); err == nil || !strings.Contains(err.Error(), "token_file") {
+		t.Errorf("missing file: error = %v, want one naming token_file", err)
+	}
+}
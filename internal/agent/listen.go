@@ -0,0 +1,40 @@
+package agent
+
+import (
+	"fmt"
+	"net"
+)
+
+// DefaultListenAddress is where agents bind their internal HTTP services (the
+// agent API and metrics) unless configured otherwise.
+const DefaultListenAddress = "127.0.0.1"
+
+// BindAddr resolves the address an internal service listens on. A service
+// address without a host, such as ":9102", binds to listenAddress. Binding
+// anywhere but loopback fails unless public is set, so agent introspection and
+// control endpoints aren't exposed by accident on an internet-facing node. An
+// empty addr leaves the service disabled and returns "".
+func BindAddr(addr, listenAddress string, public bool) (string, error) {
+	if addr == "" {
+		return "", nil
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", fmt.Errorf("invalid listen address %q: %w", addr, err)
+	}
+	if host == "" {
+		host = listenAddress
+	}
+	if !public && !isLoopback(host) {
+		return "", fmt.Errorf("listen address %q is not loopback; set listen_public: true to serve it on other interfaces", net.JoinHostPort(host, port))
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,29 @@
+package agent
+
+import "testing"
+
+func TestBindAddr(t *testing.T) {
+	tests := []struct {
+		addr, listenAddress string
+		public              bool
+		want                string
+		wantErr             bool
+	}{
+		{":9102", DefaultListenAddress, false, "127.0.0.1:9102", false},
+		{":9443", "::1", false, "[::1]:9443", false},
+		{"localhost:9102", "", false, "localhost:9102", false},
+		{"", DefaultListenAddress, false, "", false},
+		{":9102", "0.0.0.0", false, "", true},
+		{":9102", "", false, "", true},
+		{"10.0.0.5:9102", DefaultListenAddress, false, "", true},
+		{":9102", "0.0.0.0", true, "0.0.0.0:9102", false},
+		{"9102", DefaultListenAddress, false, "", true},
+	}
+	for _, tt := range tests {
+		got, err := BindAddr(tt.addr, tt.listenAddress, tt.public)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("BindAddr(%q, %q, %v) = %q, %v; want %q, error %v",
+				tt.addr, tt.listenAddress, tt.public, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
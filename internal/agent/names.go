@@ -0,0 +1,38 @@
+package agent
+
+import (
+	"regexp"
+	"strings"
+)
+
+// nodeNameRegex matches names that are safe for hubs, spokes and gateways to use
+// in file names, certificate common names and command arguments.
+var nodeNameRegex = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._@-]{0,62}$`)
+
+// ValidNodeName reports whether name is made up only of letters, digits, '.',
+// '_', '@' and '-', starts with a letter or digit, and is at most 63 characters.
+func ValidNodeName(name string) bool {
+	return nodeNameRegex.MatchString(name) && !strings.Contains(name, "..")
+}
+
+// CCDFileName returns the client-config-dir file name OpenVPN looks up for a
+// certificate common name. OpenVPN replaces every byte other than letters,
+// digits, '.', '_', '@' and '-' with '_' before the lookup, so doing the same
+// both matches it and keeps a name from control plane data from escaping the
+// directory.
+func CCDFileName(commonName string) string {
+	b := []byte(commonName)
+	for i, c := range b {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '.', c == '_', c == '@', c == '-':
+		default:
+			b[i] = '_'
+		}
+	}
+	name := string(b)
+	if name == "" || strings.Trim(name, ".") == "" {
+		return "_"
+	}
+	return name
+}
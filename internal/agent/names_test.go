@@ -0,0 +1,33 @@
+package agent
+
+import "testing"
+
+func TestValidNodeName(t *testing.T) {
+	valid := []string{"spoke1", "branch-office.eu", "site_a", "a"}
+	invalid := []string{"", "../etc", "a/b", "spoke one", "-spoke", "a..b", "name\nroute", "a;rm"}
+	for _, name := range valid {
+		if !ValidNodeName(name) {
+			t.Errorf("ValidNodeName(%q) = false, want true", name)
+		}
+	}
+	for _, name := range invalid {
+		if ValidNodeName(name) {
+			t.Errorf("ValidNodeName(%q) = true, want false", name)
+		}
+	}
+}
+
+func TestCCDFileName(t *testing.T) {
+	tests := map[string]string{
+		"mesh-gateway-spoke1":    "mesh-gateway-spoke1",
+		"mesh-gateway-../../etc": "mesh-gateway-.._.._etc",
+		"mesh-gateway-my spoke":  "mesh-gateway-my_spoke",
+		"..":                     "_",
+		"":                       "_",
+	}
+	for in, want := range tests {
+		if got := CCDFileName(in); got != want {
+			t.Errorf("CCDFileName(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package agent
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Agents write the certificates and keys the control plane sends them and
+// restart OpenVPN, so anyone able to impersonate the control plane can take
+// over a gateway. Trusting the system CAs alone leaves that to any CA that can
+// be talked into issuing a certificate for the control plane's name; pinning
+// the control plane's public keys closes it. Every agent connection to the
+// control plane goes through ControlPlaneTransport or ControlPlaneTLSConfig.
+
+// ErrControlPlaneNotPinned is returned by TLS handshakes with a control plane
+// whose certificate chain contains none of the pinned keys.
+var ErrControlPlaneNotPinned = errors.New("control plane certificate does not match any pinned key")
+
+var (
+	pinsMu sync.RWMutex
+	pins   map[[sha256.Size]byte]bool
+)
+
+// PinControlPlane restricts control plane connections to servers whose
+// certificate chain contains one of pins: SHA-256 hashes of a certificate's
+// SubjectPublicKeyInfo, base64 encoded with an optional "sha256/" prefix as
+// used by HPKP and curl, or hex encoded. Pinning requires an https control plane
+// URL. No pins turns pinning off.
+func PinControlPlane(controlPlaneURL string, keys []string) error {
+	parsed := make(map[[sha256.Size]byte]bool, len(keys))
+	for _, key := range keys {
+		hash, err := parsePin(key)
+		if err != nil {
+			return err
+		}
+		parsed[hash] = true
+	}
+	if len(parsed) > 0 && !strings.HasPrefix(strings.ToLower(controlPlaneURL), "https://") {
+		return fmt.Errorf("control_plane_pins requires an https control_plane_url")
+	}
+
+	pinsMu.Lock()
+	pins = nil
+	if len(parsed) > 0 {
+		pins = parsed
+	}
+	pinsMu.Unlock()
+
+	// Connections made under the old pins aren't reused
+	if t, ok := ControlPlaneTransport.(*pinnedTransport); ok {
+		t.base.CloseIdleConnections()
+	}
+	return nil
+}
+
+func parsePin(pin string) ([sha256.Size]byte, error) {
+	var hash [sha256.Size]byte
+	s := strings.TrimSpace(pin)
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "sha256/"), "/")
+
+	var raw []byte
+	var err error
+	// Hex may be colon separated, as openssl prints fingerprints
+	if h := strings.ReplaceAll(s, ":", ""); len(h) == hex.EncodedLen(sha256.Size) {
+		raw, err = hex.DecodeString(h)
+	} else {
+		raw, err = base64.StdEncoding.DecodeString(s)
+	}
+	if err != nil || len(raw) != sha256.Size {
+		return hash, fmt.Errorf("invalid control plane pin %q: want a base64 or hex SHA-256 hash", pin)
+	}
+	copy(hash[:], raw)
+	return hash, nil
+}
+
+// pinned reports whether pinning is on.
+func pinned() bool {
+	pinsMu.RLock()
+	defer pinsMu.RUnlock()
+	return pins != nil
+}
+
+// verifyPins checks a verified TLS connection against the pins. The chain has
+// already passed normal verification, so a pin on the CA or an intermediate
+// trusts whatever it issues. Only the verified chains count: a server can send
+// any extra certificates it likes, such as the real control plane's.
+func verifyPins(cs tls.ConnectionState) error {
+	pinsMu.RLock()
+	defer pinsMu.RUnlock()
+	if pins == nil {
+		return nil
+	}
+	for _, chain := range cs.VerifiedChains {
+		for _, cert := range chain {
+			if pins[SPKIHash(cert)] {
+				return nil
+			}
+		}
+	}
+	return ErrControlPlaneNotPinned
+}
+
+// SPKIHash returns the SHA-256 hash of a certificate's public key, the value
+// control plane pins are made of.
+func SPKIHash(cert *x509.Certificate) [sha256.Size]byte {
+	return sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+}
+
+// ControlPlaneTLSConfig returns the TLS config for connections to the control
+// plane that don't go through ControlPlaneTransport, such as websockets.
+func ControlPlaneTLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:       tls.VersionTLS12,
+		VerifyConnection: verifyPins,
+	}
+}
+
+// pinnedTransport refuses plain HTTP while pinning is on, so a redirect can't
+// take a request around the pin check.
+type pinnedTransport struct {
+	base *http.Transport
+}
+
+func (t *pinnedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme != "https" && pinned() {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, fmt.Errorf("refusing %s request to %s: control plane pinning requires https", req.URL.Scheme, req.URL.Host)
+	}
+	return t.base.RoundTrip(req)
+}
+
+// ControlPlaneTransport carries every agent HTTP request to the control plane
+// and checks the control plane's certificate against the pins on each new
+// connection.
+var ControlPlaneTransport http.RoundTripper = newPinnedTransport()
+
+func newPinnedTransport() *pinnedTransport {
+	base := http.DefaultTransport.(*http.Transport).Clone()
+	base.TLSClientConfig = ControlPlaneTLSConfig()
+	return &pinnedTransport{base: base}
+}
@@ -0,0 +1,134 @@
+package agent
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParsePin(t *testing.T) {
+	sum := make([]byte, 32)
+	sum[0], sum[31] = 0xab, 0xcd
+	b64 := base64.StdEncoding.EncodeToString(sum)
+	hexPin := hex.EncodeToString(sum)
+
+	for _, pin := range []string{b64, "sha256/" + b64, "sha256//" + b64, hexPin, "AB:00:" + hexPin[4:]} {
+		if _, err := parsePin(pin); err != nil {
+			t.Errorf("parsePin(%q): %v", pin, err)
+		}
+	}
+	for _, pin := range []string{"", "not-a-pin", base64.StdEncoding.EncodeToString(sum[:20])} {
+		if _, err := parsePin(pin); err == nil {
+			t.Errorf("parsePin(%q) succeeded, want error", pin)
+		}
+	}
+}
+
+func TestControlPlanePinning(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	defer PinControlPlane("", nil)
+
+	// A transport like ControlPlaneTransport that trusts the test server's CA
+	roots := x509.NewCertPool()
+	roots.AddCert(srv.Certificate())
+	base := http.DefaultTransport.(*http.Transport).Clone()
+	base.TLSClientConfig = ControlPlaneTLSConfig()
+	base.TLSClientConfig.RootCAs = roots
+	client := &http.Client{Transport: &pinnedTransport{base: base}}
+
+	get := func() error {
+		base.CloseIdleConnections()
+		resp, err := client.Get(srv.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	if err := get(); err != nil {
+		t.Fatalf("unpinned request: %v", err)
+	}
+
+	hash := SPKIHash(srv.Certificate())
+	if err := PinControlPlane(srv.URL, []string{hex.EncodeToString(hash[:])}); err != nil {
+		t.Fatalf("PinControlPlane: %v", err)
+	}
+	if err := get(); err != nil {
+		t.Errorf("request with matching pin: %v", err)
+	}
+
+	other := make([]byte, 32)
+	if err := PinControlPlane(srv.URL, []string{base64.StdEncoding.EncodeToString(other)}); err != nil {
+		t.Fatalf("PinControlPlane: %v", err)
+	}
+	if err := get(); !errors.Is(err, ErrControlPlaneNotPinned) {
+		t.Errorf("request with mismatched pin: got %v, want %v", err, ErrControlPlaneNotPinned)
+	}
+
+	if _, err := client.Get("http://127.0.0.1:1/"); err == nil {
+		t.Error("plain HTTP request succeeded while pinned")
+	}
+	if err := PinControlPlane("http://control-plane", []string{base64.StdEncoding.EncodeToString(other)}); err == nil {
+		t.Error("PinControlPlane accepted an http URL")
+	}
+}
+
+// A server with any trusted certificate can't pass the pin check by also
+// sending the pinned certificate, since it isn't part of the verified chain.
+func TestControlPlanePinningIgnoresExtraCertificates(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	defer PinControlPlane("", nil)
+
+	// The "real" control plane's certificate, pinned, which the server appends
+	// after its own
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "control-plane"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pinnedCert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.TLS.Certificates[0].Certificate = append(srv.TLS.Certificates[0].Certificate, der)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(srv.Certificate())
+	base := http.DefaultTransport.(*http.Transport).Clone()
+	base.TLSClientConfig = ControlPlaneTLSConfig()
+	base.TLSClientConfig.RootCAs = roots
+	client := &http.Client{Transport: &pinnedTransport{base: base}}
+
+	hash := SPKIHash(pinnedCert)
+	if err := PinControlPlane(srv.URL, []string{hex.EncodeToString(hash[:])}); err != nil {
+		t.Fatalf("PinControlPlane: %v", err)
+	}
+	resp, err := client.Get(srv.URL)
+	if err == nil {
+		resp.Body.Close()
+	}
+	if !errors.Is(err, ErrControlPlaneNotPinned) {
+		t.Errorf("request with pinned certificate outside the chain: got %v, want %v", err, ErrControlPlaneNotPinned)
+	}
+}
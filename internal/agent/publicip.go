@@ -0,0 +1,223 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Agents report their public IP in heartbeats so the control plane knows where
+// clients and hubs can reach them. Most hosts don't know their own public address,
+// since it belongs to a NAT or load balancer in front of them, so it's looked up
+// from the cloud provider's metadata service or, failing that, an external IP
+// echo service.
+
+// Public IP sources, tried in the order configured in public_ip_sources.
+const (
+	PublicIPSourceEnv   = "env"   // The PUBLIC_IP environment variable
+	PublicIPSourceAWS   = "aws"   // EC2 instance metadata (IMDSv2)
+	PublicIPSourceGCP   = "gcp"   // Compute Engine metadata
+	PublicIPSourceAzure = "azure" // Azure instance metadata
+	PublicIPSourceEcho  = "echo"  // An external service that echoes the caller's address
+)
+
+// DefaultPublicIPSources are tried when an agent's config doesn't set
+// public_ip_sources. An empty list turns detection off.
+var DefaultPublicIPSources = []string{
+	PublicIPSourceEnv, PublicIPSourceAWS, PublicIPSourceGCP, PublicIPSourceAzure, PublicIPSourceEcho,
+}
+
+// DefaultPublicIPEchoURL returns the caller's address as plain text.
+const DefaultPublicIPEchoURL = "https://checkip.amazonaws.com"
+
+// DefaultPublicIPRefresh is how often the public IP is looked up again, since it
+// can change on hosts without a static address.
+const DefaultPublicIPRefresh = 15 * time.Minute
+
+// metadataTimeout bounds each metadata lookup; off the cloud the link-local
+// address doesn't answer, and detection shouldn't hold up startup for long.
+const metadataTimeout = 2 * time.Second
+
+// echoTimeout bounds a lookup from the IP echo service.
+const echoTimeout = 5 * time.Second
+
+// metadataBaseURL is the link-local address AWS, GCP and Azure all serve
+// instance metadata on.
+const metadataBaseURL = "http://169.254.169.254"
+
+// ErrNoPublicIP is returned when no source knows the agent's public IP.
+var ErrNoPublicIP = errors.New("no public IP found")
+
+// ValidPublicIPSource reports whether source is a known public IP source.
+func ValidPublicIPSource(source string) bool {
+	switch source {
+	case PublicIPSourceEnv, PublicIPSourceAWS, PublicIPSourceGCP, PublicIPSourceAzure, PublicIPSourceEcho:
+		return true
+	}
+	return false
+}
+
+// PublicIPDetector looks up an agent's public IP from its sources and caches the
+// last address found.
+type PublicIPDetector struct {
+	sources     []string
+	echoURL     string
+	metadataURL string
+	client      *http.Client
+
+	mu sync.RWMutex
+	ip string
+}
+
+// NewPublicIPDetector returns a detector trying sources in order, using echoURL
+// for the echo source. Sources should be checked with ValidPublicIPSource first;
+// unknown ones are skipped.
+func NewPublicIPDetector(sources []string, echoURL string) *PublicIPDetector {
+	if echoURL == "" {
+		echoURL = DefaultPublicIPEchoURL
+	}
+	d := &PublicIPDetector{sources: sources, echoURL: echoURL, metadataURL: metadataBaseURL}
+	d.client = &http.Client{Transport: &http.Transport{
+		// The metadata service is only reachable directly, never through a proxy
+		Proxy: func(r *http.Request) (*url.URL, error) {
+			if strings.HasPrefix(r.URL.String(), d.metadataURL+"/") {
+				return nil, nil
+			}
+			return http.ProxyFromEnvironment(r)
+		},
+	}}
+	return d
+}
+
+// IP returns the last public IP found, or "" if none has been.
+func (d *PublicIPDetector) IP() string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.ip
+}
+
+// Refresh looks the public IP up again and caches it. It returns the address,
+// the source that knew it, and whether it differs from the one cached before. If
+// no source knows it, the cached address is kept and ErrNoPublicIP returned.
+func (d *PublicIPDetector) Refresh(ctx context.Context) (ip, source string, changed bool, err error) {
+	ip, source, err = d.detect(ctx)
+	if err != nil {
+		return d.IP(), "", false, err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	changed = ip != d.ip
+	d.ip = ip
+	return ip, source, changed, nil
+}
+
+// Run refreshes the public IP every interval until ctx is done, calling report
+// when the address changes or can't be found. An interval of 0 returns at once.
+func (d *PublicIPDetector) Run(ctx context.Context, interval time.Duration, report func(ip, source string, err error)) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			ip, source, changed, err := d.Refresh(ctx)
+			if changed || err != nil {
+				report(ip, source, err)
+			}
+		}
+	}
+}
+
+// detect returns the public IP from the first source that knows it.
+func (d *PublicIPDetector) detect(ctx context.Context) (string, string, error) {
+	var errs []error
+	metadataDown := false
+	for _, source := range d.sources {
+		isMetadata := source == PublicIPSourceAWS || source == PublicIPSourceGCP || source == PublicIPSourceAzure
+		if isMetadata && metadataDown {
+			// Off the cloud, don't wait out the timeout once per provider
+			continue
+		}
+		ip, err := d.lookup(ctx, source)
+		var netErr net.Error
+		if isMetadata && errors.As(err, &netErr) {
+			metadataDown = true
+		}
+		if err == nil {
+			if parsed := net.ParseIP(ip); parsed != nil {
+				return parsed.String(), source, nil
+			}
+			err = fmt.Errorf("invalid address %q", ip)
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", source, err))
+	}
+	return "", "", errors.Join(append([]error{ErrNoPublicIP}, errs...)...)
+}
+
+func (d *PublicIPDetector) lookup(ctx context.Context, source string) (string, error) {
+	switch source {
+	case PublicIPSourceEnv:
+		if ip := os.Getenv("PUBLIC_IP"); ip != "" {
+			return ip, nil
+		}
+		return "", errors.New("PUBLIC_IP is not set")
+	case PublicIPSourceAWS:
+		// IMDSv2 needs a session token first
+		token, err := d.fetch(ctx, http.MethodPut, d.metadataURL+"/latest/api/token",
+			map[string]string{"X-aws-ec2-metadata-token-ttl-seconds": "60"}, metadataTimeout)
+		if err != nil {
+			return "", err
+		}
+		return d.fetch(ctx, http.MethodGet, d.metadataURL+"/latest/meta-data/public-ipv4",
+			map[string]string{"X-aws-ec2-metadata-token": token}, metadataTimeout)
+	case PublicIPSourceGCP:
+		return d.fetch(ctx, http.MethodGet,
+			d.metadataURL+"/computeMetadata/v1/instance/network-interfaces/0/access-configs/0/external-ip",
+			map[string]string{"Metadata-Flavor": "Google"}, metadataTimeout)
+	case PublicIPSourceAzure:
+		return d.fetch(ctx, http.MethodGet,
+			d.metadataURL+"/metadata/instance/network/interface/0/ipv4/ipAddress/0/publicIpAddress?api-version=2021-02-01&format=text",
+			map[string]string{"Metadata": "true"}, metadataTimeout)
+	case PublicIPSourceEcho:
+		return d.fetch(ctx, http.MethodGet, d.echoURL, nil, echoTimeout)
+	}
+	return "", errors.New("unknown source")
+}
+
+// fetch returns the trimmed body of a successful response to a small request.
+func (d *PublicIPDetector) fetch(ctx context.Context, method, target string, header map[string]string, timeout time.Duration) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, method, target, nil)
+	if err != nil {
+		return "", err
+	}
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s returned %s", req.URL.Host, resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(body)), nil
+}
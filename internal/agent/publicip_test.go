@@ -0,0 +1,68 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPublicIPDetector(t *testing.T) {
+	// A metadata service that behaves like EC2's IMDSv2 for an instance without a
+	// public IP, and like Azure's for one with
+	metadata := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPut && r.URL.Path == "/latest/api/token":
+			_, _ = w.Write([]byte("token"))
+		case r.URL.Path == "/latest/meta-data/public-ipv4":
+			http.NotFound(w, r)
+		case r.URL.Path == "/metadata/instance/network/interface/0/ipv4/ipAddress/0/publicIpAddress" && r.Header.Get("Metadata") == "true":
+			_, _ = w.Write([]byte("203.0.113.7\n"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer metadata.Close()
+	echo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("198.51.100.1\n"))
+	}))
+	defer echo.Close()
+
+	t.Setenv("PUBLIC_IP", "")
+	d := NewPublicIPDetector([]string{PublicIPSourceEnv, PublicIPSourceAWS, PublicIPSourceAzure, PublicIPSourceEcho}, echo.URL)
+	d.metadataURL = metadata.URL
+
+	ip, source, changed, err := d.Refresh(context.Background())
+	if err != nil || ip != "203.0.113.7" || source != PublicIPSourceAzure || !changed {
+		t.Fatalf("Refresh() = %q, %q, %v, %v; want Azure's address", ip, source, changed, err)
+	}
+
+	// PUBLIC_IP comes first when set
+	t.Setenv("PUBLIC_IP", "192.0.2.10")
+	if ip, source, _, _ := d.Refresh(context.Background()); ip != "192.0.2.10" || source != PublicIPSourceEnv {
+		t.Errorf("Refresh() = %q from %q, want PUBLIC_IP", ip, source)
+	}
+
+	// The echo service is the fallback
+	d = NewPublicIPDetector([]string{PublicIPSourceGCP, PublicIPSourceEcho}, echo.URL)
+	d.metadataURL = metadata.URL
+	if ip, source, _, _ := d.Refresh(context.Background()); ip != "198.51.100.1" || source != PublicIPSourceEcho {
+		t.Errorf("Refresh() = %q from %q, want the echo service's address", ip, source)
+	}
+
+	// A failed lookup keeps the last address
+	echo.Close()
+	ip, _, changed, err = d.Refresh(context.Background())
+	if !errors.Is(err, ErrNoPublicIP) || ip != "198.51.100.1" || changed {
+		t.Errorf("Refresh() after failure = %q, %v, %v; want the cached address and ErrNoPublicIP", ip, changed, err)
+	}
+	if d.IP() != "198.51.100.1" {
+		t.Errorf("IP() = %q after a failed refresh", d.IP())
+	}
+
+	// No sources turns detection off
+	if _, _, _, err := NewPublicIPDetector(nil, "").Refresh(context.Background()); !errors.Is(err, ErrNoPublicIP) {
+		t.Errorf("Refresh() with no sources error = %v", err)
+	}
+}
@@ -0,0 +1,108 @@
+package agent
+
+import (
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// Agents that start together, such as a fleet restarted by the same rollout, would
+// otherwise heartbeat and refresh rules in lockstep for as long as they run. Ticker
+// moves every tick by a random offset so their calls drift apart.
+
+// DefaultJitter is the fraction of an interval ticks are moved by when an agent's
+// config doesn't set interval_jitter.
+const DefaultJitter = 0.1
+
+// maxJitter keeps a jittered interval well above zero.
+const maxJitter = 0.5
+
+// Jitter returns d moved by a random offset of up to fraction of d either way.
+func Jitter(d time.Duration, fraction float64) time.Duration {
+	fraction = min(fraction, maxJitter)
+	spread := int64(float64(d) * fraction)
+	if spread <= 0 {
+		return d
+	}
+	return d + time.Duration(rand.Int64N(2*spread+1)-spread)
+}
+
+// HeartbeatInterval returns the interval an agent should heartbeat at: its
+// configured one, or the minimum the control plane asks for when that is longer.
+// The control plane can slow a fleet down this way, but never speed it up.
+func HeartbeatInterval(configured time.Duration, minimumSeconds int) time.Duration {
+	return max(configured, time.Duration(minimumSeconds)*time.Second)
+}
+
+// Ticker delivers ticks on C at a jittered interval, which can be changed while
+// it runs. Like time.Ticker, it drops ticks for slow receivers.
+type Ticker struct {
+	C <-chan time.Time
+
+	c        chan time.Time
+	stop     chan struct{}
+	stopOnce sync.Once
+
+	mu       sync.Mutex
+	interval time.Duration
+	jitter   float64
+}
+
+// NewTicker starts a ticker that fires every interval, each tick moved by up to
+// jitter (a fraction of the interval) either way.
+func NewTicker(interval time.Duration, jitter float64) *Ticker {
+	c := make(chan time.Time, 1)
+	t := &Ticker{C: c, c: c, stop: make(chan struct{}), interval: interval, jitter: jitter}
+	go t.run()
+	return t
+}
+
+func (t *Ticker) run() {
+	timer := time.NewTimer(t.next())
+	defer timer.Stop()
+	for {
+		select {
+		case <-t.stop:
+			return
+		case now := <-timer.C:
+			select {
+			case t.c <- now:
+			default:
+			}
+			timer.Reset(t.next())
+		}
+	}
+}
+
+func (t *Ticker) next() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return Jitter(t.interval, t.jitter)
+}
+
+// Interval returns the ticker's interval before jitter.
+func (t *Ticker) Interval() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.interval
+}
+
+// SetInterval changes the interval from the tick after next. It reports whether
+// the interval changed.
+func (t *Ticker) SetInterval(d time.Duration) bool {
+	if d <= 0 {
+		return false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if d == t.interval {
+		return false
+	}
+	t.interval = d
+	return true
+}
+
+// Stop turns off the ticker. Like time.Ticker, it doesn't close C.
+func (t *Ticker) Stop() {
+	t.stopOnce.Do(func() { close(t.stop) })
+}
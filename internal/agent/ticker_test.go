@@ -0,0 +1,87 @@
+package agent
+
+import (
+	"testing"
+	"time"
+)
+
+func TestJitter(t *testing.T) {
+	const d = 30 * time.Second
+	seen := make(map[time.Duration]bool)
+	for i := 0; i < 1000; i++ {
+		got := Jitter(d, 0.1)
+		if got < 27*time.Second || got > 33*time.Second {
+			t.Fatalf("Jitter(30s, 0.1) = %v, want within 27s-33s", got)
+		}
+		seen[got] = true
+	}
+	if len(seen) < 10 {
+		t.Errorf("Jitter returned only %d distinct intervals", len(seen))
+	}
+
+	if got := Jitter(d, 0); got != d {
+		t.Errorf("Jitter(30s, 0) = %v, want 30s", got)
+	}
+	for i := 0; i < 1000; i++ {
+		if got := Jitter(d, 5); got < 15*time.Second {
+			t.Fatalf("Jitter(30s, 5) = %v, want at least 15s", got)
+		}
+	}
+}
+
+func TestHeartbeatInterval(t *testing.T) {
+	tests := []struct {
+		configured time.Duration
+		minimum    int
+		want       time.Duration
+	}{
+		{30 * time.Second, 0, 30 * time.Second},
+		{30 * time.Second, 120, 2 * time.Minute},
+		{5 * time.Minute, 120, 5 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := HeartbeatInterval(tt.configured, tt.minimum); got != tt.want {
+			t.Errorf("HeartbeatInterval(%v, %d) = %v, want %v", tt.configured, tt.minimum, got, tt.want)
+		}
+	}
+}
+
+func TestTicker(t *testing.T) {
+	ticker := NewTicker(time.Hour, DefaultJitter)
+	defer ticker.Stop()
+
+	if ticker.SetInterval(time.Hour) {
+		t.Error("SetInterval reported a change for the same interval")
+	}
+	if ticker.SetInterval(0) {
+		t.Error("SetInterval accepted a zero interval")
+	}
+
+	// The hour-long first tick still fires at the old interval, so use a fresh
+	// ticker to see ticks arrive.
+	fast := NewTicker(10*time.Millisecond, DefaultJitter)
+	defer fast.Stop()
+	for i := 0; i < 3; i++ {
+		select {
+		case <-fast.C:
+		case <-time.After(time.Second):
+			t.Fatal("ticker didn't fire")
+		}
+	}
+
+	fast.Stop()
+	time.Sleep(30 * time.Millisecond)
+	select {
+	case <-fast.C:
+	default:
+	}
+	select {
+	case <-fast.C:
+		t.Error("ticker fired after Stop")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if !ticker.SetInterval(time.Minute) || ticker.Interval() != time.Minute {
+		t.Errorf("Interval() = %v after SetInterval(1m)", ticker.Interval())
+	}
+}
@@ -0,0 +1,96 @@
+// Package agentlog builds the zap loggers used by the gateway, hub, and mesh gateway
+// agents, with control over format, sampling, and file output independent of level.
+package agentlog
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Config holds agent logging options.
+type Config struct {
+	Level  string `mapstructure:"log_level"`  // debug, info, warn, error
+	Format string `mapstructure:"log_format"` // json or console; empty picks console for debug, json otherwise
+	File   string `mapstructure:"log_file"`   // Log to this file instead of stderr
+
+	MaxSizeMB  int `mapstructure:"log_max_size_mb"` // Rotate the log file at this size
+	MaxBackups int `mapstructure:"log_max_backups"` // Rotated files to keep
+
+	// Sampling keeps the first SamplingInitial entries with the same message each
+	// second, then every SamplingThereafter-th. SamplingInitial 0 disables it.
+	SamplingInitial    int `mapstructure:"log_sampling_initial"`
+	SamplingThereafter int `mapstructure:"log_sampling_thereafter"`
+}
+
+// Defaults used when options are unset.
+const (
+	DefaultMaxSizeMB          = 100
+	DefaultMaxBackups         = 5
+	DefaultSamplingInitial    = 100
+	DefaultSamplingThereafter = 100
+)
+
+// SetDefaults registers the logging defaults on a viper-style config.
+func SetDefaults(setDefault func(key string, value interface{})) {
+	setDefault("log_level", "info")
+	setDefault("log_format", "")
+	setDefault("log_file", "")
+	setDefault("log_max_size_mb", DefaultMaxSizeMB)
+	setDefault("log_max_backups", DefaultMaxBackups)
+	setDefault("log_sampling_initial", DefaultSamplingInitial)
+	setDefault("log_sampling_thereafter", DefaultSamplingThereafter)
+}
+
+// New builds a logger from cfg.
+func New(cfg Config) (*zap.Logger, error) {
+	var level zapcore.Level
+	if err := level.UnmarshalText([]byte(cfg.Level)); err != nil {
+		level = zapcore.InfoLevel
+	}
+
+	format := cfg.Format
+	if format == "" {
+		format = "json"
+		if level == zapcore.DebugLevel {
+			format = "console"
+		}
+	}
+
+	var encoder zapcore.Encoder
+	switch format {
+	case "json":
+		encoder = zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig())
+	case "console":
+		encoder = zapcore.NewConsoleEncoder(zap.NewDevelopmentEncoderConfig())
+	default:
+		return nil, fmt.Errorf("invalid log_format %q: must be json or console", cfg.Format)
+	}
+
+	var sink zapcore.WriteSyncer = zapcore.Lock(os.Stderr)
+	if cfg.File != "" {
+		maxSize := cfg.MaxSizeMB
+		if maxSize <= 0 {
+			maxSize = DefaultMaxSizeMB
+		}
+		rf, err := newRotatingFile(cfg.File, int64(maxSize)*1024*1024, cfg.MaxBackups)
+		if err != nil {
+			return nil, err
+		}
+		sink = rf
+	}
+
+	core := zapcore.NewCore(encoder, sink, zap.NewAtomicLevelAt(level))
+	if cfg.SamplingInitial > 0 {
+		thereafter := cfg.SamplingThereafter
+		if thereafter <= 0 {
+			thereafter = DefaultSamplingThereafter
+		}
+		core = zapcore.NewSamplerWithOptions(core, time.Second, cfg.SamplingInitial, thereafter)
+	}
+
+	return zap.New(core, zap.AddCaller(), zap.AddStacktrace(zapcore.ErrorLevel)), nil
+}
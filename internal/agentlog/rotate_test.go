@@ -0,0 +1,50 @@
+package agentlog
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agent.log")
+
+	r, err := newRotatingFile(path, 10, 2)
+	if err != nil {
+		t.Fatalf("newRotatingFile: %v", err)
+	}
+
+	for _, line := range []string{"aaaaaaaa\n", "bbbbbbbb\n", "cccccccc\n", "dddddddd\n"} {
+		if _, err := r.Write([]byte(line)); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+	if err := r.Sync(); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+
+	for file, want := range map[string]string{
+		path:        "dddddddd\n",
+		path + ".1": "cccccccc\n",
+		path + ".2": "bbbbbbbb\n",
+	} {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatalf("read %s: %v", file, err)
+		}
+		if string(data) != want {
+			t.Errorf("%s = %q, want %q", file, data, want)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Error("expected only 2 backups to be kept")
+	}
+}
+
+func TestNewRejectsUnknownFormat(t *testing.T) {
+	_, err := New(Config{Level: "info", Format: "xml"})
+	if err == nil || !strings.Contains(err.Error(), "log_format") {
+		t.Errorf("expected log_format error, got %v", err)
+	}
+}
@@ -0,0 +1,164 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/gatekey-project/gatekey/internal/db"
+)
+
+// accessExceptionJSON is an exception in admin API responses.
+func accessExceptionJSON(e *db.AccessException) gin.H {
+	return gin.H{
+		"id":               e.ID,
+		"user_id":          e.UserID,
+		"rule_id":          e.RuleID,
+		"rule_name":        e.RuleName,
+		"destination_type": e.DestinationType,
+		"destination":      e.Destination,
+		"reason":           e.Reason,
+		"created_by":       e.CreatedBy,
+		"created_at":       e.CreatedAt,
+	}
+}
+
+// userGetter looks up a user in the tenant in ctx.
+type userGetter interface {
+	GetSSOUser(ctx context.Context, id string) (*db.SSOUser, error)
+}
+
+// userExceptionStore is the access rule store's per-user exception handling.
+type userExceptionStore interface {
+	ListUserAccessExceptions(ctx context.Context, userID string) ([]*db.AccessException, error)
+	DeleteAccessException(ctx context.Context, userID, id string) error
+}
+
+// requireTenantUser checks the user in the id parameter is in the request's
+// tenant, writing a 404 if not, so tenant admins can't reach other tenants'
+// users by ID.
+func (s *Server) requireTenantUser(c *gin.Context, users userGetter) bool {
+	if _, err := users.GetSSOUser(c.Request.Context(), c.Param("id")); err != nil {
+		if err == db.ErrUserNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+			return false
+		}
+		s.logger.Error("Failed to get user", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get user"})
+		return false
+	}
+	return true
+}
+
+func (s *Server) handleListUserAccessExceptions(c *gin.Context) {
+	s.listUserAccessExceptions(c, s.userStore, s.accessRuleStore)
+}
+
+func (s *Server) listUserAccessExceptions(c *gin.Context, users userGetter, store userExceptionStore) {
+	if !s.requireTenantUser(c, users) {
+		return
+	}
+	exceptions, err := store.ListUserAccessExceptions(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		s.logger.Error("Failed to list access exceptions", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list access exceptions"})
+		return
+	}
+	result := make([]gin.H, 0, len(exceptions))
+	for _, e := range exceptions {
+		result = append(result, accessExceptionJSON(e))
+	}
+	c.JSON(http.StatusOK, gin.H{"exceptions": result})
+}
+
+// handleCreateUserAccessException takes a rule, or every rule for a destination,
+// away from a user. Access is additive: a user gets every rule assigned to them
+// or to any of their groups. Exceptions take access away from one user without
+// restructuring groups, and win over any grant. A destination exception inside
+// a wider grant is taken out of that grant when the user's rules are loaded, so
+// grants made after the exception honor it too.
+func (s *Server) handleCreateUserAccessException(c *gin.Context) {
+	userID := c.Param("id")
+	var req struct {
+		RuleID          string `json:"rule_id"`
+		DestinationType string `json:"destination_type"`
+		Destination     string `json:"destination" binding:"max=255"`
+		Reason          string `json:"reason" binding:"max=500"`
+	}
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	e := &db.AccessException{UserID: userID, Reason: strings.TrimSpace(req.Reason)}
+	switch {
+	case req.RuleID != "" && req.Destination == "":
+		e.RuleID = &req.RuleID
+	case req.RuleID == "" && req.Destination != "":
+		e.DestinationType = db.AccessRuleType(req.DestinationType)
+		e.Destination = strings.TrimSpace(req.Destination)
+		if err := validateAccessRuleValue(e.DestinationType, e.Destination); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid destination: " + err.Error()})
+			return
+		}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "set either rule_id or destination_type and destination"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	if !s.requireTenantUser(c, s.userStore) {
+		return
+	}
+	if user, err := s.getAuthenticatedUser(c); err == nil {
+		e.CreatedBy = user.Email
+	}
+
+	if err := s.accessRuleStore.CreateAccessException(ctx, e); err != nil {
+		switch err {
+		case db.ErrAccessRuleNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": "access rule not found"})
+		case db.ErrAccessExceptionExists:
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			s.logger.Error("Failed to create access exception", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create access exception"})
+		}
+		return
+	}
+
+	s.recordAudit(c, "user.access_exception.create", "user", userID, gin.H{
+		"exceptionId":     e.ID,
+		"ruleId":          e.RuleID,
+		"destinationType": e.DestinationType,
+		"destination":     e.Destination,
+		"reason":          e.Reason,
+	})
+	c.JSON(http.StatusCreated, accessExceptionJSON(e))
+}
+
+func (s *Server) handleDeleteUserAccessException(c *gin.Context) {
+	s.deleteUserAccessException(c, s.userStore, s.accessRuleStore)
+}
+
+func (s *Server) deleteUserAccessException(c *gin.Context, users userGetter, store userExceptionStore) {
+	if !s.requireTenantUser(c, users) {
+		return
+	}
+	userID := c.Param("id")
+	exceptionID := c.Param("exceptionId")
+	if err := store.DeleteAccessException(c.Request.Context(), userID, exceptionID); err != nil {
+		if err == db.ErrAccessExceptionNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "access exception not found"})
+			return
+		}
+		s.logger.Error("Failed to delete access exception", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete access exception"})
+		return
+	}
+
+	s.recordAudit(c, "user.access_exception.delete", "user", userID, gin.H{"exceptionId": exceptionID})
+	c.JSON(http.StatusOK, gin.H{"message": "access exception removed"})
+}
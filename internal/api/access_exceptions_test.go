@@ -0,0 +1,87 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/gatekey-project/gatekey/internal/config"
+	"github.com/gatekey-project/gatekey/internal/db"
+)
+
+// fakeTenantUsers finds users only in the tenant in ctx, as the user store does.
+type fakeTenantUsers map[string]string // User ID to tenant ID
+
+func (f fakeTenantUsers) GetSSOUser(ctx context.Context, id string) (*db.SSOUser, error) {
+	tenantID, _ := db.TenantFromContext(ctx)
+	if f[id] == "" || f[id] != tenantID {
+		return nil, db.ErrUserNotFound
+	}
+	return &db.SSOUser{ID: id}, nil
+}
+
+// fakeExceptionStore holds exceptions by user ID, with no tenant scoping of its
+// own, so the handlers' checks are what's tested.
+type fakeExceptionStore map[string][]*db.AccessException
+
+func (f fakeExceptionStore) ListUserAccessExceptions(ctx context.Context, userID string) ([]*db.AccessException, error) {
+	return f[userID], nil
+}
+
+func (f fakeExceptionStore) DeleteAccessException(ctx context.Context, userID, id string) error {
+	for i, e := range f[userID] {
+		if e.ID == id {
+			f[userID] = append(f[userID][:i], f[userID][i+1:]...)
+			return nil
+		}
+	}
+	return db.ErrAccessExceptionNotFound
+}
+
+func TestUserAccessExceptionsTenantScoped(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	s := &Server{config: &config.Config{}, logger: zap.NewNop()}
+	users := fakeTenantUsers{"user-a": "tenant-a", "user-b": "tenant-b"}
+	store := fakeExceptionStore{
+		"user-a": {{ID: "exc-a", UserID: "user-a"}},
+		"user-b": {{ID: "exc-b", UserID: "user-b"}},
+	}
+
+	// An admin of tenant A
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Request = c.Request.WithContext(db.WithTenant(c.Request.Context(), "tenant-a"))
+	})
+	router.GET("/users/:id/access-exceptions", func(c *gin.Context) { s.listUserAccessExceptions(c, users, store) })
+	router.DELETE("/users/:id/access-exceptions/:exceptionId", func(c *gin.Context) { s.deleteUserAccessException(c, users, store) })
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		want   int
+	}{
+		{"list own tenant's user", http.MethodGet, "/users/user-a/access-exceptions", http.StatusOK},
+		{"list another tenant's user", http.MethodGet, "/users/user-b/access-exceptions", http.StatusNotFound},
+		{"delete from another tenant's user", http.MethodDelete, "/users/user-b/access-exceptions/exc-b", http.StatusNotFound},
+		{"delete from own tenant's user", http.MethodDelete, "/users/user-a/access-exceptions/exc-a", http.StatusOK},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+		if w.Code != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.name, w.Code, tt.want)
+		}
+	}
+
+	if len(store["user-b"]) != 1 {
+		t.Errorf("another tenant's exception was deleted")
+	}
+	if len(store["user-a"]) != 0 {
+		t.Errorf("own tenant's exception was not deleted")
+	}
+}
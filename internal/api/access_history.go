@@ -0,0 +1,271 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/gatekey-project/gatekey/internal/db"
+)
+
+// accessHistoryEvents are the audit events that change who has which access
+// rules and gateways.
+var accessHistoryEvents = []string{
+	"access_rule.create", "access_rule.update", "access_rule.delete",
+	"access_rule.assign_user", "access_rule.unassign_user",
+	"access_rule.assign_group", "access_rule.unassign_group",
+	"gateway.create", "gateway.update", "gateway.delete", "gateway.restore",
+	"gateway.assign_user", "gateway.unassign_user",
+	"gateway.assign_group", "gateway.unassign_group",
+}
+
+// accessItem is a rule or gateway in a user's effective access, with how they
+// got it: "direct" or "group:<name>".
+type accessItem struct {
+	ID   string   `json:"id"`
+	Name string   `json:"name"`
+	Via  []string `json:"via,omitempty"`
+}
+
+// accessHistoryEntry is a change to a user's effective access and the access
+// they had afterwards.
+type accessHistoryEntry struct {
+	Timestamp       time.Time    `json:"timestamp"`
+	Event           string       `json:"event"`
+	ActorEmail      string       `json:"actorEmail,omitempty"`
+	ChangeID        string       `json:"changeId,omitempty"`
+	RequestedBy     string       `json:"requestedBy,omitempty"`
+	RulesAdded      []accessItem `json:"rulesAdded"`
+	RulesRemoved    []accessItem `json:"rulesRemoved"`
+	GatewaysAdded   []accessItem `json:"gatewaysAdded"`
+	GatewaysRemoved []accessItem `json:"gatewaysRemoved"`
+	Rules           []accessItem `json:"rules"`
+	Gateways        []accessItem `json:"gateways"`
+}
+
+// accessGrant tracks why a user holds a rule or gateway and whether it is
+// currently in force.
+type accessGrant struct {
+	sources  map[string]bool
+	deleted  bool
+	inactive bool
+}
+
+func (g *accessGrant) effective() bool {
+	return len(g.sources) > 0 && !g.deleted && !g.inactive
+}
+
+type accessHistoryDetails struct {
+	UserID   string `json:"userId"`
+	Group    string `json:"group"`
+	Name     string `json:"name"`
+	IsActive *bool  `json:"isActive"`
+	ChangeID string `json:"changeId"`
+}
+
+// buildAccessHistory replays assignment events from the audit log, oldest first,
+// and returns each event that changed the user's effective access. Group grants
+// are counted for the groups the user belongs to now, since group membership
+// comes from the identity provider and isn't audited. names maps rule and
+// gateway IDs to display names and is updated as names change.
+func buildAccessHistory(entries []*db.AuditEntry, userID string, groups []string, names map[string]string) []*accessHistoryEntry {
+	inGroup := make(map[string]bool, len(groups))
+	for _, g := range groups {
+		inGroup[g] = true
+	}
+	rules := make(map[string]*accessGrant)
+	gateways := make(map[string]*accessGrant)
+	grant := func(m map[string]*accessGrant, id string) *accessGrant {
+		if g, ok := m[id]; ok {
+			return g
+		}
+		g := &accessGrant{sources: make(map[string]bool)}
+		m[id] = g
+		return g
+	}
+
+	history := []*accessHistoryEntry{}
+	prevRules, prevGateways := map[string]bool{}, map[string]bool{}
+	for _, e := range entries {
+		var d accessHistoryDetails
+		if len(e.Details) > 0 {
+			_ = json.Unmarshal(e.Details, &d)
+		}
+		if d.Name != "" {
+			names[e.ResourceID] = d.Name
+		}
+
+		kind, action, _ := strings.Cut(e.Event, ".")
+		grants := rules
+		if kind == "gateway" {
+			grants = gateways
+		}
+		source := ""
+		switch {
+		case strings.HasSuffix(action, "_user") && d.UserID == userID:
+			source = "direct"
+		case strings.HasSuffix(action, "_group") && inGroup[d.Group]:
+			source = "group:" + d.Group
+		}
+
+		switch action {
+		case "assign_user", "assign_group":
+			if source != "" {
+				grant(grants, e.ResourceID).sources[source] = true
+			}
+		case "unassign_user", "unassign_group":
+			if source != "" {
+				delete(grant(grants, e.ResourceID).sources, source)
+			}
+		case "update":
+			if d.IsActive != nil {
+				grant(grants, e.ResourceID).inactive = !*d.IsActive
+			}
+		case "delete":
+			grant(grants, e.ResourceID).deleted = true
+		case "restore":
+			grant(grants, e.ResourceID).deleted = false
+		}
+
+		curRules, curGateways := effectiveAccess(rules), effectiveAccess(gateways)
+		rulesAdded, rulesRemoved := diffAccess(prevRules, curRules)
+		gatewaysAdded, gatewaysRemoved := diffAccess(prevGateways, curGateways)
+		if len(rulesAdded)+len(rulesRemoved)+len(gatewaysAdded)+len(gatewaysRemoved) == 0 {
+			continue
+		}
+
+		history = append(history, &accessHistoryEntry{
+			Timestamp:       e.Timestamp,
+			Event:           e.Event,
+			ActorEmail:      e.ActorEmail,
+			ChangeID:        d.ChangeID,
+			RulesAdded:      accessItems(rulesAdded, rules, names),
+			RulesRemoved:    accessItems(rulesRemoved, rules, names),
+			GatewaysAdded:   accessItems(gatewaysAdded, gateways, names),
+			GatewaysRemoved: accessItems(gatewaysRemoved, gateways, names),
+			Rules:           accessItems(accessIDs(curRules), rules, names),
+			Gateways:        accessItems(accessIDs(curGateways), gateways, names),
+		})
+		prevRules, prevGateways = curRules, curGateways
+	}
+	return history
+}
+
+func effectiveAccess(grants map[string]*accessGrant) map[string]bool {
+	ids := make(map[string]bool)
+	for id, g := range grants {
+		if g.effective() {
+			ids[id] = true
+		}
+	}
+	return ids
+}
+
+func diffAccess(before, after map[string]bool) (added, removed []string) {
+	for id := range after {
+		if !before[id] {
+			added = append(added, id)
+		}
+	}
+	for id := range before {
+		if !after[id] {
+			removed = append(removed, id)
+		}
+	}
+	return added, removed
+}
+
+func accessIDs(set map[string]bool) []string {
+	ids := make([]string, 0, len(set))
+	for id := range set {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func accessItems(ids []string, grants map[string]*accessGrant, names map[string]string) []accessItem {
+	items := make([]accessItem, 0, len(ids))
+	for _, id := range ids {
+		item := accessItem{ID: id, Name: names[id]}
+		if g, ok := grants[id]; ok {
+			for source := range g.sources {
+				item.Via = append(item.Via, source)
+			}
+			sort.Strings(item.Via)
+		}
+		items = append(items, item)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Name != items[j].Name {
+			return items[i].Name < items[j].Name
+		}
+		return items[i].ID < items[j].ID
+	})
+	return items
+}
+
+// handleGetUserAccessHistory reconstructs how a user's effective access rules and
+// gateways changed over time from the audit log.
+func (s *Server) handleGetUserAccessHistory(c *gin.Context) {
+	userID := c.Param("id")
+	ctx := c.Request.Context()
+
+	var email string
+	var groups []string
+	if user, err := s.userStore.GetSSOUser(ctx, userID); err == nil {
+		email, groups = user.Email, user.Groups
+	} else if local, err := s.userStore.GetUserByID(ctx, userID); err == nil {
+		email = local.Email
+	} else {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+
+	entries, err := s.auditStore.ListEvents(ctx, accessHistoryEvents)
+	if err != nil {
+		s.logger.Error("Failed to read audit log", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to read audit log"})
+		return
+	}
+
+	// Start from current names; events carry the names rules and gateways had then
+	names := make(map[string]string)
+	if rules, err := s.accessRuleStore.ListAccessRules(ctx); err == nil {
+		for _, r := range rules {
+			names[r.ID] = r.Name
+		}
+	}
+	if gateways, err := s.gatewayStore.ListGateways(ctx); err == nil {
+		for _, g := range gateways {
+			names[g.ID] = g.Name
+		}
+	}
+
+	history := buildAccessHistory(entries, userID, groups, names)
+
+	// Changes applied through the approval queue: show who asked for them
+	requesters := make(map[string]string)
+	for _, h := range history {
+		if h.ChangeID == "" {
+			continue
+		}
+		if _, ok := requesters[h.ChangeID]; !ok {
+			if ch, err := s.changeStore.Get(ctx, h.ChangeID); err == nil {
+				requesters[h.ChangeID] = ch.RequestedByEmail
+			}
+		}
+		h.RequestedBy = requesters[h.ChangeID]
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"userId":  userID,
+		"email":   email,
+		"groups":  groups,
+		"history": history,
+	})
+}
@@ -0,0 +1,56 @@
+package api
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/gatekey-project/gatekey/internal/db"
+)
+
+func TestBuildAccessHistory(t *testing.T) {
+	start := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	var entries []*db.AuditEntry
+	add := func(event, resourceID, actor string, details map[string]interface{}) {
+		raw, _ := json.Marshal(details)
+		entries = append(entries, &db.AuditEntry{
+			Timestamp:  start.Add(time.Duration(len(entries)) * time.Hour),
+			Event:      event,
+			ActorEmail: actor,
+			ResourceID: resourceID,
+			Details:    raw,
+		})
+	}
+
+	add("access_rule.create", "rule-1", "admin@example.com", map[string]interface{}{"name": "finance"})
+	add("access_rule.assign_user", "rule-1", "admin@example.com", map[string]interface{}{"userId": "bob"})
+	add("access_rule.assign_user", "rule-1", "admin@example.com", map[string]interface{}{"userId": "alice"}) // Someone else
+	add("access_rule.assign_group", "rule-1", "other@example.com", map[string]interface{}{"group": "finance-team", "changeId": "change-1"})
+	add("gateway.assign_group", "gw-1", "admin@example.com", map[string]interface{}{"group": "engineering"})
+	add("access_rule.unassign_user", "rule-1", "admin@example.com", map[string]interface{}{"userId": "bob"}) // Still held via the group
+	add("access_rule.update", "rule-1", "admin@example.com", map[string]interface{}{"name": "finance", "isActive": false})
+
+	history := buildAccessHistory(entries, "bob", []string{"finance-team", "engineering"}, map[string]string{"gw-1": "us-east"})
+
+	if len(history) != 3 {
+		t.Fatalf("got %d history entries, want 3: %+v", len(history), history)
+	}
+
+	granted := history[0]
+	if granted.Event != "access_rule.assign_user" || len(granted.RulesAdded) != 1 || granted.RulesAdded[0].Name != "finance" {
+		t.Errorf("first entry = %+v, want finance rule added", granted)
+	}
+
+	gateway := history[1]
+	if len(gateway.GatewaysAdded) != 1 || gateway.GatewaysAdded[0].Name != "us-east" || gateway.GatewaysAdded[0].Via[0] != "group:engineering" {
+		t.Errorf("second entry = %+v, want us-east added via group:engineering", gateway)
+	}
+	if len(gateway.Rules) != 1 || len(gateway.Rules[0].Via) != 2 {
+		t.Errorf("rules after second entry = %+v, want finance via direct and group", gateway.Rules)
+	}
+
+	deactivated := history[2]
+	if deactivated.Event != "access_rule.update" || len(deactivated.RulesRemoved) != 1 || len(deactivated.Rules) != 0 {
+		t.Errorf("third entry = %+v, want finance rule removed", deactivated)
+	}
+}
@@ -0,0 +1,530 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/gatekey-project/gatekey/internal/db"
+)
+
+const (
+	// maxAccessRequestHours caps how long time-bounded access can be requested or
+	// granted for.
+	maxAccessRequestHours = 90 * 24
+	// maxJustificationLength caps the justification a user gives for a request.
+	maxJustificationLength = 2000
+	// accessGrantSweepInterval is how often ended time-bounded grants are removed.
+	accessGrantSweepInterval = 5 * time.Minute
+)
+
+func accessRequestJSON(r *db.AccessRequest) gin.H {
+	result := gin.H{
+		"id":            r.ID,
+		"userId":        r.UserID,
+		"userEmail":     r.UserEmail,
+		"resourceType":  r.ResourceType,
+		"resourceId":    r.ResourceID,
+		"resourceName":  r.ResourceName,
+		"justification": r.Justification,
+		"durationHours": r.DurationHours,
+		"status":        r.Status,
+		"reviewComment": r.ReviewComment,
+		"createdAt":     r.CreatedAt.Format(time.RFC3339),
+	}
+	if r.ReviewedByEmail != nil {
+		result["reviewedByEmail"] = *r.ReviewedByEmail
+	}
+	if r.ReviewedAt != nil {
+		result["reviewedAt"] = r.ReviewedAt.Format(time.RFC3339)
+	}
+	if r.GrantedRuleID != nil {
+		result["grantedRuleId"] = *r.GrantedRuleID
+	}
+	if r.AccessExpiresAt != nil {
+		result["accessExpiresAt"] = r.AccessExpiresAt.Format(time.RFC3339)
+	}
+	return result
+}
+
+// validateAccessDuration checks a requested or granted length of access. Zero
+// means access doesn't end.
+func validateAccessDuration(hours int) error {
+	if hours < 0 || hours > maxAccessRequestHours {
+		return fmt.Errorf("duration_hours must be between 0 and %d", maxAccessRequestHours)
+	}
+	return nil
+}
+
+// hasNetworkRule reports whether any of the rules is on the network.
+func hasNetworkRule(rules []*db.AccessRule, networkID string) bool {
+	for _, r := range rules {
+		if r.NetworkID != nil && *r.NetworkID == networkID {
+			return true
+		}
+	}
+	return false
+}
+
+// handleCreateAccessRequest lets a user ask for access to a gateway or network
+// they can't reach yet.
+func (s *Server) handleCreateAccessRequest(c *gin.Context) {
+	user, err := s.getAuthenticatedUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		return
+	}
+
+	var req struct {
+		ResourceType  string `json:"resource_type" binding:"required"`
+		ResourceID    string `json:"resource_id" binding:"required"`
+		Justification string `json:"justification"`
+		DurationHours int    `json:"duration_hours"`
+	}
+	if !bindJSON(c, &req) {
+		return
+	}
+	req.Justification = strings.TrimSpace(req.Justification)
+	if req.Justification == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "justification is required"})
+		return
+	}
+	if len(req.Justification) > maxJustificationLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("justification must be at most %d characters", maxJustificationLength)})
+		return
+	}
+	if err := validateAccessDuration(req.DurationHours); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	r := &db.AccessRequest{
+		UserID:        user.UserID,
+		UserEmail:     user.Email,
+		ResourceType:  req.ResourceType,
+		ResourceID:    req.ResourceID,
+		Justification: req.Justification,
+	}
+	if req.DurationHours > 0 {
+		r.DurationHours = &req.DurationHours
+	}
+
+	switch req.ResourceType {
+	case db.AccessRequestGateway:
+		gateway, err := s.gatewayStore.GetGateway(ctx, req.ResourceID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "gateway not found"})
+			return
+		}
+		hasAccess, err := s.gatewayStore.UserHasGatewayAccess(ctx, user.UserID, gateway.ID, user.Groups)
+		if err != nil {
+			s.logger.Error("Failed to check gateway access", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check access"})
+			return
+		}
+		if hasAccess {
+			c.JSON(http.StatusConflict, gin.H{"error": "you already have access to this gateway"})
+			return
+		}
+		r.ResourceName = gateway.Name
+	case db.AccessRequestNetwork:
+		network, err := s.networkStore.GetNetwork(ctx, req.ResourceID)
+		if err != nil || !network.IsActive {
+			c.JSON(http.StatusNotFound, gin.H{"error": "network not found"})
+			return
+		}
+		rules, err := s.accessRuleStore.GetUserAccessRules(ctx, user.UserID, user.Groups)
+		if err != nil {
+			s.logger.Error("Failed to get user access rules", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check access"})
+			return
+		}
+		if hasNetworkRule(rules, network.ID) {
+			c.JSON(http.StatusConflict, gin.H{"error": "you already have access rules on this network"})
+			return
+		}
+		r.ResourceName = network.Name
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "resource_type must be 'gateway' or 'network'"})
+		return
+	}
+
+	if err := s.accessRequestStore.Create(ctx, r); err != nil {
+		if err == db.ErrAccessRequestExists {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		s.logger.Error("Failed to create access request", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create access request"})
+		return
+	}
+
+	s.recordAudit(c, "access_request.create", "access_request", r.ID, gin.H{
+		"resourceType": r.ResourceType,
+		"resourceId":   r.ResourceID,
+		"resourceName": r.ResourceName,
+	})
+	s.emitEvent(ctx, eventAccessRequested, r.UserID, "", gin.H{
+		"requestId":    r.ID,
+		"userEmail":    r.UserEmail,
+		"resourceType": r.ResourceType,
+		"resourceName": r.ResourceName,
+	})
+	c.JSON(http.StatusCreated, accessRequestJSON(r))
+}
+
+// handleListMyAccessRequests returns the authenticated user's access requests.
+func (s *Server) handleListMyAccessRequests(c *gin.Context) {
+	user, err := s.getAuthenticatedUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		return
+	}
+
+	requests, err := s.accessRequestStore.List(c.Request.Context(), user.UserID, c.Query("status"), 100)
+	if err != nil {
+		s.logger.Error("Failed to list access requests", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list access requests"})
+		return
+	}
+	result := make([]gin.H, 0, len(requests))
+	for _, r := range requests {
+		result = append(result, accessRequestJSON(r))
+	}
+	c.JSON(http.StatusOK, gin.H{"requests": result})
+}
+
+// handleListRequestableAccess returns the active gateways and networks the
+// authenticated user could request access to.
+func (s *Server) handleListRequestableAccess(c *gin.Context) {
+	user, err := s.getAuthenticatedUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		return
+	}
+	ctx := c.Request.Context()
+
+	allGateways, err := s.gatewayStore.ListGateways(ctx)
+	if err != nil {
+		s.logger.Error("Failed to list gateways", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list gateways"})
+		return
+	}
+	userGateways, err := s.gatewayStore.ListUserGateways(ctx, user.UserID, user.Groups)
+	if err != nil {
+		s.logger.Error("Failed to list user gateways", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list gateways"})
+		return
+	}
+	networks, err := s.networkStore.ListNetworks(ctx)
+	if err != nil {
+		s.logger.Error("Failed to list networks", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list networks"})
+		return
+	}
+	rules, err := s.accessRuleStore.GetUserAccessRules(ctx, user.UserID, user.Groups)
+	if err != nil {
+		s.logger.Error("Failed to get user access rules", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get access rules"})
+		return
+	}
+	pending, err := s.accessRequestStore.List(ctx, user.UserID, db.AccessRequestPending, 100)
+	if err != nil {
+		s.logger.Error("Failed to list access requests", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list access requests"})
+		return
+	}
+	pendingIDs := make(map[string]string, len(pending))
+	for _, r := range pending {
+		pendingIDs[r.ResourceType+"/"+r.ResourceID] = r.ID
+	}
+
+	has := make(map[string]bool, len(userGateways))
+	for _, gw := range userGateways {
+		has[gw.ID] = true
+	}
+	gateways := make([]gin.H, 0)
+	for _, gw := range allGateways {
+		if has[gw.ID] {
+			continue
+		}
+		entry := gin.H{"id": gw.ID, "name": gw.Name}
+		if id, ok := pendingIDs[db.AccessRequestGateway+"/"+gw.ID]; ok {
+			entry["pendingRequestId"] = id
+		}
+		gateways = append(gateways, entry)
+	}
+	networkResult := make([]gin.H, 0)
+	for _, n := range networks {
+		if !n.IsActive || hasNetworkRule(rules, n.ID) {
+			continue
+		}
+		entry := gin.H{"id": n.ID, "name": n.Name, "description": n.Description}
+		if id, ok := pendingIDs[db.AccessRequestNetwork+"/"+n.ID]; ok {
+			entry["pendingRequestId"] = id
+		}
+		networkResult = append(networkResult, entry)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"gateways": gateways, "networks": networkResult})
+}
+
+// handleCancelAccessRequest withdraws one of the authenticated user's pending
+// requests.
+func (s *Server) handleCancelAccessRequest(c *gin.Context) {
+	user, err := s.getAuthenticatedUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		return
+	}
+
+	r, err := s.accessRequestStore.Cancel(c.Request.Context(), c.Param("id"), user.UserID)
+	if err != nil {
+		switch err {
+		case db.ErrAccessRequestNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": "access request not found"})
+		case db.ErrAccessRequestNotPending:
+			c.JSON(http.StatusConflict, gin.H{"error": "access request has already been reviewed"})
+		default:
+			s.logger.Error("Failed to cancel access request", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to cancel access request"})
+		}
+		return
+	}
+
+	s.recordAudit(c, "access_request.cancel", "access_request", r.ID, nil)
+	c.JSON(http.StatusOK, accessRequestJSON(r))
+}
+
+// handleAdminListAccessRequests returns the access request queue, pending
+// requests by default.
+func (s *Server) handleAdminListAccessRequests(c *gin.Context) {
+	if _, ok := s.requireAdmin(c); !ok {
+		return
+	}
+
+	status := c.DefaultQuery("status", db.AccessRequestPending)
+	if status == "all" {
+		status = ""
+	}
+	limit := 100
+	if l, err := strconv.Atoi(c.Query("limit")); err == nil && l > 0 && l <= 500 {
+		limit = l
+	}
+
+	requests, err := s.accessRequestStore.List(c.Request.Context(), c.Query("user_id"), status, limit)
+	if err != nil {
+		s.logger.Error("Failed to list access requests", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list access requests"})
+		return
+	}
+	result := make([]gin.H, 0, len(requests))
+	for _, r := range requests {
+		result = append(result, accessRequestJSON(r))
+	}
+	c.JSON(http.StatusOK, gin.H{"requests": result})
+}
+
+// handleApproveAccessRequest approves a request, assigning the gateway, or for a
+// network the access rule the admin picks, to the user. The assignment is
+// removed again when time-bounded access ends.
+func (s *Server) handleApproveAccessRequest(c *gin.Context) {
+	admin, ok := s.requireAdmin(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		RuleID        string `json:"rule_id"`
+		DurationHours *int   `json:"duration_hours"` // Overrides the requested duration; 0 for no end
+		Comment       string `json:"comment"`
+	}
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	ctx := c.Request.Context()
+	r, err := s.accessRequestStore.Get(ctx, c.Param("id"))
+	if err != nil {
+		if err == db.ErrAccessRequestNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "access request not found"})
+			return
+		}
+		s.logger.Error("Failed to get access request", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to approve access request"})
+		return
+	}
+	if r.Status != db.AccessRequestPending {
+		c.JSON(http.StatusConflict, gin.H{"error": "access request has already been reviewed"})
+		return
+	}
+
+	hours := 0
+	if r.DurationHours != nil {
+		hours = *r.DurationHours
+	}
+	if req.DurationHours != nil {
+		hours = *req.DurationHours
+	}
+	if err := validateAccessDuration(hours); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	switch r.ResourceType {
+	case db.AccessRequestGateway:
+		if _, err := s.gatewayStore.GetGateway(ctx, r.ResourceID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "the requested gateway no longer exists; reject the request instead"})
+			return
+		}
+	case db.AccessRequestNetwork:
+		if req.RuleID == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "rule_id is required to approve network access"})
+			return
+		}
+		rule, err := s.accessRuleStore.GetAccessRule(ctx, req.RuleID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "access rule not found"})
+			return
+		}
+		if rule.NetworkID == nil || *rule.NetworkID != r.ResourceID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "rule_id must be an access rule on the requested network"})
+			return
+		}
+		r.GrantedRuleID = &rule.ID
+	}
+
+	reviewed, err := s.accessRequestStore.Review(ctx, r.ID, db.AccessRequestApproved, admin.UserID, admin.Email, req.Comment)
+	if err != nil {
+		s.respondAccessReviewError(c, err)
+		return
+	}
+	reviewed.GrantedRuleID = r.GrantedRuleID
+
+	var created bool
+	if reviewed.ResourceType == db.AccessRequestGateway {
+		created, err = s.gatewayStore.AssignUserToGateway(ctx, reviewed.UserID, reviewed.ResourceID)
+	} else {
+		created, err = s.accessRuleStore.AssignRuleToUser(ctx, reviewed.UserID, *reviewed.GrantedRuleID)
+	}
+	if err != nil {
+		s.logger.Error("Failed to grant access request", zap.Error(err), zap.String("id", reviewed.ID))
+		if err := s.accessRequestStore.SetStatus(ctx, reviewed.ID, db.AccessRequestFailed); err != nil {
+			s.logger.Error("Failed to mark access request failed", zap.Error(err), zap.String("id", reviewed.ID))
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to grant access"})
+		return
+	}
+
+	reviewed.Granted = created
+	if hours > 0 {
+		expires := time.Now().Add(time.Duration(hours) * time.Hour)
+		reviewed.AccessExpiresAt = &expires
+	}
+	if err := s.accessRequestStore.SetGrant(ctx, reviewed); err != nil {
+		s.logger.Error("Failed to record access grant", zap.Error(err), zap.String("id", reviewed.ID))
+	}
+
+	s.recordAudit(c, "access_request.approve", "access_request", reviewed.ID, gin.H{
+		"userId":          reviewed.UserID,
+		"resourceType":    reviewed.ResourceType,
+		"resourceId":      reviewed.ResourceID,
+		"ruleId":          reviewed.GrantedRuleID,
+		"accessExpiresAt": reviewed.AccessExpiresAt,
+		"created":         created,
+	})
+	c.JSON(http.StatusOK, accessRequestJSON(reviewed))
+}
+
+func (s *Server) handleRejectAccessRequest(c *gin.Context) {
+	admin, ok := s.requireAdmin(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Comment string `json:"comment"`
+	}
+	_ = c.ShouldBindJSON(&req) // The comment is optional
+
+	r, err := s.accessRequestStore.Review(c.Request.Context(), c.Param("id"), db.AccessRequestRejected, admin.UserID, admin.Email, req.Comment)
+	if err != nil {
+		s.respondAccessReviewError(c, err)
+		return
+	}
+
+	s.recordAudit(c, "access_request.reject", "access_request", r.ID, gin.H{"userId": r.UserID, "comment": req.Comment})
+	c.JSON(http.StatusOK, accessRequestJSON(r))
+}
+
+func (s *Server) respondAccessReviewError(c *gin.Context, err error) {
+	switch err {
+	case db.ErrAccessRequestNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": "access request not found"})
+	case db.ErrAccessRequestNotPending:
+		c.JSON(http.StatusConflict, gin.H{"error": "access request has already been reviewed"})
+	case db.ErrAccessRequestSelfReview:
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	default:
+		s.logger.Error("Failed to review access request", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to review access request"})
+	}
+}
+
+// runAccessGrantExpiry periodically removes access granted for a limited time.
+func (s *Server) runAccessGrantExpiry(ctx context.Context) {
+	ticker := time.NewTicker(accessGrantSweepInterval)
+	defer ticker.Stop()
+
+	s.expireAccessGrants(ctx)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.expireAccessGrants(ctx)
+		}
+	}
+}
+
+// expireAccessGrants removes the assignments of approved requests whose access
+// has ended. Assignments the user already had before the approval are left.
+func (s *Server) expireAccessGrants(ctx context.Context) {
+	requests, err := s.accessRequestStore.ListExpiredGrants(ctx, time.Now())
+	if err != nil {
+		s.logger.Error("Failed to list expired access grants", zap.Error(err))
+		return
+	}
+
+	for _, r := range requests {
+		if r.Granted {
+			var err error
+			if r.ResourceType == db.AccessRequestGateway {
+				err = s.gatewayStore.RemoveUserFromGateway(ctx, r.UserID, r.ResourceID)
+			} else if r.GrantedRuleID != nil {
+				err = s.accessRuleStore.RemoveRuleFromUser(ctx, r.UserID, *r.GrantedRuleID)
+			}
+			if err != nil && err != db.ErrGatewayNotFound && err != db.ErrAccessRuleNotFound {
+				s.logger.Error("Failed to remove expired access grant", zap.String("id", r.ID), zap.Error(err))
+				continue
+			}
+		}
+		if err := s.accessRequestStore.SetStatus(ctx, r.ID, db.AccessRequestExpired); err != nil {
+			s.logger.Error("Failed to mark access request expired", zap.String("id", r.ID), zap.Error(err))
+			continue
+		}
+		s.logger.Info("Time-bounded access ended",
+			zap.String("request_id", r.ID),
+			zap.String("user", r.UserEmail),
+			zap.String("resource_type", r.ResourceType),
+			zap.String("resource", r.ResourceName))
+	}
+}
@@ -0,0 +1,35 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/gatekey-project/gatekey/internal/db"
+)
+
+func TestHasNetworkRule(t *testing.T) {
+	prod, dev := "net-prod", "net-dev"
+	rules := []*db.AccessRule{
+		{ID: "r1", NetworkID: &dev},
+		{ID: "r2"}, // Not tied to a network
+	}
+
+	if !hasNetworkRule(rules, dev) {
+		t.Errorf("expected a rule on %s", dev)
+	}
+	if hasNetworkRule(rules, prod) {
+		t.Errorf("rules without a network shouldn't count as access to %s", prod)
+	}
+}
+
+func TestValidateAccessDuration(t *testing.T) {
+	for _, hours := range []int{0, 1, maxAccessRequestHours} {
+		if err := validateAccessDuration(hours); err != nil {
+			t.Errorf("validateAccessDuration(%d) = %v, want nil", hours, err)
+		}
+	}
+	for _, hours := range []int{-1, maxAccessRequestHours + 1} {
+		if err := validateAccessDuration(hours); err == nil {
+			t.Errorf("validateAccessDuration(%d) = nil, want error", hours)
+		}
+	}
+}
@@ -0,0 +1,348 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/gatekey-project/gatekey/internal/db"
+)
+
+// Access reviews answer "who can reach this" for a gateway or network by
+// inverting the assignment graph: gateway and rule assignments point at users and
+// groups, and each user is listed with every assignment that reaches them.
+
+// Kinds of assignment that grant access.
+const (
+	grantGateway = "gateway" // The user can connect to a gateway
+	grantRule    = "rule"    // The user has an access rule
+)
+
+// reviewGrant is a gateway or access rule assignment.
+type reviewGrant struct {
+	kind    string
+	id      string
+	name    string
+	userIDs []string
+	groups  []string
+}
+
+// accessSource is how a user was granted access: directly, or through a group.
+type accessSource struct {
+	Kind  string `json:"kind"`
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Group string `json:"group,omitempty"` // Empty for a direct assignment
+}
+
+// reviewUser is a user who may hold access, with the groups they're in.
+type reviewUser struct {
+	id     string
+	email  string
+	name   string
+	groups []string
+}
+
+// invertGrants returns, for each user any of the grants reach, how they reach
+// them. A user both assigned directly and through a group gets one source for each.
+func invertGrants(users []reviewUser, grants []reviewGrant) map[string][]accessSource {
+	sources := make(map[string][]accessSource)
+	for _, g := range grants {
+		direct := make(map[string]bool, len(g.userIDs))
+		for _, id := range g.userIDs {
+			direct[id] = true
+		}
+		for _, u := range users {
+			if direct[u.id] {
+				sources[u.id] = append(sources[u.id], accessSource{Kind: g.kind, ID: g.id, Name: g.name})
+			}
+			for _, group := range g.groups {
+				if containsString(u.groups, group) {
+					sources[u.id] = append(sources[u.id], accessSource{Kind: g.kind, ID: g.id, Name: g.name, Group: group})
+				}
+			}
+		}
+	}
+	return sources
+}
+
+// reviewUsers returns the users that can hold access: active SSO users and
+// local users, who have no groups.
+func (s *Server) reviewUsers(ctx context.Context) ([]reviewUser, error) {
+	ssoUsers, err := s.userStore.ListSSOUsers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	localUsers, err := s.userStore.ListLocalUsers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	users := make([]reviewUser, 0, len(ssoUsers)+len(localUsers))
+	for _, u := range ssoUsers {
+		if u.IsActive {
+			users = append(users, reviewUser{id: u.ID, email: u.Email, name: u.Name, groups: u.Groups})
+		}
+	}
+	for _, u := range localUsers {
+		users = append(users, reviewUser{id: u.ID, email: u.Email, name: u.Username})
+	}
+	return users, nil
+}
+
+// gatewayGrant loads who is assigned to a gateway.
+func (s *Server) gatewayGrant(ctx context.Context, gateway *db.Gateway) (reviewGrant, error) {
+	grant := reviewGrant{kind: grantGateway, id: gateway.ID, name: gateway.Name}
+	users, err := s.gatewayStore.GetGatewayUsers(ctx, gateway.ID)
+	if err != nil {
+		return grant, err
+	}
+	groups, err := s.gatewayStore.GetGatewayGroups(ctx, gateway.ID)
+	if err != nil {
+		return grant, err
+	}
+	for _, u := range users {
+		grant.userIDs = append(grant.userIDs, u.UserID)
+	}
+	for _, g := range groups {
+		grant.groups = append(grant.groups, g.GroupName)
+	}
+	return grant, nil
+}
+
+// accessReviewEntry is a user who can reach the reviewed gateway or network.
+type accessReviewEntry struct {
+	UserID     string         `json:"userId"`
+	Email      string         `json:"email"`
+	Name       string         `json:"name"`
+	Sources    []accessSource `json:"sources"`
+	LastUsedAt *string        `json:"lastUsedAt"` // Last connection through the gateway, or any gateway serving the network
+}
+
+// buildAccessReview lists the users reached by every one of the grant sets, with
+// all the sources that reach them, ordered by email.
+func buildAccessReview(users []reviewUser, lastUsed map[string]time.Time, grantSets ...[]reviewGrant) []accessReviewEntry {
+	perSet := make([]map[string][]accessSource, len(grantSets))
+	for i, grants := range grantSets {
+		perSet[i] = invertGrants(users, grants)
+	}
+
+	entries := make([]accessReviewEntry, 0)
+	for _, u := range users {
+		var sources []accessSource
+		reached := true
+		for _, set := range perSet {
+			if len(set[u.id]) == 0 {
+				reached = false
+				break
+			}
+			sources = append(sources, set[u.id]...)
+		}
+		if !reached {
+			continue
+		}
+		entry := accessReviewEntry{UserID: u.id, Email: u.email, Name: u.name, Sources: sources}
+		if t, ok := lastUsed[u.id]; ok {
+			formatted := t.Format(time.RFC3339)
+			entry.LastUsedAt = &formatted
+		}
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Email < entries[j].Email })
+	return entries
+}
+
+// handleGatewayAccessReview lists everyone who can connect to a gateway and
+// how: a direct assignment or an assigned group they're in.
+func (s *Server) handleGatewayAccessReview(c *gin.Context) {
+	if _, ok := s.requireAdmin(c); !ok {
+		return
+	}
+	ctx := c.Request.Context()
+	gatewayID := c.Param("id")
+
+	gateway, err := s.gatewayStore.GetGateway(ctx, gatewayID)
+	if err != nil {
+		if err == db.ErrGatewayNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "gateway not found"})
+			return
+		}
+		s.logger.Error("Failed to get gateway", zap.Error(err), zap.String("id", gatewayID))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get gateway"})
+		return
+	}
+
+	users, err := s.reviewUsers(ctx)
+	if err != nil {
+		s.logger.Error("Failed to list users for access review", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to build access review"})
+		return
+	}
+	grant, err := s.gatewayGrant(ctx, gateway)
+	if err != nil {
+		s.logger.Error("Failed to get gateway assignments", zap.Error(err), zap.String("id", gatewayID))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to build access review"})
+		return
+	}
+	lastUsed, err := s.connectionStore.LastConnectedAt(ctx, []string{gateway.ID})
+	if err != nil {
+		s.logger.Error("Failed to get last connections", zap.Error(err), zap.String("id", gatewayID))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to build access review"})
+		return
+	}
+
+	entries := buildAccessReview(users, lastUsed, []reviewGrant{grant})
+	s.respondAccessReview(c, "gateway", gateway.ID, gateway.Name, entries)
+}
+
+// handleNetworkAccessReview lists everyone who can reach a network: users with
+// an active rule for it, directly or through a group, who can also connect to a
+// gateway serving it. Rules without a network count for every network.
+func (s *Server) handleNetworkAccessReview(c *gin.Context) {
+	if _, ok := s.requireAdmin(c); !ok {
+		return
+	}
+	ctx := c.Request.Context()
+	networkID := c.Param("id")
+
+	network, err := s.networkStore.GetNetwork(ctx, networkID)
+	if err != nil {
+		if err == db.ErrNetworkNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "network not found"})
+			return
+		}
+		s.logger.Error("Failed to get network", zap.Error(err), zap.String("id", networkID))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get network"})
+		return
+	}
+
+	users, err := s.reviewUsers(ctx)
+	if err != nil {
+		s.logger.Error("Failed to list users for access review", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to build access review"})
+		return
+	}
+	ruleGrants, err := s.networkRuleGrants(ctx, network.ID)
+	if err != nil {
+		s.logger.Error("Failed to get network rule assignments", zap.Error(err), zap.String("id", networkID))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to build access review"})
+		return
+	}
+
+	gateways, err := s.networkStore.GetNetworkGateways(ctx, network.ID)
+	if err != nil {
+		s.logger.Error("Failed to get network gateways", zap.Error(err), zap.String("id", networkID))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to build access review"})
+		return
+	}
+	gatewayGrants := make([]reviewGrant, 0, len(gateways))
+	gatewayIDs := make([]string, 0, len(gateways))
+	for _, gw := range gateways {
+		grant, err := s.gatewayGrant(ctx, gw)
+		if err != nil {
+			s.logger.Error("Failed to get gateway assignments", zap.Error(err), zap.String("id", gw.ID))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to build access review"})
+			return
+		}
+		gatewayGrants = append(gatewayGrants, grant)
+		gatewayIDs = append(gatewayIDs, gw.ID)
+	}
+
+	lastUsed, err := s.connectionStore.LastConnectedAt(ctx, gatewayIDs)
+	if err != nil {
+		s.logger.Error("Failed to get last connections", zap.Error(err), zap.String("id", networkID))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to build access review"})
+		return
+	}
+
+	entries := buildAccessReview(users, lastUsed, ruleGrants, gatewayGrants)
+	s.respondAccessReview(c, "network", network.ID, network.Name, entries)
+}
+
+// networkRuleGrants loads who is assigned each active access rule that applies
+// to a network.
+func (s *Server) networkRuleGrants(ctx context.Context, networkID string) ([]reviewGrant, error) {
+	rules, err := s.accessRuleStore.ListAccessRulesByNetwork(ctx, networkID)
+	if err != nil {
+		return nil, err
+	}
+	userRules, err := s.accessRuleStore.GetAllUserAccessRuleAssignments(ctx)
+	if err != nil {
+		return nil, err
+	}
+	groupRules, err := s.accessRuleStore.GetAllGroupAccessRuleAssignments(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	grants := make([]reviewGrant, 0, len(rules))
+	byRule := make(map[string]*reviewGrant, len(rules))
+	for _, r := range rules {
+		if !r.IsActive {
+			continue
+		}
+		grants = append(grants, reviewGrant{kind: grantRule, id: r.ID, name: r.Name})
+	}
+	for i := range grants {
+		byRule[grants[i].id] = &grants[i]
+	}
+	for userID, ruleIDs := range userRules {
+		for _, id := range ruleIDs {
+			if g, ok := byRule[id]; ok {
+				g.userIDs = append(g.userIDs, userID)
+			}
+		}
+	}
+	for group, ruleIDs := range groupRules {
+		for _, id := range ruleIDs {
+			if g, ok := byRule[id]; ok {
+				g.groups = append(g.groups, group)
+			}
+		}
+	}
+	for i := range grants {
+		sort.Strings(grants[i].groups)
+	}
+	return grants, nil
+}
+
+// respondAccessReview writes an access review as JSON, or as CSV with one row per
+// user and source when ?format=csv.
+func (s *Server) respondAccessReview(c *gin.Context, objectType, id, name string, entries []accessReviewEntry) {
+	switch c.DefaultQuery("format", "json") {
+	case "json":
+	case "csv":
+		w := csvExportWriter(c, "access-review-"+objectType, []string{
+			objectType, "user_email", "user_name", "source", "source_name", "via_group", "last_used_at",
+		})
+		for _, e := range entries {
+			lastUsed := ""
+			if e.LastUsedAt != nil {
+				lastUsed = *e.LastUsedAt
+			}
+			for _, src := range e.Sources {
+				_ = w.Write([]string{
+					csvField(name), csvField(e.Email), csvField(e.Name),
+					src.Kind, csvField(src.Name), csvField(src.Group), lastUsed,
+				})
+			}
+		}
+		w.Flush()
+		return
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be json or csv"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		objectType + "Id":   id,
+		objectType + "Name": name,
+		"generatedAt":       time.Now().UTC().Format(time.RFC3339),
+		"users":             entries,
+		"total":             len(entries),
+	})
+}
@@ -0,0 +1,49 @@
+package api
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBuildAccessReview(t *testing.T) {
+	users := []reviewUser{
+		{id: "u1", email: "alice@example.com", groups: []string{"eng", "ops"}},
+		{id: "u2", email: "bob@example.com", groups: []string{"sales"}},
+		{id: "u3", email: "carol@example.com"},
+	}
+	rules := []reviewGrant{
+		{kind: grantRule, id: "r1", name: "prod-db", userIDs: []string{"u1", "u3"}, groups: []string{"eng"}},
+		{kind: grantRule, id: "r2", name: "crm", groups: []string{"sales"}},
+	}
+	gateways := []reviewGrant{
+		{kind: grantGateway, id: "g1", name: "us-east-1", groups: []string{"ops", "sales"}},
+	}
+	connected := time.Date(2024, 1, 14, 8, 0, 0, 0, time.UTC)
+
+	entries := buildAccessReview(users, map[string]time.Time{"u1": connected}, rules, gateways)
+	if len(entries) != 2 {
+		t.Fatalf("got %d users, want 2 (carol has a rule but no gateway): %+v", len(entries), entries)
+	}
+
+	alice := entries[0]
+	want := []accessSource{
+		{Kind: grantRule, ID: "r1", Name: "prod-db"},
+		{Kind: grantRule, ID: "r1", Name: "prod-db", Group: "eng"},
+		{Kind: grantGateway, ID: "g1", Name: "us-east-1", Group: "ops"},
+	}
+	if alice.UserID != "u1" || len(alice.Sources) != len(want) {
+		t.Fatalf("alice = %+v", alice)
+	}
+	for i := range want {
+		if alice.Sources[i] != want[i] {
+			t.Errorf("alice source %d = %+v, want %+v", i, alice.Sources[i], want[i])
+		}
+	}
+	if alice.LastUsedAt == nil || *alice.LastUsedAt != "2024-01-14T08:00:00Z" {
+		t.Errorf("alice lastUsedAt = %v", alice.LastUsedAt)
+	}
+
+	if bob := entries[1]; bob.UserID != "u2" || len(bob.Sources) != 2 || bob.LastUsedAt != nil {
+		t.Errorf("bob = %+v", bob)
+	}
+}
@@ -0,0 +1,65 @@
+package api
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/gatekey-project/gatekey/internal/db"
+	"github.com/gatekey-project/gatekey/internal/firewall"
+)
+
+// validateAccessRuleValue checks that value is well-formed for the given rule type.
+// Malformed values would otherwise be silently skipped when the gateway applies rules.
+func validateAccessRuleValue(ruleType db.AccessRuleType, value string) error {
+	if value == "" {
+		return fmt.Errorf("value is required")
+	}
+
+	switch ruleType {
+	case db.AccessRuleTypeIP:
+		if net.ParseIP(value) == nil {
+			return fmt.Errorf("invalid value for ip rule: %q is not an IP address", value)
+		}
+	case db.AccessRuleTypeCIDR:
+		if _, _, err := net.ParseCIDR(value); err != nil {
+			return fmt.Errorf("invalid value for cidr rule: %q is not a CIDR (e.g. 10.0.0.0/24)", value)
+		}
+	case db.AccessRuleTypeHostname:
+		if net.ParseIP(value) != nil {
+			return fmt.Errorf("invalid value for hostname rule: %q is an IP address, use an ip rule instead", value)
+		}
+		if !firewall.ValidHostname(value) {
+			return fmt.Errorf("invalid value for hostname rule: %q is not a valid hostname", value)
+		}
+	case db.AccessRuleTypeHostnameWildcard:
+		if err := firewall.ValidateHostnameWildcard(value); err != nil {
+			return fmt.Errorf("invalid value for hostname_wildcard rule: %w", err)
+		}
+	default:
+		return fmt.Errorf("invalid rule_type, must be: ip, cidr, hostname, or hostname_wildcard")
+	}
+	return nil
+}
+
+// validatePortAndProtocol checks an optional port range and protocol using the same
+// parsers the gateway uses when applying rules. ICMP has no ports, so an ICMP
+// rule can't have a port range.
+func validatePortAndProtocol(portRange, protocol *string) error {
+	start := 0
+	if portRange != nil {
+		var err error
+		if start, _, err = firewall.ParsePortRange(*portRange); err != nil {
+			return err
+		}
+	}
+	if protocol != nil {
+		parsed, err := firewall.ParseProtocol(*protocol)
+		if err != nil {
+			return err
+		}
+		if parsed == firewall.ProtocolICMP && start != 0 {
+			return fmt.Errorf("invalid port range %q: icmp rules have no ports", *portRange)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package api
+
+import "testing"
+
+func TestValidatePortAndProtocol(t *testing.T) {
+	tests := []struct {
+		port, protocol *string
+		wantErr        bool
+	}{
+		{nil, nil, false},
+		{strPtr("443"), strPtr("tcp"), false},
+		{strPtr("8000-9000"), strPtr("udp"), false},
+		{nil, strPtr("icmp"), false},
+		{strPtr("*"), strPtr("icmp"), false},
+		{strPtr("443"), strPtr("any"), false},
+		{strPtr("443"), strPtr("icmp"), true},
+		{strPtr("0"), nil, true},
+		{nil, strPtr("sctp"), true},
+	}
+	for _, tt := range tests {
+		err := validatePortAndProtocol(tt.port, tt.protocol)
+		if (err != nil) != tt.wantErr {
+			port, protocol := "<nil>", "<nil>"
+			if tt.port != nil {
+				port = *tt.port
+			}
+			if tt.protocol != nil {
+				protocol = *tt.protocol
+			}
+			t.Errorf("validatePortAndProtocol(%q, %q) error = %v, wantErr %v", port, protocol, err, tt.wantErr)
+		}
+	}
+}
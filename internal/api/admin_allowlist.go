@@ -0,0 +1,177 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+
+	"github.com/gatekey-project/gatekey/internal/db"
+)
+
+// parseAdminAllowlist parses the admin_allowed_cidrs setting: a comma-separated
+// list of CIDRs or single addresses. An empty list allows every address.
+func parseAdminAllowlist(value string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid address %q in admin_allowed_cidrs", entry)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q in admin_allowed_cidrs", entry)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// allowlistContains reports whether ip is in one of networks, or networks is empty.
+func allowlistContains(networks []*net.IPNet, ip net.IP) bool {
+	if len(networks) == 0 {
+		return true
+	}
+	if ip == nil {
+		return false
+	}
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// adminClientIP returns the address admin requests are checked against. The
+// forwarded client IP is only used when trusted proxies are configured, since
+// otherwise any client could set X-Forwarded-For to an allowed address.
+func (s *Server) adminClientIP(c *gin.Context) net.IP {
+	if len(s.config.Server.TrustedProxies) > 0 {
+		return net.ParseIP(c.ClientIP())
+	}
+	return net.ParseIP(c.RemoteIP())
+}
+
+// adminAllowlistTTL bounds how long the cached admin allowlist is used, and so
+// how long a change saved through another replica takes to apply.
+const adminAllowlistTTL = 30 * time.Second
+
+// errAdminAllowlistUnavailable wraps failures to read the admin allowlist. Admin
+// access is denied until it can be read, rather than treating it as unset.
+var errAdminAllowlistUnavailable = errors.New("admin allowlist is unavailable")
+
+// adminAllowlistCache holds the parsed admin_allowed_cidrs setting, so admin
+// requests don't each read it from the database. Saving the setting through
+// this process invalidates it.
+type adminAllowlistCache struct {
+	mu      sync.Mutex
+	entry   adminAllowlistEntry
+	expires time.Time
+}
+
+type adminAllowlistEntry struct {
+	networks []*net.IPNet
+	err      error // The setting doesn't parse
+}
+
+func (c *adminAllowlistCache) get(now time.Time) (adminAllowlistEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !now.Before(c.expires) {
+		return adminAllowlistEntry{}, false
+	}
+	return c.entry, true
+}
+
+func (c *adminAllowlistCache) put(entry adminAllowlistEntry, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entry, c.expires = entry, now.Add(adminAllowlistTTL)
+}
+
+func (c *adminAllowlistCache) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entry, c.expires = adminAllowlistEntry{}, time.Time{}
+}
+
+// adminAllowlist returns the admin networks from settings; none when the setting
+// was never saved. A setting that doesn't parse allows nothing, since it can only
+// get there by editing the database. Failures to read it are wrapped in
+// errAdminAllowlistUnavailable.
+func (s *Server) adminAllowlist(ctx context.Context) ([]*net.IPNet, error) {
+	now := time.Now()
+	if entry, ok := s.adminNetworks.get(now); ok {
+		return entry.networks, entry.err
+	}
+	var value string
+	setting, err := s.settingsStore.Get(ctx, db.SettingAdminAllowedCIDRs)
+	switch {
+	case err == nil:
+		value = setting.Value
+	case !errors.Is(err, pgx.ErrNoRows):
+		return nil, fmt.Errorf("%w: %v", errAdminAllowlistUnavailable, err)
+	}
+	networks, err := parseAdminAllowlist(value)
+	s.adminNetworks.put(adminAllowlistEntry{networks: networks, err: err}, now)
+	return networks, err
+}
+
+// requireAdminNetwork rejects admin API requests from addresses outside the
+// admin_allowed_cidrs setting, when it is set.
+func (s *Server) requireAdminNetwork() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		networks, err := s.adminAllowlist(c.Request.Context())
+		if errors.Is(err, errAdminAllowlistUnavailable) {
+			s.logger.Error("Failed to read admin allowlist; denying admin access", zap.Error(err))
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "admin access is temporarily unavailable"})
+			return
+		}
+		if err != nil {
+			s.logger.Error("Invalid admin allowlist; denying admin access", zap.Error(err))
+		}
+		ip := s.adminClientIP(c)
+		if err != nil || !allowlistContains(networks, ip) {
+			s.logger.Warn("Admin API request from outside the admin allowlist",
+				zap.String("client_ip", ip.String()),
+				zap.String("path", c.Request.URL.Path))
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "admin access is not allowed from this network"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// checkAdminAllowlistSetting validates a new admin_allowed_cidrs value. The
+// caller's own address must be allowed, so admins can't lock themselves out.
+func (s *Server) checkAdminAllowlistSetting(c *gin.Context, value string) error {
+	networks, err := parseAdminAllowlist(value)
+	if err != nil {
+		return err
+	}
+	if ip := s.adminClientIP(c); !allowlistContains(networks, ip) {
+		return fmt.Errorf("admin_allowed_cidrs must include your current address %s", ip)
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package api
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/gatekey-project/gatekey/internal/config"
+)
+
+func TestAdminAllowlist(t *testing.T) {
+	networks, err := parseAdminAllowlist(" 10.10.0.0/16, 192.0.2.7 ,2001:db8::/32,")
+	if err != nil {
+		t.Fatalf("parseAdminAllowlist() error = %v", err)
+	}
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"10.10.4.2", true},
+		{"10.11.0.1", false},
+		{"192.0.2.7", true},
+		{"192.0.2.8", false},
+		{"2001:db8::1", true},
+		{"::ffff:10.10.0.1", true},
+	}
+	for _, tt := range tests {
+		if got := allowlistContains(networks, net.ParseIP(tt.ip)); got != tt.want {
+			t.Errorf("allowlistContains(%s) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+	if allowlistContains(networks, nil) {
+		t.Error("allowlistContains(nil) = true, want false")
+	}
+
+	if empty, err := parseAdminAllowlist(""); err != nil || !allowlistContains(empty, net.ParseIP("203.0.113.1")) {
+		t.Errorf("empty allowlist doesn't allow everything (err %v)", err)
+	}
+	for _, bad := range []string{"10.0.0.0/33", "not-an-ip", "10.0.0.1/8/2"} {
+		if _, err := parseAdminAllowlist(bad); err == nil {
+			t.Errorf("parseAdminAllowlist(%q) = nil error", bad)
+		}
+	}
+}
+
+func TestAdminAllowlistCache(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	networks, _ := parseAdminAllowlist("10.10.0.0/16")
+	s := &Server{config: &config.Config{}, logger: zap.NewNop(), adminNetworks: &adminAllowlistCache{}}
+	now := time.Now()
+	s.adminNetworks.put(adminAllowlistEntry{networks: networks}, now)
+
+	if entry, ok := s.adminNetworks.get(now.Add(adminAllowlistTTL - time.Second)); !ok || len(entry.networks) != 1 {
+		t.Errorf("get() before expiry = %v, %v", entry, ok)
+	}
+	if _, ok := s.adminNetworks.get(now.Add(adminAllowlistTTL)); ok {
+		t.Error("get() returned an expired allowlist")
+	}
+
+	// The middleware uses the cached allowlist without reading settings
+	router := gin.New()
+	router.GET("/admin", s.requireAdminNetwork(), func(c *gin.Context) { c.Status(http.StatusNoContent) })
+	for ip, want := range map[string]int{"10.10.0.5": http.StatusNoContent, "192.0.2.1": http.StatusForbidden} {
+		req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+		req.RemoteAddr = ip + ":1234"
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code != want {
+			t.Errorf("request from %s: status = %d, want %d", ip, rec.Code, want)
+		}
+	}
+
+	s.adminNetworks.invalidate()
+	if _, ok := s.adminNetworks.get(now); ok {
+		t.Error("get() returned an invalidated allowlist")
+	}
+}
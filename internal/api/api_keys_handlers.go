@@ -15,7 +15,7 @@ import (
 type CreateAPIKeyRequest struct {
 	Name        string   `json:"name" binding:"required"`
 	Description string   `json:"description"`
-	Scopes      []string `json:"scopes"`
+	Scopes      []string `json:"scopes" binding:"max=64"`
 	ExpiresIn   string   `json:"expires_in"` // e.g., "30d", "1y", "never"
 }
 
@@ -23,7 +23,7 @@ type CreateAPIKeyRequest struct {
 type CreateAPIKeyForUserRequest struct {
 	Name        string   `json:"name" binding:"required"`
 	Description string   `json:"description"`
-	Scopes      []string `json:"scopes"`
+	Scopes      []string `json:"scopes" binding:"max=64"`
 	ExpiresIn   string   `json:"expires_in"`
 }
 
@@ -167,8 +167,7 @@ func (s *Server) handleCreateUserAPIKey(c *gin.Context) {
 	}
 
 	var req CreateAPIKeyRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+	if !bindJSON(c, &req) {
 		return
 	}
 
@@ -314,11 +313,10 @@ func (s *Server) handleAdminCreateAPIKey(c *gin.Context) {
 		UserID      string   `json:"user_id" binding:"required"`
 		Name        string   `json:"name" binding:"required"`
 		Description string   `json:"description"`
-		Scopes      []string `json:"scopes"`
+		Scopes      []string `json:"scopes" binding:"max=64"`
 		ExpiresIn   string   `json:"expires_in"`
 	}
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+	if !bindJSON(c, &req) {
 		return
 	}
 
@@ -456,8 +454,7 @@ func (s *Server) handleAdminCreateUserAPIKey(c *gin.Context) {
 	userID := c.Param("id")
 
 	var req CreateAPIKeyForUserRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+	if !bindJSON(c, &req) {
 		return
 	}
 
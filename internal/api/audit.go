@@ -0,0 +1,263 @@
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/gatekey-project/gatekey/internal/db"
+	"github.com/gatekey-project/gatekey/internal/pki"
+)
+
+// recordAudit appends an admin action to the audit chain. Failures are logged but
+// never fail the request that triggered them.
+func (s *Server) recordAudit(c *gin.Context, event, resourceType, resourceID string, details gin.H) {
+	if !s.config.Audit.Enabled {
+		return
+	}
+
+	entry := &db.AuditEntry{
+		Event:        event,
+		ActorIP:      c.ClientIP(),
+		ResourceType: resourceType,
+		ResourceID:   resourceID,
+		Success:      true,
+	}
+	if user, err := s.getAuthenticatedUser(c); err == nil {
+		entry.ActorID = user.UserID
+		entry.ActorEmail = user.Email
+	}
+	// Link changes applied through the approval queue to the approved change
+	if changeID, ok := c.Request.Context().Value(approvedChangeKey{}).(string); ok {
+		if details == nil {
+			details = gin.H{}
+		}
+		details["changeId"] = changeID
+	}
+	if details != nil {
+		if raw, err := json.Marshal(details); err == nil {
+			entry.Details = raw
+		}
+	}
+
+	if err := s.auditStore.Create(c.Request.Context(), entry); err != nil {
+		s.logger.Error("Failed to record audit event", zap.String("event", event), zap.Error(err))
+	}
+}
+
+// recordSystemAudit appends an action GateKey took on its own, such as a
+// background job's, to the audit chain with "system" as the actor.
+func (s *Server) recordSystemAudit(ctx context.Context, event, resourceType, resourceID string, details gin.H) {
+	if !s.config.Audit.Enabled {
+		return
+	}
+
+	entry := &db.AuditEntry{
+		Event:        event,
+		ActorEmail:   "system",
+		ResourceType: resourceType,
+		ResourceID:   resourceID,
+		Success:      true,
+	}
+	if details != nil {
+		if raw, err := json.Marshal(details); err == nil {
+			entry.Details = raw
+		}
+	}
+
+	if err := s.auditStore.Create(ctx, entry); err != nil {
+		s.logger.Error("Failed to record audit event", zap.String("event", event), zap.Error(err))
+	}
+}
+
+func (s *Server) handleGetAuditLogs(c *gin.Context) {
+	filter := &db.AuditFilter{
+		Event:        c.Query("event"),
+		ActorEmail:   c.Query("actor"),
+		ResourceType: c.Query("resource_type"),
+		Limit:        50,
+	}
+	filter.StartTime, filter.EndTime = timeRangeFromQuery(c)
+	if limitStr := c.Query("limit"); limitStr != "" {
+		if limit, err := strconv.Atoi(limitStr); err == nil && limit > 0 && limit <= 500 {
+			filter.Limit = limit
+		}
+	}
+	if offsetStr := c.Query("offset"); offsetStr != "" {
+		if offset, err := strconv.Atoi(offsetStr); err == nil && offset >= 0 {
+			filter.Offset = offset
+		}
+	}
+
+	entries, total, err := s.auditStore.List(c.Request.Context(), filter)
+	if err != nil {
+		s.logger.Error("Failed to list audit logs", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list audit logs"})
+		return
+	}
+
+	if entries == nil {
+		entries = []*db.AuditEntry{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"logs":   entries,
+		"total":  total,
+		"limit":  filter.Limit,
+		"offset": filter.Offset,
+	})
+}
+
+// auditAnchorResult reports whether a signed anchor still matches the chain.
+type auditAnchorResult struct {
+	*db.AuditAnchor
+	Status string `json:"status"` // ok, hash_mismatch, or signature_invalid
+}
+
+// handleVerifyAuditChain recomputes the audit chain over a range given as from_seq
+// and to_seq, or start and end (RFC3339); with no range the whole chain is checked.
+// Signed anchors in the range are checked against the stored hashes, which also
+// catches records deleted from the end of the chain.
+func (s *Server) handleVerifyAuditChain(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	fromSeq, _ := strconv.ParseInt(c.Query("from_seq"), 10, 64)
+	toSeq, _ := strconv.ParseInt(c.Query("to_seq"), 10, 64)
+	if start, end := timeRangeFromQuery(c); start != nil || end != nil {
+		first, last, err := s.auditStore.SeqRange(ctx, start, end)
+		if err != nil {
+			s.logger.Error("Failed to resolve audit range", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to verify audit chain"})
+			return
+		}
+		if last == 0 {
+			c.JSON(http.StatusOK, gin.H{"report": db.AuditChainReport{Valid: true}, "anchors": []auditAnchorResult{}})
+			return
+		}
+		fromSeq, toSeq = first, last
+	}
+
+	report, err := s.auditStore.VerifyChain(ctx, fromSeq, toSeq)
+	if err != nil {
+		s.logger.Error("Failed to verify audit chain", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to verify audit chain"})
+		return
+	}
+
+	anchors, err := s.auditStore.ListAnchors(ctx, fromSeq, toSeq)
+	if err != nil {
+		s.logger.Error("Failed to list audit anchors", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to verify audit chain"})
+		return
+	}
+
+	results := make([]auditAnchorResult, 0, len(anchors))
+	for _, anchor := range anchors {
+		result := auditAnchorResult{AuditAnchor: anchor, Status: "ok"}
+		stored, err := s.auditStore.HashAt(ctx, anchor.Seq)
+		if err != nil {
+			s.logger.Error("Failed to read anchored audit record", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to verify audit chain"})
+			return
+		}
+		switch {
+		case stored != anchor.Hash:
+			// The anchored record was changed or deleted since it was signed
+			result.Status = "hash_mismatch"
+			if report.Valid {
+				report.Valid = false
+				report.BrokenAt = anchor.Seq
+				report.Reason = "record no longer matches its signed anchor"
+			}
+		case !s.verifyAuditAnchor(anchor):
+			// Not fatal on its own: anchors signed before a CA rotation no longer
+			// verify against the current CA
+			result.Status = "signature_invalid"
+		}
+		results = append(results, result)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"report": report, "anchors": results})
+}
+
+// auditAnchorPayload is the message signed for an anchor.
+func auditAnchorPayload(seq int64, hash string) []byte {
+	return []byte(fmt.Sprintf("gatekey-audit-anchor:%d:%s", seq, hash))
+}
+
+func (s *Server) verifyAuditAnchor(anchor *db.AuditAnchor) bool {
+	if s.ca == nil {
+		return false
+	}
+	signature, err := base64.StdEncoding.DecodeString(anchor.Signature)
+	if err != nil {
+		return false
+	}
+	return pki.VerifySignature(s.ca.Certificate(), auditAnchorPayload(anchor.Seq, anchor.Hash), signature) == nil
+}
+
+// runAuditAnchoring periodically signs the audit chain head with the CA key
+func (s *Server) runAuditAnchoring(ctx context.Context) {
+	interval := s.config.Audit.AnchorInterval
+	if !s.config.Audit.Enabled || interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	s.logger.Info("Started audit anchoring background task", zap.Duration("interval", interval))
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.logger.Info("Audit anchoring stopped")
+			return
+		case <-ticker.C:
+			s.anchorAuditChain(ctx)
+		}
+	}
+}
+
+// anchorAuditChain signs the current chain head, if it has moved since the last anchor
+func (s *Server) anchorAuditChain(ctx context.Context) {
+	if s.ca == nil {
+		return
+	}
+
+	seq, hash, err := s.auditStore.Head(ctx)
+	if err != nil {
+		s.logger.Error("Failed to read audit chain head", zap.Error(err))
+		return
+	}
+	if seq == 0 {
+		return
+	}
+	latest, err := s.auditStore.LatestAnchor(ctx)
+	if err != nil {
+		s.logger.Error("Failed to read latest audit anchor", zap.Error(err))
+		return
+	}
+	if latest != nil && latest.Seq == seq {
+		return
+	}
+
+	signature, err := s.ca.Sign(auditAnchorPayload(seq, hash))
+	if err != nil {
+		s.logger.Error("Failed to sign audit anchor", zap.Error(err))
+		return
+	}
+	anchor := &db.AuditAnchor{Seq: seq, Hash: hash, Signature: base64.StdEncoding.EncodeToString(signature)}
+	if err := s.auditStore.CreateAnchor(ctx, anchor); err != nil {
+		s.logger.Error("Failed to store audit anchor", zap.Error(err))
+		return
+	}
+	s.logger.Info("Anchored audit chain", zap.Int64("seq", seq), zap.String("hash", hash))
+}
@@ -0,0 +1,286 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/gatekey-project/gatekey/internal/db"
+)
+
+// Change categories that can be configured to need a second admin's approval
+// (policy.require_approval).
+const (
+	changeCategoryAccessRules        = "access_rules"
+	changeCategoryGatewayAssignments = "gateway_assignments"
+)
+
+// maxChangeBodySize caps the request body stored for a pending change.
+const maxChangeBodySize = 1 << 20
+
+// approvedChangeKey marks a request replayed on approval so it isn't queued again.
+type approvedChangeKey struct{}
+
+func (s *Server) approvalRequired(category string) bool {
+	for _, c := range s.config.Policy.RequireApproval {
+		if c == category {
+			return true
+		}
+	}
+	return false
+}
+
+// requireApproval holds requests in a category for a second admin's approval when
+// the category is listed in policy.require_approval. The request is stored as it
+// was sent and replayed through the router once approved, so it goes through the
+// same validation as an immediate change.
+func (s *Server) requireApproval(category string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !s.approvalRequired(category) || c.Request.Context().Value(approvedChangeKey{}) != nil {
+			c.Next()
+			return
+		}
+
+		user, err := s.getAuthenticatedUser(c)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxChangeBodySize+1))
+		if err != nil || len(body) > maxChangeBodySize {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+			return
+		}
+
+		change := &db.PendingChange{
+			Category:         category,
+			Method:           c.Request.Method,
+			Path:             c.Request.URL.RequestURI(),
+			Body:             string(body),
+			RequestedBy:      user.UserID,
+			RequestedByEmail: user.Email,
+		}
+		if err := s.changeStore.Create(c.Request.Context(), change); err != nil {
+			s.logger.Error("Failed to queue change for approval", zap.Error(err))
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to queue change for approval"})
+			return
+		}
+
+		s.recordAudit(c, "change.request", "change", change.ID, gin.H{
+			"category": category,
+			"method":   change.Method,
+			"path":     change.Path,
+		})
+		c.AbortWithStatusJSON(http.StatusAccepted, gin.H{
+			"message":  "change queued for approval by another admin",
+			"changeId": change.ID,
+			"status":   change.Status,
+		})
+	}
+}
+
+func pendingChangeJSON(ch *db.PendingChange) gin.H {
+	result := gin.H{
+		"id":               ch.ID,
+		"category":         ch.Category,
+		"method":           ch.Method,
+		"path":             ch.Path,
+		"body":             ch.Body,
+		"status":           ch.Status,
+		"requestedBy":      ch.RequestedBy,
+		"requestedByEmail": ch.RequestedByEmail,
+		"reviewComment":    ch.ReviewComment,
+		"createdAt":        ch.CreatedAt,
+	}
+	if ch.ReviewedBy != nil {
+		result["reviewedBy"] = *ch.ReviewedBy
+	}
+	if ch.ReviewedByEmail != nil {
+		result["reviewedByEmail"] = *ch.ReviewedByEmail
+	}
+	if ch.ReviewedAt != nil {
+		result["reviewedAt"] = *ch.ReviewedAt
+	}
+	if ch.ResultStatus != nil {
+		result["resultStatus"] = *ch.ResultStatus
+	}
+	if ch.ResultBody != nil {
+		result["resultBody"] = *ch.ResultBody
+	}
+	return result
+}
+
+// handleListChanges returns the approval queue. ?status= filters by status
+// (default pending; "all" for every change).
+func (s *Server) handleListChanges(c *gin.Context) {
+	status := c.DefaultQuery("status", db.ChangeStatusPending)
+	if status == "all" {
+		status = ""
+	}
+	limit := 100
+	if l, err := strconv.Atoi(c.Query("limit")); err == nil && l > 0 && l <= 500 {
+		limit = l
+	}
+
+	changes, err := s.changeStore.List(c.Request.Context(), status, limit)
+	if err != nil {
+		s.logger.Error("Failed to list changes", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list changes"})
+		return
+	}
+
+	result := make([]gin.H, 0, len(changes))
+	for _, ch := range changes {
+		result = append(result, pendingChangeJSON(ch))
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"changes":         result,
+		"requireApproval": s.config.Policy.RequireApproval,
+	})
+}
+
+func (s *Server) handleGetChange(c *gin.Context) {
+	ch, err := s.changeStore.Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		if err == db.ErrChangeNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "change not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get change"})
+		return
+	}
+	c.JSON(http.StatusOK, pendingChangeJSON(ch))
+}
+
+func (s *Server) handleApproveChange(c *gin.Context) {
+	s.reviewChange(c, db.ChangeStatusApproved)
+}
+
+func (s *Server) handleRejectChange(c *gin.Context) {
+	s.reviewChange(c, db.ChangeStatusRejected)
+}
+
+// reviewChange approves or rejects a pending change in the caller's tenant.
+// Approved changes are applied straight away by replaying the original request
+// with the approver's credentials in the tenant it was requested in.
+func (s *Server) reviewChange(c *gin.Context, status string) {
+	id := c.Param("id")
+	ctx := c.Request.Context()
+
+	var req struct {
+		Comment string `json:"comment"`
+	}
+	_ = c.ShouldBindJSON(&req) // The comment is optional
+
+	user, err := s.getAuthenticatedUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		return
+	}
+	if !user.IsAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "admin access required"})
+		return
+	}
+
+	ch, err := s.changeStore.Review(ctx, id, status, user.UserID, user.Email, req.Comment)
+	if err != nil {
+		switch err {
+		case db.ErrChangeNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": "change not found"})
+		case db.ErrChangeNotPending:
+			c.JSON(http.StatusConflict, gin.H{"error": "change has already been reviewed"})
+		case db.ErrSelfApproval:
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		default:
+			s.logger.Error("Failed to review change", zap.Error(err), zap.String("id", id))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to review change"})
+		}
+		return
+	}
+
+	if status == db.ChangeStatusRejected {
+		s.recordAudit(c, "change.reject", "change", ch.ID, gin.H{"requestedBy": ch.RequestedByEmail, "comment": req.Comment})
+		c.JSON(http.StatusOK, pendingChangeJSON(ch))
+		return
+	}
+
+	result := s.applyChange(c, ch)
+	applied := result.status < http.StatusMultipleChoices
+	if err := s.changeStore.SetResult(ctx, ch.ID, applied, result.status, result.body.String()); err != nil {
+		s.logger.Error("Failed to record change result", zap.Error(err), zap.String("id", ch.ID))
+	}
+	s.recordAudit(c, "change.approve", "change", ch.ID, gin.H{
+		"requestedBy":  ch.RequestedByEmail,
+		"path":         ch.Path,
+		"applied":      applied,
+		"resultStatus": result.status,
+	})
+
+	if updated, err := s.changeStore.Get(ctx, ch.ID); err == nil {
+		ch = updated
+	}
+	c.JSON(http.StatusOK, pendingChangeJSON(ch))
+}
+
+// applyChange replays an approved change through the router as the approver, in
+// the tenant the change was requested in.
+func (s *Server) applyChange(c *gin.Context, ch *db.PendingChange) *changeResult {
+	ctx := context.WithValue(c.Request.Context(), approvedChangeKey{}, ch.ID)
+	req, err := http.NewRequestWithContext(ctx, ch.Method, ch.Path, bytes.NewReader([]byte(ch.Body)))
+	result := &changeResult{header: http.Header{}, status: http.StatusOK}
+	if err != nil {
+		result.status = http.StatusInternalServerError
+		result.body.WriteString(err.Error())
+		return result
+	}
+	for _, header := range []string{"Cookie", "Authorization", "X-Forwarded-For", "X-Real-IP", "User-Agent"} {
+		if v := c.GetHeader(header); v != "" {
+			req.Header.Set(header, v)
+		}
+	}
+	// Review only matches changes in the approver's tenant, so an approver acting
+	// in their own tenant is already in the requester's. Only platform admins can
+	// act in another tenant, and for them the header names the requester's.
+	if c.GetHeader(tenantHeader) != "" {
+		req.Header.Set(tenantHeader, ch.TenantID)
+	}
+	if ch.Body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.RemoteAddr = c.Request.RemoteAddr
+
+	s.router.ServeHTTP(result, req)
+	return result
+}
+
+// changeResult is the http.ResponseWriter an approved change is replayed into,
+// keeping the status and body to record as the change's result.
+type changeResult struct {
+	header      http.Header
+	status      int
+	body        bytes.Buffer
+	wroteHeader bool
+}
+
+func (r *changeResult) Header() http.Header {
+	return r.header
+}
+
+func (r *changeResult) WriteHeader(status int) {
+	if r.wroteHeader {
+		return
+	}
+	r.wroteHeader = true
+	r.status = status
+}
+
+func (r *changeResult) Write(b []byte) (int, error) {
+	r.WriteHeader(http.StatusOK)
+	return r.body.Write(b)
+}
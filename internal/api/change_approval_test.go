@@ -0,0 +1,87 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/gatekey-project/gatekey/internal/config"
+	"github.com/gatekey-project/gatekey/internal/db"
+)
+
+// TestRequireApprovalPassThrough checks that requests go straight to the handler
+// when their category doesn't need approval, and when they are an approved replay.
+func TestRequireApprovalPassThrough(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{Policy: config.PolicyConfig{RequireApproval: []string{changeCategoryAccessRules}}}
+	s := &Server{config: cfg, logger: zap.NewNop()}
+
+	router := gin.New()
+	ok := func(c *gin.Context) { c.Status(http.StatusNoContent) }
+	router.POST("/rules", s.requireApproval(changeCategoryAccessRules), ok)
+	router.POST("/assignments", s.requireApproval(changeCategoryGatewayAssignments), ok)
+
+	tests := []struct {
+		name     string
+		path     string
+		approved bool
+		want     int
+	}{
+		{"category not configured", "/assignments", false, http.StatusNoContent},
+		{"approved replay", "/rules", true, http.StatusNoContent},
+		// No session, so the change can't be attributed to anyone
+		{"needs approval", "/rules", false, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		ctx := context.Background()
+		if tt.approved {
+			ctx = context.WithValue(ctx, approvedChangeKey{}, "change-id")
+		}
+		req := httptest.NewRequest(http.MethodPost, tt.path, nil).WithContext(ctx)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, rec.Code, tt.want)
+		}
+	}
+}
+
+// TestApplyChangeTenant checks that approved changes are replayed in the tenant
+// they were requested in, naming it only for approvers acting in another tenant.
+func TestApplyChangeTenant(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	s := &Server{config: &config.Config{}, logger: zap.NewNop(), router: gin.New()}
+	var gotTenant string
+	s.router.POST("/rules", func(c *gin.Context) {
+		gotTenant = c.GetHeader(tenantHeader)
+		c.Status(http.StatusNoContent)
+	})
+	ch := &db.PendingChange{ID: "change-id", Method: http.MethodPost, Path: "/rules", TenantID: "tenant-b"}
+
+	tests := []struct {
+		name     string
+		approver string // The approver's tenant header
+		want     string
+	}{
+		{"approver in own tenant", "", ""},
+		{"platform admin in another tenant", "tenant-b-slug", "tenant-b"},
+	}
+	for _, tt := range tests {
+		gotTenant = "unset"
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodPost, "/changes/change-id/approve", nil)
+		if tt.approver != "" {
+			c.Request.Header.Set(tenantHeader, tt.approver)
+		}
+		if result := s.applyChange(c, ch); result.status != http.StatusNoContent {
+			t.Fatalf("%s: status = %d", tt.name, result.status)
+		}
+		if gotTenant != tt.want {
+			t.Errorf("%s: replayed tenant = %q, want %q", tt.name, gotTenant, tt.want)
+		}
+	}
+}
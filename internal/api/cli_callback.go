@@ -0,0 +1,118 @@
+package api
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/gatekey-project/gatekey/internal/db"
+)
+
+// cliExchangeCodeTTL is how long the CLI has to exchange a login code for its
+// session token.
+const cliExchangeCodeTTL = 60 * time.Second
+
+var errInvalidCLICallback = errors.New("invalid CLI callback URL")
+
+// validateCLICallback checks a callback URL the CLI asked to be sent back to after
+// login. The server redirects there with a code for the session token, so only
+// the CLI's own loopback listener is accepted, plus any hosts listed in
+// auth.cli_callback_hosts, which must use https. Anything else would let a
+// crafted login link hand a user's session to another host.
+func validateCLICallback(raw string, allowedHosts []string) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Opaque != "" || u.User != nil || u.Fragment != "" || u.RawQuery != "" {
+		return errInvalidCLICallback
+	}
+
+	host := u.Hostname()
+	switch {
+	case isLoopbackHost(host):
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return errInvalidCLICallback
+		}
+		return nil
+	case u.Scheme == "https" && host != "":
+		for _, allowed := range allowedHosts {
+			if strings.EqualFold(host, allowed) {
+				return nil
+			}
+		}
+	}
+	return errInvalidCLICallback
+}
+
+// isLoopbackHost reports whether host is localhost or a loopback IP address.
+func isLoopbackHost(host string) bool {
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// postLoginRedirect returns where browsers go after a web login.
+func (s *Server) postLoginRedirect() string {
+	if s.config.Auth.PostLoginRedirect == "" {
+		return "/"
+	}
+	return s.config.Auth.PostLoginRedirect
+}
+
+// redirectToCLI sends the browser back to the CLI's callback with a single-use
+// exchange code rather than the session token, so the token never appears in
+// browser history, proxy logs or Referer headers. The CLI exchanges the code
+// with POST /api/v1/auth/cli/exchange.
+func (s *Server) redirectToCLI(c *gin.Context, callbackURL, sessionToken string) {
+	code, err := generateState()
+	if err == nil {
+		err = s.stateStore.SaveCLIExchangeCode(c.Request.Context(), code, sessionToken, time.Now().Add(cliExchangeCodeTTL))
+	}
+	if err != nil {
+		s.logger.Error("Failed to create CLI exchange code", zap.Error(err))
+		c.Redirect(http.StatusFound, callbackURL+"?error=server_error&error_description="+url.QueryEscape("failed to complete login"))
+		return
+	}
+	c.Redirect(http.StatusFound, callbackURL+"?code="+url.QueryEscape(code))
+}
+
+// handleCLIExchange exchanges a code from a CLI login redirect for the session
+// token. Codes are single-use and expire after cliExchangeCodeTTL.
+func (s *Server) handleCLIExchange(c *gin.Context) {
+	var req struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	ctx := c.Request.Context()
+	token, err := s.stateStore.RedeemCLIExchangeCode(ctx, req.Code)
+	if err != nil {
+		if err != db.ErrExchangeCodeInvalid {
+			s.logger.Error("Failed to redeem CLI exchange code", zap.Error(err))
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired code"})
+		return
+	}
+
+	session, err := s.stateStore.GetSSOSession(ctx, token)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "session expired"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"token":      session.Token,
+		"email":      session.Email,
+		"name":       session.Name,
+		"is_admin":   session.IsAdmin,
+		"expires_in": int(time.Until(session.ExpiresAt).Seconds()),
+	})
+}
@@ -0,0 +1,28 @@
+package api
+
+import "testing"
+
+func TestValidateCLICallback(t *testing.T) {
+	allowed := []string{"cli.example.com"}
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{"http://127.0.0.1:53124/callback", true},
+		{"http://localhost:53124/callback", true},
+		{"http://[::1]:53124/callback", true},
+		{"https://cli.example.com/callback", true},
+		{"http://cli.example.com/callback", false}, // Allowed hosts need https
+		{"https://evil.example.com/callback", false},
+		{"http://127.0.0.1.evil.example.com/callback", false},
+		{"http://user@127.0.0.1:53124/callback", false},
+		{"http://127.0.0.1:53124/callback?next=x", false},
+		{"javascript:alert(1)", false},
+		{"//evil.example.com/callback", false},
+	}
+	for _, tt := range tests {
+		if got := validateCLICallback(tt.url, allowed) == nil; got != tt.want {
+			t.Errorf("validateCLICallback(%q) allowed = %v, want %v", tt.url, got, tt.want)
+		}
+	}
+}
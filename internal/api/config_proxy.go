@@ -0,0 +1,61 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/gatekey-project/gatekey/internal/openvpn"
+)
+
+// gatewayConfigProxy checks requests forwarded by a gateway's config proxy. Such
+// requests carry the gateway token, must be one of the allowlisted config
+// endpoints, and may only generate configs for the forwarding gateway. The user's
+// own credentials are still checked by the handler, so a proxied request can't do
+// more than the user could directly. Requests without the header pass through.
+func (s *Server) gatewayConfigProxy() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := c.GetHeader(openvpn.GatewayProxyHeader)
+		if token == "" {
+			c.Next()
+			return
+		}
+
+		if !openvpn.ConfigProxyAllowed(c.Request.Method, c.Request.URL.Path) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "endpoint not available through gateway proxy"})
+			return
+		}
+
+		gateway, err := s.gatewayStore.GetGatewayByToken(c.Request.Context(), token)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid gateway token"})
+			return
+		}
+
+		if c.Request.Method == http.MethodPost && c.Request.URL.Path == openvpn.ConfigProxyGeneratePath {
+			body, err := io.ReadAll(io.LimitReader(c.Request.Body, 64<<10))
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+				return
+			}
+			var req struct {
+				GatewayID string `json:"gateway_id"`
+			}
+			if err := json.Unmarshal(body, &req); err != nil || req.GatewayID != gateway.ID {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "gateway proxy can only generate configs for its own gateway"})
+				return
+			}
+			c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		}
+
+		s.logger.Info("Config request proxied by gateway",
+			zap.String("gateway", gateway.Name),
+			zap.String("method", c.Request.Method),
+			zap.String("path", c.Request.URL.Path))
+		c.Next()
+	}
+}
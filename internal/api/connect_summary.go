@@ -0,0 +1,120 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/gatekey-project/gatekey/internal/db"
+)
+
+// The gateway agent, not the client, calls handleGatewayConnect, so the CLI
+// can't see what was pushed to it. After starting OpenVPN it asks for a
+// summary of the connection instead and prints it, so users know what they
+// can now reach.
+
+// maxConnectMessageLength caps the admin-configured connect message.
+const maxConnectMessageLength = 500
+
+// pushedDNSServers returns the DNS servers pushed to a gateway's clients, if it
+// pushes DNS. Without configured servers, public resolvers are pushed.
+func pushedDNSServers(gw *db.Gateway) []string {
+	if !gw.PushDNS {
+		return nil
+	}
+	if len(gw.DNSServers) > 0 {
+		return gw.DNSServers
+	}
+	return []string{"1.1.1.1", "8.8.8.8"}
+}
+
+// connectPushOptions returns the custom push options for a client: the
+// gateway's, then those of the user's active rules on it, each once.
+func connectPushOptions(gw *db.Gateway, rules []*db.AccessRule) []string {
+	seen := make(map[string]bool)
+	var options []string
+	add := func(opts []string) {
+		for _, opt := range opts {
+			if !seen[opt] {
+				seen[opt] = true
+				options = append(options, opt)
+			}
+		}
+	}
+	add(gw.PushOptions)
+	for _, rule := range rules {
+		if rule.IsActive {
+			add(rule.PushOptions)
+		}
+	}
+	return options
+}
+
+// reachableSummary lists the distinct destinations in reachable targets, in
+// order, e.g. "10.1.0.0/16" and "db.internal".
+func reachableSummary(targets []reachableTarget) []string {
+	seen := make(map[string]bool, len(targets))
+	values := make([]string, 0, len(targets))
+	for _, t := range targets {
+		if !seen[t.Value] {
+			seen[t.Value] = true
+			values = append(values, t.Value)
+		}
+	}
+	return values
+}
+
+// handleGetConnectSummary returns what a connection to a gateway gives the
+// authenticated user: the VPN IP of their connection once the gateway has
+// reported it, the tunnel mode, what they can reach, the DNS servers pushed
+// and the admin's connect message.
+//
+// since (RFC 3339) ignores connections that started earlier, such as the same
+// user's on another device; tunnel_mode is the mode the config asked for,
+// used until the connection is reported.
+func (s *Server) handleGetConnectSummary(c *gin.Context) {
+	gateway, targets, ok := s.userReachableTargets(c)
+	if !ok {
+		return
+	}
+	ctx := c.Request.Context()
+	userID, _, err := s.getCurrentUserInfo(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	tunnelMode := connectTunnelMode(gateway, c.Query("tunnel_mode"))
+	vpnIP := ""
+	active := true
+	filter := &db.ConnectionFilter{GatewayID: gateway.ID, UserID: userID, Active: &active, Limit: 1}
+	if since, err := time.Parse(time.RFC3339, c.Query("since")); err == nil {
+		filter.StartTime = &since
+	}
+	connections, _, err := s.connectionStore.List(ctx, filter)
+	if err != nil {
+		s.logger.Warn("Failed to look up connection for connect summary", zap.Error(err))
+	} else if len(connections) > 0 {
+		vpnIP = connections[0].VPNIPv4
+		if connections[0].TunnelMode != "" {
+			tunnelMode = connections[0].TunnelMode
+		}
+	}
+
+	message := ""
+	if setting, err := s.settingsStore.Get(ctx, db.SettingConnectMessage); err == nil {
+		message = setting.Value
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"gatewayId":   gateway.ID,
+		"gatewayName": gateway.Name,
+		"vpnIp":       vpnIP,
+		"tunnelMode":  tunnelMode,
+		"reachable":   reachableSummary(targets),
+		"dnsServers":  append([]string{}, pushedDNSServers(gateway)...),
+		"message":     message,
+	})
+}
@@ -0,0 +1,24 @@
+package api
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/gatekey-project/gatekey/internal/db"
+)
+
+func TestConnectPushOptions(t *testing.T) {
+	gw := &db.Gateway{PushOptions: []string{"block-outside-dns"}}
+	rules := []*db.AccessRule{
+		{IsActive: true, PushOptions: []string{"dhcp-option DOMAIN corp.example.com", "block-outside-dns"}},
+		{IsActive: false, PushOptions: []string{"register-dns"}},
+		{IsActive: true},
+	}
+	want := []string{"block-outside-dns", "dhcp-option DOMAIN corp.example.com"}
+	if got := connectPushOptions(gw, rules); !slices.Equal(got, want) {
+		t.Errorf("connectPushOptions() = %v, want %v", got, want)
+	}
+	if got := connectPushOptions(&db.Gateway{}, nil); len(got) != 0 {
+		t.Errorf("connectPushOptions() with none set = %v, want none", got)
+	}
+}
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gatekey-project/gatekey/internal/db"
+	"github.com/gatekey-project/gatekey/internal/policy"
+)
+
+// cryptoProfileStrength orders crypto profiles from least to most restrictive.
+var cryptoProfileStrength = map[string]int{
+	db.CryptoProfileCompatible: 0,
+	db.CryptoProfileModern:     1,
+	db.CryptoProfileFIPS:       2,
+}
+
+// stricterCryptoProfile returns whichever of two profiles is more restrictive.
+// An empty or unknown profile never wins.
+func stricterCryptoProfile(a, b string) string {
+	sa, okA := cryptoProfileStrength[a]
+	sb, okB := cryptoProfileStrength[b]
+	if !okB || (okA && sa >= sb) {
+		return a
+	}
+	return b
+}
+
+// gatewayCryptoProfile returns the crypto profile a gateway's server and client
+// configs use: its configured profile, raised to its minimum if that is stricter.
+func gatewayCryptoProfile(gw *db.Gateway) string {
+	profile := gw.CryptoProfile
+	if profile == "" {
+		profile = db.CryptoProfileModern
+	}
+	return stricterCryptoProfile(profile, gw.MinCryptoProfile)
+}
+
+// validateGatewayCryptoProfiles checks a gateway's crypto profile against its
+// per-gateway minimum. The minimum must itself be allowed by system policy, and
+// the profile may not be weaker than it.
+func (s *Server) validateGatewayCryptoProfiles(ctx context.Context, profile, minProfile string) error {
+	if minProfile == "" {
+		return nil
+	}
+	if _, ok := cryptoProfileStrength[minProfile]; !ok {
+		return fmt.Errorf("invalid min_crypto_profile: must be 'modern', 'fips', or 'compatible'")
+	}
+	if err := s.validateCryptoProfileAllowed(ctx, minProfile); err != nil {
+		return err
+	}
+	if stricterCryptoProfile(profile, minProfile) != profile {
+		return fmt.Errorf("crypto profile '%s' is weaker than this gateway's minimum '%s'", profile, minProfile)
+	}
+	return nil
+}
+
+// requiredCryptoProfile returns the strictest crypto profile the constraints
+// require, or "" if they don't require one.
+func requiredCryptoProfile(constraints policy.Constraints) string {
+	required := ""
+	for _, profile := range constraints.CryptoProfiles {
+		required = stricterCryptoProfile(required, profile)
+	}
+	return required
+}
+
+// meetsCryptoProfile reports whether a gateway's crypto profile is at least as
+// strict as the one required.
+func meetsCryptoProfile(profile, required string) bool {
+	return required == "" || stricterCryptoProfile(profile, required) == profile
+}
@@ -0,0 +1,44 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/gatekey-project/gatekey/internal/db"
+	"github.com/gatekey-project/gatekey/internal/policy"
+)
+
+func TestGatewayCryptoProfile(t *testing.T) {
+	tests := []struct {
+		profile, min, want string
+	}{
+		{db.CryptoProfileModern, "", db.CryptoProfileModern},
+		{"", "", db.CryptoProfileModern},
+		{db.CryptoProfileCompatible, db.CryptoProfileModern, db.CryptoProfileModern},
+		{db.CryptoProfileModern, db.CryptoProfileFIPS, db.CryptoProfileFIPS},
+		{db.CryptoProfileFIPS, db.CryptoProfileModern, db.CryptoProfileFIPS},
+		{db.CryptoProfileModern, "bogus", db.CryptoProfileModern},
+	}
+	for _, tt := range tests {
+		gw := &db.Gateway{CryptoProfile: tt.profile, MinCryptoProfile: tt.min}
+		if got := gatewayCryptoProfile(gw); got != tt.want {
+			t.Errorf("gatewayCryptoProfile(%q, min %q) = %q, want %q", tt.profile, tt.min, got, tt.want)
+		}
+	}
+}
+
+func TestPolicyCryptoProfile(t *testing.T) {
+	constraints := policy.Constraints{CryptoProfiles: []string{db.CryptoProfileModern, db.CryptoProfileFIPS, db.CryptoProfileCompatible}}
+	required := requiredCryptoProfile(constraints)
+	if required != db.CryptoProfileFIPS {
+		t.Fatalf("requiredCryptoProfile() = %q, want fips", required)
+	}
+	if meetsCryptoProfile(db.CryptoProfileModern, required) {
+		t.Error("modern gateway meets a fips requirement")
+	}
+	if !meetsCryptoProfile(db.CryptoProfileFIPS, required) {
+		t.Error("fips gateway doesn't meet a fips requirement")
+	}
+	if !meetsCryptoProfile(db.CryptoProfileCompatible, requiredCryptoProfile(policy.Constraints{})) {
+		t.Error("gateway doesn't meet an empty requirement")
+	}
+}
@@ -0,0 +1,235 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/gatekey-project/gatekey/internal/db"
+)
+
+// defaultDeletedRetentionDays is how long deleted items can be restored when the
+// setting hasn't been changed.
+const defaultDeletedRetentionDays = 30
+
+// deletedRetention returns the restore window in days (0 keeps deleted items
+// forever) and the earliest deletion time that can still be restored.
+func (s *Server) deletedRetention(ctx context.Context) (int, time.Time) {
+	days := s.settingsStore.GetInt(ctx, db.SettingDeletedRetentionDays, defaultDeletedRetentionDays)
+	if days <= 0 {
+		return 0, time.Time{}
+	}
+	return days, time.Now().AddDate(0, 0, -days)
+}
+
+// handleListDeleted lists soft-deleted gateways, networks and local users that
+// can still be restored. ?type=gateway|network|local_user narrows the list.
+func (s *Server) handleListDeleted(c *gin.Context) {
+	ctx := c.Request.Context()
+	itemType := c.Query("type")
+	days, since := s.deletedRetention(ctx)
+
+	var items []*db.DeletedItem
+	listers := []struct {
+		itemType string
+		list     func(context.Context, time.Time) ([]*db.DeletedItem, error)
+	}{
+		{db.DeletedTypeGateway, s.gatewayStore.ListDeletedGateways},
+		{db.DeletedTypeNetwork, s.networkStore.ListDeletedNetworks},
+		{db.DeletedTypeLocalUser, s.userStore.ListDeletedLocalUsers},
+	}
+	known := false
+	for _, l := range listers {
+		if itemType != "" && itemType != l.itemType {
+			continue
+		}
+		known = true
+		found, err := l.list(ctx, since)
+		if err != nil {
+			s.logger.Error("Failed to list deleted items", zap.String("type", l.itemType), zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list deleted items"})
+			return
+		}
+		items = append(items, found...)
+	}
+	if !known {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "type must be gateway, network or local_user"})
+		return
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].DeletedAt.After(items[j].DeletedAt) })
+
+	result := make([]gin.H, 0, len(items))
+	for _, item := range items {
+		entry := gin.H{
+			"type":      item.Type,
+			"id":        item.ID,
+			"name":      item.Name,
+			"deletedAt": item.DeletedAt,
+		}
+		if days > 0 {
+			entry["purgeAt"] = item.DeletedAt.AddDate(0, 0, days)
+		}
+		result = append(result, entry)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"items":         result,
+		"retentionDays": days,
+	})
+}
+
+func (s *Server) handleRestoreGateway(c *gin.Context) {
+	gatewayID := c.Param("id")
+	ctx := c.Request.Context()
+	_, since := s.deletedRetention(ctx)
+
+	if err := s.gatewayStore.RestoreGateway(ctx, gatewayID, since); err != nil {
+		switch err {
+		case db.ErrGatewayNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": "deleted gateway not found"})
+		case db.ErrGatewayExists:
+			c.JSON(http.StatusConflict, gin.H{"error": "a gateway with this name already exists"})
+		default:
+			s.logger.Error("Failed to restore gateway", zap.Error(err), zap.String("id", gatewayID))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to restore gateway"})
+		}
+		return
+	}
+
+	s.recordAudit(c, "gateway.restore", "gateway", gatewayID, nil)
+	s.logger.Info("Gateway restored", zap.String("id", gatewayID))
+	c.JSON(http.StatusOK, gin.H{"message": "gateway restored successfully"})
+}
+
+func (s *Server) handleRestoreNetwork(c *gin.Context) {
+	id := c.Param("id")
+	ctx := c.Request.Context()
+	_, since := s.deletedRetention(ctx)
+
+	if err := s.networkStore.RestoreNetwork(ctx, id, since); err != nil {
+		switch err {
+		case db.ErrNetworkNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": "deleted network not found"})
+		case db.ErrNetworkExists:
+			c.JSON(http.StatusConflict, gin.H{"error": "a network with this name already exists"})
+		default:
+			s.logger.Error("Failed to restore network", zap.Error(err), zap.String("id", id))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to restore network"})
+		}
+		return
+	}
+
+	s.recordAudit(c, "network.restore", "network", id, nil)
+	c.JSON(http.StatusOK, gin.H{"message": "network restored successfully"})
+}
+
+func (s *Server) handleRestoreLocalUser(c *gin.Context) {
+	userID := c.Param("id")
+	ctx := c.Request.Context()
+	_, since := s.deletedRetention(ctx)
+
+	if err := s.userStore.RestoreLocalUser(ctx, userID, since); err != nil {
+		switch err {
+		case db.ErrUserNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": "deleted user not found"})
+		case db.ErrUserExists:
+			c.JSON(http.StatusConflict, gin.H{"error": "a user with this username already exists"})
+		default:
+			s.logger.Error("Failed to restore local user", zap.Error(err), zap.String("id", userID))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to restore user"})
+		}
+		return
+	}
+
+	s.recordAudit(c, "local_user.restore", "local_user", userID, nil)
+	c.JSON(http.StatusOK, gin.H{"message": "user restored successfully"})
+}
+
+func (s *Server) handleGetDeletedRetention(c *gin.Context) {
+	days, _ := s.deletedRetention(c.Request.Context())
+	c.JSON(http.StatusOK, gin.H{
+		"retention_days": days,
+	})
+}
+
+func (s *Server) handleSetDeletedRetention(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var req struct {
+		RetentionDays int `json:"retention_days"`
+	}
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	// 0 = keep deleted items forever, otherwise 1-365
+	if req.RetentionDays < 0 || req.RetentionDays > 365 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "retention_days must be between 0 and 365 (0 = forever)"})
+		return
+	}
+
+	if err := s.settingsStore.Set(ctx, db.SettingDeletedRetentionDays, strconv.Itoa(req.RetentionDays)); err != nil {
+		s.logger.Error("Failed to set deleted item retention", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to set retention"})
+		return
+	}
+
+	s.logger.Info("Deleted item retention updated", zap.Int("days", req.RetentionDays))
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "retention setting updated",
+		"retention_days": req.RetentionDays,
+	})
+}
+
+// runDeletedPurge periodically removes deleted items whose restore window has passed.
+func (s *Server) runDeletedPurge(ctx context.Context) {
+	ticker := time.NewTicker(6 * time.Hour)
+	defer ticker.Stop()
+
+	s.purgeDeleted(ctx)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.purgeDeleted(ctx)
+		}
+	}
+}
+
+// purgeDeleted permanently removes gateways, networks and local users deleted
+// before the retention window.
+func (s *Server) purgeDeleted(ctx context.Context) {
+	days, before := s.deletedRetention(ctx)
+	if days <= 0 {
+		return
+	}
+
+	purges := []struct {
+		itemType string
+		purge    func(context.Context, time.Time) (int64, error)
+	}{
+		{db.DeletedTypeGateway, s.gatewayStore.PurgeDeletedGateways},
+		{db.DeletedTypeNetwork, s.networkStore.PurgeDeletedNetworks},
+		{db.DeletedTypeLocalUser, s.userStore.PurgeDeletedLocalUsers},
+	}
+	for _, p := range purges {
+		count, err := p.purge(ctx, before)
+		if err != nil {
+			s.logger.Error("Failed to purge deleted items", zap.String("type", p.itemType), zap.Error(err))
+			continue
+		}
+		if count > 0 {
+			s.logger.Info("Purged deleted items",
+				zap.String("type", p.itemType),
+				zap.Int64("deleted", count),
+				zap.Int("retention_days", days))
+		}
+	}
+}
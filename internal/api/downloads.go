@@ -0,0 +1,154 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// Binaries are served with their SHA-256 as a strong ETag and in a Digest
+// header, so clients on poor links can resume an interrupted download with a
+// Range request, and caching proxies can revalidate instead of refetching. A
+// binary with a <name>.sha256 file beside it (as sha256sum writes it) is only
+// served if it still matches.
+
+// binaryDigests caches the SHA-256 of each served binary, so it is only
+// recomputed when the file changes.
+type binaryDigests struct {
+	mu      sync.Mutex
+	digests map[string]binaryDigest // path -> digest of the file as last seen
+}
+
+type binaryDigest struct {
+	size    int64
+	modTime time.Time
+	sum     []byte
+}
+
+func newBinaryDigests() *binaryDigests {
+	return &binaryDigests{digests: make(map[string]binaryDigest)}
+}
+
+// sum returns the SHA-256 of an open file, hashing it only if its size or
+// modification time changed since it was last hashed.
+func (b *binaryDigests) sum(path string, f *os.File, info os.FileInfo) ([]byte, error) {
+	b.mu.Lock()
+	d, ok := b.digests[path]
+	b.mu.Unlock()
+	if ok && d.size == info.Size() && d.modTime.Equal(info.ModTime()) {
+		return d.sum, nil
+	}
+
+	h := sha256.New()
+	if _, err := io.Copy(h, io.NewSectionReader(f, 0, info.Size())); err != nil {
+		return nil, err
+	}
+	d = binaryDigest{size: info.Size(), modTime: info.ModTime(), sum: h.Sum(nil)}
+
+	b.mu.Lock()
+	b.digests[path] = d
+	b.mu.Unlock()
+	return d.sum, nil
+}
+
+// expectedBinarySum returns the SHA-256 recorded in the .sha256 file beside a
+// binary, or nil if there is none.
+func expectedBinarySum(path string) ([]byte, error) {
+	data, err := os.ReadFile(path + ".sha256")
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("%s.sha256 is empty", path)
+	}
+	sum, err := hex.DecodeString(fields[0])
+	if err != nil || len(sum) != sha256.Size {
+		return nil, fmt.Errorf("%s.sha256 does not hold a SHA-256 checksum", path)
+	}
+	return sum, nil
+}
+
+// verifiedBinary opens a binary and returns it with its SHA-256, after checking
+// it against its .sha256 file if it has one. The caller closes the file.
+func (s *Server) verifiedBinary(path string) (*os.File, os.FileInfo, []byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	info, sum, err := s.verifyBinary(path, f)
+	if err != nil {
+		f.Close()
+		return nil, nil, nil, err
+	}
+	return f, info, sum, nil
+}
+
+func (s *Server) verifyBinary(path string, f *os.File) (os.FileInfo, []byte, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+	sum, err := s.binaryDigests.sum(path, f, info)
+	if err != nil {
+		return nil, nil, err
+	}
+	expected, err := expectedBinarySum(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if expected != nil && !bytes.Equal(sum, expected) {
+		return nil, nil, fmt.Errorf("checksum %x does not match %s.sha256", sum, path)
+	}
+	return info, sum, nil
+}
+
+// serveBinary serves a binary under the given download name. Range,
+// If-Range, If-None-Match and If-Modified-Since requests are answered by
+// http.ServeContent against the ETag and Last-Modified set here.
+func (s *Server) serveBinary(c *gin.Context, path, filename string) {
+	f, info, sum, err := s.verifiedBinary(path)
+	if err != nil {
+		s.logger.Error("Refusing to serve binary", zap.String("path", path), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "binary could not be verified"})
+		return
+	}
+	defer f.Close()
+
+	h := c.Writer.Header()
+	h.Set("Content-Type", "application/octet-stream")
+	h.Set("Content-Disposition", "attachment; filename="+filename)
+	h.Set("ETag", `"`+hex.EncodeToString(sum)+`"`)
+	h.Set("Digest", "sha-256="+base64.StdEncoding.EncodeToString(sum))
+	h.Set("X-Checksum-Sha256", hex.EncodeToString(sum))
+	h.Set("Cache-Control", "public, no-cache") // Cacheable, but revalidated since binaries change on upgrade
+	http.ServeContent(c.Writer, c.Request, filename, info.ModTime(), f)
+}
+
+// serveBinaryChecksum serves a binary's SHA-256 in sha256sum's format, so
+// install scripts can verify what they downloaded.
+func (s *Server) serveBinaryChecksum(c *gin.Context, path, filename string) {
+	f, _, sum, err := s.verifiedBinary(path)
+	if err != nil {
+		s.logger.Error("Refusing to serve binary checksum", zap.String("path", path), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "binary could not be verified"})
+		return
+	}
+	f.Close()
+	c.String(http.StatusOK, "%x  %s\n", sum, filename)
+}
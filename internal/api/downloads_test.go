@@ -0,0 +1,66 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+func TestServeBinary(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	s := &Server{logger: zap.NewNop(), binaryDigests: newBinaryDigests()}
+	content := []byte("0123456789abcdefghij")
+	sum := sha256.Sum256(content)
+	etag := `"` + hex.EncodeToString(sum[:]) + `"`
+
+	path := filepath.Join(t.TempDir(), "gatekey-linux-amd64")
+	if err := os.WriteFile(path, content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	serve := func(header http.Header) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/downloads/gatekey-linux-amd64", nil)
+		c.Request.Header = header
+		s.serveBinary(c, path, "gatekey-linux-amd64")
+		c.Writer.WriteHeaderNow() // As gin does after the handler returns
+		return w
+	}
+
+	w := serve(http.Header{})
+	if w.Code != http.StatusOK || w.Body.String() != string(content) || w.Header().Get("ETag") != etag ||
+		w.Header().Get("Content-Length") != "20" || w.Header().Get("Last-Modified") == "" {
+		t.Errorf("full download: %d %q, headers %v", w.Code, w.Body.String(), w.Header())
+	}
+
+	w = serve(http.Header{"Range": {"bytes=10-"}, "If-Range": {etag}})
+	if w.Code != http.StatusPartialContent || w.Body.String() != "abcdefghij" {
+		t.Errorf("resumed download: %d %q", w.Code, w.Body.String())
+	}
+
+	w = serve(http.Header{"If-None-Match": {etag}})
+	if w.Code != http.StatusNotModified {
+		t.Errorf("revalidation: %d, want 304", w.Code)
+	}
+
+	if err := os.WriteFile(path+".sha256", []byte(hex.EncodeToString(sum[:])+"  gatekey-linux-amd64\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if w = serve(http.Header{}); w.Code != http.StatusOK {
+		t.Errorf("matching checksum file: %d, want 200", w.Code)
+	}
+	other := sha256.Sum256([]byte("something else"))
+	if err := os.WriteFile(path+".sha256", []byte(hex.EncodeToString(other[:])+"  gatekey-linux-amd64\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if w = serve(http.Header{}); w.Code != http.StatusInternalServerError {
+		t.Errorf("mismatched checksum file: %d, want 500", w.Code)
+	}
+}
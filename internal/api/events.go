@@ -0,0 +1,259 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/gatekey-project/gatekey/internal/db"
+)
+
+// Live event types streamed to the admin UI by /api/v1/events.
+const (
+	eventConnect            = "connection.connect"
+	eventDisconnect         = "connection.disconnect"
+	eventGatewayOnline      = "gateway.online"
+	eventGatewayOffline     = "gateway.offline"
+	eventLoginSuccess       = "login.success"
+	eventLoginFailure       = "login.failure"
+	eventConfigRevoked      = "config.revoked"
+	eventIPPoolLow          = "gateway.ip_pool_low"
+	eventGroupsAnomaly      = "user.groups_anomaly"
+	eventSignInReported     = "login.reported"
+	eventAccessRequested    = "access_request.created"
+	eventUserDeactivated    = "user.deactivated"
+	eventUserReactivated    = "user.reactivated"
+	eventReprovisionFailing = "gateway.reprovision_failing"
+)
+
+const (
+	// eventBacklogSize is how many recent events are kept for clients that
+	// reconnect with Last-Event-ID.
+	eventBacklogSize = 256
+	// eventSubscriberBuffer is how many events may queue for a slow client before
+	// further events are dropped for it.
+	eventSubscriberBuffer = 64
+	// eventKeepalive keeps idle streams from being closed by proxies.
+	eventKeepalive = 25 * time.Second
+)
+
+// liveEvent is an event sent to stream subscribers. UserID, GatewayID and
+// TenantID decide who may see it and aren't sent themselves; Data carries what
+// is shown.
+type liveEvent struct {
+	ID        int64     `json:"id"`
+	Type      string    `json:"type"`
+	Timestamp time.Time `json:"timestamp"`
+	Data      gin.H     `json:"data"`
+	UserID    string    `json:"-"`
+	GatewayID string    `json:"-"`
+	TenantID  string    `json:"-"`
+}
+
+// eventBroker fans events out to stream subscribers and keeps a short backlog.
+type eventBroker struct {
+	mu          sync.Mutex
+	nextID      int64
+	backlog     []*liveEvent
+	subscribers map[chan *liveEvent]struct{}
+	done        chan struct{} // Closed on shutdown to end open streams
+	closeOnce   sync.Once
+}
+
+func newEventBroker() *eventBroker {
+	return &eventBroker{
+		subscribers: make(map[chan *liveEvent]struct{}),
+		done:        make(chan struct{}),
+	}
+}
+
+// close ends all open streams so server shutdown doesn't wait on them.
+func (b *eventBroker) close() {
+	b.closeOnce.Do(func() { close(b.done) })
+}
+
+// publish assigns the event an ID and sends it to every subscriber. Subscribers
+// that aren't keeping up miss the event rather than blocking the caller.
+func (b *eventBroker) publish(ev *liveEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.nextID++
+	ev.ID = b.nextID
+	b.backlog = append(b.backlog, ev)
+	if len(b.backlog) > eventBacklogSize {
+		b.backlog = b.backlog[len(b.backlog)-eventBacklogSize:]
+	}
+	for ch := range b.subscribers {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
+// subscribe returns a channel of new events and the backlog after lastID.
+func (b *eventBroker) subscribe(lastID int64) (chan *liveEvent, []*liveEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ch := make(chan *liveEvent, eventSubscriberBuffer)
+	b.subscribers[ch] = struct{}{}
+
+	var missed []*liveEvent
+	if lastID > 0 {
+		for _, ev := range b.backlog {
+			if ev.ID > lastID {
+				missed = append(missed, ev)
+			}
+		}
+	}
+	return ch, missed
+}
+
+func (b *eventBroker) unsubscribe(ch chan *liveEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.subscribers, ch)
+}
+
+// emitEvent publishes a live event. userID and gatewayID are the user and
+// gateway it concerns, if any. It belongs to the tenant ctx is scoped to, which
+// for gateway events is the gateway's, else to the user's tenant; events whose
+// tenant isn't known are shown only to platform admins.
+func (s *Server) emitEvent(ctx context.Context, eventType, userID, gatewayID string, data gin.H) {
+	if s.events == nil {
+		return
+	}
+	tenantID, _ := db.TenantFromContext(s.userTenantContext(ctx, userID))
+	s.events.publish(&liveEvent{
+		Type:      eventType,
+		Timestamp: time.Now().UTC(),
+		Data:      data,
+		UserID:    userID,
+		GatewayID: gatewayID,
+		TenantID:  tenantID,
+	})
+}
+
+// eventViewer decides which events a stream subscriber may see. Admins see
+// their tenant's events, and platform admins, or every admin without
+// multi-tenancy, see everything; other users see their own events and the
+// status of gateways they can use.
+type eventViewer struct {
+	userID     string
+	isAdmin    bool
+	tenantID   string
+	allTenants bool
+	gateways   map[string]bool
+}
+
+func (v *eventViewer) canSee(ev *liveEvent) bool {
+	if v.isAdmin {
+		return v.allTenants || ev.TenantID == v.tenantID
+	}
+	if ev.UserID != "" {
+		return ev.UserID == v.userID
+	}
+	switch ev.Type {
+	case eventGatewayOnline, eventGatewayOffline:
+		return v.gateways[ev.GatewayID]
+	}
+	return false
+}
+
+// handleEventStream streams live events as server-sent events. Clients that
+// reconnect send Last-Event-ID to receive events they missed, as far as the
+// backlog goes.
+func (s *Server) handleEventStream(c *gin.Context) {
+	user, err := s.getAuthenticatedUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		return
+	}
+
+	// Requests are scoped to the admin's tenant, or to the one a platform admin
+	// picked; platform admins acting in their own tenant see every tenant's events
+	tenantID, _ := db.TenantFromContext(c.Request.Context())
+	viewer := &eventViewer{
+		userID:     user.UserID,
+		isAdmin:    user.IsAdmin,
+		tenantID:   tenantID,
+		allTenants: !s.config.Tenancy.Enabled || tenantID == db.DefaultTenantID,
+		gateways:   make(map[string]bool),
+	}
+	if !user.IsAdmin {
+		gateways, err := s.gatewayStore.ListUserGateways(c.Request.Context(), user.UserID, user.Groups)
+		if err != nil {
+			s.logger.Error("Failed to list user gateways for event stream", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to open event stream"})
+			return
+		}
+		for _, gw := range gateways {
+			viewer.gateways[gw.ID] = true
+		}
+	}
+
+	lastID, _ := strconv.ParseInt(c.GetHeader("Last-Event-ID"), 10, 64)
+	ch, missed := s.events.subscribe(lastID)
+	defer s.events.unsubscribe(ch)
+
+	// Streams outlive the server's write timeout
+	_ = http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{})
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // Stop nginx buffering the stream
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	write := func(ev *liveEvent) bool {
+		if !viewer.canSee(ev) {
+			return true
+		}
+		data, err := json.Marshal(ev)
+		if err != nil {
+			return true
+		}
+		if _, err := fmt.Fprintf(c.Writer, "id: %d\nevent: %s\ndata: %s\n\n", ev.ID, ev.Type, data); err != nil {
+			return false
+		}
+		c.Writer.Flush()
+		return true
+	}
+
+	for _, ev := range missed {
+		if !write(ev) {
+			return
+		}
+	}
+
+	keepalive := time.NewTicker(eventKeepalive)
+	defer keepalive.Stop()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-s.events.done:
+			return
+		case ev := <-ch:
+			if !write(ev) {
+				return
+			}
+		case <-keepalive.C:
+			if _, err := fmt.Fprint(c.Writer, ": keepalive\n\n"); err != nil {
+				return
+			}
+			c.Writer.Flush()
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package api
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gatekey-project/gatekey/internal/config"
+	"github.com/gatekey-project/gatekey/internal/db"
+)
+
+func TestEventBrokerBacklog(t *testing.T) {
+	b := newEventBroker()
+	for i := 0; i < 3; i++ {
+		b.publish(&liveEvent{Type: eventConnect})
+	}
+
+	ch, missed := b.subscribe(1)
+	defer b.unsubscribe(ch)
+	if len(missed) != 2 || missed[0].ID != 2 {
+		t.Fatalf("missed = %+v, want events 2 and 3", missed)
+	}
+
+	b.publish(&liveEvent{Type: eventDisconnect})
+	if ev := <-ch; ev.ID != 4 || ev.Type != eventDisconnect {
+		t.Errorf("received %+v, want event 4", ev)
+	}
+}
+
+func TestEventViewerCanSee(t *testing.T) {
+	viewer := &eventViewer{userID: "alice", gateways: map[string]bool{"gw-1": true}}
+	admin := &eventViewer{userID: "admin", isAdmin: true, allTenants: true}
+
+	tests := []struct {
+		name string
+		ev   *liveEvent
+		want bool
+	}{
+		{"own connection", &liveEvent{Type: eventConnect, UserID: "alice", GatewayID: "gw-2"}, true},
+		{"someone else's login", &liveEvent{Type: eventLoginSuccess, UserID: "bob"}, false},
+		{"unattributed login failure", &liveEvent{Type: eventLoginFailure}, false},
+		{"accessible gateway", &liveEvent{Type: eventGatewayOffline, GatewayID: "gw-1"}, true},
+		{"other gateway", &liveEvent{Type: eventGatewayOnline, GatewayID: "gw-2"}, false},
+		{"accessible gateway failing to reprovision", &liveEvent{Type: eventReprovisionFailing, GatewayID: "gw-1"}, false},
+	}
+	for _, tt := range tests {
+		if got := viewer.canSee(tt.ev); got != tt.want {
+			t.Errorf("%s: canSee = %v, want %v", tt.name, got, tt.want)
+		}
+		if !admin.canSee(tt.ev) {
+			t.Errorf("%s: admin should see every event", tt.name)
+		}
+	}
+}
+
+func TestEventViewerTenants(t *testing.T) {
+	tenantAdmin := &eventViewer{userID: "admin-a", isAdmin: true, tenantID: "tenant-a"}
+	platformAdmin := &eventViewer{userID: "admin", isAdmin: true, tenantID: db.DefaultTenantID, allTenants: true}
+
+	tests := []struct {
+		name       string
+		ev         *liveEvent
+		tenantSees bool
+	}{
+		{"own tenant's login", &liveEvent{Type: eventLoginSuccess, UserID: "alice", TenantID: "tenant-a"}, true},
+		{"other tenant's login", &liveEvent{Type: eventLoginSuccess, UserID: "bob", TenantID: "tenant-b"}, false},
+		{"other tenant's connection", &liveEvent{Type: eventConnect, UserID: "bob", GatewayID: "gw-b", TenantID: "tenant-b"}, false},
+		{"other tenant's gateway", &liveEvent{Type: eventGatewayOffline, GatewayID: "gw-b", TenantID: "tenant-b"}, false},
+		{"event with no known tenant", &liveEvent{Type: eventLoginFailure}, false},
+	}
+	for _, tt := range tests {
+		if got := tenantAdmin.canSee(tt.ev); got != tt.tenantSees {
+			t.Errorf("%s: tenant admin canSee = %v, want %v", tt.name, got, tt.tenantSees)
+		}
+		if !platformAdmin.canSee(tt.ev) {
+			t.Errorf("%s: platform admin should see every tenant's events", tt.name)
+		}
+	}
+}
+
+func TestEmitEventTenant(t *testing.T) {
+	s := &Server{config: &config.Config{}, events: newEventBroker()}
+	ch, _ := s.events.subscribe(0)
+	defer s.events.unsubscribe(ch)
+
+	// Gateway handlers scope their context to the gateway's tenant
+	s.emitEvent(db.WithTenant(context.Background(), "tenant-b"), eventGatewayOnline, "", "gw-b", nil)
+	if ev := <-ch; ev.TenantID != "tenant-b" {
+		t.Errorf("event tenant = %q, want tenant-b", ev.TenantID)
+	}
+}
@@ -0,0 +1,185 @@
+package api
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/gatekey-project/gatekey/internal/db"
+)
+
+// csvFlushEvery is how many rows are written between flushes to the client, so
+// exports stream instead of buffering.
+const csvFlushEvery = 500
+
+// connectionFilterFromQuery parses the connection list filters: gateway_id, user_id,
+// user (email substring), status (active or closed), and start/end (RFC3339, on the
+// connect time).
+func connectionFilterFromQuery(c *gin.Context) *db.ConnectionFilter {
+	filter := &db.ConnectionFilter{
+		GatewayID: c.Query("gateway_id"),
+		UserID:    c.Query("user_id"),
+		UserEmail: c.Query("user"),
+	}
+	switch c.Query("status") {
+	case "active":
+		active := true
+		filter.Active = &active
+	case "closed":
+		active := false
+		filter.Active = &active
+	}
+	filter.StartTime, filter.EndTime = timeRangeFromQuery(c)
+	return filter
+}
+
+// loginLogFilterFromQuery parses the login log list filters.
+func loginLogFilterFromQuery(c *gin.Context) *db.LoginLogFilter {
+	filter := &db.LoginLogFilter{
+		UserEmail: c.Query("email"),
+		UserID:    c.Query("user_id"),
+		IPAddress: c.Query("ip"),
+		Provider:  c.Query("provider"),
+	}
+	if successStr := c.Query("success"); successStr != "" {
+		success := successStr == "true"
+		filter.Success = &success
+	}
+	filter.StartTime, filter.EndTime = timeRangeFromQuery(c)
+	return filter
+}
+
+// timeRangeFromQuery parses the optional start and end RFC3339 query parameters.
+func timeRangeFromQuery(c *gin.Context) (start, end *time.Time) {
+	if startStr := c.Query("start"); startStr != "" {
+		if t, err := time.Parse(time.RFC3339, startStr); err == nil {
+			start = &t
+		}
+	}
+	if endStr := c.Query("end"); endStr != "" {
+		if t, err := time.Parse(time.RFC3339, endStr); err == nil {
+			end = &t
+		}
+	}
+	return start, end
+}
+
+// csvExportWriter starts a CSV download and returns a writer for it, or responds
+// with an error and returns nil if the requested format isn't supported.
+func csvExportWriter(c *gin.Context, name string, header []string) *csv.Writer {
+	if format := c.DefaultQuery("format", "csv"); format != "csv" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unsupported export format: " + format})
+		return nil
+	}
+
+	fileName := fmt.Sprintf("gatekey-%s-%s.csv", name, time.Now().UTC().Format("20060102-150405"))
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", "attachment; filename="+fileName)
+	c.Status(http.StatusOK)
+
+	w := csv.NewWriter(c.Writer)
+	_ = w.Write(header)
+	return w
+}
+
+// csvField neutralizes values that spreadsheet applications would otherwise
+// evaluate as formulas.
+func csvField(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+func (s *Server) handleExportConnections(c *gin.Context) {
+	filter := connectionFilterFromQuery(c)
+
+	w := csvExportWriter(c, "connections", []string{
+		"user", "gateway", "vpn_ip", "source_ip", "connected_at", "disconnected_at",
+		"duration_seconds", "bytes_sent", "bytes_received", "tunnel_mode",
+	})
+	if w == nil {
+		return
+	}
+
+	now := time.Now()
+	rows := 0
+	err := s.connectionStore.Each(c.Request.Context(), filter, func(conn *db.ConnectionRecord) error {
+		disconnectedAt := ""
+		if conn.DisconnectedAt != nil {
+			disconnectedAt = conn.DisconnectedAt.UTC().Format(time.RFC3339)
+		}
+		if err := w.Write([]string{
+			csvField(conn.UserEmail),
+			csvField(conn.GatewayName),
+			conn.VPNIPv4,
+			conn.ClientIP,
+			conn.ConnectedAt.UTC().Format(time.RFC3339),
+			disconnectedAt,
+			strconv.FormatInt(int64(conn.Duration(now).Seconds()), 10),
+			strconv.FormatInt(conn.BytesSent, 10),
+			strconv.FormatInt(conn.BytesReceived, 10),
+			conn.TunnelMode,
+		}); err != nil {
+			return err
+		}
+		rows++
+		if rows%csvFlushEvery == 0 {
+			w.Flush()
+			c.Writer.Flush()
+		}
+		return w.Error()
+	})
+	w.Flush()
+	if err != nil {
+		// Headers are already sent, so the export is just cut short
+		s.logger.Error("Failed to export connections", zap.Int("rows", rows), zap.Error(err))
+	}
+}
+
+func (s *Server) handleExportLoginLogs(c *gin.Context) {
+	filter := loginLogFilterFromQuery(c)
+
+	w := csvExportWriter(c, "login-logs", []string{
+		"time", "user", "user_name", "provider", "provider_name", "ip_address",
+		"country", "city", "success", "failure_reason", "user_agent",
+	})
+	if w == nil {
+		return
+	}
+
+	rows := 0
+	err := s.loginLogStore.Each(c.Request.Context(), filter, func(log *db.LoginLog) error {
+		if err := w.Write([]string{
+			log.CreatedAt.UTC().Format(time.RFC3339),
+			csvField(log.UserEmail),
+			csvField(log.UserName),
+			log.Provider,
+			csvField(log.ProviderName),
+			log.IPAddress,
+			csvField(log.Country),
+			csvField(log.City),
+			strconv.FormatBool(log.Success),
+			csvField(log.FailureReason),
+			csvField(log.UserAgent),
+		}); err != nil {
+			return err
+		}
+		rows++
+		if rows%csvFlushEvery == 0 {
+			w.Flush()
+			c.Writer.Flush()
+		}
+		return w.Error()
+	})
+	w.Flush()
+	if err != nil {
+		s.logger.Error("Failed to export login logs", zap.Int("rows", rows), zap.Error(err))
+	}
+}
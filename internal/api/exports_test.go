@@ -0,0 +1,19 @@
+package api
+
+import "testing"
+
+func TestCSVField(t *testing.T) {
+	tests := map[string]string{
+		"user@example.com":     "user@example.com",
+		"=HYPERLINK(\"x\")":    "'=HYPERLINK(\"x\")",
+		"+1":                   "'+1",
+		"@SUM(A1)":             "'@SUM(A1)",
+		"":                     "",
+		"Mozilla/5.0 (X11; …)": "Mozilla/5.0 (X11; …)",
+	}
+	for in, want := range tests {
+		if got := csvField(in); got != want {
+			t.Errorf("csvField(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package api
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/gatekey-project/gatekey/internal/firewall"
+)
+
+// normalizeGatewayAddress validates and cleans up the hostname and public IP
+// clients connect to. Values pasted from a browser or a remote line often carry a
+// scheme, path or port, which are stripped; what's left must be an RFC 1123
+// hostname or an IP address, since it's written verbatim into client configs.
+func normalizeGatewayAddress(hostname, publicIP string) (string, string, error) {
+	hostname = stripAddress(hostname)
+	publicIP = stripAddress(publicIP)
+	if hostname == "" && publicIP == "" {
+		return "", "", fmt.Errorf("either hostname or public_ip is required")
+	}
+
+	if hostname != "" {
+		if ip := net.ParseIP(hostname); ip != nil {
+			hostname = ip.String()
+		} else if firewall.ValidHostname(hostname) {
+			hostname = strings.ToLower(strings.TrimSuffix(hostname, "."))
+		} else {
+			return "", "", fmt.Errorf("invalid hostname %q: must be a DNS name such as vpn.example.com or an IP address", hostname)
+		}
+	}
+
+	if publicIP != "" {
+		ip := net.ParseIP(publicIP)
+		if ip == nil {
+			return "", "", fmt.Errorf("invalid public_ip %q: must be an IPv4 or IPv6 address; use hostname for DNS names", publicIP)
+		}
+		if ip.IsUnspecified() || ip.IsMulticast() {
+			return "", "", fmt.Errorf("invalid public_ip %q: clients can't connect to it", publicIP)
+		}
+		publicIP = ip.String()
+	}
+	return hostname, publicIP, nil
+}
+
+// stripAddress trims whitespace, a URL scheme and path, and a port from an
+// address, leaving the host.
+func stripAddress(addr string) string {
+	addr = strings.TrimSpace(addr)
+	if addr == "" {
+		return ""
+	}
+	if strings.Contains(addr, "://") {
+		if u, err := url.Parse(addr); err == nil && u.Host != "" {
+			addr = u.Host
+		}
+	} else if i := strings.IndexByte(addr, '/'); i >= 0 {
+		addr = addr[:i]
+	}
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+	return strings.Trim(addr, "[]")
+}
@@ -0,0 +1,36 @@
+package api
+
+import "testing"
+
+func TestNormalizeGatewayAddress(t *testing.T) {
+	tests := []struct {
+		hostname, publicIP         string
+		wantHostname, wantPublicIP string
+		wantErr                    bool
+	}{
+		{"vpn.example.com", "", "vpn.example.com", "", false},
+		{" VPN.Example.com. ", "203.0.113.10", "vpn.example.com", "203.0.113.10", false},
+		{"https://vpn.example.com:1194/login", "", "vpn.example.com", "", false},
+		{"vpn.example.com:1194", "203.0.113.10:1194", "vpn.example.com", "203.0.113.10", false},
+		{"", "[2001:db8::1]:1194", "", "2001:db8::1", false},
+		{"203.0.113.10", "", "203.0.113.10", "", false},
+		{"", "", "", "", true},
+		{"vpn_example.com", "", "", "", true},
+		{"vpn example.com", "", "", "", true},
+		{"-vpn.example.com", "", "", "", true},
+		{"", "vpn.example.com", "", "", true},
+		{"", "203.0.113.300", "", "", true},
+		{"", "0.0.0.0", "", "", true},
+	}
+	for _, tt := range tests {
+		hostname, publicIP, err := normalizeGatewayAddress(tt.hostname, tt.publicIP)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("normalizeGatewayAddress(%q, %q) error = %v, want error %v", tt.hostname, tt.publicIP, err, tt.wantErr)
+			continue
+		}
+		if hostname != tt.wantHostname || publicIP != tt.wantPublicIP {
+			t.Errorf("normalizeGatewayAddress(%q, %q) = %q, %q; want %q, %q",
+				tt.hostname, tt.publicIP, hostname, publicIP, tt.wantHostname, tt.wantPublicIP)
+		}
+	}
+}
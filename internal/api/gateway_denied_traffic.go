@@ -0,0 +1,251 @@
+package api
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/gatekey-project/gatekey/internal/db"
+	"github.com/gatekey-project/gatekey/internal/firewall"
+	"github.com/gatekey-project/gatekey/internal/openvpn"
+)
+
+const (
+	// maxDeniedTrafficEntries bounds one report; gateways keep at most this many
+	// destinations between reports.
+	maxDeniedTrafficEntries = 10000
+	// deniedTrafficRetention is how long denied traffic is kept after it was last seen.
+	deniedTrafficRetention = 7 * 24 * time.Hour
+)
+
+// handleGatewayDeniedTraffic adds a gateway's summary of the traffic its default
+// deny policy dropped to the totals.
+func (s *Server) handleGatewayDeniedTraffic(c *gin.Context) {
+	var req struct {
+		Token   string                  `json:"token" binding:"required"`
+		Entries []openvpn.DeniedTraffic `json:"entries" binding:"max=10000"`
+	}
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	ctx := c.Request.Context()
+	gateway, err := s.gatewayStore.GetGatewayByToken(ctx, req.Token)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid gateway token"})
+		return
+	}
+
+	if len(req.Entries) > maxDeniedTrafficEntries {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "too many entries"})
+		return
+	}
+	entries := make([]*db.DeniedTraffic, 0, len(req.Entries))
+	for _, e := range req.Entries {
+		if net.ParseIP(e.ClientIP) == nil || net.ParseIP(e.DestIP) == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid address in entry"})
+			return
+		}
+		if e.Protocol == "" || len(e.Protocol) > 16 || e.DestPort < 0 || e.DestPort > 65535 || e.Packets <= 0 || len(e.UserEmail) > 255 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid entry for %s", e.Destination())})
+			return
+		}
+		if e.FirstSeen.IsZero() || e.LastSeen.Before(e.FirstSeen) {
+			e.FirstSeen, e.LastSeen = time.Now(), time.Now()
+		}
+		entries = append(entries, &db.DeniedTraffic{
+			UserEmail: e.UserEmail,
+			ClientIP:  e.ClientIP,
+			DestIP:    e.DestIP,
+			Protocol:  e.Protocol,
+			DestPort:  e.DestPort,
+			Packets:   e.Packets,
+			FirstSeen: e.FirstSeen,
+			LastSeen:  e.LastSeen,
+		})
+	}
+
+	if err := s.gatewayStore.RecordDeniedTraffic(ctx, gateway.ID, entries); err != nil {
+		s.logger.Error("Failed to record denied traffic", zap.String("gateway", gateway.Name), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to record denied traffic"})
+		return
+	}
+	if _, err := s.gatewayStore.DeleteDeniedTrafficBefore(ctx, time.Now().Add(-deniedTrafficRetention)); err != nil {
+		s.logger.Warn("Failed to delete old denied traffic", zap.Error(err))
+	}
+	c.JSON(http.StatusOK, gin.H{"stored": len(entries)})
+}
+
+// handleGetGatewayDeniedTraffic lists the traffic a gateway blocked, optionally
+// for one user (?user=) and from a start time (?start=).
+func (s *Server) handleGetGatewayDeniedTraffic(c *gin.Context) {
+	gatewayID := c.Param("id")
+	ctx := c.Request.Context()
+
+	if _, err := s.gatewayStore.GetGateway(ctx, gatewayID); err != nil {
+		if err == db.ErrGatewayNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "gateway not found"})
+			return
+		}
+		s.logger.Error("Failed to get gateway", zap.Error(err), zap.String("id", gatewayID))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get gateway"})
+		return
+	}
+
+	filter := deniedTrafficFilterFromQuery(c)
+	filter.GatewayID = gatewayID
+	filter.UserEmail = c.Query("user")
+	s.respondDeniedTraffic(c, filter, nil)
+}
+
+// handleGetMyDeniedTraffic lists what the current user was blocked from
+// reaching, by default over the last day, so they can tell a policy denial from
+// a network failure.
+func (s *Server) handleGetMyDeniedTraffic(c *gin.Context) {
+	user, err := s.getAuthenticatedUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	filter := deniedTrafficFilterFromQuery(c)
+	if filter.Since.IsZero() {
+		filter.Since = time.Now().Add(-24 * time.Hour)
+	}
+	filter.UserEmail = user.Email
+
+	// The user's own rules explain denials a rule nearly covers
+	userID, groups, err := s.getCurrentUserInfo(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	rules, err := s.accessRuleStore.GetUserAccessRules(c.Request.Context(), userID, groups)
+	if err != nil {
+		s.logger.Error("Failed to get user access rules", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get access rules"})
+		return
+	}
+	s.respondDeniedTraffic(c, filter, rules)
+}
+
+// deniedTrafficFilterFromQuery parses the start and limit parameters shared by
+// the denied traffic lists.
+func deniedTrafficFilterFromQuery(c *gin.Context) db.DeniedTrafficFilter {
+	filter := db.DeniedTrafficFilter{Limit: 100}
+	if start, _ := timeRangeFromQuery(c); start != nil {
+		filter.Since = *start
+	}
+	if limit, err := strconv.Atoi(c.Query("limit")); err == nil && limit > 0 && limit <= 1000 {
+		filter.Limit = limit
+	}
+	return filter
+}
+
+// respondDeniedTraffic lists denied traffic. When the user's rules are given,
+// an entry whose address one of them covers names that rule.
+func (s *Server) respondDeniedTraffic(c *gin.Context, filter db.DeniedTrafficFilter, rules []*db.AccessRule) {
+	entries, err := s.gatewayStore.ListDeniedTraffic(c.Request.Context(), filter)
+	if err != nil {
+		s.logger.Error("Failed to list denied traffic", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list denied traffic"})
+		return
+	}
+
+	result := make([]gin.H, 0, len(entries))
+	for _, e := range entries {
+		destination := openvpn.DeniedTraffic{DestIP: e.DestIP, DestPort: e.DestPort}.Destination()
+		rule := coveringAccessRule(rules, e.DestIP)
+		entry := gin.H{
+			"gatewayId":   e.GatewayID,
+			"gatewayName": e.GatewayName,
+			"userEmail":   e.UserEmail,
+			"clientIp":    e.ClientIP,
+			"destination": destination,
+			"destIp":      e.DestIP,
+			"destPort":    e.DestPort,
+			"protocol":    e.Protocol,
+			"packets":     e.Packets,
+			"firstSeen":   e.FirstSeen,
+			"lastSeen":    e.LastSeen,
+			"message":     fmt.Sprintf("Blocked trying to reach %s (%s) through %s: %s", destination, e.Protocol, e.GatewayName, deniedReason(rule, e)),
+		}
+		if rule != nil {
+			entry["rule"] = rule.Name
+			if rule.Description != "" {
+				entry["ruleDescription"] = rule.Description
+			}
+		}
+		result = append(result, entry)
+	}
+	c.JSON(http.StatusOK, gin.H{"entries": result})
+}
+
+// deniedReason explains why traffic was denied, given the user's rule covering
+// its address if there is one. Such traffic was blocked for its port or
+// protocol, or because the rule's network isn't routed through the gateway.
+func deniedReason(rule *db.AccessRule, e *db.DeniedTraffic) string {
+	if rule == nil {
+		return "no access rule allows it"
+	}
+	label := fmt.Sprintf("rule %q", rule.Name)
+	if rule.Description != "" {
+		label += " (" + rule.Description + ")"
+	}
+
+	protocol, ports := "", ""
+	if rule.Protocol != nil && *rule.Protocol != "*" {
+		protocol = *rule.Protocol
+	}
+	if rule.PortRange != nil && *rule.PortRange != "*" {
+		ports = *rule.PortRange
+	}
+	start, end, _ := firewall.ParsePortRange(ports)
+	protocolOK := protocol == "" || protocol == e.Protocol
+	portOK := ports == "" || (e.DestPort >= start && e.DestPort <= end)
+	if protocolOK && portOK {
+		return label + " allows it, but not through this gateway"
+	}
+
+	allowed := "port " + ports
+	switch {
+	case protocol != "" && ports != "":
+		allowed = protocol + "/" + ports
+	case protocol != "":
+		allowed = protocol
+	}
+	return fmt.Sprintf("%s allows %s only on %s", label, e.DestIP, allowed)
+}
+
+// coveringAccessRule returns the first active IP or CIDR rule whose address
+// covers ip, or nil.
+func coveringAccessRule(rules []*db.AccessRule, ip string) *db.AccessRule {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return nil
+	}
+	for _, rule := range rules {
+		if !rule.IsActive {
+			continue
+		}
+		switch rule.RuleType {
+		case db.AccessRuleTypeIP:
+			if ruleIP := net.ParseIP(rule.Value); ruleIP != nil && ruleIP.Equal(addr) {
+				return rule
+			}
+		case db.AccessRuleTypeCIDR:
+			// Addresses the user's exceptions take out of the rule aren't covered
+			for _, value := range rule.Destinations() {
+				if _, network, err := net.ParseCIDR(value); err == nil && network.Contains(addr) {
+					return rule
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/gatekey-project/gatekey/internal/db"
+)
+
+func TestDeniedReason(t *testing.T) {
+	rules := []*db.AccessRule{
+		{Name: "old db", RuleType: db.AccessRuleTypeIP, Value: "10.2.0.5", IsActive: false},
+		{Name: "Prod DB access", Description: "ticket #123", RuleType: db.AccessRuleTypeIP, Value: "10.2.0.5", PortRange: strPtr("5432"), Protocol: strPtr("tcp"), IsActive: true},
+		{Name: "build farm", RuleType: db.AccessRuleTypeCIDR, Value: "10.4.0.0/24", PortRange: strPtr("*"), IsActive: true},
+		{Name: "wiki", RuleType: db.AccessRuleTypeHostname, Value: "wiki.internal", IsActive: true},
+	}
+
+	tests := []struct {
+		destIP, protocol string
+		port             int
+		want             string
+	}{
+		{"10.2.0.5", "tcp", 22, `rule "Prod DB access" (ticket #123) allows 10.2.0.5 only on tcp/5432`},
+		{"10.2.0.5", "tcp", 5432, `rule "Prod DB access" (ticket #123) allows it, but not through this gateway`},
+		{"10.4.0.9", "udp", 53, `rule "build farm" allows it, but not through this gateway`},
+		{"10.9.0.1", "tcp", 443, "no access rule allows it"},
+	}
+	for _, tt := range tests {
+		e := &db.DeniedTraffic{DestIP: tt.destIP, Protocol: tt.protocol, DestPort: tt.port}
+		if got := deniedReason(coveringAccessRule(rules, tt.destIP), e); got != tt.want {
+			t.Errorf("deniedReason(%s %s/%d) = %q, want %q", tt.destIP, tt.protocol, tt.port, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package api
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/gatekey-project/gatekey/internal/db"
+	"github.com/gatekey-project/gatekey/internal/openvpn"
+)
+
+// validateLinkTuning checks a gateway's keepalive and MTU settings against every
+// protocol it listens on.
+func validateLinkTuning(tuning db.LinkTuning, primaryProtocol string, endpoints []db.ListenEndpoint) error {
+	protocols := []string{primaryProtocol}
+	for _, ep := range endpoints {
+		protocols = append(protocols, ep.Protocol)
+	}
+	return openvpn.ValidateLinkTuning(openvpn.LinkTuning(tuning), protocols...)
+}
+
+// validateListenEndpoints checks a gateway's additional listen endpoints. Each must
+// use a distinct protocol/port from the primary endpoint and every other endpoint,
+// and needs its own client subnet since it runs as a separate OpenVPN instance.
+func validateListenEndpoints(primaryProtocol string, primaryPort int, primarySubnet string, endpoints []db.ListenEndpoint) error {
+	seen := map[string]bool{fmt.Sprintf("%s/%d", primaryProtocol, primaryPort): true}
+
+	_, primaryNet, err := net.ParseCIDR(primarySubnet)
+	if err != nil {
+		return fmt.Errorf("invalid vpn_subnet: %s", primarySubnet)
+	}
+	subnets := []*net.IPNet{primaryNet}
+
+	for _, ep := range endpoints {
+		if ep.Protocol != "udp" && ep.Protocol != "tcp" {
+			return fmt.Errorf("invalid endpoint protocol %q: must be udp or tcp", ep.Protocol)
+		}
+		if ep.Port < 1 || ep.Port > 65535 {
+			return fmt.Errorf("invalid endpoint port %d: must be 1-65535", ep.Port)
+		}
+		key := fmt.Sprintf("%s/%d", ep.Protocol, ep.Port)
+		if seen[key] {
+			return fmt.Errorf("duplicate endpoint %s", key)
+		}
+		seen[key] = true
+
+		_, epNet, err := net.ParseCIDR(ep.Subnet)
+		if err != nil {
+			return fmt.Errorf("endpoint %s requires a valid subnet (e.g. 172.31.254.0/24)", key)
+		}
+		for _, existing := range subnets {
+			if existing.Contains(epNet.IP) || epNet.Contains(existing.IP) {
+				return fmt.Errorf("endpoint %s subnet %s overlaps %s", key, ep.Subnet, existing.String())
+			}
+		}
+		subnets = append(subnets, epNet)
+	}
+	return nil
+}
+
+// clientRemotes converts a gateway's additional endpoints to client config remotes.
+func clientRemotes(endpoints []db.ListenEndpoint) []openvpn.Remote {
+	remotes := make([]openvpn.Remote, 0, len(endpoints))
+	for _, ep := range endpoints {
+		remotes = append(remotes, openvpn.Remote{Protocol: ep.Protocol, Port: ep.Port})
+	}
+	return remotes
+}
+
+// provisionEndpoints renders a gateway's additional endpoints for the provision response.
+func provisionEndpoints(endpoints []db.ListenEndpoint) []map[string]interface{} {
+	result := make([]map[string]interface{}, 0, len(endpoints))
+	for _, ep := range endpoints {
+		network, netmask := parseSubnetToNetworkMask(ep.Subnet)
+		result = append(result, map[string]interface{}{
+			"protocol":    ep.Protocol,
+			"port":        ep.Port,
+			"vpn_subnet":  ep.Subnet,
+			"vpn_network": network,
+			"vpn_netmask": netmask,
+		})
+	}
+	return result
+}
+
+// normalizeEndpoints treats nil and empty endpoint lists as equal for change detection.
+func normalizeEndpoints(endpoints []db.ListenEndpoint) []db.ListenEndpoint {
+	if endpoints == nil {
+		return []db.ListenEndpoint{}
+	}
+	return endpoints
+}
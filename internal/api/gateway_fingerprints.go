@@ -0,0 +1,95 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/gatekey-project/gatekey/internal/db"
+)
+
+// Provisioning artifact names reported by /gateway/config-version.
+const (
+	artifactCA        = "ca"
+	artifactNetwork   = "network"
+	artifactCrypto    = "crypto"
+	artifactTLS       = "tls"
+	artifactEndpoints = "endpoints"
+	artifactSession   = "session"
+	// Compression changes need an OpenVPN restart, like network and crypto
+	artifactCompression = "compression"
+	artifactLinkTuning  = "link"
+)
+
+// fingerprint returns a short SHA256 fingerprint of the given parts.
+func fingerprint(parts ...string) string {
+	h := sha256.New()
+	for _, p := range parts {
+		h.Write([]byte(p))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// provisioningFingerprints returns a fingerprint per provisioning input so a gateway
+// can tell which artifacts changed between its last provision and the current state.
+// The server certificate is reissued on every provision and so isn't fingerprinted;
+// it changes whenever the CA does.
+func provisioningFingerprints(gateway *db.Gateway, caPEM []byte, tlsAuthKey string, authTokenLifetime int) map[string]string {
+	vpnSubnet := gateway.VPNSubnet
+	if vpnSubnet == "" {
+		vpnSubnet = db.DefaultVPNSubnet
+	}
+
+	tls := fingerprint("disabled")
+	if gateway.TLSAuthEnabled {
+		tls = fingerprint(gateway.TLSMode, tlsAuthKey)
+	}
+
+	endpoints, _ := json.Marshal(normalizeEndpoints(gateway.AdditionalEndpoints))
+	linkTuning, _ := json.Marshal(gateway.LinkTuning)
+
+	return map[string]string{
+		artifactCA:        fingerprint(string(caPEM)),
+		artifactNetwork:   fingerprint(vpnSubnet, fmt.Sprintf("%d", gateway.VPNPort), gateway.VPNProtocol),
+		artifactCrypto:    fingerprint(gatewayCryptoProfile(gateway)),
+		artifactTLS:       tls,
+		artifactEndpoints: fingerprint(string(endpoints)),
+		artifactSession:   fingerprint(fmt.Sprintf("%d", authTokenLifetime)),
+
+		artifactCompression: fingerprint(gateway.Compression),
+		artifactLinkTuning:  fingerprint(string(linkTuning)),
+	}
+}
+
+// handleGatewayConfigVersion returns the expected config version and per-artifact
+// fingerprints without issuing certificates, so gateways can check cheaply what a
+// reprovision would change.
+func (s *Server) handleGatewayConfigVersion(c *gin.Context) {
+	if s.ca == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "PKI not configured"})
+		return
+	}
+
+	var req struct {
+		Token string `json:"token" binding:"required"`
+	}
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	gateway, err := s.gatewayStore.GetGatewayByToken(c.Request.Context(), req.Token)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid gateway token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"config_version": gateway.ConfigVersion,
+		"fingerprints":   provisioningFingerprints(gateway, s.ca.CertificatePEM(), gateway.TLSAuthKey, s.authGenTokenLifetime(c.Request.Context(), gateway)),
+	})
+}
@@ -0,0 +1,52 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/gatekey-project/gatekey/internal/db"
+)
+
+func TestProvisioningFingerprints(t *testing.T) {
+	gw := &db.Gateway{
+		VPNSubnet:      "10.8.0.0/24",
+		VPNPort:        1194,
+		VPNProtocol:    "udp",
+		CryptoProfile:  db.CryptoProfileModern,
+		TLSAuthEnabled: true,
+		TLSMode:        db.TLSModeAuth,
+	}
+	ca := []byte("ca-pem")
+
+	base := provisioningFingerprints(gw, ca, "key", 3600)
+	if len(base) != 8 {
+		t.Fatalf("expected 8 fingerprints, got %d", len(base))
+	}
+
+	// Changing only the crypto profile should only change that fingerprint
+	gw.CryptoProfile = db.CryptoProfileFIPS
+	changed := provisioningFingerprints(gw, ca, "key", 3600)
+	for name, fp := range base {
+		if name == artifactCrypto {
+			if fp == changed[name] {
+				t.Errorf("expected %s fingerprint to change", name)
+			}
+		} else if fp != changed[name] {
+			t.Errorf("expected %s fingerprint to be unchanged", name)
+		}
+	}
+
+	if provisioningFingerprints(gw, ca, "other-key", 3600)[artifactTLS] == changed[artifactTLS] {
+		t.Error("expected tls fingerprint to change with the key")
+	}
+	if provisioningFingerprints(gw, ca, "key", 0)[artifactSession] == changed[artifactSession] {
+		t.Error("expected session fingerprint to change with the auth token lifetime")
+	}
+	gw.Compression = db.CompressionLZ4
+	if provisioningFingerprints(gw, ca, "key", 3600)[artifactCompression] == changed[artifactCompression] {
+		t.Error("expected compression fingerprint to change with the compression mode")
+	}
+	gw.LinkTuning.TunMTU = 1400
+	if provisioningFingerprints(gw, ca, "key", 3600)[artifactLinkTuning] == changed[artifactLinkTuning] {
+		t.Error("expected link fingerprint to change with the MTU")
+	}
+}
@@ -0,0 +1,106 @@
+package api
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/gatekey-project/gatekey/internal/openvpn"
+)
+
+// ipPoolWarningThreshold is the fraction of a gateway's address pool in use at
+// which admins are warned that new clients may soon get no address.
+const ipPoolWarningThreshold = 0.8
+
+// gatewayReports holds the latest rule enforcement metrics each gateway agent
+// reported in its heartbeat. They are only kept in memory; gateways resend them
+// every heartbeat.
+type gatewayReports struct {
+	mu      sync.RWMutex
+	reports map[string]gatewayMetricsReport // gateway ID -> latest report
+}
+
+type gatewayMetricsReport struct {
+	metrics    openvpn.HeartbeatMetrics
+	reportedAt time.Time
+}
+
+func newGatewayReports() *gatewayReports {
+	return &gatewayReports{reports: make(map[string]gatewayMetricsReport)}
+}
+
+// record stores a gateway's latest metrics and returns the address pools that
+// have just reached the warning threshold.
+func (g *gatewayReports) record(gatewayID string, metrics *openvpn.HeartbeatMetrics) []openvpn.PoolUsage {
+	if metrics == nil {
+		return nil
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	wasLow := make(map[string]bool)
+	for _, pool := range g.reports[gatewayID].metrics.IPPools {
+		wasLow[pool.Subnet] = poolLow(pool)
+	}
+	var newlyLow []openvpn.PoolUsage
+	for _, pool := range metrics.IPPools {
+		if poolLow(pool) && !wasLow[pool.Subnet] {
+			newlyLow = append(newlyLow, pool)
+		}
+	}
+
+	g.reports[gatewayID] = gatewayMetricsReport{metrics: *metrics, reportedAt: time.Now()}
+	return newlyLow
+}
+
+// poolLow reports whether a pool is at or over the warning threshold.
+func poolLow(pool openvpn.PoolUsage) bool {
+	return pool.Size > 0 && float64(pool.Used) >= ipPoolWarningThreshold*float64(pool.Size)
+}
+
+// poolSummary describes an address pool for the admin API.
+func poolSummary(pool openvpn.PoolUsage) gin.H {
+	utilization := 0.0
+	if pool.Size > 0 {
+		utilization = float64(pool.Used) / float64(pool.Size)
+	}
+	return gin.H{
+		"subnet":      pool.Subnet,
+		"size":        pool.Size,
+		"used":        pool.Used,
+		"free":        max(pool.Size-pool.Used, 0),
+		"utilization": utilization,
+		"warning":     poolLow(pool),
+	}
+}
+
+// summary returns a gateway's latest metrics for the admin API, or nil if the
+// gateway hasn't reported any since the server started.
+func (g *gatewayReports) summary(gatewayID string) gin.H {
+	g.mu.RLock()
+	report, ok := g.reports[gatewayID]
+	g.mu.RUnlock()
+	if !ok {
+		return nil
+	}
+
+	summary := gin.H{
+		"firewallRules":       report.metrics.FirewallRules,
+		"ruleRefreshFailures": report.metrics.RuleRefreshFailures,
+		"reprovisions":        report.metrics.Reprovisions,
+		"reportedAt":          report.reportedAt.Format(time.RFC3339),
+	}
+	if report.metrics.LastRuleSync != nil {
+		summary["lastRuleSync"] = report.metrics.LastRuleSync.Format(time.RFC3339)
+	}
+	if len(report.metrics.IPPools) > 0 {
+		pools := make([]gin.H, 0, len(report.metrics.IPPools))
+		for _, pool := range report.metrics.IPPools {
+			pools = append(pools, poolSummary(pool))
+		}
+		summary["ipPools"] = pools
+		summary["ipPoolWarningThreshold"] = ipPoolWarningThreshold
+	}
+	return summary
+}
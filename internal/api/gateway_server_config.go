@@ -0,0 +1,110 @@
+package api
+
+import (
+	"net/http"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/gatekey-project/gatekey/internal/db"
+	"github.com/gatekey-project/gatekey/internal/openvpn"
+)
+
+// Limits on server configs gateways report, well above real configs.
+const (
+	maxServerConfigInstances = 32
+	maxServerConfigSize      = 256 * 1024
+)
+
+// instanceNamePattern matches OpenVPN instance names: "server" and those of
+// additional endpoints, such as "server-tcp-443".
+var instanceNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,100}$`)
+
+// handleGatewayServerConfig stores the OpenVPN server configs a gateway reports
+// running. Gateways redact key material before sending; it's redacted again here
+// in case an older or modified agent didn't.
+func (s *Server) handleGatewayServerConfig(c *gin.Context) {
+	var req struct {
+		Token   string            `json:"token" binding:"required"`
+		Configs map[string]string `json:"configs"`
+	}
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	ctx := c.Request.Context()
+	gateway, err := s.gatewayStore.GetGatewayByToken(ctx, req.Token)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid gateway token"})
+		return
+	}
+
+	if len(req.Configs) > maxServerConfigInstances {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "too many server configs"})
+		return
+	}
+	configs := make(map[string]string, len(req.Configs))
+	for instance, config := range req.Configs {
+		if !instanceNamePattern.MatchString(instance) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid instance name: " + instance})
+			return
+		}
+		if len(config) > maxServerConfigSize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "server config too large: " + instance})
+			return
+		}
+		configs[instance] = string(openvpn.RedactConfig([]byte(config)))
+	}
+
+	if err := s.gatewayStore.SetGatewayServerConfigs(ctx, gateway.ID, configs); err != nil {
+		s.logger.Error("Failed to store gateway server configs", zap.String("gateway", gateway.Name), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to store server configs"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"stored": len(configs)})
+}
+
+// handleGetGatewayServerConfig returns the OpenVPN server configs a gateway last
+// reported running, with key material redacted.
+func (s *Server) handleGetGatewayServerConfig(c *gin.Context) {
+	gatewayID := c.Param("id")
+	ctx := c.Request.Context()
+
+	gateway, err := s.gatewayStore.GetGateway(ctx, gatewayID)
+	if err != nil {
+		if err == db.ErrGatewayNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "gateway not found"})
+			return
+		}
+		s.logger.Error("Failed to get gateway", zap.Error(err), zap.String("id", gatewayID))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get gateway"})
+		return
+	}
+
+	configs, err := s.gatewayStore.ListGatewayServerConfigs(ctx, gateway.ID)
+	if err != nil {
+		s.logger.Error("Failed to get gateway server configs", zap.Error(err), zap.String("id", gatewayID))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get server configs"})
+		return
+	}
+	if len(configs) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "gateway hasn't reported its server config; agents report it after their next heartbeat"})
+		return
+	}
+
+	instances := make([]gin.H, 0, len(configs))
+	for _, cfg := range configs {
+		instances = append(instances, gin.H{
+			"instance":   cfg.Instance,
+			"config":     cfg.Config,
+			"reportedAt": cfg.ReportedAt,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"gatewayId":     gateway.ID,
+		"gatewayName":   gateway.Name,
+		"configVersion": gateway.ConfigVersion,
+		"instances":     instances,
+	})
+}
@@ -0,0 +1,53 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/gatekey-project/gatekey/internal/db"
+	"github.com/gatekey-project/gatekey/internal/openvpn"
+)
+
+// authGenTokenLifetime returns the auth-gen-token lifetime in seconds for a gateway,
+// or 0 if session tokens are disabled. Once a token expires the client is fully
+// re-authenticated by the auth-user-pass-verify hook, so revoked configs are
+// rejected at that point; the lifetime is capped at the config validity so a token
+// never outlives the config it was issued for.
+func (s *Server) authGenTokenLifetime(ctx context.Context, gateway *db.Gateway) int {
+	if !openvpn.AuthGenTokenSupported(gateway.CryptoProfile) {
+		return 0
+	}
+
+	minutes := s.settingsStore.GetInt(ctx, db.SettingAuthTokenLifetimeMinutes, db.DefaultAuthTokenLifetimeMinutes)
+	if minutes <= 0 {
+		return 0
+	}
+	lifetime := minutes * 60
+
+	validity := s.settingsStore.GetInt(ctx, db.SettingVPNCertValidityHours, 24) * 3600
+	if validity > 0 && lifetime > validity {
+		lifetime = validity
+	}
+	return lifetime
+}
+
+// bumpAllGatewayConfigVersions triggers a reprovision on every gateway after a global
+// setting that affects the server config changes.
+func (s *Server) bumpAllGatewayConfigVersions(ctx context.Context, reason string) {
+	gateways, err := s.gatewayStore.ListGateways(ctx)
+	if err != nil {
+		s.logger.Error("Failed to list gateways for config version update", zap.Error(err))
+		return
+	}
+
+	newConfigVersion := fmt.Sprintf("%s-%d", reason, time.Now().UnixNano())
+	for _, gw := range gateways {
+		if err := s.gatewayStore.UpdateGatewayConfigVersion(ctx, gw.ID, newConfigVersion); err != nil {
+			s.logger.Error("Failed to update gateway config version",
+				zap.String("gateway", gw.Name), zap.Error(err))
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/gatekey-project/gatekey/internal/db"
+)
+
+// gatewayStateRequest is the desired state of a gateway. Lists left out are left
+// as they are, while an empty list removes every assignment of that kind.
+type gatewayStateRequest struct {
+	Users    []string              `json:"users" binding:"max=10000"`   // User IDs, emails, or local usernames
+	Groups   []string              `json:"groups" binding:"max=1000"`   // Group names
+	Networks []string              `json:"networks" binding:"max=1000"` // Network IDs
+	Settings *gatewayUpdateRequest `json:"settings"`                    // As for PUT /admin/gateways/:id
+}
+
+// isDryRun reports whether a request asks to see its changes without making them.
+func isDryRun(c *gin.Context) bool {
+	dryRun, _ := strconv.ParseBool(c.Query("dry_run"))
+	return dryRun
+}
+
+// unlessDryRun runs handler only for requests that will change something, so dry
+// runs aren't queued for approval.
+func unlessDryRun(handler gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if isDryRun(c) {
+			c.Next()
+			return
+		}
+		handler(c)
+	}
+}
+
+// setDiff returns what to add to current and remove from it to match desired,
+// each sorted.
+func setDiff(current, desired []string) (add, remove []string) {
+	add, remove = []string{}, []string{}
+	for _, v := range desired {
+		if v != "" && !slices.Contains(current, v) && !slices.Contains(add, v) {
+			add = append(add, v)
+		}
+	}
+	for _, v := range current {
+		if !slices.Contains(desired, v) && !slices.Contains(remove, v) {
+			remove = append(remove, v)
+		}
+	}
+	slices.Sort(add)
+	slices.Sort(remove)
+	return add, remove
+}
+
+// gatewaySettingsDiff returns the settings that differ between two versions of a
+// gateway, keyed by their request field names.
+func gatewaySettingsDiff(from, to *db.Gateway) gin.H {
+	fields := []struct {
+		name     string
+		from, to any
+	}{
+		{"name", from.Name, to.Name},
+		{"hostname", from.Hostname, to.Hostname},
+		{"public_ip", from.PublicIP, to.PublicIP},
+		{"vpn_port", from.VPNPort, to.VPNPort},
+		{"vpn_protocol", from.VPNProtocol, to.VPNProtocol},
+		{"crypto_profile", from.CryptoProfile, to.CryptoProfile},
+		{"vpn_subnet", from.VPNSubnet, to.VPNSubnet},
+		{"tls_auth_enabled", from.TLSAuthEnabled, to.TLSAuthEnabled},
+		{"tls_mode", from.TLSMode, to.TLSMode},
+		{"compression", from.Compression, to.Compression},
+		{"full_tunnel_mode", from.FullTunnelMode, to.FullTunnelMode},
+		{"allow_tunnel_choice", from.AllowTunnelChoice, to.AllowTunnelChoice},
+		{"push_dns", from.PushDNS, to.PushDNS},
+		{"dns_servers", from.DNSServers, to.DNSServers},
+		{"push_options", from.PushOptions, to.PushOptions},
+		{"additional_endpoints", normalizeEndpoints(from.AdditionalEndpoints), normalizeEndpoints(to.AdditionalEndpoints)},
+		{"encrypt_client_keys", from.EncryptClientKeys, to.EncryptClientKeys},
+		{"min_crypto_profile", from.MinCryptoProfile, to.MinCryptoProfile},
+		{"link_tuning", from.LinkTuning, to.LinkTuning},
+	}
+	diff := gin.H{}
+	for _, f := range fields {
+		a, b := reflect.ValueOf(f.from), reflect.ValueOf(f.to)
+		if a.Kind() == reflect.Slice && a.Len() == 0 && b.Len() == 0 {
+			continue
+		}
+		if !reflect.DeepEqual(f.from, f.to) {
+			diff[f.name] = gin.H{"from": f.from, "to": f.to}
+		}
+	}
+	return diff
+}
+
+// handleApplyGatewayState reconciles a gateway's user, group, and network
+// assignments and its settings with a desired state in one transaction, so the
+// gateway can be managed declaratively. It returns the changes made, or with
+// dry_run=true the changes that would be made.
+func (s *Server) handleApplyGatewayState(c *gin.Context) {
+	gatewayID := c.Param("id")
+	dryRun := isDryRun(c)
+
+	var req gatewayStateRequest
+	if !bindStrictJSON(c, &req) {
+		return
+	}
+
+	ctx := c.Request.Context()
+	existingGw, err := s.gatewayStore.GetGateway(ctx, gatewayID)
+	if err != nil {
+		if err == db.ErrGatewayNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "gateway not found"})
+			return
+		}
+		s.logger.Error("Failed to get gateway", zap.Error(err), zap.String("id", gatewayID))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get gateway"})
+		return
+	}
+
+	change := &db.GatewayStateChange{}
+	diff := gin.H{}
+	changed := false
+
+	if req.Users != nil {
+		users, err := s.gatewayStore.GetGatewayUsers(ctx, gatewayID)
+		if err != nil {
+			s.logger.Error("Failed to get gateway users", zap.Error(err), zap.String("gatewayId", gatewayID))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get gateway users"})
+			return
+		}
+		current := make([]string, 0, len(users))
+		for _, u := range users {
+			current = append(current, u.UserID)
+		}
+		desired := make([]string, 0, len(req.Users))
+		for _, ref := range req.Users {
+			desired = append(desired, s.resolveGatewayUserID(ctx, ref))
+		}
+		change.AddUsers, change.RemoveUsers = setDiff(current, desired)
+		diff["users"] = gin.H{"added": change.AddUsers, "removed": change.RemoveUsers}
+		changed = changed || len(change.AddUsers)+len(change.RemoveUsers) > 0
+	}
+
+	if req.Groups != nil {
+		groups, err := s.gatewayStore.GetGatewayGroups(ctx, gatewayID)
+		if err != nil {
+			s.logger.Error("Failed to get gateway groups", zap.Error(err), zap.String("gatewayId", gatewayID))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get gateway groups"})
+			return
+		}
+		current := make([]string, 0, len(groups))
+		for _, g := range groups {
+			current = append(current, g.GroupName)
+		}
+		change.AddGroups, change.RemoveGroups = setDiff(current, req.Groups)
+		diff["groups"] = gin.H{"added": change.AddGroups, "removed": change.RemoveGroups}
+		changed = changed || len(change.AddGroups)+len(change.RemoveGroups) > 0
+	}
+
+	if req.Networks != nil {
+		networks, err := s.networkStore.GetGatewayNetworks(ctx, gatewayID)
+		if err != nil {
+			s.logger.Error("Failed to get gateway networks", zap.Error(err), zap.String("gatewayId", gatewayID))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get gateway networks"})
+			return
+		}
+		current := make([]string, 0, len(networks))
+		for _, n := range networks {
+			current = append(current, n.ID)
+		}
+		change.AddNetworks, change.RemoveNetworks = setDiff(current, req.Networks)
+		for _, networkID := range change.AddNetworks {
+			if _, err := uuid.Parse(networkID); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("network %s not found", networkID)})
+				return
+			}
+			if _, err := s.networkStore.GetNetwork(ctx, networkID); err == db.ErrNetworkNotFound {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("network %s not found", networkID)})
+				return
+			} else if err != nil {
+				s.logger.Error("Failed to get network", zap.Error(err), zap.String("networkId", networkID))
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get network"})
+				return
+			}
+		}
+		diff["networks"] = gin.H{"added": change.AddNetworks, "removed": change.RemoveNetworks}
+		changed = changed || len(change.AddNetworks)+len(change.RemoveNetworks) > 0
+	}
+
+	if req.Settings != nil {
+		gw, err := s.buildGatewayUpdate(ctx, existingGw, *req.Settings)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		settings := gatewaySettingsDiff(existingGw, gw)
+		if len(settings) > 0 {
+			change.Gateway = gw
+			changed = true
+		}
+		diff["settings"] = settings
+	}
+
+	diff["gatewayId"] = gatewayID
+	diff["dryRun"] = dryRun
+	diff["changed"] = changed
+	if dryRun || !changed {
+		c.JSON(http.StatusOK, diff)
+		return
+	}
+
+	if err := s.gatewayStore.ApplyGatewayState(ctx, gatewayID, change); err != nil {
+		switch err {
+		case db.ErrGatewayNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": "gateway not found"})
+		case db.ErrNetworkNotFound:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "network not found"})
+		case db.ErrGatewayExists:
+			c.JSON(http.StatusConflict, gin.H{"error": "gateway with this name already exists"})
+		default:
+			s.logger.Error("Failed to apply gateway state", zap.Error(err), zap.String("id", gatewayID))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to apply gateway state"})
+		}
+		return
+	}
+	if change.Gateway != nil {
+		s.reprovisionAfterUpdate(ctx, existingGw, change.Gateway)
+	}
+
+	s.recordAudit(c, "gateway.apply_state", "gateway", gatewayID, gin.H{
+		"users":    diff["users"],
+		"groups":   diff["groups"],
+		"networks": diff["networks"],
+		"settings": diff["settings"],
+	})
+	s.logger.Info("Gateway state applied", zap.String("id", gatewayID), zap.String("name", existingGw.Name))
+	c.JSON(http.StatusOK, diff)
+}
@@ -0,0 +1,39 @@
+package api
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/gatekey-project/gatekey/internal/db"
+)
+
+func TestSetDiff(t *testing.T) {
+	tests := []struct {
+		current, desired []string
+		add, remove      []string
+	}{
+		{nil, []string{"b", "a", "a"}, []string{"a", "b"}, []string{}},
+		{[]string{"a", "b"}, []string{"b", "c"}, []string{"c"}, []string{"a"}},
+		{[]string{"a"}, []string{}, []string{}, []string{"a"}},
+		{[]string{"a"}, []string{"a", ""}, []string{}, []string{}},
+	}
+	for _, tt := range tests {
+		add, remove := setDiff(tt.current, tt.desired)
+		if !reflect.DeepEqual(add, tt.add) || !reflect.DeepEqual(remove, tt.remove) {
+			t.Errorf("setDiff(%v, %v) = %v, %v; want %v, %v", tt.current, tt.desired, add, remove, tt.add, tt.remove)
+		}
+	}
+}
+
+func TestGatewaySettingsDiff(t *testing.T) {
+	from := &db.Gateway{Name: "gw", VPNPort: 1194, DNSServers: nil}
+	to := &db.Gateway{Name: "gw", VPNPort: 443, DNSServers: []string{}, PushDNS: true}
+
+	diff := gatewaySettingsDiff(from, to)
+	if len(diff) != 2 || diff["vpn_port"] == nil || diff["push_dns"] == nil {
+		t.Errorf("gatewaySettingsDiff = %v, want vpn_port and push_dns", diff)
+	}
+	if diff := gatewaySettingsDiff(from, from); len(diff) != 0 {
+		t.Errorf("gatewaySettingsDiff of identical gateways = %v, want none", diff)
+	}
+}
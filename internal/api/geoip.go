@@ -0,0 +1,62 @@
+package api
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/gatekey-project/gatekey/internal/config"
+	"github.com/gatekey-project/gatekey/internal/geoip"
+)
+
+// geoIPQueueSize bounds pending lookups; when full, new logins are logged without
+// a location rather than blocking.
+const geoIPQueueSize = 256
+
+// geoIPJob fills in the location of a login log entry.
+type geoIPJob struct {
+	logID string
+	ip    string
+}
+
+func geoipConfig(cfg config.GeoIPConfig) geoip.Config {
+	return geoip.Config{
+		Provider:     cfg.Provider,
+		DatabasePath: cfg.DatabasePath,
+		CacheSize:    cfg.CacheSize,
+		CacheTTL:     cfg.CacheTTL,
+	}
+}
+
+// queueGeoIPLookup schedules a location lookup for a login log entry without
+// blocking the login.
+func (s *Server) queueGeoIPLookup(logID, ip string) {
+	select {
+	case s.geoipQueue <- geoIPJob{logID: logID, ip: ip}:
+	default:
+		s.logger.Debug("GeoIP lookup queue full, skipping lookup", zap.String("ip", ip))
+	}
+}
+
+// runGeoIPLookups resolves queued login locations and updates their log entries
+func (s *Server) runGeoIPLookups(ctx context.Context) {
+	s.logger.Info("Started GeoIP lookup background task", zap.String("source", s.geoip.Source()))
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case job := <-s.geoipQueue:
+			lookupCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+			location, err := s.geoip.Lookup(lookupCtx, job.ip)
+			if err == nil && !location.IsZero() {
+				err = s.loginLogStore.UpdateLocation(lookupCtx, job.logID, location.Country, location.CountryCode, location.City)
+			}
+			cancel()
+			if err != nil {
+				s.logger.Debug("GeoIP lookup failed", zap.String("ip", job.ip), zap.Error(err))
+			}
+		}
+	}
+}
@@ -0,0 +1,294 @@
+package api
+
+import (
+	"context"
+	cryptoRand "crypto/rand"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/gatekey-project/gatekey/internal/db"
+	"github.com/gatekey-project/gatekey/internal/ldap"
+)
+
+// ldapClients keeps one client, and so one connection pool, per LDAP provider.
+// Entries are dropped when a provider changes so the next login picks up the
+// new settings.
+type ldapClients struct {
+	mu      sync.Mutex
+	clients map[string]*ldap.Client
+}
+
+func newLDAPClients() *ldapClients {
+	return &ldapClients{clients: make(map[string]*ldap.Client)}
+}
+
+func (l *ldapClients) get(provider *db.LDAPProvider) (*ldap.Client, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if client, ok := l.clients[provider.Name]; ok {
+		return client, nil
+	}
+	client, err := ldap.New(ldapConfig(provider))
+	if err != nil {
+		return nil, err
+	}
+	l.clients[provider.Name] = client
+	return client, nil
+}
+
+func (l *ldapClients) invalidate(name string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if client, ok := l.clients[name]; ok {
+		client.Close()
+		delete(l.clients, name)
+	}
+}
+
+func ldapConfig(p *db.LDAPProvider) ldap.Config {
+	return ldap.Config{
+		URL:                p.URL,
+		BindDN:             p.BindDN,
+		BindPassword:       p.BindPassword,
+		BaseDN:             p.BaseDN,
+		UserFilter:         p.UserFilter,
+		GroupFilter:        p.GroupFilter,
+		GroupAttribute:     p.GroupAttribute,
+		EmailAttribute:     p.EmailAttribute,
+		NameAttribute:      p.NameAttribute,
+		StartTLS:           p.StartTLS,
+		InsecureSkipVerify: p.InsecureSkipVerify,
+		CACert:             p.CACert,
+	}
+}
+
+// handleLDAPLogin authenticates a user against an LDAP provider and creates an SSO
+// session for them, the same way OIDC and SAML logins do.
+func (s *Server) handleLDAPLogin(c *gin.Context) {
+	var req struct {
+		Provider string `json:"provider" binding:"required"`
+		Username string `json:"username" binding:"required"`
+		Password string `json:"password" binding:"required"`
+	}
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	ctx := c.Request.Context()
+	ipAddress := getRealClientIP(c)
+	userAgent := c.GetHeader("User-Agent")
+
+	provider, err := s.providerStore.GetLDAPProvider(ctx, req.Provider)
+	if err != nil || !provider.Enabled {
+		c.JSON(http.StatusNotFound, gin.H{"error": "provider not found"})
+		return
+	}
+
+	client, err := s.ldapClients.get(provider)
+	if err != nil {
+		s.logger.Error("Invalid LDAP provider configuration", zap.String("provider", provider.Name), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "provider is misconfigured"})
+		return
+	}
+
+	user, err := client.Authenticate(ctx, req.Username, req.Password)
+	if err != nil {
+		if errors.Is(err, ldap.ErrInvalidCredentials) {
+			s.logUserLogin(c, "", req.Username, "", "ldap", provider.Name, ipAddress, userAgent, "", false, "invalid credentials")
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
+			return
+		}
+		s.logger.Error("LDAP authentication failed", zap.String("provider", provider.Name), zap.Error(err))
+		s.logUserLogin(c, "", req.Username, "", "ldap", provider.Name, ipAddress, userAgent, "", false, "directory unavailable")
+		c.JSON(http.StatusBadGateway, gin.H{"error": "directory server unavailable"})
+		return
+	}
+
+	email := user.Email
+	if email == "" {
+		email = user.Username + "@" + provider.Name
+	}
+	name := user.Name
+	if name == "" {
+		name = user.Username
+	}
+
+	tokenBytes := make([]byte, 32)
+	if _, err := cryptoRand.Read(tokenBytes); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate session"})
+		return
+	}
+	token := base64.URLEncoding.EncodeToString(tokenBytes)
+
+	userID := "ldap:" + provider.Name + ":" + user.DN
+	expiresAt := time.Now().Add(s.config.Auth.Session.Validity)
+	if err := s.createSSOSession(ctx, userID, token, expiresAt, ipAddress, userAgent, user.Username, email, name, user.Groups); err != nil {
+		if err == errUserDeactivated {
+			s.logUserLogin(c, userID, email, name, "ldap", provider.Name, ipAddress, userAgent, "", false, "user deactivated")
+			c.JSON(http.StatusForbidden, gin.H{"error": errUserDeactivated.Error()})
+			return
+		}
+		s.logger.Error("Failed to create session", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create session"})
+		return
+	}
+
+	c.SetCookie(
+		s.config.Auth.Session.CookieName,
+		token,
+		int(s.config.Auth.Session.Validity.Seconds()),
+		"/",
+		"",
+		s.config.Auth.Session.Secure,
+		true, // httpOnly
+	)
+
+	s.logger.Info("LDAP login successful",
+		zap.String("provider", provider.Name),
+		zap.String("user", user.Username),
+		zap.String("email", email))
+	s.logUserLogin(c, userID, email, name, "ldap", provider.Name, ipAddress, userAgent, token, true, "")
+
+	c.JSON(http.StatusOK, gin.H{
+		"user": gin.H{
+			"username": user.Username,
+			"email":    email,
+			"name":     name,
+			"groups":   user.Groups,
+		},
+		"token": token,
+	})
+}
+
+// LDAP Provider HTTP Handlers
+
+func (s *Server) handleGetLDAPProvidersDynamic(c *gin.Context) {
+	providers, err := s.providerStore.GetLDAPProviders(c.Request.Context())
+	if err != nil {
+		s.logger.Error("Failed to get LDAP providers", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get providers"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"providers": providers,
+		"enabled":   len(providers) > 0,
+	})
+}
+
+func (s *Server) handleCreateLDAPProviderDynamic(c *gin.Context) {
+	var provider db.LDAPProvider
+	if !bindJSON(c, &provider) {
+		return
+	}
+
+	if provider.Name == "" || provider.URL == "" || provider.BaseDN == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name, url, and base_dn are required"})
+		return
+	}
+	if _, err := ldap.New(ldapConfig(&provider)); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := s.providerStore.CreateLDAPProvider(c.Request.Context(), &provider); err != nil {
+		if err == db.ErrProviderExists {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		s.logger.Error("Failed to create LDAP provider", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create provider"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "provider created", "name": provider.Name})
+}
+
+func (s *Server) handleUpdateLDAPProviderDynamic(c *gin.Context) {
+	name := c.Param("name")
+
+	var provider db.LDAPProvider
+	if !bindJSON(c, &provider) {
+		return
+	}
+	if _, err := ldap.New(ldapConfig(&provider)); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := s.providerStore.UpdateLDAPProvider(c.Request.Context(), name, &provider); err != nil {
+		if err == db.ErrProviderNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		s.logger.Error("Failed to update LDAP provider", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update provider"})
+		return
+	}
+	s.ldapClients.invalidate(name)
+
+	c.JSON(http.StatusOK, gin.H{"message": "provider updated", "name": name})
+}
+
+func (s *Server) handleDeleteLDAPProviderDynamic(c *gin.Context) {
+	name := c.Param("name")
+
+	if err := s.providerStore.DeleteLDAPProvider(c.Request.Context(), name); err != nil {
+		if err == db.ErrProviderNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		s.logger.Error("Failed to delete LDAP provider", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete provider"})
+		return
+	}
+	s.ldapClients.invalidate(name)
+
+	c.JSON(http.StatusOK, gin.H{"message": "provider deleted", "name": name})
+}
+
+// handleTestLDAPProvider checks that the directory is reachable and the service
+// account can bind and search the base DN.
+func (s *Server) handleTestLDAPProvider(c *gin.Context) {
+	provider, err := s.providerStore.GetLDAPProvider(c.Request.Context(), c.Param("name"))
+	if err != nil {
+		if errors.Is(err, db.ErrProviderNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "provider not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get provider"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), providerTestTimeout)
+	defer cancel()
+
+	r := &providerTestResult{Provider: provider.Name, Type: "ldap"}
+	// Use a fresh client so the test doesn't reuse a pooled connection
+	client, err := ldap.New(ldapConfig(provider))
+	if err != nil {
+		r.add("config", checkFail, err.Error(), "Fix the provider settings")
+	} else {
+		defer client.Close()
+		r.add("config", checkPass, "provider settings are valid", "")
+		if err := client.Test(ctx); err != nil {
+			r.add("connection", checkFail, err.Error(), "Check the URL, TLS settings and service account credentials, and that the base DN exists")
+		} else {
+			r.add("connection", checkPass, "bound as the service account and searched "+provider.BaseDN, "")
+		}
+	}
+	if provider.InsecureSkipVerify {
+		r.add("tls", checkWarn, "server certificate verification is disabled", "Set ca_cert instead of insecure_skip_verify outside of testing")
+	}
+
+	r.OK = !r.failed()
+	c.JSON(http.StatusOK, r)
+}
@@ -0,0 +1,60 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+
+	"github.com/gatekey-project/gatekey/internal/db"
+)
+
+var errLocalAuthDisabled = errors.New("local login is disabled")
+
+// localAuthEnabled reports whether local users may log in. SSO-only deployments
+// turn it off with the local_auth_enabled setting.
+func (s *Server) localAuthEnabled(ctx context.Context) bool {
+	return s.settingsStore.GetBool(ctx, db.SettingLocalAuthEnabled, true)
+}
+
+// localLoginAllowed reports whether a local user may log in or keep using their
+// session: anyone while local auth is enabled, and only auth.break_glass_users
+// while it is disabled.
+func (s *Server) localLoginAllowed(ctx context.Context, username string) bool {
+	return s.localAuthEnabled(ctx) || slices.Contains(s.config.Auth.BreakGlassUsers, username)
+}
+
+// getLocalSession returns the local user a session token belongs to. Sessions of
+// users who may no longer log in stop working when local auth is disabled.
+func (s *Server) getLocalSession(ctx context.Context, token string) (*db.LocalUser, error) {
+	_, user, err := s.userStore.GetSession(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if !s.localLoginAllowed(ctx, user.Username) {
+		return nil, errLocalAuthDisabled
+	}
+	return user, nil
+}
+
+// checkLocalAuthSetting validates a new local_auth_enabled value. Local auth can
+// only be turned off while an active SSO admin exists, so admins can't lock
+// themselves out.
+func (s *Server) checkLocalAuthSetting(ctx context.Context, value string) error {
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		return fmt.Errorf("local_auth_enabled must be true or false")
+	}
+	if enabled {
+		return nil
+	}
+	admins, err := s.userStore.CountSSOAdmins(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to check for SSO admins")
+	}
+	if admins == 0 {
+		return fmt.Errorf("local auth can't be disabled until an SSO user with admin rights has logged in")
+	}
+	return nil
+}
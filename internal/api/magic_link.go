@@ -0,0 +1,169 @@
+package api
+
+import (
+	"context"
+	cryptoRand "crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/gatekey-project/gatekey/internal/config"
+	"github.com/gatekey-project/gatekey/internal/db"
+	"github.com/gatekey-project/gatekey/internal/mail"
+)
+
+func mailConfig(cfg config.SMTPConfig) mail.Config {
+	return mail.Config{
+		Host:     cfg.Host,
+		Port:     cfg.Port,
+		Username: cfg.Username,
+		Password: cfg.Password,
+		From:     cfg.From,
+		TLS:      cfg.TLS,
+	}
+}
+
+// sendMail queues a message for delivery in the background so the caller doesn't
+// wait on the mail server, and so response times don't reveal whether an email
+// was sent.
+func (s *Server) sendMail(msg *mail.Message) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), notificationEnqueueTimeout)
+		defer cancel()
+		if err := s.notifications.Enqueue(ctx, notificationEmail, msg); err != nil {
+			s.logger.Error("Failed to queue email",
+				zap.Strings("to", msg.To),
+				zap.String("subject", msg.Subject),
+				zap.Error(err))
+		}
+	}()
+}
+
+// magicLinkSentMessage is returned whether or not the email matched a user, so
+// the endpoint can't be used to find out which addresses have accounts.
+const magicLinkSentMessage = "if an account exists for that email, a login link has been sent"
+
+// handleMagicLinkRequest emails a one-time login link to a local user.
+func (s *Server) handleMagicLinkRequest(c *gin.Context) {
+	if !s.config.Auth.MagicLink.Enabled || !s.localAuthEnabled(c.Request.Context()) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "magic link login is not enabled"})
+		return
+	}
+	baseURL := s.emailBaseURL()
+	if baseURL == "" {
+		// Config validation requires server.base_url with magic links
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "magic link login is not configured"})
+		return
+	}
+
+	var req struct {
+		Email string `json:"email" binding:"required"`
+	}
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	ctx := c.Request.Context()
+	email := strings.TrimSpace(req.Email)
+
+	user, err := s.userStore.GetLocalUserByEmail(ctx, email)
+	if err != nil || user.DeactivatedAt != nil {
+		if err != nil && !errors.Is(err, db.ErrUserNotFound) {
+			s.logger.Error("Failed to look up user for magic link", zap.Error(err))
+		}
+		c.JSON(http.StatusOK, gin.H{"message": magicLinkSentMessage})
+		return
+	}
+
+	// Don't let repeated requests flood the user's inbox
+	if last, err := s.userStore.LastMagicLinkSent(ctx, user.ID); err == nil && last != nil &&
+		time.Since(*last) < s.config.Auth.MagicLink.Resend {
+		c.JSON(http.StatusOK, gin.H{"message": magicLinkSentMessage})
+		return
+	}
+
+	tokenBytes := make([]byte, 32)
+	if _, err := cryptoRand.Read(tokenBytes); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate link"})
+		return
+	}
+	token := base64.RawURLEncoding.EncodeToString(tokenBytes)
+
+	ttl := s.config.Auth.MagicLink.TTL
+	if err := s.userStore.CreateMagicLinkToken(ctx, user.ID, token, getRealClientIP(c), time.Now().Add(ttl)); err != nil {
+		s.logger.Error("Failed to store magic link token", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate link"})
+		return
+	}
+
+	link := baseURL + "/api/v1/auth/magic/verify?token=" + url.QueryEscape(token)
+	s.sendMail(&mail.Message{
+		To:      []string{user.Email},
+		Subject: "Your GateKey login link",
+		Body: fmt.Sprintf("Hello %s,\n\n"+
+			"Use the link below to log in to GateKey. It expires in %s and can only be used once.\n\n"+
+			"%s\n\n"+
+			"If you didn't request this, you can ignore this email.\n",
+			user.Username, ttl, link),
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": magicLinkSentMessage})
+}
+
+// handleMagicLinkVerify consumes a magic-link token and logs the user in, the same
+// way a password login does.
+func (s *Server) handleMagicLinkVerify(c *gin.Context) {
+	if !s.config.Auth.MagicLink.Enabled || !s.localAuthEnabled(c.Request.Context()) {
+		c.Redirect(http.StatusFound, "/login?error=magic_link_disabled")
+		return
+	}
+
+	ctx := c.Request.Context()
+	ipAddress := getRealClientIP(c)
+	userAgent := c.GetHeader("User-Agent")
+
+	user, err := s.userStore.ConsumeMagicLinkToken(ctx, c.Query("token"))
+	if err != nil {
+		if !errors.Is(err, db.ErrMagicLinkInvalid) {
+			s.logger.Error("Failed to consume magic link token", zap.Error(err))
+		}
+		s.logUserLogin(c, "", "", "", "local", "magic-link", ipAddress, userAgent, "", false, "invalid or expired link")
+		c.Redirect(http.StatusFound, "/login?error=invalid_link")
+		return
+	}
+
+	tokenBytes := make([]byte, 32)
+	if _, err := cryptoRand.Read(tokenBytes); err != nil {
+		c.Redirect(http.StatusFound, "/login?error=session_error")
+		return
+	}
+	token := base64.URLEncoding.EncodeToString(tokenBytes)
+
+	expiresAt := time.Now().Add(s.config.Auth.Session.Validity)
+	if err := s.userStore.CreateSession(ctx, user.ID, token, expiresAt, ipAddress, userAgent); err != nil {
+		s.logger.Error("Failed to create session", zap.Error(err))
+		c.Redirect(http.StatusFound, "/login?error=session_error")
+		return
+	}
+
+	c.SetCookie(
+		s.config.Auth.Session.CookieName,
+		token,
+		int(s.config.Auth.Session.Validity.Seconds()),
+		"/",
+		"",
+		s.config.Auth.Session.Secure,
+		true, // httpOnly
+	)
+
+	s.logUserLogin(c, user.ID, user.Email, user.Username, "local", "magic-link", ipAddress, userAgent, token, true, "")
+
+	c.Redirect(http.StatusFound, s.postLoginRedirect())
+}
@@ -0,0 +1,408 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/gatekey-project/gatekey/internal/db"
+)
+
+// A CA rotation disrupts every gateway, hub and spoke, so admins can schedule
+// one for a maintenance window instead of running it by hand. When the window
+// opens the server activates the pending CA and reprovisions the whole fleet,
+// then watches the rollout; if too many components haven't converged by the
+// deadline it re-activates the previous CA, which is still trusted, and
+// reprovisions them back.
+
+const (
+	// maintenanceCheckInterval is how often windows are started and checked.
+	maintenanceCheckInterval = time.Minute
+	// defaultConvergeMinutes is how long components have to converge when the
+	// window doesn't say.
+	defaultConvergeMinutes = 60
+	// maxConvergeMinutes bounds converge_minutes.
+	maxConvergeMinutes = 24 * 60
+	// defaultMaxFailedPercent is the share of components that may fail to
+	// converge without a rollback when the window doesn't say.
+	defaultMaxFailedPercent = 10
+)
+
+// maintenanceDecision decides whether a running window is done, given how many
+// components have converged: completed once all have, or at the deadline if
+// few enough haven't; rolled back at the deadline otherwise. It returns "" to
+// keep waiting.
+func maintenanceDecision(w *db.MaintenanceWindow, converged, total int, now time.Time) string {
+	if converged >= total {
+		return db.MaintenanceCompleted
+	}
+	if now.Before(w.ConvergeDeadline()) {
+		return ""
+	}
+	if (total-converged)*100 > w.MaxFailedPercent*total {
+		return db.MaintenanceRolledBack
+	}
+	return db.MaintenanceCompleted
+}
+
+// runMaintenanceWindows periodically starts due maintenance windows and checks
+// on running ones.
+func (s *Server) runMaintenanceWindows(ctx context.Context) {
+	ticker := time.NewTicker(maintenanceCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.checkMaintenanceWindows(ctx)
+		}
+	}
+}
+
+func (s *Server) checkMaintenanceWindows(ctx context.Context) {
+	if s.ca == nil {
+		return
+	}
+	due, err := s.maintenanceStore.ClaimDue(ctx)
+	if err != nil {
+		s.logger.Error("Failed to claim due maintenance windows", zap.Error(err))
+		return
+	}
+	for _, w := range due {
+		s.startMaintenanceWindow(ctx, w)
+	}
+
+	running, err := s.maintenanceStore.ListRunning(ctx)
+	if err != nil {
+		s.logger.Error("Failed to list running maintenance windows", zap.Error(err))
+		return
+	}
+	for _, w := range running {
+		s.checkMaintenanceWindow(ctx, w, time.Now())
+	}
+}
+
+// reprovisionAll triggers a reprovision of every gateway, hub and spoke and
+// returns how many of each.
+func (s *Server) reprovisionAll(ctx context.Context) (gin.H, error) {
+	targets, _, msg := s.reprovisionTargets(ctx, &reprovisionRequest{All: true})
+	if targets == nil {
+		return nil, errors.New(msg)
+	}
+	gatewayIDs, hubIDs, spokeIDs, err := s.triggerBulkReprovision(ctx, targets)
+	if err != nil {
+		return nil, err
+	}
+	return gin.H{"gateways": len(gatewayIDs), "hubs": len(hubIDs), "spokes": len(spokeIDs)}, nil
+}
+
+// startMaintenanceWindow activates a claimed window's CA and reprovisions the
+// fleet. The window fails without changing anything if the CA is no longer
+// pending, such as when it was activated by hand.
+func (s *Server) startMaintenanceWindow(ctx context.Context, w *db.MaintenanceWindow) {
+	fail := func(reason string) {
+		s.logger.Error("Maintenance window failed", zap.String("id", w.ID), zap.String("reason", reason))
+		if _, err := s.maintenanceStore.Finish(ctx, w.ID, db.MaintenanceRunning, db.MaintenanceFailed, reason); err != nil {
+			s.logger.Error("Failed to record maintenance window outcome", zap.String("id", w.ID), zap.Error(err))
+		}
+		s.recordSystemAudit(ctx, "ca.maintenance.failed", "maintenance_window", w.ID, gin.H{
+			"caId":    w.CAID,
+			"outcome": reason,
+		})
+	}
+
+	previous, err := s.pkiStore.GetCA(ctx)
+	if err != nil {
+		fail("failed to get the active CA: " + err.Error())
+		return
+	}
+	ca, err := s.pkiStore.GetCAByID(ctx, w.CAID)
+	if err != nil {
+		fail(fmt.Sprintf("CA %s not found", w.CAID))
+		return
+	}
+	if ca.Status != db.CAStatusPending {
+		fail(fmt.Sprintf("CA %s is %s, not pending", w.CAID, ca.Status))
+		return
+	}
+	if err := s.maintenanceStore.SetPreviousCA(ctx, w.ID, previous.ID); err != nil {
+		fail("failed to record the active CA: " + err.Error())
+		return
+	}
+	if err := s.pkiStore.ActivateCA(ctx, w.CAID); err != nil {
+		fail("failed to activate CA: " + err.Error())
+		return
+	}
+	if err := s.reloadActiveCA(ctx); err != nil {
+		s.logger.Error("Failed to reload CA in memory", zap.Error(err))
+	}
+
+	details := gin.H{
+		"caId":             w.CAID,
+		"previousCaId":     previous.ID,
+		"convergeDeadline": w.ConvergeDeadline(),
+		"maxFailedPercent": w.MaxFailedPercent,
+	}
+	// Components still pick up the new CA from heartbeats without this
+	if reprovisioned, err := s.reprovisionAll(ctx); err != nil {
+		s.logger.Warn("Failed to reprovision for maintenance window", zap.String("id", w.ID), zap.Error(err))
+		details["reprovisionError"] = err.Error()
+	} else {
+		details["reprovisioned"] = reprovisioned
+	}
+
+	s.logger.Info("Maintenance window started: CA activated",
+		zap.String("id", w.ID),
+		zap.String("ca_id", w.CAID),
+		zap.String("previous_ca_id", previous.ID),
+		zap.Time("converge_deadline", w.ConvergeDeadline()))
+	s.recordSystemAudit(ctx, "ca.maintenance.started", "maintenance_window", w.ID, details)
+}
+
+// checkMaintenanceWindow completes a running window once the fleet has
+// converged, or rolls it back if too little has by the deadline.
+func (s *Server) checkMaintenanceWindow(ctx context.Context, w *db.MaintenanceWindow, now time.Time) {
+	progress, err := s.rolloutProgress(ctx)
+	if err != nil {
+		s.logger.Error("Failed to get reprovision progress for maintenance window", zap.String("id", w.ID), zap.Error(err))
+		return
+	}
+	converged, total := progress.counts[rolloutConverged], len(progress.components)
+	decision := maintenanceDecision(w, converged, total, now)
+	if decision == "" {
+		return
+	}
+
+	outcome := fmt.Sprintf("%d of %d components converged", converged, total)
+	details := gin.H{
+		"caId":         w.CAID,
+		"previousCaId": w.PreviousCAID,
+		"converged":    converged,
+		"pending":      progress.counts[rolloutPending],
+		"unknown":      progress.counts[rolloutUnknown],
+	}
+	if decision == db.MaintenanceRolledBack {
+		outcome += fmt.Sprintf(" by the deadline, more than %d%% failed; re-activated CA %s", w.MaxFailedPercent, w.PreviousCAID)
+	}
+	details["outcome"] = outcome
+
+	// Claim the outcome first, so only one server rolls back
+	claimed, err := s.maintenanceStore.Finish(ctx, w.ID, db.MaintenanceRunning, decision, outcome)
+	if err != nil {
+		s.logger.Error("Failed to record maintenance window outcome", zap.String("id", w.ID), zap.Error(err))
+		return
+	}
+	if !claimed {
+		return
+	}
+
+	if decision == db.MaintenanceCompleted {
+		s.logger.Info("Maintenance window completed", zap.String("id", w.ID), zap.String("outcome", outcome))
+		s.recordSystemAudit(ctx, "ca.maintenance.completed", "maintenance_window", w.ID, details)
+		return
+	}
+
+	if err := s.rollBackMaintenanceWindow(ctx, w, outcome); err != nil {
+		outcome += "; rollback failed: " + err.Error()
+		if _, err := s.maintenanceStore.Finish(ctx, w.ID, db.MaintenanceRolledBack, db.MaintenanceFailed, outcome); err != nil {
+			s.logger.Error("Failed to record maintenance window outcome", zap.String("id", w.ID), zap.Error(err))
+		}
+		s.logger.Error("Maintenance window rollback failed", zap.String("id", w.ID), zap.String("outcome", outcome))
+		details["outcome"] = outcome
+		s.recordSystemAudit(ctx, "ca.maintenance.failed", "maintenance_window", w.ID, details)
+		return
+	}
+	s.logger.Warn("Maintenance window rolled back", zap.String("id", w.ID), zap.String("outcome", outcome))
+	s.recordSystemAudit(ctx, "ca.maintenance.rolled_back", "maintenance_window", w.ID, details)
+}
+
+// rollBackMaintenanceWindow re-activates the CA that was active before a window
+// and reprovisions the fleet back to it. The window's CA goes back to pending,
+// so it stays trusted and can be scheduled again.
+func (s *Server) rollBackMaintenanceWindow(ctx context.Context, w *db.MaintenanceWindow, outcome string) error {
+	if w.PreviousCAID == "" {
+		return errors.New("no previous CA was recorded")
+	}
+	previous, err := s.pkiStore.GetCAByID(ctx, w.PreviousCAID)
+	if err != nil {
+		return fmt.Errorf("previous CA %s not found", w.PreviousCAID)
+	}
+	if previous.Status == db.CAStatusRevoked {
+		return fmt.Errorf("previous CA %s has been revoked", w.PreviousCAID)
+	}
+	if err := s.pkiStore.ActivateCA(ctx, w.PreviousCAID); err != nil {
+		return fmt.Errorf("failed to re-activate CA %s: %w", w.PreviousCAID, err)
+	}
+	if err := s.pkiStore.UpdateCAStatus(ctx, w.CAID, db.CAStatusPending); err != nil {
+		s.logger.Warn("Failed to return rolled back CA to pending", zap.String("ca_id", w.CAID), zap.Error(err))
+	}
+	if err := s.reloadActiveCA(ctx); err != nil {
+		s.logger.Error("Failed to reload CA in memory", zap.Error(err))
+	}
+	event := &db.CARotationEvent{
+		CAID:           w.PreviousCAID,
+		EventType:      "rolled_back",
+		NewFingerprint: previous.Fingerprint,
+		Notes:          "Maintenance window " + w.ID + ": " + outcome,
+	}
+	if ca, err := s.pkiStore.GetCAByID(ctx, w.CAID); err == nil {
+		event.OldFingerprint = ca.Fingerprint
+	}
+	_ = s.pkiStore.RecordRotationEvent(ctx, event) // Best effort
+	if _, err := s.reprovisionAll(ctx); err != nil {
+		s.logger.Warn("Failed to reprovision after maintenance window rollback", zap.String("id", w.ID), zap.Error(err))
+	}
+	return nil
+}
+
+// maintenanceWindowResponse is a maintenance window in API responses.
+func maintenanceWindowResponse(w *db.MaintenanceWindow) gin.H {
+	return gin.H{
+		"id":                 w.ID,
+		"ca_id":              w.CAID,
+		"description":        w.Description,
+		"scheduled_at":       w.ScheduledAt,
+		"converge_minutes":   w.ConvergeMinutes,
+		"max_failed_percent": w.MaxFailedPercent,
+		"converge_deadline":  w.ConvergeDeadline(),
+		"status":             w.Status,
+		"previous_ca_id":     w.PreviousCAID,
+		"outcome":            w.Outcome,
+		"created_by":         w.CreatedBy,
+		"created_at":         w.CreatedAt,
+		"started_at":         w.StartedAt,
+		"finished_at":        w.FinishedAt,
+	}
+}
+
+func (s *Server) handleListMaintenanceWindows(c *gin.Context) {
+	windows, err := s.maintenanceStore.List(c.Request.Context(), 100)
+	if err != nil {
+		s.logger.Error("Failed to list maintenance windows", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list maintenance windows"})
+		return
+	}
+	result := make([]gin.H, 0, len(windows))
+	for _, w := range windows {
+		result = append(result, maintenanceWindowResponse(w))
+	}
+	c.JSON(http.StatusOK, gin.H{"windows": result})
+}
+
+// handleScheduleMaintenanceWindow schedules the activation of a pending CA.
+func (s *Server) handleScheduleMaintenanceWindow(c *gin.Context) {
+	var req struct {
+		CAID             string    `json:"ca_id" binding:"required"`
+		ScheduledAt      time.Time `json:"scheduled_at" binding:"required"`
+		ConvergeMinutes  *int      `json:"converge_minutes"`
+		MaxFailedPercent *int      `json:"max_failed_percent"`
+		Description      string    `json:"description" binding:"max=500"`
+	}
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	w := &db.MaintenanceWindow{
+		CAID:             req.CAID,
+		Description:      req.Description,
+		ScheduledAt:      req.ScheduledAt,
+		ConvergeMinutes:  defaultConvergeMinutes,
+		MaxFailedPercent: defaultMaxFailedPercent,
+	}
+	if req.ConvergeMinutes != nil {
+		w.ConvergeMinutes = *req.ConvergeMinutes
+	}
+	if req.MaxFailedPercent != nil {
+		w.MaxFailedPercent = *req.MaxFailedPercent
+	}
+	if w.ConvergeMinutes < 1 || w.ConvergeMinutes > maxConvergeMinutes {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("converge_minutes must be between 1 and %d", maxConvergeMinutes)})
+		return
+	}
+	if w.MaxFailedPercent < 0 || w.MaxFailedPercent > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "max_failed_percent must be between 0 and 100"})
+		return
+	}
+	if !w.ScheduledAt.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "scheduled_at must be in the future"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	ca, err := s.pkiStore.GetCAByID(ctx, req.CAID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "CA not found"})
+		return
+	}
+	if ca.Status != db.CAStatusPending {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "CA is not in pending status"})
+		return
+	}
+	if user, err := s.getAuthenticatedUser(c); err == nil {
+		w.CreatedBy = user.Email
+	}
+
+	if err := s.maintenanceStore.Create(ctx, w); err != nil {
+		if err == db.ErrMaintenanceWindowExists {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		s.logger.Error("Failed to schedule maintenance window", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to schedule maintenance window"})
+		return
+	}
+
+	s.logger.Info("Maintenance window scheduled",
+		zap.String("id", w.ID),
+		zap.String("ca_id", w.CAID),
+		zap.Time("scheduled_at", w.ScheduledAt))
+	s.recordAudit(c, "ca.maintenance.scheduled", "maintenance_window", w.ID, gin.H{
+		"caId":             w.CAID,
+		"scheduledAt":      w.ScheduledAt,
+		"convergeMinutes":  w.ConvergeMinutes,
+		"maxFailedPercent": w.MaxFailedPercent,
+		"description":      w.Description,
+	})
+	c.JSON(http.StatusCreated, maintenanceWindowResponse(w))
+}
+
+// handleCancelMaintenanceWindow cancels a window that hasn't started. A running
+// window can't be cancelled, since the CA has already been activated.
+func (s *Server) handleCancelMaintenanceWindow(c *gin.Context) {
+	ctx := c.Request.Context()
+	w, err := s.maintenanceStore.Get(ctx, c.Param("id"))
+	if err == db.ErrMaintenanceWindowNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "maintenance window not found"})
+		return
+	}
+	if err != nil {
+		s.logger.Error("Failed to get maintenance window", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get maintenance window"})
+		return
+	}
+
+	outcome := "cancelled"
+	if user, err := s.getAuthenticatedUser(c); err == nil {
+		outcome += " by " + user.Email
+	}
+	cancelled, err := s.maintenanceStore.Finish(ctx, w.ID, db.MaintenanceScheduled, db.MaintenanceCancelled, outcome)
+	if err != nil {
+		s.logger.Error("Failed to cancel maintenance window", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to cancel maintenance window"})
+		return
+	}
+	if !cancelled {
+		c.JSON(http.StatusConflict, gin.H{"error": "only scheduled maintenance windows can be cancelled"})
+		return
+	}
+
+	s.recordAudit(c, "ca.maintenance.cancelled", "maintenance_window", w.ID, gin.H{"caId": w.CAID})
+	c.JSON(http.StatusOK, gin.H{"message": "maintenance window cancelled"})
+}
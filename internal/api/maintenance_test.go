@@ -0,0 +1,38 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gatekey-project/gatekey/internal/db"
+)
+
+func TestMaintenanceDecision(t *testing.T) {
+	started := time.Now().Add(-30 * time.Minute)
+	w := &db.MaintenanceWindow{ConvergeMinutes: 60, MaxFailedPercent: 10, StartedAt: &started}
+	beforeDeadline := started.Add(59 * time.Minute)
+	afterDeadline := started.Add(61 * time.Minute)
+
+	tests := []struct {
+		name             string
+		converged, total int
+		now              time.Time
+		want             string
+	}{
+		{"all converged early", 20, 20, beforeDeadline, db.MaintenanceCompleted},
+		{"nothing to converge", 0, 0, beforeDeadline, db.MaintenanceCompleted},
+		{"still converging", 5, 20, beforeDeadline, ""},
+		{"few failed by the deadline", 18, 20, afterDeadline, db.MaintenanceCompleted},
+		{"too many failed by the deadline", 17, 20, afterDeadline, db.MaintenanceRolledBack},
+	}
+	for _, tt := range tests {
+		if got := maintenanceDecision(w, tt.converged, tt.total, tt.now); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	strict := &db.MaintenanceWindow{ConvergeMinutes: 60, StartedAt: &started}
+	if got := maintenanceDecision(strict, 19, 20, afterDeadline); got != db.MaintenanceRolledBack {
+		t.Errorf("max_failed_percent 0 with one failure: got %q, want rolled back", got)
+	}
+}
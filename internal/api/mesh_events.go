@@ -0,0 +1,164 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/gatekey-project/gatekey/internal/db"
+)
+
+// meshEventRetentionDays is how long mesh lifecycle events are kept.
+const meshEventRetentionDays = 90
+
+// meshHeartbeatTimeout is how long after its last heartbeat a hub or spoke is
+// shown as offline, as in the hub and spoke lists.
+const meshHeartbeatTimeout = 2 * time.Minute
+
+// previousMeshStatus returns the status a hub or spoke had before a heartbeat
+// arrived: offline if its last heartbeat timed out, otherwise its stored status.
+func previousMeshStatus(stored string, lastHeartbeat *time.Time, offline string, now time.Time) string {
+	if lastHeartbeat != nil && now.Sub(*lastHeartbeat) >= meshHeartbeatTimeout {
+		return offline
+	}
+	return stored
+}
+
+// meshStatusChange describes a status change for a status_changed event.
+func meshStatusChange(from, to, statusMessage string) string {
+	message := fmt.Sprintf("%s -> %s", from, to)
+	if statusMessage != "" {
+		message += ": " + statusMessage
+	}
+	return message
+}
+
+// hubEvent returns an event of eventType for a hub.
+func hubEvent(hub *db.MeshHub, eventType, outcome, message string) *db.MeshEvent {
+	return &db.MeshEvent{
+		ComponentType: db.ComponentHub,
+		ComponentID:   hub.ID,
+		ComponentName: hub.Name,
+		HubID:         hub.ID,
+		EventType:     eventType,
+		Outcome:       outcome,
+		Message:       message,
+	}
+}
+
+// spokeEvent returns an event of eventType for a spoke.
+func spokeEvent(spoke *db.MeshSpoke, eventType, outcome, message string) *db.MeshEvent {
+	return &db.MeshEvent{
+		ComponentType: db.ComponentSpoke,
+		ComponentID:   spoke.ID,
+		ComponentName: spoke.Name,
+		HubID:         spoke.HubID,
+		EventType:     eventType,
+		Outcome:       outcome,
+		Message:       message,
+	}
+}
+
+// recordMeshEvent stores a mesh lifecycle event. Failures are only logged, since
+// the event history must never get in the way of the mesh itself.
+func (s *Server) recordMeshEvent(ctx context.Context, e *db.MeshEvent) {
+	if err := s.meshEventStore.Record(ctx, e); err != nil {
+		s.logger.Warn("Failed to record mesh event",
+			zap.String("component", e.ComponentName),
+			zap.String("event", e.EventType),
+			zap.Error(err))
+	}
+}
+
+// recordMeshEventOnce stores a mesh event for a condition reported on every
+// heartbeat, unless it's already the component's latest event.
+func (s *Server) recordMeshEventOnce(ctx context.Context, e *db.MeshEvent) {
+	if _, err := s.meshEventStore.RecordUnlessRepeated(ctx, e); err != nil {
+		s.logger.Warn("Failed to record mesh event",
+			zap.String("component", e.ComponentName),
+			zap.String("event", e.EventType),
+			zap.Error(err))
+	}
+}
+
+// recordHubRoutesChanged records a routes_changed event for a hub a network was
+// assigned to or removed from.
+func (s *Server) recordHubRoutesChanged(ctx context.Context, hubID, networkID, change string) {
+	hub, err := s.meshStore.GetHub(ctx, hubID)
+	if err != nil {
+		return
+	}
+	network := networkID
+	if n, err := s.networkStore.GetNetwork(ctx, networkID); err == nil {
+		network = fmt.Sprintf("%s (%s)", n.Name, n.CIDR)
+	}
+	s.recordMeshEvent(ctx, hubEvent(hub, db.MeshEventRoutesChanged, db.MeshEventSuccess, "network "+network+" "+change))
+}
+
+// recordMeshProvisionOutcome records e as a provisioned event once the handler has
+// responded, replacing its message with the status if the response was an error.
+// It's deferred by the provisioning handlers, which fail in many places.
+func (s *Server) recordMeshProvisionOutcome(c *gin.Context, e *db.MeshEvent) {
+	e.EventType = db.MeshEventProvisioned
+	if status := c.Writer.Status(); status >= http.StatusBadRequest {
+		e.Outcome = db.MeshEventFailure
+		e.Message = fmt.Sprintf("provisioning failed with HTTP %d", status)
+	} else {
+		e.Outcome = db.MeshEventSuccess
+	}
+	s.recordMeshEvent(context.WithoutCancel(c.Request.Context()), e)
+}
+
+func (s *Server) handleListMeshEvents(c *gin.Context) {
+	filter := &db.MeshEventFilter{
+		HubID:         c.Query("hub_id"),
+		ComponentType: c.Query("component_type"),
+		ComponentID:   c.Query("component_id"),
+		EventType:     c.Query("event_type"),
+		Outcome:       c.Query("outcome"),
+		Limit:         50,
+	}
+	filter.StartTime, filter.EndTime = timeRangeFromQuery(c)
+
+	if limitStr := c.Query("limit"); limitStr != "" {
+		if limit, err := strconv.Atoi(limitStr); err == nil && limit > 0 && limit <= 500 {
+			filter.Limit = limit
+		}
+	}
+	if offsetStr := c.Query("offset"); offsetStr != "" {
+		if offset, err := strconv.Atoi(offsetStr); err == nil && offset >= 0 {
+			filter.Offset = offset
+		}
+	}
+
+	events, total, err := s.meshEventStore.List(c.Request.Context(), filter)
+	if err != nil {
+		s.logger.Error("Failed to list mesh events", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list mesh events"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"events": events,
+		"total":  total,
+		"limit":  filter.Limit,
+		"offset": filter.Offset,
+	})
+}
+
+// cleanupOldMeshEvents deletes mesh events older than meshEventRetentionDays
+func (s *Server) cleanupOldMeshEvents(ctx context.Context) {
+	count, err := s.meshEventStore.DeleteOlderThan(ctx, meshEventRetentionDays)
+	if err != nil {
+		s.logger.Error("Failed to cleanup old mesh events", zap.Error(err))
+		return
+	}
+	if count > 0 {
+		s.logger.Info("Cleaned up old mesh events", zap.Int64("deleted", count))
+	}
+}
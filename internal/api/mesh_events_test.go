@@ -0,0 +1,42 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gatekey-project/gatekey/internal/db"
+)
+
+func TestPreviousMeshStatus(t *testing.T) {
+	now := time.Now()
+	recent := now.Add(-30 * time.Second)
+	stale := now.Add(-5 * time.Minute)
+
+	tests := []struct {
+		name          string
+		stored        string
+		lastHeartbeat *time.Time
+		want          string
+	}{
+		{"never heartbeated", db.MeshHubStatusPending, nil, db.MeshHubStatusPending},
+		{"recent heartbeat", db.MeshHubStatusOnline, &recent, db.MeshHubStatusOnline},
+		{"recent error", db.MeshHubStatusError, &recent, db.MeshHubStatusError},
+		{"timed out", db.MeshHubStatusOnline, &stale, db.MeshHubStatusOffline},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := previousMeshStatus(tt.stored, tt.lastHeartbeat, db.MeshHubStatusOffline, now); got != tt.want {
+				t.Errorf("previousMeshStatus() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMeshStatusChange(t *testing.T) {
+	if got := meshStatusChange("offline", "online", ""); got != "offline -> online" {
+		t.Errorf("meshStatusChange() = %q", got)
+	}
+	if got := meshStatusChange("online", "error", "openvpn exited"); got != "online -> error: openvpn exited" {
+		t.Errorf("meshStatusChange() = %q", got)
+	}
+}
@@ -11,12 +11,14 @@ import (
 	"fmt"
 	"math/big"
 	"net/http"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 
+	"github.com/gatekey-project/gatekey/internal/agent"
 	"github.com/gatekey-project/gatekey/internal/db"
 	"github.com/gatekey-project/gatekey/internal/pki"
 )
@@ -56,6 +58,7 @@ func (s *Server) handleListMeshHubs(c *gin.Context) {
 			"vpnSubnet":        hub.VPNSubnet,
 			"cryptoProfile":    hub.CryptoProfile,
 			"tlsAuthEnabled":   hub.TLSAuthEnabled,
+			"tlsMode":          hub.TLSMode,
 			"fullTunnelMode":   hub.FullTunnelMode,
 			"pushDns":          hub.PushDNS,
 			"dnsServers":       hub.DNSServers,
@@ -87,10 +90,14 @@ func (s *Server) handleCreateMeshHub(c *gin.Context) {
 		VPNSubnet      string `json:"vpnSubnet"`
 		CryptoProfile  string `json:"cryptoProfile"`
 		TLSAuthEnabled bool   `json:"tlsAuthEnabled"`
+		TLSMode        string `json:"tlsMode"`
 	}
 
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &req) {
+		return
+	}
+	if req.TLSMode != "" && !isValidTLSMode(req.TLSMode) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid tlsMode, must be: auth or crypt"})
 		return
 	}
 
@@ -102,17 +109,7 @@ func (s *Server) handleCreateMeshHub(c *gin.Context) {
 		return
 	}
 
-	// Determine control plane URL from request
-	// Check X-Forwarded-Proto header first (for reverse proxy/Istio)
-	scheme := c.GetHeader("X-Forwarded-Proto")
-	if scheme == "" {
-		if c.Request.TLS != nil {
-			scheme = "https"
-		} else {
-			scheme = "http"
-		}
-	}
-	controlPlaneURL := fmt.Sprintf("%s://%s", scheme, c.Request.Host)
+	controlPlaneURL := s.baseURL(c)
 
 	hub := &db.MeshHub{
 		Name:            req.Name,
@@ -123,6 +120,7 @@ func (s *Server) handleCreateMeshHub(c *gin.Context) {
 		VPNSubnet:       req.VPNSubnet,
 		CryptoProfile:   req.CryptoProfile,
 		TLSAuthEnabled:  req.TLSAuthEnabled,
+		TLSMode:         req.TLSMode,
 		APIToken:        apiToken,
 		ControlPlaneURL: controlPlaneURL,
 		Status:          db.MeshHubStatusPending,
@@ -150,6 +148,7 @@ func (s *Server) handleCreateMeshHub(c *gin.Context) {
 			"vpnSubnet":       hub.VPNSubnet,
 			"cryptoProfile":   hub.CryptoProfile,
 			"tlsAuthEnabled":  hub.TLSAuthEnabled,
+			"tlsMode":         hub.TLSMode,
 			"apiToken":        apiToken, // Only shown once at creation
 			"controlPlaneUrl": controlPlaneURL,
 			"status":          hub.Status,
@@ -184,6 +183,7 @@ func (s *Server) handleGetMeshHub(c *gin.Context) {
 			"vpnSubnet":        hub.VPNSubnet,
 			"cryptoProfile":    hub.CryptoProfile,
 			"tlsAuthEnabled":   hub.TLSAuthEnabled,
+			"tlsMode":          hub.TLSMode,
 			"fullTunnelMode":   hub.FullTunnelMode,
 			"pushDns":          hub.PushDNS,
 			"dnsServers":       hub.DNSServers,
@@ -214,14 +214,14 @@ func (s *Server) handleUpdateMeshHub(c *gin.Context) {
 		VPNSubnet      string   `json:"vpnSubnet"`
 		CryptoProfile  string   `json:"cryptoProfile"`
 		TLSAuthEnabled *bool    `json:"tlsAuthEnabled"`
+		TLSMode        string   `json:"tlsMode"`
 		FullTunnelMode *bool    `json:"fullTunnelMode"`
 		PushDNS        *bool    `json:"pushDns"`
-		DNSServers     []string `json:"dnsServers"`
-		LocalNetworks  []string `json:"localNetworks"`
+		DNSServers     []string `json:"dnsServers" binding:"max=16"`
+		LocalNetworks  []string `json:"localNetworks" binding:"max=256"`
 	}
 
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &req) {
 		return
 	}
 
@@ -262,6 +262,13 @@ func (s *Server) handleUpdateMeshHub(c *gin.Context) {
 	if req.TLSAuthEnabled != nil {
 		hub.TLSAuthEnabled = *req.TLSAuthEnabled
 	}
+	if req.TLSMode != "" {
+		if !isValidTLSMode(req.TLSMode) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid tlsMode, must be: auth or crypt"})
+			return
+		}
+		hub.TLSMode = req.TLSMode
+	}
 	if req.FullTunnelMode != nil {
 		hub.FullTunnelMode = *req.FullTunnelMode
 	}
@@ -321,6 +328,7 @@ func (s *Server) handleProvisionMeshHub(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get mesh hub"})
 		return
 	}
+	defer s.recordMeshProvisionOutcome(c, hubEvent(hub, "", "", "PKI regenerated by admin"))
 
 	// Check if we have a CA
 	if s.ca == nil {
@@ -346,8 +354,8 @@ func (s *Server) handleProvisionMeshHub(c *gin.Context) {
 		return
 	}
 
-	// Generate DH params placeholder (hub will generate actual DH params)
-	dhParams := "# DH parameters will be generated on the hub server\n"
+	// Hubs use ECDHE ("dh none"), so there are no DH params to send
+	dhParams := ""
 
 	// Generate TLS-Auth key if enabled
 	var tlsAuthKey string
@@ -368,7 +376,7 @@ func (s *Server) handleProvisionMeshHub(c *gin.Context) {
 	}
 
 	// Compute config version hash (includes TLSAuthKey and CA cert hash for rotation detection)
-	configVersion := computeConfigVersion(hub.VPNPort, hub.VPNProtocol, hub.VPNSubnet, hub.CryptoProfile, hub.TLSAuthEnabled, hub.TLSAuthKey, hub.CACert)
+	configVersion := computeConfigVersion(hub.VPNPort, hub.VPNProtocol, hub.VPNSubnet, hub.CryptoProfile, hub.TLSAuthEnabled, hub.TLSMode, hub.TLSAuthKey, hub.CACert)
 
 	c.JSON(http.StatusOK, gin.H{
 		"message":       "hub provisioned successfully",
@@ -424,18 +432,18 @@ func (s *Server) handleAssignMeshHubUser(c *gin.Context) {
 	var req struct {
 		UserID string `json:"userId" binding:"required"`
 	}
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &req) {
 		return
 	}
 
-	if err := s.meshStore.AssignUserToHub(ctx, hubID, req.UserID); err != nil {
+	created, err := s.meshStore.AssignUserToHub(ctx, hubID, req.UserID)
+	if err != nil {
 		s.logger.Error("Failed to assign user to hub", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to assign user to hub"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "user assigned to hub"})
+	c.JSON(http.StatusOK, gin.H{"message": "user assigned to hub", "created": created})
 }
 
 func (s *Server) handleRemoveMeshHubUser(c *gin.Context) {
@@ -473,18 +481,18 @@ func (s *Server) handleAssignMeshHubGroup(c *gin.Context) {
 	var req struct {
 		GroupName string `json:"groupName" binding:"required"`
 	}
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &req) {
 		return
 	}
 
-	if err := s.meshStore.AssignGroupToHub(ctx, hubID, req.GroupName); err != nil {
+	created, err := s.meshStore.AssignGroupToHub(ctx, hubID, req.GroupName)
+	if err != nil {
 		s.logger.Error("Failed to assign group to hub", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to assign group to hub"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "group assigned to hub"})
+	c.JSON(http.StatusOK, gin.H{"message": "group assigned to hub", "created": created})
 }
 
 func (s *Server) handleRemoveMeshHubGroup(c *gin.Context) {
@@ -535,18 +543,21 @@ func (s *Server) handleAssignMeshHubNetwork(c *gin.Context) {
 	var req struct {
 		NetworkID string `json:"networkId" binding:"required"`
 	}
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &req) {
 		return
 	}
 
-	if err := s.meshStore.AssignNetworkToHub(ctx, hubID, req.NetworkID); err != nil {
+	created, err := s.meshStore.AssignNetworkToHub(ctx, hubID, req.NetworkID)
+	if err != nil {
 		s.logger.Error("Failed to assign network to hub", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to assign network to hub"})
 		return
 	}
+	if created {
+		s.recordHubRoutesChanged(ctx, hubID, req.NetworkID, "assigned")
+	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "network assigned to hub"})
+	c.JSON(http.StatusOK, gin.H{"message": "network assigned to hub", "created": created})
 }
 
 func (s *Server) handleRemoveMeshHubNetwork(c *gin.Context) {
@@ -559,6 +570,7 @@ func (s *Server) handleRemoveMeshHubNetwork(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to remove network from hub"})
 		return
 	}
+	s.recordHubRoutesChanged(ctx, hubID, networkID, "removed")
 
 	c.JSON(http.StatusOK, gin.H{"message": "network removed from hub"})
 }
@@ -616,6 +628,10 @@ func (s *Server) handleListMeshSpokes(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"spokes": result})
 }
 
+// spokeNameError explains the spoke name rules. Spoke names end up in certificate
+// common names and file names on the hub.
+const spokeNameError = "name must be at most 63 letters, digits, '.', '_', '@' or '-', starting with a letter or digit"
+
 func (s *Server) handleCreateMeshSpoke(c *gin.Context) {
 	ctx := c.Request.Context()
 	hubID := c.Param("id")
@@ -623,11 +639,14 @@ func (s *Server) handleCreateMeshSpoke(c *gin.Context) {
 	var req struct {
 		Name          string   `json:"name" binding:"required"`
 		Description   string   `json:"description"`
-		LocalNetworks []string `json:"localNetworks"`
+		LocalNetworks []string `json:"localNetworks" binding:"max=256"`
 	}
 
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &req) {
+		return
+	}
+	if !agent.ValidNodeName(req.Name) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": spokeNameError})
 		return
 	}
 
@@ -729,14 +748,13 @@ func (s *Server) handleUpdateMeshSpoke(c *gin.Context) {
 	var req struct {
 		Name           string   `json:"name"`
 		Description    string   `json:"description"`
-		LocalNetworks  []string `json:"localNetworks"`
+		LocalNetworks  []string `json:"localNetworks" binding:"max=256"`
 		FullTunnelMode *bool    `json:"fullTunnelMode"`
 		PushDNS        *bool    `json:"pushDns"`
-		DNSServers     []string `json:"dnsServers"`
+		DNSServers     []string `json:"dnsServers" binding:"max=16"`
 	}
 
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &req) {
 		return
 	}
 
@@ -752,12 +770,18 @@ func (s *Server) handleUpdateMeshSpoke(c *gin.Context) {
 	}
 
 	if req.Name != "" {
+		if !agent.ValidNodeName(req.Name) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": spokeNameError})
+			return
+		}
 		gw.Name = req.Name
 	}
 	if req.Description != "" {
 		gw.Description = req.Description
 	}
+	routesChanged := false
 	if req.LocalNetworks != nil {
+		routesChanged = !slices.Equal(gw.LocalNetworks, req.LocalNetworks)
 		gw.LocalNetworks = req.LocalNetworks
 	}
 	if req.FullTunnelMode != nil {
@@ -780,6 +804,11 @@ func (s *Server) handleUpdateMeshSpoke(c *gin.Context) {
 		return
 	}
 
+	if routesChanged {
+		s.recordMeshEvent(ctx, spokeEvent(gw, db.MeshEventRoutesChanged, db.MeshEventSuccess,
+			"local networks set to "+strings.Join(gw.LocalNetworks, ", ")))
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "spoke updated"})
 }
 
@@ -814,6 +843,7 @@ func (s *Server) handleProvisionMeshSpoke(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get mesh spoke"})
 		return
 	}
+	defer s.recordMeshProvisionOutcome(c, spokeEvent(gw, "", "", "certificate regenerated by admin"))
 
 	// Get the hub to access its CA
 	hub, err := s.meshStore.GetHub(ctx, gw.HubID)
@@ -909,18 +939,18 @@ func (s *Server) handleAssignMeshSpokeUser(c *gin.Context) {
 	var req struct {
 		UserID string `json:"userId" binding:"required"`
 	}
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &req) {
 		return
 	}
 
-	if err := s.meshStore.AddUserToSpoke(ctx, spokeID, req.UserID); err != nil {
+	created, err := s.meshStore.AddUserToSpoke(ctx, spokeID, req.UserID)
+	if err != nil {
 		s.logger.Error("Failed to assign user to spoke", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to assign user"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "user assigned"})
+	c.JSON(http.StatusOK, gin.H{"message": "user assigned", "created": created})
 }
 
 func (s *Server) handleRemoveMeshSpokeUser(c *gin.Context) {
@@ -958,18 +988,18 @@ func (s *Server) handleAssignMeshSpokeGroup(c *gin.Context) {
 	var req struct {
 		GroupName string `json:"groupName" binding:"required"`
 	}
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &req) {
 		return
 	}
 
-	if err := s.meshStore.AddGroupToSpoke(ctx, spokeID, req.GroupName); err != nil {
+	created, err := s.meshStore.AddGroupToSpoke(ctx, spokeID, req.GroupName)
+	if err != nil {
 		s.logger.Error("Failed to assign group to spoke", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to assign group"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "group assigned"})
+	c.JSON(http.StatusOK, gin.H{"message": "group assigned", "created": created})
 }
 
 func (s *Server) handleRemoveMeshSpokeGroup(c *gin.Context) {
@@ -1000,8 +1030,7 @@ func (s *Server) handleMeshHubHeartbeat(c *gin.Context) {
 		ConfigVersion    string `json:"configVersion"`
 	}
 
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &req) {
 		return
 	}
 
@@ -1024,10 +1053,31 @@ func (s *Server) handleMeshHubHeartbeat(c *gin.Context) {
 	if err := s.meshStore.UpdateHubStatus(ctx, hub.ID, status, req.StatusMessage, req.ConnectedSpokes, req.ConnectedClients); err != nil {
 		s.logger.Error("Failed to update hub status", zap.Error(err))
 	}
+	if prev := previousMeshStatus(hub.Status, hub.LastHeartbeat, db.MeshHubStatusOffline, time.Now()); prev != status {
+		event := hubEvent(hub, db.MeshEventStatusChanged, db.MeshEventSuccess, meshStatusChange(prev, status, req.StatusMessage))
+		if status == db.MeshHubStatusError {
+			event.Outcome = db.MeshEventFailure
+		}
+		event.RemoteIP = c.ClientIP()
+		s.recordMeshEvent(ctx, event)
+	}
 
 	// Check if config version matches (includes TLSAuthKey and CA cert hash for rotation detection)
-	expectedVersion := computeConfigVersion(hub.VPNPort, hub.VPNProtocol, hub.VPNSubnet, hub.CryptoProfile, hub.TLSAuthEnabled, hub.TLSAuthKey, hub.CACert)
+	expectedVersion := computeConfigVersion(hub.VPNPort, hub.VPNProtocol, hub.VPNSubnet, hub.CryptoProfile, hub.TLSAuthEnabled, hub.TLSMode, hub.TLSAuthKey, hub.CACert)
 	needsReprovision := req.ConfigVersion != "" && req.ConfigVersion != expectedVersion
+	s.recordHeartbeatVersion(ctx, db.ComponentHub, hub.ID, req.ConfigVersion)
+
+	reason := "config version mismatch"
+
+	// An admin-requested reprovision regenerates the Sub-CA after a root CA rotation
+	if !needsReprovision && s.meshReprovisionRequested(ctx, db.ComponentHub, hub.ID) {
+		s.logger.Info("Hub reprovision requested, signaling reprovision", zap.String("hub", hub.Name))
+		needsReprovision = true
+		reason = "reprovision requested by admin"
+	}
+	if needsReprovision {
+		s.recordMeshEventOnce(ctx, hubEvent(hub, db.MeshEventReprovisionSignaled, db.MeshEventSuccess, reason))
+	}
 
 	// Get Root CA fingerprint for rotation detection
 	rootCAFingerprint := ""
@@ -1036,10 +1086,11 @@ func (s *Server) handleMeshHubHeartbeat(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"ok":                true,
-		"needsReprovision":  needsReprovision,
-		"configVersion":     expectedVersion,
-		"rootCAFingerprint": rootCAFingerprint,
+		"ok":                   true,
+		"needsReprovision":     needsReprovision,
+		"configVersion":        expectedVersion,
+		"rootCAFingerprint":    rootCAFingerprint,
+		"minHeartbeatInterval": s.minHeartbeatInterval(),
 	})
 }
 
@@ -1050,8 +1101,7 @@ func (s *Server) handleMeshHubProvisionRequest(c *gin.Context) {
 		Token string `json:"token" binding:"required"`
 	}
 
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &req) {
 		return
 	}
 
@@ -1074,6 +1124,13 @@ func (s *Server) handleMeshHubProvisionRequest(c *gin.Context) {
 		needsNewPKI = s.hubSubCANeedsRegeneration(hub.CACert)
 	}
 
+	event := hubEvent(hub, "", "", "existing PKI")
+	event.RemoteIP = c.ClientIP()
+	if needsNewPKI {
+		event.Message = "new PKI generated"
+	}
+	defer s.recordMeshProvisionOutcome(c, event)
+
 	if needsNewPKI {
 		s.logger.Info("Auto-provisioning hub PKI", zap.String("hub", hub.Name), zap.Bool("existing_pki", hub.CACert != ""))
 
@@ -1101,8 +1158,8 @@ func (s *Server) handleMeshHubProvisionRequest(c *gin.Context) {
 			return
 		}
 
-		// Generate DH params placeholder (hub will generate actual DH params)
-		dhParams := "# DH parameters will be generated on the hub server\n"
+		// Hubs use ECDHE ("dh none"), so there are no DH params to send
+		dhParams := ""
 
 		// Generate TLS-Auth key if enabled
 		var tlsAuthKey string
@@ -1139,6 +1196,7 @@ func (s *Server) handleMeshHubProvisionRequest(c *gin.Context) {
 		rootCACert := string(s.ca.CertificatePEM())
 		fullCAChain = hub.CACert + "\n" + rootCACert
 	}
+	s.recordProvisioned(ctx, db.ComponentHub, hub.ID)
 
 	c.JSON(http.StatusOK, gin.H{
 		"cacert":         fullCAChain,
@@ -1147,11 +1205,12 @@ func (s *Server) handleMeshHubProvisionRequest(c *gin.Context) {
 		"dhparams":       hub.DHParams,
 		"tlsauthenabled": hub.TLSAuthEnabled,
 		"tlsauthkey":     hub.TLSAuthKey,
+		"tlsmode":        hub.TLSMode,
 		"vpnport":        hub.VPNPort,
 		"vpnprotocol":    hub.VPNProtocol,
 		"vpnsubnet":      hub.VPNSubnet,
 		"cryptoprofile":  hub.CryptoProfile,
-		"configversion":  computeConfigVersion(hub.VPNPort, hub.VPNProtocol, hub.VPNSubnet, hub.CryptoProfile, hub.TLSAuthEnabled, hub.TLSAuthKey, hub.CACert),
+		"configversion":  computeConfigVersion(hub.VPNPort, hub.VPNProtocol, hub.VPNSubnet, hub.CryptoProfile, hub.TLSAuthEnabled, hub.TLSMode, hub.TLSAuthKey, hub.CACert),
 	})
 }
 
@@ -1223,8 +1282,7 @@ func (s *Server) handleMeshSpokeConnected(c *gin.Context) {
 		RemoteIP string `json:"remoteIp"`
 	}
 
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &req) {
 		return
 	}
 
@@ -1241,6 +1299,20 @@ func (s *Server) handleMeshSpokeConnected(c *gin.Context) {
 		zap.String("hub", hub.Name),
 		zap.String("remoteIp", req.RemoteIP))
 
+	// The hub doesn't say which spoke connected, so match the address it last
+	// reported and fall back to recording the connect against the hub
+	event := hubEvent(hub, db.MeshEventSpokeConnected, db.MeshEventSuccess, "unidentified spoke")
+	if spokes, err := s.meshStore.ListMeshSpokesByHub(ctx, hub.ID); err == nil && req.RemoteIP != "" {
+		for _, spoke := range spokes {
+			if spoke.RemoteIP == req.RemoteIP {
+				event = spokeEvent(spoke, db.MeshEventSpokeConnected, db.MeshEventSuccess, "")
+				break
+			}
+		}
+	}
+	event.RemoteIP = req.RemoteIP
+	s.recordMeshEvent(ctx, event)
+
 	c.JSON(http.StatusOK, gin.H{"ok": true})
 }
 
@@ -1253,8 +1325,7 @@ func (s *Server) handleMeshSpokeDisconnected(c *gin.Context) {
 		RemoteIP string `json:"remoteIp"`
 	}
 
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &req) {
 		return
 	}
 
@@ -1273,6 +1344,15 @@ func (s *Server) handleMeshSpokeDisconnected(c *gin.Context) {
 		_ = s.meshStore.UpdateMeshSpokeStatus(ctx, req.SpokeID, db.MeshSpokeStatusDisconnected, "Disconnected", "", 0, 0)
 	}
 
+	event := hubEvent(hub, db.MeshEventSpokeDisconnected, db.MeshEventSuccess, "unidentified spoke")
+	if req.SpokeID != "" {
+		if spoke, err := s.meshStore.GetMeshSpoke(ctx, req.SpokeID); err == nil && spoke.HubID == hub.ID {
+			event = spokeEvent(spoke, db.MeshEventSpokeDisconnected, db.MeshEventSuccess, "")
+		}
+	}
+	event.RemoteIP = req.RemoteIP
+	s.recordMeshEvent(ctx, event)
+
 	c.JSON(http.StatusOK, gin.H{"ok": true})
 }
 
@@ -1286,8 +1366,7 @@ func (s *Server) handleMeshClientConnected(c *gin.Context) {
 		TunnelIP string `json:"tunnelIp"`
 	}
 
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &req) {
 		return
 	}
 
@@ -1314,8 +1393,7 @@ func (s *Server) handleMeshClientDisconnected(c *gin.Context) {
 		TunnelIP string `json:"tunnelIp"`
 	}
 
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &req) {
 		return
 	}
 
@@ -1343,8 +1421,7 @@ func (s *Server) handleMeshClientRules(c *gin.Context) {
 		ClientEmail string `json:"clientEmail" binding:"required"`
 	}
 
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &req) {
 		return
 	}
 
@@ -1381,11 +1458,10 @@ func (s *Server) handleMeshAllClientRules(c *gin.Context) {
 
 	var req struct {
 		Token   string   `json:"token" binding:"required"`
-		Clients []string `json:"clients"` // List of client emails to get rules for
+		Clients []string `json:"clients" binding:"max=10000"` // List of client emails to get rules for
 	}
 
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &req) {
 		return
 	}
 
@@ -1422,8 +1498,7 @@ func (s *Server) handleMeshSpokeProvisionRequest(c *gin.Context) {
 		Token string `json:"token" binding:"required"`
 	}
 
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &req) {
 		return
 	}
 
@@ -1437,6 +1512,9 @@ func (s *Server) handleMeshSpokeProvisionRequest(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to authenticate"})
 		return
 	}
+	event := spokeEvent(gw, "", "", "existing certificate")
+	event.RemoteIP = c.ClientIP()
+	defer s.recordMeshProvisionOutcome(c, event)
 
 	hub, err := s.meshStore.GetHub(ctx, gw.HubID)
 	if err != nil {
@@ -1473,8 +1551,8 @@ func (s *Server) handleMeshSpokeProvisionRequest(c *gin.Context) {
 			return
 		}
 
-		// Generate DH params placeholder (hub will generate actual DH params)
-		dhParams := "# DH parameters will be generated on the hub server\n"
+		// Hubs use ECDHE ("dh none"), so there are no DH params to send
+		dhParams := ""
 
 		// Generate TLS-Auth key if enabled
 		var tlsAuthKey string
@@ -1522,6 +1600,7 @@ func (s *Server) handleMeshSpokeProvisionRequest(c *gin.Context) {
 
 	if needsNewCert {
 		s.logger.Info("Generating client certificate for spoke", zap.String("spoke", gw.Name))
+		event.Message = "new certificate generated"
 
 		// Generate client certificate signed by hub's CA
 		cert, key, err := s.ca.GenerateClientCertWithCA(
@@ -1561,6 +1640,7 @@ func (s *Server) handleMeshSpokeProvisionRequest(c *gin.Context) {
 		rootCACert := string(s.ca.CertificatePEM())
 		fullCAChain = hub.CACert + "\n" + rootCACert
 	}
+	s.recordProvisioned(ctx, db.ComponentSpoke, gw.ID)
 
 	c.JSON(http.StatusOK, gin.H{
 		"gatewayId":      gw.ID,
@@ -1575,6 +1655,7 @@ func (s *Server) handleMeshSpokeProvisionRequest(c *gin.Context) {
 		"localNetworks":  gw.LocalNetworks,
 		"tlsAuthEnabled": hub.TLSAuthEnabled,
 		"tlsAuthKey":     hub.TLSAuthKey,
+		"tlsMode":        hub.TLSMode,
 		"cryptoProfile":  hub.CryptoProfile,
 		"configVersion":  computeSpokeConfigVersion(hub),
 	})
@@ -1593,8 +1674,7 @@ func (s *Server) handleMeshSpokeHeartbeat(c *gin.Context) {
 		ConfigVersion string `json:"configVersion"`
 	}
 
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &req) {
 		return
 	}
 
@@ -1617,6 +1697,14 @@ func (s *Server) handleMeshSpokeHeartbeat(c *gin.Context) {
 	if err := s.meshStore.UpdateMeshSpokeStatus(ctx, gw.ID, status, req.StatusMessage, req.RemoteIP, req.BytesSent, req.BytesReceived); err != nil {
 		s.logger.Error("Failed to update gateway status", zap.Error(err))
 	}
+	if prev := previousMeshStatus(gw.Status, gw.LastSeen, db.MeshSpokeStatusDisconnected, time.Now()); prev != status {
+		event := spokeEvent(gw, db.MeshEventStatusChanged, db.MeshEventSuccess, meshStatusChange(prev, status, req.StatusMessage))
+		if status == db.MeshSpokeStatusError {
+			event.Outcome = db.MeshEventFailure
+		}
+		event.RemoteIP = req.RemoteIP
+		s.recordMeshEvent(ctx, event)
+	}
 
 	// Get hub to compute current config version
 	hub, err := s.meshStore.GetHub(ctx, gw.HubID)
@@ -1631,6 +1719,17 @@ func (s *Server) handleMeshSpokeHeartbeat(c *gin.Context) {
 
 	// Check if spoke needs to reprovision
 	needsReprovision := req.ConfigVersion != "" && req.ConfigVersion != currentConfigVersion
+	s.recordHeartbeatVersion(ctx, db.ComponentSpoke, gw.ID, req.ConfigVersion)
+	reason := "config version mismatch"
+
+	if !needsReprovision && s.meshReprovisionRequested(ctx, db.ComponentSpoke, gw.ID) {
+		s.logger.Info("Spoke reprovision requested, signaling reprovision", zap.String("spoke", gw.Name))
+		needsReprovision = true
+		reason = "reprovision requested by admin"
+	}
+	if needsReprovision {
+		s.recordMeshEventOnce(ctx, spokeEvent(gw, db.MeshEventReprovisionSignaled, db.MeshEventSuccess, reason))
+	}
 
 	if needsReprovision {
 		s.logger.Info("Spoke config version mismatch, needs reprovision",
@@ -1646,17 +1745,18 @@ func (s *Server) handleMeshSpokeHeartbeat(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"ok":                true,
-		"configVersion":     currentConfigVersion,
-		"needsReprovision":  needsReprovision,
-		"tlsAuthEnabled":    hub.TLSAuthEnabled,
-		"rootCAFingerprint": rootCAFingerprint,
+		"ok":                   true,
+		"configVersion":        currentConfigVersion,
+		"needsReprovision":     needsReprovision,
+		"tlsAuthEnabled":       hub.TLSAuthEnabled,
+		"rootCAFingerprint":    rootCAFingerprint,
+		"minHeartbeatInterval": s.minHeartbeatInterval(),
 	})
 }
 
 // ==================== Helper Functions ====================
 
-func computeConfigVersion(vpnPort int, vpnProtocol, vpnSubnet, cryptoProfile string, tlsAuthEnabled bool, tlsAuthKey, caCert string) string {
+func computeConfigVersion(vpnPort int, vpnProtocol, vpnSubnet, cryptoProfile string, tlsAuthEnabled bool, tlsMode, tlsAuthKey, caCert string) string {
 	// Hash the TLS-Auth key content to detect changes
 	var tlsAuthHash string
 	if tlsAuthEnabled && tlsAuthKey != "" {
@@ -1672,10 +1772,19 @@ func computeConfigVersion(vpnPort int, vpnProtocol, vpnSubnet, cryptoProfile str
 	}
 
 	data := fmt.Sprintf("%d|%s|%s|%s|%v|%s|%s", vpnPort, vpnProtocol, vpnSubnet, cryptoProfile, tlsAuthEnabled, tlsAuthHash, caCertHash)
+	// Only tls-crypt extends the hash so existing tls-auth hubs keep their version
+	if tlsAuthEnabled && tlsMode == db.TLSModeCrypt {
+		data += "|crypt"
+	}
 	hash := sha256.Sum256([]byte(data))
 	return hex.EncodeToString(hash[:8])
 }
 
+// isValidTLSMode reports whether mode is a supported TLS control channel mode.
+func isValidTLSMode(mode string) bool {
+	return mode == db.TLSModeAuth || mode == db.TLSModeCrypt
+}
+
 // computeSpokeConfigVersion computes a config version hash for spoke provisioning
 // This includes the TLS-Auth key hash and CA cert hash so spokes can detect when they need to reprovision
 func computeSpokeConfigVersion(hub *db.MeshHub) string {
@@ -1702,6 +1811,9 @@ func computeSpokeConfigVersion(hub *db.MeshHub) string {
 		tlsAuthHash,
 		caCertHash,
 	)
+	if hub.TLSAuthEnabled && hub.TLSMode == db.TLSModeCrypt {
+		data += "|crypt"
+	}
 	hash := sha256.Sum256([]byte(data))
 	return hex.EncodeToString(hash[:8])
 }
@@ -1759,8 +1871,10 @@ case $ARCH in
 esac
 
 echo "Downloading gatekey-hub binary..."
-curl -sSL "${CONTROL_PLANE_URL}/downloads/gatekey-hub-linux-${ARCH}" -o /usr/local/bin/gatekey-hub
-chmod +x /usr/local/bin/gatekey-hub
+rm -f /tmp/gatekey-hub.download
+curl -fsSL --retry 5 -C - "${CONTROL_PLANE_URL}/downloads/gatekey-hub-linux-${ARCH}" -o /tmp/gatekey-hub.download
+install -m 0755 /tmp/gatekey-hub.download /usr/local/bin/gatekey-hub
+rm -f /tmp/gatekey-hub.download
 
 # Create configuration file
 cat > /etc/gatekey-hub/config.yaml << EOF
@@ -1844,8 +1958,10 @@ case $ARCH in
 esac
 
 echo "Downloading gatekey-mesh-spoke binary..."
-curl -sSL "${CONTROL_PLANE_URL}/downloads/gatekey-mesh-spoke-linux-${ARCH}" -o /usr/local/bin/gatekey-mesh-spoke
-chmod +x /usr/local/bin/gatekey-mesh-spoke
+rm -f /tmp/gatekey-mesh-spoke.download
+curl -fsSL --retry 5 -C - "${CONTROL_PLANE_URL}/downloads/gatekey-mesh-spoke-linux-${ARCH}" -o /tmp/gatekey-mesh-spoke.download
+install -m 0755 /tmp/gatekey-mesh-spoke.download /usr/local/bin/gatekey-mesh-spoke
+rm -f /tmp/gatekey-mesh-spoke.download
 
 # Create configuration file
 cat > /etc/gatekey-spoke/config.yaml << EOF
@@ -1962,8 +2078,7 @@ func (s *Server) handleGenerateMeshClientConfig(c *gin.Context) {
 	var req struct {
 		HubID string `json:"hubid" binding:"required"`
 	}
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "hubid is required"})
+	if !bindJSON(c, &req) {
 		return
 	}
 
@@ -2009,11 +2124,28 @@ func (s *Server) handleGenerateMeshClientConfig(c *gin.Context) {
 		return
 	}
 
+	// Apply the constraints the user's policies set
+	constraints, err := s.userConstraints(ctx, user.UserID, user.Email, user.Groups)
+	if err != nil {
+		s.logger.Error("Failed to evaluate policy constraints", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check access"})
+		return
+	}
+	if ok, name := constraints.AllowsTime(time.Now()); !ok {
+		c.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("policy '%s' doesn't allow connecting at this time", name)})
+		return
+	}
+	if required := requiredCryptoProfile(constraints); !meetsCryptoProfile(hub.CryptoProfile, required) {
+		c.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("your policy requires the '%s' crypto profile, but this hub uses '%s'", required, hub.CryptoProfile)})
+		return
+	}
+
 	// Issue client certificate using hub's CA
 	certValidity := 24 * time.Hour
 	if s.config.PKI.CertValidity > 0 {
 		certValidity = s.config.PKI.CertValidity
 	}
+	certValidity = constraints.CapValidity(certValidity)
 
 	clientCert, clientKey, err := issueClientCertFromPEM(hub.CACert, hub.CAKey, user.Email, certValidity)
 	if err != nil {
@@ -2308,15 +2440,22 @@ func generateMeshClientOVPNConfig(hub *db.MeshHub, caChain, clientCert, clientKe
 	}
 	sb.WriteString("</key>\n")
 
-	// Add TLS auth if enabled
+	// Add TLS auth/crypt if enabled
 	if hub.TLSAuthEnabled && hub.TLSAuthKey != "" {
-		sb.WriteString("\n<tls-auth>\n")
+		tag := "tls-auth"
+		if hub.TLSMode == db.TLSModeCrypt {
+			tag = "tls-crypt"
+		}
+		sb.WriteString("\n<" + tag + ">\n")
 		sb.WriteString(hub.TLSAuthKey)
 		if !strings.HasSuffix(hub.TLSAuthKey, "\n") {
 			sb.WriteString("\n")
 		}
-		sb.WriteString("</tls-auth>\n")
-		sb.WriteString("key-direction 1\n")
+		sb.WriteString("</" + tag + ">\n")
+		// tls-crypt has no key direction
+		if tag == "tls-auth" {
+			sb.WriteString("key-direction 1\n")
+		}
 	}
 
 	return sb.String()
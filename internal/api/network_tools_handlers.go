@@ -51,8 +51,7 @@ func (s *Server) handleExecuteNetworkTool(c *gin.Context) {
 	}
 
 	var req NetworkToolRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+	if !bindJSON(c, &req) {
 		return
 	}
 
@@ -0,0 +1,128 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/gatekey-project/gatekey/internal/config"
+	"github.com/gatekey-project/gatekey/internal/db"
+	"github.com/gatekey-project/gatekey/internal/mail"
+	"github.com/gatekey-project/gatekey/internal/notify"
+)
+
+// Notification kinds delivered through the queue.
+const (
+	notificationEmail = "email" // A mail.Message
+)
+
+// notificationEnqueueTimeout bounds recording a notification, which runs after
+// the request returns.
+const notificationEnqueueTimeout = 10 * time.Second
+
+func notifyConfig(cfg config.NotificationsConfig) notify.Config {
+	return notify.Config{
+		Workers:         cfg.Workers,
+		MaxPending:      cfg.MaxPending,
+		MaxAttempts:     cfg.MaxAttempts,
+		DeliveryTimeout: cfg.DeliveryTimeout,
+	}
+}
+
+// newNotificationQueue returns the server's notification queue with a handler
+// for each kind.
+func (s *Server) newNotificationQueue(store *db.NotificationStore) *notify.Queue {
+	q := notify.New(&notificationStoreAdapter{store}, notifyConfig(s.config.Notifications), s.logger)
+	q.Handle(notificationEmail, func(ctx context.Context, payload []byte) error {
+		var msg mail.Message
+		if err := json.Unmarshal(payload, &msg); err != nil {
+			return fmt.Errorf("invalid email notification: %w", err)
+		}
+		return s.mailer.Send(ctx, &msg)
+	})
+	return q
+}
+
+// handleGetNotificationQueue returns the notification queue's depth and this
+// server's delivery counters.
+func (s *Server) handleGetNotificationQueue(c *gin.Context) {
+	if _, ok := s.requireAdmin(c); !ok {
+		return
+	}
+	stats, err := s.notifications.Stats(c.Request.Context())
+	if err != nil {
+		s.logger.Error("Failed to get notification queue stats", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get notification queue stats"})
+		return
+	}
+	c.JSON(http.StatusOK, stats)
+}
+
+// writeNotificationMetrics appends the notification queue's metrics in the
+// Prometheus text format.
+func (s *Server) writeNotificationMetrics(ctx context.Context, sb *strings.Builder) {
+	stats, err := s.notifications.Stats(ctx)
+	if err != nil {
+		s.logger.Warn("Failed to get notification queue stats for metrics", zap.Error(err))
+		return
+	}
+	sb.WriteString("# HELP gatekey_notification_queue_pending Notifications waiting to be delivered\n")
+	sb.WriteString("# TYPE gatekey_notification_queue_pending gauge\n")
+	fmt.Fprintf(sb, "gatekey_notification_queue_pending %d\n", stats.Pending)
+	sb.WriteString("# HELP gatekey_notification_queue_failed Notifications that ran out of delivery attempts in the last 7 days\n")
+	sb.WriteString("# TYPE gatekey_notification_queue_failed gauge\n")
+	fmt.Fprintf(sb, "gatekey_notification_queue_failed %d\n", stats.Failed)
+	sb.WriteString("# HELP gatekey_notification_deliveries_total Notification delivery outcomes on this server\n")
+	sb.WriteString("# TYPE gatekey_notification_deliveries_total counter\n")
+	fmt.Fprintf(sb, "gatekey_notification_deliveries_total{result=\"delivered\"} %d\n", stats.Delivered)
+	fmt.Fprintf(sb, "gatekey_notification_deliveries_total{result=\"retried\"} %d\n", stats.Retried)
+	fmt.Fprintf(sb, "gatekey_notification_deliveries_total{result=\"gave_up\"} %d\n", stats.GaveUp)
+	fmt.Fprintf(sb, "gatekey_notification_deliveries_total{result=\"dropped\"} %d\n", stats.Dropped)
+}
+
+// notificationStoreAdapter adapts db.NotificationStore to notify.Store
+type notificationStoreAdapter struct {
+	store *db.NotificationStore
+}
+
+func (a *notificationStoreAdapter) Enqueue(ctx context.Context, kind string, payload []byte, maxAttempts int) error {
+	return a.store.EnqueueNotification(ctx, kind, payload, maxAttempts)
+}
+
+func (a *notificationStoreAdapter) Claim(ctx context.Context, limit int, lease time.Duration) ([]notify.Job, error) {
+	queued, err := a.store.ClaimNotifications(ctx, limit, lease)
+	if err != nil {
+		return nil, err
+	}
+	jobs := make([]notify.Job, 0, len(queued))
+	for _, n := range queued {
+		jobs = append(jobs, notify.Job{ID: n.ID, Kind: n.Kind, Payload: n.Payload, Attempts: n.Attempts})
+	}
+	return jobs, nil
+}
+
+func (a *notificationStoreAdapter) Complete(ctx context.Context, id string) error {
+	return a.store.CompleteNotification(ctx, id)
+}
+
+func (a *notificationStoreAdapter) Retry(ctx context.Context, id string, at time.Time, lastError string) error {
+	return a.store.RetryNotification(ctx, id, at, lastError)
+}
+
+func (a *notificationStoreAdapter) Fail(ctx context.Context, id string, lastError string) error {
+	return a.store.FailNotification(ctx, id, lastError)
+}
+
+func (a *notificationStoreAdapter) Count(ctx context.Context) (pending, failed int64, err error) {
+	return a.store.CountNotifications(ctx)
+}
+
+func (a *notificationStoreAdapter) PurgeFailed(ctx context.Context, before time.Time) (int64, error) {
+	return a.store.PurgeFailedNotifications(ctx, before)
+}
@@ -0,0 +1,280 @@
+package api
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/gatekey-project/gatekey/internal/db"
+	"github.com/gatekey-project/gatekey/internal/pki"
+)
+
+// Teams moving from a hand-rolled OpenVPN setup can import its CA, so GateKey
+// issues new configs from it, along with the client certificates it already
+// issued. Each imported certificate becomes a config of its user's, so the
+// gateway keeps accepting it by serial number until it expires or is revoked,
+// and users can move to GateKey configs in their own time.
+
+// importedConfigPurpose labels configs created for imported certificates.
+const importedConfigPurpose = "Imported from existing PKI"
+
+// importClientCert maps an existing client certificate to a user and gateway.
+// Either the certificate or its serial number and expiry are needed.
+type importClientCert struct {
+	Certificate  string     `json:"certificate"`   // PEM; checked against the CA
+	SerialNumber string     `json:"serial_number"` // Hex, as openssl prints it, when there's no certificate
+	ExpiresAt    *time.Time `json:"expires_at"`    // Required with serial_number
+	UserEmail    string     `json:"user_email"`    // Defaults to the user the certificate's common name identifies
+	GatewayID    string     `json:"gateway_id"`    // Defaults to the request's gateway_id
+}
+
+// importClientResult reports what happened to one client certificate.
+type importClientResult struct {
+	SerialNumber string `json:"serial_number,omitempty"`
+	UserEmail    string `json:"user_email,omitempty"`
+	ConfigID     string `json:"config_id,omitempty"`
+	Status       string `json:"status"` // imported, skipped or failed
+	Reason       string `json:"reason,omitempty"`
+}
+
+// handleImportPKI imports an existing OpenVPN CA and the client certificates it
+// issued. With dry_run nothing is changed, so the mapping can be checked first.
+func (s *Server) handleImportPKI(c *gin.Context) {
+	if s.ca == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "CA not initialized"})
+		return
+	}
+
+	var req struct {
+		Certificate string             `json:"certificate" binding:"required"`
+		PrivateKey  string             `json:"private_key" binding:"required"`
+		GatewayID   string             `json:"gateway_id"`
+		Clients     []importClientCert `json:"clients" binding:"max=5000"`
+		DryRun      bool               `json:"dry_run"`
+	}
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	ctx := c.Request.Context()
+	caCert, warnings, err := pki.ValidateImportCA(req.Certificate, req.PrivateKey, time.Now())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid CA: " + err.Error()})
+		return
+	}
+
+	results := make([]importClientResult, 0, len(req.Clients))
+	gateways := map[string]*db.Gateway{}
+	counts := map[string]int{}
+	for _, client := range req.Clients {
+		result := s.importClientCert(ctx, client, req.GatewayID, caCert, gateways, req.DryRun)
+		counts[result.Status]++
+		results = append(results, result)
+	}
+
+	resp := gin.H{
+		"dry_run":       req.DryRun,
+		"serial_number": caCert.SerialNumber.Text(16),
+		"subject":       caCert.Subject.String(),
+		"not_before":    caCert.NotBefore,
+		"not_after":     caCert.NotAfter,
+		"fingerprint":   pki.Fingerprint(caCert),
+		"warnings":      append([]string{}, warnings...),
+		"clients":       results,
+		"imported":      counts["imported"],
+		"skipped":       counts["skipped"],
+		"failed":        counts["failed"],
+	}
+	if req.DryRun {
+		c.JSON(http.StatusOK, resp)
+		return
+	}
+
+	// The client configs are already saved; if the CA can't be, they're
+	// harmless, since gateways won't accept their certificates without it
+	caID, err := importCA(ctx, s.pkiStore, req.Certificate, req.PrivateKey, caCert)
+	if err != nil {
+		s.logger.Error("Failed to import CA", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to import CA: " + err.Error()})
+		return
+	}
+	if err := s.reloadActiveCA(ctx); err != nil {
+		s.logger.Error("Failed to reload CA in memory", zap.Error(err))
+		// Don't fail the request - the database is updated
+	}
+	resp["id"] = caID
+
+	s.logger.Info("Existing PKI imported",
+		zap.String("ca_id", caID),
+		zap.String("serial", caCert.SerialNumber.Text(16)),
+		zap.Time("not_after", caCert.NotAfter),
+		zap.Int("imported", counts["imported"]),
+		zap.Int("skipped", counts["skipped"]),
+		zap.Int("failed", counts["failed"]))
+	s.recordAudit(c, "ca.import", "ca", pki.Fingerprint(caCert), gin.H{
+		"ca_id":    caID,
+		"subject":  caCert.Subject.String(),
+		"imported": counts["imported"],
+		"skipped":  counts["skipped"],
+		"failed":   counts["failed"],
+	})
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// caActivator is the part of the PKI store a CA import goes through.
+type caActivator interface {
+	SaveCAWithID(ctx context.Context, ca *db.StoredCA) error
+	ActivateCA(ctx context.Context, id string) error
+}
+
+// importCA saves an imported CA as pending and activates it, as a rotation
+// does, and returns its ID. The CA it replaces is retired rather than
+// overwritten, so it stays trusted and endorses provisioning responses: gateways
+// provisioned with it accept the imported CA when they reprovision.
+func importCA(ctx context.Context, store caActivator, certPEM, keyPEM string, cert *x509.Certificate) (string, error) {
+	stored := &db.StoredCA{
+		ID:             fmt.Sprintf("ca-%d", time.Now().UnixNano()),
+		CertificatePEM: certPEM,
+		PrivateKeyPEM:  keyPEM,
+		SerialNumber:   cert.SerialNumber.String(),
+		NotBefore:      cert.NotBefore,
+		NotAfter:       cert.NotAfter,
+		Status:         db.CAStatusPending,
+		Description:    "Imported from existing PKI",
+	}
+	if err := store.SaveCAWithID(ctx, stored); err != nil {
+		return "", fmt.Errorf("failed to save CA: %w", err)
+	}
+	if err := store.ActivateCA(ctx, stored.ID); err != nil {
+		return "", fmt.Errorf("failed to activate CA: %w", err)
+	}
+	return stored.ID, nil
+}
+
+// importClientCert validates one client certificate and, unless dryRun, saves
+// it as a config of its user's. gateways caches gateways by ID.
+func (s *Server) importClientCert(ctx context.Context, client importClientCert, defaultGatewayID string,
+	caCert *x509.Certificate, gateways map[string]*db.Gateway, dryRun bool) importClientResult {
+	failed := func(result importClientResult, format string, args ...any) importClientResult {
+		result.Status = "failed"
+		result.Reason = fmt.Sprintf(format, args...)
+		return result
+	}
+
+	var result importClientResult
+	var cert *pki.ImportedCert
+	switch {
+	case client.Certificate != "":
+		parsed, err := pki.ParseImportClientCert(client.Certificate, caCert)
+		if err != nil {
+			return failed(result, "%v", err)
+		}
+		cert = parsed
+	case client.SerialNumber != "":
+		serial, err := pki.NormalizeSerial(client.SerialNumber)
+		if err != nil {
+			return failed(result, "%v", err)
+		}
+		if client.ExpiresAt == nil {
+			return failed(importClientResult{SerialNumber: serial}, "expires_at is required with serial_number")
+		}
+		cert = &pki.ImportedCert{SerialNumber: serial, NotAfter: *client.ExpiresAt}
+	default:
+		return failed(result, "certificate or serial_number is required")
+	}
+	result.SerialNumber = cert.SerialNumber
+
+	if time.Now().After(cert.NotAfter) {
+		result.Status = "skipped"
+		result.Reason = "certificate has expired"
+		return result
+	}
+	if _, err := s.configStore.GetConfigBySerial(ctx, cert.SerialNumber); err == nil {
+		result.Status = "skipped"
+		result.Reason = "certificate is already known"
+		return result
+	}
+
+	// Find the user: by the given email, else as the gateway would from the
+	// certificate's common name, else by an email in the certificate
+	var user *db.SSOUser
+	var err error
+	switch {
+	case client.UserEmail != "":
+		user, err = s.userStore.GetSSOUserByEmail(ctx, client.UserEmail)
+	case cert.CommonName != "":
+		user, err = s.userStore.GetSSOUserByCommonName(ctx, cert.CommonName)
+		if err != nil && cert.Email != "" {
+			user, err = s.userStore.GetSSOUserByEmail(ctx, cert.Email)
+		}
+	default:
+		return failed(result, "user_email is required without a certificate")
+	}
+	if err != nil {
+		return failed(result, "no user found; they must sign in once, or set user_email")
+	}
+	result.UserEmail = user.Email
+
+	gatewayID := client.GatewayID
+	if gatewayID == "" {
+		gatewayID = defaultGatewayID
+	}
+	if gatewayID == "" {
+		return failed(result, "gateway_id is required")
+	}
+	gateway, ok := gateways[gatewayID]
+	if !ok {
+		gateway, err = s.gatewayStore.GetGateway(ctx, gatewayID)
+		if err != nil {
+			return failed(result, "gateway %s not found", gatewayID)
+		}
+		gateways[gatewayID] = gateway
+	}
+
+	result.Status = "imported"
+	if dryRun {
+		return result
+	}
+	config := &db.GeneratedConfig{
+		ID:           generateConfigID(),
+		UserID:       user.ID,
+		GatewayID:    gateway.ID,
+		GatewayName:  gateway.Name,
+		SerialNumber: cert.SerialNumber,
+		Fingerprint:  cert.Fingerprint,
+		ExpiresAt:    cert.NotAfter,
+		Purpose:      importedConfigPurpose,
+	}
+	if err := s.configStore.SaveConfig(ctx, config); err != nil {
+		s.logger.Error("Failed to save imported config", zap.String("serial", cert.SerialNumber), zap.Error(err))
+		return failed(result, "failed to save config")
+	}
+	result.ConfigID = config.ID
+	return result
+}
+
+// configBySerial returns the config issued with a certificate, given its serial
+// as the gateway reports it or as GateKey stores it.
+func (s *Server) configBySerial(ctx context.Context, serial string) (*db.GeneratedConfig, error) {
+	if normalized, err := pki.NormalizeSerial(serial); err == nil {
+		serial = normalized
+	}
+	return s.configStore.GetConfigBySerial(ctx, serial)
+}
+
+// certificateUser returns the user a client certificate identifies by its
+// common name. Certificates imported from an existing PKI may use any common
+// name, so for those it falls back to the user their config was imported for.
+func (s *Server) certificateUser(ctx context.Context, commonName string, config *db.GeneratedConfig) (*db.SSOUser, error) {
+	user, err := s.userStore.GetSSOUserByCommonName(ctx, commonName)
+	if err != nil && config != nil && config.Purpose == importedConfigPurpose {
+		return s.userStore.GetSSOUser(ctx, config.UserID)
+	}
+	return user, err
+}
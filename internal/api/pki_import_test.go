@@ -0,0 +1,105 @@
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/gatekey-project/gatekey/internal/config"
+	"github.com/gatekey-project/gatekey/internal/db"
+	"github.com/gatekey-project/gatekey/internal/openvpn"
+	"github.com/gatekey-project/gatekey/internal/pki"
+)
+
+// fakeCAStore keeps CAs in memory with the PKI store's rotation semantics.
+type fakeCAStore struct {
+	cas []*db.StoredCA
+}
+
+func (f *fakeCAStore) SaveCAWithID(ctx context.Context, ca *db.StoredCA) error {
+	cert, err := pki.ParseCertificatePEM([]byte(ca.CertificatePEM))
+	if err != nil {
+		return err
+	}
+	saved := *ca
+	saved.Fingerprint = pki.Fingerprint(cert)
+	f.cas = append(f.cas, &saved)
+	return nil
+}
+
+func (f *fakeCAStore) ActivateCA(ctx context.Context, id string) error {
+	for _, ca := range f.cas {
+		switch {
+		case ca.ID == id:
+			ca.Status = db.CAStatusActive
+		case ca.Status == db.CAStatusActive:
+			ca.Status = db.CAStatusRetired
+		}
+	}
+	return nil
+}
+
+func newImportTestCA(t *testing.T) *pki.CA {
+	t.Helper()
+	ca, err := pki.NewCA(config.PKIConfig{
+		KeyAlgorithm: "ecdsa256",
+		Organization: "Test Org",
+		CertValidity: time.Hour,
+		CAValidity:   24 * time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ca
+}
+
+func TestImportCAKeepsPreviousCAEndorsing(t *testing.T) {
+	oldCA, imported := newImportTestCA(t), newImportTestCA(t)
+	store := &fakeCAStore{cas: []*db.StoredCA{{
+		ID:             "default",
+		CertificatePEM: string(oldCA.CertificatePEM()),
+		PrivateKeyPEM:  string(oldCA.PrivateKeyPEM()),
+		Fingerprint:    pki.Fingerprint(oldCA.Certificate()),
+		Status:         db.CAStatusActive,
+	}}}
+
+	id, err := importCA(context.Background(), store, string(imported.CertificatePEM()), string(imported.PrivateKeyPEM()), imported.Certificate())
+	if err != nil {
+		t.Fatalf("importCA() error = %v", err)
+	}
+	if len(store.cas) != 2 || store.cas[0].Status != db.CAStatusRetired || store.cas[1].ID != id || store.cas[1].Status != db.CAStatusActive {
+		t.Fatalf("after import: old CA %s, imported CA %s; want the old one retired", store.cas[0].Status, store.cas[len(store.cas)-1].Status)
+	}
+
+	// Serve a provision signed with the imported CA and endorsed by the others,
+	// as the control plane does, to a gateway still on the old CA
+	s := &Server{logger: zap.NewNop()}
+	payload, _ := json.Marshal(gin.H{"ca_cert": string(imported.CertificatePEM())})
+	signature, err := imported.Sign(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(openvpn.ProvisionSignatureHeader, base64.StdEncoding.EncodeToString(signature))
+		for _, e := range s.provisionEndorsements(store.cas, pki.Fingerprint(imported.Certificate()), payload) {
+			w.Header().Add(openvpn.ProvisionEndorsementHeader, e)
+		}
+		_, _ = w.Write(payload)
+	}))
+	defer srv.Close()
+
+	resp, err := openvpn.NewHookClient(srv.URL, "gw-token").Provision()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := openvpn.VerifyProvision(resp, openvpn.ProvisionTrust{Current: oldCA.Certificate()}); err != nil {
+		t.Errorf("gateway on the old CA rejected the provision after import: %v", err)
+	}
+}
@@ -0,0 +1,355 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/gatekey-project/gatekey/internal/db"
+	"github.com/gatekey-project/gatekey/internal/models"
+	"github.com/gatekey-project/gatekey/internal/openvpn"
+	"github.com/gatekey-project/gatekey/internal/policy"
+)
+
+// policyRequest is the body for creating or updating a policy. Rules replace the
+// policy's existing rules; omit them on update to keep the rules as they are.
+type policyRequest struct {
+	Name        string                    `json:"name" binding:"required"`
+	Description string                    `json:"description"`
+	Priority    int                       `json:"priority"`
+	IsEnabled   *bool                     `json:"is_enabled"`
+	Constraints *models.PolicyConstraints `json:"constraints"`
+	Rules       []policyRuleRequest       `json:"rules" binding:"max=1000"`
+}
+
+type policyRuleRequest struct {
+	Action     string                 `json:"action"`
+	Subject    models.PolicySubject   `json:"subject"`
+	Resource   models.PolicyResource  `json:"resource"`
+	Conditions models.PolicyCondition `json:"conditions"`
+	Priority   int                    `json:"priority"`
+}
+
+// policyResponse is a policy with its rules.
+type policyResponse struct {
+	models.Policy
+	Rules []models.PolicyRule `json:"rules"`
+}
+
+// requireAdmin checks that the caller is an admin, for handlers on routes without
+// admin middleware.
+func (s *Server) requireAdmin(c *gin.Context) (*authenticatedUser, bool) {
+	user, err := s.getAuthenticatedUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		return nil, false
+	}
+	if !user.IsAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "admin access required"})
+		return nil, false
+	}
+	return user, true
+}
+
+// validate checks the request and converts its rules for storage.
+func (req *policyRequest) validate(ctx context.Context, s *Server) ([]models.PolicyRule, error) {
+	if pc := req.Constraints; pc != nil {
+		subject := pc.Subject
+		if !subject.Everyone && len(subject.Users) == 0 && len(subject.Groups) == 0 {
+			return nil, fmt.Errorf("constraints.subject must list users or groups, or set everyone")
+		}
+		if pc.CertValidityHours < 0 || pc.MaxSessions < 0 {
+			return nil, fmt.Errorf("cert_validity_hours and max_sessions can't be negative")
+		}
+		if pc.CryptoProfile != "" {
+			if _, ok := cryptoProfileStrength[pc.CryptoProfile]; !ok {
+				return nil, fmt.Errorf("invalid crypto_profile: must be 'modern', 'fips', or 'compatible'")
+			}
+			if err := s.validateCryptoProfileAllowed(ctx, pc.CryptoProfile); err != nil {
+				return nil, err
+			}
+		}
+		for _, tw := range pc.TimeWindows {
+			if err := policy.ValidateTimeWindow(tw); err != nil {
+				return nil, fmt.Errorf("invalid time window: %w", err)
+			}
+		}
+	}
+
+	if req.Rules == nil {
+		return nil, nil
+	}
+	rules := make([]models.PolicyRule, 0, len(req.Rules))
+	for i, r := range req.Rules {
+		if r.Action != "allow" && r.Action != "deny" {
+			return nil, fmt.Errorf("rule %d: action must be 'allow' or 'deny'", i+1)
+		}
+		for _, tw := range r.Conditions.TimeWindows {
+			if err := policy.ValidateTimeWindow(tw); err != nil {
+				return nil, fmt.Errorf("rule %d: invalid time window: %w", i+1, err)
+			}
+		}
+		subject, _ := json.Marshal(r.Subject)
+		resource, _ := json.Marshal(r.Resource)
+		conditions, _ := json.Marshal(r.Conditions)
+		rules = append(rules, models.PolicyRule{
+			Action:     r.Action,
+			Subject:    subject,
+			Resource:   resource,
+			Conditions: conditions,
+			Priority:   r.Priority,
+		})
+	}
+	return rules, nil
+}
+
+func (s *Server) handleListPolicies(c *gin.Context) {
+	if _, ok := s.requireAdmin(c); !ok {
+		return
+	}
+
+	policies, err := s.policyStore.List(c.Request.Context())
+	if err != nil {
+		s.logger.Error("Failed to list policies", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list policies"})
+		return
+	}
+	if policies == nil {
+		policies = []models.Policy{}
+	}
+	c.JSON(http.StatusOK, gin.H{"policies": policies})
+}
+
+func (s *Server) handleCreatePolicy(c *gin.Context) {
+	user, ok := s.requireAdmin(c)
+	if !ok {
+		return
+	}
+
+	var req policyRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	ctx := c.Request.Context()
+	rules, err := req.validate(ctx, s)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if rules == nil {
+		rules = []models.PolicyRule{}
+	}
+
+	p := &models.Policy{
+		Name:        req.Name,
+		Description: req.Description,
+		Priority:    req.Priority,
+		IsEnabled:   req.IsEnabled == nil || *req.IsEnabled,
+		Constraints: req.Constraints,
+	}
+	if err := s.policyStore.Create(ctx, p, rules, user.UserID); err != nil {
+		if err == db.ErrPolicyExists {
+			c.JSON(http.StatusConflict, gin.H{"error": "a policy with this name already exists"})
+			return
+		}
+		s.logger.Error("Failed to create policy", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create policy"})
+		return
+	}
+
+	s.recordAudit(c, "policy.create", "policy", p.ID.String(), gin.H{"name": p.Name})
+	c.JSON(http.StatusCreated, policyResponse{Policy: *p, Rules: rules})
+}
+
+func (s *Server) handleGetPolicy(c *gin.Context) {
+	if _, ok := s.requireAdmin(c); !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	p, err := s.policyStore.Get(ctx, c.Param("id"))
+	if err != nil {
+		if err == db.ErrPolicyNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "policy not found"})
+			return
+		}
+		s.logger.Error("Failed to get policy", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get policy"})
+		return
+	}
+	rules, err := s.policyStore.GetRules(ctx, p.ID)
+	if err != nil {
+		s.logger.Error("Failed to get policy rules", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get policy"})
+		return
+	}
+	c.JSON(http.StatusOK, policyResponse{Policy: *p, Rules: rules})
+}
+
+func (s *Server) handleUpdatePolicy(c *gin.Context) {
+	if _, ok := s.requireAdmin(c); !ok {
+		return
+	}
+
+	var req policyRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	ctx := c.Request.Context()
+	rules, err := req.validate(ctx, s)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	p, err := s.policyStore.Get(ctx, c.Param("id"))
+	if err != nil {
+		if err == db.ErrPolicyNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "policy not found"})
+			return
+		}
+		s.logger.Error("Failed to get policy", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update policy"})
+		return
+	}
+	p.Name = req.Name
+	p.Description = req.Description
+	p.Priority = req.Priority
+	if req.IsEnabled != nil {
+		p.IsEnabled = *req.IsEnabled
+	}
+	p.Constraints = req.Constraints
+
+	if err := s.policyStore.Update(ctx, p, rules); err != nil {
+		switch err {
+		case db.ErrPolicyNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": "policy not found"})
+		case db.ErrPolicyExists:
+			c.JSON(http.StatusConflict, gin.H{"error": "a policy with this name already exists"})
+		default:
+			s.logger.Error("Failed to update policy", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update policy"})
+		}
+		return
+	}
+	if rules == nil {
+		if rules, err = s.policyStore.GetRules(ctx, p.ID); err != nil {
+			s.logger.Warn("Failed to get policy rules", zap.Error(err))
+		}
+	}
+
+	s.recordAudit(c, "policy.update", "policy", p.ID.String(), gin.H{"name": p.Name})
+	c.JSON(http.StatusOK, policyResponse{Policy: *p, Rules: rules})
+}
+
+func (s *Server) handleDeletePolicy(c *gin.Context) {
+	if _, ok := s.requireAdmin(c); !ok {
+		return
+	}
+
+	policyID := c.Param("id")
+	if err := s.policyStore.Delete(c.Request.Context(), policyID); err != nil {
+		if err == db.ErrPolicyNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "policy not found"})
+			return
+		}
+		s.logger.Error("Failed to delete policy", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete policy"})
+		return
+	}
+
+	s.recordAudit(c, "policy.delete", "policy", policyID, nil)
+	c.JSON(http.StatusOK, gin.H{"message": "policy deleted"})
+}
+
+// userConstraints returns the connection constraints the enabled policies set for
+// a user.
+func (s *Server) userConstraints(ctx context.Context, userID, email string, groups []string) (policy.Constraints, error) {
+	policies, err := s.policyStore.List(ctx)
+	if err != nil {
+		return policy.Constraints{}, err
+	}
+	user := &models.User{Email: email, Groups: groups}
+	user.ID, _ = uuid.Parse(userID)
+	return policy.EffectiveConstraints(policies, user), nil
+}
+
+// checkPolicyConstraints checks a connecting user against the time windows,
+// crypto profile and session limit their policies set. It returns a denial
+// reason code and reason, or "" if the connection is allowed.
+func (s *Server) checkPolicyConstraints(ctx context.Context, user *db.SSOUser, gateway *db.Gateway) (string, string) {
+	constraints, err := s.userConstraints(ctx, user.ID, user.Email, user.Groups)
+	if err != nil {
+		s.logger.Error("Failed to evaluate policy constraints", zap.Error(err))
+		return openvpn.DenyAccessCheckFailed, "access check failed"
+	}
+
+	if ok, name := constraints.AllowsTime(time.Now()); !ok {
+		return openvpn.DenyOutsideTimeWindow, fmt.Sprintf("outside the hours allowed by policy '%s'", name)
+	}
+
+	profile := gatewayCryptoProfile(gateway)
+	if required := requiredCryptoProfile(constraints); !meetsCryptoProfile(profile, required) {
+		return openvpn.DenyCryptoProfile, fmt.Sprintf("policy requires the '%s' crypto profile, gateway uses '%s'", required, profile)
+	}
+
+	if constraints.MaxSessions > 0 {
+		active, err := s.connectionStore.CountActive(ctx, user.ID)
+		if err != nil {
+			s.logger.Error("Failed to count active sessions", zap.Error(err))
+			return openvpn.DenyAccessCheckFailed, "access check failed"
+		}
+		if active >= constraints.MaxSessions {
+			return openvpn.DenySessionLimit, fmt.Sprintf("%d of %d allowed sessions already active", active, constraints.MaxSessions)
+		}
+	}
+	return "", ""
+}
+
+// checkGroupConnectionLimits checks a connecting user against the connection
+// limits on their groups. A user who is already connected doesn't count against
+// the limit again, so a second session or a reconnect is never refused. It
+// returns a denial reason code and reason, or "" if the connection is allowed.
+func (s *Server) checkGroupConnectionLimits(ctx context.Context, user *db.SSOUser) (string, string) {
+	limits, err := s.userStore.GetGroupConnectionLimits(ctx, user.Groups)
+	if err != nil {
+		s.logger.Error("Failed to get group connection limits", zap.Error(err))
+		return openvpn.DenyAccessCheckFailed, "access check failed"
+	}
+	for _, limit := range limits {
+		connected, err := s.userStore.CountConnectedGroupUsers(ctx, limit.GroupName, user.ID)
+		if err != nil {
+			s.logger.Error("Failed to count connected group users", zap.Error(err))
+			return openvpn.DenyAccessCheckFailed, "access check failed"
+		}
+		if connected >= limit.MaxUsers {
+			return openvpn.DenyGroupLimit, fmt.Sprintf("group '%s' connection limit reached (%d of %d users connected)", limit.GroupName, connected, limit.MaxUsers)
+		}
+	}
+	return "", ""
+}
+
+// recordGroupLimitedConnect records a connection for history and export, unless
+// it would take one of the user's groups over its connection limit. The count
+// and the insert happen in one transaction, so concurrent connects can't both
+// take a group's last place. It returns a denial reason code and reason, or ""
+// if the connection is allowed.
+func (s *Server) recordGroupLimitedConnect(ctx context.Context, user *db.SSOUser, gateway *db.Gateway, clientIP, vpnIPv4, vpnIPv6, tunnelMode string) (string, string) {
+	_, err := s.userStore.RecordConnectWithinGroupLimits(ctx, user.ID, user.Groups, gateway.ID, clientIP, vpnIPv4, vpnIPv6, tunnelMode)
+	if err == nil {
+		return "", ""
+	}
+	var limitErr *db.GroupLimitError
+	if errors.As(err, &limitErr) {
+		return openvpn.DenyGroupLimit, limitErr.Error()
+	}
+	s.logger.Error("Gateway connect: failed to record connection", zap.Error(err))
+	return openvpn.DenyAccessCheckFailed, "access check failed"
+}
@@ -0,0 +1,387 @@
+package api
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/crewjam/saml"
+	"github.com/crewjam/saml/samlsp"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+
+	"github.com/gatekey-project/gatekey/internal/db"
+)
+
+// providerTestTimeout bounds the network calls made while testing a provider.
+const providerTestTimeout = 15 * time.Second
+
+// Provider check statuses.
+const (
+	checkPass = "pass"
+	checkWarn = "warn"
+	checkFail = "fail"
+	checkSkip = "skip"
+)
+
+// providerCheck is one step of a provider configuration test.
+type providerCheck struct {
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	Message string `json:"message"`
+	Hint    string `json:"hint,omitempty"` // What to change when the check doesn't pass
+}
+
+// providerTestResult collects the checks run against a provider.
+type providerTestResult struct {
+	Provider string          `json:"provider"`
+	Type     string          `json:"type"`
+	OK       bool            `json:"ok"` // No check failed
+	Checks   []providerCheck `json:"checks"`
+}
+
+func (r *providerTestResult) add(name, status, message, hint string) {
+	r.Checks = append(r.Checks, providerCheck{Name: name, Status: status, Message: message, Hint: hint})
+}
+
+func (r *providerTestResult) failed() bool {
+	for _, c := range r.Checks {
+		if c.Status == checkFail {
+			return true
+		}
+	}
+	return false
+}
+
+// checkCallbackURL validates a redirect or ACS URL and that it points at the
+// expected GateKey endpoint.
+func checkCallbackURL(r *providerTestResult, name, raw, wantPath string) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		r.add(name, checkFail, fmt.Sprintf("%q is not an absolute URL", raw),
+			fmt.Sprintf("Use the full public URL of GateKey, e.g. https://vpn.example.com%s", wantPath))
+		return
+	}
+	if strings.TrimSuffix(u.Path, "/") != wantPath {
+		r.add(name, checkWarn, fmt.Sprintf("%s does not end in %s", u, wantPath),
+			"The identity provider will send users to this URL after login; GateKey handles it at "+wantPath)
+		return
+	}
+	if u.Scheme != "https" {
+		r.add(name, checkWarn, fmt.Sprintf("%s is not HTTPS", u), "Most identity providers reject non-HTTPS callback URLs outside of localhost")
+		return
+	}
+	r.add(name, checkPass, u.String(), "")
+}
+
+func (s *Server) handleTestOIDCProvider(c *gin.Context) {
+	name := c.Param("name")
+
+	provider, err := s.providerStore.GetOIDCProvider(c.Request.Context(), name)
+	if err != nil {
+		if errors.Is(err, db.ErrProviderNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "provider not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get provider"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), providerTestTimeout)
+	defer cancel()
+
+	provider.RedirectURL = s.oidcRedirectURL(c, provider)
+	result := testOIDCProvider(ctx, provider)
+	c.JSON(http.StatusOK, result)
+}
+
+// testOIDCProvider performs discovery, fetches the JWKS, and validates the client
+// credentials with a client_credentials token request when the issuer supports it.
+func testOIDCProvider(ctx context.Context, p *db.OIDCProvider) *providerTestResult {
+	r := &providerTestResult{Provider: p.Name, Type: "oidc"}
+	defer func() { r.OK = !r.failed() }()
+
+	issuer := strings.TrimSpace(p.Issuer)
+	clientID := strings.TrimSpace(p.ClientID)
+	clientSecret := strings.TrimSpace(p.ClientSecret)
+
+	if clientID == "" || clientSecret == "" {
+		r.add("client", checkFail, "client_id or client_secret is empty", "Copy both from the application registered with the identity provider")
+	} else {
+		r.add("client", checkPass, "client_id and client_secret are set", "")
+	}
+	checkCallbackURL(r, "redirect_url", p.RedirectURL, oidcCallbackPath)
+
+	provider, err := oidc.NewProvider(ctx, issuer)
+	if err != nil {
+		r.add("discovery", checkFail, err.Error(),
+			fmt.Sprintf("Check that %s/.well-known/openid-configuration is reachable from the server and that its \"issuer\" matches %q exactly, including any trailing slash", strings.TrimSuffix(issuer, "/"), issuer))
+		return r
+	}
+	r.add("discovery", checkPass, "fetched "+strings.TrimSuffix(issuer, "/")+"/.well-known/openid-configuration", "")
+
+	var discovery struct {
+		JWKSURI         string   `json:"jwks_uri"`
+		ScopesSupported []string `json:"scopes_supported"`
+		GrantTypes      []string `json:"grant_types_supported"`
+		TokenAuth       []string `json:"token_endpoint_auth_methods_supported"`
+		PKCEMethods     []string `json:"code_challenge_methods_supported"`
+	}
+	if err := provider.Claims(&discovery); err != nil {
+		r.add("discovery", checkFail, "failed to parse discovery document: "+err.Error(), "")
+		return r
+	}
+
+	checkJWKS(ctx, r, discovery.JWKSURI)
+
+	scopes := p.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{oidc.ScopeOpenID, "profile", "email"}
+	}
+	checkScopes(r, scopes, discovery.ScopesSupported)
+	checkPKCE(r, discovery.PKCEMethods)
+
+	if !containsString(discovery.GrantTypes, "client_credentials") || clientID == "" || clientSecret == "" {
+		r.add("credentials", checkSkip, "issuer does not advertise the client_credentials grant, so the client secret can only be verified by logging in", "")
+		return r
+	}
+
+	cc := clientcredentials.Config{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		TokenURL:     provider.Endpoint().TokenURL,
+		AuthStyle:    provider.Endpoint().AuthStyle,
+	}
+	if _, err := cc.Token(ctx); err != nil {
+		var rerr *oauth2.RetrieveError
+		switch {
+		case errors.As(err, &rerr) && rerr.ErrorCode == "invalid_client":
+			r.add("credentials", checkFail, "the identity provider rejected the client credentials",
+				"The client_id or client_secret is wrong, or the secret has expired; generate a new secret and update the provider")
+		case errors.As(err, &rerr) && (rerr.ErrorCode == "unauthorized_client" || rerr.ErrorCode == "unsupported_grant_type"):
+			// The client authenticated but isn't allowed this grant, which is normal
+			// for a login-only application
+			r.add("credentials", checkPass, "client credentials accepted (client is not enabled for client_credentials, which is fine)", "")
+		default:
+			r.add("credentials", checkWarn, "could not verify the client credentials: "+err.Error(),
+				"Log in once to confirm the client secret works")
+		}
+		return r
+	}
+	r.add("credentials", checkPass, "client credentials accepted", "")
+	return r
+}
+
+// checkJWKS fetches the issuer's signing keys.
+func checkJWKS(ctx context.Context, r *providerTestResult, jwksURI string) {
+	if jwksURI == "" {
+		r.add("jwks", checkFail, "discovery document has no jwks_uri", "ID tokens can't be verified without the issuer's signing keys")
+		return
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, jwksURI, nil)
+	if err != nil {
+		r.add("jwks", checkFail, err.Error(), "")
+		return
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		r.add("jwks", checkFail, err.Error(), "Check that "+jwksURI+" is reachable from the server")
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		r.add("jwks", checkFail, fmt.Sprintf("%s returned %s", jwksURI, resp.Status), "")
+		return
+	}
+
+	var jwks struct {
+		Keys []json.RawMessage `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&jwks); err != nil {
+		r.add("jwks", checkFail, "failed to parse JWKS: "+err.Error(), "")
+		return
+	}
+	if len(jwks.Keys) == 0 {
+		r.add("jwks", checkFail, "JWKS contains no keys", "ID tokens can't be verified until the issuer publishes a signing key")
+		return
+	}
+	r.add("jwks", checkPass, fmt.Sprintf("%d signing key(s) published", len(jwks.Keys)), "")
+}
+
+// checkScopes warns about configured scopes the issuer doesn't advertise.
+func checkScopes(r *providerTestResult, scopes, supported []string) {
+	if !containsString(scopes, oidc.ScopeOpenID) {
+		r.add("scopes", checkFail, "scopes do not include openid", "Add the openid scope, or leave scopes empty to use openid, profile, email")
+		return
+	}
+	if len(supported) == 0 {
+		r.add("scopes", checkPass, strings.Join(scopes, " "), "")
+		return
+	}
+	var unknown []string
+	for _, scope := range scopes {
+		if !containsString(supported, scope) {
+			unknown = append(unknown, scope)
+		}
+	}
+	if len(unknown) > 0 {
+		r.add("scopes", checkWarn, "issuer does not advertise scope(s): "+strings.Join(unknown, ", "),
+			"Unsupported scopes are usually ignored, but some issuers reject the login; the groups claim often needs a provider-specific scope")
+		return
+	}
+	r.add("scopes", checkPass, strings.Join(scopes, " "), "")
+}
+
+// checkPKCE reports whether the issuer supports the S256 PKCE challenge GateKey
+// sends with every login.
+func checkPKCE(r *providerTestResult, methods []string) {
+	switch {
+	case containsString(methods, "S256"):
+		r.add("pkce", checkPass, "issuer supports PKCE (S256)", "")
+	case len(methods) == 0:
+		r.add("pkce", checkPass, "issuer does not advertise PKCE support; logins still work, since issuers without PKCE ignore the challenge", "")
+	default:
+		r.add("pkce", checkWarn, "issuer advertises PKCE without S256: "+strings.Join(methods, ", "),
+			"GateKey only sends S256 challenges; the issuer may reject logins, so check its PKCE settings for the client")
+	}
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) handleTestSAMLProvider(c *gin.Context) {
+	name := c.Param("name")
+
+	provider, err := s.providerStore.GetSAMLProvider(c.Request.Context(), name)
+	if err != nil {
+		if errors.Is(err, db.ErrProviderNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "provider not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get provider"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), providerTestTimeout)
+	defer cancel()
+
+	r := &providerTestResult{Provider: provider.Name, Type: "saml"}
+	checkCallbackURL(r, "acs_url", provider.ACSURL, "/api/v1/auth/saml/acs")
+
+	metadataURL, err := url.Parse(strings.TrimSpace(provider.IDPMetadataURL))
+	if err != nil || metadataURL.Host == "" {
+		r.add("metadata", checkFail, fmt.Sprintf("%q is not a valid URL", provider.IDPMetadataURL), "Use the IdP metadata URL from the identity provider's application settings")
+	} else if md, err := samlsp.FetchMetadata(ctx, http.DefaultClient, *metadataURL); err != nil {
+		r.add("metadata", checkFail, err.Error(), "Check that the metadata URL is reachable from the server and returns IdP EntityDescriptor XML")
+	} else {
+		r.add("metadata", checkPass, "fetched and parsed IdP metadata for "+md.EntityID, "")
+		samlMetadataChecks(r, provider, md, time.Now())
+	}
+
+	r.OK = !r.failed()
+	c.JSON(http.StatusOK, r)
+}
+
+// samlMetadataChecks checks IdP metadata against what GateKey needs and against the
+// SP settings of the provider.
+func samlMetadataChecks(r *providerTestResult, p *db.SAMLProvider, md *saml.EntityDescriptor, now time.Time) {
+	if len(md.IDPSSODescriptors) == 0 {
+		r.add("idp", checkFail, "metadata has no IDPSSODescriptor", "The URL may point at SP metadata or a different document; use the IdP metadata URL")
+		return
+	}
+	idp := md.IDPSSODescriptors[0]
+
+	redirect := false
+	for _, sso := range idp.SingleSignOnServices {
+		if sso.Binding == saml.HTTPRedirectBinding {
+			redirect = true
+		}
+	}
+	if !redirect {
+		r.add("sso_binding", checkFail, "IdP does not offer an HTTP-Redirect SingleSignOnService", "GateKey sends AuthnRequests with the HTTP-Redirect binding; enable it on the IdP")
+	} else {
+		r.add("sso_binding", checkPass, "HTTP-Redirect SingleSignOnService available", "")
+	}
+
+	if idp.WantAuthnRequestsSigned != nil && *idp.WantAuthnRequestsSigned {
+		if p.SignRequests {
+			r.add("authn_signing", checkPass, "IdP requires signed AuthnRequests and sign_requests is on", "")
+		} else {
+			r.add("authn_signing", checkFail, "IdP requires signed AuthnRequests", "Turn on sign_requests for this provider and load GateKey's SP metadata, which has the signing certificate, into the IdP")
+		}
+	}
+
+	checkSAMLSigningCerts(r, idp.KeyDescriptors, now)
+
+	entityID := strings.TrimSpace(p.EntityID)
+	switch {
+	case entityID == "":
+		r.add("entity_id", checkFail, "entity_id is empty", "Set it to the SP entity ID (Audience) configured on the IdP")
+	case entityID == md.EntityID:
+		r.add("entity_id", checkFail, "entity_id is the IdP's own entity ID", "entity_id identifies GateKey as the SP; use the Audience/SP entity ID from the IdP application, not the IdP issuer")
+	default:
+		entity, err := url.Parse(entityID)
+		acs, acsErr := url.Parse(strings.TrimSpace(p.ACSURL))
+		if err == nil && acsErr == nil && entity.Host != "" && acs.Host != "" && !strings.EqualFold(entity.Host, acs.Host) {
+			r.add("entity_id", checkWarn, fmt.Sprintf("entity_id host %s differs from acs_url host %s", entity.Host, acs.Host),
+				"This is valid but often a copy/paste mistake; both usually use GateKey's public hostname")
+		} else {
+			r.add("entity_id", checkPass, entityID, "")
+		}
+	}
+}
+
+// checkSAMLSigningCerts checks that the IdP publishes a usable signing certificate.
+func checkSAMLSigningCerts(r *providerTestResult, keys []saml.KeyDescriptor, now time.Time) {
+	var certs []*x509.Certificate
+	for _, kd := range keys {
+		if kd.Use != "" && kd.Use != "signing" {
+			continue
+		}
+		for _, xc := range kd.KeyInfo.X509Data.X509Certificates {
+			der, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(xc.Data), ""))
+			if err != nil {
+				continue
+			}
+			if cert, err := x509.ParseCertificate(der); err == nil {
+				certs = append(certs, cert)
+			}
+		}
+	}
+
+	if len(certs) == 0 {
+		r.add("signing_cert", checkFail, "metadata has no parseable signing certificate", "Assertions can't be verified; check the IdP metadata includes its X.509 signing certificate")
+		return
+	}
+
+	latest := certs[0]
+	for _, cert := range certs[1:] {
+		if cert.NotAfter.After(latest.NotAfter) {
+			latest = cert
+		}
+	}
+	switch {
+	case now.After(latest.NotAfter):
+		r.add("signing_cert", checkFail, fmt.Sprintf("signing certificate expired %s", latest.NotAfter.Format(time.RFC3339)), "Rotate the signing certificate on the IdP")
+	case latest.NotAfter.Sub(now) < 30*24*time.Hour:
+		r.add("signing_cert", checkWarn, fmt.Sprintf("signing certificate expires %s", latest.NotAfter.Format(time.RFC3339)), "Plan a certificate rotation on the IdP")
+	default:
+		r.add("signing_cert", checkPass, fmt.Sprintf("valid until %s", latest.NotAfter.Format(time.RFC3339)), "")
+	}
+}
@@ -0,0 +1,136 @@
+package api
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/crewjam/saml"
+
+	"github.com/gatekey-project/gatekey/internal/db"
+)
+
+func checkStatuses(r *providerTestResult) map[string]string {
+	statuses := make(map[string]string)
+	for _, c := range r.Checks {
+		statuses[c.Name] = c.Status
+	}
+	return statuses
+}
+
+func TestTestOIDCProviderRejectedCredentials(t *testing.T) {
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                           srv.URL,
+			"authorization_endpoint":           srv.URL + "/authorize",
+			"token_endpoint":                   srv.URL + "/token",
+			"jwks_uri":                         srv.URL + "/jwks",
+			"scopes_supported":                 []string{"openid", "email", "profile"},
+			"grant_types_supported":            []string{"authorization_code", "client_credentials"},
+			"code_challenge_methods_supported": []string{"plain", "S256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"keys":[{"kty":"RSA","kid":"1","n":"AQAB","e":"AQAB"}]}`))
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(`{"error":"invalid_client"}`))
+	})
+
+	result := testOIDCProvider(context.Background(), &db.OIDCProvider{
+		Name:         "test",
+		Issuer:       srv.URL,
+		ClientID:     "client",
+		ClientSecret: "wrong",
+		RedirectURL:  "https://vpn.example.com/api/v1/auth/oidc/callback",
+	})
+
+	statuses := checkStatuses(result)
+	for name, want := range map[string]string{
+		"discovery":    checkPass,
+		"jwks":         checkPass,
+		"scopes":       checkPass,
+		"redirect_url": checkPass,
+		"pkce":         checkPass,
+		"credentials":  checkFail,
+	} {
+		if statuses[name] != want {
+			t.Errorf("%s = %q, want %q", name, statuses[name], want)
+		}
+	}
+	if result.OK {
+		t.Error("expected result not OK with rejected credentials")
+	}
+}
+
+func TestSAMLMetadataChecks(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "idp"},
+		NotBefore:    now.Add(-48 * time.Hour),
+		NotAfter:     now.Add(-time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantSigned := true
+	md := &saml.EntityDescriptor{
+		EntityID: "https://idp.example.com/metadata",
+		IDPSSODescriptors: []saml.IDPSSODescriptor{{
+			SSODescriptor: saml.SSODescriptor{RoleDescriptor: saml.RoleDescriptor{
+				KeyDescriptors: []saml.KeyDescriptor{{
+					Use: "signing",
+					KeyInfo: saml.KeyInfo{X509Data: saml.X509Data{X509Certificates: []saml.X509Certificate{
+						{Data: base64.StdEncoding.EncodeToString(der)},
+					}}},
+				}},
+			}},
+			WantAuthnRequestsSigned: &wantSigned,
+			SingleSignOnServices: []saml.Endpoint{
+				{Binding: saml.HTTPPostBinding, Location: "https://idp.example.com/sso"},
+			},
+		}},
+	}
+
+	r := &providerTestResult{}
+	samlMetadataChecks(r, &db.SAMLProvider{
+		EntityID: "https://idp.example.com/metadata",
+		ACSURL:   "https://vpn.example.com/api/v1/auth/saml/acs",
+	}, md, now)
+
+	statuses := checkStatuses(r)
+	for _, name := range []string{"sso_binding", "authn_signing", "signing_cert", "entity_id"} {
+		if statuses[name] != checkFail {
+			t.Errorf("%s = %q, want fail", name, statuses[name])
+		}
+	}
+
+	r = &providerTestResult{}
+	samlMetadataChecks(r, &db.SAMLProvider{SignRequests: true}, md, now)
+	if got := checkStatuses(r)["authn_signing"]; got != checkPass {
+		t.Errorf("authn_signing with sign_requests = %q, want pass", got)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 
+	authoidc "github.com/gatekey-project/gatekey/internal/auth/oidc"
 	"github.com/gatekey-project/gatekey/internal/db"
 )
 
@@ -27,8 +28,7 @@ func (s *Server) handleGetOIDCProvidersDynamic(c *gin.Context) {
 
 func (s *Server) handleCreateOIDCProviderDynamic(c *gin.Context) {
 	var provider db.OIDCProvider
-	if err := c.ShouldBindJSON(&provider); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+	if !bindJSON(c, &provider) {
 		return
 	}
 
@@ -37,6 +37,21 @@ func (s *Server) handleCreateOIDCProviderDynamic(c *gin.Context) {
 		return
 	}
 
+	if err := authoidc.ValidateAudiences(provider.ClientID, provider.AdditionalAudiences); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := authoidc.ValidateCNSource(provider.CNSource); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	warnings, err := validateOIDCRedirectURL(provider.RedirectURL, s.baseURL(c))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	if err := s.providerStore.CreateOIDCProvider(c.Request.Context(), &provider); err != nil {
 		if err == db.ErrProviderExists {
 			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
@@ -47,15 +62,34 @@ func (s *Server) handleCreateOIDCProviderDynamic(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{"message": "provider created", "name": provider.Name})
+	c.JSON(http.StatusCreated, gin.H{
+		"message":      "provider created",
+		"name":         provider.Name,
+		"redirect_url": s.oidcRedirectURL(c, &provider),
+		"warnings":     warnings,
+	})
 }
 
 func (s *Server) handleUpdateOIDCProviderDynamic(c *gin.Context) {
 	name := c.Param("name")
 
 	var provider db.OIDCProvider
-	if err := c.ShouldBindJSON(&provider); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+	if !bindJSON(c, &provider) {
+		return
+	}
+
+	if err := authoidc.ValidateAudiences(provider.ClientID, provider.AdditionalAudiences); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := authoidc.ValidateCNSource(provider.CNSource); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	warnings, err := validateOIDCRedirectURL(provider.RedirectURL, s.baseURL(c))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
@@ -69,7 +103,12 @@ func (s *Server) handleUpdateOIDCProviderDynamic(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "provider updated", "name": name})
+	c.JSON(http.StatusOK, gin.H{
+		"message":      "provider updated",
+		"name":         name,
+		"redirect_url": s.oidcRedirectURL(c, &provider),
+		"warnings":     warnings,
+	})
 }
 
 func (s *Server) handleDeleteOIDCProviderDynamic(c *gin.Context) {
@@ -106,8 +145,7 @@ func (s *Server) handleGetSAMLProvidersDynamic(c *gin.Context) {
 
 func (s *Server) handleCreateSAMLProviderDynamic(c *gin.Context) {
 	var provider db.SAMLProvider
-	if err := c.ShouldBindJSON(&provider); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+	if !bindJSON(c, &provider) {
 		return
 	}
 
@@ -115,6 +153,10 @@ func (s *Server) handleCreateSAMLProviderDynamic(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "name, idp_metadata_url, and entity_id are required"})
 		return
 	}
+	if !validSAMLNameIDFormat(provider.NameIDFormat) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unsupported name_id_format"})
+		return
+	}
 
 	if err := s.providerStore.CreateSAMLProvider(c.Request.Context(), &provider); err != nil {
 		if err == db.ErrProviderExists {
@@ -133,8 +175,11 @@ func (s *Server) handleUpdateSAMLProviderDynamic(c *gin.Context) {
 	name := c.Param("name")
 
 	var provider db.SAMLProvider
-	if err := c.ShouldBindJSON(&provider); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+	if !bindJSON(c, &provider) {
+		return
+	}
+	if !validSAMLNameIDFormat(provider.NameIDFormat) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unsupported name_id_format"})
 		return
 	}
 
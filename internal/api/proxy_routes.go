@@ -60,14 +60,13 @@ func (s *Server) handleCreateProxyApp(c *gin.Context) {
 		IsActive           *bool             `json:"is_active"`
 		PreserveHostHeader *bool             `json:"preserve_host_header"`
 		StripPrefix        *bool             `json:"strip_prefix"`
-		InjectHeaders      map[string]string `json:"inject_headers"`
-		AllowedHeaders     []string          `json:"allowed_headers"`
+		InjectHeaders      map[string]string `json:"inject_headers" binding:"max=64"`
+		AllowedHeaders     []string          `json:"allowed_headers" binding:"max=64"`
 		WebsocketEnabled   *bool             `json:"websocket_enabled"`
 		TimeoutSeconds     *int              `json:"timeout_seconds"`
 	}
 
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &req) {
 		return
 	}
 
@@ -217,14 +216,13 @@ func (s *Server) handleUpdateProxyApp(c *gin.Context) {
 		IsActive           *bool             `json:"is_active"`
 		PreserveHostHeader *bool             `json:"preserve_host_header"`
 		StripPrefix        *bool             `json:"strip_prefix"`
-		InjectHeaders      map[string]string `json:"inject_headers"`
-		AllowedHeaders     []string          `json:"allowed_headers"`
+		InjectHeaders      map[string]string `json:"inject_headers" binding:"max=64"`
+		AllowedHeaders     []string          `json:"allowed_headers" binding:"max=64"`
 		WebsocketEnabled   *bool             `json:"websocket_enabled"`
 		TimeoutSeconds     *int              `json:"timeout_seconds"`
 	}
 
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &req) {
 		return
 	}
 
@@ -363,18 +361,18 @@ func (s *Server) handleAssignProxyAppToUser(c *gin.Context) {
 	var req struct {
 		UserID string `json:"user_id" binding:"required"`
 	}
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &req) {
 		return
 	}
 
-	if err := s.proxyAppStore.AssignAppToUser(c.Request.Context(), req.UserID, id); err != nil {
+	created, err := s.proxyAppStore.AssignAppToUser(c.Request.Context(), req.UserID, id)
+	if err != nil {
 		s.logger.Error("Failed to assign proxy app to user", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to assign user"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "user assigned"})
+	c.JSON(http.StatusOK, gin.H{"message": "user assigned", "created": created})
 }
 
 func (s *Server) handleRemoveProxyAppFromUser(c *gin.Context) {
@@ -439,18 +437,18 @@ func (s *Server) handleAssignProxyAppToGroup(c *gin.Context) {
 	var req struct {
 		GroupName string `json:"group_name" binding:"required"`
 	}
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &req) {
 		return
 	}
 
-	if err := s.proxyAppStore.AssignAppToGroup(c.Request.Context(), req.GroupName, id); err != nil {
+	created, err := s.proxyAppStore.AssignAppToGroup(c.Request.Context(), req.GroupName, id)
+	if err != nil {
 		s.logger.Error("Failed to assign proxy app to group", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to assign group"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "group assigned"})
+	c.JSON(http.StatusOK, gin.H{"message": "group assigned", "created": created})
 }
 
 func (s *Server) handleRemoveProxyAppFromGroup(c *gin.Context) {
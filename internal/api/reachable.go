@@ -0,0 +1,156 @@
+package api
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/gatekey-project/gatekey/internal/db"
+)
+
+// reachableTarget is something a user can reach through a gateway.
+type reachableTarget struct {
+	Rule        string `json:"rule"`
+	Description string `json:"description,omitempty"`
+	Type        string `json:"type"`
+	Value       string `json:"value"`
+	Ports       string `json:"ports,omitempty"`
+	Protocol    string `json:"protocol,omitempty"`
+	Network     string `json:"network"`
+}
+
+// handleGetReachableNetworks returns what the authenticated user can reach
+// through a gateway: their access rules on the gateway's networks, with IP and
+// CIDR rules narrowed to the part of the network the gateway routes.
+func (s *Server) handleGetReachableNetworks(c *gin.Context) {
+	gateway, targets, ok := s.userReachableTargets(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"gatewayId":   gateway.ID,
+		"gatewayName": gateway.Name,
+		"reachable":   targets,
+	})
+}
+
+// userReachableTargets looks up the gateway in the request path and what the
+// authenticated user can reach through it. If the user can't use the gateway,
+// it writes the error response and returns false.
+func (s *Server) userReachableTargets(c *gin.Context) (*db.Gateway, []reachableTarget, bool) {
+	ctx := c.Request.Context()
+	userID, groups, err := s.getCurrentUserInfo(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return nil, nil, false
+	}
+
+	gateway, err := s.gatewayStore.GetGateway(ctx, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "gateway not found"})
+		return nil, nil, false
+	}
+
+	hasAccess, err := s.gatewayStore.UserHasGatewayAccess(ctx, userID, gateway.ID, groups)
+	if err != nil {
+		s.logger.Error("Failed to check gateway access", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check access"})
+		return nil, nil, false
+	}
+	if !hasAccess {
+		c.JSON(http.StatusForbidden, gin.H{"error": "you do not have access to this gateway"})
+		return nil, nil, false
+	}
+
+	rules, err := s.accessRuleStore.GetUserAccessRulesForGateway(ctx, userID, groups, gateway.ID)
+	if err != nil {
+		s.logger.Error("Failed to get user access rules", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get access rules"})
+		return nil, nil, false
+	}
+	networks, err := s.networkStore.GetGatewayNetworks(ctx, gateway.ID)
+	if err != nil {
+		s.logger.Error("Failed to get gateway networks", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get gateway networks"})
+		return nil, nil, false
+	}
+
+	return gateway, reachableTargets(rules, networks), true
+}
+
+// reachableTargets intersects access rules with the networks a gateway routes.
+// Rules on inactive networks are dropped, and IP or CIDR rules that fall outside
+// their network are dropped or narrowed to it, since that traffic isn't routed
+// through the tunnel. Hostname rules are kept as they are.
+func reachableTargets(rules []*db.AccessRule, networks []*db.Network) []reachableTarget {
+	byID := make(map[string]*db.Network, len(networks))
+	for _, n := range networks {
+		if n.IsActive {
+			byID[n.ID] = n
+		}
+	}
+
+	targets := make([]reachableTarget, 0, len(rules))
+	for _, rule := range rules {
+		if rule.NetworkID == nil {
+			continue
+		}
+		network, ok := byID[*rule.NetworkID]
+		if !ok {
+			continue
+		}
+
+		value := rule.Value
+		switch rule.RuleType {
+		case db.AccessRuleTypeIP, db.AccessRuleTypeCIDR:
+			var ok bool
+			if value, ok = intersectCIDR(rule.Value, network.CIDR); !ok {
+				continue
+			}
+		}
+
+		target := reachableTarget{
+			Rule:        rule.Name,
+			Description: rule.Description,
+			Type:        string(rule.RuleType),
+			Value:       value,
+			Network:     network.Name,
+		}
+		if rule.PortRange != nil && *rule.PortRange != "*" {
+			target.Ports = *rule.PortRange
+		}
+		if rule.Protocol != nil && *rule.Protocol != "*" {
+			target.Protocol = *rule.Protocol
+		}
+		targets = append(targets, target)
+	}
+	return targets
+}
+
+// intersectCIDR returns the overlap of an IP or CIDR with a network's CIDR. Two
+// CIDRs either nest or are disjoint, so the overlap is the smaller of the two.
+func intersectCIDR(value, networkCIDR string) (string, bool) {
+	_, network, err := net.ParseCIDR(networkCIDR)
+	if err != nil {
+		return "", false
+	}
+	if ip := net.ParseIP(value); ip != nil {
+		return value, network.Contains(ip)
+	}
+	_, target, err := net.ParseCIDR(value)
+	if err != nil {
+		return "", false
+	}
+
+	targetOnes, _ := target.Mask.Size()
+	networkOnes, _ := network.Mask.Size()
+	switch {
+	case targetOnes >= networkOnes && network.Contains(target.IP):
+		return target.String(), true
+	case networkOnes > targetOnes && target.Contains(network.IP):
+		return network.String(), true
+	}
+	return "", false
+}
@@ -0,0 +1,38 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/gatekey-project/gatekey/internal/db"
+)
+
+func TestReachableTargets(t *testing.T) {
+	networks := []*db.Network{
+		{ID: "n1", Name: "prod", CIDR: "10.0.0.0/16", IsActive: true},
+		{ID: "n2", Name: "old", CIDR: "10.9.0.0/16", IsActive: false},
+	}
+	rules := []*db.AccessRule{
+		{Name: "web", Description: "ticket #123", RuleType: db.AccessRuleTypeIP, Value: "10.0.0.1", PortRange: strPtr("443"), Protocol: strPtr("tcp"), NetworkID: strPtr("n1")},
+		{Name: "subnet", RuleType: db.AccessRuleTypeCIDR, Value: "10.0.4.0/24", NetworkID: strPtr("n1")},
+		{Name: "everything", RuleType: db.AccessRuleTypeCIDR, Value: "10.0.0.0/8", PortRange: strPtr("*"), NetworkID: strPtr("n1")},
+		{Name: "elsewhere", RuleType: db.AccessRuleTypeIP, Value: "192.168.1.1", NetworkID: strPtr("n1")},
+		{Name: "wiki", RuleType: db.AccessRuleTypeHostname, Value: "wiki.internal", NetworkID: strPtr("n1")},
+		{Name: "inactive network", RuleType: db.AccessRuleTypeIP, Value: "10.9.0.1", NetworkID: strPtr("n2")},
+	}
+
+	got := reachableTargets(rules, networks)
+	want := []reachableTarget{
+		{Rule: "web", Description: "ticket #123", Type: "ip", Value: "10.0.0.1", Ports: "443", Protocol: "tcp", Network: "prod"},
+		{Rule: "subnet", Type: "cidr", Value: "10.0.4.0/24", Network: "prod"},
+		{Rule: "everything", Type: "cidr", Value: "10.0.0.0/16", Network: "prod"},
+		{Rule: "wiki", Type: "hostname", Value: "wiki.internal", Network: "prod"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("reachableTargets() = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("target %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/gatekey-project/gatekey/internal/db"
+)
+
+// oidcCallbackPath is where identity providers send users back after OIDC login.
+const oidcCallbackPath = "/api/v1/auth/oidc/callback"
+
+// baseURL returns the external base URL of the server, for building links back to
+// it: server.base_url if configured, otherwise derived from the request.
+func (s *Server) baseURL(c *gin.Context) string {
+	if s.config.Server.BaseURL != "" {
+		return s.config.Server.BaseURL
+	}
+	return requestBaseURL(c)
+}
+
+// emailBaseURL returns server.base_url, for links sent by email. They carry
+// single-use tokens, so unlike baseURL they are never built from request
+// headers, which whoever sent the request controls. Empty when unset.
+func (s *Server) emailBaseURL() string {
+	return s.config.Server.BaseURL
+}
+
+// requestBaseURL returns the external base URL of the server as seen by the client,
+// honoring X-Forwarded-Proto from a reverse proxy.
+func requestBaseURL(c *gin.Context) string {
+	scheme := strings.TrimSpace(strings.Split(c.GetHeader("X-Forwarded-Proto"), ",")[0])
+	if scheme == "" {
+		if c.Request.TLS != nil {
+			scheme = "https"
+		} else {
+			scheme = "http"
+		}
+	}
+	return scheme + "://" + c.Request.Host
+}
+
+// oidcRedirectURL returns the redirect URL for a provider: the configured one if
+// set, otherwise one on the server's base URL.
+func (s *Server) oidcRedirectURL(c *gin.Context, provider *db.OIDCProvider) string {
+	if redirectURL := strings.TrimSpace(provider.RedirectURL); redirectURL != "" {
+		return redirectURL
+	}
+	return s.baseURL(c) + oidcCallbackPath
+}
+
+// validateOIDCRedirectURL checks a configured redirect URL. Malformed URLs are an
+// error; a wrong callback path or a host other than the server's own are returned
+// as warnings, since proxies can make either legitimate.
+func validateOIDCRedirectURL(raw, baseURL string) ([]string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return []string{}, nil
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("redirect_url must be an absolute http(s) URL, e.g. %s%s", baseURL, oidcCallbackPath)
+	}
+	if u.RawQuery != "" || u.Fragment != "" {
+		return nil, fmt.Errorf("redirect_url must not contain a query or fragment")
+	}
+
+	warnings := []string{}
+	if strings.TrimSuffix(u.Path, "/") != oidcCallbackPath {
+		warnings = append(warnings, fmt.Sprintf("redirect_url path %q does not point to %s, so logins will not complete", u.Path, oidcCallbackPath))
+	}
+	if base, err := url.Parse(baseURL); err == nil && !strings.EqualFold(base.Host, u.Host) {
+		warnings = append(warnings, fmt.Sprintf("redirect_url host %s differs from %s, the host the server is reached on", u.Host, base.Host))
+	}
+	return warnings, nil
+}
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/gatekey-project/gatekey/internal/config"
+)
+
+func TestValidateOIDCRedirectURL(t *testing.T) {
+	base := "https://vpn.example.com"
+
+	tests := []struct {
+		url      string
+		warnings int
+		wantErr  bool
+	}{
+		{"", 0, false},
+		{"https://vpn.example.com/api/v1/auth/oidc/callback", 0, false},
+		{"https://vpn.example.com/api/v1/auth/oidc/callback/", 0, false},
+		{"https://vpn.example.com/callback", 1, false},
+		{"https://other.example.com/api/v1/auth/oidc/callback", 1, false},
+		{"https://other.example.com/oidc", 2, false},
+		{"vpn.example.com/api/v1/auth/oidc/callback", 0, true},
+		{"https://vpn.example.com/api/v1/auth/oidc/callback?x=1", 0, true},
+	}
+
+	for _, tt := range tests {
+		warnings, err := validateOIDCRedirectURL(tt.url, base)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("validateOIDCRedirectURL(%q) error = %v, wantErr %v", tt.url, err, tt.wantErr)
+			continue
+		}
+		if len(warnings) != tt.warnings {
+			t.Errorf("validateOIDCRedirectURL(%q) warnings = %v, want %d", tt.url, warnings, tt.warnings)
+		}
+	}
+}
+
+func TestServerBaseURL(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		configured string
+		proto      string
+		want       string
+	}{
+		{"", "", "http://internal:8080"},
+		{"", "https", "https://internal:8080"},
+		{"https://vpn.example.com", "", "https://vpn.example.com"},
+		{"https://vpn.example.com", "http", "https://vpn.example.com"},
+	}
+	for _, tt := range tests {
+		s := &Server{config: &config.Config{Server: config.ServerConfig{BaseURL: tt.configured}}}
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodGet, "http://internal:8080/downloads", nil)
+		if tt.proto != "" {
+			c.Request.Header.Set("X-Forwarded-Proto", tt.proto)
+		}
+		if got := s.baseURL(c); got != tt.want {
+			t.Errorf("baseURL(configured=%q, proto=%q) = %q, want %q", tt.configured, tt.proto, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,392 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/gatekey-project/gatekey/internal/db"
+	"github.com/gatekey-project/gatekey/internal/openvpn"
+	"github.com/gatekey-project/gatekey/internal/pki"
+)
+
+// Rollout states of a component in GET /admin/reprovision/progress
+const (
+	rolloutConverged = "converged" // Running the expected config, provisioned with the active CA
+	rolloutPending   = "pending"   // Still to reprovision
+	rolloutUnknown   = "unknown"   // Hasn't reported or provisioned since tracking began
+)
+
+// reprovisionRequest is the body of POST /admin/reprovision. With all set every
+// gateway, hub and spoke is reprovisioned; otherwise only the listed ones are.
+type reprovisionRequest struct {
+	All        bool     `json:"all"`
+	GatewayIDs []string `json:"gateway_ids" binding:"max=1000"`
+	HubIDs     []string `json:"hub_ids" binding:"max=1000"`
+	SpokeIDs   []string `json:"spoke_ids" binding:"max=1000"`
+}
+
+// reprovisionTargets are the components a bulk reprovision applies to
+type reprovisionTargets struct {
+	gateways []*db.Gateway
+	hubs     []*db.MeshHub
+	spokes   []*db.MeshSpoke
+}
+
+// triggerGatewayReprovision gives a gateway a new config version so it reprovisions
+// on its next heartbeat, and returns that version.
+func (s *Server) triggerGatewayReprovision(ctx context.Context, gatewayID string) (string, error) {
+	// A fresh version never matches the gateway's current one
+	newConfigVersion := fmt.Sprintf("%s%d", openvpn.ReprovisionVersionPrefix, time.Now().UnixNano())
+	if err := s.gatewayStore.UpdateGatewayConfigVersion(ctx, gatewayID, newConfigVersion); err != nil {
+		return "", err
+	}
+	if err := s.provisioningStore.RequestReprovision(ctx, db.ComponentGateway, gatewayID); err != nil {
+		s.logger.Warn("Failed to record reprovision request", zap.String("gateway_id", gatewayID), zap.Error(err))
+	}
+	return newConfigVersion, nil
+}
+
+// meshReprovisionRequested reports whether an admin asked a hub or spoke to
+// reprovision and it hasn't provisioned since. Lookup errors are logged and
+// treated as no request, so heartbeats keep working.
+func (s *Server) meshReprovisionRequested(ctx context.Context, componentType, componentID string) bool {
+	status, err := s.provisioningStore.Get(ctx, componentType, componentID)
+	if err != nil {
+		s.logger.Warn("Failed to get provisioning status",
+			zap.String("component_type", componentType), zap.String("component_id", componentID), zap.Error(err))
+		return false
+	}
+	return status.ReprovisionPending()
+}
+
+// recordHeartbeatVersion stores the config version a component reported
+func (s *Server) recordHeartbeatVersion(ctx context.Context, componentType, componentID, configVersion string) {
+	if err := s.provisioningStore.RecordReport(ctx, componentType, componentID, configVersion); err != nil {
+		s.logger.Warn("Failed to record reported config version",
+			zap.String("component_type", componentType), zap.String("component_id", componentID), zap.Error(err))
+	}
+}
+
+// recordProvisioned stores the root CA a component was just provisioned with
+func (s *Server) recordProvisioned(ctx context.Context, componentType, componentID string) {
+	if s.ca == nil || s.ca.Certificate() == nil {
+		return
+	}
+	if err := s.provisioningStore.RecordProvisioned(ctx, componentType, componentID, pki.Fingerprint(s.ca.Certificate())); err != nil {
+		s.logger.Warn("Failed to record provisioning",
+			zap.String("component_type", componentType), zap.String("component_id", componentID), zap.Error(err))
+	}
+}
+
+// reprovisionTargets resolves the components a bulk reprovision applies to. The
+// returned status and message describe the first ID that couldn't be resolved.
+func (s *Server) reprovisionTargets(ctx context.Context, req *reprovisionRequest) (*reprovisionTargets, int, string) {
+	targets := &reprovisionTargets{}
+
+	if req.All {
+		gateways, err := s.gatewayStore.ListGateways(ctx)
+		if err != nil {
+			s.logger.Error("Failed to list gateways", zap.Error(err))
+			return nil, http.StatusInternalServerError, "failed to list gateways"
+		}
+		hubs, err := s.meshStore.ListHubs(ctx)
+		if err != nil {
+			s.logger.Error("Failed to list mesh hubs", zap.Error(err))
+			return nil, http.StatusInternalServerError, "failed to list mesh hubs"
+		}
+		targets.gateways = gateways
+		targets.hubs = hubs
+		for _, hub := range hubs {
+			spokes, err := s.meshStore.ListMeshSpokesByHub(ctx, hub.ID)
+			if err != nil {
+				s.logger.Error("Failed to list mesh spokes", zap.Error(err))
+				return nil, http.StatusInternalServerError, "failed to list mesh spokes"
+			}
+			targets.spokes = append(targets.spokes, spokes...)
+		}
+		return targets, http.StatusOK, ""
+	}
+
+	for _, id := range req.GatewayIDs {
+		gateway, err := s.gatewayStore.GetGateway(ctx, id)
+		if err == db.ErrGatewayNotFound {
+			return nil, http.StatusNotFound, fmt.Sprintf("gateway %s not found", id)
+		}
+		if err != nil {
+			s.logger.Error("Failed to get gateway", zap.Error(err), zap.String("id", id))
+			return nil, http.StatusInternalServerError, "failed to get gateway"
+		}
+		targets.gateways = append(targets.gateways, gateway)
+	}
+	for _, id := range req.HubIDs {
+		hub, err := s.meshStore.GetHub(ctx, id)
+		if err == db.ErrMeshHubNotFound {
+			return nil, http.StatusNotFound, fmt.Sprintf("hub %s not found", id)
+		}
+		if err != nil {
+			s.logger.Error("Failed to get mesh hub", zap.Error(err), zap.String("id", id))
+			return nil, http.StatusInternalServerError, "failed to get mesh hub"
+		}
+		targets.hubs = append(targets.hubs, hub)
+	}
+	for _, id := range req.SpokeIDs {
+		spoke, err := s.meshStore.GetMeshSpoke(ctx, id)
+		if err == db.ErrMeshSpokeNotFound {
+			return nil, http.StatusNotFound, fmt.Sprintf("spoke %s not found", id)
+		}
+		if err != nil {
+			s.logger.Error("Failed to get mesh spoke", zap.Error(err), zap.String("id", id))
+			return nil, http.StatusInternalServerError, "failed to get mesh spoke"
+		}
+		targets.spokes = append(targets.spokes, spoke)
+	}
+	return targets, http.StatusOK, ""
+}
+
+// triggerBulkReprovision gives gateways a new config version and tells hubs and
+// spokes to reprovision on their next heartbeat, and returns the IDs of each.
+// It stops at the first component it can't trigger.
+func (s *Server) triggerBulkReprovision(ctx context.Context, targets *reprovisionTargets) (gatewayIDs, hubIDs, spokeIDs []string, err error) {
+	for _, gateway := range targets.gateways {
+		if _, err := s.triggerGatewayReprovision(ctx, gateway.ID); err != nil {
+			s.logger.Error("Failed to trigger gateway reprovision", zap.Error(err), zap.String("gateway", gateway.Name))
+			return nil, nil, nil, fmt.Errorf("failed to trigger reprovision of gateway %s", gateway.Name)
+		}
+		gatewayIDs = append(gatewayIDs, gateway.ID)
+	}
+	for _, hub := range targets.hubs {
+		if err := s.provisioningStore.RequestReprovision(ctx, db.ComponentHub, hub.ID); err != nil {
+			s.logger.Error("Failed to trigger hub reprovision", zap.Error(err), zap.String("hub", hub.Name))
+			return nil, nil, nil, fmt.Errorf("failed to trigger reprovision of hub %s", hub.Name)
+		}
+		hubIDs = append(hubIDs, hub.ID)
+	}
+	for _, spoke := range targets.spokes {
+		if err := s.provisioningStore.RequestReprovision(ctx, db.ComponentSpoke, spoke.ID); err != nil {
+			s.logger.Error("Failed to trigger spoke reprovision", zap.Error(err), zap.String("spoke", spoke.Name))
+			return nil, nil, nil, fmt.Errorf("failed to trigger reprovision of spoke %s", spoke.Name)
+		}
+		spokeIDs = append(spokeIDs, spoke.ID)
+	}
+	return gatewayIDs, hubIDs, spokeIDs, nil
+}
+
+// handleBulkReprovision triggers a reprovision of many gateways, hubs and spokes at
+// once, typically after activating a new CA. Gateways get a new config version;
+// hubs and spokes are told to reprovision on their next heartbeat.
+func (s *Server) handleBulkReprovision(c *gin.Context) {
+	if _, ok := s.requireAdmin(c); !ok {
+		return
+	}
+
+	var req reprovisionRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	if !req.All && len(req.GatewayIDs) == 0 && len(req.HubIDs) == 0 && len(req.SpokeIDs) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "set all or list gateway_ids, hub_ids or spoke_ids"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	targets, status, msg := s.reprovisionTargets(ctx, &req)
+	if targets == nil {
+		c.JSON(status, gin.H{"error": msg})
+		return
+	}
+
+	gatewayIDs, hubIDs, spokeIDs, err := s.triggerBulkReprovision(ctx, targets)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	s.recordAudit(c, "reprovision.bulk", "reprovision", "", gin.H{
+		"all":        req.All,
+		"gatewayIds": gatewayIDs,
+		"hubIds":     hubIDs,
+		"spokeIds":   spokeIDs,
+	})
+	s.logger.Info("Bulk reprovision triggered",
+		zap.Int("gateways", len(gatewayIDs)),
+		zap.Int("hubs", len(hubIDs)),
+		zap.Int("spokes", len(spokeIDs)))
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "reprovision triggered - components will reprovision on their next heartbeat",
+		"gateways": len(gatewayIDs),
+		"hubs":     len(hubIDs),
+		"spokes":   len(spokeIDs),
+	})
+}
+
+// rolloutState classifies a component against the config version and root CA it
+// should be running.
+func rolloutState(expectedVersion, expectedCA string, status *db.ProvisioningStatus) string {
+	if status.ReprovisionPending() {
+		return rolloutPending
+	}
+	if status == nil || status.ReportedAt == nil || status.ProvisionedCAFingerprint == "" {
+		return rolloutUnknown
+	}
+	// A gateway without a server-side version is never told to reprovision
+	if expectedVersion != "" && status.ReportedConfigVersion != expectedVersion {
+		return rolloutPending
+	}
+	if status.ProvisionedCAFingerprint != expectedCA {
+		return rolloutPending
+	}
+	return rolloutConverged
+}
+
+// componentProgress describes one component in GET /admin/reprovision/progress
+func componentProgress(componentType, id, name string, lastHeartbeat *time.Time, expectedVersion, expectedCA string, status *db.ProvisioningStatus) gin.H {
+	entry := gin.H{
+		"type":                     componentType,
+		"id":                       id,
+		"name":                     name,
+		"state":                    rolloutState(expectedVersion, expectedCA, status),
+		"lastHeartbeat":            lastHeartbeat,
+		"expectedConfigVersion":    expectedVersion,
+		"reportedConfigVersion":    "",
+		"expectedCaFingerprint":    expectedCA,
+		"provisionedCaFingerprint": "",
+		"provisionedAt":            nil,
+		"reprovisionRequestedAt":   nil,
+	}
+	if status != nil {
+		entry["reportedConfigVersion"] = status.ReportedConfigVersion
+		entry["provisionedCaFingerprint"] = status.ProvisionedCAFingerprint
+		entry["provisionedAt"] = status.ProvisionedAt
+		entry["reprovisionRequestedAt"] = status.ReprovisionRequestedAt
+	}
+	return entry
+}
+
+// rolloutProgress is where every gateway, hub and spoke stands against the config
+// version and root CA it should be running.
+type rolloutProgress struct {
+	activeCA   string
+	components []gin.H
+	counts     map[string]int // Components by rollout state
+	usingCA    map[string]int // Components by the CA they were provisioned with
+}
+
+// rolloutProgress collects the rollout state of every gateway, hub and spoke.
+func (s *Server) rolloutProgress(ctx context.Context) (*rolloutProgress, error) {
+	p := &rolloutProgress{
+		components: []gin.H{},
+		counts:     map[string]int{rolloutConverged: 0, rolloutPending: 0, rolloutUnknown: 0},
+		usingCA:    make(map[string]int),
+	}
+	if s.ca != nil && s.ca.Certificate() != nil {
+		p.activeCA = pki.Fingerprint(s.ca.Certificate())
+	}
+	add := func(entry gin.H, status *db.ProvisioningStatus) {
+		p.components = append(p.components, entry)
+		p.counts[entry["state"].(string)]++
+		if status != nil && status.ProvisionedCAFingerprint != "" {
+			p.usingCA[status.ProvisionedCAFingerprint]++
+		}
+	}
+
+	gateways, err := s.gatewayStore.ListGateways(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list gateways: %w", err)
+	}
+	statuses, err := s.provisioningStore.List(ctx, db.ComponentGateway)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list provisioning status: %w", err)
+	}
+	for _, gw := range gateways {
+		status := statuses[gw.ID]
+		add(componentProgress(db.ComponentGateway, gw.ID, gw.Name, gw.LastHeartbeat, gw.ConfigVersion, p.activeCA, status), status)
+	}
+
+	hubs, err := s.meshStore.ListHubs(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list mesh hubs: %w", err)
+	}
+	hubStatuses, err := s.provisioningStore.List(ctx, db.ComponentHub)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list provisioning status: %w", err)
+	}
+	spokeStatuses, err := s.provisioningStore.List(ctx, db.ComponentSpoke)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list provisioning status: %w", err)
+	}
+	for _, listed := range hubs {
+		// The listing leaves out the PKI the expected versions are computed from
+		hub, err := s.meshStore.GetHub(ctx, listed.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get mesh hub %s: %w", listed.ID, err)
+		}
+		hubVersion := computeConfigVersion(hub.VPNPort, hub.VPNProtocol, hub.VPNSubnet, hub.CryptoProfile, hub.TLSAuthEnabled, hub.TLSMode, hub.TLSAuthKey, hub.CACert)
+		status := hubStatuses[hub.ID]
+		add(componentProgress(db.ComponentHub, hub.ID, hub.Name, hub.LastHeartbeat, hubVersion, p.activeCA, status), status)
+
+		spokes, err := s.meshStore.ListMeshSpokesByHub(ctx, hub.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list mesh spokes: %w", err)
+		}
+		spokeVersion := computeSpokeConfigVersion(hub)
+		for _, spoke := range spokes {
+			status := spokeStatuses[spoke.ID]
+			add(componentProgress(db.ComponentSpoke, spoke.ID, spoke.Name, spoke.LastSeen, spokeVersion, p.activeCA, status), status)
+		}
+	}
+	return p, nil
+}
+
+// handleReprovisionProgress reports, per gateway, hub and spoke, the config version
+// and root CA it is expected to run against what its heartbeats and last
+// provisioning show, and which retired CAs are still in use.
+func (s *Server) handleReprovisionProgress(c *gin.Context) {
+	if _, ok := s.requireAdmin(c); !ok {
+		return
+	}
+	ctx := c.Request.Context()
+
+	progress, err := s.rolloutProgress(ctx)
+	if err != nil {
+		s.logger.Error("Failed to get reprovision progress", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get reprovision progress"})
+		return
+	}
+	counts, usingCA := progress.counts, progress.usingCA
+
+	cas, err := s.pkiStore.ListCAs(ctx)
+	if err != nil {
+		s.logger.Error("Failed to list CAs", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list CAs"})
+		return
+	}
+	retired := []gin.H{}
+	for _, ca := range cas {
+		if ca.Status != db.CAStatusRetired {
+			continue
+		}
+		// Components in an unknown state may still be using any retired CA
+		retired = append(retired, gin.H{
+			"id":              ca.ID,
+			"fingerprint":     ca.Fingerprint,
+			"componentsUsing": usingCA[ca.Fingerprint],
+			"safeToRevoke":    usingCA[ca.Fingerprint] == 0 && counts[rolloutUnknown] == 0,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"activeCaFingerprint": progress.activeCA,
+		"total":               len(progress.components),
+		"converged":           counts[rolloutConverged],
+		"pending":             counts[rolloutPending],
+		"unknown":             counts[rolloutUnknown],
+		"components":          progress.components,
+		"retiredCas":          retired,
+	})
+}
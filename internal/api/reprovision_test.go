@@ -0,0 +1,133 @@
+package api
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/gatekey-project/gatekey/internal/db"
+)
+
+func TestRolloutState(t *testing.T) {
+	now := time.Now()
+	earlier := now.Add(-time.Hour)
+	reported := func(version, ca string) *db.ProvisioningStatus {
+		return &db.ProvisioningStatus{ReportedConfigVersion: version, ReportedAt: &earlier, ProvisionedCAFingerprint: ca, ProvisionedAt: &earlier}
+	}
+
+	tests := []struct {
+		name            string
+		expectedVersion string
+		status          *db.ProvisioningStatus
+		want            string
+	}{
+		{"never reported", "v1", nil, rolloutUnknown},
+		{"converged", "v1", reported("v1", "ca-new"), rolloutConverged},
+		{"no server version", "", reported("v0", "ca-new"), rolloutConverged},
+		{"version mismatch", "v2", reported("v1", "ca-new"), rolloutPending},
+		{"old CA", "v1", reported("v1", "ca-old"), rolloutPending},
+		{"provisioned before tracking", "v1", reported("v1", ""), rolloutUnknown},
+	}
+	for _, tt := range tests {
+		if got := rolloutState(tt.expectedVersion, "ca-new", tt.status); got != tt.want {
+			t.Errorf("%s: rolloutState() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	// A requested reprovision is pending until the component provisions again
+	requested := reported("v1", "ca-new")
+	requested.ReprovisionRequestedAt = &now
+	if got := rolloutState("v1", "ca-new", requested); got != rolloutPending {
+		t.Errorf("requested reprovision: rolloutState() = %q, want %q", got, rolloutPending)
+	}
+	later := now.Add(time.Minute)
+	requested.ProvisionedAt = &later
+	if got := rolloutState("v1", "ca-new", requested); got != rolloutConverged {
+		t.Errorf("reprovisioned: rolloutState() = %q, want %q", got, rolloutConverged)
+	}
+}
+
+func TestNeedsReprovision(t *testing.T) {
+	base := db.Gateway{TLSMode: db.TLSModeAuth, Compression: "none", CryptoProfile: db.CryptoProfileModern}
+	tests := []struct {
+		name   string
+		change func(gw *db.Gateway)
+		want   string
+	}{
+		{"nothing", func(gw *db.Gateway) { gw.Name = "renamed" }, ""},
+		{"endpoints", func(gw *db.Gateway) {
+			gw.AdditionalEndpoints = []db.ListenEndpoint{{Protocol: "tcp", Port: 443, Subnet: "10.9.0.0/24"}}
+		}, "endpoints"},
+		{"tls mode", func(gw *db.Gateway) { gw.TLSMode = db.TLSModeCrypt }, "tlsmode"},
+		{"crypto profile", func(gw *db.Gateway) { gw.MinCryptoProfile = db.CryptoProfileFIPS }, "crypto"},
+		{"compression", func(gw *db.Gateway) { gw.Compression = "lz4" }, "compression"},
+		{"link tuning", func(gw *db.Gateway) { gw.LinkTuning.TunMTU = 1400 }, "link"},
+		{"several", func(gw *db.Gateway) { gw.TLSMode = db.TLSModeCrypt; gw.Compression = "lz4" }, "tlsmode"},
+	}
+	for _, tt := range tests {
+		updated := base
+		tt.change(&updated)
+		if got := needsReprovision(&base, &updated); got != tt.want {
+			t.Errorf("%s: needsReprovision() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestReprovisionAlertDue(t *testing.T) {
+	alerted := time.Now()
+	tests := []struct {
+		name   string
+		status db.GatewayReprovisionStatus
+		want   bool
+	}{
+		{"below threshold", db.GatewayReprovisionStatus{ConsecutiveSignals: 9}, false},
+		{"at threshold", db.GatewayReprovisionStatus{ConsecutiveSignals: 10}, true},
+		{"past threshold", db.GatewayReprovisionStatus{ConsecutiveSignals: 25}, true},
+		{"already alerted", db.GatewayReprovisionStatus{ConsecutiveSignals: 25, AlertedAt: &alerted}, false},
+	}
+	for _, tt := range tests {
+		if got := reprovisionAlertDue(&tt.status, 10); got != tt.want {
+			t.Errorf("%s: reprovisionAlertDue() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// fakeReprovisionTracker keeps reprovision signal counts in memory.
+type fakeReprovisionTracker struct {
+	signals map[string]int
+}
+
+func (f *fakeReprovisionTracker) RecordReprovisionSignal(_ context.Context, gatewayID string) (*db.GatewayReprovisionStatus, error) {
+	f.signals[gatewayID]++
+	return &db.GatewayReprovisionStatus{GatewayID: gatewayID, ConsecutiveSignals: f.signals[gatewayID]}, nil
+}
+
+func (f *fakeReprovisionTracker) MarkReprovisionAlerted(context.Context, string) error { return nil }
+
+func (f *fakeReprovisionTracker) ClearReprovisionSignals(_ context.Context, gatewayID string) (bool, error) {
+	_, ok := f.signals[gatewayID]
+	delete(f.signals, gatewayID)
+	return ok, nil
+}
+
+// TestTrackReprovisionSignalRevert checks that tracking is cleared when the
+// server's config version goes back to the one a gateway runs, though the
+// gateway keeps reporting the same version.
+func TestTrackReprovisionSignalRevert(t *testing.T) {
+	s := &Server{logger: zap.NewNop()}
+	tracker := &fakeReprovisionTracker{signals: map[string]int{"gw-1": 4}}
+	gateway := &db.Gateway{ID: "gw-1", Name: "gw-1", ConfigVersion: "v1"}
+
+	s.trackReprovisionSignal(context.Background(), tracker, gateway, false)
+	if n, ok := tracker.signals["gw-1"]; ok {
+		t.Errorf("tracking after the version reverted = %d signals, want cleared", n)
+	}
+
+	// Heartbeats from a gateway with nothing tracked stay harmless
+	s.trackReprovisionSignal(context.Background(), tracker, gateway, false)
+	if len(tracker.signals) != 0 {
+		t.Errorf("signals = %v, want none", tracker.signals)
+	}
+}
@@ -0,0 +1,176 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// agentMaxRequestBody caps request bodies from gateway and mesh agents, which
+// report server configs and denied traffic summaries larger than any user or
+// admin request. server.max_request_body applies to everything else.
+const agentMaxRequestBody = 16 << 20
+
+// Paths of the gateway and mesh agent APIs.
+var agentPathPrefixes = []string{
+	"/api/v1/gateway/",
+	"/api/v1/mesh-hub/",
+	"/api/v1/mesh-spoke/",
+	"/api/v1/mesh-gateway/",
+}
+
+// requestBodyLimit caps API request bodies at server.max_request_body, or at
+// agentMaxRequestBody for agents if that's larger.
+func (s *Server) requestBodyLimit() gin.HandlerFunc {
+	limit := s.config.Server.MaxRequestBody
+	agentLimit := max(limit, agentMaxRequestBody)
+	return func(c *gin.Context) {
+		for _, prefix := range agentPathPrefixes {
+			if strings.HasPrefix(c.Request.URL.Path, prefix) {
+				limitRequestBody(c, agentLimit)
+				return
+			}
+		}
+		limitRequestBody(c, limit)
+	}
+}
+
+// limitRequestBody rejects a request body larger than limit bytes with 413.
+// Bodies without a Content-Length are cut off at the limit while they're read,
+// so handlers never buffer more than that.
+func limitRequestBody(c *gin.Context, limit int64) {
+	if c.Request.ContentLength > limit {
+		c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": "request body too large"})
+		return
+	}
+	if c.Request.Body != nil {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+	}
+	c.Next()
+}
+
+var registerJSONFieldNames sync.Once
+
+// bindJSON decodes a JSON request body into obj and validates its binding tags.
+// On failure it responds with 400, or 413 if the body is over the size limit,
+// naming the offending field, and returns false.
+func bindJSON(c *gin.Context, obj any) bool {
+	return decodeJSONBody(c, obj, false)
+}
+
+// bindStrictJSON is bindJSON that also rejects fields obj doesn't have, for
+// requests where a misspelled field would otherwise be silently ignored.
+func bindStrictJSON(c *gin.Context, obj any) bool {
+	return decodeJSONBody(c, obj, true)
+}
+
+func decodeJSONBody(c *gin.Context, obj any, strict bool) bool {
+	registerJSONFieldNames.Do(useJSONFieldNames)
+	err := decodeJSON(c.Request.Body, obj, strict)
+	if err == nil {
+		err = binding.Validator.ValidateStruct(obj)
+	}
+	if err == nil {
+		return true
+	}
+
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": "request body too large"})
+		return false
+	}
+	c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": jsonBodyError(err)})
+	return false
+}
+
+// decodeJSON decodes exactly one JSON value from r into obj.
+func decodeJSON(r io.Reader, obj any, strict bool) error {
+	if r == nil {
+		return io.EOF
+	}
+	dec := json.NewDecoder(r)
+	if strict {
+		dec.DisallowUnknownFields()
+	}
+	if err := dec.Decode(obj); err != nil {
+		return err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return errors.New("unexpected data after JSON body")
+	}
+	return nil
+}
+
+// jsonBodyError describes a decode or validation error by the JSON names of the
+// fields involved.
+func jsonBodyError(err error) string {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var fieldErrs validator.ValidationErrors
+	switch {
+	case errors.Is(err, io.EOF):
+		return "request body is required"
+	case errors.As(err, &syntaxErr), errors.Is(err, io.ErrUnexpectedEOF):
+		return "request body is not valid JSON"
+	case errors.As(err, &typeErr):
+		return fmt.Sprintf("invalid request body: %s must be %s", typeErr.Field, typeErr.Type)
+	case errors.As(err, &fieldErrs):
+		msgs := make([]string, 0, len(fieldErrs))
+		for _, fe := range fieldErrs {
+			msgs = append(msgs, fieldErrorMessage(fe))
+		}
+		return strings.Join(msgs, "; ")
+	}
+	// json reports unknown fields as `json: unknown field "name"`
+	return "invalid request body: " + strings.TrimPrefix(err.Error(), "json: ")
+}
+
+// fieldErrorMessage describes one failed binding tag, e.g. "gateway_id is
+// required" or "dns_servers must have at most 16 items".
+func fieldErrorMessage(fe validator.FieldError) string {
+	name := fe.Field()
+	switch fe.Tag() {
+	case "required":
+		return name + " is required"
+	case "max", "min":
+		bound := "at most"
+		if fe.Tag() == "min" {
+			bound = "at least"
+		}
+		switch fe.Kind() {
+		case reflect.Slice, reflect.Map, reflect.Array:
+			return fmt.Sprintf("%s must have %s %s items", name, bound, fe.Param())
+		case reflect.String:
+			return fmt.Sprintf("%s must be %s %s characters", name, bound, fe.Param())
+		}
+		return fmt.Sprintf("%s must be %s %s", name, bound, fe.Param())
+	case "oneof":
+		return fmt.Sprintf("%s must be one of: %s", name, fe.Param())
+	}
+	return name + " is invalid"
+}
+
+// useJSONFieldNames makes validation errors name fields as they appear in the
+// JSON body rather than by their Go names.
+func useJSONFieldNames() {
+	v, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return
+	}
+	v.RegisterTagNameFunc(func(f reflect.StructField) string {
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			return f.Name
+		}
+		return name
+	})
+}
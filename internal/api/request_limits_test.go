@@ -0,0 +1,85 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/gatekey-project/gatekey/internal/config"
+)
+
+func TestBindJSON(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	s := &Server{config: &config.Config{Server: config.ServerConfig{MaxRequestBody: 64}}}
+
+	type body struct {
+		GatewayID  string   `json:"gateway_id" binding:"required"`
+		DNSServers []string `json:"dns_servers" binding:"max=2"`
+	}
+	router := gin.New()
+	router.Use(s.requestBodyLimit())
+	router.POST("/api/v1/lenient", func(c *gin.Context) {
+		var req body
+		if bindJSON(c, &req) {
+			c.Status(http.StatusNoContent)
+		}
+	})
+	router.POST("/api/v1/strict", func(c *gin.Context) {
+		var req body
+		if bindStrictJSON(c, &req) {
+			c.Status(http.StatusNoContent)
+		}
+	})
+	router.POST("/api/v1/gateway/report", func(c *gin.Context) {
+		var req map[string]string
+		if bindJSON(c, &req) {
+			c.Status(http.StatusNoContent)
+		}
+	})
+
+	tests := []struct {
+		name, path, body string
+		status           int
+		wantErr          string
+	}{
+		{"valid", "/api/v1/lenient", `{"gateway_id": "gw", "extra": 1}`, http.StatusNoContent, ""},
+		{"missing field", "/api/v1/lenient", `{"dns_servers": []}`, http.StatusBadRequest, "gateway_id is required"},
+		{"too many items", "/api/v1/lenient", `{"gateway_id": "gw", "dns_servers": ["a", "b", "c"]}`, http.StatusBadRequest, "dns_servers must have at most 2 items"},
+		{"wrong type", "/api/v1/lenient", `{"gateway_id": 1}`, http.StatusBadRequest, "invalid request body: gateway_id must be string"},
+		{"malformed", "/api/v1/lenient", `{"gateway_id": `, http.StatusBadRequest, "request body is not valid JSON"},
+		{"empty", "/api/v1/lenient", ``, http.StatusBadRequest, "request body is required"},
+		{"trailing data", "/api/v1/lenient", `{"gateway_id": "gw"} {}`, http.StatusBadRequest, "invalid request body: unexpected data after JSON body"},
+		{"unknown field", "/api/v1/strict", `{"gateway_id": "gw", "extra": 1}`, http.StatusBadRequest, `invalid request body: unknown field "extra"`},
+		{"too large", "/api/v1/lenient", `{"gateway_id": "` + strings.Repeat("a", 100) + `"}`, http.StatusRequestEntityTooLarge, "request body too large"},
+		{"agent limit", "/api/v1/gateway/report", `{"config": "` + strings.Repeat("a", 100) + `"}`, http.StatusNoContent, ""},
+	}
+	for _, tt := range tests {
+		for _, chunked := range []bool{false, true} {
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+			if chunked {
+				// Unknown length, so the body is only cut off while it's read
+				req.ContentLength = -1
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Errorf("%s (chunked=%v): status = %d, want %d (%s)", tt.name, chunked, w.Code, tt.status, w.Body.String())
+				continue
+			}
+			if tt.wantErr != "" {
+				var resp struct {
+					Error string `json:"error"`
+				}
+				_ = json.Unmarshal(w.Body.Bytes(), &resp)
+				if resp.Error != tt.wantErr {
+					t.Errorf("%s (chunked=%v): error = %q, want %q", tt.name, chunked, resp.Error, tt.wantErr)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package api
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/gatekey-project/gatekey/internal/db"
+)
+
+// noteRevocation bumps the revocation epoch sent in gateway heartbeats. Gateways
+// that cache successful verify results drop them when the epoch changes, so a
+// revoked config can't reconnect from the cache.
+func (s *Server) noteRevocation(ctx context.Context) {
+	epoch := strconv.FormatInt(time.Now().UnixNano(), 10)
+	if err := s.settingsStore.Set(ctx, db.SettingRevocationEpoch, epoch); err != nil {
+		s.logger.Error("Failed to update revocation epoch", zap.Error(err))
+	}
+}
+
+// revocationEpoch returns the current revocation epoch, or "" if nothing has been
+// revoked yet.
+func (s *Server) revocationEpoch(ctx context.Context) string {
+	setting, err := s.settingsStore.Get(ctx, db.SettingRevocationEpoch)
+	if err != nil {
+		return ""
+	}
+	return setting.Value
+}
@@ -16,10 +16,11 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"reflect"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
+	"unicode/utf8"
 
 	"github.com/coreos/go-oidc/v3/oidc"
 	"github.com/crewjam/saml"
@@ -29,15 +30,13 @@ import (
 	"go.uber.org/zap"
 	"golang.org/x/oauth2"
 
+	authoidc "github.com/gatekey-project/gatekey/internal/auth/oidc"
 	"github.com/gatekey-project/gatekey/internal/db"
 	"github.com/gatekey-project/gatekey/internal/models"
 	"github.com/gatekey-project/gatekey/internal/openvpn"
 	"github.com/gatekey-project/gatekey/internal/pki"
 )
 
-// cliCallbackStore stores CLI callback URLs by state
-var cliCallbackStore sync.Map
-
 // cidrToRoute converts a CIDR notation (e.g., "192.168.50.0/23") to OpenVPN route format (e.g., "route 192.168.50.0 255.255.254.0")
 func cidrToRoute(cidr string) string {
 	_, ipNet, err := net.ParseCIDR(cidr)
@@ -53,6 +52,24 @@ func cidrToRoute(cidr string) string {
 	return ""
 }
 
+// gatewayDenial is the response body for a denied gateway verify. The reason is
+// for people; reason_code is stable for the agent and client to act on.
+func gatewayDenial(code, reason string) gin.H {
+	return gin.H{
+		"allowed":     false,
+		"reason":      reason,
+		"reason_code": code,
+	}
+}
+
+// gatewayConnectDenial is the response body for a denied gateway connect, which
+// also keeps the error field older agents expect.
+func gatewayConnectDenial(code, reason string) gin.H {
+	resp := gatewayDenial(code, reason)
+	resp["error"] = reason
+	return resp
+}
+
 // Authentication handlers
 
 func (s *Server) handleOIDCLogin(c *gin.Context) {
@@ -100,7 +117,7 @@ func (s *Server) handleOIDCLogin(c *gin.Context) {
 	oauth2Config := &oauth2.Config{
 		ClientID:     strings.TrimSpace(providerConfig.ClientID),
 		ClientSecret: strings.TrimSpace(providerConfig.ClientSecret),
-		RedirectURL:  strings.TrimSpace(providerConfig.RedirectURL),
+		RedirectURL:  s.oidcRedirectURL(c, providerConfig),
 		Endpoint:     oidcProvider.Endpoint(),
 		Scopes:       scopes,
 	}
@@ -120,6 +137,10 @@ func (s *Server) handleOIDCLogin(c *gin.Context) {
 		return
 	}
 
+	// PKCE binds the authorization code to this login, so an intercepted code
+	// can't be redeemed without the verifier stored with the state
+	codeVerifier := oauth2.GenerateVerifier()
+
 	// Check for CLI state (to redirect back to CLI after auth)
 	cliState := c.Query("cli_state")
 	var cliCallbackURL string
@@ -143,6 +164,7 @@ func (s *Server) handleOIDCLogin(c *gin.Context) {
 		Nonce:          nonce,
 		RelayState:     cliState,
 		CLICallbackURL: cliCallbackURL, // Store CLI callback URL for redirect after auth
+		CodeVerifier:   codeVerifier,
 		ExpiresAt:      time.Now().Add(10 * time.Minute),
 	}
 	if err := s.stateStore.SaveState(c.Request.Context(), oauthState); err != nil {
@@ -152,7 +174,7 @@ func (s *Server) handleOIDCLogin(c *gin.Context) {
 	}
 
 	// Redirect to authorization URL
-	authURL := oauth2Config.AuthCodeURL(state, oidc.Nonce(nonce))
+	authURL := oauth2Config.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(codeVerifier))
 	c.Redirect(http.StatusFound, authURL)
 }
 
@@ -174,7 +196,7 @@ func (s *Server) handleOIDCCallback(c *gin.Context) {
 	}
 
 	// Validate and retrieve state data from database
-	stateData, err := s.stateStore.GetState(c.Request.Context(), state)
+	stateData, err := s.stateStore.GetState(c.Request.Context(), state, "oidc")
 	if err != nil {
 		s.logger.Error("Invalid or expired state", zap.Error(err))
 		c.Redirect(http.StatusFound, "/login?error=invalid_state")
@@ -208,13 +230,18 @@ func (s *Server) handleOIDCCallback(c *gin.Context) {
 	oauth2Config := &oauth2.Config{
 		ClientID:     strings.TrimSpace(providerConfig.ClientID),
 		ClientSecret: strings.TrimSpace(providerConfig.ClientSecret),
-		RedirectURL:  strings.TrimSpace(providerConfig.RedirectURL),
+		RedirectURL:  s.oidcRedirectURL(c, providerConfig),
 		Endpoint:     oidcProvider.Endpoint(),
 		Scopes:       scopes,
 	}
 
-	// Exchange code for token
-	oauth2Token, err := oauth2Config.Exchange(ctx, code)
+	// Exchange code for token, with the PKCE verifier unless the login started
+	// before PKCE was added
+	var exchangeOpts []oauth2.AuthCodeOption
+	if stateData.CodeVerifier != "" {
+		exchangeOpts = append(exchangeOpts, oauth2.VerifierOption(stateData.CodeVerifier))
+	}
+	oauth2Token, err := oauth2Config.Exchange(ctx, code, exchangeOpts...)
 	if err != nil {
 		s.logger.Error("Failed to exchange code for token", zap.Error(err))
 		c.Redirect(http.StatusFound, "/login?error=token_exchange_failed")
@@ -230,7 +257,7 @@ func (s *Server) handleOIDCCallback(c *gin.Context) {
 	}
 
 	// Verify ID token
-	verifier := oidcProvider.Verifier(&oidc.Config{ClientID: providerConfig.ClientID})
+	verifier := authoidc.NewAudienceVerifier(oidcProvider, providerConfig.ClientID, providerConfig.AdditionalAudiences)
 	idToken, err := verifier.Verify(ctx, rawIDToken)
 	if err != nil {
 		s.logger.Error("Failed to verify ID token", zap.Error(err))
@@ -259,6 +286,22 @@ func (s *Server) handleOIDCCallback(c *gin.Context) {
 		return
 	}
 
+	// Resolve the VPN common name from the provider's configured source
+	var rawClaims map[string]interface{}
+	if err := idToken.Claims(&rawClaims); err != nil {
+		s.logger.Error("Failed to parse claims", zap.Error(err))
+		c.Redirect(http.StatusFound, "/login?error=claims_error")
+		return
+	}
+	commonName, err := authoidc.CommonName(providerConfig.CNSource, idToken.Subject, rawClaims)
+	if err != nil {
+		s.logger.Error("Failed to resolve VPN common name",
+			zap.String("provider", stateData.Provider),
+			zap.Error(err))
+		c.Redirect(http.StatusFound, "/login?error=claims_error")
+		return
+	}
+
 	// Use preferred_username or email as identifier
 	username := claims.PreferredUser
 	if username == "" {
@@ -300,10 +343,24 @@ func (s *Server) handleOIDCCallback(c *gin.Context) {
 	// For now, we'll store it in admin_sessions with a synthetic user_id
 	// A better approach would be to have a separate sso_sessions table
 	if err := s.createSSOSession(c.Request.Context(), userID, token, expiresAt, ipAddress, userAgent, username, email, name, claims.Groups); err != nil {
+		if err == errUserDeactivated {
+			s.logUserLogin(c, userID, email, name, "oidc", stateData.Provider, ipAddress, userAgent, "", false, "user deactivated")
+			c.Redirect(http.StatusFound, "/login?error=account_deactivated")
+			return
+		}
 		s.logger.Error("Failed to create session", zap.Error(err))
 		c.Redirect(http.StatusFound, "/login?error=session_error")
 		return
 	}
+	if err := s.userStore.SetSSOUserCommonName(c.Request.Context(), stateData.Provider, idToken.Subject, commonName); err != nil {
+		s.logger.Error("Failed to store VPN common name",
+			zap.String("provider", stateData.Provider),
+			zap.String("email", email),
+			zap.Error(err))
+		_ = s.stateStore.DeleteSSOSession(c.Request.Context(), token)
+		c.Redirect(http.StatusFound, "/login?error=session_error")
+		return
+	}
 
 	// Set session cookie
 	c.SetCookie(
@@ -323,22 +380,20 @@ func (s *Server) handleOIDCCallback(c *gin.Context) {
 	)
 
 	// Log the successful login
-	s.logUserLogin(c.Request.Context(), userID, email, name, "oidc", stateData.Provider, ipAddress, userAgent, token, true, "")
+	s.logUserLogin(c, userID, email, name, "oidc", stateData.Provider, ipAddress, userAgent, token, true, "")
 
 	// Check if this is a CLI login flow
-	if stateData.CLICallbackURL != "" {
+	if stateData.CLICallbackURL != "" && validateCLICallback(stateData.CLICallbackURL, s.config.Auth.CLICallbackHosts) == nil {
 		s.logger.Info("OIDC callback with CLI callback URL", zap.String("callback_url", stateData.CLICallbackURL))
-		// Redirect to CLI callback with token
-		redirectURL := stateData.CLICallbackURL + "?token=" + token + "&email=" + url.QueryEscape(email) + "&name=" + url.QueryEscape(name) + "&expires_in=86400"
-		s.logger.Info("Redirecting to CLI", zap.String("redirect_url", redirectURL))
-		c.Redirect(http.StatusFound, redirectURL)
+		s.logger.Info("Redirecting to CLI", zap.String("callback_url", stateData.CLICallbackURL))
+		s.redirectToCLI(c, stateData.CLICallbackURL, token)
 		return
 	} else {
 		s.logger.Info("OIDC callback without CLI callback URL (normal web login)")
 	}
 
 	// Redirect to dashboard for normal web login
-	c.Redirect(http.StatusFound, "/")
+	c.Redirect(http.StatusFound, s.postLoginRedirect())
 }
 
 func (s *Server) handleSAMLLogin(c *gin.Context) {
@@ -376,22 +431,14 @@ func (s *Server) handleSAMLLogin(c *gin.Context) {
 		return
 	}
 
-	// Parse ACS URL
-	acsURL, err := url.Parse(providerConfig.ACSURL)
+	// Create the SP; it signs the AuthnRequest when the provider requires it
+	sp, err := s.samlServiceProvider(c.Request.Context(), providerConfig, idpMetadata)
 	if err != nil {
-		s.logger.Error("Invalid ACS URL", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "invalid ACS URL"})
+		s.logger.Error("Failed to set up SAML service provider", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to set up SAML service provider"})
 		return
 	}
 
-	// Create a minimal SP (we don't need signing for the AuthnRequest in most cases)
-	sp := &saml.ServiceProvider{
-		EntityID:          providerConfig.EntityID,
-		AcsURL:            *acsURL,
-		IDPMetadata:       idpMetadata,
-		AllowIDPInitiated: true,
-	}
-
 	// Generate a relay state for CSRF protection
 	relayState, err := generateState()
 	if err != nil {
@@ -400,11 +447,25 @@ func (s *Server) handleSAMLLogin(c *gin.Context) {
 		return
 	}
 
-	// Store state data in database for validation (expires in 10 minutes)
+	// Create AuthnRequest
+	authnRequest, err := sp.MakeAuthenticationRequest(
+		sp.GetSSOBindingLocation(saml.HTTPRedirectBinding),
+		saml.HTTPRedirectBinding,
+		saml.HTTPPostBinding,
+	)
+	if err != nil {
+		s.logger.Error("Failed to create SAML AuthnRequest", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create authentication request"})
+		return
+	}
+
+	// Store state data in database for validation (expires in 10 minutes). The
+	// request ID binds the IdP's response to this login.
 	oauthState := &db.OAuthState{
 		State:        relayState,
 		Provider:     providerName,
 		ProviderType: "saml",
+		Nonce:        authnRequest.ID,
 		RelayState:   relayState,
 		ExpiresAt:    time.Now().Add(10 * time.Minute),
 	}
@@ -414,18 +475,6 @@ func (s *Server) handleSAMLLogin(c *gin.Context) {
 		return
 	}
 
-	// Create AuthnRequest
-	authnRequest, err := sp.MakeAuthenticationRequest(
-		sp.GetSSOBindingLocation(saml.HTTPRedirectBinding),
-		saml.HTTPRedirectBinding,
-		saml.HTTPPostBinding,
-	)
-	if err != nil {
-		s.logger.Error("Failed to create SAML AuthnRequest", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create authentication request"})
-		return
-	}
-
 	// Get redirect URL
 	redirectURL, err := authnRequest.Redirect(relayState, sp)
 	if err != nil {
@@ -444,21 +493,33 @@ func (s *Server) handleSAMLACS(c *gin.Context) {
 		relayState = c.Query("RelayState")
 	}
 
-	// Validate relay state from database
-	stateData, err := s.stateStore.GetState(c.Request.Context(), relayState)
-	if err != nil {
+	// Validate relay state from database. Without a stored state, the login is
+	// IdP-initiated, which the provider must allow.
+	stateData, err := s.stateStore.GetState(c.Request.Context(), relayState, "saml")
+	if err != nil && err != db.ErrSessionNotFound {
 		s.logger.Error("Invalid or expired relay state", zap.Error(err))
 		c.Redirect(http.StatusFound, "/login?error=invalid_state")
 		return
 	}
+	providerName, requestIDs := samlLogin(stateData, relayState)
 
 	// Get provider config from database
-	providerConfig, err := s.providerStore.GetSAMLProvider(c.Request.Context(), stateData.Provider)
+	providerConfig, err := s.providerStore.GetSAMLProvider(c.Request.Context(), providerName)
+	if err != nil && stateData == nil {
+		s.logger.Error("Unknown relay state", zap.Error(err))
+		c.Redirect(http.StatusFound, "/login?error=invalid_state")
+		return
+	}
 	if err != nil {
 		s.logger.Error("Failed to get SAML provider", zap.Error(err))
 		c.Redirect(http.StatusFound, "/login?error=provider_not_found")
 		return
 	}
+	if stateData == nil && !providerConfig.AllowIDPInitiated {
+		s.logger.Error("IdP-initiated SAML login not allowed", zap.String("provider", providerName))
+		c.Redirect(http.StatusFound, "/login?error=invalid_state")
+		return
+	}
 
 	// Fetch IdP metadata
 	idpMetadataURL, err := url.Parse(providerConfig.IDPMetadataURL)
@@ -475,22 +536,17 @@ func (s *Server) handleSAMLACS(c *gin.Context) {
 		return
 	}
 
-	// Parse ACS URL
-	acsURL, err := url.Parse(providerConfig.ACSURL)
+	// Create SP, with its key to decrypt encrypted assertions. Unless the provider
+	// allows IdP-initiated logins, the response must answer the stored login's
+	// AuthnRequest, so a captured assertion can't be replayed with a fresh relay
+	// state.
+	sp, err := s.samlServiceProvider(c.Request.Context(), providerConfig, idpMetadata)
 	if err != nil {
-		s.logger.Error("Invalid ACS URL", zap.Error(err))
+		s.logger.Error("Failed to set up SAML service provider", zap.Error(err))
 		c.Redirect(http.StatusFound, "/login?error=config_error")
 		return
 	}
 
-	// Create SP
-	sp := &saml.ServiceProvider{
-		EntityID:          providerConfig.EntityID,
-		AcsURL:            *acsURL,
-		IDPMetadata:       idpMetadata,
-		AllowIDPInitiated: true,
-	}
-
 	// Get SAML response
 	samlResponse := c.PostForm("SAMLResponse")
 	if samlResponse == "" {
@@ -500,7 +556,7 @@ func (s *Server) handleSAMLACS(c *gin.Context) {
 	}
 
 	// Parse and validate the assertion
-	assertion, err := sp.ParseResponse(c.Request, []string{})
+	assertion, err := sp.ParseResponse(c.Request, requestIDs)
 	if err != nil {
 		s.logger.Error("Failed to parse SAML response", zap.Error(err))
 		c.Redirect(http.StatusFound, "/login?error=invalid_response")
@@ -563,7 +619,7 @@ func (s *Server) handleSAMLACS(c *gin.Context) {
 	}
 
 	if email == "" {
-		email = username + "@" + stateData.Provider
+		email = username + "@" + providerName
 	}
 
 	if name == "" {
@@ -580,12 +636,17 @@ func (s *Server) handleSAMLACS(c *gin.Context) {
 	token := base64.URLEncoding.EncodeToString(tokenBytes)
 
 	// Create session
-	userID := "saml:" + stateData.Provider + ":" + nameID
+	userID := "saml:" + providerName + ":" + nameID
 	expiresAt := time.Now().Add(s.config.Auth.Session.Validity)
 	ipAddress := getRealClientIP(c)
 	userAgent := c.GetHeader("User-Agent")
 
 	if err := s.createSSOSession(c.Request.Context(), userID, token, expiresAt, ipAddress, userAgent, username, email, name, groups); err != nil {
+		if err == errUserDeactivated {
+			s.logUserLogin(c, userID, email, name, "saml", providerName, ipAddress, userAgent, "", false, "user deactivated")
+			c.Redirect(http.StatusFound, "/login?error=account_deactivated")
+			return
+		}
 		s.logger.Error("Failed to create session", zap.Error(err))
 		c.Redirect(http.StatusFound, "/login?error=session_error")
 		return
@@ -603,16 +664,16 @@ func (s *Server) handleSAMLACS(c *gin.Context) {
 	)
 
 	s.logger.Info("SAML login successful",
-		zap.String("provider", stateData.Provider),
+		zap.String("provider", providerName),
 		zap.String("user", username),
 		zap.String("email", email),
 	)
 
 	// Log the successful login
-	s.logUserLogin(c.Request.Context(), userID, email, name, "saml", stateData.Provider, ipAddress, userAgent, token, true, "")
+	s.logUserLogin(c, userID, email, name, "saml", providerName, ipAddress, userAgent, token, true, "")
 
 	// Redirect to dashboard
-	c.Redirect(http.StatusFound, "/")
+	c.Redirect(http.StatusFound, s.postLoginRedirect())
 }
 
 func (s *Server) handleSAMLMetadata(c *gin.Context) {
@@ -630,21 +691,15 @@ func (s *Server) handleSAMLMetadata(c *gin.Context) {
 		return
 	}
 
-	// Parse ACS URL
-	acsURL, err := url.Parse(providerConfig.ACSURL)
+	// Create SP metadata with its certificate and NameID formats
+	sp, err := s.samlServiceProvider(c.Request.Context(), providerConfig, nil)
 	if err != nil {
-		s.logger.Error("Invalid ACS URL", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "invalid ACS URL"})
+		s.logger.Error("Failed to set up SAML service provider", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate metadata"})
 		return
 	}
 
-	// Create SP metadata
-	sp := &saml.ServiceProvider{
-		EntityID: providerConfig.EntityID,
-		AcsURL:   *acsURL,
-	}
-
-	metadata := sp.Metadata()
+	metadata := samlSPMetadata(sp)
 
 	// Return metadata as XML
 	c.Header("Content-Type", "application/samlmetadata+xml")
@@ -723,7 +778,7 @@ func (s *Server) handleGetSession(c *gin.Context) {
 	}
 
 	// Fall back to local user session from database
-	_, user, err := s.userStore.GetSession(c.Request.Context(), token)
+	user, err := s.getLocalSession(c.Request.Context(), token)
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{"user": nil, "authenticated": false})
 		return
@@ -757,6 +812,13 @@ func (s *Server) createSSOSession(ctx context.Context, userID, token string, exp
 		externalID = parts[2]
 	}
 
+	// Don't let an IdP that suddenly reports no groups wipe the user's access
+	var groupCheck ssoGroupCheck
+	if externalID != "" && providerName != "" {
+		groupCheck = s.checkSSOGroups(ctx, providerName, externalID, email, groups)
+		groups = groupCheck.groups
+	}
+
 	// Check if user should be admin based on provider's admin_group setting
 	isAdmin := false
 	s.logger.Info("Checking admin status for SSO user",
@@ -827,18 +889,41 @@ func (s *Server) createSSOSession(ctx context.Context, userID, token string, exp
 					zap.Strings("userGroups", groups))
 			}
 		}
+	} else if providerType == "ldap" && providerName != "" {
+		ldapProvider, err := s.providerStore.GetLDAPProvider(ctx, providerName)
+		if err != nil {
+			s.logger.Warn("Failed to get LDAP provider for admin check",
+				zap.String("provider", providerName),
+				zap.Error(err))
+		} else if ldapProvider.AdminGroup != "" {
+			for _, group := range groups {
+				if group == ldapProvider.AdminGroup {
+					isAdmin = true
+					s.logger.Info("User granted admin via LDAP group membership",
+						zap.String("email", email),
+						zap.String("group", ldapProvider.AdminGroup))
+					break
+				}
+			}
+		}
 	}
 
 	// Persist the user to the database (upsert on each login)
 	// Use the actual database UUID as the session UserID for consistent access checks
 	actualUserID := userID // fallback to compound ID
 	if externalID != "" && providerName != "" {
-		ssoUser, err := s.userStore.UpsertSSOUser(ctx, externalID, providerName, email, name, groups, isAdmin)
+		ssoUser, err := s.userStore.UpsertSSOUser(ctx, externalID, providerType, providerName, email, name, groups, isAdmin)
 		if err != nil {
 			s.logger.Warn("Failed to persist SSO user", zap.Error(err), zap.String("email", email))
 			// Continue anyway - session can still be created
 		} else if ssoUser != nil {
+			if !ssoUser.IsActive {
+				if err := s.reactivateOnLogin(ctx, ssoUser); err != nil {
+					return err
+				}
+			}
 			actualUserID = ssoUser.ID // Use the database UUID
+			s.recordSSOGroups(ctx, ssoUser.ID, groupCheck)
 		}
 	}
 
@@ -882,8 +967,19 @@ func (s *Server) handleGetProviders(c *gin.Context) {
 	// Return list of available auth providers
 	providers := []gin.H{}
 
+	// With multi-tenancy, a tenant's login page lists only its own providers
+	ctx := c.Request.Context()
+	if slug := c.Query("tenant"); slug != "" && s.config.Tenancy.Enabled {
+		tenant, err := s.tenantStore.GetTenant(ctx, slug)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "tenant not found"})
+			return
+		}
+		ctx = db.WithTenant(ctx, tenant.ID)
+	}
+
 	// Only include dynamically configured OIDC providers from database
-	oidcProviders, _ := s.providerStore.GetOIDCProviders(c.Request.Context())
+	oidcProviders, _ := s.providerStore.GetOIDCProviders(ctx)
 	for _, p := range oidcProviders {
 		if p.Enabled {
 			providers = append(providers, gin.H{
@@ -896,7 +992,7 @@ func (s *Server) handleGetProviders(c *gin.Context) {
 	}
 
 	// Only include dynamically configured SAML providers from database
-	samlProviders, _ := s.providerStore.GetSAMLProviders(c.Request.Context())
+	samlProviders, _ := s.providerStore.GetSAMLProviders(ctx)
 	for _, p := range samlProviders {
 		if p.Enabled {
 			providers = append(providers, gin.H{
@@ -908,13 +1004,37 @@ func (s *Server) handleGetProviders(c *gin.Context) {
 		}
 	}
 
-	// Always include local auth for admin access
-	providers = append(providers, gin.H{
-		"type":         "local",
-		"name":         "local",
-		"display_name": "Local Admin",
-		"login_url":    "/api/v1/auth/local/login",
-	})
+	ldapProviders, _ := s.providerStore.GetLDAPProviders(ctx)
+	for _, p := range ldapProviders {
+		if p.Enabled {
+			providers = append(providers, gin.H{
+				"type":         "ldap",
+				"name":         p.Name,
+				"display_name": p.DisplayName,
+				"login_url":    "/api/v1/auth/ldap/login",
+			})
+		}
+	}
+
+	// Local auth is listed unless the deployment is SSO-only; break-glass users
+	// can still log in at its URL
+	localAuth := s.localAuthEnabled(ctx)
+	if localAuth {
+		providers = append(providers, gin.H{
+			"type":         "local",
+			"name":         "local",
+			"display_name": "Local Admin",
+			"login_url":    "/api/v1/auth/local/login",
+		})
+	}
+	if s.config.Auth.MagicLink.Enabled && localAuth {
+		providers = append(providers, gin.H{
+			"type":         "magic-link",
+			"name":         "magic-link",
+			"display_name": "Email Link",
+			"login_url":    "/api/v1/auth/magic/request",
+		})
+	}
 
 	c.JSON(http.StatusOK, gin.H{"providers": providers})
 }
@@ -926,18 +1046,28 @@ func (s *Server) handleLocalLogin(c *gin.Context) {
 		Username string `json:"username" binding:"required"`
 		Password string `json:"password" binding:"required"`
 	}
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "username and password required"})
+	if !bindJSON(c, &req) {
 		return
 	}
 
 	ipAddress := getRealClientIP(c)
 	userAgent := c.GetHeader("User-Agent")
 
+	if !s.localLoginAllowed(c.Request.Context(), req.Username) {
+		s.logUserLogin(c, "", req.Username, "", "local", "", ipAddress, userAgent, "", false, "local login disabled")
+		c.JSON(http.StatusForbidden, gin.H{"error": errLocalAuthDisabled.Error()})
+		return
+	}
+
 	user, err := s.userStore.Authenticate(c.Request.Context(), req.Username, req.Password)
+	if err == db.ErrUserDeactivated {
+		s.logUserLogin(c, "", req.Username, "", "local", "", ipAddress, userAgent, "", false, "user deactivated")
+		c.JSON(http.StatusForbidden, gin.H{"error": errUserDeactivated.Error()})
+		return
+	}
 	if err != nil {
 		// Log failed login attempt
-		s.logUserLogin(c.Request.Context(), "", req.Username, "", "local", "", ipAddress, userAgent, "", false, "invalid credentials")
+		s.logUserLogin(c, "", req.Username, "", "local", "", ipAddress, userAgent, "", false, "invalid credentials")
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
 		return
 	}
@@ -970,7 +1100,7 @@ func (s *Server) handleLocalLogin(c *gin.Context) {
 	)
 
 	// Log successful login
-	s.logUserLogin(c.Request.Context(), user.ID, user.Email, user.Username, "local", "", ipAddress, userAgent, token, true, "")
+	s.logUserLogin(c, user.ID, user.Email, user.Username, "local", "", ipAddress, userAgent, token, true, "")
 
 	c.JSON(http.StatusOK, gin.H{
 		"user": gin.H{
@@ -988,8 +1118,12 @@ func (s *Server) handleChangePassword(c *gin.Context) {
 		CurrentPassword string `json:"current_password" binding:"required"`
 		NewPassword     string `json:"new_password" binding:"required"`
 	}
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	if !s.localLoginAllowed(c.Request.Context(), req.Username) {
+		c.JSON(http.StatusForbidden, gin.H{"error": errLocalAuthDisabled.Error()})
 		return
 	}
 
@@ -1017,6 +1151,11 @@ func (s *Server) handleCLILogin(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "callback parameter required"})
 		return
 	}
+	if err := validateCLICallback(callbackURL, s.config.Auth.CLICallbackHosts); err != nil {
+		s.logger.Warn("Rejected CLI login callback", zap.String("callback", callbackURL))
+		c.JSON(http.StatusBadRequest, gin.H{"error": "callback must be a loopback URL such as http://127.0.0.1:<port>/callback"})
+		return
+	}
 
 	// Store the CLI callback URL in a session/state
 	state, err := generateState()
@@ -1070,6 +1209,11 @@ func (s *Server) handleCLIComplete(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired state"})
 		return
 	}
+	if err := validateCLICallback(callbackURL, s.config.Auth.CLICallbackHosts); err != nil {
+		s.logger.Warn("CLI complete: callback URL not allowed", zap.String("callback_url", callbackURL))
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired state"})
+		return
+	}
 
 	s.logger.Info("CLI complete: redirecting with existing session",
 		zap.String("state", state),
@@ -1077,59 +1221,74 @@ func (s *Server) handleCLIComplete(c *gin.Context) {
 		zap.Bool("is_admin", session.IsAdmin),
 		zap.String("callback_url", callbackURL))
 
-	// Redirect to CLI callback with token (include is_admin flag)
-	redirectURL := callbackURL + "?token=" + session.Token + "&email=" + url.QueryEscape(session.Email) + "&name=" + url.QueryEscape(session.Name) + "&expires_in=86400"
-	if session.IsAdmin {
-		redirectURL += "&is_admin=true"
-	}
-	c.Redirect(http.StatusFound, redirectURL)
+	s.redirectToCLI(c, callbackURL, session.Token)
 }
 
+// handleCLICallback completes CLI login for a logged-in browser by giving the
+// CLI a session of its own, so logging out in the browser doesn't log the CLI
+// out too. The state is looked up in the database, so it works whichever
+// replica the browser lands on, and can only be used once.
 func (s *Server) handleCLICallback(c *gin.Context) {
 	state := c.Query("state")
 	if state == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "state parameter required"})
 		return
 	}
+	ctx := c.Request.Context()
 
-	// Retrieve the CLI callback URL
-	callbackURLInterface, ok := cliCallbackStore.Load(state)
-	if !ok {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired state"})
+	// Check the session before using up the state, so the user can log in and retry
+	cookie, err := c.Cookie(s.config.Auth.Session.CookieName)
+	if err != nil || cookie == "" {
+		c.Redirect(http.StatusFound, "/login?cli=true&state="+url.QueryEscape(state)+"&error=not_logged_in")
+		return
+	}
+	session, err := s.stateStore.GetSSOSession(ctx, cookie)
+	if err != nil {
+		c.Redirect(http.StatusFound, "/login?cli=true&state="+url.QueryEscape(state)+"&error=session_expired")
 		return
 	}
-	callbackURL := callbackURLInterface.(string)
-	cliCallbackStore.Delete(state) // Clean up
-
-	// Get user info from session (set by OIDC/SAML callback)
-	userEmail, _ := c.Get("user_email")
-	userName, _ := c.Get("user_name")
-	token, _ := c.Get("access_token")
 
-	if token == nil || token == "" {
-		// Generate a new token for the CLI
-		token = "cli-token-placeholder" // TODO: Generate proper JWT
+	callbackURL, err := s.stateStore.GetCLICallback(ctx, state)
+	if err != nil {
+		if err != db.ErrSessionNotFound && err != db.ErrSessionExpired {
+			s.logger.Error("Failed to get CLI callback", zap.Error(err))
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired state"})
+		return
+	}
+	if err := validateCLICallback(callbackURL, s.config.Auth.CLICallbackHosts); err != nil {
+		s.logger.Warn("CLI callback: callback URL not allowed", zap.String("callback_url", callbackURL))
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired state"})
+		return
 	}
 
-	// Build callback URL with token
-	redirectURL := callbackURL + "?token=" + token.(string)
-	if userEmail != nil {
-		redirectURL += "&email=" + userEmail.(string)
+	// The CLI's session ends when the browser session it came from would
+	tokenBytes := make([]byte, 32)
+	if _, err := cryptoRand.Read(tokenBytes); err != nil {
+		s.logger.Error("Failed to generate session token", zap.Error(err))
+		c.Redirect(http.StatusFound, callbackURL+"?error=server_error&error_description="+url.QueryEscape("failed to complete login"))
+		return
 	}
-	if userName != nil {
-		redirectURL += "&name=" + userName.(string)
+	cliSession := *session
+	cliSession.Token = base64.URLEncoding.EncodeToString(tokenBytes)
+	if err := s.stateStore.SaveSSOSession(ctx, &cliSession); err != nil {
+		s.logger.Error("Failed to create CLI session", zap.Error(err))
+		c.Redirect(http.StatusFound, callbackURL+"?error=server_error&error_description="+url.QueryEscape("failed to complete login"))
+		return
 	}
-	redirectURL += "&expires_in=86400" // 24 hours
 
-	c.Redirect(http.StatusFound, redirectURL)
+	s.logger.Info("CLI callback: created CLI session",
+		zap.String("state", state),
+		zap.String("email", session.Email))
+
+	s.redirectToCLI(c, callbackURL, cliSession.Token)
 }
 
 func (s *Server) handleTokenRefresh(c *gin.Context) {
 	var req struct {
 		RefreshToken string `json:"refresh_token"`
 	}
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+	if !bindJSON(c, &req) {
 		return
 	}
 
@@ -1165,12 +1324,21 @@ func (s *Server) handleGenerateConfig(c *gin.Context) {
 	// Parse request
 	var req struct {
 		GatewayID      string `json:"gateway_id" binding:"required"`
-		CLICallbackURL string `json:"cli_callback_url"` // Optional: for CLI auto-download
+		CLICallbackURL string `json:"cli_callback_url"`              // Optional: for CLI auto-download
+		TunnelMode     string `json:"tunnel_mode"`                   // Optional: full or split, if the gateway allows choosing
+		DeviceName     string `json:"device_name" binding:"max=255"` // Optional labels so admins can tell configs apart
+		DeviceOS       string `json:"device_os" binding:"max=100"`
+		Purpose        string `json:"purpose" binding:"max=255"`
 	}
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "gateway_id is required"})
+	if !bindJSON(c, &req) {
 		return
 	}
+	if req.CLICallbackURL != "" {
+		if err := validateCLICallback(req.CLICallbackURL, s.config.Auth.CLICallbackHosts); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "cli_callback_url must be a loopback URL such as http://127.0.0.1:<port>/callback"})
+			return
+		}
+	}
 
 	// Get gateway info
 	ctx := c.Request.Context()
@@ -1186,6 +1354,12 @@ func (s *Server) handleGenerateConfig(c *gin.Context) {
 		return
 	}
 
+	tunnelMode, err := chooseTunnelMode(gateway, req.TunnelMode)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	// Check if user has access to this gateway (user must be assigned directly or via group)
 	hasAccess, err := s.gatewayStore.UserHasGatewayAccess(ctx, user.UserID, gateway.ID, user.Groups)
 	if err != nil {
@@ -1198,14 +1372,41 @@ func (s *Server) handleGenerateConfig(c *gin.Context) {
 		return
 	}
 
-	// Generate client certificate (valid for configured duration or 24h default)
+	// Apply the constraints the user's policies set
+	constraints, err := s.userConstraints(ctx, user.UserID, user.Email, user.Groups)
+	if err != nil {
+		s.logger.Error("Failed to evaluate policy constraints", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check access"})
+		return
+	}
+	if ok, name := constraints.AllowsTime(time.Now()); !ok {
+		c.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("policy '%s' doesn't allow connecting at this time", name)})
+		return
+	}
+
+	// Determine crypto profile - enforce the gateway's minimum, and FIPS if the server requires it
+	cryptoProfile := gatewayCryptoProfile(gateway)
+	requireFIPS := s.settingsStore.GetBool(ctx, db.SettingRequireFIPS, false)
+	if requireFIPS {
+		cryptoProfile = openvpn.CryptoProfileFIPS
+		s.logger.Info("FIPS mode enforced by server settings", zap.String("gateway", gateway.Name))
+	}
+	if required := requiredCryptoProfile(constraints); !meetsCryptoProfile(cryptoProfile, required) {
+		c.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("your policy requires the '%s' crypto profile, but this gateway uses '%s'", required, cryptoProfile)})
+		return
+	}
+
+	// Generate client certificate (valid for configured duration or 24h default,
+	// shortened by the user's policies)
 	certValidity := s.config.PKI.CertValidity
 	if certValidity == 0 {
 		certValidity = 24 * time.Hour
 	}
+	certValidity = constraints.CapValidity(certValidity)
 
+	commonName := s.vpnCommonName(ctx, user)
 	certReq := pki.CertificateRequest{
-		CommonName: user.Email,
+		CommonName: commonName,
 		Email:      user.Email,
 		ValidFor:   certValidity,
 	}
@@ -1255,18 +1456,22 @@ func (s *Server) handleGenerateConfig(c *gin.Context) {
 		}
 	}
 
-	// Determine crypto profile - enforce FIPS if server requires it
-	cryptoProfile := gateway.CryptoProfile
-	requireFIPS := s.settingsStore.GetBool(ctx, db.SettingRequireFIPS, false)
-	if requireFIPS {
-		cryptoProfile = openvpn.CryptoProfileFIPS
-		s.logger.Info("FIPS mode enforced by server settings", zap.String("gateway", gateway.Name))
-	}
-
 	// Generate unique config ID and auth token
 	configID := generateConfigID()
 	authToken := generateAuthToken()
 
+	// The key passphrase is returned once below and never stored, so the config
+	// file alone can't be used to connect
+	var keyPassphrase string
+	if gateway.EncryptClientKeys {
+		keyPassphrase, err = pki.GenerateKeyPassphrase()
+		if err != nil {
+			s.logger.Error("Failed to generate key passphrase", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate config"})
+			return
+		}
+	}
+
 	// Generate OpenVPN config
 	genReq := openvpn.GenerateRequest{
 		Gateway:       modelGateway,
@@ -1277,6 +1482,13 @@ func (s *Server) handleGenerateConfig(c *gin.Context) {
 		CryptoProfile: cryptoProfile,
 		TLSAuthKey:    gateway.TLSAuthKey, // Use gateway-specific TLS-Auth key
 		AuthToken:     authToken,          // Unique token for password authentication
+		TLSMode:       gateway.TLSMode,
+		Compression:   gateway.Compression,
+		KeyPassphrase: keyPassphrase,
+		AuthUsername:  commonName,
+
+		AdditionalRemotes: clientRemotes(gateway.AdditionalEndpoints),
+		LinkTuning:        openvpn.LinkTuning(gateway.LinkTuning),
 	}
 
 	vpnConfig, err := s.configGen.Generate(genReq)
@@ -1299,6 +1511,10 @@ func (s *Server) handleGenerateConfig(c *gin.Context) {
 		CLICallbackURL: req.CLICallbackURL,
 		AuthToken:      authToken, // Store token for gateway verification
 		ExpiresAt:      vpnConfig.ExpiresAt,
+		TunnelMode:     tunnelMode,
+		DeviceName:     strings.TrimSpace(req.DeviceName),
+		DeviceOS:       strings.TrimSpace(req.DeviceOS),
+		Purpose:        strings.TrimSpace(req.Purpose),
 	}
 
 	if err := s.configStore.SaveConfig(c.Request.Context(), dbConfig); err != nil {
@@ -1314,19 +1530,34 @@ func (s *Server) handleGenerateConfig(c *gin.Context) {
 	)
 
 	// Return config metadata
-	c.JSON(http.StatusOK, gin.H{
-		"id":          configID,
-		"fileName":    vpnConfig.FileName,
-		"gatewayName": gateway.Name,
-		"expiresAt":   vpnConfig.ExpiresAt.Format(time.RFC3339),
-		"downloadUrl": "/api/v1/configs/download/" + configID,
-		"cliCallback": req.CLICallbackURL != "",
-	})
+	resp := gin.H{
+		"id":           configID,
+		"fileName":     vpnConfig.FileName,
+		"gatewayName":  gateway.Name,
+		"expiresAt":    vpnConfig.ExpiresAt.Format(time.RFC3339),
+		"downloadUrl":  "/api/v1/configs/download/" + configID,
+		"bundleUrl":    "/api/v1/configs/download/" + configID + "?format=zip",
+		"cliCallback":  req.CLICallbackURL != "",
+		"keyEncrypted": keyPassphrase != "",
+		"tunnelMode":   connectTunnelMode(gateway, tunnelMode),
+	}
+	if keyPassphrase != "" {
+		resp["keyPassphrase"] = keyPassphrase
+	}
+	c.JSON(http.StatusOK, resp)
 }
 
 func (s *Server) handleDownloadConfig(c *gin.Context) {
 	configID := c.Param("id")
 
+	// inline (default) is a single .ovpn; zip splits the certs, key and
+	// credentials into separate files for clients that don't handle inline blocks
+	format := c.DefaultQuery("format", "inline")
+	if format != "inline" && format != "zip" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be 'inline' or 'zip'"})
+		return
+	}
+
 	// Get config from database
 	vpnConfig, err := s.configStore.GetConfig(c.Request.Context(), configID)
 	if err != nil {
@@ -1342,10 +1573,15 @@ func (s *Server) handleDownloadConfig(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get config"})
 		return
 	}
+	if len(vpnConfig.ConfigData) == 0 {
+		// Imported certificates were issued outside GateKey, which never had their keys
+		c.JSON(http.StatusNotFound, gin.H{"error": "config was imported from an existing PKI and has no file to download"})
+		return
+	}
 
 	// Check if this is a CLI callback request
 	cliRedirect := c.Query("cli_redirect")
-	if cliRedirect == "true" && vpnConfig.CLICallbackURL != "" {
+	if cliRedirect == "true" && vpnConfig.CLICallbackURL != "" && validateCLICallback(vpnConfig.CLICallbackURL, s.config.Auth.CLICallbackHosts) == nil {
 		// Redirect to CLI with config data encoded
 		_ = s.configStore.MarkDownloaded(c.Request.Context(), configID) // Best effort
 		redirectURL := vpnConfig.CLICallbackURL + "?config_id=" + configID
@@ -1353,6 +1589,19 @@ func (s *Server) handleDownloadConfig(c *gin.Context) {
 		return
 	}
 
+	if format == "zip" {
+		bundle, err := openvpn.ConfigBundle(vpnConfig.FileName, vpnConfig.ConfigData)
+		if err != nil {
+			s.logger.Error("Failed to build config bundle", zap.String("config_id", configID), zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to build config bundle"})
+			return
+		}
+		_ = s.configStore.MarkDownloaded(c.Request.Context(), configID)
+		c.Header("Content-Disposition", "attachment; filename="+strings.TrimSuffix(vpnConfig.FileName, ".ovpn")+".zip")
+		c.Data(http.StatusOK, "application/zip", bundle)
+		return
+	}
+
 	// Mark as downloaded (best effort, don't fail download if this fails)
 	_ = s.configStore.MarkDownloaded(c.Request.Context(), configID)
 
@@ -1416,7 +1665,7 @@ func (s *Server) getAuthenticatedUser(c *gin.Context) (*authenticatedUser, error
 	}
 
 	// Check local session
-	_, localUser, err := s.userStore.GetSession(c.Request.Context(), token)
+	localUser, err := s.getLocalSession(c.Request.Context(), token)
 	if err != nil {
 		return nil, err
 	}
@@ -1439,6 +1688,15 @@ type authenticatedUser struct {
 	Provider string
 }
 
+// vpnCommonName returns the common name for a user's VPN certificates: the one
+// their SSO provider resolved at login, or the email.
+func (s *Server) vpnCommonName(ctx context.Context, user *authenticatedUser) string {
+	if ssoUser, err := s.userStore.GetSSOUser(ctx, user.UserID); err == nil {
+		return ssoUser.VPNCommonName()
+	}
+	return user.Email
+}
+
 func generateConfigID() string {
 	return uuid.New().String()
 }
@@ -1518,6 +1776,10 @@ func (s *Server) handleGetConfigRaw(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get config"})
 		return
 	}
+	if len(vpnConfig.ConfigData) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "config was imported from an existing PKI and has no file to download"})
+		return
+	}
 
 	// Mark as downloaded (best effort)
 	_ = s.configStore.MarkDownloaded(c.Request.Context(), configID)
@@ -1567,6 +1829,14 @@ func (s *Server) handleRevokeConfig(c *gin.Context) {
 		return
 	}
 
+	s.noteRevocation(c.Request.Context())
+	s.emitEvent(c.Request.Context(), eventConfigRevoked, userID, config.GatewayID, gin.H{
+		"configId":  configID,
+		"userId":    userID,
+		"gatewayId": config.GatewayID,
+		"reason":    "revoked by user",
+	})
+
 	s.logger.Info("Config revoked by user",
 		zap.String("config_id", configID),
 		zap.String("user_id", userID))
@@ -1607,10 +1877,17 @@ func (s *Server) handleListUserConfigs(c *gin.Context) {
 			"isRevoked":   cfg.IsRevoked,
 			"revokedAt":   nil,
 			"downloaded":  cfg.DownloadedAt != nil,
+			"lastUsedAt":  nil,
+			"deviceName":  cfg.DeviceName,
+			"deviceOs":    cfg.DeviceOS,
+			"purpose":     cfg.Purpose,
 		}
 		if cfg.RevokedAt != nil {
 			result[i]["revokedAt"] = cfg.RevokedAt.Format(time.RFC3339)
 		}
+		if cfg.LastUsedAt != nil {
+			result[i]["lastUsedAt"] = cfg.LastUsedAt.Format(time.RFC3339)
+		}
 	}
 
 	c.JSON(http.StatusOK, gin.H{"configs": result})
@@ -1645,10 +1922,17 @@ func (s *Server) handleAdminListAllConfigs(c *gin.Context) {
 			"isRevoked":    cfg.IsRevoked,
 			"revokedAt":    nil,
 			"downloaded":   cfg.DownloadedAt != nil,
+			"lastUsedAt":   nil,
+			"deviceName":   cfg.DeviceName,
+			"deviceOs":     cfg.DeviceOS,
+			"purpose":      cfg.Purpose,
 		}
 		if cfg.RevokedAt != nil {
 			result[i]["revokedAt"] = cfg.RevokedAt.Format(time.RFC3339)
 		}
+		if cfg.LastUsedAt != nil {
+			result[i]["lastUsedAt"] = cfg.LastUsedAt.Format(time.RFC3339)
+		}
 		if cfg.RevokedReason != "" {
 			result[i]["revokedReason"] = cfg.RevokedReason
 		}
@@ -1679,6 +1963,16 @@ func (s *Server) handleAdminRevokeConfig(c *gin.Context) {
 		return
 	}
 
+	s.noteRevocation(c.Request.Context())
+	if config, err := s.configStore.GetConfig(c.Request.Context(), configID); err == nil {
+		s.emitEvent(c.Request.Context(), eventConfigRevoked, config.UserID, config.GatewayID, gin.H{
+			"configId":  configID,
+			"userId":    config.UserID,
+			"gatewayId": config.GatewayID,
+			"reason":    req.Reason,
+		})
+	}
+
 	s.logger.Info("Config revoked by admin", zap.String("config_id", configID))
 
 	c.JSON(http.StatusOK, gin.H{
@@ -1706,6 +2000,15 @@ func (s *Server) handleAdminRevokeUserConfigs(c *gin.Context) {
 		return
 	}
 
+	s.noteRevocation(c.Request.Context())
+	if count > 0 {
+		s.emitEvent(c.Request.Context(), eventConfigRevoked, userID, "", gin.H{
+			"userId":       userID,
+			"revokedCount": count,
+			"reason":       req.Reason,
+		})
+	}
+
 	s.logger.Info("User configs revoked by admin",
 		zap.String("user_id", userID),
 		zap.Int64("count", count))
@@ -1738,6 +2041,10 @@ func (s *Server) handleAdminListUserConfigs(c *gin.Context) {
 		IsRevoked   bool    `json:"isRevoked"`
 		RevokedAt   *string `json:"revokedAt"`
 		Downloaded  bool    `json:"downloaded"`
+		LastUsedAt  *string `json:"lastUsedAt"`
+		DeviceName  string  `json:"deviceName"`
+		DeviceOS    string  `json:"deviceOs"`
+		Purpose     string  `json:"purpose"`
 	}
 
 	var response []configResponse
@@ -1751,11 +2058,18 @@ func (s *Server) handleAdminListUserConfigs(c *gin.Context) {
 			CreatedAt:   cfg.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
 			IsRevoked:   cfg.IsRevoked,
 			Downloaded:  cfg.DownloadedAt != nil,
+			DeviceName:  cfg.DeviceName,
+			DeviceOS:    cfg.DeviceOS,
+			Purpose:     cfg.Purpose,
 		}
 		if cfg.RevokedAt != nil {
 			revokedAt := cfg.RevokedAt.Format("2006-01-02T15:04:05Z07:00")
 			resp.RevokedAt = &revokedAt
 		}
+		if cfg.LastUsedAt != nil {
+			lastUsedAt := cfg.LastUsedAt.Format("2006-01-02T15:04:05Z07:00")
+			resp.LastUsedAt = &lastUsedAt
+		}
 		response = append(response, resp)
 	}
 
@@ -1819,36 +2133,6 @@ func (s *Server) handleRevokeCert(c *gin.Context) {
 	c.JSON(http.StatusNotImplemented, gin.H{"error": "revoke cert not yet implemented"})
 }
 
-// Policy handlers
-
-func (s *Server) handleListPolicies(c *gin.Context) {
-	// TODO: List all policies
-	c.JSON(http.StatusNotImplemented, gin.H{"error": "list policies not yet implemented"})
-}
-
-func (s *Server) handleCreatePolicy(c *gin.Context) {
-	// TODO: Create a new policy
-	c.JSON(http.StatusNotImplemented, gin.H{"error": "create policy not yet implemented"})
-}
-
-func (s *Server) handleGetPolicy(c *gin.Context) {
-	policyID := c.Param("id")
-	// TODO: Get a specific policy
-	c.JSON(http.StatusNotImplemented, gin.H{"error": "get policy not yet implemented", "policy_id": policyID})
-}
-
-func (s *Server) handleUpdatePolicy(c *gin.Context) {
-	policyID := c.Param("id")
-	// TODO: Update a policy
-	c.JSON(http.StatusNotImplemented, gin.H{"error": "update policy not yet implemented", "policy_id": policyID})
-}
-
-func (s *Server) handleDeletePolicy(c *gin.Context) {
-	policyID := c.Param("id")
-	// TODO: Delete a policy
-	c.JSON(http.StatusNotImplemented, gin.H{"error": "delete policy not yet implemented", "policy_id": policyID})
-}
-
 // Gateway handlers (internal API for gateways)
 
 func (s *Server) handleGatewayVerify(c *gin.Context) {
@@ -1862,8 +2146,7 @@ func (s *Server) handleGatewayVerify(c *gin.Context) {
 		ClientIP     string `json:"client_ip"`
 	}
 
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &req) {
 		return
 	}
 
@@ -1872,9 +2155,10 @@ func (s *Server) handleGatewayVerify(c *gin.Context) {
 	gateway, err := s.gatewayStore.GetGatewayByToken(ctx, req.Token)
 	if err != nil {
 		s.logger.Warn("Gateway verify: invalid token", zap.Error(err))
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid gateway token", "allowed": false})
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid gateway token", "allowed": false, "reason_code": openvpn.DenyInvalidGatewayToken})
 		return
 	}
+	ctx = s.tenantContext(ctx, gateway.TenantID)
 
 	// Verify auth token (password) if provided - this is the primary authentication method
 	var config *db.GeneratedConfig
@@ -1885,44 +2169,32 @@ func (s *Server) handleGatewayVerify(c *gin.Context) {
 			if err == db.ErrConfigRevoked {
 				s.logger.Warn("Gateway verify: config revoked",
 					zap.String("username", req.Username))
-				c.JSON(http.StatusOK, gin.H{
-					"allowed": false,
-					"reason":  "access revoked",
-				})
+				c.JSON(http.StatusOK, gatewayDenial(openvpn.DenyConfigRevoked, "access revoked"))
 				return
 			}
 			if err == db.ErrConfigExpired {
 				s.logger.Warn("Gateway verify: config expired",
 					zap.String("username", req.Username))
-				c.JSON(http.StatusOK, gin.H{
-					"allowed": false,
-					"reason":  "config expired",
-				})
+				c.JSON(http.StatusOK, gatewayDenial(openvpn.DenyConfigExpired, "config expired"))
 				return
 			}
 			s.logger.Warn("Gateway verify: invalid auth token",
 				zap.String("username", req.Username),
 				zap.Error(err))
-			c.JSON(http.StatusOK, gin.H{
-				"allowed": false,
-				"reason":  "invalid credentials",
-			})
+			c.JSON(http.StatusOK, gatewayDenial(openvpn.DenyInvalidCredentials, "invalid credentials"))
 			return
 		}
 
-		// Verify the username matches the config's user (email)
-		// Username in auth-user-pass should be the user's email
+		// Verify the username matches the config's user
+		// Username in auth-user-pass is the user's VPN common name (the email by
+		// default); configs issued before a provider changed its source use the email
 		if req.Username != "" && config.UserID != "" {
-			// Get user to verify email matches
 			user, err := s.userStore.GetSSOUser(ctx, config.UserID)
-			if err == nil && user.Email != req.Username {
+			if err == nil && user.Email != req.Username && user.VPNCommonName() != req.Username {
 				s.logger.Warn("Gateway verify: username mismatch",
 					zap.String("provided", req.Username),
-					zap.String("expected", user.Email))
-				c.JSON(http.StatusOK, gin.H{
-					"allowed": false,
-					"reason":  "username mismatch",
-				})
+					zap.String("expected", user.VPNCommonName()))
+				c.JSON(http.StatusOK, gatewayDenial(openvpn.DenyUsernameMismatch, "username mismatch"))
 				return
 			}
 		}
@@ -1932,10 +2204,7 @@ func (s *Server) handleGatewayVerify(c *gin.Context) {
 			s.logger.Warn("Gateway verify: config not for this gateway",
 				zap.String("config_gateway", config.GatewayID),
 				zap.String("request_gateway", gateway.ID))
-			c.JSON(http.StatusOK, gin.H{
-				"allowed": false,
-				"reason":  "config not valid for this gateway",
-			})
+			c.JSON(http.StatusOK, gatewayDenial(openvpn.DenyWrongGateway, "config not valid for this gateway"))
 			return
 		}
 
@@ -1946,33 +2215,24 @@ func (s *Server) handleGatewayVerify(c *gin.Context) {
 	} else if req.SerialNumber != "" {
 		// Fallback to certificate verification if no password provided
 		var err error
-		config, err = s.configStore.GetConfigBySerial(ctx, req.SerialNumber)
+		config, err = s.configBySerial(ctx, req.SerialNumber)
 		if err != nil {
 			s.logger.Warn("Gateway verify: certificate not found",
 				zap.String("serial", req.SerialNumber),
 				zap.Error(err))
-			c.JSON(http.StatusOK, gin.H{
-				"allowed": false,
-				"reason":  "certificate not found or revoked",
-			})
+			c.JSON(http.StatusOK, gatewayDenial(openvpn.DenyCertNotFound, "certificate not found or revoked"))
 			return
 		}
 
 		// Check if config is revoked
 		if config.IsRevoked {
-			c.JSON(http.StatusOK, gin.H{
-				"allowed": false,
-				"reason":  "access revoked",
-			})
+			c.JSON(http.StatusOK, gatewayDenial(openvpn.DenyConfigRevoked, "access revoked"))
 			return
 		}
 
 		// Check if certificate has expired
 		if time.Now().After(config.ExpiresAt) {
-			c.JSON(http.StatusOK, gin.H{
-				"allowed": false,
-				"reason":  "certificate expired",
-			})
+			c.JSON(http.StatusOK, gatewayDenial(openvpn.DenyCertExpired, "certificate expired"))
 			return
 		}
 
@@ -1981,33 +2241,24 @@ func (s *Server) handleGatewayVerify(c *gin.Context) {
 			s.logger.Warn("Gateway verify: config not for this gateway",
 				zap.String("config_gateway", config.GatewayID),
 				zap.String("request_gateway", gateway.ID))
-			c.JSON(http.StatusOK, gin.H{
-				"allowed": false,
-				"reason":  "certificate not valid for this gateway",
-			})
+			c.JSON(http.StatusOK, gatewayDenial(openvpn.DenyWrongGateway, "certificate not valid for this gateway"))
 			return
 		}
 	}
 
-	// Look up the user by email (common_name is the email)
-	user, err := s.userStore.GetSSOUserByEmail(ctx, req.CommonName)
+	// Look up the user by their certificate common name
+	user, err := s.certificateUser(ctx, req.CommonName, config)
 	if err != nil {
 		s.logger.Warn("Gateway verify: user not found",
 			zap.String("common_name", req.CommonName),
 			zap.Error(err))
-		c.JSON(http.StatusOK, gin.H{
-			"allowed": false,
-			"reason":  "user not found",
-		})
+		c.JSON(http.StatusOK, gatewayDenial(openvpn.DenyUserNotFound, "user not found"))
 		return
 	}
 
 	// Check if user is active
 	if !user.IsActive {
-		c.JSON(http.StatusOK, gin.H{
-			"allowed": false,
-			"reason":  "user account is disabled",
-		})
+		c.JSON(http.StatusOK, gatewayDenial(openvpn.DenyUserDisabled, "user account is disabled"))
 		return
 	}
 
@@ -2015,20 +2266,33 @@ func (s *Server) handleGatewayVerify(c *gin.Context) {
 	hasAccess, err := s.gatewayStore.UserHasGatewayAccess(ctx, user.ID, gateway.ID, user.Groups)
 	if err != nil {
 		s.logger.Error("Gateway verify: failed to check access", zap.Error(err))
-		c.JSON(http.StatusOK, gin.H{
-			"allowed": false,
-			"reason":  "access check failed",
-		})
+		c.JSON(http.StatusOK, gatewayDenial(openvpn.DenyAccessCheckFailed, "access check failed"))
 		return
 	}
 	if !hasAccess {
 		s.logger.Warn("Gateway verify: user does not have gateway access",
 			zap.String("user", user.Email),
 			zap.String("gateway", gateway.Name))
-		c.JSON(http.StatusOK, gin.H{
-			"allowed": false,
-			"reason":  "user does not have access to this gateway",
-		})
+		c.JSON(http.StatusOK, gatewayDenial(openvpn.DenyNoGatewayAccess, "user does not have access to this gateway"))
+		return
+	}
+
+	// Check the constraints the user's policies set
+	if code, reason := s.checkPolicyConstraints(ctx, user, gateway); code != "" {
+		s.logger.Warn("Gateway verify: denied by policy",
+			zap.String("user", user.Email),
+			zap.String("gateway", gateway.Name),
+			zap.String("reason", reason))
+		c.JSON(http.StatusOK, gatewayDenial(code, reason))
+		return
+	}
+
+	if code, reason := s.checkGroupConnectionLimits(ctx, user); code != "" {
+		s.logger.Warn("Gateway verify: group connection limit reached",
+			zap.String("user", user.Email),
+			zap.String("gateway", gateway.Name),
+			zap.String("reason", reason))
+		c.JSON(http.StatusOK, gatewayDenial(code, reason))
 		return
 	}
 
@@ -2037,6 +2301,25 @@ func (s *Server) handleGatewayVerify(c *gin.Context) {
 		zap.String("user", user.Email),
 		zap.String("client_ip", req.ClientIP))
 
+	// Record the use off the request path; the stores skip the write if the
+	// timestamp was updated recently.
+	configID := ""
+	if config != nil {
+		configID = config.ID
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if configID != "" {
+			if err := s.configStore.MarkUsed(ctx, configID); err != nil {
+				s.logger.Warn("Failed to record config use", zap.String("config_id", configID), zap.Error(err))
+			}
+		}
+		if err := s.userStore.RecordVPNAuth(ctx, user.ID); err != nil {
+			s.logger.Warn("Failed to record VPN auth", zap.String("user", user.Email), zap.Error(err))
+		}
+	}()
+
 	c.JSON(http.StatusOK, gin.H{
 		"allowed":      true,
 		"gateway_id":   gateway.ID,
@@ -2057,8 +2340,7 @@ func (s *Server) handleGatewayConnect(c *gin.Context) {
 		SerialNumber string `json:"serial_number"`
 	}
 
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &req) {
 		return
 	}
 
@@ -2066,27 +2348,58 @@ func (s *Server) handleGatewayConnect(c *gin.Context) {
 	ctx := c.Request.Context()
 	gateway, err := s.gatewayStore.GetGatewayByToken(ctx, req.Token)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid gateway token"})
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid gateway token", "reason_code": openvpn.DenyInvalidGatewayToken})
 		return
 	}
+	ctx = s.tenantContext(ctx, gateway.TenantID)
+
+	// The config the certificate was issued with, if the gateway reported it
+	var config *db.GeneratedConfig
+	if req.SerialNumber != "" {
+		config, _ = s.configBySerial(ctx, req.SerialNumber)
+	}
 
-	// Look up the user by email (common_name is the email)
-	user, err := s.userStore.GetSSOUserByEmail(ctx, req.CommonName)
+	// Look up the user by their certificate common name
+	user, err := s.certificateUser(ctx, req.CommonName, config)
 	if err != nil {
 		s.logger.Warn("Gateway connect: user not found",
 			zap.String("common_name", req.CommonName),
 			zap.Error(err))
-		c.JSON(http.StatusForbidden, gin.H{"error": "user not found"})
+		c.JSON(http.StatusForbidden, gatewayConnectDenial(openvpn.DenyUserNotFound, "user not found"))
 		return
 	}
 
 	// Check if user has access to this gateway (defense in depth)
 	hasAccess, err := s.gatewayStore.UserHasGatewayAccess(ctx, user.ID, gateway.ID, user.Groups)
-	if err != nil || !hasAccess {
+	if err != nil {
+		s.logger.Error("Gateway connect: failed to check access", zap.Error(err))
+		c.JSON(http.StatusForbidden, gatewayConnectDenial(openvpn.DenyAccessCheckFailed, "access check failed"))
+		return
+	}
+	if !hasAccess {
 		s.logger.Warn("Gateway connect: access denied",
 			zap.String("user", user.Email),
 			zap.String("gateway", gateway.Name))
-		c.JSON(http.StatusForbidden, gin.H{"error": "access denied"})
+		c.JSON(http.StatusForbidden, gatewayConnectDenial(openvpn.DenyNoGatewayAccess, "access denied"))
+		return
+	}
+
+	// The tunnel mode the user chose for this config, if the gateway allows it
+	configTunnelMode := ""
+	if config != nil {
+		configTunnelMode = config.TunnelMode
+	}
+	tunnelMode := connectTunnelMode(gateway, configTunnelMode)
+
+	// Record the connection, checking group connection limits again in the same
+	// transaction, since other members may have connected between this user's
+	// verify and connect
+	if code, reason := s.recordGroupLimitedConnect(ctx, user, gateway, req.ClientIP, req.VPNIPv4, req.VPNIPv6, tunnelMode); code != "" {
+		s.logger.Warn("Gateway connect: group connection limit reached",
+			zap.String("user", user.Email),
+			zap.String("gateway", gateway.Name),
+			zap.String("reason", reason))
+		c.JSON(http.StatusForbidden, gatewayConnectDenial(code, reason))
 		return
 	}
 
@@ -2104,67 +2417,87 @@ func (s *Server) handleGatewayConnect(c *gin.Context) {
 	firewallRules := []gin.H{}
 	clientConfig := []string{}
 
+	fullTunnel := tunnelMode == db.TunnelModeFull
+
 	// If full tunnel mode is enabled, push default route for all traffic
-	if gateway.FullTunnelMode {
+	if fullTunnel {
 		clientConfig = append(clientConfig, "push \"redirect-gateway def1 bypass-dhcp\"")
 	}
 
 	// Push DNS servers if enabled
-	if gateway.PushDNS {
-		if len(gateway.DNSServers) > 0 {
-			// Use custom DNS servers configured for this gateway
-			for _, dns := range gateway.DNSServers {
-				clientConfig = append(clientConfig, fmt.Sprintf("push \"dhcp-option DNS %s\"", dns))
-			}
-		} else {
-			// Fallback to public DNS if push_dns is enabled but no servers configured
-			clientConfig = append(clientConfig, "push \"dhcp-option DNS 1.1.1.1\"")
-			clientConfig = append(clientConfig, "push \"dhcp-option DNS 8.8.8.8\"")
+	for _, dns := range pushedDNSServers(gateway) {
+		clientConfig = append(clientConfig, fmt.Sprintf("push \"dhcp-option DNS %s\"", dns))
+	}
+
+	// Custom push options from the gateway and the user's rules, re-validated in
+	// case the allowlist changed since they were saved
+	for _, opt := range connectPushOptions(gateway, accessRules) {
+		if err := openvpn.ValidatePushOption(opt); err != nil {
+			s.logger.Warn("Skipping disallowed push option",
+				zap.String("gateway", gateway.Name),
+				zap.Error(err))
+			continue
 		}
+		clientConfig = append(clientConfig, openvpn.FormatPushOption(opt))
 	}
 
 	for _, rule := range accessRules {
 		if !rule.IsActive {
 			continue
 		}
-		fwRule := gin.H{
-			"action":    "allow",
-			"rule_type": rule.RuleType,
-			"value":     rule.Value,
-		}
-		if rule.PortRange != nil {
-			fwRule["port_range"] = *rule.PortRange
-		}
-		if rule.Protocol != nil {
-			fwRule["protocol"] = *rule.Protocol
-		}
-		firewallRules = append(firewallRules, fwRule)
-
-		// For split tunnel mode, push routes for CIDR and IP rules
-		if !gateway.FullTunnelMode {
-			var route string
-			switch rule.RuleType {
-			case db.AccessRuleTypeCIDR:
-				// Convert CIDR to OpenVPN route format (network netmask)
-				route = cidrToRoute(rule.Value)
-			case db.AccessRuleTypeIP:
-				// Single IP is a /32 CIDR
-				route = cidrToRoute(rule.Value + "/32")
-			case db.AccessRuleTypeHostname, db.AccessRuleTypeHostnameWildcard:
-				// Hostname rules don't generate routes
+		for _, value := range rule.Destinations() {
+			fwRule := gin.H{
+				"action":    "allow",
+				"rule_type": rule.RuleType,
+				"value":     value,
+			}
+			if rule.RuleType == db.AccessRuleTypeHostnameWildcard && len(rule.Except) > 0 {
+				fwRule["except"] = rule.Except
 			}
-			if route != "" {
-				clientConfig = append(clientConfig, route)
+			if rule.PortRange != nil {
+				fwRule["port_range"] = *rule.PortRange
+			}
+			if rule.Protocol != nil {
+				fwRule["protocol"] = *rule.Protocol
+			}
+			firewallRules = append(firewallRules, fwRule)
+
+			// For split tunnel mode, push routes for CIDR and IP rules
+			if !fullTunnel {
+				var route string
+				switch rule.RuleType {
+				case db.AccessRuleTypeCIDR:
+					// Convert CIDR to OpenVPN route format (network netmask)
+					route = cidrToRoute(value)
+				case db.AccessRuleTypeIP:
+					// Single IP is a /32 CIDR
+					route = cidrToRoute(value + "/32")
+				case db.AccessRuleTypeHostname, db.AccessRuleTypeHostnameWildcard:
+					// Hostname rules don't generate routes
+				}
+				if route != "" {
+					clientConfig = append(clientConfig, route)
+				}
 			}
 		}
 	}
 
+	s.emitEvent(ctx, eventConnect, user.ID, gateway.ID, gin.H{
+		"userId":      user.ID,
+		"userEmail":   user.Email,
+		"gatewayId":   gateway.ID,
+		"gatewayName": gateway.Name,
+		"clientIp":    req.ClientIP,
+		"vpnIp":       req.VPNIPv4,
+		"tunnelMode":  tunnelMode,
+	})
+
 	s.logger.Info("Gateway connect: client connected with rules",
 		zap.String("gateway", gateway.Name),
 		zap.String("user", user.Email),
 		zap.String("vpn_ipv4", req.VPNIPv4),
 		zap.Int("rule_count", len(firewallRules)),
-		zap.Bool("full_tunnel", gateway.FullTunnelMode),
+		zap.String("tunnel_mode", tunnelMode),
 		zap.Int("route_count", len(clientConfig)))
 
 	c.JSON(http.StatusOK, gin.H{
@@ -2189,10 +2522,11 @@ func (s *Server) handleGatewayDisconnect(c *gin.Context) {
 		Duration   int64  `json:"duration_seconds"`
 		BytesSent  int64  `json:"bytes_sent"`
 		BytesRecv  int64  `json:"bytes_received"`
+		// The client certificate's serial; absent from older agents
+		SerialNumber string `json:"serial_number"`
 	}
 
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &req) {
 		return
 	}
 
@@ -2203,6 +2537,7 @@ func (s *Server) handleGatewayDisconnect(c *gin.Context) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid gateway token"})
 		return
 	}
+	ctx = s.tenantContext(ctx, gateway.TenantID)
 
 	s.logger.Info("Gateway disconnect: client disconnected",
 		zap.String("gateway", gateway.Name),
@@ -2211,7 +2546,31 @@ func (s *Server) handleGatewayDisconnect(c *gin.Context) {
 		zap.Int64("bytes_sent", req.BytesSent),
 		zap.Int64("bytes_received", req.BytesRecv))
 
-	// TODO: Update connection record in database and remove firewall rules
+	// Close the connection record, resolving the user as connect did; firewall
+	// rules are removed by the gateway agent
+	var config *db.GeneratedConfig
+	if req.SerialNumber != "" {
+		config, _ = s.configBySerial(ctx, req.SerialNumber)
+	}
+	var userID string
+	userEmail := req.CommonName
+	if user, err := s.certificateUser(ctx, req.CommonName, config); err == nil {
+		userID = user.ID
+		userEmail = user.Email
+		if err := s.connectionStore.RecordDisconnect(ctx, user.ID, gateway.ID, req.ClientIP, req.BytesSent, req.BytesRecv, "client-disconnect"); err != nil {
+			s.logger.Error("Gateway disconnect: failed to record disconnection", zap.Error(err))
+		}
+	}
+	s.emitEvent(ctx, eventDisconnect, userID, gateway.ID, gin.H{
+		"userId":          userID,
+		"userEmail":       userEmail,
+		"gatewayId":       gateway.ID,
+		"gatewayName":     gateway.Name,
+		"clientIp":        req.ClientIP,
+		"durationSeconds": req.Duration,
+		"bytesSent":       req.BytesSent,
+		"bytesReceived":   req.BytesRecv,
+	})
 
 	c.JSON(http.StatusOK, gin.H{
 		"status":       "disconnected",
@@ -2230,10 +2589,11 @@ func (s *Server) handleGatewayHeartbeat(c *gin.Context) {
 		MemoryUsage    float64 `json:"memory_usage"`
 		OpenVPNRunning bool    `json:"openvpn_running"`
 		ConfigVersion  string  `json:"config_version"` // Gateway's current config version
+		// Rule enforcement metrics from the agent; absent from older agents
+		Metrics *openvpn.HeartbeatMetrics `json:"metrics"`
 	}
 
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &req) {
 		return
 	}
 
@@ -2244,8 +2604,18 @@ func (s *Server) handleGatewayHeartbeat(c *gin.Context) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid gateway token"})
 		return
 	}
+	ctx = s.tenantContext(ctx, gateway.TenantID)
 
-	// Update gateway heartbeat and status
+	// Update gateway heartbeat and status; an unparseable reported IP is ignored
+	if req.PublicIP != "" {
+		if _, ip, err := normalizeGatewayAddress("", req.PublicIP); err == nil {
+			req.PublicIP = ip
+		} else {
+			s.logger.Warn("Ignoring invalid public IP in gateway heartbeat",
+				zap.String("gateway", gateway.Name), zap.Error(err))
+			req.PublicIP = ""
+		}
+	}
 	if req.PublicIP != "" {
 		err = s.gatewayStore.UpdateGatewayStatus(ctx, gateway.ID, req.PublicIP)
 	} else {
@@ -2258,6 +2628,18 @@ func (s *Server) handleGatewayHeartbeat(c *gin.Context) {
 		return
 	}
 
+	for _, pool := range s.gatewayMetrics.record(gateway.ID, req.Metrics) {
+		s.logger.Warn("Gateway address pool is nearly full",
+			zap.String("gateway", gateway.Name),
+			zap.String("subnet", pool.Subnet),
+			zap.Int("used", pool.Used),
+			zap.Int("size", pool.Size))
+		s.emitEvent(ctx, eventIPPoolLow, "", gateway.ID, gin.H{"gatewayId": gateway.ID, "gatewayName": gateway.Name, "pool": poolSummary(pool)})
+	}
+	if !gateway.IsActive {
+		s.emitEvent(ctx, eventGatewayOnline, "", gateway.ID, gin.H{"gatewayId": gateway.ID, "gatewayName": gateway.Name})
+	}
+
 	// Check if gateway needs to reprovision
 	// Trigger reprovision if:
 	// 1. Gateway sends empty version AND server has a version (new/reset gateway needs initial provision)
@@ -2277,6 +2659,8 @@ func (s *Server) handleGatewayHeartbeat(c *gin.Context) {
 				zap.String("server_version", gateway.ConfigVersion))
 		}
 	}
+	s.trackReprovisionSignal(ctx, s.gatewayStore, gateway, needsReprovision)
+	s.recordHeartbeatVersion(ctx, db.ComponentGateway, gateway.ID, req.ConfigVersion)
 
 	// Get CA fingerprint for rotation detection
 	caFingerprint := ""
@@ -2284,16 +2668,95 @@ func (s *Server) handleGatewayHeartbeat(c *gin.Context) {
 		caFingerprint = pki.Fingerprint(s.ca.Certificate())
 	}
 
+	// Rules hash lets the gateway skip rule refreshes when nothing changed.
+	// An empty hash tells the gateway to fall back to refreshing every interval.
+	rulesHash, err := s.rulesHash(ctx)
+	if err != nil {
+		s.logger.Warn("Failed to compute rules hash", zap.Error(err))
+		rulesHash = ""
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"status":            "ok",
-		"gateway_id":        gateway.ID,
-		"gateway_name":      gateway.Name,
-		"config_version":    gateway.ConfigVersion,
-		"needs_reprovision": needsReprovision,
-		"ca_fingerprint":    caFingerprint,
+		"status":                 "ok",
+		"gateway_id":             gateway.ID,
+		"gateway_name":           gateway.Name,
+		"config_version":         gateway.ConfigVersion,
+		"needs_reprovision":      needsReprovision,
+		"ca_fingerprint":         caFingerprint,
+		"rules_hash":             rulesHash,
+		"revocation_epoch":       s.revocationEpoch(ctx),
+		"min_heartbeat_interval": s.minHeartbeatInterval(),
 	})
 }
 
+// minHeartbeatInterval is the shortest heartbeat interval in seconds agents are
+// asked to use, so an operator can throttle a large fleet from the control plane.
+func (s *Server) minHeartbeatInterval() int {
+	return int(s.config.Gateway.MinHeartbeatInterval / time.Second)
+}
+
+// reprovisionTracker is the gateway store's reprovision signal tracking.
+type reprovisionTracker interface {
+	RecordReprovisionSignal(ctx context.Context, gatewayID string) (*db.GatewayReprovisionStatus, error)
+	MarkReprovisionAlerted(ctx context.Context, gatewayID string) error
+	ClearReprovisionSignals(ctx context.Context, gatewayID string) (bool, error)
+}
+
+// trackReprovisionSignal counts consecutive heartbeats in which a gateway was told to
+// reprovision. A gateway whose version never converges is still heartbeating but
+// effectively broken, so an alert is raised once the threshold is crossed.
+//
+// Tracking is cleared on every heartbeat that doesn't need a reprovision, whether
+// the gateway reported a new version or the server's version went back to the
+// one it runs. Clearing a gateway with nothing tracked deletes nothing.
+func (s *Server) trackReprovisionSignal(ctx context.Context, tracker reprovisionTracker, gateway *db.Gateway, needsReprovision bool) {
+	if !needsReprovision {
+		cleared, err := tracker.ClearReprovisionSignals(ctx, gateway.ID)
+		if err != nil {
+			s.logger.Warn("Failed to clear reprovision status", zap.String("gateway", gateway.Name), zap.Error(err))
+		} else if cleared {
+			s.logger.Info("Gateway config version converged", zap.String("gateway", gateway.Name))
+		}
+		return
+	}
+
+	status, err := tracker.RecordReprovisionSignal(ctx, gateway.ID)
+	if err != nil {
+		s.logger.Warn("Failed to record reprovision signal", zap.String("gateway", gateway.Name), zap.Error(err))
+		return
+	}
+
+	threshold := s.settingsStore.GetInt(ctx, db.SettingReprovisionAlertThreshold, db.DefaultReprovisionAlertThreshold)
+	if !reprovisionAlertDue(status, threshold) {
+		return
+	}
+
+	s.logger.Error("Gateway reprovision failing: config version has not converged",
+		zap.String("gateway", gateway.Name),
+		zap.String("gateway_id", gateway.ID),
+		zap.Int("consecutive_signals", status.ConsecutiveSignals),
+		zap.Time("pending_since", status.FirstSignaledAt),
+		zap.String("server_version", gateway.ConfigVersion))
+	if err := tracker.MarkReprovisionAlerted(ctx, gateway.ID); err != nil {
+		s.logger.Warn("Failed to mark reprovision alert", zap.String("gateway", gateway.Name), zap.Error(err))
+	}
+	details := gin.H{
+		"gatewayName":        gateway.Name,
+		"consecutiveSignals": status.ConsecutiveSignals,
+		"pendingSince":       status.FirstSignaledAt,
+		"serverVersion":      gateway.ConfigVersion,
+	}
+	s.emitEvent(ctx, eventReprovisionFailing, "", gateway.ID, details)
+	s.recordSystemAudit(ctx, "gateway.reprovision_failing", "gateway", gateway.ID, details)
+}
+
+// reprovisionAlertDue reports whether a gateway's reprovision tracking calls for
+// an alert: once it has been signaled threshold times in a row, and once per
+// episode.
+func reprovisionAlertDue(status *db.GatewayReprovisionStatus, threshold int) bool {
+	return status.ConsecutiveSignals >= threshold && status.AlertedAt == nil
+}
+
 // handleGatewayProvision provisions certificates for a gateway to run OpenVPN server
 func (s *Server) handleGatewayProvision(c *gin.Context) {
 	if s.ca == nil {
@@ -2305,8 +2768,7 @@ func (s *Server) handleGatewayProvision(c *gin.Context) {
 		Token string `json:"token" binding:"required"`
 	}
 
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &req) {
 		return
 	}
 
@@ -2317,6 +2779,7 @@ func (s *Server) handleGatewayProvision(c *gin.Context) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid gateway token"})
 		return
 	}
+	ctx = s.tenantContext(ctx, gateway.TenantID)
 
 	// Issue server certificate for this gateway
 	certReq := pki.CertificateRequest{
@@ -2370,6 +2833,9 @@ func (s *Server) handleGatewayProvision(c *gin.Context) {
 		}
 	}
 
+	authTokenLifetime := s.authGenTokenLifetime(ctx, gateway)
+	s.recordProvisioned(ctx, db.ComponentGateway, gateway.ID)
+
 	s.logger.Info("Gateway provisioned",
 		zap.String("gateway", gateway.Name),
 		zap.String("serial", cert.SerialNumber),
@@ -2387,8 +2853,15 @@ func (s *Server) handleGatewayProvision(c *gin.Context) {
 		"vpn_netmask":      vpnNetmask,
 		"vpn_port":         gateway.VPNPort,
 		"vpn_protocol":     gateway.VPNProtocol,
-		"crypto_profile":   gateway.CryptoProfile,
+		"crypto_profile":   gatewayCryptoProfile(gateway),
 		"tls_auth_enabled": gateway.TLSAuthEnabled,
+		"tls_mode":         gateway.TLSMode,
+		"compression":      gateway.Compression,
+		"link_tuning":      openvpn.LinkTuning(gateway.LinkTuning),
+
+		"auth_gen_token_lifetime": authTokenLifetime,
+		"additional_endpoints":    provisionEndpoints(gateway.AdditionalEndpoints),
+		"fingerprints":            provisioningFingerprints(gateway, s.ca.CertificatePEM(), tlsAuthKey, authTokenLifetime),
 	}
 
 	// Only include TLS-Auth key if enabled
@@ -2396,7 +2869,55 @@ func (s *Server) handleGatewayProvision(c *gin.Context) {
 		response["tls_auth_key"] = tlsAuthKey
 	}
 
-	c.JSON(http.StatusOK, response)
+	// Sign the exact body, so the agent can check it was issued with the CA from
+	// its heartbeats before writing any of it
+	body, err := json.Marshal(response)
+	if err != nil {
+		s.logger.Error("Failed to encode provisioning response", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to encode provisioning response"})
+		return
+	}
+	signature, err := s.ca.Sign(body)
+	if err != nil {
+		s.logger.Error("Failed to sign provisioning response", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to sign provisioning response"})
+		return
+	}
+	c.Header(openvpn.ProvisionSignatureHeader, base64.StdEncoding.EncodeToString(signature))
+	s.endorseProvision(c, body)
+	c.Data(http.StatusOK, "application/json; charset=utf-8", body)
+}
+
+// endorseProvision signs a provisioning response with every trusted CA other than
+// the active one. Agents trust the CA they were provisioned with, so after a
+// rotation the retired CA's endorsement is what lets them accept the new one.
+func (s *Server) endorseProvision(c *gin.Context, body []byte) {
+	trusted, err := s.pkiStore.GetTrustedCAs(c.Request.Context())
+	if err != nil {
+		s.logger.Warn("Failed to load trusted CAs to endorse provisioning", zap.Error(err))
+		return
+	}
+	for _, endorsement := range s.provisionEndorsements(trusted, pki.Fingerprint(s.ca.Certificate()), body) {
+		c.Writer.Header().Add(openvpn.ProvisionEndorsementHeader, endorsement)
+	}
+}
+
+// provisionEndorsements returns ProvisionEndorsementHeader values signing body
+// with each trusted CA other than the active one.
+func (s *Server) provisionEndorsements(trusted []*db.StoredCA, active string, body []byte) []string {
+	var endorsements []string
+	for _, ca := range trusted {
+		if ca.Fingerprint == active {
+			continue
+		}
+		signature, err := pki.SignWithPEM(ca.CertificatePEM, ca.PrivateKeyPEM, body)
+		if err != nil {
+			s.logger.Warn("Failed to endorse provisioning response", zap.String("ca_id", ca.ID), zap.Error(err))
+			continue
+		}
+		endorsements = append(endorsements, ca.Fingerprint+"="+base64.StdEncoding.EncodeToString(signature))
+	}
+	return endorsements
 }
 
 // parseSubnetToNetworkMask converts CIDR (e.g., "10.8.0.0/24") to network and netmask
@@ -2419,12 +2940,11 @@ func (s *Server) handleGatewayClientRules(c *gin.Context) {
 		Token      string   `json:"token" binding:"required"`
 		UserID     string   `json:"user_id" binding:"required"`
 		UserEmail  string   `json:"user_email"`
-		UserGroups []string `json:"user_groups"`
+		UserGroups []string `json:"user_groups" binding:"max=1000"`
 		ClientIP   string   `json:"client_ip"` // VPN IP assigned to client
 	}
 
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &req) {
 		return
 	}
 
@@ -2435,14 +2955,14 @@ func (s *Server) handleGatewayClientRules(c *gin.Context) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid gateway token"})
 		return
 	}
+	ctx = s.tenantContext(ctx, gateway.TenantID)
 
-	// The UserID from the certificate common name is actually the user's email
-	// We need to look up the user by email to get their UUID for rule lookup
+	// The UserID is the certificate common name (the user's email unless their
+	// provider sets another source); look the user up to get their UUID for rules
 	var userID string
 	var userGroups []string
 
-	// Try to find user by email (the common name in the cert is the email)
-	ssoUser, err := s.userStore.GetSSOUserByEmail(ctx, req.UserID)
+	ssoUser, err := s.userStore.GetSSOUserByCommonName(ctx, req.UserID)
 	if err == nil && ssoUser != nil {
 		userID = ssoUser.ID
 		userGroups = ssoUser.Groups
@@ -2477,6 +2997,11 @@ func (s *Server) handleGatewayClientRules(c *gin.Context) {
 		Value    string `json:"value"`    // IP address, CIDR, or hostname
 		Port     string `json:"port"`     // Port or port range (empty = all)
 		Protocol string `json:"protocol"` // tcp, udp, or empty for both
+		// Rule and Description name the access rule, for the gateway's logs
+		Rule        string `json:"rule"`
+		Description string `json:"description,omitempty"`
+		// Except lists hostnames and wildcards a hostname wildcard must not match
+		Except []string `json:"except,omitempty"`
 	}
 
 	allowed := make([]AllowedDestination, 0)
@@ -2492,13 +3017,21 @@ func (s *Server) handleGatewayClientRules(c *gin.Context) {
 		if rule.Protocol != nil {
 			protocol = *rule.Protocol
 		}
-		dest := AllowedDestination{
-			Type:     string(rule.RuleType),
-			Value:    rule.Value,
-			Port:     port,
-			Protocol: protocol,
+		// A CIDR containing a destination exception is split around it
+		for _, value := range rule.Destinations() {
+			dest := AllowedDestination{
+				Type:        string(rule.RuleType),
+				Value:       value,
+				Port:        port,
+				Protocol:    protocol,
+				Rule:        rule.Name,
+				Description: rule.Description,
+			}
+			if rule.RuleType == db.AccessRuleTypeHostnameWildcard {
+				dest.Except = rule.Except
+			}
+			allowed = append(allowed, dest)
 		}
-		allowed = append(allowed, dest)
 	}
 
 	s.logger.Info("Client rules requested",
@@ -2508,11 +3041,12 @@ func (s *Server) handleGatewayClientRules(c *gin.Context) {
 		zap.Int("rules_count", len(allowed)))
 
 	c.JSON(http.StatusOK, gin.H{
-		"user_id":     req.UserID,
-		"client_ip":   req.ClientIP,
-		"allowed":     allowed,
-		"default":     "deny", // Default policy is deny
-		"last_update": time.Now().UTC().Format(time.RFC3339),
+		"user_id":               req.UserID,
+		"client_ip":             req.ClientIP,
+		"allowed":               allowed,
+		"default":               "deny", // Default policy is deny
+		"wildcard_single_label": s.config.Policy.WildcardSingleLabel,
+		"last_update":           time.Now().UTC().Format(time.RFC3339),
 	})
 }
 
@@ -2523,8 +3057,7 @@ func (s *Server) handleGatewayAllRules(c *gin.Context) {
 		Token string `json:"token" binding:"required"`
 	}
 
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &req) {
 		return
 	}
 
@@ -2535,6 +3068,7 @@ func (s *Server) handleGatewayAllRules(c *gin.Context) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid gateway token"})
 		return
 	}
+	ctx = s.tenantContext(ctx, gateway.TenantID)
 
 	// Get all active access rules
 	rules, err := s.accessRuleStore.ListAccessRules(ctx)
@@ -2544,17 +3078,21 @@ func (s *Server) handleGatewayAllRules(c *gin.Context) {
 		return
 	}
 
-	// Get all user-rule and group-rule assignments
+	// Get all user-rule and group-rule assignments. The hash is only sent when
+	// every input to it loaded, so a partial one can't look up to date
+	complete := true
 	userRules, err := s.accessRuleStore.GetAllUserAccessRuleAssignments(ctx)
 	if err != nil {
 		s.logger.Warn("Failed to get user rule assignments", zap.Error(err))
 		userRules = make(map[string][]string) // Continue with empty
+		complete = false
 	}
 
 	groupRules, err := s.accessRuleStore.GetAllGroupAccessRuleAssignments(ctx)
 	if err != nil {
 		s.logger.Warn("Failed to get group rule assignments", zap.Error(err))
 		groupRules = make(map[string][]string) // Continue with empty
+		complete = false
 	}
 
 	// Build response
@@ -2589,25 +3127,99 @@ func (s *Server) handleGatewayAllRules(c *gin.Context) {
 		})
 	}
 
-	// Generate a hash of the rules for change detection
-	rulesHash := fmt.Sprintf("%d-%d", len(rules), time.Now().Unix()/60) // Changes every minute if rules change
+	// Content hash for change detection; matches the rules_hash sent in heartbeats
+	membership, err := s.userStore.GetGroupMembershipFingerprint(ctx)
+	if err != nil {
+		s.logger.Warn("Failed to get group membership fingerprint", zap.Error(err))
+		complete = false
+	}
+	exceptions, err := s.accessRuleStore.GetAccessExceptionFingerprint(ctx)
+	if err != nil {
+		s.logger.Warn("Failed to get access exception fingerprint", zap.Error(err))
+		complete = false
+	}
 
 	s.logger.Debug("All rules requested", zap.String("gateway", gateway.Name))
 
-	c.JSON(http.StatusOK, gin.H{
+	resp := gin.H{
 		"rules":       ruleList,
 		"user_rules":  userRules,  // map[userID][]ruleID
 		"group_rules": groupRules, // map[groupName][]ruleID
-		"hash":        rulesHash,
 		"timestamp":   time.Now().UTC().Format(time.RFC3339),
-	})
+	}
+	if complete {
+		resp["hash"] = rulesContentHash(rules, userRules, groupRules, membership, exceptions)
+	}
+	c.JSON(http.StatusOK, resp)
 }
 
 // User handlers
 
+// handleGetCurrentUser returns the authenticated user's profile. Unlike
+// handleGetSession, which only reports whether a session is valid, it also looks
+// up the user's last login and how many gateways they can reach.
 func (s *Server) handleGetCurrentUser(c *gin.Context) {
-	// TODO: Get current user info
-	c.JSON(http.StatusNotImplemented, gin.H{"error": "get current user not yet implemented"})
+	ctx := c.Request.Context()
+
+	user, err := s.getAuthenticatedUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	groups := user.Groups
+	if groups == nil {
+		groups = []string{}
+	}
+	provider := user.Provider
+	if provider == "" {
+		provider = "local"
+	}
+
+	profile := gin.H{
+		"id":       user.UserID,
+		"email":    user.Email,
+		"name":     user.Name,
+		"groups":   groups,
+		"isAdmin":  user.IsAdmin,
+		"provider": provider,
+	}
+
+	var lastLogin *time.Time
+	if provider == "local" {
+		if localUser, err := s.userStore.GetUserByID(ctx, user.UserID); err == nil {
+			lastLogin = localUser.LastLoginAt
+		}
+	} else if ssoUser, err := s.userStore.GetSSOUserByEmail(ctx, user.Email); err == nil {
+		lastLogin = ssoUser.LastLoginAt
+	}
+	if lastLogin != nil {
+		profile["lastLoginAt"] = lastLogin.Format(time.RFC3339)
+	}
+
+	if gateways, err := s.gatewayStore.ListUserGateways(ctx, user.UserID, groups); err == nil {
+		profile["gatewayCount"] = len(gateways)
+	} else {
+		s.logger.Warn("Failed to count user gateways", zap.String("user", user.Email), zap.Error(err))
+	}
+
+	// Access taken away from the user despite their groups
+	if exceptions, err := s.accessRuleStore.ListUserAccessExceptions(ctx, user.UserID); err == nil {
+		accessExceptions := make([]gin.H, 0, len(exceptions))
+		for _, e := range exceptions {
+			accessExceptions = append(accessExceptions, gin.H{
+				"ruleName":        e.RuleName,
+				"destinationType": e.DestinationType,
+				"destination":     e.Destination,
+				"reason":          e.Reason,
+			})
+		}
+		profile["accessExceptions"] = accessExceptions
+	} else {
+		s.logger.Warn("Failed to list access exceptions", zap.String("user", user.Email), zap.Error(err))
+	}
+
+	c.JSON(http.StatusOK, profile)
 }
 
 func (s *Server) handleGetUserConnections(c *gin.Context) {
@@ -2656,6 +3268,9 @@ func (s *Server) handleListUserGateways(c *gin.Context) {
 			"vpnPort":     gw.VPNPort,
 			"vpnProtocol": gw.VPNProtocol,
 			"isActive":    isActive,
+			// The default tunnel mode, and whether tunnel_mode may choose the other
+			"tunnelMode":        defaultTunnelMode(gw),
+			"allowTunnelChoice": gw.AllowTunnelChoice,
 		}
 		if gw.LastHeartbeat != nil {
 			gwData["lastHeartbeat"] = gw.LastHeartbeat.Format(time.RFC3339)
@@ -2706,7 +3321,7 @@ func (s *Server) getCurrentUserInfo(c *gin.Context) (string, []string, error) {
 	}
 
 	// Fall back to local user session
-	_, user, err := s.userStore.GetSession(c.Request.Context(), token)
+	user, err := s.getLocalSession(c.Request.Context(), token)
 	if err != nil {
 		return "", nil, err
 	}
@@ -2727,6 +3342,13 @@ func (s *Server) handleListGateways(c *gin.Context) {
 		return
 	}
 
+	reprovisionStatuses, err := s.gatewayStore.ListReprovisionStatuses(ctx)
+	if err != nil {
+		s.logger.Warn("Failed to get gateway reprovision status", zap.Error(err))
+		reprovisionStatuses = nil // Continue without reprovision status
+	}
+	reprovisionThreshold := s.settingsStore.GetInt(ctx, db.SettingReprovisionAlertThreshold, db.DefaultReprovisionAlertThreshold)
+
 	// Convert to API response format (include token for admin)
 	// Compute isActive dynamically based on last_heartbeat (active if heartbeat within last 2 minutes)
 	result := make([]gin.H, 0, len(gateways))
@@ -2738,25 +3360,42 @@ func (s *Server) handleListGateways(c *gin.Context) {
 		isActive := gw.LastHeartbeat != nil && now.Sub(*gw.LastHeartbeat) < activeThreshold
 
 		gwData := gin.H{
-			"id":             gw.ID,
-			"name":           gw.Name,
-			"hostname":       gw.Hostname,
-			"publicIp":       gw.PublicIP,
-			"vpnPort":        gw.VPNPort,
-			"vpnProtocol":    gw.VPNProtocol,
-			"cryptoProfile":  gw.CryptoProfile,
-			"vpnSubnet":      gw.VPNSubnet,
-			"tlsAuthEnabled": gw.TLSAuthEnabled,
-			"fullTunnelMode": gw.FullTunnelMode,
-			"pushDns":        gw.PushDNS,
-			"dnsServers":     gw.DNSServers,
-			"isActive":       isActive,
-			"createdAt":      gw.CreatedAt.Format(time.RFC3339),
-			"updatedAt":      gw.UpdatedAt.Format(time.RFC3339),
+			"id":                  gw.ID,
+			"name":                gw.Name,
+			"hostname":            gw.Hostname,
+			"publicIp":            gw.PublicIP,
+			"vpnPort":             gw.VPNPort,
+			"vpnProtocol":         gw.VPNProtocol,
+			"cryptoProfile":       gw.CryptoProfile,
+			"minCryptoProfile":    gw.MinCryptoProfile,
+			"vpnSubnet":           gw.VPNSubnet,
+			"tlsAuthEnabled":      gw.TLSAuthEnabled,
+			"tlsMode":             gw.TLSMode,
+			"compression":         gw.Compression,
+			"encryptClientKeys":   gw.EncryptClientKeys,
+			"fullTunnelMode":      gw.FullTunnelMode,
+			"allowTunnelChoice":   gw.AllowTunnelChoice,
+			"pushDns":             gw.PushDNS,
+			"dnsServers":          gw.DNSServers,
+			"pushOptions":         gw.PushOptions,
+			"additionalEndpoints": gw.AdditionalEndpoints,
+			"linkTuning":          gw.LinkTuning,
+			"isActive":            isActive,
+			"createdAt":           gw.CreatedAt.Format(time.RFC3339),
+			"updatedAt":           gw.UpdatedAt.Format(time.RFC3339),
 		}
 		if gw.LastHeartbeat != nil {
 			gwData["lastHeartbeat"] = gw.LastHeartbeat.Format(time.RFC3339)
 		}
+		if metrics := s.gatewayMetrics.summary(gw.ID); metrics != nil {
+			gwData["agentMetrics"] = metrics
+		}
+		gwData["reprovisionFailing"] = false
+		if st, ok := reprovisionStatuses[gw.ID]; ok {
+			gwData["reprovisionAttempts"] = st.ConsecutiveSignals
+			gwData["reprovisionPendingSince"] = st.FirstSignaledAt.Format(time.RFC3339)
+			gwData["reprovisionFailing"] = st.ConsecutiveSignals >= reprovisionThreshold
+		}
 		result = append(result, gwData)
 	}
 
@@ -2771,24 +3410,38 @@ func (s *Server) handleRegisterGateway(c *gin.Context) {
 		PublicIP       string   `json:"public_ip"`
 		VPNPort        int      `json:"vpn_port"`
 		VPNProtocol    string   `json:"vpn_protocol"`
-		CryptoProfile  string   `json:"crypto_profile"`   // modern, fips, or compatible
-		VPNSubnet      string   `json:"vpn_subnet"`       // VPN client subnet (e.g., "10.8.0.0/24")
-		TLSAuthEnabled *bool    `json:"tls_auth_enabled"` // Enable TLS-Auth (default: true)
-		FullTunnelMode *bool    `json:"full_tunnel_mode"` // Route all traffic through VPN (default: false)
-		PushDNS        *bool    `json:"push_dns"`         // Push DNS servers to clients (default: false)
-		DNSServers     []string `json:"dns_servers"`      // DNS server IPs to push
-	}
-
-	if err := c.ShouldBindJSON(&req); err != nil {
+		CryptoProfile  string   `json:"crypto_profile"`                // modern, fips, or compatible
+		VPNSubnet      string   `json:"vpn_subnet"`                    // VPN client subnet (e.g., "10.8.0.0/24")
+		TLSAuthEnabled *bool    `json:"tls_auth_enabled"`              // Enable TLS-Auth (default: true)
+		TLSMode        string   `json:"tls_mode"`                      // auth or crypt (default: auth)
+		Compression    string   `json:"compression"`                   // none, lz4, or lzo (default: none)
+		FullTunnelMode *bool    `json:"full_tunnel_mode"`              // Route all traffic through VPN (default: false)
+		PushDNS        *bool    `json:"push_dns"`                      // Push DNS servers to clients (default: false)
+		DNSServers     []string `json:"dns_servers" binding:"max=16"`  // DNS server IPs to push
+		PushOptions    []string `json:"push_options" binding:"max=32"` // Extra allowlisted push options
+		// Extra protocol/port listeners, e.g. TCP 443 fallback for networks that block UDP
+		AdditionalEndpoints []db.ListenEndpoint `json:"additional_endpoints" binding:"max=16"`
+		// Encrypt private keys in client configs with a passphrase shown once
+		EncryptClientKeys *bool `json:"encrypt_client_keys"`
+		// Weakest crypto profile this gateway may use, e.g. fips to require FIPS here only
+		MinCryptoProfile string `json:"min_crypto_profile"`
+		// Keepalive and MTU settings for server and client configs; omitted values use the defaults
+		LinkTuning db.LinkTuning `json:"link_tuning"`
+		// Let users pick full or split tunnel per config, with full_tunnel_mode as the default
+		AllowTunnelChoice bool `json:"allow_tunnel_choice"`
+	}
+
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	// At least one of hostname or public_ip is required, and both end up in client configs
+	hostname, publicIP, err := normalizeGatewayAddress(req.Hostname, req.PublicIP)
+	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-
-	// Validate that at least one of hostname or public_ip is provided
-	if req.Hostname == "" && req.PublicIP == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "either hostname or public_ip is required"})
-		return
-	}
+	req.Hostname, req.PublicIP = hostname, publicIP
 
 	// Default values
 	if req.VPNPort == 0 {
@@ -2798,7 +3451,7 @@ func (s *Server) handleRegisterGateway(c *gin.Context) {
 		req.VPNProtocol = "udp"
 	}
 	if req.CryptoProfile == "" {
-		req.CryptoProfile = db.CryptoProfileModern
+		req.CryptoProfile = stricterCryptoProfile(db.CryptoProfileModern, req.MinCryptoProfile)
 	}
 	if req.VPNSubnet == "" {
 		req.VPNSubnet = db.DefaultVPNSubnet
@@ -2806,6 +3459,33 @@ func (s *Server) handleRegisterGateway(c *gin.Context) {
 	if req.DNSServers == nil {
 		req.DNSServers = []string{}
 	}
+	if req.PushOptions == nil {
+		req.PushOptions = []string{}
+	}
+	if req.TLSMode == "" {
+		req.TLSMode = db.TLSModeAuth
+	}
+	if !isValidTLSMode(req.TLSMode) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid tls_mode: must be 'auth' or 'crypt'"})
+		return
+	}
+	if req.Compression == "" {
+		req.Compression = db.CompressionNone
+	}
+	for _, opt := range req.PushOptions {
+		if err := openvpn.ValidatePushOption(opt); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if err := validateListenEndpoints(req.VPNProtocol, req.VPNPort, req.VPNSubnet, req.AdditionalEndpoints); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateLinkTuning(req.LinkTuning, req.VPNProtocol, req.AdditionalEndpoints); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	// Validate crypto profile is valid
 	switch req.CryptoProfile {
 	case db.CryptoProfileModern, db.CryptoProfileFIPS, db.CryptoProfileCompatible:
@@ -2815,12 +3495,20 @@ func (s *Server) handleRegisterGateway(c *gin.Context) {
 		return
 	}
 
-	// Validate crypto profile is allowed by system settings
+	// Validate crypto profile is allowed by system settings and this gateway's minimum
 	ctx := c.Request.Context()
 	if err := s.validateCryptoProfileAllowed(ctx, req.CryptoProfile); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if err := s.validateGatewayCryptoProfiles(ctx, req.CryptoProfile, req.MinCryptoProfile); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := openvpn.ValidateCompression(req.Compression, req.CryptoProfile); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	// Generate authentication token
 	token, err := db.GenerateToken()
@@ -2857,10 +3545,19 @@ func (s *Server) handleRegisterGateway(c *gin.Context) {
 		CryptoProfile:  req.CryptoProfile,
 		VPNSubnet:      req.VPNSubnet,
 		TLSAuthEnabled: tlsAuthEnabled,
+		TLSMode:        req.TLSMode,
+		Compression:    req.Compression,
 		FullTunnelMode: fullTunnelMode,
 		PushDNS:        pushDNS,
 		DNSServers:     req.DNSServers,
+		PushOptions:    req.PushOptions,
 		Token:          token,
+
+		AdditionalEndpoints: req.AdditionalEndpoints,
+		EncryptClientKeys:   req.EncryptClientKeys != nil && *req.EncryptClientKeys,
+		MinCryptoProfile:    req.MinCryptoProfile,
+		LinkTuning:          req.LinkTuning,
+		AllowTunnelChoice:   req.AllowTunnelChoice,
 	}
 
 	if err := s.gatewayStore.CreateGateway(ctx, gateway); err != nil {
@@ -2881,24 +3578,37 @@ func (s *Server) handleRegisterGateway(c *gin.Context) {
 		return
 	}
 
+	s.recordAudit(c, "gateway.create", "gateway", createdGateway.ID, gin.H{"name": createdGateway.Name})
 	s.logger.Info("Gateway registered",
 		zap.String("name", req.Name),
 		zap.String("hostname", req.Hostname))
 
-	c.JSON(http.StatusCreated, gin.H{
-		"id":             createdGateway.ID,
-		"name":           createdGateway.Name,
-		"hostname":       createdGateway.Hostname,
-		"vpnPort":        createdGateway.VPNPort,
-		"vpnProtocol":    createdGateway.VPNProtocol,
-		"cryptoProfile":  createdGateway.CryptoProfile,
-		"tlsAuthEnabled": createdGateway.TLSAuthEnabled,
-		"fullTunnelMode": createdGateway.FullTunnelMode,
-		"pushDns":        createdGateway.PushDNS,
-		"dnsServers":     createdGateway.DNSServers,
-		"token":          token, // Only returned on creation
-		"message":        "Gateway registered successfully. Save the token - it will not be shown again.",
-	})
+	response := gin.H{
+		"id":                  createdGateway.ID,
+		"name":                createdGateway.Name,
+		"hostname":            createdGateway.Hostname,
+		"vpnPort":             createdGateway.VPNPort,
+		"vpnProtocol":         createdGateway.VPNProtocol,
+		"cryptoProfile":       createdGateway.CryptoProfile,
+		"minCryptoProfile":    createdGateway.MinCryptoProfile,
+		"tlsAuthEnabled":      createdGateway.TLSAuthEnabled,
+		"tlsMode":             createdGateway.TLSMode,
+		"compression":         createdGateway.Compression,
+		"encryptClientKeys":   createdGateway.EncryptClientKeys,
+		"fullTunnelMode":      createdGateway.FullTunnelMode,
+		"allowTunnelChoice":   createdGateway.AllowTunnelChoice,
+		"pushDns":             createdGateway.PushDNS,
+		"dnsServers":          createdGateway.DNSServers,
+		"pushOptions":         createdGateway.PushOptions,
+		"additionalEndpoints": createdGateway.AdditionalEndpoints,
+		"linkTuning":          createdGateway.LinkTuning,
+		"token":               token, // Only returned on creation
+		"message":             "Gateway registered successfully. Save the token - it will not be shown again.",
+	}
+	if warning := openvpn.CompressionWarning(createdGateway.Compression); warning != "" {
+		response["warning"] = warning
+	}
+	c.JSON(http.StatusCreated, response)
 }
 
 func (s *Server) handleDeleteGateway(c *gin.Context) {
@@ -2915,6 +3625,7 @@ func (s *Server) handleDeleteGateway(c *gin.Context) {
 		return
 	}
 
+	s.recordAudit(c, "gateway.delete", "gateway", gatewayID, nil)
 	s.logger.Info("Gateway deleted", zap.String("id", gatewayID))
 	c.JSON(http.StatusOK, gin.H{"message": "gateway deleted successfully"})
 }
@@ -2938,15 +3649,14 @@ func (s *Server) handleReprovisionGateway(c *gin.Context) {
 	}
 
 	// Generate a new config version to trigger reprovision on next heartbeat
-	// Using a UUID ensures it will never match the gateway's current version
-	newConfigVersion := fmt.Sprintf("reprovision-%d", time.Now().UnixNano())
-
-	if err := s.gatewayStore.UpdateGatewayConfigVersion(ctx, gatewayID, newConfigVersion); err != nil {
+	newConfigVersion, err := s.triggerGatewayReprovision(ctx, gatewayID)
+	if err != nil {
 		s.logger.Error("Failed to update gateway config version", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to trigger reprovision"})
 		return
 	}
 
+	s.recordAudit(c, "gateway.reprovision", "gateway", gatewayID, gin.H{"name": gateway.Name})
 	s.logger.Info("Gateway reprovision triggered",
 		zap.String("id", gatewayID),
 		zap.String("gateway", gateway.Name),
@@ -2958,33 +3668,96 @@ func (s *Server) handleReprovisionGateway(c *gin.Context) {
 	})
 }
 
+// gatewayUpdateRequest is the body of PUT /admin/gateways/:id and the settings in
+// a gateway's desired state. Optional fields left out keep their current values.
+type gatewayUpdateRequest struct {
+	Name           string   `json:"name" binding:"required"`
+	Hostname       string   `json:"hostname"`
+	PublicIP       string   `json:"public_ip"`
+	VPNPort        int      `json:"vpn_port"`
+	VPNProtocol    string   `json:"vpn_protocol"`
+	CryptoProfile  string   `json:"crypto_profile"`                // modern, fips, or compatible
+	VPNSubnet      string   `json:"vpn_subnet"`                    // VPN client subnet (e.g., "10.8.0.0/24")
+	TLSAuthEnabled *bool    `json:"tls_auth_enabled"`              // Enable TLS-Auth
+	TLSMode        string   `json:"tls_mode"`                      // auth or crypt
+	Compression    string   `json:"compression"`                   // none, lz4, or lzo
+	FullTunnelMode *bool    `json:"full_tunnel_mode"`              // Route all traffic through VPN
+	PushDNS        *bool    `json:"push_dns"`                      // Push DNS servers to clients
+	DNSServers     []string `json:"dns_servers" binding:"max=16"`  // DNS server IPs to push
+	PushOptions    []string `json:"push_options" binding:"max=32"` // Extra allowlisted push options
+	// Extra protocol/port listeners, e.g. TCP 443 fallback for networks that block UDP
+	AdditionalEndpoints []db.ListenEndpoint `json:"additional_endpoints" binding:"max=16"`
+	// Encrypt private keys in client configs with a passphrase shown once
+	EncryptClientKeys *bool `json:"encrypt_client_keys"`
+	// Weakest crypto profile this gateway may use; omit to keep the current one,
+	// or send "" to remove it
+	MinCryptoProfile *string `json:"min_crypto_profile"`
+	// Keepalive and MTU settings; omit to keep the current ones
+	LinkTuning *db.LinkTuning `json:"link_tuning"`
+	// Let users pick full or split tunnel per config; omit to keep the current setting
+	AllowTunnelChoice *bool `json:"allow_tunnel_choice"`
+}
+
 func (s *Server) handleUpdateGateway(c *gin.Context) {
 	gatewayID := c.Param("id")
 
-	var req struct {
-		Name           string   `json:"name" binding:"required"`
-		Hostname       string   `json:"hostname"`
-		PublicIP       string   `json:"public_ip"`
-		VPNPort        int      `json:"vpn_port"`
-		VPNProtocol    string   `json:"vpn_protocol"`
-		CryptoProfile  string   `json:"crypto_profile"`   // modern, fips, or compatible
-		VPNSubnet      string   `json:"vpn_subnet"`       // VPN client subnet (e.g., "10.8.0.0/24")
-		TLSAuthEnabled *bool    `json:"tls_auth_enabled"` // Enable TLS-Auth
-		FullTunnelMode *bool    `json:"full_tunnel_mode"` // Route all traffic through VPN
-		PushDNS        *bool    `json:"push_dns"`         // Push DNS servers to clients
-		DNSServers     []string `json:"dns_servers"`      // DNS server IPs to push
+	var req gatewayUpdateRequest
+	if !bindJSON(c, &req) {
+		return
 	}
 
-	if err := c.ShouldBindJSON(&req); err != nil {
+	// Get existing gateway to preserve settings that aren't specified
+	ctx := c.Request.Context()
+	existingGw, err := s.gatewayStore.GetGateway(ctx, gatewayID)
+	if err != nil {
+		if err == db.ErrGatewayNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "gateway not found"})
+			return
+		}
+		s.logger.Error("Failed to get gateway", zap.Error(err), zap.String("id", gatewayID))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get gateway"})
+		return
+	}
+
+	gw, err := s.buildGatewayUpdate(ctx, existingGw, req)
+	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Validate that at least one of hostname or public_ip is provided
-	if req.Hostname == "" && req.PublicIP == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "either hostname or public_ip is required"})
+	if err := s.gatewayStore.UpdateGateway(ctx, gw); err != nil {
+		if err == db.ErrGatewayNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "gateway not found"})
+			return
+		}
+		if err == db.ErrGatewayExists {
+			c.JSON(http.StatusConflict, gin.H{"error": "gateway with this name already exists"})
+			return
+		}
+		s.logger.Error("Failed to update gateway", zap.Error(err), zap.String("id", gatewayID))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update gateway"})
 		return
 	}
+	s.reprovisionAfterUpdate(ctx, existingGw, gw)
+
+	s.recordAudit(c, "gateway.update", "gateway", gatewayID, gin.H{"name": req.Name})
+	s.logger.Info("Gateway updated", zap.String("id", gatewayID), zap.String("name", req.Name))
+	response := gin.H{"message": "gateway updated successfully"}
+	if warning := openvpn.CompressionWarning(gw.Compression); warning != "" && gw.Compression != existingGw.Compression {
+		response["warning"] = warning
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// buildGatewayUpdate applies req to existingGw, keeping current values for what
+// req leaves out, and validates the result. Errors are meant for the client.
+func (s *Server) buildGatewayUpdate(ctx context.Context, existingGw *db.Gateway, req gatewayUpdateRequest) (*db.Gateway, error) {
+	// At least one of hostname or public_ip is required, and both end up in client configs
+	hostname, publicIP, err := normalizeGatewayAddress(req.Hostname, req.PublicIP)
+	if err != nil {
+		return nil, err
+	}
+	req.Hostname, req.PublicIP = hostname, publicIP
 
 	// Default values
 	if req.VPNPort == 0 {
@@ -2993,38 +3766,31 @@ func (s *Server) handleUpdateGateway(c *gin.Context) {
 	if req.VPNProtocol == "" {
 		req.VPNProtocol = "udp"
 	}
-	if req.CryptoProfile == "" {
-		req.CryptoProfile = db.CryptoProfileModern
-	}
 	if req.VPNSubnet == "" {
 		req.VPNSubnet = db.DefaultVPNSubnet
 	}
+
+	minCryptoProfile := existingGw.MinCryptoProfile
+	if req.MinCryptoProfile != nil {
+		minCryptoProfile = *req.MinCryptoProfile
+	}
+	if req.CryptoProfile == "" {
+		req.CryptoProfile = stricterCryptoProfile(db.CryptoProfileModern, minCryptoProfile)
+	}
 	// Validate crypto profile is valid
 	switch req.CryptoProfile {
 	case db.CryptoProfileModern, db.CryptoProfileFIPS, db.CryptoProfileCompatible:
 		// Valid
 	default:
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid crypto_profile: must be 'modern', 'fips', or 'compatible'"})
-		return
+		return nil, errors.New("invalid crypto_profile: must be 'modern', 'fips', or 'compatible'")
 	}
 
-	// Validate crypto profile is allowed by system settings
-	ctx := c.Request.Context()
+	// Validate crypto profile is allowed by system settings and this gateway's minimum
 	if err := s.validateCryptoProfileAllowed(ctx, req.CryptoProfile); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
+		return nil, err
 	}
-
-	// Get existing gateway to preserve TLSAuthEnabled if not specified
-	existingGw, err := s.gatewayStore.GetGateway(ctx, gatewayID)
-	if err != nil {
-		if err == db.ErrGatewayNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "gateway not found"})
-			return
-		}
-		s.logger.Error("Failed to get gateway", zap.Error(err), zap.String("id", gatewayID))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get gateway"})
-		return
+	if err := s.validateGatewayCryptoProfiles(ctx, req.CryptoProfile, minCryptoProfile); err != nil {
+		return nil, err
 	}
 
 	// Use existing TLSAuthEnabled if not specified in request
@@ -3033,12 +3799,44 @@ func (s *Server) handleUpdateGateway(c *gin.Context) {
 		tlsAuthEnabled = *req.TLSAuthEnabled
 	}
 
+	// Use existing TLSMode if not specified in request
+	tlsMode := existingGw.TLSMode
+	if req.TLSMode != "" {
+		if !isValidTLSMode(req.TLSMode) {
+			return nil, errors.New("invalid tls_mode: must be 'auth' or 'crypt'")
+		}
+		tlsMode = req.TLSMode
+	}
+
+	// Use existing Compression if not specified in request
+	compression := existingGw.Compression
+	if req.Compression != "" {
+		compression = req.Compression
+	}
+	if err := openvpn.ValidateCompression(compression, req.CryptoProfile); err != nil {
+		return nil, err
+	}
+
+	// Use existing EncryptClientKeys if not specified in request. This only affects
+	// newly generated client configs, so no reprovision is needed.
+	encryptClientKeys := existingGw.EncryptClientKeys
+	if req.EncryptClientKeys != nil {
+		encryptClientKeys = *req.EncryptClientKeys
+	}
+
 	// Use existing FullTunnelMode if not specified in request
 	fullTunnelMode := existingGw.FullTunnelMode
 	if req.FullTunnelMode != nil {
 		fullTunnelMode = *req.FullTunnelMode
 	}
 
+	// Use existing AllowTunnelChoice if not specified in request. Like the tunnel
+	// mode itself it's applied at connect, so no reprovision is needed.
+	allowTunnelChoice := existingGw.AllowTunnelChoice
+	if req.AllowTunnelChoice != nil {
+		allowTunnelChoice = *req.AllowTunnelChoice
+	}
+
 	// Use existing PushDNS if not specified in request
 	pushDNS := existingGw.PushDNS
 	if req.PushDNS != nil {
@@ -3051,8 +3849,38 @@ func (s *Server) handleUpdateGateway(c *gin.Context) {
 		dnsServers = req.DNSServers
 	}
 
-	gw := &db.Gateway{
-		ID:             gatewayID,
+	// Use request PushOptions if provided, otherwise keep existing
+	pushOptions := existingGw.PushOptions
+	if req.PushOptions != nil {
+		for _, opt := range req.PushOptions {
+			if err := openvpn.ValidatePushOption(opt); err != nil {
+				return nil, err
+			}
+		}
+		pushOptions = req.PushOptions
+	}
+
+	// Use request AdditionalEndpoints if provided, otherwise keep existing
+	additionalEndpoints := existingGw.AdditionalEndpoints
+	if req.AdditionalEndpoints != nil {
+		additionalEndpoints = req.AdditionalEndpoints
+	}
+	if err := validateListenEndpoints(req.VPNProtocol, req.VPNPort, req.VPNSubnet, additionalEndpoints); err != nil {
+		return nil, err
+	}
+
+	// Use request LinkTuning if provided, otherwise keep existing. It's checked
+	// either way, since fragment depends on the protocols the gateway listens on.
+	linkTuning := existingGw.LinkTuning
+	if req.LinkTuning != nil {
+		linkTuning = *req.LinkTuning
+	}
+	if err := validateLinkTuning(linkTuning, req.VPNProtocol, additionalEndpoints); err != nil {
+		return nil, err
+	}
+
+	return &db.Gateway{
+		ID:             existingGw.ID,
 		Name:           req.Name,
 		Hostname:       req.Hostname,
 		PublicIP:       req.PublicIP,
@@ -3061,27 +3889,61 @@ func (s *Server) handleUpdateGateway(c *gin.Context) {
 		CryptoProfile:  req.CryptoProfile,
 		VPNSubnet:      req.VPNSubnet,
 		TLSAuthEnabled: tlsAuthEnabled,
+		TLSMode:        tlsMode,
+		Compression:    compression,
 		FullTunnelMode: fullTunnelMode,
 		PushDNS:        pushDNS,
 		DNSServers:     dnsServers,
-	}
+		PushOptions:    pushOptions,
 
-	if err := s.gatewayStore.UpdateGateway(ctx, gw); err != nil {
-		if err == db.ErrGatewayNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "gateway not found"})
-			return
-		}
-		if err == db.ErrGatewayExists {
-			c.JSON(http.StatusConflict, gin.H{"error": "gateway with this name already exists"})
-			return
-		}
-		s.logger.Error("Failed to update gateway", zap.Error(err), zap.String("id", gatewayID))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update gateway"})
-		return
+		AdditionalEndpoints: additionalEndpoints,
+		EncryptClientKeys:   encryptClientKeys,
+		MinCryptoProfile:    minCryptoProfile,
+		LinkTuning:          linkTuning,
+		AllowTunnelChoice:   allowTunnelChoice,
+	}, nil
+}
+
+// needsReprovision returns why an update from existingGw to gw changed the
+// gateway's server config, or "" if it didn't:
+//   - endpoints: additional endpoints run as separate OpenVPN instances, which
+//     have to be created or removed
+//   - tlsmode: switching between tls-auth and tls-crypt rewrites server.conf and
+//     invalidates existing client configs
+//   - crypto: a new crypto profile, or a minimum that raises it, rewrites the
+//     cipher settings
+//   - compression: set in server.conf and in every client config, so clients
+//     need new configs to match
+//   - link: keepalive and MTU settings have to match on both ends, like
+//     compression
+func needsReprovision(existingGw, gw *db.Gateway) string {
+	switch {
+	case !reflect.DeepEqual(normalizeEndpoints(existingGw.AdditionalEndpoints), normalizeEndpoints(gw.AdditionalEndpoints)):
+		return "endpoints"
+	case gw.TLSMode != existingGw.TLSMode:
+		return "tlsmode"
+	case gatewayCryptoProfile(gw) != gatewayCryptoProfile(existingGw):
+		return "crypto"
+	case gw.Compression != existingGw.Compression:
+		return "compression"
+	case gw.LinkTuning != existingGw.LinkTuning:
+		return "link"
 	}
+	return ""
+}
 
-	s.logger.Info("Gateway updated", zap.String("id", gatewayID), zap.String("name", req.Name))
-	c.JSON(http.StatusOK, gin.H{"message": "gateway updated successfully"})
+// reprovisionAfterUpdate bumps a gateway's config version when an update changed
+// something in its server config, so it reprovisions on its next heartbeat.
+func (s *Server) reprovisionAfterUpdate(ctx context.Context, existingGw, gw *db.Gateway) {
+	reason := needsReprovision(existingGw, gw)
+	if reason == "" {
+		return
+	}
+	newConfigVersion := fmt.Sprintf("%s-%d", reason, time.Now().UnixNano())
+	if err := s.gatewayStore.UpdateGatewayConfigVersion(ctx, gw.ID, newConfigVersion); err != nil {
+		s.logger.Warn("Failed to bump config version after gateway update", zap.Error(err),
+			zap.String("id", gw.ID), zap.String("reason", reason))
+	}
 }
 
 func (s *Server) handleGetGatewayUsers(c *gin.Context) {
@@ -3115,38 +3977,45 @@ func (s *Server) handleAssignGatewayUser(c *gin.Context) {
 		UserID string `json:"user_id" binding:"required"`
 	}
 
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &req) {
 		return
 	}
 
 	ctx := c.Request.Context()
+	resolvedUserID := s.resolveGatewayUserID(ctx, req.UserID)
 
-	// Resolve email/username to actual user UUID
-	resolvedUserID := req.UserID
-	if strings.Contains(req.UserID, "@") {
-		// Looks like an email, try to find the user
-		if ssoUser, err := s.userStore.GetSSOUserByEmail(ctx, req.UserID); err == nil {
-			resolvedUserID = ssoUser.ID
-		} else if localUser, err := s.userStore.GetLocalUserByEmail(ctx, req.UserID); err == nil {
-			resolvedUserID = localUser.ID
-		}
-	} else {
-		// Try to find by username (for local users)
-		if localUser, err := s.userStore.GetLocalUserByUsername(ctx, req.UserID); err == nil {
-			resolvedUserID = localUser.ID
-		}
-		// If not found, assume it's already a UUID
-	}
-
-	if err := s.gatewayStore.AssignUserToGateway(ctx, resolvedUserID, gatewayID); err != nil {
+	created, err := s.gatewayStore.AssignUserToGateway(ctx, resolvedUserID, gatewayID)
+	if err != nil {
 		s.logger.Error("Failed to assign user to gateway", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to assign user to gateway"})
 		return
 	}
 
+	if created {
+		s.recordAudit(c, "gateway.assign_user", "gateway", gatewayID, gin.H{"userId": resolvedUserID})
+	}
 	s.logger.Info("User assigned to gateway", zap.String("userId", resolvedUserID), zap.String("gatewayId", gatewayID))
-	c.JSON(http.StatusOK, gin.H{"message": "user assigned to gateway"})
+	c.JSON(http.StatusOK, gin.H{"message": "user assigned to gateway", "created": created})
+}
+
+// resolveGatewayUserID resolves an email or local username to the user's ID.
+// Anything else is assumed to be an ID already.
+func (s *Server) resolveGatewayUserID(ctx context.Context, ref string) string {
+	if strings.Contains(ref, "@") {
+		// Looks like an email, try to find the user
+		if ssoUser, err := s.userStore.GetSSOUserByEmail(ctx, ref); err == nil {
+			return ssoUser.ID
+		} else if localUser, err := s.userStore.GetLocalUserByEmail(ctx, ref); err == nil {
+			return localUser.ID
+		}
+		return ref
+	}
+	// Try to find by username (for local users)
+	if localUser, err := s.userStore.GetLocalUserByUsername(ctx, ref); err == nil {
+		return localUser.ID
+	}
+	// If not found, assume it's already a UUID
+	return ref
 }
 
 func (s *Server) handleRemoveGatewayUser(c *gin.Context) {
@@ -3160,6 +4029,7 @@ func (s *Server) handleRemoveGatewayUser(c *gin.Context) {
 		return
 	}
 
+	s.recordAudit(c, "gateway.unassign_user", "gateway", gatewayID, gin.H{"userId": userID})
 	s.logger.Info("User removed from gateway", zap.String("userId", userID), zap.String("gatewayId", gatewayID))
 	c.JSON(http.StatusOK, gin.H{"message": "user removed from gateway"})
 }
@@ -3193,20 +4063,23 @@ func (s *Server) handleAssignGatewayGroup(c *gin.Context) {
 		GroupName string `json:"group_name" binding:"required"`
 	}
 
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &req) {
 		return
 	}
 
 	ctx := c.Request.Context()
-	if err := s.gatewayStore.AssignGroupToGateway(ctx, req.GroupName, gatewayID); err != nil {
+	created, err := s.gatewayStore.AssignGroupToGateway(ctx, req.GroupName, gatewayID)
+	if err != nil {
 		s.logger.Error("Failed to assign group to gateway", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to assign group to gateway"})
 		return
 	}
 
+	if created {
+		s.recordAudit(c, "gateway.assign_group", "gateway", gatewayID, gin.H{"group": req.GroupName})
+	}
 	s.logger.Info("Group assigned to gateway", zap.String("groupName", req.GroupName), zap.String("gatewayId", gatewayID))
-	c.JSON(http.StatusOK, gin.H{"message": "group assigned to gateway"})
+	c.JSON(http.StatusOK, gin.H{"message": "group assigned to gateway", "created": created})
 }
 
 func (s *Server) handleRemoveGatewayGroup(c *gin.Context) {
@@ -3220,18 +4093,64 @@ func (s *Server) handleRemoveGatewayGroup(c *gin.Context) {
 		return
 	}
 
+	s.recordAudit(c, "gateway.unassign_group", "gateway", gatewayID, gin.H{"group": groupName})
 	s.logger.Info("Group removed from gateway", zap.String("groupName", groupName), zap.String("gatewayId", gatewayID))
 	c.JSON(http.StatusOK, gin.H{"message": "group removed from gateway"})
 }
 
 func (s *Server) handleListConnections(c *gin.Context) {
-	// TODO: List all active connections
-	c.JSON(http.StatusNotImplemented, gin.H{"error": "list connections not yet implemented"})
-}
+	filter := connectionFilterFromQuery(c)
+	filter.Limit = 50
+	if limitStr := c.Query("limit"); limitStr != "" {
+		if limit, err := strconv.Atoi(limitStr); err == nil && limit > 0 && limit <= 100 {
+			filter.Limit = limit
+		}
+	}
+	if offsetStr := c.Query("offset"); offsetStr != "" {
+		if offset, err := strconv.Atoi(offsetStr); err == nil && offset >= 0 {
+			filter.Offset = offset
+		}
+	}
+
+	connections, total, err := s.connectionStore.List(c.Request.Context(), filter)
+	if err != nil {
+		s.logger.Error("Failed to list connections", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list connections"})
+		return
+	}
+
+	now := time.Now()
+	result := make([]gin.H, 0, len(connections))
+	for _, conn := range connections {
+		item := gin.H{
+			"id":              conn.ID,
+			"userId":          conn.UserID,
+			"userEmail":       conn.UserEmail,
+			"gatewayId":       conn.GatewayID,
+			"gatewayName":     conn.GatewayName,
+			"vpnIp":           conn.VPNIPv4,
+			"sourceIp":        conn.ClientIP,
+			"connectedAt":     conn.ConnectedAt.Format(time.RFC3339),
+			"durationSeconds": int64(conn.Duration(now).Seconds()),
+			"bytesSent":       conn.BytesSent,
+			"bytesReceived":   conn.BytesReceived,
+			"active":          conn.DisconnectedAt == nil,
+		}
+		if conn.TunnelMode != "" {
+			item["tunnelMode"] = conn.TunnelMode
+		}
+		if conn.DisconnectedAt != nil {
+			item["disconnectedAt"] = conn.DisconnectedAt.Format(time.RFC3339)
+		}
+		result = append(result, item)
+	}
 
-func (s *Server) handleGetAuditLogs(c *gin.Context) {
-	// TODO: Get audit logs
-	c.JSON(http.StatusNotImplemented, gin.H{"error": "get audit logs not yet implemented"})
+	c.JSON(http.StatusOK, gin.H{
+		"connections": result,
+		"total":       total,
+		"limit":       filter.Limit,
+		"offset":      filter.Offset,
+	})
 }
 
 // Network handlers
@@ -3267,8 +4186,7 @@ func (s *Server) handleCreateNetwork(c *gin.Context) {
 		CIDR        string `json:"cidr" binding:"required"`
 		IsActive    *bool  `json:"is_active"`
 	}
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &req) {
 		return
 	}
 
@@ -3338,8 +4256,7 @@ func (s *Server) handleUpdateNetwork(c *gin.Context) {
 		CIDR        string `json:"cidr" binding:"required"`
 		IsActive    *bool  `json:"is_active"`
 	}
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &req) {
 		return
 	}
 
@@ -3476,18 +4393,18 @@ func (s *Server) handleAssignGatewayNetwork(c *gin.Context) {
 	var req struct {
 		NetworkID string `json:"network_id" binding:"required"`
 	}
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &req) {
 		return
 	}
 
 	ctx := c.Request.Context()
-	if err := s.networkStore.AssignGatewayToNetwork(ctx, gatewayID, req.NetworkID); err != nil {
+	created, err := s.networkStore.AssignGatewayToNetwork(ctx, gatewayID, req.NetworkID)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to assign gateway to network"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "gateway assigned to network"})
+	c.JSON(http.StatusOK, gin.H{"message": "gateway assigned to network", "created": created})
 }
 
 func (s *Server) handleRemoveGatewayNetwork(c *gin.Context) {
@@ -3522,6 +4439,7 @@ func (s *Server) handleListAccessRules(c *gin.Context) {
 			"description": r.Description,
 			"ruleType":    r.RuleType,
 			"value":       r.Value,
+			"pushOptions": r.PushOptions,
 			"isActive":    r.IsActive,
 			"createdAt":   r.CreatedAt.Format(time.RFC3339),
 			"updatedAt":   r.UpdatedAt.Format(time.RFC3339),
@@ -3542,17 +4460,17 @@ func (s *Server) handleListAccessRules(c *gin.Context) {
 
 func (s *Server) handleCreateAccessRule(c *gin.Context) {
 	var req struct {
-		Name        string  `json:"name" binding:"required"`
-		Description string  `json:"description"`
-		RuleType    string  `json:"rule_type" binding:"required"`
-		Value       string  `json:"value" binding:"required"`
-		PortRange   *string `json:"port_range"`
-		Protocol    *string `json:"protocol"`
-		NetworkID   *string `json:"network_id"`
-		IsActive    *bool   `json:"is_active"`
+		Name        string   `json:"name" binding:"required"`
+		Description string   `json:"description"`
+		RuleType    string   `json:"rule_type" binding:"required"`
+		Value       string   `json:"value" binding:"required"`
+		PortRange   *string  `json:"port_range"`
+		Protocol    *string  `json:"protocol"`
+		NetworkID   *string  `json:"network_id"`
+		PushOptions []string `json:"push_options" binding:"max=32"` // Extra allowlisted push options
+		IsActive    *bool    `json:"is_active"`
 	}
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &req) {
 		return
 	}
 
@@ -3563,6 +4481,22 @@ func (s *Server) handleCreateAccessRule(c *gin.Context) {
 		return
 	}
 
+	// Validate value, port range, and protocol
+	if err := validateAccessRuleValue(db.AccessRuleType(req.RuleType), req.Value); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validatePortAndProtocol(req.PortRange, req.Protocol); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	for _, opt := range req.PushOptions {
+		if err := openvpn.ValidatePushOption(opt); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
 	isActive := true
 	if req.IsActive != nil {
 		isActive = *req.IsActive
@@ -3576,6 +4510,7 @@ func (s *Server) handleCreateAccessRule(c *gin.Context) {
 		PortRange:   req.PortRange,
 		Protocol:    req.Protocol,
 		NetworkID:   req.NetworkID,
+		PushOptions: req.PushOptions,
 		IsActive:    isActive,
 	}
 
@@ -3586,6 +4521,7 @@ func (s *Server) handleCreateAccessRule(c *gin.Context) {
 		return
 	}
 
+	s.recordAudit(c, "access_rule.create", "access_rule", rule.ID, gin.H{"name": rule.Name, "ruleType": rule.RuleType, "value": rule.Value, "pushOptions": rule.PushOptions})
 	c.JSON(http.StatusCreated, gin.H{
 		"id":        rule.ID,
 		"name":      rule.Name,
@@ -3620,6 +4556,7 @@ func (s *Server) handleGetAccessRule(c *gin.Context) {
 		"description": rule.Description,
 		"ruleType":    rule.RuleType,
 		"value":       rule.Value,
+		"pushOptions": rule.PushOptions,
 		"isActive":    rule.IsActive,
 		"createdAt":   rule.CreatedAt.Format(time.RFC3339),
 		"updatedAt":   rule.UpdatedAt.Format(time.RFC3339),
@@ -3641,19 +4578,35 @@ func (s *Server) handleGetAccessRule(c *gin.Context) {
 func (s *Server) handleUpdateAccessRule(c *gin.Context) {
 	id := c.Param("id")
 	var req struct {
-		Name        string  `json:"name" binding:"required"`
-		Description string  `json:"description"`
-		RuleType    string  `json:"rule_type" binding:"required"`
-		Value       string  `json:"value" binding:"required"`
-		PortRange   *string `json:"port_range"`
-		Protocol    *string `json:"protocol"`
-		NetworkID   *string `json:"network_id"`
-		IsActive    *bool   `json:"is_active"`
+		Name        string   `json:"name" binding:"required"`
+		Description string   `json:"description"`
+		RuleType    string   `json:"rule_type" binding:"required"`
+		Value       string   `json:"value" binding:"required"`
+		PortRange   *string  `json:"port_range"`
+		Protocol    *string  `json:"protocol"`
+		NetworkID   *string  `json:"network_id"`
+		PushOptions []string `json:"push_options" binding:"max=32"` // Extra allowlisted push options
+		IsActive    *bool    `json:"is_active"`
 	}
-	if err := c.ShouldBindJSON(&req); err != nil {
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	// Validate rule type, value, port range, and protocol
+	if err := validateAccessRuleValue(db.AccessRuleType(req.RuleType), req.Value); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if err := validatePortAndProtocol(req.PortRange, req.Protocol); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	for _, opt := range req.PushOptions {
+		if err := openvpn.ValidatePushOption(opt); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
 
 	ctx := c.Request.Context()
 	rule, err := s.accessRuleStore.GetAccessRule(ctx, id)
@@ -3673,6 +4626,10 @@ func (s *Server) handleUpdateAccessRule(c *gin.Context) {
 	rule.PortRange = req.PortRange
 	rule.Protocol = req.Protocol
 	rule.NetworkID = req.NetworkID
+	// Keep the rule's push options unless the request sets them
+	if req.PushOptions != nil {
+		rule.PushOptions = req.PushOptions
+	}
 	if req.IsActive != nil {
 		rule.IsActive = *req.IsActive
 	}
@@ -3682,6 +4639,8 @@ func (s *Server) handleUpdateAccessRule(c *gin.Context) {
 		return
 	}
 
+	s.recordAudit(c, "access_rule.update", "access_rule", id, gin.H{"name": rule.Name, "ruleType": rule.RuleType, "value": rule.Value, "pushOptions": rule.PushOptions, "isActive": rule.IsActive})
+
 	c.JSON(http.StatusOK, gin.H{"message": "access rule updated successfully"})
 }
 
@@ -3698,6 +4657,8 @@ func (s *Server) handleDeleteAccessRule(c *gin.Context) {
 		return
 	}
 
+	s.recordAudit(c, "access_rule.delete", "access_rule", id, nil)
+
 	c.JSON(http.StatusOK, gin.H{"message": "access rule deleted successfully"})
 }
 
@@ -3706,18 +4667,21 @@ func (s *Server) handleAssignRuleToUser(c *gin.Context) {
 	var req struct {
 		UserID string `json:"user_id" binding:"required"`
 	}
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &req) {
 		return
 	}
 
 	ctx := c.Request.Context()
-	if err := s.accessRuleStore.AssignRuleToUser(ctx, req.UserID, ruleID); err != nil {
+	created, err := s.accessRuleStore.AssignRuleToUser(ctx, req.UserID, ruleID)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to assign rule to user"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "rule assigned to user"})
+	if created {
+		s.recordAudit(c, "access_rule.assign_user", "access_rule", ruleID, gin.H{"userId": req.UserID})
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "rule assigned to user", "created": created})
 }
 
 func (s *Server) handleRemoveRuleFromUser(c *gin.Context) {
@@ -3730,6 +4694,7 @@ func (s *Server) handleRemoveRuleFromUser(c *gin.Context) {
 		return
 	}
 
+	s.recordAudit(c, "access_rule.unassign_user", "access_rule", ruleID, gin.H{"userId": userID})
 	c.JSON(http.StatusOK, gin.H{"message": "rule removed from user"})
 }
 
@@ -3738,18 +4703,21 @@ func (s *Server) handleAssignRuleToGroup(c *gin.Context) {
 	var req struct {
 		GroupName string `json:"group_name" binding:"required"`
 	}
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &req) {
 		return
 	}
 
 	ctx := c.Request.Context()
-	if err := s.accessRuleStore.AssignRuleToGroup(ctx, req.GroupName, ruleID); err != nil {
+	created, err := s.accessRuleStore.AssignRuleToGroup(ctx, req.GroupName, ruleID)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to assign rule to group"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "rule assigned to group"})
+	if created {
+		s.recordAudit(c, "access_rule.assign_group", "access_rule", ruleID, gin.H{"group": req.GroupName})
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "rule assigned to group", "created": created})
 }
 
 func (s *Server) handleRemoveRuleFromGroup(c *gin.Context) {
@@ -3762,6 +4730,7 @@ func (s *Server) handleRemoveRuleFromGroup(c *gin.Context) {
 		return
 	}
 
+	s.recordAudit(c, "access_rule.unassign_group", "access_rule", ruleID, gin.H{"group": groupName})
 	c.JSON(http.StatusOK, gin.H{"message": "rule removed from group"})
 }
 
@@ -3769,7 +4738,10 @@ func (s *Server) handleRemoveRuleFromGroup(c *gin.Context) {
 
 func (s *Server) handleMetrics(c *gin.Context) {
 	// TODO: Implement Prometheus metrics
-	c.String(http.StatusOK, "# HELP gatekey_info GateKey server info\n# TYPE gatekey_info gauge\ngatekey_info{version=\"0.1.0\"} 1\n")
+	var sb strings.Builder
+	sb.WriteString("# HELP gatekey_info GateKey server info\n# TYPE gatekey_info gauge\ngatekey_info{version=\"0.1.0\"} 1\n")
+	s.writeNotificationMetrics(c.Request.Context(), &sb)
+	c.String(http.StatusOK, sb.String())
 }
 
 // Server info handler - returns server requirements for clients
@@ -3811,20 +4783,23 @@ func (s *Server) handleUpdateSettings(c *gin.Context) {
 	ctx := c.Request.Context()
 
 	var req map[string]string
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+	if !bindJSON(c, &req) {
 		return
 	}
 
 	// Validate allowed settings
 	allowedSettings := map[string]bool{
-		db.SettingSessionDurationHours:  true,
-		db.SettingSecureCookies:         true,
-		db.SettingVPNCertValidityHours:  true,
-		db.SettingRequireFIPS:           true,
-		db.SettingAllowedCryptoProfiles: true,
-		db.SettingMinTLSVersion:         true,
-		db.SettingAllowedCiphers:        true,
+		db.SettingSessionDurationHours:     true,
+		db.SettingSecureCookies:            true,
+		db.SettingVPNCertValidityHours:     true,
+		db.SettingRequireFIPS:              true,
+		db.SettingAllowedCryptoProfiles:    true,
+		db.SettingMinTLSVersion:            true,
+		db.SettingAllowedCiphers:           true,
+		db.SettingAuthTokenLifetimeMinutes: true,
+		db.SettingLocalAuthEnabled:         true,
+		db.SettingAdminAllowedCIDRs:        true,
+		db.SettingConnectMessage:           true,
 	}
 
 	for key, value := range req {
@@ -3832,6 +4807,31 @@ func (s *Server) handleUpdateSettings(c *gin.Context) {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid setting key: " + key})
 			return
 		}
+		if key == db.SettingAuthTokenLifetimeMinutes {
+			if minutes, err := strconv.Atoi(value); err != nil || minutes < 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "auth_token_lifetime_minutes must be a non-negative integer"})
+				return
+			}
+		}
+		if key == db.SettingLocalAuthEnabled {
+			if err := s.checkLocalAuthSetting(ctx, value); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		if key == db.SettingAdminAllowedCIDRs {
+			if err := s.checkAdminAllowlistSetting(c, value); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		if key == db.SettingConnectMessage && utf8.RuneCountInString(value) > maxConnectMessageLength {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("connect_message must be at most %d characters", maxConnectMessageLength)})
+			return
+		}
+	}
+
+	for key, value := range req {
 		if err := s.settingsStore.Set(ctx, key, value); err != nil {
 			s.logger.Error("Failed to update setting", zap.String("key", key), zap.Error(err))
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update setting"})
@@ -3839,6 +4839,18 @@ func (s *Server) handleUpdateSettings(c *gin.Context) {
 		}
 	}
 
+	if _, ok := req[db.SettingAdminAllowedCIDRs]; ok {
+		s.adminNetworks.invalidate()
+	}
+
+	// The auth-gen-token lifetime is written into gateway server configs
+	_, lifetimeChanged := req[db.SettingAuthTokenLifetimeMinutes]
+	_, validityChanged := req[db.SettingVPNCertValidityHours]
+	if lifetimeChanged || validityChanged {
+		s.bumpAllGatewayConfigVersions(ctx, "authtoken")
+	}
+
+	s.recordAudit(c, "settings.update", "settings", "", gin.H{"settings": req})
 	s.logger.Info("Settings updated", zap.Any("settings", req))
 	c.JSON(http.StatusOK, gin.H{"message": "settings updated"})
 }
@@ -3932,6 +4944,8 @@ func (s *Server) handleMeshSpokeGenericInstallScript(c *gin.Context) {
 
 func (s *Server) handleDownloadBinary(c *gin.Context) {
 	filename := c.Param("filename")
+	// <binary>.sha256 serves the binary's checksum
+	filename, checksumOnly := strings.CutSuffix(filename, ".sha256")
 
 	// Map filename to GitHub release asset
 	allowedBinaries := map[string]bool{
@@ -3990,31 +5004,23 @@ func (s *Server) handleDownloadBinary(c *gin.Context) {
 
 	for _, binPath := range binPaths {
 		if _, err := os.Stat(binPath); err == nil {
-			c.Header("Content-Type", "application/octet-stream")
-			c.Header("Content-Disposition", "attachment; filename="+filename)
-			c.File(binPath)
+			if checksumOnly {
+				s.serveBinaryChecksum(c, binPath, filename)
+			} else {
+				s.serveBinary(c, binPath, filename)
+			}
 			return
 		}
 	}
 
 	// Redirect to GitHub releases for production deployments
-	githubReleasesURL := "https://github.com/dye-tech/GateKey/releases/latest/download/" + filename
+	githubReleasesURL := "https://github.com/dye-tech/GateKey/releases/latest/download/" + c.Param("filename")
 	c.Redirect(http.StatusTemporaryRedirect, githubReleasesURL)
 }
 
 func (s *Server) handleDownloadsPage(c *gin.Context) {
 	// Return a simple HTML page listing available downloads
-	serverURL := c.Request.Host
-	// Check X-Forwarded-Proto header first (for reverse proxy/Istio)
-	protocol := c.GetHeader("X-Forwarded-Proto")
-	if protocol == "" {
-		if c.Request.TLS != nil {
-			protocol = "https"
-		} else {
-			protocol = "http"
-		}
-	}
-	baseURL := protocol + "://" + serverURL
+	baseURL := s.baseURL(c)
 
 	html := `<!DOCTYPE html>
 <html>
@@ -4073,23 +5079,14 @@ func (s *Server) handleDownloadsPage(c *gin.Context) {
 }
 
 func (s *Server) handleClientInstallScript(c *gin.Context) {
-	serverURL := c.Request.Host
-	// Check X-Forwarded-Proto header first (for reverse proxy/Istio)
-	protocol := c.GetHeader("X-Forwarded-Proto")
-	if protocol == "" {
-		if c.Request.TLS != nil {
-			protocol = "https"
-		} else {
-			protocol = "http"
-		}
-	}
+	baseURL := s.baseURL(c)
 
 	script := `#!/bin/bash
 # GateKey Client Installer
 # This script installs the GateKey VPN client.
 #
 # Usage:
-#   curl -sSL ` + protocol + `://` + serverURL + `/scripts/install-client.sh | bash
+#   curl -sSL ` + baseURL + `/scripts/install-client.sh | bash
 
 set -e
 
@@ -4099,7 +5096,7 @@ GREEN='\033[0;32m'
 YELLOW='\033[1;33m'
 NC='\033[0m' # No Color
 
-GATEKEY_SERVER="` + protocol + `://` + serverURL + `"
+GATEKEY_SERVER="` + baseURL + `"
 INSTALL_DIR="/usr/local/bin"
 
 echo -e "${GREEN}GateKey Client Installer${NC}"
@@ -4141,9 +5138,11 @@ echo ""
 
 # Check for curl or wget
 if command -v curl &> /dev/null; then
-    DOWNLOADER="curl -fsSL -o"
+    DOWNLOADER="curl -fsSL --retry 5 -C - -o"
+    FETCH="curl -fsSL"
 elif command -v wget &> /dev/null; then
-    DOWNLOADER="wget -q -O"
+    DOWNLOADER="wget -q --tries=5 -O"
+    FETCH="wget -qO-"
 else
     echo -e "${RED}Error: Neither curl nor wget found. Please install one of them.${NC}"
     exit 1
@@ -4161,6 +5160,20 @@ if [ ! -s "$TMP_FILE" ]; then
     exit 1
 fi
 
+# Verify the checksum when the server publishes one
+EXPECTED_SUM=$($FETCH "${DOWNLOAD_URL}.sha256" 2>/dev/null | awk '{print $1}')
+if [ -n "$EXPECTED_SUM" ]; then
+    if command -v sha256sum &> /dev/null; then
+        ACTUAL_SUM=$(sha256sum "$TMP_FILE" | awk '{print $1}')
+    else
+        ACTUAL_SUM=$(shasum -a 256 "$TMP_FILE" | awk '{print $1}')
+    fi
+    if [ "$ACTUAL_SUM" != "$EXPECTED_SUM" ]; then
+        echo -e "${RED}Error: Checksum mismatch; the download is corrupt${NC}"
+        exit 1
+    fi
+fi
+
 # Install binary
 echo -e "${YELLOW}Installing to $INSTALL_DIR/gatekey...${NC}"
 if [ -w "$INSTALL_DIR" ]; then
@@ -4273,22 +5286,52 @@ func (s *Server) handleGetUserAccessRules(c *gin.Context) {
 		return
 	}
 
+	// Grants the user's exceptions take away, so admins can see why a rule a
+	// group has is missing
+	excluded, err := s.accessRuleStore.GetUserExcludedAccessRules(ctx, userID, user.Groups)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get user access rules"})
+		return
+	}
+	exceptions, err := s.accessRuleStore.ListUserAccessExceptions(ctx, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get user access exceptions"})
+		return
+	}
+
+	ruleJSON := func(r *db.AccessRule) gin.H {
+		return gin.H{
+			"id":           r.ID,
+			"name":         r.Name,
+			"description":  r.Description,
+			"rule_type":    r.RuleType,
+			"value":        r.Value,
+			"port_range":   r.PortRange,
+			"protocol":     r.Protocol,
+			"network_id":   r.NetworkID,
+			"push_options": r.PushOptions,
+			"is_active":    r.IsActive,
+			"except":       r.Except,
+		}
+	}
 	response := make([]gin.H, 0, len(rules))
 	for _, r := range rules {
-		response = append(response, gin.H{
-			"id":          r.ID,
-			"name":        r.Name,
-			"description": r.Description,
-			"rule_type":   r.RuleType,
-			"value":       r.Value,
-			"port_range":  r.PortRange,
-			"protocol":    r.Protocol,
-			"network_id":  r.NetworkID,
-			"is_active":   r.IsActive,
-		})
+		response = append(response, ruleJSON(r))
+	}
+	excludedResponse := make([]gin.H, 0, len(excluded))
+	for _, r := range excluded {
+		excludedResponse = append(excludedResponse, ruleJSON(r))
+	}
+	exceptionsResponse := make([]gin.H, 0, len(exceptions))
+	for _, e := range exceptions {
+		exceptionsResponse = append(exceptionsResponse, accessExceptionJSON(e))
 	}
 
-	c.JSON(http.StatusOK, gin.H{"access_rules": response})
+	c.JSON(http.StatusOK, gin.H{
+		"access_rules":   response,
+		"excluded_rules": excludedResponse,
+		"exceptions":     exceptionsResponse,
+	})
 }
 
 func (s *Server) handleGetUserGateways(c *gin.Context) {
@@ -4324,18 +5367,18 @@ func (s *Server) handleAssignUserGateway(c *gin.Context) {
 		GatewayID string `json:"gateway_id" binding:"required"`
 	}
 
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &req) {
 		return
 	}
 
 	ctx := c.Request.Context()
-	if err := s.gatewayStore.AssignUserToGateway(ctx, userID, req.GatewayID); err != nil {
+	created, err := s.gatewayStore.AssignUserToGateway(ctx, userID, req.GatewayID)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to assign gateway"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "gateway assigned successfully"})
+	c.JSON(http.StatusOK, gin.H{"message": "gateway assigned successfully", "created": created})
 }
 
 func (s *Server) handleRemoveUserGateway(c *gin.Context) {
@@ -4362,12 +5405,13 @@ func (s *Server) handleListLocalUsers(c *gin.Context) {
 	response := make([]gin.H, 0, len(users))
 	for _, u := range users {
 		response = append(response, gin.H{
-			"id":            u.ID,
-			"username":      u.Username,
-			"email":         u.Email,
-			"is_admin":      u.IsAdmin,
-			"last_login_at": u.LastLoginAt,
-			"created_at":    u.CreatedAt,
+			"id":             u.ID,
+			"username":       u.Username,
+			"email":          u.Email,
+			"is_admin":       u.IsAdmin,
+			"last_login_at":  u.LastLoginAt,
+			"created_at":     u.CreatedAt,
+			"deactivated_at": u.DeactivatedAt,
 		})
 	}
 
@@ -4382,8 +5426,7 @@ func (s *Server) handleCreateLocalUser(c *gin.Context) {
 		IsAdmin  bool   `json:"is_admin"`
 	}
 
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &req) {
 		return
 	}
 
@@ -4429,6 +5472,7 @@ func (s *Server) handleDeleteLocalUser(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete user"})
 		return
 	}
+	s.noteRevocation(ctx)
 
 	c.JSON(http.StatusOK, gin.H{"message": "user deleted successfully"})
 }
@@ -4443,14 +5487,28 @@ func (s *Server) handleListGroups(c *gin.Context) {
 		return
 	}
 
+	limits, err := s.userStore.ListGroupConnectionLimits(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list groups"})
+		return
+	}
+	maxUsers := make(map[string]int, len(limits))
+	for _, l := range limits {
+		maxUsers[l.GroupName] = l.MaxUsers
+	}
+
 	// For each group, get member count
 	response := make([]gin.H, 0, len(groups))
 	for _, g := range groups {
 		members, _ := s.userStore.GetGroupMembers(ctx, g)
-		response = append(response, gin.H{
+		group := gin.H{
 			"name":         g,
 			"member_count": len(members),
-		})
+		}
+		if limit, ok := maxUsers[g]; ok {
+			group["connection_limit"] = limit
+		}
+		response = append(response, group)
 	}
 
 	c.JSON(http.StatusOK, gin.H{"groups": response})
@@ -4523,6 +5581,106 @@ func (s *Server) handleGetGroupAccessRules(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"access_rules": response, "group": groupName})
 }
 
+// handleAssignGroupAccessRules assigns several access rules to a group at once.
+// Either every rule is assigned or, if one doesn't exist, none are, so
+// automation that re-applies the same list never leaves it half done.
+func (s *Server) handleAssignGroupAccessRules(c *gin.Context) {
+	groupName := c.Param("name")
+	var req struct {
+		RuleIDs []string `json:"rule_ids" binding:"required,max=1000"`
+	}
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	created, err := s.accessRuleStore.AssignRulesToGroup(c.Request.Context(), groupName, req.RuleIDs)
+	if err != nil {
+		if err == db.ErrAccessRuleNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "access rule not found; no rules were assigned"})
+			return
+		}
+		s.logger.Error("Failed to assign rules to group", zap.String("group", groupName), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to assign rules to group"})
+		return
+	}
+
+	for _, ruleID := range created {
+		s.recordAudit(c, "access_rule.assign_group", "access_rule", ruleID, gin.H{"group": groupName})
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"group":    groupName,
+		"created":  created,
+		"existing": len(req.RuleIDs) - len(created),
+	})
+}
+
+func (s *Server) handleGetGroupConnectionLimit(c *gin.Context) {
+	groupName := c.Param("name")
+	ctx := c.Request.Context()
+
+	limits, err := s.userStore.GetGroupConnectionLimits(ctx, []string{groupName})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get group connection limit"})
+		return
+	}
+	if len(limits) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "group has no connection limit"})
+		return
+	}
+	connected, err := s.userStore.CountConnectedGroupUsers(ctx, groupName, "")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to count connected users"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"group":           groupName,
+		"max_users":       limits[0].MaxUsers,
+		"connected_users": connected,
+		"updated_at":      limits[0].UpdatedAt,
+	})
+}
+
+func (s *Server) handleSetGroupConnectionLimit(c *gin.Context) {
+	groupName := c.Param("name")
+	var req struct {
+		MaxUsers int `json:"max_users" binding:"required,min=1"`
+	}
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	limit, err := s.userStore.SetGroupConnectionLimit(c.Request.Context(), groupName, req.MaxUsers)
+	if err != nil {
+		s.logger.Error("Failed to set group connection limit", zap.String("group", groupName), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to set group connection limit"})
+		return
+	}
+
+	s.recordAudit(c, "group.set_connection_limit", "group", "", gin.H{"group": groupName, "max_users": req.MaxUsers})
+	c.JSON(http.StatusOK, gin.H{
+		"group":      groupName,
+		"max_users":  limit.MaxUsers,
+		"updated_at": limit.UpdatedAt,
+	})
+}
+
+func (s *Server) handleDeleteGroupConnectionLimit(c *gin.Context) {
+	groupName := c.Param("name")
+	if err := s.userStore.DeleteGroupConnectionLimit(c.Request.Context(), groupName); err != nil {
+		if err == db.ErrGroupLimitNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "group has no connection limit"})
+			return
+		}
+		s.logger.Error("Failed to delete group connection limit", zap.String("group", groupName), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete group connection limit"})
+		return
+	}
+
+	s.recordAudit(c, "group.delete_connection_limit", "group", "", gin.H{"group": groupName})
+	c.JSON(http.StatusOK, gin.H{"message": "group connection limit removed"})
+}
+
 // CA management handlers
 
 func (s *Server) handleGetCA(c *gin.Context) {
@@ -4600,8 +5758,7 @@ func (s *Server) handleUpdateCA(c *gin.Context) {
 		PrivateKey  string `json:"private_key" binding:"required"`
 	}
 
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request: certificate and private_key required"})
+	if !bindJSON(c, &req) {
 		return
 	}
 
@@ -4807,6 +5964,24 @@ func (s *Server) handleRevokeCA(c *gin.Context) {
 		return
 	}
 
+	// Components still provisioned with the CA would lose connectivity; see
+	// GET /admin/reprovision/progress for which ones
+	if c.Query("force") != "true" {
+		inUse, err := s.provisioningStore.CountProvisionedWithCA(ctx, ca.Fingerprint)
+		if err != nil {
+			s.logger.Error("Failed to count components using CA", zap.Error(err), zap.String("ca_id", caID))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check CA usage"})
+			return
+		}
+		if inUse > 0 {
+			c.JSON(http.StatusConflict, gin.H{
+				"error":            fmt.Sprintf("%d gateways/hubs/spokes are still provisioned with this CA - reprovision them first or pass force=true", inUse),
+				"components_using": inUse,
+			})
+			return
+		}
+	}
+
 	if err := s.pkiStore.RevokeCA(ctx, caID); err != nil {
 		s.logger.Error("Failed to revoke CA", zap.Error(err), zap.String("ca_id", caID))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke CA"})
@@ -4850,8 +6025,9 @@ func (s *Server) reloadActiveCA(ctx context.Context) error {
 		return err
 	}
 
-	// Update the CA in memory
-	if err := s.ca.UpdateFromPEM(ctx, storedCA.CertificatePEM, storedCA.PrivateKeyPEM); err != nil {
+	// Update the CA in memory; it's already stored, and saving it again would
+	// overwrite the CA it replaced, which must stay trusted
+	if err := s.ca.LoadFromPEM(storedCA.CertificatePEM, storedCA.PrivateKeyPEM); err != nil {
 		return err
 	}
 
@@ -4893,20 +6069,8 @@ func (s *Server) handleListLoginLogs(c *gin.Context) {
 	ctx := c.Request.Context()
 
 	// Parse filter parameters
-	filter := &db.LoginLogFilter{
-		UserEmail: c.Query("email"),
-		UserID:    c.Query("user_id"),
-		IPAddress: c.Query("ip"),
-		Provider:  c.Query("provider"),
-		Limit:     50,
-		Offset:    0,
-	}
-
-	// Parse success filter
-	if successStr := c.Query("success"); successStr != "" {
-		success := successStr == "true"
-		filter.Success = &success
-	}
+	filter := loginLogFilterFromQuery(c)
+	filter.Limit = 50
 
 	// Parse pagination
 	if limitStr := c.Query("limit"); limitStr != "" {
@@ -4920,18 +6084,6 @@ func (s *Server) handleListLoginLogs(c *gin.Context) {
 		}
 	}
 
-	// Parse time filters
-	if startStr := c.Query("start"); startStr != "" {
-		if start, err := time.Parse(time.RFC3339, startStr); err == nil {
-			filter.StartTime = &start
-		}
-	}
-	if endStr := c.Query("end"); endStr != "" {
-		if end, err := time.Parse(time.RFC3339, endStr); err == nil {
-			filter.EndTime = &end
-		}
-	}
-
 	logs, total, err := s.loginLogStore.List(ctx, filter)
 	if err != nil {
 		s.logger.Error("Failed to list login logs", zap.Error(err))
@@ -5014,8 +6166,7 @@ func (s *Server) handleSetLoginLogRetention(c *gin.Context) {
 	var req struct {
 		RetentionDays int `json:"retention_days"`
 	}
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+	if !bindJSON(c, &req) {
 		return
 	}
 
@@ -5038,46 +6189,6 @@ func (s *Server) handleSetLoginLogRetention(c *gin.Context) {
 	})
 }
 
-// geoIPResult holds the result from IP geolocation lookup
-type geoIPResult struct {
-	Country     string `json:"country"`
-	CountryCode string `json:"countryCode"`
-	City        string `json:"city"`
-}
-
-// lookupGeoIP performs a geolocation lookup for an IP address using ip-api.com
-// Returns country, countryCode, and city, or empty strings on error
-func lookupGeoIP(ip string) (country, countryCode, city string) {
-	// Skip lookup for private/local IPs
-	if strings.HasPrefix(ip, "10.") || strings.HasPrefix(ip, "192.168.") ||
-		strings.HasPrefix(ip, "172.16.") || strings.HasPrefix(ip, "172.17.") ||
-		strings.HasPrefix(ip, "172.18.") || strings.HasPrefix(ip, "172.19.") ||
-		strings.HasPrefix(ip, "172.2") || strings.HasPrefix(ip, "172.30.") ||
-		strings.HasPrefix(ip, "172.31.") || strings.HasPrefix(ip, "127.") ||
-		ip == "::1" || ip == "localhost" {
-		return "", "", ""
-	}
-
-	// Use ip-api.com (free, no API key required, 45 requests/minute limit)
-	client := &http.Client{Timeout: 2 * time.Second}
-	resp, err := client.Get("http://ip-api.com/json/" + ip + "?fields=country,countryCode,city")
-	if err != nil {
-		return "", "", ""
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return "", "", ""
-	}
-
-	var result geoIPResult
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return "", "", ""
-	}
-
-	return result.Country, result.CountryCode, result.City
-}
-
 // getRealClientIP extracts the real client IP from headers or falls back to c.ClientIP()
 // This handles cases where requests come through load balancers, ingress controllers, or proxies
 func getRealClientIP(c *gin.Context) string {
@@ -5114,9 +6225,11 @@ func getRealClientIP(c *gin.Context) string {
 }
 
 // logUserLogin creates a login log entry (helper for auth handlers)
-func (s *Server) logUserLogin(ctx context.Context, userID, userEmail, userName, provider, providerName, ipAddress, userAgent, sessionID string, success bool, failureReason string) {
-	// Look up geolocation for the IP address
-	country, countryCode, city := lookupGeoIP(ipAddress)
+func (s *Server) logUserLogin(c *gin.Context, userID, userEmail, userName, provider, providerName, ipAddress, userAgent, sessionID string, success bool, failureReason string) {
+	ctx := c.Request.Context()
+
+	// Use a cached location if there is one; otherwise it's filled in asynchronously
+	location, cached := s.geoip.Cached(ipAddress)
 
 	log := &db.LoginLog{
 		UserID:        userID,
@@ -5126,15 +6239,37 @@ func (s *Server) logUserLogin(ctx context.Context, userID, userEmail, userName,
 		ProviderName:  providerName,
 		IPAddress:     ipAddress,
 		UserAgent:     userAgent,
-		Country:       country,
-		CountryCode:   countryCode,
-		City:          city,
+		Country:       location.Country,
+		CountryCode:   location.CountryCode,
+		City:          location.City,
 		Success:       success,
 		FailureReason: failureReason,
 		SessionID:     sessionID,
 	}
 
+	eventType := eventLoginSuccess
+	if !success {
+		eventType = eventLoginFailure
+	}
+	s.emitEvent(ctx, eventType, userID, "", gin.H{
+		"userId":        userID,
+		"userEmail":     userEmail,
+		"provider":      provider,
+		"providerName":  providerName,
+		"ipAddress":     ipAddress,
+		"country":       location.Country,
+		"failureReason": failureReason,
+	})
+
 	if err := s.loginLogStore.Create(ctx, log); err != nil {
 		s.logger.Error("Failed to create login log", zap.Error(err), zap.String("user_email", userEmail))
+		return
+	}
+
+	if !cached {
+		s.queueGeoIPLookup(log.ID, ipAddress)
+	}
+	if success {
+		s.notifyNewSignIn(c, log)
 	}
 }
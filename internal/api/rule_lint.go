@@ -0,0 +1,269 @@
+package api
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/gatekey-project/gatekey/internal/db"
+	"github.com/gatekey-project/gatekey/internal/firewall"
+)
+
+// Kinds of access rule lint findings.
+const (
+	lintDuplicate   = "duplicate"
+	lintShadowed    = "shadowed"
+	lintOverlapping = "overlapping"
+	lintUnassigned  = "unassigned"
+)
+
+// ruleLintFinding is a problem with one access rule, found by comparing it with
+// another (RelatedRuleID) or on its own.
+type ruleLintFinding struct {
+	Kind            string `json:"kind"`
+	RuleID          string `json:"ruleId"`
+	RuleName        string `json:"ruleName"`
+	RelatedRuleID   string `json:"relatedRuleId,omitempty"`
+	RelatedRuleName string `json:"relatedRuleName,omitempty"`
+	Message         string `json:"message"`
+	Suggestion      string `json:"suggestion"`
+}
+
+// ruleScope is the traffic an access rule allows, parsed for comparison.
+type ruleScope struct {
+	rule       *db.AccessRule
+	ipNet      *net.IPNet // ip and cidr rules
+	host       string     // hostname and hostname_wildcard rules, normalized
+	wildcard   bool
+	portStart  int
+	portEnd    int
+	protocol   firewall.Protocol
+	principals []string // "user:<id>" and "group:<name>", sorted
+}
+
+// parseRuleScope parses a rule with the same parsers the gateway uses. Rules that
+// don't parse are skipped, since the gateway skips them too.
+func parseRuleScope(rule *db.AccessRule, principals []string) (*ruleScope, bool) {
+	scope := &ruleScope{rule: rule, principals: principals, portStart: 1, portEnd: 65535}
+	switch rule.RuleType {
+	case db.AccessRuleTypeIP:
+		ip := net.ParseIP(rule.Value)
+		if ip == nil {
+			return nil, false
+		}
+		bits := 8 * net.IPv6len
+		if ip4 := ip.To4(); ip4 != nil {
+			ip, bits = ip4, 8*net.IPv4len
+		}
+		scope.ipNet = &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
+	case db.AccessRuleTypeCIDR:
+		_, ipNet, err := net.ParseCIDR(rule.Value)
+		if err != nil {
+			return nil, false
+		}
+		scope.ipNet = ipNet
+	case db.AccessRuleTypeHostname, db.AccessRuleTypeHostnameWildcard:
+		scope.host = strings.ToLower(strings.TrimSuffix(rule.Value, "."))
+		scope.wildcard = rule.RuleType == db.AccessRuleTypeHostnameWildcard
+	default:
+		return nil, false
+	}
+	if rule.PortRange != nil {
+		start, end, err := firewall.ParsePortRange(*rule.PortRange)
+		if err != nil {
+			return nil, false
+		}
+		if start != 0 {
+			scope.portStart, scope.portEnd = start, end
+		}
+	}
+	scope.protocol = firewall.ProtocolAny
+	if rule.Protocol != nil {
+		protocol, err := firewall.ParseProtocol(*rule.Protocol)
+		if err != nil {
+			return nil, false
+		}
+		scope.protocol = protocol
+	}
+	return scope, true
+}
+
+// coversDestination reports whether every destination b allows is also allowed
+// by a. IP rules and hostname rules are never compared, since which addresses a
+// hostname resolves to isn't known here.
+func (a *ruleScope) coversDestination(b *ruleScope, singleLabel bool) bool {
+	switch {
+	case a.ipNet != nil && b.ipNet != nil:
+		aOnes, _ := a.ipNet.Mask.Size()
+		bOnes, _ := b.ipNet.Mask.Size()
+		return len(a.ipNet.IP) == len(b.ipNet.IP) && aOnes <= bOnes && a.ipNet.Contains(b.ipNet.IP)
+	case a.ipNet != nil || b.ipNet != nil:
+		return false
+	case a.wildcard && b.wildcard:
+		if a.host == b.host {
+			return true
+		}
+		// *.example.com covers *.dev.example.com unless wildcards match one label
+		return !singleLabel && strings.HasSuffix(b.host, strings.TrimPrefix(a.host, "*"))
+	case a.wildcard:
+		return firewall.MatchHostnameWildcard(a.host, b.host, singleLabel)
+	case b.wildcard:
+		return false
+	default:
+		return a.host == b.host
+	}
+}
+
+// covers reports whether a allows all the traffic b does.
+func (a *ruleScope) covers(b *ruleScope, singleLabel bool) bool {
+	return a.coversDestination(b, singleLabel) &&
+		a.portStart <= b.portStart && b.portEnd <= a.portEnd &&
+		(a.protocol == firewall.ProtocolAny || a.protocol == b.protocol) &&
+		(a.rule.NetworkID == nil || (b.rule.NetworkID != nil && *a.rule.NetworkID == *b.rule.NetworkID))
+}
+
+// overlaps reports whether some traffic is allowed by both a and b.
+func (a *ruleScope) overlaps(b *ruleScope, singleLabel bool) bool {
+	return (a.coversDestination(b, singleLabel) || b.coversDestination(a, singleLabel)) &&
+		a.portStart <= b.portEnd && b.portStart <= a.portEnd &&
+		(a.protocol == firewall.ProtocolAny || b.protocol == firewall.ProtocolAny || a.protocol == b.protocol) &&
+		(a.rule.NetworkID == nil || b.rule.NetworkID == nil || *a.rule.NetworkID == *b.rule.NetworkID)
+}
+
+// hasPrincipals reports whether every user and group assigned to b is also
+// assigned to a.
+func hasPrincipals(a, b []string) bool {
+	for _, p := range b {
+		if _, found := slices.BinarySearch(a, p); !found {
+			return false
+		}
+	}
+	return true
+}
+
+// lintAccessRules finds active access rules that grant nothing or nothing extra.
+// Rules only ever allow traffic, so a rule is redundant when another rule allows
+// at least the same traffic to at least the same users and groups. principals
+// maps rule IDs to their assigned users and groups.
+func lintAccessRules(rules []*db.AccessRule, principals map[string][]string, singleLabel bool) []ruleLintFinding {
+	var scopes []*ruleScope
+	for _, rule := range rules {
+		if !rule.IsActive {
+			continue
+		}
+		assigned := slices.Clone(principals[rule.ID])
+		sort.Strings(assigned)
+		if scope, ok := parseRuleScope(rule, slices.Compact(assigned)); ok {
+			scopes = append(scopes, scope)
+		}
+	}
+	sort.Slice(scopes, func(i, j int) bool {
+		if scopes[i].rule.Name != scopes[j].rule.Name {
+			return scopes[i].rule.Name < scopes[j].rule.Name
+		}
+		return scopes[i].rule.ID < scopes[j].rule.ID
+	})
+
+	findings := []ruleLintFinding{}
+	finding := func(kind string, rule, related *ruleScope, message, suggestion string) {
+		f := ruleLintFinding{Kind: kind, RuleID: rule.rule.ID, RuleName: rule.rule.Name, Message: message, Suggestion: suggestion}
+		if related != nil {
+			f.RelatedRuleID, f.RelatedRuleName = related.rule.ID, related.rule.Name
+		}
+		findings = append(findings, f)
+	}
+
+	redundant := make(map[string]bool)
+	for _, b := range scopes {
+		if len(b.principals) == 0 {
+			finding(lintUnassigned, b, nil,
+				fmt.Sprintf("%q isn't assigned to any user or group, so it grants nothing", b.rule.Name),
+				"Assign it to the users or groups who need it, or delete it")
+			redundant[b.rule.ID] = true
+		}
+	}
+
+	for i, a := range scopes {
+		for _, b := range scopes[i+1:] {
+			aCoversB, bCoversA := a.covers(b, singleLabel), b.covers(a, singleLabel)
+			switch {
+			case aCoversB && bCoversA:
+				if slices.Equal(a.principals, b.principals) {
+					finding(lintDuplicate, b, a,
+						fmt.Sprintf("%q allows the same traffic to the same users and groups as %q", b.rule.Name, a.rule.Name),
+						fmt.Sprintf("Delete %q", b.rule.Name))
+					redundant[b.rule.ID] = true
+				} else {
+					finding(lintDuplicate, b, a,
+						fmt.Sprintf("%q allows the same traffic as %q, assigned to different users or groups", b.rule.Name, a.rule.Name),
+						fmt.Sprintf("Assign %q's users and groups to %q and delete %q", b.rule.Name, a.rule.Name, b.rule.Name))
+				}
+			case aCoversB || bCoversA:
+				broad, narrow := a, b
+				if bCoversA {
+					broad, narrow = b, a
+				}
+				if redundant[narrow.rule.ID] || !hasPrincipals(broad.principals, narrow.principals) {
+					continue
+				}
+				finding(lintShadowed, narrow, broad,
+					fmt.Sprintf("%q is fully covered by %q, which is assigned to all of its users and groups", narrow.rule.Name, broad.rule.Name),
+					fmt.Sprintf("Delete %q, or narrow %q if the broader access is unintended", narrow.rule.Name, broad.rule.Name))
+				redundant[narrow.rule.ID] = true
+			case a.overlaps(b, singleLabel):
+				finding(lintOverlapping, b, a,
+					fmt.Sprintf("%q and %q allow some of the same traffic", b.rule.Name, a.rule.Name),
+					"Merge them or split the port ranges so each rule has a clear purpose")
+			}
+		}
+	}
+	return findings
+}
+
+// handleLintAccessRules reports access rules that are duplicates of, shadowed
+// by, or overlap other rules, or that aren't assigned to anyone.
+func (s *Server) handleLintAccessRules(c *gin.Context) {
+	ctx := c.Request.Context()
+	rules, err := s.accessRuleStore.ListAccessRules(ctx)
+	if err != nil {
+		s.logger.Error("Failed to list access rules", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list access rules"})
+		return
+	}
+	userRules, err := s.accessRuleStore.GetAllUserAccessRuleAssignments(ctx)
+	if err != nil {
+		s.logger.Error("Failed to get user rule assignments", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get rule assignments"})
+		return
+	}
+	groupRules, err := s.accessRuleStore.GetAllGroupAccessRuleAssignments(ctx)
+	if err != nil {
+		s.logger.Error("Failed to get group rule assignments", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get rule assignments"})
+		return
+	}
+
+	principals := make(map[string][]string)
+	for userID, ruleIDs := range userRules {
+		for _, ruleID := range ruleIDs {
+			principals[ruleID] = append(principals[ruleID], "user:"+userID)
+		}
+	}
+	for group, ruleIDs := range groupRules {
+		for _, ruleID := range ruleIDs {
+			principals[ruleID] = append(principals[ruleID], "group:"+group)
+		}
+	}
+
+	findings := lintAccessRules(rules, principals, s.config.Policy.WildcardSingleLabel)
+	c.JSON(http.StatusOK, gin.H{
+		"findings": findings,
+		"total":    len(findings),
+	})
+}
@@ -0,0 +1,51 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/gatekey-project/gatekey/internal/db"
+)
+
+func TestLintAccessRules(t *testing.T) {
+	str := func(s string) *string { return &s }
+	rules := []*db.AccessRule{
+		{ID: "1", Name: "a-office", RuleType: db.AccessRuleTypeCIDR, Value: "10.0.0.0/16", IsActive: true},
+		{ID: "2", Name: "b-web", RuleType: db.AccessRuleTypeIP, Value: "10.0.1.5", PortRange: str("443"), Protocol: str("tcp"), IsActive: true},
+		{ID: "3", Name: "c-office-copy", RuleType: db.AccessRuleTypeCIDR, Value: "10.0.0.0/16", PortRange: str("*"), IsActive: true},
+		{ID: "4", Name: "d-db", RuleType: db.AccessRuleTypeIP, Value: "10.0.2.9", PortRange: str("5432"), IsActive: true},
+		{ID: "5", Name: "e-apps", RuleType: db.AccessRuleTypeHostnameWildcard, Value: "*.apps.example.com", PortRange: str("80-443"), IsActive: true},
+		{ID: "6", Name: "f-wiki", RuleType: db.AccessRuleTypeHostname, Value: "wiki.apps.example.com", PortRange: str("400-500"), IsActive: true},
+		{ID: "7", Name: "g-unused", RuleType: db.AccessRuleTypeCIDR, Value: "192.168.0.0/24", IsActive: true},
+		{ID: "8", Name: "h-inactive", RuleType: db.AccessRuleTypeIP, Value: "10.0.1.5", IsActive: false},
+	}
+	principals := map[string][]string{
+		"1": {"group:eng"},
+		"2": {"group:eng"},
+		"3": {"group:eng"},
+		"4": {"group:eng", "user:alice"},
+		"5": {"group:web"},
+		"6": {"group:web"},
+	}
+
+	type key struct{ kind, rule, related string }
+	want := map[key]bool{
+		{lintUnassigned, "7", ""}:   true, // no users or groups
+		{lintDuplicate, "3", "1"}:   true, // same traffic and principals
+		{lintShadowed, "2", "1"}:    true, // inside a-office, same group
+		{lintOverlapping, "6", "5"}: true, // ports 400-500 vs 80-443
+	}
+	got := make(map[key]bool)
+	for _, f := range lintAccessRules(rules, principals, false) {
+		got[key{f.Kind, f.RuleID, f.RelatedRuleID}] = true
+	}
+	for k := range want {
+		if !got[k] {
+			t.Errorf("missing finding %+v", k)
+		}
+	}
+	for k := range got {
+		if !want[k] {
+			t.Errorf("unexpected finding %+v", k)
+		}
+	}
+}
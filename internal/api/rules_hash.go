@@ -0,0 +1,165 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gatekey-project/gatekey/internal/db"
+)
+
+// canonicalRule is the subset of an access rule that affects enforcement,
+// serialized in a fixed field order for hashing.
+type canonicalRule struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	Value     string `json:"value"`
+	Port      string `json:"port"`
+	Protocol  string `json:"protocol"`
+	NetworkID string `json:"network_id"`
+	IsActive  bool   `json:"is_active"`
+}
+
+// rulesContentHash returns a deterministic SHA256 over the rule set, its user and
+// group assignments, and group membership and user exception fingerprints. The
+// result only changes when something that affects enforcement changes.
+func rulesContentHash(rules []*db.AccessRule, userRules, groupRules map[string][]string, membership, exceptions string) string {
+	canonical := make([]canonicalRule, 0, len(rules))
+	for _, r := range rules {
+		cr := canonicalRule{
+			ID:       r.ID,
+			Name:     r.Name,
+			Type:     string(r.RuleType),
+			Value:    r.Value,
+			IsActive: r.IsActive,
+		}
+		if r.PortRange != nil {
+			cr.Port = *r.PortRange
+		}
+		if r.Protocol != nil {
+			cr.Protocol = *r.Protocol
+		}
+		if r.NetworkID != nil {
+			cr.NetworkID = *r.NetworkID
+		}
+		canonical = append(canonical, cr)
+	}
+	sort.Slice(canonical, func(i, j int) bool { return canonical[i].ID < canonical[j].ID })
+
+	// encoding/json sorts map keys, so only the slices need ordering
+	payload := struct {
+		Rules      []canonicalRule     `json:"rules"`
+		UserRules  map[string][]string `json:"user_rules"`
+		GroupRules map[string][]string `json:"group_rules"`
+		Membership string              `json:"membership"`
+		Exceptions string              `json:"exceptions"`
+	}{
+		Rules:      canonical,
+		UserRules:  sortedAssignments(userRules),
+		GroupRules: sortedAssignments(groupRules),
+		Membership: membership,
+		Exceptions: exceptions,
+	}
+
+	data, _ := json.Marshal(payload)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// sortedAssignments returns a copy of an assignment map with each rule ID list sorted.
+func sortedAssignments(assignments map[string][]string) map[string][]string {
+	result := make(map[string][]string, len(assignments))
+	for key, ids := range assignments {
+		sorted := make([]string, len(ids))
+		copy(sorted, ids)
+		sort.Strings(sorted)
+		result[key] = sorted
+	}
+	return result
+}
+
+// rulesHashCache holds recent rules hashes, per tenant, so heartbeats don't
+// reload every rule and assignment. A hash is used until the access rule cache
+// is next invalidated, which every change to rules, assignments and exceptions
+// made through this process does, or for db.DefaultAccessRuleCacheTTL, which
+// bounds how long changes made by other replicas and group membership changes
+// take to show.
+type rulesHashCache struct {
+	mu      sync.Mutex
+	entries map[string]rulesHashCacheEntry
+}
+
+type rulesHashCacheEntry struct {
+	hash       string
+	generation uint64 // Access rule cache generation the hash was computed at
+	expires    time.Time
+}
+
+func newRulesHashCache() *rulesHashCache {
+	return &rulesHashCache{entries: make(map[string]rulesHashCacheEntry)}
+}
+
+func (c *rulesHashCache) get(key string, generation uint64, now time.Time) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok || entry.generation != generation || now.After(entry.expires) {
+		return "", false
+	}
+	return entry.hash, true
+}
+
+func (c *rulesHashCache) put(key string, generation uint64, hash string, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = rulesHashCacheEntry{hash: hash, generation: generation, expires: now.Add(db.DefaultAccessRuleCacheTTL)}
+}
+
+// rulesHash returns the rules hash for the tenant in ctx, computing it only when
+// the cached one is out of date.
+func (s *Server) rulesHash(ctx context.Context) (string, error) {
+	key, _ := db.TenantFromContext(ctx)
+	// Read before computing, so an invalidation during it leaves the result stale
+	generation := s.accessRuleStore.CacheGeneration()
+	now := time.Now()
+	if hash, ok := s.rulesHashes.get(key, generation, now); ok {
+		return hash, nil
+	}
+	hash, err := s.computeRulesHash(ctx)
+	if err != nil {
+		return "", err
+	}
+	s.rulesHashes.put(key, generation, hash, now)
+	return hash, nil
+}
+
+// computeRulesHash loads the current rules, assignments, group memberships and
+// user exceptions and returns their content hash.
+func (s *Server) computeRulesHash(ctx context.Context) (string, error) {
+	rules, err := s.accessRuleStore.ListAccessRules(ctx)
+	if err != nil {
+		return "", err
+	}
+	userRules, err := s.accessRuleStore.GetAllUserAccessRuleAssignments(ctx)
+	if err != nil {
+		return "", err
+	}
+	groupRules, err := s.accessRuleStore.GetAllGroupAccessRuleAssignments(ctx)
+	if err != nil {
+		return "", err
+	}
+	membership, err := s.userStore.GetGroupMembershipFingerprint(ctx)
+	if err != nil {
+		return "", err
+	}
+	exceptions, err := s.accessRuleStore.GetAccessExceptionFingerprint(ctx)
+	if err != nil {
+		return "", err
+	}
+	return rulesContentHash(rules, userRules, groupRules, membership, exceptions), nil
+}
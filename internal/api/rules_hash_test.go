@@ -0,0 +1,103 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gatekey-project/gatekey/internal/db"
+)
+
+func strPtr(s string) *string { return &s }
+
+func testRules() []*db.AccessRule {
+	return []*db.AccessRule{
+		{ID: "r1", Name: "web", RuleType: db.AccessRuleTypeIP, Value: "10.0.0.1", PortRange: strPtr("443"), Protocol: strPtr("tcp"), IsActive: true},
+		{ID: "r2", Name: "db", RuleType: db.AccessRuleTypeCIDR, Value: "10.1.0.0/16", IsActive: true},
+	}
+}
+
+func TestRulesContentHashDeterministic(t *testing.T) {
+	rules := testRules()
+	userRules := map[string][]string{"u1": {"r2", "r1"}}
+	groupRules := map[string][]string{"eng": {"r1"}}
+
+	h1 := rulesContentHash(rules, userRules, groupRules, "m", "")
+
+	// Reordered rules and assignments must hash the same
+	reversed := []*db.AccessRule{rules[1], rules[0]}
+	h2 := rulesContentHash(reversed, map[string][]string{"u1": {"r1", "r2"}}, groupRules, "m", "")
+
+	if h1 != h2 {
+		t.Errorf("hash should not depend on ordering: %s != %s", h1, h2)
+	}
+}
+
+func TestRulesContentHashDetectsChanges(t *testing.T) {
+	userRules := map[string][]string{"u1": {"r1"}}
+	groupRules := map[string][]string{"eng": {"r2"}}
+	base := rulesContentHash(testRules(), userRules, groupRules, "m", "")
+
+	tests := []struct {
+		name   string
+		mutate func(rules []*db.AccessRule, users, groups map[string][]string) string
+	}{
+		{"value edited in place", func(r []*db.AccessRule, u, g map[string][]string) string {
+			r[0].Value = "10.0.0.2"
+			return "m"
+		}},
+		{"port changed", func(r []*db.AccessRule, u, g map[string][]string) string {
+			r[0].PortRange = strPtr("8443")
+			return "m"
+		}},
+		{"rule deactivated", func(r []*db.AccessRule, u, g map[string][]string) string {
+			r[1].IsActive = false
+			return "m"
+		}},
+		{"user assignment added", func(r []*db.AccessRule, u, g map[string][]string) string {
+			u["u2"] = []string{"r1"}
+			return "m"
+		}},
+		{"group assignment moved", func(r []*db.AccessRule, u, g map[string][]string) string {
+			g["eng"] = []string{"r1"}
+			return "m"
+		}},
+		{"group membership changed", func(r []*db.AccessRule, u, g map[string][]string) string {
+			return "m2"
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules := testRules()
+			users := map[string][]string{"u1": {"r1"}}
+			groups := map[string][]string{"eng": {"r2"}}
+			membership := tt.mutate(rules, users, groups)
+			if got := rulesContentHash(rules, users, groups, membership, ""); got == base {
+				t.Errorf("hash did not change")
+			}
+		})
+	}
+
+	if rulesContentHash(testRules(), userRules, groupRules, "m", "e") == base {
+		t.Error("hash did not change with user exceptions")
+	}
+}
+
+func TestRulesHashCache(t *testing.T) {
+	c := newRulesHashCache()
+	now := time.Now()
+	c.put("tenant-a", 3, "hash-a", now)
+
+	if hash, ok := c.get("tenant-a", 3, now.Add(time.Second)); !ok || hash != "hash-a" {
+		t.Errorf("get() = %q, %v, want the cached hash", hash, ok)
+	}
+	if _, ok := c.get("tenant-b", 3, now); ok {
+		t.Error("another tenant got tenant-a's hash")
+	}
+	if _, ok := c.get("tenant-a", 4, now); ok {
+		t.Error("hash served after the access rule cache was invalidated")
+	}
+	if _, ok := c.get("tenant-a", 3, now.Add(db.DefaultAccessRuleCacheTTL+time.Second)); ok {
+		t.Error("hash served after it expired")
+	}
+}
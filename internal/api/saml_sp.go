@@ -0,0 +1,197 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/url"
+	"time"
+
+	"github.com/crewjam/saml"
+	dsig "github.com/russellhaering/goxmldsig"
+
+	"github.com/gatekey-project/gatekey/internal/db"
+)
+
+// samlSigningKeyValidity is how long a generated SP certificate is valid. IdPs
+// pin it from the metadata, so it's long-lived like an IdP's own certificate.
+const samlSigningKeyValidity = 10 * 365 * 24 * time.Hour
+
+// samlNameIDFormats are the NameID formats a provider may request. GateKey keys
+// users on whatever NameID the IdP sends, so it supports all of them.
+var samlNameIDFormats = []saml.NameIDFormat{
+	saml.EmailAddressNameIDFormat,
+	saml.PersistentNameIDFormat,
+	saml.TransientNameIDFormat,
+	saml.UnspecifiedNameIDFormat,
+}
+
+// validSAMLNameIDFormat reports whether format is empty or a supported NameID format.
+func validSAMLNameIDFormat(format string) bool {
+	if format == "" {
+		return true
+	}
+	for _, f := range samlNameIDFormats {
+		if string(f) == format {
+			return true
+		}
+	}
+	return false
+}
+
+// samlLogin returns the provider a response posted to the ACS is for and the
+// AuthnRequest IDs it may answer. A login started with GET /auth/saml/login
+// comes back with its stored relay state, which names the provider and the
+// request. An IdP-initiated login has no stored state and answers no request;
+// its RelayState names the provider.
+func samlLogin(state *db.OAuthState, relayState string) (provider string, requestIDs []string) {
+	if state == nil {
+		return relayState, nil
+	}
+	return state.Provider, []string{state.Nonce}
+}
+
+// samlServiceProvider builds the SP for a provider with its signing key pair,
+// generating the pair the first time it's needed. idpMetadata may be nil when
+// only the SP's own metadata is wanted.
+func (s *Server) samlServiceProvider(ctx context.Context, p *db.SAMLProvider, idpMetadata *saml.EntityDescriptor) (*saml.ServiceProvider, error) {
+	acsURL, err := url.Parse(p.ACSURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ACS URL: %w", err)
+	}
+	key, cert, err := s.samlSigningKey(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+
+	sp := &saml.ServiceProvider{
+		EntityID:          p.EntityID,
+		AcsURL:            *acsURL,
+		IDPMetadata:       idpMetadata,
+		Key:               key,
+		Certificate:       cert,
+		AuthnNameIDFormat: saml.NameIDFormat(p.NameIDFormat),
+		AllowIDPInitiated: p.AllowIDPInitiated,
+	}
+	if p.SignRequests {
+		sp.SignatureMethod = dsig.RSASHA256SignatureMethod
+	}
+	return sp, nil
+}
+
+// samlSigningKey returns a provider's SP key pair, generating and storing one if
+// it has none yet.
+func (s *Server) samlSigningKey(ctx context.Context, p *db.SAMLProvider) (*rsa.PrivateKey, *x509.Certificate, error) {
+	if p.SPCertificate == "" || p.SPPrivateKey == "" {
+		certPEM, keyPEM, err := generateSAMLKeyPair(p.EntityID, time.Now())
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to generate SP key pair: %w", err)
+		}
+		stored, err := s.providerStore.SetSAMLSigningKey(ctx, p.ID, certPEM, keyPEM)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to save SP key pair: %w", err)
+		}
+		if stored {
+			p.SPCertificate, p.SPPrivateKey = certPEM, keyPEM
+		} else {
+			// Another request generated one first
+			current, err := s.providerStore.GetSAMLProvider(ctx, p.Name)
+			if err != nil {
+				return nil, nil, err
+			}
+			p.SPCertificate, p.SPPrivateKey = current.SPCertificate, current.SPPrivateKey
+		}
+	}
+	return parseSAMLKeyPair(p.SPCertificate, p.SPPrivateKey)
+}
+
+// generateSAMLKeyPair returns a self-signed RSA certificate and key for an SP, as PEM.
+func generateSAMLKeyPair(entityID string, now time.Time) (string, string, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return "", "", err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return "", "", err
+	}
+	commonName := entityID
+	if u, err := url.Parse(entityID); err == nil && u.Host != "" {
+		commonName = u.Hostname()
+	}
+	if len(commonName) > 64 {
+		commonName = commonName[:64]
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName, Organization: []string{"GateKey"}},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(samlSigningKeyValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return "", "", err
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	return string(certPEM), string(keyPEM), nil
+}
+
+// parseSAMLKeyPair parses a PEM SP certificate and RSA key.
+func parseSAMLKeyPair(certPEM, keyPEM string) (*rsa.PrivateKey, *x509.Certificate, error) {
+	certBlock, _ := pem.Decode([]byte(certPEM))
+	keyBlock, _ := pem.Decode([]byte(keyPEM))
+	if certBlock == nil || keyBlock == nil {
+		return nil, nil, errors.New("invalid SP key pair")
+	}
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid SP certificate: %w", err)
+	}
+	key, err := x509.ParsePKCS1PrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid SP private key: %w", err)
+	}
+	return key, cert, nil
+}
+
+// samlSPMetadata returns an SP's metadata with its certificate published for
+// signing as well as encryption, even before request signing is turned on so the
+// IdP can be set up first, and every supported NameID format with the requested
+// one first.
+func samlSPMetadata(sp *saml.ServiceProvider) *saml.EntityDescriptor {
+	md := sp.Metadata()
+	spsso := &md.SPSSODescriptors[0]
+
+	hasSigning := false
+	for _, kd := range spsso.KeyDescriptors {
+		if kd.Use == "signing" {
+			hasSigning = true
+		}
+	}
+	if !hasSigning && len(spsso.KeyDescriptors) > 0 {
+		spsso.KeyDescriptors = append(spsso.KeyDescriptors, saml.KeyDescriptor{
+			Use:     "signing",
+			KeyInfo: spsso.KeyDescriptors[0].KeyInfo,
+		})
+	}
+
+	var formats []saml.NameIDFormat
+	if sp.AuthnNameIDFormat != "" {
+		formats = append(formats, sp.AuthnNameIDFormat)
+	}
+	for _, f := range samlNameIDFormats {
+		if f != sp.AuthnNameIDFormat {
+			formats = append(formats, f)
+		}
+	}
+	spsso.NameIDFormats = formats
+	return md
+}
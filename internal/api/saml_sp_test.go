@@ -0,0 +1,183 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/crewjam/saml"
+	dsig "github.com/russellhaering/goxmldsig"
+
+	"github.com/gatekey-project/gatekey/internal/db"
+)
+
+func TestSAMLSPMetadataAndSigning(t *testing.T) {
+	certPEM, keyPEM, err := generateSAMLKeyPair("https://vpn.example.com/saml", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, cert, err := parseSAMLKeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatalf("parseSAMLKeyPair() error = %v", err)
+	}
+	if cert.Subject.CommonName != "vpn.example.com" {
+		t.Errorf("certificate CN = %q", cert.Subject.CommonName)
+	}
+
+	acsURL, _ := url.Parse("https://vpn.example.com/api/v1/auth/saml/acs")
+	sp := &saml.ServiceProvider{
+		EntityID:          "https://vpn.example.com/saml",
+		AcsURL:            *acsURL,
+		Key:               key,
+		Certificate:       cert,
+		AuthnNameIDFormat: saml.PersistentNameIDFormat,
+	}
+
+	// The certificate is published for signing before signing is turned on
+	md := samlSPMetadata(sp).SPSSODescriptors[0]
+	uses := map[string]bool{}
+	for _, kd := range md.KeyDescriptors {
+		uses[kd.Use] = true
+	}
+	if !uses["signing"] || !uses["encryption"] {
+		t.Errorf("key descriptor uses = %v, want signing and encryption", uses)
+	}
+	if len(md.NameIDFormats) != len(samlNameIDFormats) || md.NameIDFormats[0] != saml.PersistentNameIDFormat {
+		t.Errorf("NameIDFormats = %v, want all formats with persistent first", md.NameIDFormats)
+	}
+	if *md.AuthnRequestsSigned {
+		t.Error("AuthnRequestsSigned = true without sign_requests")
+	}
+
+	sp.SignatureMethod = dsig.RSASHA256SignatureMethod
+	sp.IDPMetadata = &saml.EntityDescriptor{IDPSSODescriptors: []saml.IDPSSODescriptor{{
+		SingleSignOnServices: []saml.Endpoint{{Binding: saml.HTTPRedirectBinding, Location: "https://idp.example.com/sso"}},
+	}}}
+	req, err := sp.MakeAuthenticationRequest(sp.GetSSOBindingLocation(saml.HTTPRedirectBinding), saml.HTTPRedirectBinding, saml.HTTPPostBinding)
+	if err != nil {
+		t.Fatal(err)
+	}
+	redirect, err := req.Redirect("state", sp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q := redirect.Query(); q.Get("Signature") == "" || !strings.Contains(q.Get("SigAlg"), "rsa-sha256") {
+		t.Errorf("redirect is not signed: %s", redirect)
+	}
+	if !*samlSPMetadata(sp).SPSSODescriptors[0].AuthnRequestsSigned {
+		t.Error("AuthnRequestsSigned = false with sign_requests")
+	}
+}
+
+func TestValidSAMLNameIDFormat(t *testing.T) {
+	for _, f := range []string{"", string(saml.EmailAddressNameIDFormat), string(saml.TransientNameIDFormat)} {
+		if !validSAMLNameIDFormat(f) {
+			t.Errorf("validSAMLNameIDFormat(%q) = false", f)
+		}
+	}
+	if validSAMLNameIDFormat("urn:example:custom") {
+		t.Error("validSAMLNameIDFormat accepted an unknown format")
+	}
+}
+
+func TestSAMLLogin(t *testing.T) {
+	provider, ids := samlLogin(&db.OAuthState{Provider: "okta", Nonce: "id-123"}, "relay")
+	if provider != "okta" || len(ids) != 1 || ids[0] != "id-123" {
+		t.Errorf("stored login = %q %v, want okta [id-123]", provider, ids)
+	}
+	provider, ids = samlLogin(nil, "okta")
+	if provider != "okta" || ids != nil {
+		t.Errorf("IdP-initiated login = %q %v, want okta and no request IDs", provider, ids)
+	}
+}
+
+func TestSAMLResponseInResponseTo(t *testing.T) {
+	idpCertPEM, idpKeyPEM, err := generateSAMLKeyPair("https://idp.example.com/metadata", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	idpKey, idpCert, err := parseSAMLKeyPair(idpCertPEM, idpKeyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	metadataURL, _ := url.Parse("https://idp.example.com/metadata")
+	ssoURL, _ := url.Parse("https://idp.example.com/sso")
+	idp := &saml.IdentityProvider{Key: idpKey, Certificate: idpCert, MetadataURL: *metadataURL, SSOURL: *ssoURL}
+
+	spCertPEM, spKeyPEM, err := generateSAMLKeyPair("https://vpn.example.com/saml", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{}
+	serviceProvider := func(allowIDPInitiated bool) *saml.ServiceProvider {
+		sp, err := s.samlServiceProvider(context.Background(), &db.SAMLProvider{
+			EntityID:          "https://vpn.example.com/saml",
+			ACSURL:            "https://vpn.example.com/api/v1/auth/saml/acs",
+			AllowIDPInitiated: allowIDPInitiated,
+			SPCertificate:     spCertPEM,
+			SPPrivateKey:      spKeyPEM,
+		}, idp.Metadata())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sp
+	}
+
+	// respond posts the IdP's response to the ACS, answering requestID if set
+	respond := func(sp *saml.ServiceProvider, requestID string) *http.Request {
+		md := sp.Metadata()
+		req := &saml.IdpAuthnRequest{
+			IDP:                     idp,
+			HTTPRequest:             httptest.NewRequest(http.MethodGet, ssoURL.String(), nil),
+			Request:                 saml.AuthnRequest{ID: requestID},
+			ServiceProviderMetadata: md,
+			SPSSODescriptor:         &md.SPSSODescriptors[0],
+			ACSEndpoint:             &saml.IndexedEndpoint{Binding: saml.HTTPPostBinding, Location: sp.AcsURL.String()},
+			Now:                     saml.TimeNow(),
+		}
+		session := &saml.Session{ID: "session", NameID: "alice@example.com", CreateTime: req.Now, ExpireTime: req.Now.Add(time.Hour)}
+		if err := (saml.DefaultAssertionMaker{}).MakeAssertion(req, session); err != nil {
+			t.Fatal(err)
+		}
+		form, err := req.PostBinding()
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := httptest.NewRequest(http.MethodPost, form.URL, strings.NewReader(url.Values{"SAMLResponse": {form.SAMLResponse}}.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if err := r.ParseForm(); err != nil { // As c.PostForm does in the handler
+			t.Fatal(err)
+		}
+		return r
+	}
+
+	strict, lenient := serviceProvider(false), serviceProvider(true)
+	tests := []struct {
+		name       string
+		sp         *saml.ServiceProvider
+		answers    string
+		requestIDs []string
+		wantErr    bool
+	}{
+		{"answers the stored request", strict, "id-login", []string{"id-login"}, false},
+		{"answers another request", strict, "id-other", []string{"id-login"}, true},
+		{"unsolicited, not allowed", strict, "", nil, true},
+		{"unsolicited, allowed", lenient, "", nil, false},
+		{"answers another request, allowed", lenient, "id-other", []string{"id-login"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertion, err := tt.sp.ParseResponse(respond(tt.sp, tt.answers), tt.requestIDs)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseResponse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && assertion.Subject.NameID.Value != "alice@example.com" {
+				t.Errorf("NameID = %q", assertion.Subject.NameID.Value)
+			}
+		})
+	}
+}
@@ -3,6 +3,7 @@ package api
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 	"time"
 
@@ -12,7 +13,10 @@ import (
 
 	"github.com/gatekey-project/gatekey/internal/config"
 	"github.com/gatekey-project/gatekey/internal/db"
+	"github.com/gatekey-project/gatekey/internal/geoip"
 	"github.com/gatekey-project/gatekey/internal/k8s"
+	"github.com/gatekey-project/gatekey/internal/mail"
+	"github.com/gatekey-project/gatekey/internal/notify"
 	"github.com/gatekey-project/gatekey/internal/openvpn"
 	"github.com/gatekey-project/gatekey/internal/pki"
 	"github.com/gatekey-project/gatekey/internal/session"
@@ -20,30 +24,51 @@ import (
 
 // Server represents the HTTP API server.
 type Server struct {
-	config          *config.Config
-	logger          *zap.Logger
-	router          *gin.Engine
-	httpServer      *http.Server
-	db              *db.DB
-	userStore       *db.UserStore
-	providerStore   *db.ProviderStore
-	stateStore      *db.StateStore
-	configStore     *db.ConfigStore
-	gatewayStore    *db.GatewayStore
-	networkStore    *db.NetworkStore
-	accessRuleStore *db.AccessRuleStore
-	settingsStore   *db.SettingsStore
-	pkiStore        *db.PKIStore
-	proxyAppStore   *db.ProxyApplicationStore
-	loginLogStore   *db.LoginLogStore
-	meshStore       *db.MeshStore
-	meshConfigStore *db.MeshConfigStore
-	apiKeyStore     *db.APIKeyStore
-	ca              *pki.CA
-	configGen       *openvpn.ConfigGenerator
-	adminPassword   string             // Initial admin password (shown once at startup)
-	bgCancel        context.CancelFunc // Cancel function for background tasks
-	sessionMgr      *session.Manager   // Remote session manager
+	config             *config.Config
+	logger             *zap.Logger
+	router             *gin.Engine
+	httpServer         *http.Server
+	db                 *db.DB
+	userStore          *db.UserStore
+	providerStore      *db.ProviderStore
+	stateStore         *db.StateStore
+	configStore        *db.ConfigStore
+	gatewayStore       *db.GatewayStore
+	networkStore       *db.NetworkStore
+	accessRuleStore    *db.AccessRuleStore
+	settingsStore      *db.SettingsStore
+	pkiStore           *db.PKIStore
+	proxyAppStore      *db.ProxyApplicationStore
+	loginLogStore      *db.LoginLogStore
+	connectionStore    *db.ConnectionStore
+	auditStore         *db.AuditStore
+	meshStore          *db.MeshStore
+	meshConfigStore    *db.MeshConfigStore
+	meshEventStore     *db.MeshEventStore
+	apiKeyStore        *db.APIKeyStore
+	changeStore        *db.ChangeStore
+	tenantStore        *db.TenantStore
+	statsStore         *db.StatsStore
+	policyStore        *db.PolicyStore
+	accessRequestStore *db.AccessRequestStore
+	provisioningStore  *db.ProvisioningStore
+	maintenanceStore   *db.MaintenanceStore
+	ca                 *pki.CA
+	configGen          *openvpn.ConfigGenerator
+	adminPassword      string               // Initial admin password (shown once at startup)
+	bgCancel           context.CancelFunc   // Cancel function for background tasks
+	sessionMgr         *session.Manager     // Remote session manager
+	geoip              *geoip.Resolver      // Login geolocation with an in-memory cache
+	geoipQueue         chan geoIPJob        // Pending asynchronous login geolocation lookups
+	ldapClients        *ldapClients         // Pooled LDAP connections per provider
+	mailer             mail.Sender          // Outgoing email for login links and notifications
+	gatewayMetrics     *gatewayReports      // Latest rule metrics reported by gateway heartbeats
+	binaryDigests      *binaryDigests       // Checksums of downloadable binaries
+	events             *eventBroker         // Live events streamed to the admin UI
+	statsCache         *statsCache          // Recently computed admin dashboard stats
+	rulesHashes        *rulesHashCache      // Recently computed rules hashes for gateway heartbeats
+	adminNetworks      *adminAllowlistCache // The parsed admin_allowed_cidrs setting
+	notifications      *notify.Queue        // Background delivery of email and other notifications
 }
 
 // NewServer creates a new API server instance.
@@ -57,6 +82,9 @@ func NewServer(cfg *config.Config, logger *zap.Logger) (*Server, error) {
 
 	router := gin.New()
 
+	// Name fields in request validation errors as they're spelled in JSON
+	registerJSONFieldNames.Do(useJSONFieldNames)
+
 	// Add middleware
 	router.Use(gin.Recovery())
 	router.Use(zapLogger(logger))
@@ -66,7 +94,7 @@ func NewServer(cfg *config.Config, logger *zap.Logger) (*Server, error) {
 		router.Use(cors.New(cors.Config{
 			AllowOrigins:     cfg.Server.CORSOrigins,
 			AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-			AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
+			AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", tenantHeader},
 			ExposeHeaders:    []string{"Content-Length"},
 			AllowCredentials: true,
 			MaxAge:           12 * time.Hour,
@@ -75,7 +103,9 @@ func NewServer(cfg *config.Config, logger *zap.Logger) (*Server, error) {
 
 	// Configure trusted proxies
 	if len(cfg.Server.TrustedProxies) > 0 {
-		_ = router.SetTrustedProxies(cfg.Server.TrustedProxies) // Ignore error, will use defaults
+		if err := router.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+			return nil, fmt.Errorf("invalid server.trusted_proxies: %w", err)
+		}
 	}
 
 	// Initialize database connection
@@ -84,6 +114,9 @@ func NewServer(cfg *config.Config, logger *zap.Logger) (*Server, error) {
 	if err != nil {
 		return nil, err
 	}
+	if database.Secrets, err = cfg.Database.Encryption.Keyring(); err != nil {
+		return nil, fmt.Errorf("invalid database.encryption: %w", err)
+	}
 
 	// Initialize stores
 	userStore := db.NewUserStore(database)
@@ -97,9 +130,14 @@ func NewServer(cfg *config.Config, logger *zap.Logger) (*Server, error) {
 	pkiStore := db.NewPKIStore(database)
 	proxyAppStore := db.NewProxyApplicationStore(database)
 	loginLogStore := db.NewLoginLogStore(database)
+	connectionStore := db.NewConnectionStore(database)
+	auditStore := db.NewAuditStore(database)
 	meshStore := db.NewMeshStore(database)
 	meshConfigStore := db.NewMeshConfigStore(database)
+	meshEventStore := db.NewMeshEventStore(database)
 	apiKeyStore := db.NewAPIKeyStore(database)
+	changeStore := db.NewChangeStore(database)
+	tenantStore := db.NewTenantStore(database)
 
 	// Initialize PKI with database store for CA persistence
 	// This ensures all pods share the same CA
@@ -124,27 +162,47 @@ func NewServer(cfg *config.Config, logger *zap.Logger) (*Server, error) {
 	}
 
 	srv := &Server{
-		config:          cfg,
-		logger:          logger,
-		router:          router,
-		db:              database,
-		userStore:       userStore,
-		providerStore:   providerStore,
-		stateStore:      stateStore,
-		configStore:     configStore,
-		gatewayStore:    gatewayStore,
-		networkStore:    networkStore,
-		accessRuleStore: accessRuleStore,
-		settingsStore:   settingsStore,
-		pkiStore:        pkiStore,
-		proxyAppStore:   proxyAppStore,
-		loginLogStore:   loginLogStore,
-		meshStore:       meshStore,
-		meshConfigStore: meshConfigStore,
-		apiKeyStore:     apiKeyStore,
-		ca:              ca,
-		configGen:       configGen,
-		adminPassword:   adminPassword,
+		config:             cfg,
+		logger:             logger,
+		router:             router,
+		db:                 database,
+		userStore:          userStore,
+		providerStore:      providerStore,
+		stateStore:         stateStore,
+		configStore:        configStore,
+		gatewayStore:       gatewayStore,
+		networkStore:       networkStore,
+		accessRuleStore:    accessRuleStore,
+		settingsStore:      settingsStore,
+		pkiStore:           pkiStore,
+		proxyAppStore:      proxyAppStore,
+		loginLogStore:      loginLogStore,
+		connectionStore:    connectionStore,
+		auditStore:         auditStore,
+		meshStore:          meshStore,
+		meshConfigStore:    meshConfigStore,
+		meshEventStore:     meshEventStore,
+		apiKeyStore:        apiKeyStore,
+		changeStore:        changeStore,
+		tenantStore:        tenantStore,
+		statsStore:         db.NewStatsStore(database),
+		policyStore:        db.NewPolicyStore(database),
+		accessRequestStore: db.NewAccessRequestStore(database),
+		provisioningStore:  db.NewProvisioningStore(database),
+		maintenanceStore:   db.NewMaintenanceStore(database),
+		ca:                 ca,
+		configGen:          configGen,
+		adminPassword:      adminPassword,
+		geoip:              geoip.New(geoipConfig(cfg.GeoIP), logger),
+		geoipQueue:         make(chan geoIPJob, geoIPQueueSize),
+		ldapClients:        newLDAPClients(),
+		mailer:             mail.New(mailConfig(cfg.SMTP)),
+		gatewayMetrics:     newGatewayReports(),
+		binaryDigests:      newBinaryDigests(),
+		events:             newEventBroker(),
+		statsCache:         newStatsCache(),
+		rulesHashes:        newRulesHashCache(),
+		adminNetworks:      &adminAllowlistCache{},
 	}
 
 	// Save admin password to Kubernetes secret if created
@@ -176,6 +234,8 @@ func NewServer(cfg *config.Config, logger *zap.Logger) (*Server, error) {
 		logger.Info("==============================================")
 	}
 
+	srv.notifications = srv.newNotificationQueue(db.NewNotificationStore(database))
+
 	// Initialize session manager for remote sessions
 	srv.sessionMgr = session.NewManager(logger)
 	srv.sessionMgr.ValidateAgentToken = srv.validateAgentToken
@@ -189,18 +249,32 @@ func NewServer(cfg *config.Config, logger *zap.Logger) (*Server, error) {
 	go srv.runGatewayHealthCheck(bgCtx)
 	go srv.runConfigCleanup(bgCtx)
 	go srv.runLoginLogCleanup(bgCtx)
+	go srv.runStateCleanup(bgCtx)
+	go srv.runDeletedPurge(bgCtx)
+	go srv.runAccessGrantExpiry(bgCtx)
+	go srv.runUserInactivity(bgCtx)
+	go srv.runMaintenanceWindows(bgCtx)
+	go srv.runAuditAnchoring(bgCtx)
+	go srv.runGeoIPLookups(bgCtx)
+	go srv.notifications.Run(bgCtx)
 
 	return srv, nil
 }
 
 // setupRoutes configures all API routes.
 func (s *Server) setupRoutes() {
+	// Checks requests forwarded by a gateway's config proxy
+	s.router.Use(s.gatewayConfigProxy())
+
+	// Scopes user and admin requests to the caller's tenant
+	s.router.Use(s.tenantScope())
+
 	// Health check
 	s.router.GET("/health", s.healthCheck)
 	s.router.GET("/ready", s.readyCheck)
 
 	// API v1 routes
-	v1 := s.router.Group("/api/v1")
+	v1 := s.router.Group("/api/v1", s.requestBodyLimit())
 	{
 		// Authentication routes
 		auth := v1.Group("/auth")
@@ -218,12 +292,24 @@ func (s *Server) setupRoutes() {
 			auth.GET("/cli/login", s.handleCLILogin)
 			auth.GET("/cli/complete", s.handleCLIComplete)
 			auth.GET("/cli/callback", s.handleCLICallback)
+			auth.POST("/cli/exchange", s.handleCLIExchange)
 			auth.POST("/refresh", s.handleTokenRefresh)
 
 			// Local authentication (for initial setup)
 			auth.POST("/local/login", s.handleLocalLogin)
 			auth.POST("/local/change-password", s.handleChangePassword)
 
+			// Passwordless email login for local users
+			auth.POST("/magic/request", s.handleMagicLinkRequest)
+			auth.GET("/magic/verify", s.handleMagicLinkVerify)
+
+			// "This wasn't me" links from new sign-in emails
+			auth.GET("/sign-in/report", s.handleSignInReportPage)
+			auth.POST("/sign-in/report", s.handleSignInReport)
+
+			// LDAP / Active Directory authentication
+			auth.POST("/ldap/login", s.handleLDAPLogin)
+
 			// Session management
 			auth.POST("/logout", s.handleLogout)
 			auth.GET("/session", s.handleGetSession)
@@ -231,10 +317,13 @@ func (s *Server) setupRoutes() {
 		}
 
 		// Admin settings routes (requires admin auth)
-		settings := v1.Group("/admin/settings")
+		settings := v1.Group("/admin/settings", s.requireAdminNetwork())
 		{
-			settings.GET("", s.handleGetSettings)
-			settings.PUT("", s.handleUpdateSettings)
+			// Global settings and the CA are shared by every tenant
+			platformSettings := settings.Group("", s.platformOnly())
+
+			platformSettings.GET("", s.handleGetSettings)
+			platformSettings.PUT("", s.handleUpdateSettings)
 			settings.GET("/oidc", s.handleGetOIDCProvidersDynamic)
 			settings.POST("/oidc", s.handleCreateOIDCProviderDynamic)
 			settings.PUT("/oidc/:name", s.handleUpdateOIDCProviderDynamic)
@@ -243,16 +332,24 @@ func (s *Server) setupRoutes() {
 			settings.POST("/saml", s.handleCreateSAMLProviderDynamic)
 			settings.PUT("/saml/:name", s.handleUpdateSAMLProviderDynamic)
 			settings.DELETE("/saml/:name", s.handleDeleteSAMLProviderDynamic)
+			settings.GET("/ldap", s.handleGetLDAPProvidersDynamic)
+			settings.POST("/ldap", s.handleCreateLDAPProviderDynamic)
+			settings.PUT("/ldap/:name", s.handleUpdateLDAPProviderDynamic)
+			settings.DELETE("/ldap/:name", s.handleDeleteLDAPProviderDynamic)
 			// CA management
-			settings.GET("/ca", s.handleGetCA)
-			settings.POST("/ca/rotate", s.handleRotateCA)
-			settings.PUT("/ca", s.handleUpdateCA)
+			platformSettings.GET("/ca", s.handleGetCA)
+			platformSettings.POST("/ca/rotate", s.handleRotateCA)
+			platformSettings.PUT("/ca", s.handleUpdateCA)
+			platformSettings.POST("/ca/import", s.handleImportPKI)
 			// Graceful CA rotation
-			settings.GET("/ca/list", s.handleListCAs)
-			settings.POST("/ca/prepare-rotation", s.handlePrepareCARotation)
-			settings.POST("/ca/activate/:id", s.handleActivateCA)
-			settings.POST("/ca/revoke/:id", s.handleRevokeCA)
-			settings.GET("/ca/fingerprint", s.handleGetCAFingerprint)
+			platformSettings.GET("/ca/list", s.handleListCAs)
+			platformSettings.POST("/ca/prepare-rotation", s.handlePrepareCARotation)
+			platformSettings.POST("/ca/activate/:id", s.handleActivateCA)
+			platformSettings.POST("/ca/revoke/:id", s.handleRevokeCA)
+			platformSettings.GET("/ca/fingerprint", s.handleGetCAFingerprint)
+			platformSettings.GET("/ca/maintenance-windows", s.handleListMaintenanceWindows)
+			platformSettings.POST("/ca/maintenance-windows", s.handleScheduleMaintenanceWindow)
+			platformSettings.POST("/ca/maintenance-windows/:id/cancel", s.handleCancelMaintenanceWindow)
 		}
 
 		// Config generation routes
@@ -291,8 +388,11 @@ func (s *Server) setupRoutes() {
 			gateway.POST("/disconnect", s.handleGatewayDisconnect)
 			gateway.POST("/heartbeat", s.handleGatewayHeartbeat)
 			gateway.POST("/provision", s.handleGatewayProvision)
+			gateway.POST("/config-version", s.handleGatewayConfigVersion)
 			gateway.POST("/client-rules", s.handleGatewayClientRules)
 			gateway.POST("/all-rules", s.handleGatewayAllRules)
+			gateway.POST("/server-config", s.handleGatewayServerConfig)
+			gateway.POST("/denied-traffic", s.handleGatewayDeniedTraffic)
 		}
 
 		// Mesh Hub internal routes (hub → control plane communication)
@@ -329,33 +429,65 @@ func (s *Server) setupRoutes() {
 		{
 			users.GET("/me", s.handleGetCurrentUser)
 			users.GET("/me/connections", s.handleGetUserConnections)
+			users.GET("/me/denied-traffic", s.handleGetMyDeniedTraffic)
 		}
 
 		// Gateway listing for authenticated users
 		v1.GET("/gateways", s.handleListUserGateways)
+		v1.GET("/gateways/:id/reachable", s.handleGetReachableNetworks)
+		v1.GET("/gateways/:id/connect-summary", s.handleGetConnectSummary)
+
+		// Self-service access requests
+		v1.GET("/access-requests", s.handleListMyAccessRequests)
+		v1.POST("/access-requests", s.handleCreateAccessRequest)
+		v1.GET("/access-requests/requestable", s.handleListRequestableAccess)
+		v1.POST("/access-requests/:id/cancel", s.handleCancelAccessRequest)
+
+		// Live connection, gateway and login events (server-sent events)
+		v1.GET("/events", s.handleEventStream)
 
 		// Server info for clients (includes FIPS requirements)
 		v1.GET("/server/info", s.handleGetServerInfo)
 
 		// Admin routes
-		admin := v1.Group("/admin")
+		admin := v1.Group("/admin", s.requireAdminNetwork())
 		{
+			// Changes in these categories can be held for a second admin's approval
+			ruleChanges := s.requireApproval(changeCategoryAccessRules)
+			gatewayChanges := s.requireApproval(changeCategoryGatewayAssignments)
+
+			// Resources shared by every tenant, such as mesh hubs and proxy apps,
+			// are managed by platform admins when multi-tenancy is enabled
+			platform := admin.Group("", s.platformOnly())
+
 			admin.GET("/gateways", s.handleListGateways)
 			admin.POST("/gateways", s.handleRegisterGateway)
 			admin.PUT("/gateways/:id", s.handleUpdateGateway)
+			admin.PUT("/gateways/:id/state", unlessDryRun(gatewayChanges), s.handleApplyGatewayState)
 			admin.DELETE("/gateways/:id", s.handleDeleteGateway)
 			admin.POST("/gateways/:id/reprovision", s.handleReprovisionGateway)
+			admin.POST("/reprovision", s.handleBulkReprovision)
+			admin.GET("/reprovision/progress", s.handleReprovisionProgress)
+			admin.POST("/gateways/:id/restore", s.handleRestoreGateway)
+			admin.GET("/gateways/:id/server-config", s.handleGetGatewayServerConfig)
+			admin.GET("/gateways/:id/denied-traffic", s.handleGetGatewayDeniedTraffic)
 			admin.GET("/gateways/:id/networks", s.handleGetGatewayNetworks)
-			admin.POST("/gateways/:id/networks", s.handleAssignGatewayNetwork)
-			admin.DELETE("/gateways/:id/networks/:networkId", s.handleRemoveGatewayNetwork)
+			admin.POST("/gateways/:id/networks", gatewayChanges, s.handleAssignGatewayNetwork)
+			admin.DELETE("/gateways/:id/networks/:networkId", gatewayChanges, s.handleRemoveGatewayNetwork)
 			admin.GET("/gateways/:id/users", s.handleGetGatewayUsers)
-			admin.POST("/gateways/:id/users", s.handleAssignGatewayUser)
-			admin.DELETE("/gateways/:id/users/:userId", s.handleRemoveGatewayUser)
+			admin.POST("/gateways/:id/users", gatewayChanges, s.handleAssignGatewayUser)
+			admin.DELETE("/gateways/:id/users/:userId", gatewayChanges, s.handleRemoveGatewayUser)
 			admin.GET("/gateways/:id/groups", s.handleGetGatewayGroups)
-			admin.POST("/gateways/:id/groups", s.handleAssignGatewayGroup)
-			admin.DELETE("/gateways/:id/groups/:groupName", s.handleRemoveGatewayGroup)
+			admin.GET("/gateways/:id/access-review", s.handleGatewayAccessReview)
+			admin.POST("/gateways/:id/groups", gatewayChanges, s.handleAssignGatewayGroup)
+			admin.DELETE("/gateways/:id/groups/:groupName", gatewayChanges, s.handleRemoveGatewayGroup)
 			admin.GET("/connections", s.handleListConnections)
+			admin.GET("/connections/export", s.handleExportConnections)
+			admin.POST("/providers/oidc/:name/test", s.handleTestOIDCProvider)
+			admin.POST("/providers/saml/:name/test", s.handleTestSAMLProvider)
+			admin.POST("/providers/ldap/:name/test", s.handleTestLDAPProvider)
 			admin.GET("/audit", s.handleGetAuditLogs)
+			platform.GET("/audit/verify", s.handleVerifyAuditChain)
 
 			// Network management
 			admin.GET("/networks", s.handleListNetworks)
@@ -363,103 +495,143 @@ func (s *Server) setupRoutes() {
 			admin.GET("/networks/:id", s.handleGetNetwork)
 			admin.PUT("/networks/:id", s.handleUpdateNetwork)
 			admin.DELETE("/networks/:id", s.handleDeleteNetwork)
+			admin.POST("/networks/:id/restore", s.handleRestoreNetwork)
 			admin.GET("/networks/:id/gateways", s.handleGetNetworkGateways)
 			admin.GET("/networks/:id/access-rules", s.handleGetNetworkAccessRules)
+			admin.GET("/networks/:id/access-review", s.handleNetworkAccessReview)
 
 			// Access rules management
 			admin.GET("/access-rules", s.handleListAccessRules)
-			admin.POST("/access-rules", s.handleCreateAccessRule)
+			admin.GET("/access-rules/lint", s.handleLintAccessRules)
+			admin.POST("/access-rules", ruleChanges, s.handleCreateAccessRule)
 			admin.GET("/access-rules/:id", s.handleGetAccessRule)
-			admin.PUT("/access-rules/:id", s.handleUpdateAccessRule)
-			admin.DELETE("/access-rules/:id", s.handleDeleteAccessRule)
-			admin.POST("/access-rules/:id/users", s.handleAssignRuleToUser)
-			admin.DELETE("/access-rules/:id/users/:userId", s.handleRemoveRuleFromUser)
-			admin.POST("/access-rules/:id/groups", s.handleAssignRuleToGroup)
-			admin.DELETE("/access-rules/:id/groups/:groupName", s.handleRemoveRuleFromGroup)
+			admin.PUT("/access-rules/:id", ruleChanges, s.handleUpdateAccessRule)
+			admin.DELETE("/access-rules/:id", ruleChanges, s.handleDeleteAccessRule)
+			admin.POST("/access-rules/:id/users", ruleChanges, s.handleAssignRuleToUser)
+			admin.DELETE("/access-rules/:id/users/:userId", ruleChanges, s.handleRemoveRuleFromUser)
+			admin.POST("/access-rules/:id/groups", ruleChanges, s.handleAssignRuleToGroup)
+			admin.DELETE("/access-rules/:id/groups/:groupName", ruleChanges, s.handleRemoveRuleFromGroup)
 
 			// User management
 			admin.GET("/users", s.handleListUsers)
 			admin.GET("/users/:id", s.handleGetUser)
 			admin.GET("/users/:id/access-rules", s.handleGetUserAccessRules)
+			admin.GET("/users/:id/access-exceptions", s.handleListUserAccessExceptions)
+			admin.POST("/users/:id/access-exceptions", ruleChanges, s.handleCreateUserAccessException)
+			admin.DELETE("/users/:id/access-exceptions/:exceptionId", ruleChanges, s.handleDeleteUserAccessException)
+			admin.GET("/users/:id/access-history", s.handleGetUserAccessHistory)
+			admin.GET("/users/:id/group-history", s.handleGetUserGroupHistory)
 			admin.GET("/users/:id/gateways", s.handleGetUserGateways)
-			admin.POST("/users/:id/gateways", s.handleAssignUserGateway)
-			admin.DELETE("/users/:id/gateways/:gatewayId", s.handleRemoveUserGateway)
+			admin.POST("/users/:id/gateways", gatewayChanges, s.handleAssignUserGateway)
+			admin.DELETE("/users/:id/gateways/:gatewayId", gatewayChanges, s.handleRemoveUserGateway)
 			admin.POST("/users/:id/revoke-configs", s.handleAdminRevokeUserConfigs)
 			admin.GET("/users/:id/configs", s.handleAdminListUserConfigs)
-			admin.GET("/users/:id/mesh-configs", s.handleAdminListUserMeshConfigs)
+			platform.GET("/users/:id/mesh-configs", s.handleAdminListUserMeshConfigs)
+			admin.POST("/users/:id/reactivate", s.handleReactivateUser)
 
 			// Config management (admin)
 			admin.POST("/configs/:id/revoke", s.handleAdminRevokeConfig)
 			admin.GET("/local-users", s.handleListLocalUsers)
 			admin.POST("/local-users", s.handleCreateLocalUser)
 			admin.DELETE("/local-users/:id", s.handleDeleteLocalUser)
+			admin.POST("/local-users/:id/restore", s.handleRestoreLocalUser)
+			admin.POST("/local-users/:id/reactivate", s.handleReactivateLocalUser)
+
+			// Deactivating users who haven't been active for a while
+			platform.GET("/user-inactivity", s.handleGetUserInactivity)
+			platform.PUT("/user-inactivity", s.handleSetUserInactivity)
 
 			// Group management
 			admin.GET("/groups", s.handleListGroups)
 			admin.GET("/groups/:name/members", s.handleGetGroupMembers)
 			admin.GET("/groups/:name/access-rules", s.handleGetGroupAccessRules)
+			admin.POST("/groups/:name/access-rules", ruleChanges, s.handleAssignGroupAccessRules)
+			admin.GET("/groups/:name/connection-limit", s.handleGetGroupConnectionLimit)
+			admin.PUT("/groups/:name/connection-limit", s.handleSetGroupConnectionLimit)
+			admin.DELETE("/groups/:name/connection-limit", s.handleDeleteGroupConnectionLimit)
 
 			// Proxy application management
-			admin.GET("/proxy-apps", s.handleListProxyApps)
-			admin.POST("/proxy-apps", s.handleCreateProxyApp)
-			admin.GET("/proxy-apps/:id", s.handleGetProxyApp)
-			admin.PUT("/proxy-apps/:id", s.handleUpdateProxyApp)
-			admin.DELETE("/proxy-apps/:id", s.handleDeleteProxyApp)
-			admin.GET("/proxy-apps/:id/users", s.handleGetProxyAppUsers)
-			admin.POST("/proxy-apps/:id/users", s.handleAssignProxyAppToUser)
-			admin.DELETE("/proxy-apps/:id/users/:userId", s.handleRemoveProxyAppFromUser)
-			admin.GET("/proxy-apps/:id/groups", s.handleGetProxyAppGroups)
-			admin.POST("/proxy-apps/:id/groups", s.handleAssignProxyAppToGroup)
-			admin.DELETE("/proxy-apps/:id/groups/:groupName", s.handleRemoveProxyAppFromGroup)
-			admin.GET("/proxy-apps/:id/logs", s.handleGetProxyAppLogs)
+			platform.GET("/proxy-apps", s.handleListProxyApps)
+			platform.POST("/proxy-apps", s.handleCreateProxyApp)
+			platform.GET("/proxy-apps/:id", s.handleGetProxyApp)
+			platform.PUT("/proxy-apps/:id", s.handleUpdateProxyApp)
+			platform.DELETE("/proxy-apps/:id", s.handleDeleteProxyApp)
+			platform.GET("/proxy-apps/:id/users", s.handleGetProxyAppUsers)
+			platform.POST("/proxy-apps/:id/users", s.handleAssignProxyAppToUser)
+			platform.DELETE("/proxy-apps/:id/users/:userId", s.handleRemoveProxyAppFromUser)
+			platform.GET("/proxy-apps/:id/groups", s.handleGetProxyAppGroups)
+			platform.POST("/proxy-apps/:id/groups", s.handleAssignProxyAppToGroup)
+			platform.DELETE("/proxy-apps/:id/groups/:groupName", s.handleRemoveProxyAppFromGroup)
+			platform.GET("/proxy-apps/:id/logs", s.handleGetProxyAppLogs)
 
 			// Login logs / monitoring
 			admin.GET("/login-logs", s.handleListLoginLogs)
 			admin.GET("/login-logs/stats", s.handleGetLoginLogStats)
+			admin.GET("/stats", s.handleGetAdminStats)
+			admin.GET("/login-logs/export", s.handleExportLoginLogs)
 			admin.DELETE("/login-logs", s.handlePurgeLoginLogs)
-			admin.GET("/login-logs/retention", s.handleGetLoginLogRetention)
-			admin.PUT("/login-logs/retention", s.handleSetLoginLogRetention)
+			platform.GET("/login-logs/retention", s.handleGetLoginLogRetention)
+			platform.PUT("/login-logs/retention", s.handleSetLoginLogRetention)
+
+			// Approval queue for changes held by policy.require_approval
+			admin.GET("/changes", s.handleListChanges)
+			admin.GET("/changes/:id", s.handleGetChange)
+			admin.POST("/changes/:id/approve", s.handleApproveChange)
+			admin.POST("/changes/:id/reject", s.handleRejectChange)
+
+			// Access request queue
+			admin.GET("/access-requests", s.handleAdminListAccessRequests)
+			admin.POST("/access-requests/:id/approve", s.handleApproveAccessRequest)
+			admin.POST("/access-requests/:id/reject", s.handleRejectAccessRequest)
+
+			// Recently deleted gateways, networks and local users
+			admin.GET("/deleted", s.handleListDeleted)
+			platform.GET("/deleted/retention", s.handleGetDeletedRetention)
+			platform.PUT("/deleted/retention", s.handleSetDeletedRetention)
 
 			// Mesh Hub management
-			admin.GET("/mesh/hubs", s.handleListMeshHubs)
-			admin.POST("/mesh/hubs", s.handleCreateMeshHub)
-			admin.GET("/mesh/hubs/:id", s.handleGetMeshHub)
-			admin.PUT("/mesh/hubs/:id", s.handleUpdateMeshHub)
-			admin.DELETE("/mesh/hubs/:id", s.handleDeleteMeshHub)
-			admin.POST("/mesh/hubs/:id/provision", s.handleProvisionMeshHub)
-			admin.GET("/mesh/hubs/:id/install-script", s.handleMeshHubInstallScript)
-			admin.GET("/mesh/hubs/:id/users", s.handleGetMeshHubUsers)
-			admin.POST("/mesh/hubs/:id/users", s.handleAssignMeshHubUser)
-			admin.DELETE("/mesh/hubs/:id/users/:userId", s.handleRemoveMeshHubUser)
-			admin.GET("/mesh/hubs/:id/groups", s.handleGetMeshHubGroups)
-			admin.POST("/mesh/hubs/:id/groups", s.handleAssignMeshHubGroup)
-			admin.DELETE("/mesh/hubs/:id/groups/:groupName", s.handleRemoveMeshHubGroup)
-			admin.GET("/mesh/hubs/:id/networks", s.handleGetMeshHubNetworks)
-			admin.POST("/mesh/hubs/:id/networks", s.handleAssignMeshHubNetwork)
-			admin.DELETE("/mesh/hubs/:id/networks/:networkId", s.handleRemoveMeshHubNetwork)
+			platform.GET("/mesh/hubs", s.handleListMeshHubs)
+			platform.POST("/mesh/hubs", s.handleCreateMeshHub)
+			platform.GET("/mesh/hubs/:id", s.handleGetMeshHub)
+			platform.PUT("/mesh/hubs/:id", s.handleUpdateMeshHub)
+			platform.DELETE("/mesh/hubs/:id", s.handleDeleteMeshHub)
+			platform.POST("/mesh/hubs/:id/provision", s.handleProvisionMeshHub)
+			platform.GET("/mesh/hubs/:id/install-script", s.handleMeshHubInstallScript)
+			platform.GET("/mesh/hubs/:id/users", s.handleGetMeshHubUsers)
+			platform.POST("/mesh/hubs/:id/users", s.handleAssignMeshHubUser)
+			platform.DELETE("/mesh/hubs/:id/users/:userId", s.handleRemoveMeshHubUser)
+			platform.GET("/mesh/hubs/:id/groups", s.handleGetMeshHubGroups)
+			platform.POST("/mesh/hubs/:id/groups", s.handleAssignMeshHubGroup)
+			platform.DELETE("/mesh/hubs/:id/groups/:groupName", s.handleRemoveMeshHubGroup)
+			platform.GET("/mesh/hubs/:id/networks", s.handleGetMeshHubNetworks)
+			platform.POST("/mesh/hubs/:id/networks", s.handleAssignMeshHubNetwork)
+			platform.DELETE("/mesh/hubs/:id/networks/:networkId", s.handleRemoveMeshHubNetwork)
 
 			// Mesh Spoke management
-			admin.GET("/mesh/hubs/:id/spokes", s.handleListMeshSpokes)
-			admin.POST("/mesh/hubs/:id/spokes", s.handleCreateMeshSpoke)
-			admin.GET("/mesh/spokes/:id", s.handleGetMeshSpoke)
-			admin.PUT("/mesh/spokes/:id", s.handleUpdateMeshSpoke)
-			admin.DELETE("/mesh/spokes/:id", s.handleDeleteMeshSpoke)
-			admin.POST("/mesh/spokes/:id/provision", s.handleProvisionMeshSpoke)
-			admin.GET("/mesh/spokes/:id/install-script", s.handleMeshSpokeInstallScript)
-			admin.GET("/mesh/spokes/:id/users", s.handleGetMeshSpokeUsers)
-			admin.POST("/mesh/spokes/:id/users", s.handleAssignMeshSpokeUser)
-			admin.DELETE("/mesh/spokes/:id/users/:userId", s.handleRemoveMeshSpokeUser)
-			admin.GET("/mesh/spokes/:id/groups", s.handleGetMeshSpokeGroups)
-			admin.POST("/mesh/spokes/:id/groups", s.handleAssignMeshSpokeGroup)
-			admin.DELETE("/mesh/spokes/:id/groups/:groupName", s.handleRemoveMeshSpokeGroup)
+			platform.GET("/mesh/hubs/:id/spokes", s.handleListMeshSpokes)
+			platform.POST("/mesh/hubs/:id/spokes", s.handleCreateMeshSpoke)
+			platform.GET("/mesh/spokes/:id", s.handleGetMeshSpoke)
+			platform.PUT("/mesh/spokes/:id", s.handleUpdateMeshSpoke)
+			platform.DELETE("/mesh/spokes/:id", s.handleDeleteMeshSpoke)
+			platform.POST("/mesh/spokes/:id/provision", s.handleProvisionMeshSpoke)
+			platform.GET("/mesh/spokes/:id/install-script", s.handleMeshSpokeInstallScript)
+			platform.GET("/mesh/spokes/:id/users", s.handleGetMeshSpokeUsers)
+			platform.POST("/mesh/spokes/:id/users", s.handleAssignMeshSpokeUser)
+			platform.DELETE("/mesh/spokes/:id/users/:userId", s.handleRemoveMeshSpokeUser)
+			platform.GET("/mesh/spokes/:id/groups", s.handleGetMeshSpokeGroups)
+			platform.POST("/mesh/spokes/:id/groups", s.handleAssignMeshSpokeGroup)
+			platform.DELETE("/mesh/spokes/:id/groups/:groupName", s.handleRemoveMeshSpokeGroup)
+			platform.GET("/mesh/events", s.handleListMeshEvents)
 
 			// Admin config management (gateway configs)
 			admin.GET("/configs", s.handleAdminListAllConfigs)
+			admin.GET("/unused-access", s.handleListUnusedAccess)
+			platform.GET("/notifications/queue", s.handleGetNotificationQueue)
 
 			// Admin mesh config management
-			admin.GET("/mesh-configs", s.handleAdminListMeshConfigs)
-			admin.POST("/mesh-configs/:id/revoke", s.handleAdminRevokeMeshConfig)
-			admin.POST("/users/:id/revoke-mesh-configs", s.handleAdminRevokeMeshUserConfigs)
+			platform.GET("/mesh-configs", s.handleAdminListMeshConfigs)
+			platform.POST("/mesh-configs/:id/revoke", s.handleAdminRevokeMeshConfig)
+			platform.POST("/users/:id/revoke-mesh-configs", s.handleAdminRevokeMeshUserConfigs)
 
 			// API key management (admin)
 			admin.GET("/api-keys", s.handleAdminListAPIKeys)
@@ -472,13 +644,19 @@ func (s *Server) setupRoutes() {
 			admin.DELETE("/users/:id/api-keys/all", s.handleAdminDeleteUserAPIKeys)
 
 			// Topology and network tools
-			admin.GET("/topology", s.handleGetTopology)
-			admin.GET("/sessions/active", s.handleGetActiveSessions)
-			admin.GET("/network-tools", s.handleListNetworkTools)
-			admin.POST("/network-tools/execute", s.handleExecuteNetworkTool)
+			platform.GET("/topology", s.handleGetTopology)
+			platform.GET("/sessions/active", s.handleGetActiveSessions)
+			platform.GET("/network-tools", s.handleListNetworkTools)
+			platform.POST("/network-tools/execute", s.handleExecuteNetworkTool)
 
 			// Remote session agents
-			admin.GET("/remote-session/agents", s.handleGetConnectedAgents)
+			platform.GET("/remote-session/agents", s.handleGetConnectedAgents)
+
+			// Tenants (multi-tenancy only, platform admins)
+			admin.GET("/tenants", s.handleListTenants)
+			admin.POST("/tenants", s.handleCreateTenant)
+			admin.DELETE("/tenants/:id", s.handleDeleteTenant)
+			admin.PUT("/tenants/:id/local-users/:userId", s.handleSetLocalUserTenant)
 		}
 
 		// User API key management
@@ -534,7 +712,9 @@ func (s *Server) setupRoutes() {
 	// Downloads endpoints
 	s.router.GET("/downloads", s.handleDownloadsPage)
 	s.router.GET("/downloads/:filename", s.handleDownloadBinary)
+	s.router.HEAD("/downloads/:filename", s.handleDownloadBinary)
 	s.router.GET("/bin/:filename", s.handleDownloadBinary) // Alias for /downloads
+	s.router.HEAD("/bin/:filename", s.handleDownloadBinary)
 }
 
 // ListenAndServe starts the HTTP server.
@@ -567,6 +747,9 @@ func (s *Server) Shutdown(ctx context.Context) error {
 	if s.bgCancel != nil {
 		s.bgCancel()
 	}
+	if s.events != nil {
+		s.events.close()
+	}
 
 	if s.httpServer != nil {
 		return s.httpServer.Shutdown(ctx)
@@ -592,11 +775,14 @@ func (s *Server) runGatewayHealthCheck(ctx context.Context) {
 			s.logger.Info("Gateway health check stopped")
 			return
 		case <-ticker.C:
-			count, err := s.gatewayStore.MarkInactiveGateways(ctx, threshold)
+			gateways, err := s.gatewayStore.MarkInactiveGateways(ctx, threshold)
 			if err != nil {
 				s.logger.Error("Failed to mark inactive gateways", zap.Error(err))
-			} else if count > 0 {
-				s.logger.Info("Marked gateways as inactive", zap.Int64("count", count))
+			} else if len(gateways) > 0 {
+				s.logger.Info("Marked gateways as inactive", zap.Int("count", len(gateways)))
+			}
+			for _, gw := range gateways {
+				s.emitEvent(s.tenantContext(ctx, gw.TenantID), eventGatewayOffline, "", gw.ID, gin.H{"gatewayId": gw.ID, "gatewayName": gw.Name})
 			}
 		}
 	}
@@ -674,7 +860,8 @@ func (s *Server) cleanupExpiredConfigs(ctx context.Context) {
 	}
 }
 
-// runLoginLogCleanup periodically deletes old login logs based on retention setting
+// runLoginLogCleanup periodically deletes old login logs based on retention setting,
+// and mesh events older than meshEventRetentionDays
 func (s *Server) runLoginLogCleanup(ctx context.Context) {
 	// Run cleanup every 6 hours
 	ticker := time.NewTicker(6 * time.Hour)
@@ -684,6 +871,7 @@ func (s *Server) runLoginLogCleanup(ctx context.Context) {
 
 	// Run once at startup
 	s.cleanupOldLoginLogs(ctx)
+	s.cleanupOldMeshEvents(ctx)
 
 	for {
 		select {
@@ -692,6 +880,31 @@ func (s *Server) runLoginLogCleanup(ctx context.Context) {
 			return
 		case <-ticker.C:
 			s.cleanupOldLoginLogs(ctx)
+			s.cleanupOldMeshEvents(ctx)
+		}
+	}
+}
+
+// runStateCleanup periodically deletes expired login states, CLI exchange codes,
+// and SSO sessions, which are otherwise only removed when used
+func (s *Server) runStateCleanup(ctx context.Context) {
+	ticker := time.NewTicker(15 * time.Minute)
+	defer ticker.Stop()
+
+	s.logger.Info("Started login state cleanup background task", zap.Duration("interval", 15*time.Minute))
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.logger.Info("Login state cleanup stopped")
+			return
+		case <-ticker.C:
+			if err := s.stateStore.CleanupExpiredStates(ctx); err != nil {
+				s.logger.Error("Failed to clean up expired login states", zap.Error(err))
+			}
+			if err := s.stateStore.CleanupExpiredSSOSessions(ctx); err != nil {
+				s.logger.Error("Failed to clean up expired SSO sessions", zap.Error(err))
+			}
 		}
 	}
 }
@@ -0,0 +1,222 @@
+package api
+
+import (
+	cryptoRand "crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/gatekey-project/gatekey/internal/db"
+	"github.com/gatekey-project/gatekey/internal/mail"
+)
+
+const (
+	// signInHistoryLimit is how many recent logins a sign-in is compared against.
+	signInHistoryLimit = 200
+	// signInReportTTL is how long the "this wasn't me" link in a new sign-in
+	// email works.
+	signInReportTTL = 7 * 24 * time.Hour
+)
+
+// isNewSignIn reports whether a login comes from somewhere the user hasn't
+// logged in from before: an IP address none of their earlier successful logins
+// used, on a device (user agent) they haven't used from the same country. A
+// user's first login isn't new, since there's nothing to compare it to.
+func isNewSignIn(current *db.LoginLog, history []*db.LoginLog) bool {
+	seen := false
+	for _, prev := range history {
+		if prev.ID == current.ID || !prev.Success {
+			continue
+		}
+		seen = true
+		if prev.IPAddress == current.IPAddress {
+			return false
+		}
+		if prev.UserAgent == current.UserAgent && prev.CountryCode == current.CountryCode {
+			return false
+		}
+	}
+	return seen
+}
+
+// notifyNewSignIn emails a user about a successful login from a new device or
+// location, with a link to sign out everywhere if it wasn't them.
+func (s *Server) notifyNewSignIn(c *gin.Context, log *db.LoginLog) {
+	// The report link is only built from server.base_url, which config validation
+	// requires with alerts; the sign-in's Host header is the signer-in's to choose
+	baseURL := s.emailBaseURL()
+	if !s.config.Auth.NewSignInAlerts || !mail.Enabled(s.mailer) || log.UserEmail == "" || baseURL == "" {
+		return
+	}
+	ctx := c.Request.Context()
+
+	history, err := s.loginLogStore.GetUserLoginHistory(ctx, log.UserEmail, signInHistoryLimit)
+	if err != nil {
+		s.logger.Warn("Failed to read login history for new sign-in check", zap.Error(err))
+		return
+	}
+	if !isNewSignIn(log, history) {
+		return
+	}
+
+	// Login logs identify SSO users by provider and subject; sessions and configs
+	// use the user's ID
+	userID := log.UserID
+	if log.Provider != "local" {
+		session, err := s.stateStore.GetSSOSession(ctx, log.SessionID)
+		if err != nil {
+			s.logger.Warn("Failed to find session for new sign-in alert", zap.Error(err))
+			return
+		}
+		userID = session.UserID
+	}
+
+	tokenBytes := make([]byte, 32)
+	if _, err := cryptoRand.Read(tokenBytes); err != nil {
+		return
+	}
+	token := base64.RawURLEncoding.EncodeToString(tokenBytes)
+	alert := &db.SignInAlert{
+		UserID:    userID,
+		UserEmail: log.UserEmail,
+		Provider:  log.Provider,
+		IPAddress: log.IPAddress,
+	}
+	if err := s.loginLogStore.CreateSignInAlert(ctx, alert, token, time.Now().Add(signInReportTTL)); err != nil {
+		s.logger.Error("Failed to store sign-in alert", zap.Error(err))
+		return
+	}
+
+	location := strings.Trim(log.City+", "+log.Country, ", ")
+	if location == "" {
+		location = "unknown"
+	}
+	method := log.Provider
+	if log.ProviderName != "" {
+		method += " (" + log.ProviderName + ")"
+	}
+	name := log.UserName
+	if name == "" {
+		name = log.UserEmail
+	}
+	link := baseURL + "/api/v1/auth/sign-in/report?token=" + url.QueryEscape(token)
+	s.sendMail(&mail.Message{
+		To:      []string{log.UserEmail},
+		Subject: "New sign-in to GateKey",
+		Body: fmt.Sprintf("Hello %s,\n\n"+
+			"Your GateKey account was just used to sign in from a new device or location.\n\n"+
+			"Time: %s\nIP address: %s\nLocation: %s\nDevice: %s\nSign-in method: %s\n\n"+
+			"If this was you, you can ignore this email.\n\n"+
+			"If it wasn't, open the link below within %s to sign out all your sessions and revoke your VPN configs, then contact your administrator:\n\n"+
+			"%s\n",
+			name, time.Now().UTC().Format(time.RFC1123), log.IPAddress, location, log.UserAgent, method,
+			signInReportTTL, link),
+	})
+}
+
+var signInReportPage = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head><title>GateKey - Report sign-in</title></head>
+<body style="font-family: sans-serif; max-width: 600px; margin: 40px auto;">
+<h1>Report a sign-in</h1>
+{{if .Done}}<p>All your sessions have been signed out and {{.Revoked}} VPN config(s) revoked. Sign in again and contact your administrator.</p>
+{{else if .Error}}<p>{{.Error}}</p>
+{{else}}<p>A sign-in to {{.Email}} from {{.IPAddress}} at {{.Time}} was reported as new. If it wasn't you, sign out all your sessions and revoke your VPN configs.</p>
+<form method="POST"><input type="hidden" name="token" value="{{.Token}}"><button type="submit">This wasn't me</button></form>
+{{end}}</body>
+</html>`))
+
+type signInReportData struct {
+	Token, Email, IPAddress, Time, Error string
+	Done                                 bool
+	Revoked                              int64
+}
+
+func (s *Server) renderSignInReport(c *gin.Context, status int, data signInReportData) {
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.Status(status)
+	if err := signInReportPage.Execute(c.Writer, data); err != nil {
+		s.logger.Error("Failed to render sign-in report page", zap.Error(err))
+	}
+}
+
+// handleSignInReportPage shows a confirmation page for a "this wasn't me" link.
+// Acting needs a POST, so mail scanners that follow links can't sign users out.
+func (s *Server) handleSignInReportPage(c *gin.Context) {
+	token := c.Query("token")
+	alert, err := s.loginLogStore.GetSignInAlert(c.Request.Context(), token)
+	if err != nil {
+		s.renderSignInReport(c, http.StatusNotFound, signInReportData{Error: "This link is invalid, has expired, or was already used."})
+		return
+	}
+	s.renderSignInReport(c, http.StatusOK, signInReportData{
+		Token:     token,
+		Email:     alert.UserEmail,
+		IPAddress: alert.IPAddress,
+		Time:      alert.CreatedAt.UTC().Format(time.RFC1123),
+	})
+}
+
+// handleSignInReport signs a user out everywhere and revokes their VPN configs
+// after they report a sign-in that wasn't them.
+func (s *Server) handleSignInReport(c *gin.Context) {
+	ctx := c.Request.Context()
+	alert, err := s.loginLogStore.ConsumeSignInAlert(ctx, c.PostForm("token"))
+	if err != nil {
+		s.renderSignInReport(c, http.StatusNotFound, signInReportData{Error: "This link is invalid, has expired, or was already used."})
+		return
+	}
+
+	var sessions int64
+	if alert.Provider == "local" {
+		sessions, err = s.userStore.DeleteUserSessions(ctx, alert.UserID)
+	} else {
+		sessions, err = s.stateStore.DeleteUserSSOSessions(ctx, alert.UserID)
+	}
+	if err != nil {
+		s.logger.Error("Failed to sign out user after reported sign-in", zap.Error(err))
+		s.renderSignInReport(c, http.StatusInternalServerError, signInReportData{Error: "Signing you out failed. Contact your administrator."})
+		return
+	}
+
+	revoked, err := s.configStore.RevokeUserConfigs(ctx, alert.UserID, "sign-in reported by user")
+	if err != nil {
+		s.logger.Error("Failed to revoke configs after reported sign-in", zap.Error(err))
+		s.renderSignInReport(c, http.StatusInternalServerError, signInReportData{Error: "Revoking your VPN configs failed. Contact your administrator."})
+		return
+	}
+	s.noteRevocation(ctx)
+	if revoked > 0 {
+		s.emitEvent(ctx, eventConfigRevoked, alert.UserID, "", gin.H{
+			"userId":       alert.UserID,
+			"revokedCount": revoked,
+			"reason":       "sign-in reported by user",
+		})
+	}
+
+	s.logger.Warn("User reported a sign-in that wasn't them",
+		zap.String("email", alert.UserEmail),
+		zap.String("ip_address", alert.IPAddress),
+		zap.Int64("sessions", sessions),
+		zap.Int64("revoked_configs", revoked))
+	s.emitEvent(s.userTenantContext(ctx, alert.UserID), eventSignInReported, "", "", gin.H{
+		"userId":       alert.UserID,
+		"userEmail":    alert.UserEmail,
+		"ipAddress":    alert.IPAddress,
+		"revokedCount": revoked,
+	})
+	s.recordAudit(c, "user.sign_in_reported", "user", alert.UserID, gin.H{
+		"email":          alert.UserEmail,
+		"ipAddress":      alert.IPAddress,
+		"sessions":       sessions,
+		"revokedConfigs": revoked,
+	})
+	s.renderSignInReport(c, http.StatusOK, signInReportData{Done: true, Revoked: revoked})
+}
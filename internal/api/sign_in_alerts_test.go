@@ -0,0 +1,46 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/gatekey-project/gatekey/internal/db"
+)
+
+func TestIsNewSignIn(t *testing.T) {
+	laptop := "Mozilla/5.0 (Macintosh)"
+	phone := "Mozilla/5.0 (iPhone)"
+	current := &db.LoginLog{ID: "now", IPAddress: "198.51.100.7", UserAgent: laptop, CountryCode: "US", Success: true}
+
+	tests := []struct {
+		name    string
+		history []*db.LoginLog
+		want    bool
+	}{
+		{"first login", []*db.LoginLog{current}, false},
+		{"only failed logins before", []*db.LoginLog{
+			current,
+			{ID: "1", IPAddress: "203.0.113.9", UserAgent: phone, CountryCode: "DE"},
+		}, false},
+		{"same IP", []*db.LoginLog{
+			current,
+			{ID: "1", IPAddress: "198.51.100.7", UserAgent: phone, CountryCode: "US", Success: true},
+		}, false},
+		{"same device and country, new IP", []*db.LoginLog{
+			current,
+			{ID: "1", IPAddress: "198.51.100.20", UserAgent: laptop, CountryCode: "US", Success: true},
+		}, false},
+		{"same device from another country", []*db.LoginLog{
+			current,
+			{ID: "1", IPAddress: "203.0.113.9", UserAgent: laptop, CountryCode: "DE", Success: true},
+		}, true},
+		{"new device and IP", []*db.LoginLog{
+			current,
+			{ID: "1", IPAddress: "203.0.113.9", UserAgent: phone, CountryCode: "US", Success: true},
+		}, true},
+	}
+	for _, tt := range tests {
+		if got := isNewSignIn(current, tt.history); got != tt.want {
+			t.Errorf("%s: isNewSignIn = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// ssoGroupCheck is the outcome of comparing the groups an SSO login received
+// with those stored for the user.
+type ssoGroupCheck struct {
+	groups   []string // groups to store and put in the session
+	received []string // groups the identity provider sent
+	previous []string
+	changed  bool // whether the group set is worth recording
+	anomaly  bool // an empty set for a user who had groups
+}
+
+// checkSSOGroups decides which groups an SSO login gets. An identity provider
+// that returns no groups for a user who had some is more often misconfigured or
+// briefly failing than reporting a real change, so unless auth.empty_groups is
+// "apply" the previous groups are kept rather than wiping the user's access.
+func (s *Server) checkSSOGroups(ctx context.Context, provider, externalID, email string, received []string) ssoGroupCheck {
+	check := ssoGroupCheck{groups: received, received: received}
+	previous, found, err := s.userStore.SSOUserGroups(ctx, provider, externalID)
+	if err != nil {
+		s.logger.Warn("Failed to load stored groups for SSO user",
+			zap.String("email", email), zap.Error(err))
+		return check
+	}
+	check.previous = previous
+	check.changed = !found || !sameGroups(previous, received)
+	if len(received) > 0 || len(previous) == 0 {
+		return check
+	}
+
+	check.anomaly = true
+	retained := s.config.Auth.EmptyGroups != "apply"
+	if retained {
+		check.groups = previous
+	}
+	s.logger.Warn("Identity provider returned no groups for a user who had some",
+		zap.String("email", email),
+		zap.String("provider", provider),
+		zap.Strings("previousGroups", previous),
+		zap.Bool("retained", retained))
+	s.emitEvent(ctx, eventGroupsAnomaly, "", "", gin.H{
+		"userEmail":      email,
+		"providerName":   provider,
+		"previousGroups": previous,
+		"retained":       retained,
+	})
+	return check
+}
+
+// recordSSOGroups adds a login's group set to the user's group history when it
+// differs from what was stored.
+func (s *Server) recordSSOGroups(ctx context.Context, userID string, check ssoGroupCheck) {
+	if !check.changed {
+		return
+	}
+	if err := s.userStore.RecordGroupHistory(ctx, userID, check.groups, check.received, check.anomaly); err != nil {
+		s.logger.Warn("Failed to record group history", zap.String("user_id", userID), zap.Error(err))
+	}
+}
+
+// sameGroups reports whether two group lists hold the same groups, ignoring order.
+func sameGroups(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	a, b = slices.Clone(a), slices.Clone(b)
+	slices.Sort(a)
+	slices.Sort(b)
+	return slices.Equal(a, b)
+}
+
+// handleGetUserGroupHistory returns the group sets recently reported for an SSO
+// user, newest first.
+func (s *Server) handleGetUserGroupHistory(c *gin.Context) {
+	userID := c.Param("id")
+	ctx := c.Request.Context()
+
+	user, err := s.userStore.GetSSOUser(ctx, userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+
+	entries, err := s.userStore.ListGroupHistory(ctx, user.ID)
+	if err != nil {
+		s.logger.Error("Failed to list group history", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list group history"})
+		return
+	}
+
+	history := make([]gin.H, 0, len(entries))
+	for _, e := range entries {
+		history = append(history, gin.H{
+			"groups":    e.Groups,
+			"received":  e.Received,
+			"anomaly":   e.Anomaly,
+			"createdAt": e.CreatedAt,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"userId":  user.ID,
+		"email":   user.Email,
+		"groups":  user.Groups,
+		"history": history,
+	})
+}
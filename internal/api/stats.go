@@ -0,0 +1,106 @@
+package api
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/gatekey-project/gatekey/internal/db"
+)
+
+const (
+	// statsCacheTTL is how long a computed stats summary is served before it's
+	// recomputed. Dashboards poll it, and slightly stale numbers are fine.
+	statsCacheTTL = 30 * time.Second
+	// statsWindow is the period top users and login counts cover.
+	statsWindow = 7 * 24 * time.Hour
+	// statsTopUsers is how many of the most connected users are listed.
+	statsTopUsers = 10
+	// gatewayOnlineThreshold matches the heartbeat age the gateway lists use.
+	gatewayOnlineThreshold = 2 * time.Minute
+)
+
+// statsCache holds recent stats summaries, per tenant.
+type statsCache struct {
+	mu      sync.Mutex
+	entries map[string]statsCacheEntry
+}
+
+type statsCacheEntry struct {
+	stats   *db.AdminStats
+	expires time.Time
+}
+
+func newStatsCache() *statsCache {
+	return &statsCache{entries: make(map[string]statsCacheEntry)}
+}
+
+func (c *statsCache) get(key string, now time.Time) *db.AdminStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok || now.After(entry.expires) {
+		return nil
+	}
+	return entry.stats
+}
+
+func (c *statsCache) put(key string, stats *db.AdminStats, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = statsCacheEntry{stats: stats, expires: now.Add(statsCacheTTL)}
+}
+
+// handleGetAdminStats returns a summary of gateways, connections, issued configs,
+// logins and CA expiry for the admin dashboard.
+func (s *Server) handleGetAdminStats(c *gin.Context) {
+	user, err := s.getAuthenticatedUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		return
+	}
+	if !user.IsAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "admin access required"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	key, _ := db.TenantFromContext(ctx)
+	now := time.Now()
+
+	stats := s.statsCache.get(key, now)
+	if stats == nil {
+		stats, err = s.statsStore.AdminStats(ctx, statsWindow, gatewayOnlineThreshold, statsTopUsers)
+		if err != nil {
+			s.logger.Error("Failed to compute admin stats", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to compute stats"})
+			return
+		}
+		s.statsCache.put(key, stats, now)
+	}
+
+	ca := gin.H{}
+	if s.ca != nil {
+		if cert := s.ca.Certificate(); cert != nil {
+			ca = gin.H{
+				"notAfter":        cert.NotAfter.Format(time.RFC3339),
+				"daysUntilExpiry": int(time.Until(cert.NotAfter).Hours() / 24),
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"gateways":        stats.Gateways,
+		"connections":     stats.Connections,
+		"configsToday":    stats.ConfigsToday,
+		"configsThisWeek": stats.ConfigsThisWeek,
+		"topUsers":        stats.TopUsers,
+		"logins":          stats.Logins,
+		"ca":              ca,
+		"windowDays":      int(statsWindow.Hours() / 24),
+		"generatedAt":     stats.GeneratedAt.Format(time.RFC3339),
+	})
+}
@@ -0,0 +1,283 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/gatekey-project/gatekey/internal/db"
+)
+
+// tenantHeader lets a platform admin (an admin in the default tenant) act within
+// another tenant, identified by ID or slug.
+const tenantHeader = "X-GateKey-Tenant"
+
+// tenantSlugRegex matches tenant slugs, which appear in login page URLs.
+var tenantSlugRegex = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// Paths under /api/v1 that aren't scoped by the caller's tenant: login flows,
+// which work out the tenant from the provider, and gateway and mesh agents, which
+// are scoped by their gateway's tenant in the handlers.
+var unscopedTenantPrefixes = []string{
+	"/api/v1/auth/",
+	"/api/v1/gateway/",
+	"/api/v1/mesh-hub/",
+	"/api/v1/mesh-spoke/",
+	"/api/v1/mesh-gateway/",
+}
+
+// tenantScoped reports whether requests to a path are scoped to the caller's tenant.
+func tenantScoped(path string) bool {
+	if !strings.HasPrefix(path, "/api/v1/") {
+		return false
+	}
+	for _, prefix := range unscopedTenantPrefixes {
+		if strings.HasPrefix(path, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// tenantContext scopes store queries made with ctx to a tenant when multi-tenancy
+// is enabled.
+func (s *Server) tenantContext(ctx context.Context, tenantID string) context.Context {
+	if !s.config.Tenancy.Enabled || tenantID == "" {
+		return ctx
+	}
+	return db.WithTenant(ctx, tenantID)
+}
+
+// userTenantContext scopes ctx to a user's tenant when multi-tenancy is enabled
+// and ctx isn't scoped already, as in login flows and background jobs.
+func (s *Server) userTenantContext(ctx context.Context, userID string) context.Context {
+	if userID == "" || !s.config.Tenancy.Enabled {
+		return ctx
+	}
+	if _, ok := db.TenantFromContext(ctx); ok {
+		return ctx
+	}
+	tenantID, err := s.tenantStore.UserTenant(ctx, userID)
+	if err != nil {
+		return ctx
+	}
+	return db.WithTenant(ctx, tenantID)
+}
+
+// tenantScope scopes user and admin API requests to the caller's tenant when
+// multi-tenancy is enabled, so the stores only return that tenant's gateways,
+// networks, rules, providers and users. Admin requests must be authenticated to
+// be scoped at all.
+func (s *Server) tenantScope() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		path := c.Request.URL.Path
+		if !s.config.Tenancy.Enabled || !tenantScoped(path) {
+			c.Next()
+			return
+		}
+		ctx := c.Request.Context()
+
+		user, err := s.getAuthenticatedUser(c)
+		if err != nil {
+			if strings.HasPrefix(path, "/api/v1/admin/") {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+				return
+			}
+			// The handler rejects the request itself
+			c.Next()
+			return
+		}
+
+		tenantID, err := s.tenantStore.UserTenant(ctx, user.UserID)
+		if err != nil {
+			s.logger.Warn("Failed to resolve user's tenant", zap.String("user", user.Email), zap.Error(err))
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "user does not belong to a tenant"})
+			return
+		}
+
+		if requested := c.GetHeader(tenantHeader); requested != "" {
+			if !user.IsAdmin || tenantID != db.DefaultTenantID {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "only platform admins can act in another tenant"})
+				return
+			}
+			tenant, err := s.tenantStore.GetTenant(ctx, requested)
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "tenant not found"})
+				return
+			}
+			tenantID = tenant.ID
+		}
+
+		c.Request = c.Request.WithContext(db.WithTenant(ctx, tenantID))
+		c.Next()
+	}
+}
+
+// requirePlatformAdmin checks that multi-tenancy is enabled and the caller is an
+// admin in the default tenant, who manages the other tenants.
+func (s *Server) requirePlatformAdmin(c *gin.Context) bool {
+	if !s.config.Tenancy.Enabled {
+		c.JSON(http.StatusNotFound, gin.H{"error": "multi-tenancy is not enabled"})
+		return false
+	}
+	return s.checkPlatformAdmin(c)
+}
+
+// checkPlatformAdmin checks that the caller is an admin in the default tenant,
+// responding with an error if not.
+func (s *Server) checkPlatformAdmin(c *gin.Context) bool {
+	user, err := s.getAuthenticatedUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		return false
+	}
+	tenantID, err := s.tenantStore.UserTenant(c.Request.Context(), user.UserID)
+	if err != nil || !user.IsAdmin || tenantID != db.DefaultTenantID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "platform admin access required"})
+		return false
+	}
+	return true
+}
+
+// platformOnly restricts routes for resources every tenant shares, such as
+// global settings, the CA, mesh hubs and proxy applications, to platform admins
+// when multi-tenancy is enabled. Otherwise the handlers' own admin checks apply.
+func (s *Server) platformOnly() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if s.config.Tenancy.Enabled && !s.checkPlatformAdmin(c) {
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+func tenantJSON(t *db.Tenant) gin.H {
+	return gin.H{
+		"id":        t.ID,
+		"name":      t.Name,
+		"slug":      t.Slug,
+		"createdAt": t.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+func (s *Server) handleListTenants(c *gin.Context) {
+	if !s.requirePlatformAdmin(c) {
+		return
+	}
+	tenants, err := s.tenantStore.ListTenants(c.Request.Context())
+	if err != nil {
+		s.logger.Error("Failed to list tenants", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list tenants"})
+		return
+	}
+
+	result := make([]gin.H, 0, len(tenants))
+	for _, t := range tenants {
+		result = append(result, tenantJSON(t))
+	}
+	c.JSON(http.StatusOK, gin.H{"tenants": result})
+}
+
+func (s *Server) handleCreateTenant(c *gin.Context) {
+	if !s.requirePlatformAdmin(c) {
+		return
+	}
+	var req struct {
+		Name string `json:"name" binding:"required"`
+		Slug string `json:"slug" binding:"required"`
+	}
+	if !bindJSON(c, &req) {
+		return
+	}
+	if !tenantSlugRegex.MatchString(req.Slug) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "slug must be lowercase letters, digits and hyphens"})
+		return
+	}
+
+	tenant := &db.Tenant{Name: req.Name, Slug: req.Slug}
+	if err := s.tenantStore.CreateTenant(c.Request.Context(), tenant); err != nil {
+		if err == db.ErrTenantExists {
+			c.JSON(http.StatusConflict, gin.H{"error": "a tenant with this slug already exists"})
+			return
+		}
+		s.logger.Error("Failed to create tenant", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create tenant"})
+		return
+	}
+
+	s.recordAudit(c, "tenant.create", "tenant", tenant.ID, gin.H{"name": tenant.Name, "slug": tenant.Slug})
+	c.JSON(http.StatusCreated, tenantJSON(tenant))
+}
+
+func (s *Server) handleDeleteTenant(c *gin.Context) {
+	if !s.requirePlatformAdmin(c) {
+		return
+	}
+	ctx := c.Request.Context()
+	tenant, err := s.tenantStore.GetTenant(ctx, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "tenant not found"})
+		return
+	}
+	if tenant.ID == db.DefaultTenantID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "the default tenant can't be deleted"})
+		return
+	}
+
+	if err := s.tenantStore.DeleteTenant(ctx, tenant.ID); err != nil {
+		switch err {
+		case db.ErrTenantNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": "tenant not found"})
+		case db.ErrTenantInUse:
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			s.logger.Error("Failed to delete tenant", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete tenant"})
+		}
+		return
+	}
+
+	s.recordAudit(c, "tenant.delete", "tenant", tenant.ID, gin.H{"name": tenant.Name, "slug": tenant.Slug})
+	c.JSON(http.StatusOK, gin.H{"message": "tenant deleted"})
+}
+
+// handleSetLocalUserTenant moves a local user into a tenant. Local users who are
+// admins become that tenant's admins, which is how a new tenant gets its first
+// admin before it has an identity provider.
+func (s *Server) handleSetLocalUserTenant(c *gin.Context) {
+	if !s.requirePlatformAdmin(c) {
+		return
+	}
+	ctx := c.Request.Context()
+	tenant, err := s.tenantStore.GetTenant(ctx, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "tenant not found"})
+		return
+	}
+	userID := c.Param("userId")
+	if caller, err := s.getAuthenticatedUser(c); err == nil && caller.UserID == userID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "you can't move yourself out of the default tenant"})
+		return
+	}
+
+	if err := s.tenantStore.SetLocalUserTenant(ctx, userID, tenant.ID); err != nil {
+		if err == db.ErrUserNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "local user not found"})
+			return
+		}
+		s.logger.Error("Failed to move local user to tenant", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to move local user"})
+		return
+	}
+	// A user's rules come from their tenant, which the rule cache isn't keyed by
+	s.accessRuleStore.InvalidateCache()
+
+	s.recordAudit(c, "tenant.assign_local_user", "tenant", tenant.ID, gin.H{"local_user_id": userID, "slug": tenant.Slug})
+	c.JSON(http.StatusOK, gin.H{"message": "local user moved", "tenant": tenantJSON(tenant)})
+}
@@ -0,0 +1,54 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/gatekey-project/gatekey/internal/config"
+)
+
+func TestTenantScoped(t *testing.T) {
+	tests := map[string]bool{
+		"/api/v1/admin/gateways":        true,
+		"/api/v1/admin/settings/oidc":   true,
+		"/api/v1/gateways":              true,
+		"/api/v1/configs/generate":      true,
+		"/api/v1/auth/oidc/callback":    false,
+		"/api/v1/gateway/verify":        false,
+		"/api/v1/mesh-hub/client-rules": false,
+		"/health":                       false,
+		"/proxy/app/":                   false,
+	}
+	for path, want := range tests {
+		if got := tenantScoped(path); got != want {
+			t.Errorf("tenantScoped(%q) = %v, want %v", path, got, want)
+		}
+	}
+}
+
+func TestPlatformOnly(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	for _, tt := range []struct {
+		name    string
+		tenancy bool
+		status  int
+	}{
+		{"single tenant", false, http.StatusNoContent},
+		{"multi-tenant, unauthenticated", true, http.StatusUnauthorized},
+	} {
+		cfg := &config.Config{}
+		cfg.Tenancy.Enabled = tt.tenancy
+		s := &Server{config: cfg}
+		router := gin.New()
+		router.GET("/api/v1/admin/settings", s.platformOnly(), func(c *gin.Context) { c.Status(http.StatusNoContent) })
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/admin/settings", nil))
+		if w.Code != tt.status {
+			t.Errorf("%s: status %d, want %d", tt.name, w.Code, tt.status)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package api
+
+import (
+	"fmt"
+
+	"github.com/gatekey-project/gatekey/internal/db"
+)
+
+// defaultTunnelMode returns the tunnel mode a gateway uses when the user hasn't
+// chosen one.
+func defaultTunnelMode(gw *db.Gateway) string {
+	if gw.FullTunnelMode {
+		return db.TunnelModeFull
+	}
+	return db.TunnelModeSplit
+}
+
+// chooseTunnelMode checks the tunnel mode a user asked for when generating a
+// config for gw. It returns the mode to store on the config: "" when none was
+// requested, so the config follows the gateway's default.
+func chooseTunnelMode(gw *db.Gateway, requested string) (string, error) {
+	switch requested {
+	case "":
+		return "", nil
+	case db.TunnelModeFull, db.TunnelModeSplit:
+	default:
+		return "", fmt.Errorf("tunnel_mode must be '%s' or '%s'", db.TunnelModeFull, db.TunnelModeSplit)
+	}
+	if requested != defaultTunnelMode(gw) && !gw.AllowTunnelChoice {
+		return "", fmt.Errorf("gateway '%s' only allows %s tunnel", gw.Name, defaultTunnelMode(gw))
+	}
+	return requested, nil
+}
+
+// connectTunnelMode returns the tunnel mode to push to a client connecting with a
+// config generated with configMode. The choice only stands while the gateway
+// still allows it; otherwise the gateway's default applies.
+func connectTunnelMode(gw *db.Gateway, configMode string) string {
+	if gw.AllowTunnelChoice && (configMode == db.TunnelModeFull || configMode == db.TunnelModeSplit) {
+		return configMode
+	}
+	return defaultTunnelMode(gw)
+}
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/gatekey-project/gatekey/internal/db"
+)
+
+func TestChooseTunnelMode(t *testing.T) {
+	split := &db.Gateway{Name: "gw"}
+	choice := &db.Gateway{Name: "gw", FullTunnelMode: true, AllowTunnelChoice: true}
+
+	tests := []struct {
+		gw        *db.Gateway
+		requested string
+		want      string
+		wantErr   bool
+	}{
+		{split, "", "", false},
+		{split, "split", "split", false},
+		{split, "full", "", true},
+		{split, "bogus", "", true},
+		{choice, "split", "split", false},
+		{choice, "full", "full", false},
+	}
+	for _, tt := range tests {
+		got, err := chooseTunnelMode(tt.gw, tt.requested)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("chooseTunnelMode(allow=%v, %q) = %q, %v, want %q (error %v)", tt.gw.AllowTunnelChoice, tt.requested, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestConnectTunnelMode(t *testing.T) {
+	gw := &db.Gateway{FullTunnelMode: true, AllowTunnelChoice: true}
+	if got := connectTunnelMode(gw, "split"); got != db.TunnelModeSplit {
+		t.Errorf("connectTunnelMode() = %q, want split", got)
+	}
+	if got := connectTunnelMode(gw, ""); got != db.TunnelModeFull {
+		t.Errorf("connectTunnelMode() with no choice = %q, want full", got)
+	}
+
+	// A choice made while it was allowed lapses once the gateway stops allowing it
+	gw.AllowTunnelChoice = false
+	if got := connectTunnelMode(gw, "split"); got != db.TunnelModeFull {
+		t.Errorf("connectTunnelMode() after disallowing = %q, want full", got)
+	}
+}
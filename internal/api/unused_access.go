@@ -0,0 +1,111 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const (
+	// defaultUnusedDays is how long access must go unused before it's listed
+	// when the caller doesn't say.
+	defaultUnusedDays = 90
+	// maxUnusedDays bounds the days parameter to something a review would use.
+	maxUnusedDays = 3650
+)
+
+// parseUnusedDays parses the days query parameter, defaulting when it's empty.
+func parseUnusedDays(value string) (int, error) {
+	if value == "" {
+		return defaultUnusedDays, nil
+	}
+	days, err := strconv.Atoi(value)
+	if err != nil || days < 1 || days > maxUnusedDays {
+		return 0, fmt.Errorf("days must be between 1 and %d", maxUnusedDays)
+	}
+	return days, nil
+}
+
+// formatOptionalTime formats t as RFC 3339, or returns nil if it isn't set.
+func formatOptionalTime(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return t.Format(time.RFC3339)
+}
+
+// handleListUnusedAccess lists active users and live configs that haven't passed
+// gateway verification in the given number of days, so the access can be
+// reviewed and reclaimed.
+func (s *Server) handleListUnusedAccess(c *gin.Context) {
+	user, err := s.getAuthenticatedUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		return
+	}
+	if !user.IsAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "admin access required"})
+		return
+	}
+
+	days, err := parseUnusedDays(c.Query("days"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ctx := c.Request.Context()
+	cutoff := time.Now().AddDate(0, 0, -days)
+
+	users, err := s.userStore.ListDormantUsers(ctx, cutoff)
+	if err != nil {
+		s.logger.Error("Failed to list dormant users", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list unused access"})
+		return
+	}
+	configs, err := s.configStore.ListUnusedConfigs(ctx, cutoff)
+	if err != nil {
+		s.logger.Error("Failed to list unused configs", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list unused access"})
+		return
+	}
+
+	userResult := make([]gin.H, len(users))
+	for i, u := range users {
+		userResult[i] = gin.H{
+			"id":            u.ID,
+			"email":         u.Email,
+			"name":          u.Name,
+			"groups":        u.Groups,
+			"lastLoginAt":   formatOptionalTime(u.LastLoginAt),
+			"lastVpnAuthAt": formatOptionalTime(u.LastVPNAuthAt),
+			"createdAt":     u.CreatedAt.Format(time.RFC3339),
+		}
+	}
+	configResult := make([]gin.H, len(configs))
+	for i, cfg := range configs {
+		configResult[i] = gin.H{
+			"id":          cfg.ID,
+			"userId":      cfg.UserID,
+			"userEmail":   cfg.UserEmail,
+			"userName":    cfg.UserName,
+			"gatewayId":   cfg.GatewayID,
+			"gatewayName": cfg.GatewayName,
+			"fileName":    cfg.FileName,
+			"expiresAt":   cfg.ExpiresAt.Format(time.RFC3339),
+			"createdAt":   cfg.CreatedAt.Format(time.RFC3339),
+			"downloaded":  cfg.DownloadedAt != nil,
+			"lastUsedAt":  formatOptionalTime(cfg.LastUsedAt),
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"days":    days,
+		"cutoff":  cutoff.Format(time.RFC3339),
+		"users":   userResult,
+		"configs": configResult,
+	})
+}
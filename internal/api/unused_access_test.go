@@ -0,0 +1,28 @@
+package api
+
+import "testing"
+
+func TestParseUnusedDays(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    int
+		wantErr bool
+	}{
+		{"", defaultUnusedDays, false},
+		{"30", 30, false},
+		{"0", 0, true},
+		{"-5", 0, true},
+		{"abc", 0, true},
+		{"100000", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseUnusedDays(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseUnusedDays(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseUnusedDays(%q) = %d, want %d", tt.value, got, tt.want)
+		}
+	}
+}
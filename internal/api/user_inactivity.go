@@ -0,0 +1,362 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/gatekey-project/gatekey/internal/db"
+	"github.com/gatekey-project/gatekey/internal/mail"
+)
+
+// errUserDeactivated is returned to a deactivated user who tries to log in.
+var errUserDeactivated = errors.New("your account is deactivated; ask your administrator to reactivate it")
+
+const (
+	// userInactivityCheckInterval is how often inactive users are looked for.
+	userInactivityCheckInterval = time.Hour
+	// defaultUserInactivityWarningDays is how long before deactivation users are
+	// warned when the setting hasn't been changed.
+	defaultUserInactivityWarningDays = 7
+	// maxUserInactivityDays bounds user_inactivity_days.
+	maxUserInactivityDays = 3650
+)
+
+// userInactivityPolicy is how inactive users are deactivated.
+type userInactivityPolicy struct {
+	Days         int    // Deactivate after this many days without activity; 0 never does
+	WarningDays  int    // Warn this many days before; 0 doesn't warn
+	Reactivation string // db.ReactivationAuto or db.ReactivationApproval
+}
+
+func (s *Server) userInactivityPolicy(ctx context.Context) userInactivityPolicy {
+	p := userInactivityPolicy{
+		Days:         s.settingsStore.GetInt(ctx, db.SettingUserInactivityDays, 0),
+		WarningDays:  s.settingsStore.GetInt(ctx, db.SettingUserInactivityWarningDays, defaultUserInactivityWarningDays),
+		Reactivation: db.ReactivationAuto,
+	}
+	if setting, err := s.settingsStore.Get(ctx, db.SettingUserInactivityReactivate); err == nil && setting.Value == db.ReactivationApproval {
+		p.Reactivation = db.ReactivationApproval
+	}
+	return p
+}
+
+// Actions on an inactive user
+const (
+	inactivityNone = iota
+	inactivityWarn
+	inactivityDeactivate
+)
+
+// inactivityAction decides what to do about a user who may be inactive. Users
+// are warned first, when warnings are on, and deactivated once both the
+// inactivity period and the warning period since they were warned have passed,
+// so a warning sent late (say, when the policy was first turned on) still gives
+// them the full warning period.
+func inactivityAction(u *db.InactiveUser, p userInactivityPolicy, now time.Time) int {
+	if p.Days <= 0 {
+		return inactivityNone
+	}
+	deactivateAt := u.LastActiveAt.AddDate(0, 0, p.Days)
+	if p.WarningDays > 0 {
+		if u.WarnedAt == nil {
+			if now.Before(deactivateAt.AddDate(0, 0, -p.WarningDays)) {
+				return inactivityNone
+			}
+			return inactivityWarn
+		}
+		if warned := u.WarnedAt.AddDate(0, 0, p.WarningDays); warned.After(deactivateAt) {
+			deactivateAt = warned
+		}
+	}
+	if now.Before(deactivateAt) {
+		return inactivityNone
+	}
+	return inactivityDeactivate
+}
+
+// runUserInactivity periodically warns and deactivates inactive users.
+func (s *Server) runUserInactivity(ctx context.Context) {
+	ticker := time.NewTicker(userInactivityCheckInterval)
+	defer ticker.Stop()
+
+	s.checkInactiveUsers(ctx)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.checkInactiveUsers(ctx)
+		}
+	}
+}
+
+// checkInactiveUsers warns users nearing deactivation and deactivates those
+// past it. The default admin account and break-glass users are never
+// deactivated, so there is always a way back in.
+func (s *Server) checkInactiveUsers(ctx context.Context) {
+	p := s.userInactivityPolicy(ctx)
+	if p.Days <= 0 {
+		return
+	}
+
+	now := time.Now()
+	users, err := s.userStore.ListInactiveUsers(ctx, now.AddDate(0, 0, -(p.Days-p.WarningDays)))
+	if err != nil {
+		s.logger.Error("Failed to list inactive users", zap.Error(err))
+		return
+	}
+	for _, u := range users {
+		if u.Kind == db.InactiveUserLocal && (u.Username == "admin" || slices.Contains(s.config.Auth.BreakGlassUsers, u.Username)) {
+			continue
+		}
+		switch inactivityAction(u, p, now) {
+		case inactivityWarn:
+			s.warnInactiveUser(ctx, u, p, now)
+		case inactivityDeactivate:
+			s.deactivateInactiveUser(ctx, u, p, now)
+		}
+	}
+}
+
+// warnInactiveUser emails a user that they'll be deactivated unless they sign
+// in. The warning is recorded even without a mail server, so deactivation still
+// waits out the warning period.
+func (s *Server) warnInactiveUser(ctx context.Context, u *db.InactiveUser, p userInactivityPolicy, now time.Time) {
+	claimed, err := s.userStore.MarkInactivityWarned(ctx, u.Kind, u.ID)
+	if err != nil {
+		s.logger.Error("Failed to record inactivity warning", zap.String("user", u.Email), zap.Error(err))
+		return
+	}
+	if !claimed {
+		return // Another server warned them
+	}
+
+	deactivateAt := u.LastActiveAt.AddDate(0, 0, p.Days)
+	if earliest := now.AddDate(0, 0, p.WarningDays); deactivateAt.Before(earliest) {
+		deactivateAt = earliest
+	}
+	s.logger.Info("Warned inactive user",
+		zap.String("user", u.Email),
+		zap.Time("last_active", u.LastActiveAt),
+		zap.Time("deactivate_at", deactivateAt))
+
+	if !mail.Enabled(s.mailer) || u.Email == "" {
+		return
+	}
+	signIn := "Sign in to GateKey"
+	if s.config.Server.BaseURL != "" {
+		signIn += " at " + s.config.Server.BaseURL
+	}
+	name := u.Name
+	if name == "" {
+		name = u.Email
+	}
+	s.sendMail(&mail.Message{
+		To:      []string{u.Email},
+		Subject: "Your GateKey account will be deactivated",
+		Body: fmt.Sprintf("Hello %s,\n\n"+
+			"Your GateKey account hasn't been used since %s. Accounts unused for %d days are deactivated, "+
+			"so yours will be deactivated on %s, and its VPN configs revoked.\n\n"+
+			"%s before then to keep it.\n",
+			name, u.LastActiveAt.UTC().Format("January 2, 2006"), p.Days,
+			deactivateAt.UTC().Format("January 2, 2006"), signIn),
+	})
+}
+
+// deactivateInactiveUser deactivates a user, signs them out and revokes their
+// VPN and mesh configs.
+func (s *Server) deactivateInactiveUser(ctx context.Context, u *db.InactiveUser, p userInactivityPolicy, now time.Time) {
+	deactivated, err := s.userStore.DeactivateInactiveUser(ctx, u.Kind, u.ID, now.AddDate(0, 0, -p.Days))
+	if err != nil {
+		s.logger.Error("Failed to deactivate inactive user", zap.String("user", u.Email), zap.Error(err))
+		return
+	}
+	if !deactivated {
+		return // Active again, or another server got there first
+	}
+
+	var sessions int64
+	if u.Kind == db.InactiveUserLocal {
+		sessions, err = s.userStore.DeleteUserSessions(ctx, u.ID)
+	} else {
+		sessions, err = s.stateStore.DeleteUserSSOSessions(ctx, u.ID)
+	}
+	if err != nil {
+		s.logger.Error("Failed to sign out deactivated user", zap.String("user", u.Email), zap.Error(err))
+	}
+
+	reason := fmt.Sprintf("deactivated after %d days of inactivity", p.Days)
+	revoked, err := s.configStore.RevokeUserConfigs(ctx, u.ID, reason)
+	if err != nil {
+		s.logger.Error("Failed to revoke deactivated user's configs", zap.String("user", u.Email), zap.Error(err))
+	}
+	meshRevoked, err := s.meshConfigStore.RevokeUserConfigs(ctx, u.ID, reason)
+	if err != nil {
+		s.logger.Error("Failed to revoke deactivated user's mesh configs", zap.String("user", u.Email), zap.Error(err))
+	}
+	s.noteRevocation(ctx)
+	if revoked > 0 {
+		s.emitEvent(ctx, eventConfigRevoked, u.ID, "", gin.H{
+			"userId":       u.ID,
+			"revokedCount": revoked,
+			"reason":       reason,
+		})
+	}
+
+	s.logger.Info("Deactivated inactive user",
+		zap.String("user", u.Email),
+		zap.String("kind", u.Kind),
+		zap.Time("last_active", u.LastActiveAt),
+		zap.Int64("sessions", sessions),
+		zap.Int64("revoked_configs", revoked),
+		zap.Int64("revoked_mesh_configs", meshRevoked))
+	details := gin.H{
+		"kind":               u.Kind,
+		"email":              u.Email,
+		"lastActiveAt":       u.LastActiveAt,
+		"inactivityDays":     p.Days,
+		"revokedConfigs":     revoked,
+		"revokedMeshConfigs": meshRevoked,
+	}
+	s.emitEvent(ctx, eventUserDeactivated, u.ID, "", details)
+	s.recordSystemAudit(ctx, "user.deactivate_inactive", "user", u.ID, details)
+}
+
+// reactivateOnLogin lets a deactivated SSO user back in if they were
+// deactivated for inactivity and the policy reactivates on login, and returns
+// errUserDeactivated otherwise.
+func (s *Server) reactivateOnLogin(ctx context.Context, u *db.SSOUser) error {
+	if s.userInactivityPolicy(ctx).Reactivation != db.ReactivationAuto {
+		return errUserDeactivated
+	}
+	reactivated, err := s.userStore.ReactivateInactiveUser(ctx, u.ID)
+	if err != nil {
+		return err
+	}
+	if !reactivated {
+		return errUserDeactivated
+	}
+
+	s.logger.Info("Reactivated inactive user on login", zap.String("user", u.Email))
+	details := gin.H{"email": u.Email, "reason": "login"}
+	s.emitEvent(ctx, eventUserReactivated, u.ID, "", details)
+	s.recordSystemAudit(ctx, "user.reactivate", "user", u.ID, details)
+	return nil
+}
+
+func (s *Server) handleGetUserInactivity(c *gin.Context) {
+	p := s.userInactivityPolicy(c.Request.Context())
+	c.JSON(http.StatusOK, gin.H{
+		"inactivity_days": p.Days,
+		"warning_days":    p.WarningDays,
+		"reactivation":    p.Reactivation,
+	})
+}
+
+func (s *Server) handleSetUserInactivity(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var req struct {
+		InactivityDays *int    `json:"inactivity_days"`
+		WarningDays    *int    `json:"warning_days"`
+		Reactivation   *string `json:"reactivation" binding:"omitempty,oneof=auto approval"`
+	}
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	p := s.userInactivityPolicy(ctx)
+	if req.InactivityDays != nil {
+		p.Days = *req.InactivityDays
+	}
+	if req.WarningDays != nil {
+		p.WarningDays = *req.WarningDays
+	}
+	if req.Reactivation != nil {
+		p.Reactivation = *req.Reactivation
+	}
+
+	// 0 = never deactivate, otherwise 1-3650, with the warning inside the period
+	if p.Days < 0 || p.Days > maxUserInactivityDays {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("inactivity_days must be between 0 and %d (0 = never)", maxUserInactivityDays)})
+		return
+	}
+	if p.WarningDays < 0 || (p.Days > 0 && p.WarningDays >= p.Days) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "warning_days must be at least 0 and less than inactivity_days"})
+		return
+	}
+
+	settings := map[string]string{
+		db.SettingUserInactivityDays:        strconv.Itoa(p.Days),
+		db.SettingUserInactivityWarningDays: strconv.Itoa(p.WarningDays),
+		db.SettingUserInactivityReactivate:  p.Reactivation,
+	}
+	for key, value := range settings {
+		if err := s.settingsStore.Set(ctx, key, value); err != nil {
+			s.logger.Error("Failed to set user inactivity policy", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to set user inactivity policy"})
+			return
+		}
+	}
+
+	s.logger.Info("User inactivity policy updated",
+		zap.Int("days", p.Days),
+		zap.Int("warning_days", p.WarningDays),
+		zap.String("reactivation", p.Reactivation))
+	s.recordAudit(c, "settings.user_inactivity", "settings", "", gin.H{
+		"inactivityDays": p.Days,
+		"warningDays":    p.WarningDays,
+		"reactivation":   p.Reactivation,
+	})
+	c.JSON(http.StatusOK, gin.H{
+		"message":         "user inactivity policy updated",
+		"inactivity_days": p.Days,
+		"warning_days":    p.WarningDays,
+		"reactivation":    p.Reactivation,
+	})
+}
+
+// handleReactivateUser reactivates a deactivated SSO user.
+func (s *Server) handleReactivateUser(c *gin.Context) {
+	userID := c.Param("id")
+	if err := s.userStore.ReactivateUser(c.Request.Context(), userID); err != nil {
+		if err == db.ErrUserNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+			return
+		}
+		s.logger.Error("Failed to reactivate user", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to reactivate user"})
+		return
+	}
+
+	s.emitEvent(c.Request.Context(), eventUserReactivated, userID, "", gin.H{"reason": "admin"})
+	s.recordAudit(c, "user.reactivate", "user", userID, nil)
+	c.JSON(http.StatusOK, gin.H{"message": "user reactivated"})
+}
+
+// handleReactivateLocalUser reactivates a deactivated local user.
+func (s *Server) handleReactivateLocalUser(c *gin.Context) {
+	userID := c.Param("id")
+	if err := s.userStore.ReactivateLocalUser(c.Request.Context(), userID); err != nil {
+		if err == db.ErrUserNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+			return
+		}
+		s.logger.Error("Failed to reactivate local user", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to reactivate user"})
+		return
+	}
+
+	s.emitEvent(c.Request.Context(), eventUserReactivated, userID, "", gin.H{"reason": "admin"})
+	s.recordAudit(c, "local_user.reactivate", "local_user", userID, nil)
+	c.JSON(http.StatusOK, gin.H{"message": "user reactivated"})
+}
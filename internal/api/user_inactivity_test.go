@@ -0,0 +1,36 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gatekey-project/gatekey/internal/db"
+)
+
+func TestInactivityAction(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	daysAgo := func(days int) time.Time { return now.AddDate(0, 0, -days) }
+	warnedDaysAgo := func(days int) *time.Time { t := daysAgo(days); return &t }
+	policy := userInactivityPolicy{Days: 90, WarningDays: 7}
+
+	tests := []struct {
+		name   string
+		user   db.InactiveUser
+		policy userInactivityPolicy
+		want   int
+	}{
+		{"recently active", db.InactiveUser{LastActiveAt: daysAgo(10)}, policy, inactivityNone},
+		{"inside warning period", db.InactiveUser{LastActiveAt: daysAgo(85)}, policy, inactivityWarn},
+		{"warned, period not over", db.InactiveUser{LastActiveAt: daysAgo(88), WarnedAt: warnedDaysAgo(3)}, policy, inactivityNone},
+		{"warned, period over", db.InactiveUser{LastActiveAt: daysAgo(91), WarnedAt: warnedDaysAgo(8)}, policy, inactivityDeactivate},
+		{"long inactive, not warned", db.InactiveUser{LastActiveAt: daysAgo(400)}, policy, inactivityWarn},
+		{"long inactive, warned late", db.InactiveUser{LastActiveAt: daysAgo(400), WarnedAt: warnedDaysAgo(2)}, policy, inactivityNone},
+		{"no warnings", db.InactiveUser{LastActiveAt: daysAgo(91)}, userInactivityPolicy{Days: 90}, inactivityDeactivate},
+		{"turned off", db.InactiveUser{LastActiveAt: daysAgo(400)}, userInactivityPolicy{}, inactivityNone},
+	}
+	for _, tt := range tests {
+		if got := inactivityAction(&tt.user, tt.policy, now); got != tt.want {
+			t.Errorf("%s: inactivityAction() = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
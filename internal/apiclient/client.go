@@ -0,0 +1,298 @@
+// Package apiclient is a typed client for the GateKey control plane API, shared
+// by the gatekey and gatekey-admin CLIs. It handles authentication, encodes
+// requests and decodes responses, retries idempotent requests that fail
+// transiently, and maps error responses to *Error.
+package apiclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultTimeout bounds a single request.
+	DefaultTimeout = 30 * time.Second
+
+	defaultAttempts = 3
+	retryBaseDelay  = 250 * time.Millisecond
+	retryMaxDelay   = 2 * time.Second
+)
+
+// Auth adds credentials to a request.
+type Auth interface {
+	Apply(req *http.Request) error
+}
+
+// AuthFunc adapts a function to Auth, for credentials looked up per request
+// such as a session token that may be refreshed.
+type AuthFunc func(req *http.Request) error
+
+// Apply calls f.
+func (f AuthFunc) Apply(req *http.Request) error { return f(req) }
+
+// BearerToken authenticates with a session token in the Authorization header.
+func BearerToken(token string) Auth {
+	return AuthFunc(func(req *http.Request) error {
+		req.Header.Set("Authorization", "Bearer "+token)
+		return nil
+	})
+}
+
+// APIKey authenticates with an API key, which the server takes as a bearer
+// token.
+func APIKey(key string) Auth {
+	return BearerToken(key)
+}
+
+// SessionCookie authenticates with a browser session cookie, as the web UI
+// does. name is the server's auth.session.cookie_name.
+func SessionCookie(name, token string) Auth {
+	return AuthFunc(func(req *http.Request) error {
+		req.AddCookie(&http.Cookie{Name: name, Value: token})
+		return nil
+	})
+}
+
+// Client makes requests to a GateKey server.
+type Client struct {
+	baseURL    *url.URL
+	auth       Auth
+	httpClient *http.Client
+	attempts   int
+	// sleep waits between retries; tests replace it.
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+// New creates a client for the server at baseURL. auth may be nil for
+// unauthenticated endpoints.
+func New(baseURL string, auth Auth) (*Client, error) {
+	u, err := url.Parse(strings.TrimSuffix(baseURL, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid server URL: %w", err)
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid server URL %q", baseURL)
+	}
+	return &Client{
+		baseURL:    u,
+		auth:       auth,
+		httpClient: &http.Client{Timeout: DefaultTimeout},
+		attempts:   defaultAttempts,
+		sleep:      sleepContext,
+	}, nil
+}
+
+// SetTimeout sets how long a single request may take.
+func (c *Client) SetTimeout(timeout time.Duration) {
+	if timeout > 0 {
+		c.httpClient.Timeout = timeout
+	}
+}
+
+// SetHTTPClient replaces the underlying HTTP client, e.g. to use a custom
+// transport.
+func (c *Client) SetHTTPClient(hc *http.Client) {
+	c.httpClient = hc
+}
+
+// SetRetries sets how many times a failed idempotent request is retried; 0
+// turns retries off.
+func (c *Client) SetRetries(n int) {
+	c.attempts = max(n, 0) + 1
+}
+
+// Do sends a request with body encoded as JSON, if not nil, and decodes a
+// successful JSON response into result, if not nil. path may carry a query
+// string. Error responses are returned as *Error.
+func (c *Client) Do(ctx context.Context, method, path string, body, result any) error {
+	resp, err := c.send(ctx, method, path, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if result == nil {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// Get is Do for GET requests.
+func (c *Client) Get(ctx context.Context, path string, result any) error {
+	return c.Do(ctx, http.MethodGet, path, nil, result)
+}
+
+// Download fetches a file, such as a generated config, and returns its content.
+func (c *Client) Download(ctx context.Context, path string) ([]byte, error) {
+	resp, err := c.send(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	return data, nil
+}
+
+// send makes a request, retrying GET and HEAD requests on network errors and
+// responses that mean the server is failing or overloaded. It returns the
+// response only if it succeeded.
+func (c *Client) send(ctx context.Context, method, path string, body any) (*http.Response, error) {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return nil, fmt.Errorf("failed to encode request: %w", err)
+		}
+	}
+	target, err := c.baseURL.Parse(c.baseURL.Path + path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid request path %q: %w", path, err)
+	}
+
+	attempts := 1
+	if method == http.MethodGet || method == http.MethodHead {
+		attempts = c.attempts
+	}
+
+	var lastErr error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			if err := c.sleep(ctx, backoff(attempt)); err != nil {
+				return nil, lastErr
+			}
+		}
+
+		req, err := http.NewRequestWithContext(ctx, method, target.String(), bytes.NewReader(payload))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %w", err)
+		}
+		if payload != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		req.Header.Set("Accept", "application/json")
+		if c.auth != nil {
+			if err := c.auth.Apply(req); err != nil {
+				return nil, err
+			}
+		}
+
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			lastErr = fmt.Errorf("request failed: %w", err)
+			if ctx.Err() != nil {
+				return nil, lastErr
+			}
+			continue
+		}
+		if resp.StatusCode < 400 {
+			return resp, nil
+		}
+		lastErr = responseError(resp)
+		resp.Body.Close()
+		if !retryableStatus(resp.StatusCode) {
+			break
+		}
+	}
+	return nil, lastErr
+}
+
+// retryableStatus reports whether a response means the server is failing or
+// overloaded, rather than rejecting the request.
+func retryableStatus(code int) bool {
+	switch code {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// backoff returns a random delay before a retry, with full jitter over an
+// exponentially growing window.
+func backoff(attempt int) time.Duration {
+	window := min(retryBaseDelay<<(attempt-1), retryMaxDelay)
+	return time.Duration(rand.Int64N(int64(window))) + time.Millisecond
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Errors an *Error matches with errors.Is, by status code.
+var (
+	ErrUnauthorized = errors.New("authentication required")
+	ErrForbidden    = errors.New("permission denied")
+	ErrNotFound     = errors.New("not found")
+	ErrConflict     = errors.New("conflict")
+)
+
+// Error is an error response from the server.
+type Error struct {
+	StatusCode int
+	Message    string // The response's error or message field, or its body
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("API error (%d): %s", e.StatusCode, e.Message)
+}
+
+// Is matches ErrUnauthorized, ErrForbidden, ErrNotFound and ErrConflict by
+// status code.
+func (e *Error) Is(target error) bool {
+	switch target {
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized
+	case ErrForbidden:
+		return e.StatusCode == http.StatusForbidden
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrConflict:
+		return e.StatusCode == http.StatusConflict
+	}
+	return false
+}
+
+// responseError reads an error response into an *Error.
+func responseError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	var errBody struct {
+		Error   string `json:"error"`
+		Message string `json:"message"`
+	}
+	_ = json.Unmarshal(body, &errBody)
+
+	msg := errBody.Error
+	if msg == "" {
+		msg = errBody.Message
+	}
+	if msg == "" {
+		msg = strings.TrimSpace(string(body))
+	}
+	if msg == "" {
+		msg = resp.Status
+	}
+	return &Error{StatusCode: resp.StatusCode, Message: msg}
+}
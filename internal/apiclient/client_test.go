@@ -0,0 +1,122 @@
+package apiclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newTestClient(t *testing.T, handler http.HandlerFunc, auth Auth) *Client {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	c, err := New(srv.URL, auth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.sleep = func(context.Context, time.Duration) error { return nil }
+	return c
+}
+
+func TestAuth(t *testing.T) {
+	tests := []struct {
+		name string
+		auth Auth
+		want string
+	}{
+		{"bearer", BearerToken("tok"), "Bearer tok"},
+		{"api key", APIKey("gk_key"), "Bearer gk_key"},
+		{"cookie", SessionCookie("gatekey_session", "tok"), "gatekey_session=tok"},
+	}
+	for _, tt := range tests {
+		var got string
+		c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+			got = r.Header.Get("Authorization") + r.Header.Get("Cookie")
+			w.WriteHeader(http.StatusNoContent)
+		}, tt.auth)
+		if err := c.Get(context.Background(), "/api/v1/users/me", nil); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s: sent %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestErrorMapping(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		_ = json.NewEncoder(w).Encode(map[string]string{"error": "gateway not found"})
+	}, nil)
+
+	_, err := c.ListReachable(context.Background(), "gw-1")
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound || apiErr.Message != "gateway not found" {
+		t.Fatalf("err = %v, want a 404 *Error", err)
+	}
+	if !errors.Is(err, ErrNotFound) || errors.Is(err, ErrUnauthorized) {
+		t.Errorf("errors.Is doesn't match by status: %v", err)
+	}
+	if err.Error() != "API error (404): gateway not found" {
+		t.Errorf("Error() = %q", err.Error())
+	}
+}
+
+func TestRetries(t *testing.T) {
+	var calls int
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"gateways": []map[string]any{{"id": "gw-1", "isActive": true}}})
+	}, nil)
+
+	gateways, err := c.ListGateways(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls != 3 || len(gateways) != 1 || gateways[0].Status != "online" {
+		t.Errorf("calls = %d, gateways = %+v; want a retried GET that succeeds", calls, gateways)
+	}
+
+	// Requests that change state aren't retried, since the first may have applied
+	calls = 0
+	_, err = c.GenerateConfig(context.Background(), &GenerateConfigRequest{GatewayID: "gw-1"})
+	if calls != 1 || !errors.As(err, new(*Error)) {
+		t.Errorf("POST: calls = %d, err = %v; want one attempt", calls, err)
+	}
+
+	// Client errors aren't retried either
+	calls = 0
+	c2 := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusForbidden)
+	}, nil)
+	c2.SetRetries(5)
+	if err := c2.Get(context.Background(), "/api/v1/gateways", nil); !errors.Is(err, ErrForbidden) || calls != 1 {
+		t.Errorf("403: calls = %d, err = %v; want one attempt", calls, err)
+	}
+}
+
+func TestBaseURLPath(t *testing.T) {
+	var path string
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.RequestURI()
+		_, _ = w.Write([]byte("config"))
+	}, nil)
+	c.baseURL.Path = "/gatekey"
+
+	data, err := c.DownloadConfig(context.Background(), &GeneratedConfig{DownloadURL: "/api/v1/configs/download/abc?format=zip"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != "/gatekey/api/v1/configs/download/abc?format=zip" || string(data) != "config" {
+		t.Errorf("fetched %q and got %q", path, data)
+	}
+}
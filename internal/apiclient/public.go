@@ -0,0 +1,251 @@
+package apiclient
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// === Authentication ===
+
+// APIKeyInfo is who an API key belongs to.
+type APIKeyInfo struct {
+	IsAdmin bool `json:"is_admin"`
+	User    struct {
+		Email string `json:"email"`
+		Name  string `json:"name"`
+	} `json:"user"`
+	APIKey struct {
+		Name   string   `json:"name"`
+		Scopes []string `json:"scopes"`
+	} `json:"api_key"`
+}
+
+// ValidateAPIKey checks the client's API key and returns who it belongs to.
+func (c *Client) ValidateAPIKey(ctx context.Context) (*APIKeyInfo, error) {
+	var info APIKeyInfo
+	if err := c.Get(ctx, "/api/v1/auth/api-key/validate", &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// CLISession is a session token handed to a CLI after browser login.
+type CLISession struct {
+	Token     string `json:"token"`
+	Email     string `json:"email"`
+	Name      string `json:"name"`
+	IsAdmin   bool   `json:"is_admin"`
+	ExpiresIn int    `json:"expires_in"` // Seconds
+}
+
+// ExchangeCLICode trades the single-use code from the CLI login redirect for
+// the session token, which the server only returns in a response body.
+func (c *Client) ExchangeCLICode(ctx context.Context, code string) (*CLISession, error) {
+	var session CLISession
+	if err := c.Do(ctx, http.MethodPost, "/api/v1/auth/cli/exchange", map[string]string{"code": code}, &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// RefreshedToken is a session token issued for a refresh token.
+type RefreshedToken struct {
+	AccessToken  string    `json:"access_token"`
+	RefreshToken string    `json:"refresh_token,omitempty"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	UserEmail    string    `json:"user_email,omitempty"`
+	UserName     string    `json:"user_name,omitempty"`
+}
+
+// RefreshToken trades a refresh token for a new session token.
+func (c *Client) RefreshToken(ctx context.Context, refreshToken string) (*RefreshedToken, error) {
+	var token RefreshedToken
+	if err := c.Do(ctx, http.MethodPost, "/api/v1/auth/refresh", map[string]string{"refresh_token": refreshToken}, &token); err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// ServerInfo describes the server's requirements of clients.
+type ServerInfo struct {
+	RequireFIPS bool   `json:"require_fips"`
+	Version     string `json:"version"`
+}
+
+// GetServerInfo returns the server's client requirements.
+func (c *Client) GetServerInfo(ctx context.Context) (*ServerInfo, error) {
+	var info ServerInfo
+	if err := c.Get(ctx, "/api/v1/server/info", &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// === Gateways and configs ===
+
+// Gateway is a gateway the user can connect to.
+type Gateway struct {
+	ID            string `json:"id"`
+	Name          string `json:"name"`
+	Hostname      string `json:"hostname"`
+	PublicIP      string `json:"publicIp,omitempty"`
+	VPNPort       int    `json:"vpnPort,omitempty"`
+	VPNProtocol   string `json:"vpnProtocol,omitempty"`
+	IsActive      bool   `json:"isActive"`
+	LastHeartbeat string `json:"lastHeartbeat,omitempty"`
+	Description   string `json:"description,omitempty"`
+	Location      string `json:"location,omitempty"`
+	Status        string `json:"status"`
+	// TunnelMode is the gateway's default; AllowTunnelChoice lets --tunnel pick the other
+	TunnelMode        string `json:"tunnelMode,omitempty"`
+	AllowTunnelChoice bool   `json:"allowTunnelChoice,omitempty"`
+}
+
+// ListGateways returns the gateways the user can connect to. Status is filled
+// in from IsActive when the server doesn't report it.
+func (c *Client) ListGateways(ctx context.Context) ([]Gateway, error) {
+	var result struct {
+		Gateways []Gateway `json:"gateways"`
+	}
+	if err := c.Get(ctx, "/api/v1/gateways", &result); err != nil {
+		return nil, err
+	}
+	for i := range result.Gateways {
+		if result.Gateways[i].Status == "" {
+			result.Gateways[i].Status = "offline"
+			if result.Gateways[i].IsActive {
+				result.Gateways[i].Status = "online"
+			}
+		}
+	}
+	return result.Gateways, nil
+}
+
+// ReachableTarget is a destination the user may reach through a gateway, and
+// the access rule that allows it.
+type ReachableTarget struct {
+	Rule        string `json:"rule"`
+	Description string `json:"description,omitempty"`
+	Type        string `json:"type"`
+	Value       string `json:"value"`
+	Ports       string `json:"ports,omitempty"`
+	Protocol    string `json:"protocol,omitempty"`
+	Network     string `json:"network"`
+}
+
+// ListReachable returns what the user can reach through a gateway.
+func (c *Client) ListReachable(ctx context.Context, gatewayID string) ([]ReachableTarget, error) {
+	var result struct {
+		Reachable []ReachableTarget `json:"reachable"`
+	}
+	if err := c.Get(ctx, "/api/v1/gateways/"+url.PathEscape(gatewayID)+"/reachable", &result); err != nil {
+		return nil, err
+	}
+	return result.Reachable, nil
+}
+
+// ConnectSummary describes what a connection to a gateway gives the user.
+type ConnectSummary struct {
+	GatewayName string   `json:"gatewayName"`
+	VPNIP       string   `json:"vpnIp"` // Empty until the gateway reports the connection
+	TunnelMode  string   `json:"tunnelMode"`
+	Reachable   []string `json:"reachable"`
+	DNSServers  []string `json:"dnsServers"`
+	Message     string   `json:"message"` // Set by the admin
+}
+
+// GetConnectSummary returns the summary of the user's connection to a gateway
+// started at or after since. tunnelMode is the mode the config asked for, or
+// "" for the gateway's default.
+func (c *Client) GetConnectSummary(ctx context.Context, gatewayID, tunnelMode string, since time.Time) (*ConnectSummary, error) {
+	query := url.Values{"since": {since.UTC().Format(time.RFC3339)}}
+	if tunnelMode != "" {
+		query.Set("tunnel_mode", tunnelMode)
+	}
+	var summary ConnectSummary
+	if err := c.Get(ctx, "/api/v1/gateways/"+url.PathEscape(gatewayID)+"/connect-summary?"+query.Encode(), &summary); err != nil {
+		return nil, err
+	}
+	return &summary, nil
+}
+
+// GenerateConfigRequest asks for a new config for a gateway.
+type GenerateConfigRequest struct {
+	GatewayID      string `json:"gateway_id"`
+	CLICallbackURL string `json:"cli_callback_url,omitempty"`
+	TunnelMode     string `json:"tunnel_mode,omitempty"` // "full" or "split"; empty for the gateway's default
+	DeviceName     string `json:"device_name,omitempty"`
+	DeviceOS       string `json:"device_os,omitempty"`
+	Purpose        string `json:"purpose,omitempty"`
+}
+
+// GeneratedConfig describes a newly generated config, which is fetched with
+// DownloadConfig.
+type GeneratedConfig struct {
+	ID           string `json:"id"`
+	FileName     string `json:"fileName"`
+	GatewayName  string `json:"gatewayName"`
+	ExpiresAt    string `json:"expiresAt"`
+	DownloadURL  string `json:"downloadUrl"`
+	BundleURL    string `json:"bundleUrl"`
+	TunnelMode   string `json:"tunnelMode"`
+	KeyEncrypted bool   `json:"keyEncrypted"`
+	// Only set when the gateway encrypts client keys; it isn't stored, so this
+	// is the only chance to get it
+	KeyPassphrase string `json:"keyPassphrase,omitempty"`
+}
+
+// GenerateConfig generates a config for a gateway.
+func (c *Client) GenerateConfig(ctx context.Context, req *GenerateConfigRequest) (*GeneratedConfig, error) {
+	var config GeneratedConfig
+	if err := c.Do(ctx, http.MethodPost, "/api/v1/configs/generate", req, &config); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// DownloadConfig returns the content of a generated config from its download
+// URL.
+func (c *Client) DownloadConfig(ctx context.Context, config *GeneratedConfig) ([]byte, error) {
+	return c.Download(ctx, config.DownloadURL)
+}
+
+// === Mesh ===
+
+// MeshHub is a mesh hub the user can connect to.
+type MeshHub struct {
+	ID             string `json:"id"`
+	Name           string `json:"name"`
+	Description    string `json:"description,omitempty"`
+	PublicEndpoint string `json:"publicEndpoint"`
+	Status         string `json:"status"`
+	SpokeCount     int    `json:"connectedspokes"`
+}
+
+// ListMeshHubs returns the mesh hubs the user can connect to.
+func (c *Client) ListMeshHubs(ctx context.Context) ([]MeshHub, error) {
+	var result struct {
+		Hubs []MeshHub `json:"hubs"`
+	}
+	if err := c.Get(ctx, "/api/v1/mesh/hubs", &result); err != nil {
+		return nil, err
+	}
+	return result.Hubs, nil
+}
+
+// MeshConfig is a generated mesh hub config.
+type MeshConfig struct {
+	HubName string `json:"hubname"`
+	Config  string `json:"config"`
+}
+
+// GenerateMeshConfig generates a config for a mesh hub.
+func (c *Client) GenerateMeshConfig(ctx context.Context, hubID string) (*MeshConfig, error) {
+	var config MeshConfig
+	if err := c.Do(ctx, http.MethodPost, "/api/v1/mesh/generate-config", map[string]string{"hubid": hubID}, &config); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
@@ -0,0 +1,79 @@
+package oidc
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+)
+
+// maxAudienceLength bounds a configured audience; client IDs are far shorter.
+const maxAudienceLength = 255
+
+// ValidateAudiences checks the additional audiences configured for a provider.
+// Each must be a distinct, non-empty value other than the primary client ID.
+func ValidateAudiences(clientID string, audiences []string) error {
+	seen := make(map[string]bool, len(audiences))
+	for _, aud := range audiences {
+		switch {
+		case aud == "":
+			return fmt.Errorf("additional audiences must not be empty")
+		case aud != strings.TrimSpace(aud) || strings.ContainsAny(aud, " \t\r\n"):
+			return fmt.Errorf("additional audience %q must not contain whitespace", aud)
+		case len(aud) > maxAudienceLength:
+			return fmt.Errorf("additional audience %q is longer than %d characters", aud, maxAudienceLength)
+		case aud == strings.TrimSpace(clientID):
+			return fmt.Errorf("additional audience %q is the provider's client ID", aud)
+		case seen[aud]:
+			return fmt.Errorf("additional audience %q is listed twice", aud)
+		}
+		seen[aud] = true
+	}
+	return nil
+}
+
+// AudienceVerifier verifies ID tokens issued to the provider's client ID or to
+// one of its additional audiences.
+type AudienceVerifier struct {
+	verifier  *oidc.IDTokenVerifier
+	audiences []string // Accepted audiences when there are additional ones
+}
+
+// NewAudienceVerifier returns a verifier accepting tokens for clientID and any of
+// the additional audiences. With no additional audiences it behaves exactly like
+// the standard verifier.
+func NewAudienceVerifier(provider *oidc.Provider, clientID string, additional []string) *AudienceVerifier {
+	if len(additional) == 0 {
+		return &AudienceVerifier{verifier: provider.Verifier(&oidc.Config{ClientID: clientID})}
+	}
+	// The library only checks one client ID, so the audience is checked here
+	return &AudienceVerifier{
+		verifier:  provider.Verifier(&oidc.Config{SkipClientIDCheck: true}),
+		audiences: append([]string{clientID}, additional...),
+	}
+}
+
+// Verify checks the token's signature, issuer and expiry, and that it was issued
+// to an accepted audience.
+func (v *AudienceVerifier) Verify(ctx context.Context, rawIDToken string) (*oidc.IDToken, error) {
+	idToken, err := v.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, err
+	}
+	if v.audiences != nil && !AudienceAccepted(idToken.Audience, v.audiences) {
+		return nil, fmt.Errorf("oidc: expected audience in %q, got %q", v.audiences, idToken.Audience)
+	}
+	return idToken, nil
+}
+
+// AudienceAccepted reports whether any of a token's audiences is accepted.
+func AudienceAccepted(tokenAudiences, accepted []string) bool {
+	for _, aud := range tokenAudiences {
+		if slices.Contains(accepted, aud) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,37 @@
+package oidc
+
+import "testing"
+
+func TestValidateAudiences(t *testing.T) {
+	tests := []struct {
+		name      string
+		audiences []string
+		wantErr   bool
+	}{
+		{"none", nil, false},
+		{"distinct", []string{"mobile-app", "web-app"}, false},
+		{"empty", []string{""}, true},
+		{"whitespace", []string{"mobile app"}, true},
+		{"primary client ID", []string{"gatekey"}, true},
+		{"duplicate", []string{"mobile-app", "mobile-app"}, true},
+	}
+	for _, tt := range tests {
+		err := ValidateAudiences("gatekey", tt.audiences)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: ValidateAudiences() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestAudienceAccepted(t *testing.T) {
+	accepted := []string{"gatekey", "mobile-app"}
+	if !AudienceAccepted([]string{"mobile-app"}, accepted) {
+		t.Error("expected additional audience to be accepted")
+	}
+	if !AudienceAccepted([]string{"other", "gatekey"}, accepted) {
+		t.Error("expected token with the primary client ID among its audiences to be accepted")
+	}
+	if AudienceAccepted([]string{"other"}, accepted) {
+		t.Error("expected unrelated audience to be rejected")
+	}
+}
@@ -0,0 +1,68 @@
+package oidc
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Sources for the identifier put in a user's VPN certificate common name.
+const (
+	CNSourceEmail       = "email"   // The email claim; changes if the user's email does
+	CNSourceSubject     = "subject" // The immutable sub claim
+	CNSourceClaimPrefix = "claim:"  // A custom claim, e.g. claim:employee_id
+)
+
+// maxCommonNameLength is the longest common name X.509 allows.
+const maxCommonNameLength = 64
+
+// ValidateCNSource checks a provider's common name source.
+func ValidateCNSource(source string) error {
+	switch {
+	case source == "", source == CNSourceEmail, source == CNSourceSubject:
+		return nil
+	case strings.HasPrefix(source, CNSourceClaimPrefix):
+		claim := strings.TrimPrefix(source, CNSourceClaimPrefix)
+		if claim == "" || strings.ContainsAny(claim, " \t\r\n") {
+			return fmt.Errorf("invalid cn_source %q: claim name must be non-empty and contain no whitespace", source)
+		}
+		return nil
+	default:
+		return fmt.Errorf("invalid cn_source %q: must be 'email', 'subject', or 'claim:<name>'", source)
+	}
+}
+
+// CommonName returns the VPN common name for a user from their ID token claims,
+// or "" when the source is the email, which is used by default. It fails when the
+// source claim is missing or not usable as a common name, rather than silently
+// falling back to an identifier that may change.
+func CommonName(source, subject string, claims map[string]interface{}) (string, error) {
+	var cn string
+	switch {
+	case source == "", source == CNSourceEmail:
+		return "", nil
+	case source == CNSourceSubject:
+		cn = subject
+	case strings.HasPrefix(source, CNSourceClaimPrefix):
+		claim := strings.TrimPrefix(source, CNSourceClaimPrefix)
+		switch v := claims[claim].(type) {
+		case string:
+			cn = v
+		case float64:
+			cn = strconv.FormatFloat(v, 'f', -1, 64)
+		}
+	default:
+		return "", fmt.Errorf("invalid cn_source %q", source)
+	}
+
+	if cn == "" {
+		return "", fmt.Errorf("cn_source %s: claim missing from ID token", source)
+	}
+	if len(cn) > maxCommonNameLength {
+		return "", fmt.Errorf("cn_source %s: value is longer than %d characters", source, maxCommonNameLength)
+	}
+	if strings.ContainsAny(cn, "\r\n\x00") {
+		return "", fmt.Errorf("cn_source %s: value contains control characters", source)
+	}
+	return cn, nil
+}
@@ -0,0 +1,55 @@
+package oidc
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateCNSource(t *testing.T) {
+	tests := []struct {
+		source  string
+		wantErr bool
+	}{
+		{"", false},
+		{"email", false},
+		{"subject", false},
+		{"claim:employee_id", false},
+		{"claim:", true},
+		{"claim:employee id", true},
+		{"upn", true},
+	}
+	for _, tt := range tests {
+		err := ValidateCNSource(tt.source)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ValidateCNSource(%q) error = %v, wantErr %v", tt.source, err, tt.wantErr)
+		}
+	}
+}
+
+func TestCommonName(t *testing.T) {
+	claims := map[string]interface{}{
+		"employee_id": "E1234",
+		"employee_no": float64(42),
+		"long":        strings.Repeat("a", 65),
+		"multiline":   "a\nb",
+	}
+	tests := []struct {
+		source  string
+		want    string
+		wantErr bool
+	}{
+		{"email", "", false},
+		{"subject", "00u1abcd", false},
+		{"claim:employee_id", "E1234", false},
+		{"claim:employee_no", "42", false},
+		{"claim:missing", "", true},
+		{"claim:long", "", true},
+		{"claim:multiline", "", true},
+	}
+	for _, tt := range tests {
+		got, err := CommonName(tt.source, "00u1abcd", claims)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("CommonName(%q) = %q, %v; want %q, wantErr %v", tt.source, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
@@ -20,13 +20,17 @@ type Provider struct {
 	displayName string
 	config      config.OIDCProvider
 	oauth2Cfg   *oauth2.Config
-	verifier    *oidc.IDTokenVerifier
+	verifier    *AudienceVerifier
 	provider    *oidc.Provider
 	claimMap    map[string]string
 }
 
 // NewProvider creates a new OIDC provider.
 func NewProvider(ctx context.Context, cfg config.OIDCProvider) (*Provider, error) {
+	if err := ValidateAudiences(cfg.ClientID, cfg.AdditionalAudiences); err != nil {
+		return nil, fmt.Errorf("invalid OIDC provider %s: %w", cfg.Name, err)
+	}
+
 	provider, err := oidc.NewProvider(ctx, cfg.Issuer)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create OIDC provider: %w", err)
@@ -40,9 +44,7 @@ func NewProvider(ctx context.Context, cfg config.OIDCProvider) (*Provider, error
 		Scopes:       cfg.Scopes,
 	}
 
-	verifier := provider.Verifier(&oidc.Config{
-		ClientID: cfg.ClientID,
-	})
+	verifier := NewAudienceVerifier(provider, cfg.ClientID, cfg.AdditionalAudiences)
 
 	// Default claim mappings
 	claimMap := map[string]string{
@@ -0,0 +1,37 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestExchangeCode(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Code string `json:"code"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		if r.URL.Path != "/api/v1/auth/cli/exchange" || req.Code != "one-time" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(`{"token":"session","email":"a@example.com","name":"A","expires_in":3600}`))
+	}))
+	defer srv.Close()
+
+	a := NewAuthManager(&Config{ServerURL: srv.URL})
+	token, err := a.exchangeCode(context.Background(), "one-time")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.AccessToken != "session" || token.UserEmail != "a@example.com" || token.ExpiresAt.IsZero() {
+		t.Errorf("unexpected token %+v", token)
+	}
+
+	if _, err := a.exchangeCode(context.Background(), "reused"); err == nil {
+		t.Error("expected a rejected code to fail")
+	}
+}
@@ -17,6 +17,8 @@ type Config struct {
 	ConfigDir     string `yaml:"config_dir"`
 	LogLevel      string `yaml:"log_level"`
 	APIKey        string `yaml:"api_key,omitempty"`
+	VerifyProbe   string `yaml:"verify_probe,omitempty"`
+	VerifyDomain  string `yaml:"verify_domain,omitempty"`
 
 	// Runtime paths (not saved to config)
 	configPath string `yaml:"-"`
@@ -142,6 +144,10 @@ func (c *Config) Set(key, value string) error {
 		c.LogLevel = value
 	case "api_key":
 		c.APIKey = value
+	case "verify_probe":
+		c.VerifyProbe = value
+	case "verify_domain":
+		c.VerifyDomain = value
 	default:
 		return fmt.Errorf("unknown configuration key: %s", key)
 	}
@@ -163,6 +169,12 @@ func (c *Config) Print() error {
 	fmt.Printf("OpenVPN binary: %s\n", c.OpenVPNBinary)
 	fmt.Printf("Config dir:     %s\n", c.ConfigDir)
 	fmt.Printf("Log level:      %s\n", c.LogLevel)
+	if c.VerifyProbe != "" {
+		fmt.Printf("Verify probe:   %s\n", c.VerifyProbe)
+	}
+	if c.VerifyDomain != "" {
+		fmt.Printf("Verify domain:  %s\n", c.VerifyDomain)
+	}
 	return nil
 }
 
@@ -206,6 +218,12 @@ func (c *Config) GatewayLogPath(gatewayName string) string {
 	return filepath.Join(c.dataDir, fmt.Sprintf("openvpn-%s.log", gatewayName))
 }
 
+// GatewayAskpassPath returns the path of the short-lived file OpenVPN reads a
+// gateway's key passphrase from with --askpass. It is removed once OpenVPN has started.
+func (c *Config) GatewayAskpassPath(gatewayName string) string {
+	return filepath.Join(c.dataDir, fmt.Sprintf("openvpn-%s.askpass", gatewayName))
+}
+
 // GatewayConfigPath returns the path to the OpenVPN config for a specific gateway.
 func (c *Config) GatewayConfigPath(gatewayName string) string {
 	return filepath.Join(c.dataDir, fmt.Sprintf("%s.ovpn", gatewayName))
@@ -0,0 +1,330 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// certExpiryWarning is how close to expiry the server certificate gets a warning.
+const certExpiryWarning = 14 * 24 * time.Hour
+
+// DoctorCheck is the result of one diagnostic check, with a hint on how to fix a
+// failure.
+type DoctorCheck struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Detail string `json:"detail"`
+	Hint   string `json:"hint,omitempty"`
+}
+
+// DoctorReport is the result of running every diagnostic check.
+type DoctorReport struct {
+	Server string        `json:"server"`
+	OK     bool          `json:"ok"`
+	Checks []DoctorCheck `json:"checks"`
+}
+
+func (r *DoctorReport) add(name, status, detail, hint string) {
+	if status == CheckPass || status == CheckSkip {
+		hint = ""
+	}
+	r.Checks = append(r.Checks, DoctorCheck{Name: name, Status: status, Detail: detail, Hint: hint})
+}
+
+// Doctor runs the checks needed to connect: the server is reachable with a valid
+// certificate, the session is valid, OpenVPN is installed and the config download
+// endpoint accepts the user, then verifies any active connections. Each failure
+// comes with a hint on how to fix it.
+func (v *VPNManager) Doctor(ctx context.Context, jsonOutput bool) error {
+	report := &DoctorReport{Server: v.config.ServerURL}
+	timeout := 10 * time.Second
+
+	if v.checkServer(ctx, report, timeout) {
+		if authHeader, ok := v.checkSession(ctx, report, timeout); ok {
+			v.checkConfigDownload(ctx, report, authHeader, timeout)
+		}
+	}
+	v.checkOpenVPN(report)
+	v.checkConnections(ctx, report)
+
+	report.OK = true
+	failed := 0
+	for _, check := range report.Checks {
+		if check.Status == CheckFail {
+			report.OK = false
+			failed++
+		}
+	}
+
+	if jsonOutput {
+		if err := json.NewEncoder(os.Stdout).Encode(report); err != nil {
+			return err
+		}
+	} else {
+		fmt.Printf("GateKey doctor (%s)\n\n", report.Server)
+		for _, check := range report.Checks {
+			fmt.Printf("  [%s] %s: %s\n", strings.ToUpper(check.Status), check.Name, check.Detail)
+			if check.Hint != "" {
+				fmt.Printf("         -> %s\n", check.Hint)
+			}
+		}
+		fmt.Println()
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d check(s) failed", failed)
+	}
+	if !jsonOutput {
+		fmt.Println("All checks passed.")
+	}
+	return nil
+}
+
+// checkServer checks that the server URL is set and answers its health check
+// over a connection with a valid certificate. It reports whether the server can
+// be used for further checks.
+func (v *VPNManager) checkServer(ctx context.Context, report *DoctorReport, timeout time.Duration) bool {
+	if v.config.ServerURL == "" {
+		report.add("server", CheckFail, "no server URL configured",
+			"run 'gatekey config init --server https://vpn.example.com'")
+		return false
+	}
+	healthURL, err := url.Parse(v.config.ServerURL)
+	if err != nil || healthURL.Host == "" {
+		report.add("server", CheckFail, fmt.Sprintf("invalid server URL %q", v.config.ServerURL),
+			"set it with 'gatekey config set server_url https://vpn.example.com'")
+		return false
+	}
+	healthURL.Path = "/health"
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, healthURL.String(), nil)
+	if err != nil {
+		report.add("server", CheckFail, err.Error(), "")
+		return false
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		report.add("server", CheckFail, fmt.Sprintf("%s is unreachable: %v", healthURL.Host, err), serverErrorHint(err))
+		return false
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		report.add("server", CheckFail, fmt.Sprintf("health check returned %d", resp.StatusCode),
+			"check the server URL points at GateKey, not a proxy or another site")
+		return false
+	}
+	report.add("server", CheckPass, fmt.Sprintf("%s is reachable", healthURL.Host), "")
+
+	switch {
+	case resp.TLS == nil:
+		report.add("tls", CheckWarn, "the server URL doesn't use HTTPS, so credentials cross the network in cleartext",
+			"use an https:// server URL")
+	case len(resp.TLS.PeerCertificates) > 0:
+		cert := resp.TLS.PeerCertificates[0]
+		left := time.Until(cert.NotAfter)
+		if left < certExpiryWarning {
+			report.add("tls", CheckWarn, fmt.Sprintf("certificate expires in %d days (%s)", int(left.Hours()/24), cert.NotAfter.Format(time.RFC3339)),
+				"ask your administrator to renew the server certificate")
+		} else {
+			report.add("tls", CheckPass, fmt.Sprintf("certificate is valid until %s", cert.NotAfter.Format("2006-01-02")), "")
+		}
+	}
+	return true
+}
+
+// serverErrorHint suggests a fix for a failed request to the server.
+func serverErrorHint(err error) string {
+	var unknownAuthority x509.UnknownAuthorityError
+	var hostname x509.HostnameError
+	var invalid x509.CertificateInvalidError
+	var certErr *tls.CertificateVerificationError
+	switch {
+	case errors.As(err, &unknownAuthority):
+		return "the server certificate isn't trusted; install your organization's CA certificate or ask your administrator"
+	case errors.As(err, &hostname):
+		return "the server certificate doesn't match the server URL; check the hostname in your config"
+	case errors.As(err, &invalid):
+		return "the server certificate is expired or not yet valid; check your system clock, then ask your administrator"
+	case errors.As(err, &certErr):
+		return "the server certificate couldn't be verified; ask your administrator"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "the server didn't answer in time; check your network, proxy or firewall"
+	}
+	return "check the server URL and your network connection"
+}
+
+// checkSession checks that the saved session or API key is accepted by the
+// server, returning the Authorization header to use for further checks.
+func (v *VPNManager) checkSession(ctx context.Context, report *DoctorReport, timeout time.Duration) (string, bool) {
+	authHeader, err := v.auth.GetAuthHeader()
+	if err != nil {
+		report.add("session", CheckFail, err.Error(), "run 'gatekey login'")
+		return "", false
+	}
+
+	status, body, err := v.doctorRequest(ctx, http.MethodGet, "/api/v1/users/me", authHeader, nil, timeout)
+	if err != nil {
+		report.add("session", CheckFail, err.Error(), serverErrorHint(err))
+		return "", false
+	}
+	if status == http.StatusUnauthorized {
+		report.add("session", CheckFail, "the server rejected your session", "run 'gatekey login' to sign in again")
+		return "", false
+	}
+	if status != http.StatusOK {
+		report.add("session", CheckFail, fmt.Sprintf("server returned %d", status), "try again later or ask your administrator")
+		return "", false
+	}
+
+	var me struct {
+		Email string `json:"email"`
+	}
+	_ = json.Unmarshal(body, &me)
+	detail := "session is valid"
+	if me.Email != "" {
+		detail = "signed in as " + me.Email
+	}
+	if v.config.APIKey != "" {
+		detail += " (API key)"
+	} else if token, err := v.auth.GetToken(); err == nil && !token.ExpiresAt.IsZero() {
+		detail += fmt.Sprintf(", session expires %s", token.ExpiresAt.Local().Format("2006-01-02 15:04"))
+	}
+	report.add("session", CheckPass, detail, "")
+	return authHeader, true
+}
+
+// checkConfigDownload checks that the user may use the config download endpoint.
+// It sends a request without a gateway, which the server rejects after checking
+// authentication but before issuing a certificate.
+func (v *VPNManager) checkConfigDownload(ctx context.Context, report *DoctorReport, authHeader string, timeout time.Duration) {
+	status, _, err := v.doctorRequest(ctx, http.MethodPost, "/api/v1/configs/generate", authHeader, []byte(`{}`), timeout)
+	switch {
+	case err != nil:
+		report.add("config download", CheckFail, err.Error(), serverErrorHint(err))
+	case status == http.StatusBadRequest:
+		report.add("config download", CheckPass, "the config endpoint accepts your session", "")
+	case status == http.StatusUnauthorized:
+		report.add("config download", CheckFail, "the config endpoint rejected your session", "run 'gatekey login' to sign in again")
+	case status == http.StatusServiceUnavailable:
+		report.add("config download", CheckFail, "config generation is not available on the server",
+			"the server's PKI isn't set up; ask your administrator")
+	default:
+		report.add("config download", CheckFail, fmt.Sprintf("server returned %d", status),
+			"a proxy may be blocking the request; ask your administrator")
+	}
+}
+
+func (v *VPNManager) doctorRequest(ctx context.Context, method, path, authHeader string, body []byte, timeout time.Duration) (int, []byte, error) {
+	u, err := url.Parse(v.config.ServerURL)
+	if err != nil {
+		return 0, nil, fmt.Errorf("invalid server URL: %w", err)
+	}
+	u.Path = path
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return 0, nil, err
+	}
+	req.Header.Set("Authorization", authHeader)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+	var buf bytes.Buffer
+	_, _ = buf.ReadFrom(resp.Body)
+	return resp.StatusCode, buf.Bytes(), nil
+}
+
+var openvpnVersion = regexp.MustCompile(`OpenVPN (\d+)\.(\d+)(?:\.(\d+))?`)
+
+// checkOpenVPN checks that OpenVPN is installed and recent enough.
+func (v *VPNManager) checkOpenVPN(report *DoctorReport) {
+	binary := v.config.OpenVPNBinary
+	path, err := exec.LookPath(binary)
+	if err != nil {
+		report.add("openvpn", CheckFail, fmt.Sprintf("%s not found", binary),
+			"install OpenVPN 2.5 or later (e.g. 'apt install openvpn' or 'brew install openvpn'), or set its path with 'gatekey config set openvpn_binary'")
+		return
+	}
+
+	// openvpn --version exits non-zero on some versions, so only the output matters
+	out, _ := exec.Command(path, "--version").CombinedOutput()
+	major, minor, ok := parseOpenVPNVersion(string(out))
+	switch {
+	case !ok:
+		report.add("openvpn", CheckWarn, fmt.Sprintf("could not read the version of %s", path), "check that it is a working OpenVPN binary")
+	case major < 2 || (major == 2 && minor < 4):
+		report.add("openvpn", CheckFail, fmt.Sprintf("OpenVPN %d.%d at %s is too old", major, minor, path),
+			"upgrade to OpenVPN 2.5 or later")
+	case major == 2 && minor < 5:
+		report.add("openvpn", CheckWarn, fmt.Sprintf("OpenVPN %d.%d at %s doesn't support data-ciphers", major, minor, path),
+			"upgrade to OpenVPN 2.5 or later")
+	default:
+		report.add("openvpn", CheckPass, fmt.Sprintf("OpenVPN %d.%d at %s", major, minor, path), "")
+	}
+}
+
+// parseOpenVPNVersion returns the major and minor version from openvpn --version.
+func parseOpenVPNVersion(out string) (int, int, bool) {
+	m := openvpnVersion.FindStringSubmatch(out)
+	if m == nil {
+		return 0, 0, false
+	}
+	major, _ := strconv.Atoi(m[1])
+	minor, _ := strconv.Atoi(m[2])
+	return major, minor, true
+}
+
+// checkConnections verifies routes and DNS on every active connection.
+func (v *VPNManager) checkConnections(ctx context.Context, report *DoctorReport) {
+	multiState := v.loadMultiState()
+	v.cleanupStaleConnections(multiState)
+
+	connected := 0
+	for name, conn := range multiState.Connections {
+		if !conn.Connected || !v.isProcessRunning(conn.PID) {
+			continue
+		}
+		if conn.Gateway == "" {
+			conn.Gateway = name
+		}
+		connected++
+
+		verify := &VerifyReport{Gateway: conn.Gateway, Interface: conn.TunInterface}
+		v.verifyConnection(ctx, conn, VerifyOptions{
+			Probe:   v.config.VerifyProbe,
+			Domain:  v.config.VerifyDomain,
+			Timeout: 5 * time.Second,
+		}, verify)
+		hint := fmt.Sprintf("run 'gatekey verify --gateway %s' for details, or reconnect with 'gatekey connect %s'", conn.Gateway, conn.Gateway)
+		for _, check := range verify.Checks {
+			report.add(conn.Gateway+": "+check.Name, check.Status, check.Detail, hint)
+		}
+	}
+	if connected == 0 {
+		report.add("connection", CheckSkip, "not connected; routes and DNS are checked once you connect", "")
+	}
+}
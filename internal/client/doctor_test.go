@@ -0,0 +1,68 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseOpenVPNVersion(t *testing.T) {
+	out := "OpenVPN 2.6.9 x86_64-pc-linux-gnu [SSL (OpenSSL)] [LZO] [LZ4] [EPOLL] [MH/PKTINFO] [AEAD]\nlibrary versions: OpenSSL 3.0.13"
+	if major, minor, ok := parseOpenVPNVersion(out); !ok || major != 2 || minor != 6 {
+		t.Errorf("parseOpenVPNVersion() = %d.%d, %v; want 2.6", major, minor, ok)
+	}
+	if _, _, ok := parseOpenVPNVersion("command not found"); ok {
+		t.Error("parseOpenVPNVersion() without a version: want not ok")
+	}
+}
+
+func TestDoctorServerChecks(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/health":
+			w.WriteHeader(http.StatusOK)
+		case "/api/v1/users/me":
+			if r.Header.Get("Authorization") != "Bearer gk_test" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			_, _ = w.Write([]byte(`{"email":"alice@example.com"}`))
+		case "/api/v1/configs/generate":
+			w.WriteHeader(http.StatusBadRequest)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	cfg := DefaultConfig()
+	cfg.ServerURL = srv.URL
+	cfg.APIKey = "gk_test"
+	v := NewVPNManager(cfg)
+	report := &DoctorReport{}
+
+	ctx := context.Background()
+	if !v.checkServer(ctx, report, time.Second) {
+		t.Fatalf("checkServer failed: %+v", report.Checks)
+	}
+	authHeader, ok := v.checkSession(ctx, report, time.Second)
+	if !ok {
+		t.Fatalf("checkSession failed: %+v", report.Checks)
+	}
+	v.checkConfigDownload(ctx, report, authHeader, time.Second)
+
+	want := map[string]string{"server": CheckPass, "tls": CheckWarn, "session": CheckPass, "config download": CheckPass}
+	for _, check := range report.Checks {
+		if want[check.Name] != check.Status {
+			t.Errorf("%s: got %s (%s), want %s", check.Name, check.Status, check.Detail, want[check.Name])
+		}
+	}
+
+	cfg.APIKey = "gk_revoked"
+	report = &DoctorReport{}
+	if _, ok := v.checkSession(ctx, report, time.Second); ok || report.Checks[0].Hint == "" {
+		t.Errorf("checkSession with a rejected key: want failure with a hint, got %+v", report.Checks)
+	}
+}
@@ -0,0 +1,133 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gatekey-project/gatekey/internal/apiclient"
+)
+
+// ReachableTarget is something the user can reach through a gateway, computed by
+// the server from their access rules and the gateway's networks.
+type ReachableTarget = apiclient.ReachableTarget
+
+// ShowReachable prints what the user can reach through a gateway, so they can
+// check before connecting rather than finding out afterwards.
+func (v *VPNManager) ShowReachable(ctx context.Context, gatewayName string, jsonOutput bool) error {
+	api, err := v.apiClient()
+	if err != nil {
+		return fmt.Errorf("authentication required: %w\nRun 'gatekey login' to authenticate", err)
+	}
+
+	gateways, err := v.fetchGateways(ctx, api)
+	if err != nil {
+		return fmt.Errorf("failed to fetch gateways: %w", err)
+	}
+	gateway, err := selectGateway(gateways, gatewayName)
+	if err != nil {
+		return err
+	}
+
+	targets, err := v.fetchReachable(ctx, api, gateway.ID)
+	if err != nil {
+		return fmt.Errorf("failed to fetch reachable networks: %w", err)
+	}
+
+	if jsonOutput {
+		return json.NewEncoder(os.Stdout).Encode(map[string]interface{}{
+			"gateway":   gateway.Name,
+			"reachable": targets,
+		})
+	}
+	printReachable(gateway.Name, targets)
+	return nil
+}
+
+// fetchReachable retrieves what the user can reach through a gateway.
+func (v *VPNManager) fetchReachable(ctx context.Context, api *apiclient.Client, gatewayID string) ([]ReachableTarget, error) {
+	targets, err := api.ListReachable(ctx, gatewayID)
+	return targets, loginExpired(err)
+}
+
+// printReachable lists reachable targets, one per line.
+func printReachable(gatewayName string, targets []ReachableTarget) {
+	if len(targets) == 0 {
+		fmt.Printf("No networks are reachable for you through %s. Ask your administrator for access rules.\n", gatewayName)
+		return
+	}
+	fmt.Printf("Reachable through %s:\n", gatewayName)
+	for _, t := range targets {
+		fmt.Printf("  %s\n", formatReachable(t))
+	}
+}
+
+// formatReachable renders a target as e.g. "10.0.0.1 tcp/443 on network prod,
+// allowed by rule: web (ticket #123)".
+func formatReachable(t ReachableTarget) string {
+	s := t.Value
+	switch {
+	case t.Protocol != "" && t.Ports != "":
+		s += " " + t.Protocol + "/" + t.Ports
+	case t.Protocol != "":
+		s += " " + t.Protocol
+	case t.Ports != "":
+		s += " port " + t.Ports
+	}
+	s += fmt.Sprintf(" on network %s, allowed by rule: %s", t.Network, t.Rule)
+	if t.Description != "" {
+		s += " (" + t.Description + ")"
+	}
+	return s
+}
+
+// connectSummaryWait is how long to wait after starting OpenVPN for the gateway
+// to report the connection, and with it the assigned VPN IP.
+const connectSummaryWait = 10 * time.Second
+
+// fetchConnectSummary retrieves the summary of the connection to a gateway
+// started at or after since, waiting a little for its VPN IP to be known.
+func (v *VPNManager) fetchConnectSummary(ctx context.Context, api *apiclient.Client, gatewayID string, since time.Time) (*apiclient.ConnectSummary, error) {
+	deadline := time.Now().Add(connectSummaryWait)
+	for {
+		summary, err := api.GetConnectSummary(ctx, gatewayID, v.TunnelMode, since)
+		if err != nil || summary.VPNIP != "" || time.Now().After(deadline) {
+			return summary, loginExpired(err)
+		}
+		select {
+		case <-ctx.Done():
+			return summary, nil
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// formatConnectSummary renders a connection summary as e.g. "Connected to
+// prod-gw as 10.8.0.6 (split tunnel). You can reach: 10.1.0.0/16, db.internal.
+// DNS: 10.1.0.2.", followed by the admin's message on its own line.
+func formatConnectSummary(s *apiclient.ConnectSummary) string {
+	var b strings.Builder
+	b.WriteString("Connected to " + s.GatewayName)
+	if s.VPNIP != "" {
+		b.WriteString(" as " + s.VPNIP)
+	}
+	if s.TunnelMode != "" {
+		b.WriteString(" (" + s.TunnelMode + " tunnel)")
+	}
+	b.WriteString(".")
+	if len(s.Reachable) > 0 {
+		b.WriteString(" You can reach: " + strings.Join(s.Reachable, ", ") + ".")
+	} else {
+		b.WriteString(" You can't reach any networks yet; ask your administrator for access rules.")
+	}
+	if len(s.DNSServers) > 0 {
+		b.WriteString(" DNS: " + strings.Join(s.DNSServers, ", ") + ".")
+	}
+	if s.Message != "" {
+		b.WriteString("\n" + s.Message)
+	}
+	return b.String()
+}
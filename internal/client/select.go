@@ -0,0 +1,114 @@
+package client
+
+import (
+	"fmt"
+	"strings"
+)
+
+// GatewayListEntry is the machine-readable form of a gateway in `gatekey list --json`.
+// Field names are part of the CLI's scripting interface and must stay stable.
+type GatewayListEntry struct {
+	ID            string `json:"id"`
+	Name          string `json:"name"`
+	Hostname      string `json:"hostname"`
+	PublicIP      string `json:"public_ip,omitempty"`
+	VPNPort       int    `json:"vpn_port,omitempty"`
+	VPNProtocol   string `json:"vpn_protocol,omitempty"`
+	Status        string `json:"status"`
+	LastHeartbeat string `json:"last_heartbeat,omitempty"`
+	Connected     bool   `json:"connected"`
+	TunnelMode    string `json:"tunnel_mode,omitempty"`
+	TunnelChoice  bool   `json:"tunnel_choice"`
+}
+
+// MeshHubListEntry is the machine-readable form of a mesh hub in `gatekey mesh list --json`.
+type MeshHubListEntry struct {
+	ID             string `json:"id"`
+	Name           string `json:"name"`
+	Description    string `json:"description,omitempty"`
+	PublicEndpoint string `json:"public_endpoint"`
+	Status         string `json:"status"`
+	SpokeCount     int    `json:"spoke_count"`
+	Connected      bool   `json:"connected"`
+}
+
+// selectGateway picks the gateway matching name by ID or case-insensitive name.
+// It fails when nothing matches, when more than one gateway matches, or when name
+// is empty and the choice isn't obvious, so scripted connects never guess.
+func selectGateway(gateways []Gateway, name string) (*Gateway, error) {
+	if name == "" {
+		if len(gateways) == 1 {
+			return &gateways[0], nil
+		}
+		names := make([]string, 0, len(gateways))
+		for _, gw := range gateways {
+			names = append(names, gw.Name)
+		}
+		return nil, fmt.Errorf("multiple gateways available (%s). Specify one: gatekey connect <gateway-name>", strings.Join(names, ", "))
+	}
+
+	// An exact ID match is unambiguous
+	for i := range gateways {
+		if gateways[i].ID == name {
+			return &gateways[i], nil
+		}
+	}
+
+	var matches []*Gateway
+	for i := range gateways {
+		if strings.EqualFold(gateways[i].Name, name) {
+			matches = append(matches, &gateways[i])
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("gateway '%s' not found or not accessible. Run 'gatekey list' to see available gateways", name)
+	case 1:
+		return matches[0], nil
+	default:
+		ids := make([]string, 0, len(matches))
+		for _, gw := range matches {
+			ids = append(ids, gw.ID)
+		}
+		return nil, fmt.Errorf("gateway name '%s' is ambiguous, matching IDs: %s. Connect by ID instead", name, strings.Join(ids, ", "))
+	}
+}
+
+// selectMeshHub picks the mesh hub matching name with the same rules as selectGateway.
+func selectMeshHub(hubs []MeshHub, name string) (*MeshHub, error) {
+	if name == "" {
+		if len(hubs) == 1 {
+			return &hubs[0], nil
+		}
+		names := make([]string, 0, len(hubs))
+		for _, hub := range hubs {
+			names = append(names, hub.Name)
+		}
+		return nil, fmt.Errorf("multiple mesh hubs available (%s). Specify one: gatekey mesh connect <hub-name>", strings.Join(names, ", "))
+	}
+
+	for i := range hubs {
+		if hubs[i].ID == name {
+			return &hubs[i], nil
+		}
+	}
+
+	var matches []*MeshHub
+	for i := range hubs {
+		if strings.EqualFold(hubs[i].Name, name) {
+			matches = append(matches, &hubs[i])
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("mesh hub '%s' not found or not accessible. Run 'gatekey mesh list' to see available hubs", name)
+	case 1:
+		return matches[0], nil
+	default:
+		ids := make([]string, 0, len(matches))
+		for _, hub := range matches {
+			ids = append(ids, hub.ID)
+		}
+		return nil, fmt.Errorf("mesh hub name '%s' is ambiguous, matching IDs: %s. Connect by ID instead", name, strings.Join(ids, ", "))
+	}
+}
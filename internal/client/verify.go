@@ -0,0 +1,423 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// Verify check results.
+const (
+	CheckPass = "pass"
+	CheckFail = "fail"
+	CheckWarn = "warn"
+	CheckSkip = "skip"
+)
+
+// VerifyOptions configures post-connect verification.
+type VerifyOptions struct {
+	Probe   string        // host:port to reach through the tunnel
+	Domain  string        // Internal name that should resolve via the tunnel DNS
+	Timeout time.Duration // Per-check network timeout
+}
+
+// VerifyCheck is the result of one verification check.
+type VerifyCheck struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Detail string `json:"detail"`
+}
+
+// VerifyReport is the result of verifying a connection.
+type VerifyReport struct {
+	Gateway   string        `json:"gateway"`
+	Interface string        `json:"interface"`
+	OK        bool          `json:"ok"`
+	Checks    []VerifyCheck `json:"checks"`
+}
+
+func (r *VerifyReport) add(name, status, detail string) {
+	r.Checks = append(r.Checks, VerifyCheck{Name: name, Status: status, Detail: detail})
+}
+
+// pushedOptions are the options the gateway pushed on connect.
+type pushedOptions struct {
+	Routes          []string // CIDRs
+	DNS             []string
+	Domains         []string
+	RedirectGateway bool
+}
+
+// Verify checks that an active connection routes traffic and DNS as intended:
+// pushed routes go through the tunnel, an optional internal host is reachable,
+// internal names resolve via the pushed DNS servers and, in full-tunnel mode,
+// the system resolver doesn't send queries outside the tunnel.
+func (v *VPNManager) Verify(ctx context.Context, gatewayName string, opts VerifyOptions, jsonOutput bool) error {
+	if opts.Timeout <= 0 {
+		opts.Timeout = 5 * time.Second
+	}
+	if opts.Probe == "" {
+		opts.Probe = v.config.VerifyProbe
+	}
+	if opts.Domain == "" {
+		opts.Domain = v.config.VerifyDomain
+	}
+
+	conn, err := v.activeConnection(gatewayName)
+	if err != nil {
+		return err
+	}
+
+	report := &VerifyReport{Gateway: conn.Gateway, Interface: conn.TunInterface}
+	v.verifyConnection(ctx, conn, opts, report)
+
+	report.OK = true
+	failed := 0
+	for _, check := range report.Checks {
+		if check.Status == CheckFail {
+			report.OK = false
+			failed++
+		}
+	}
+
+	if jsonOutput {
+		if err := json.NewEncoder(os.Stdout).Encode(report); err != nil {
+			return err
+		}
+	} else {
+		fmt.Printf("Verifying %s (%s)\n\n", report.Gateway, report.Interface)
+		for _, check := range report.Checks {
+			fmt.Printf("  [%s] %s: %s\n", strings.ToUpper(check.Status), check.Name, check.Detail)
+		}
+		fmt.Println()
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("verification failed: %d check(s) failed", failed)
+	}
+	if !jsonOutput {
+		fmt.Println("All checks passed.")
+	}
+	return nil
+}
+
+// activeConnection returns the named connection, or the only one if no name is given.
+func (v *VPNManager) activeConnection(gatewayName string) (*ConnectionState, error) {
+	multiState := v.loadMultiState()
+	v.cleanupStaleConnections(multiState)
+
+	var active []*ConnectionState
+	for name, conn := range multiState.Connections {
+		if !conn.Connected || !v.isProcessRunning(conn.PID) {
+			continue
+		}
+		if conn.Gateway == "" {
+			conn.Gateway = name
+		}
+		if gatewayName != "" && name == gatewayName {
+			return conn, nil
+		}
+		active = append(active, conn)
+	}
+
+	switch {
+	case gatewayName != "":
+		return nil, fmt.Errorf("not connected to %s", gatewayName)
+	case len(active) == 0:
+		return nil, fmt.Errorf("not connected. Run 'gatekey connect' first")
+	case len(active) > 1:
+		return nil, fmt.Errorf("connected to %d gateways; specify which one to verify", len(active))
+	}
+	return active[0], nil
+}
+
+func (v *VPNManager) verifyConnection(ctx context.Context, conn *ConnectionState, opts VerifyOptions, report *VerifyReport) {
+	if status := v.checkTunnelStatusForGateway(conn.Gateway); status != "connected" {
+		report.add("tunnel", CheckFail, fmt.Sprintf("tunnel is %s; see %s", status, v.config.GatewayLogPath(conn.Gateway)))
+		return
+	}
+	report.add("tunnel", CheckPass, "OpenVPN reports the tunnel is up")
+
+	logData, _ := os.ReadFile(v.config.GatewayLogPath(conn.Gateway))
+	pushed := parsePushReply(string(logData))
+	routes := appendMissing(pushed.Routes, v.getRoutesFromGatewayConfig(conn.Gateway))
+
+	// Routes
+	if len(routes) == 0 && !pushed.RedirectGateway {
+		report.add("routes", CheckWarn, "no routes were pushed; you may not have any access rules on this gateway")
+	}
+	for _, cidr := range routes {
+		ip, err := firstHost(cidr)
+		if err != nil {
+			report.add("route "+cidr, CheckWarn, err.Error())
+			continue
+		}
+		v.checkRoute(report, "route "+cidr, ip, conn.TunInterface)
+	}
+	if pushed.RedirectGateway {
+		v.checkRoute(report, "default route", "1.1.1.1", conn.TunInterface)
+	}
+
+	// Internal host
+	if opts.Probe != "" {
+		start := time.Now()
+		c, err := net.DialTimeout("tcp", opts.Probe, opts.Timeout)
+		if err != nil {
+			report.add("probe "+opts.Probe, CheckFail, err.Error())
+		} else {
+			c.Close()
+			report.add("probe "+opts.Probe, CheckPass, fmt.Sprintf("connected in %s", time.Since(start).Round(time.Millisecond)))
+		}
+	}
+
+	// DNS
+	for _, server := range pushed.DNS {
+		v.checkRoute(report, "dns server "+server, server, conn.TunInterface)
+	}
+	domain := opts.Domain
+	if domain == "" && len(pushed.Domains) > 0 {
+		domain = pushed.Domains[0]
+	}
+	if domain != "" {
+		checkDNSResolution(ctx, report, domain, pushed.DNS, opts.Timeout)
+	} else if len(pushed.DNS) > 0 {
+		report.add("dns resolution", CheckSkip, "no internal domain to test; use --domain or 'gatekey config set verify_domain'")
+	}
+	if pushed.RedirectGateway {
+		v.checkDNSLeak(report, pushed.DNS, conn.TunInterface)
+	}
+}
+
+// checkRoute checks that traffic to ip leaves through the tunnel.
+func (v *VPNManager) checkRoute(report *VerifyReport, name, ip, tun string) {
+	dev, err := routeInterface(ip)
+	switch {
+	case err != nil:
+		report.add(name, CheckWarn, "could not look up route: "+err.Error())
+	case isTunnelDevice(dev, tun):
+		report.add(name, CheckPass, fmt.Sprintf("%s goes through %s", ip, dev))
+	default:
+		report.add(name, CheckFail, fmt.Sprintf("%s goes through %s, not the tunnel", ip, dev))
+	}
+}
+
+// checkDNSResolution resolves domain through the pushed DNS servers and through
+// the system resolver.
+func checkDNSResolution(ctx context.Context, report *VerifyReport, domain string, servers []string, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var tunnelAddrs []string
+	if len(servers) > 0 {
+		resolver := &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				d := net.Dialer{Timeout: timeout}
+				return d.DialContext(ctx, network, net.JoinHostPort(servers[0], "53"))
+			},
+		}
+		addrs, err := resolver.LookupHost(ctx, domain)
+		if err != nil {
+			report.add("dns via tunnel", CheckFail, fmt.Sprintf("%s did not resolve via %s: %v", domain, servers[0], err))
+		} else {
+			tunnelAddrs = addrs
+			report.add("dns via tunnel", CheckPass, fmt.Sprintf("%s resolves to %s via %s", domain, strings.Join(addrs, ", "), servers[0]))
+		}
+	}
+
+	addrs, err := net.DefaultResolver.LookupHost(ctx, domain)
+	switch {
+	case err != nil && len(servers) > 0:
+		report.add("dns via system", CheckWarn, fmt.Sprintf("%s resolves via the tunnel but not the system resolver, so apps won't find it: %v", domain, err))
+	case err != nil:
+		report.add("dns via system", CheckFail, fmt.Sprintf("%s did not resolve: %v", domain, err))
+	case tunnelAddrs != nil && !sameAddrs(addrs, tunnelAddrs):
+		report.add("dns via system", CheckWarn, fmt.Sprintf("system resolver returns %s, the tunnel DNS returns %s", strings.Join(addrs, ", "), strings.Join(tunnelAddrs, ", ")))
+	default:
+		report.add("dns via system", CheckPass, fmt.Sprintf("%s resolves to %s", domain, strings.Join(addrs, ", ")))
+	}
+}
+
+// checkDNSLeak checks that, in full-tunnel mode, the system's DNS servers are
+// reached through the tunnel.
+func (v *VPNManager) checkDNSLeak(report *VerifyReport, pushedDNS []string, tun string) {
+	data, err := os.ReadFile("/etc/resolv.conf")
+	if err != nil {
+		report.add("dns leak", CheckSkip, "system DNS servers can't be read on this platform")
+		return
+	}
+
+	nameservers := parseResolvConf(string(data))
+	if len(nameservers) == 0 {
+		report.add("dns leak", CheckWarn, "no nameservers in /etc/resolv.conf")
+		return
+	}
+	for _, ns := range nameservers {
+		ip := net.ParseIP(ns)
+		switch {
+		case contains(pushedDNS, ns):
+			report.add("dns leak "+ns, CheckPass, "system uses the pushed DNS server")
+		case ip != nil && ip.IsLoopback():
+			report.add("dns leak "+ns, CheckWarn, "system uses a local stub resolver; check that it forwards to the pushed DNS servers")
+		default:
+			dev, err := routeInterface(ns)
+			switch {
+			case err != nil:
+				report.add("dns leak "+ns, CheckWarn, "could not look up route: "+err.Error())
+			case isTunnelDevice(dev, tun):
+				report.add("dns leak "+ns, CheckPass, fmt.Sprintf("queries go through %s", dev))
+			default:
+				report.add("dns leak "+ns, CheckFail, fmt.Sprintf("DNS queries leak through %s outside the tunnel", dev))
+			}
+		}
+	}
+}
+
+// parsePushReply extracts routes, DNS settings and redirect-gateway from the last
+// PUSH_REPLY in an OpenVPN log.
+func parsePushReply(log string) pushedOptions {
+	var reply string
+	scanner := bufio.NewScanner(strings.NewReader(log))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "PUSH_REPLY,"); i >= 0 {
+			reply = strings.TrimRight(line[i+len("PUSH_REPLY,"):], "'")
+		}
+	}
+
+	var opts pushedOptions
+	for _, option := range strings.Split(reply, ",") {
+		fields := strings.Fields(option)
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "route":
+			if len(fields) >= 3 {
+				opts.Routes = append(opts.Routes, fields[1]+"/"+netmaskToCIDR(fields[2]))
+			} else if len(fields) == 2 {
+				opts.Routes = append(opts.Routes, fields[1]+"/32")
+			}
+		case "redirect-gateway":
+			opts.RedirectGateway = true
+		case "dhcp-option":
+			if len(fields) < 3 {
+				continue
+			}
+			switch fields[1] {
+			case "DNS":
+				opts.DNS = append(opts.DNS, fields[2])
+			case "DOMAIN", "DOMAIN-SEARCH":
+				opts.Domains = append(opts.Domains, fields[2])
+			}
+		}
+	}
+	return opts
+}
+
+var (
+	linuxRouteDev    = regexp.MustCompile(`\bdev (\S+)`)
+	darwinRouteDev   = regexp.MustCompile(`interface: (\S+)`)
+	resolvNameserver = regexp.MustCompile(`^\s*nameserver\s+(\S+)`)
+)
+
+// routeInterface returns the interface the OS would send traffic to ip through.
+func routeInterface(ip string) (string, error) {
+	var out []byte
+	var err error
+	switch runtime.GOOS {
+	case "linux":
+		out, err = exec.Command("ip", "route", "get", ip).Output()
+	case "darwin":
+		out, err = exec.Command("route", "-n", "get", ip).Output()
+	default:
+		return "", fmt.Errorf("not supported on %s", runtime.GOOS)
+	}
+	if err != nil {
+		return "", err
+	}
+	return parseRouteGet(runtime.GOOS, string(out))
+}
+
+// parseRouteGet extracts the interface from `ip route get` (linux) or
+// `route -n get` (darwin) output.
+func parseRouteGet(goos, out string) (string, error) {
+	re := linuxRouteDev
+	if goos == "darwin" {
+		re = darwinRouteDev
+	}
+	m := re.FindStringSubmatch(out)
+	if m == nil {
+		return "", fmt.Errorf("no interface in route lookup output")
+	}
+	return m[1], nil
+}
+
+// isTunnelDevice reports whether dev is the connection's tunnel. macOS names
+// tunnels utunN regardless of the --dev OpenVPN was started with.
+func isTunnelDevice(dev, tun string) bool {
+	return dev == tun || (runtime.GOOS == "darwin" && strings.HasPrefix(dev, "utun"))
+}
+
+// firstHost returns the first host address in a CIDR, which is routed like the
+// rest of the network.
+func firstHost(cidr string) (string, error) {
+	ip, ipnet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return "", fmt.Errorf("invalid route %q", cidr)
+	}
+	ones, bits := ipnet.Mask.Size()
+	if ones == bits {
+		return ip.String(), nil
+	}
+	host := make(net.IP, len(ipnet.IP))
+	copy(host, ipnet.IP)
+	host[len(host)-1]++
+	return host.String(), nil
+}
+
+func parseResolvConf(data string) []string {
+	var servers []string
+	for _, line := range strings.Split(data, "\n") {
+		if m := resolvNameserver.FindStringSubmatch(line); m != nil {
+			servers = append(servers, m[1])
+		}
+	}
+	return servers
+}
+
+func appendMissing(list, more []string) []string {
+	for _, item := range more {
+		if !contains(list, item) {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func contains(list []string, item string) bool {
+	for _, v := range list {
+		if v == item {
+			return true
+		}
+	}
+	return false
+}
+
+func sameAddrs(a, b []string) bool {
+	for _, addr := range a {
+		if contains(b, addr) {
+			return true
+		}
+	}
+	return false
+}
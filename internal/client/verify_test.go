@@ -0,0 +1,60 @@
+package client
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParsePushReply(t *testing.T) {
+	log := `2024-01-15 10:00:00 PUSH: Received control message: 'PUSH_REPLY,route 10.0.0.0 255.255.255.0,route 10.1.0.5,dhcp-option DNS 10.0.0.2,dhcp-option DOMAIN corp.internal,ping 10'
+2024-01-15 10:05:00 PUSH: Received control message: 'PUSH_REPLY,redirect-gateway def1,route 10.2.0.0 255.255.0.0,dhcp-option DNS 10.0.0.3'
+2024-01-15 10:05:00 Initialization Sequence Completed`
+
+	got := parsePushReply(log)
+	want := pushedOptions{
+		Routes:          []string{"10.2.0.0/16"},
+		DNS:             []string{"10.0.0.3"},
+		RedirectGateway: true,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parsePushReply() = %+v, want the last reply %+v", got, want)
+	}
+
+	got = parsePushReply(`PUSH_REPLY,route 10.0.0.0 255.255.255.0,route 10.1.0.5,dhcp-option DOMAIN corp.internal'`)
+	if !reflect.DeepEqual(got.Routes, []string{"10.0.0.0/24", "10.1.0.5/32"}) || !reflect.DeepEqual(got.Domains, []string{"corp.internal"}) {
+		t.Errorf("parsePushReply() = %+v", got)
+	}
+}
+
+func TestParseRouteGet(t *testing.T) {
+	tests := []struct {
+		goos string
+		out  string
+		want string
+	}{
+		{"linux", "10.0.0.1 dev tun0 src 10.8.0.6 uid 1000 \n    cache \n", "tun0"},
+		{"linux", "1.1.1.1 via 192.168.1.1 dev eth0 src 192.168.1.20 uid 1000 \n", "eth0"},
+		{"darwin", "   route to: 10.0.0.1\ndestination: 10.0.0.0\n  interface: utun4\n      flags: <UP,DONE>\n", "utun4"},
+	}
+	for _, tt := range tests {
+		got, err := parseRouteGet(tt.goos, tt.out)
+		if err != nil || got != tt.want {
+			t.Errorf("parseRouteGet(%s) = %q, %v; want %q", tt.goos, got, err, tt.want)
+		}
+	}
+	if _, err := parseRouteGet("linux", "RTNETLINK answers: Network is unreachable"); err == nil {
+		t.Error("parseRouteGet() with no interface: want error")
+	}
+}
+
+func TestFirstHost(t *testing.T) {
+	for cidr, want := range map[string]string{
+		"10.0.0.0/24": "10.0.0.1",
+		"10.1.0.5/32": "10.1.0.5",
+		"10.2.3.4/16": "10.2.0.1",
+	} {
+		if got, err := firstHost(cidr); err != nil || got != want {
+			t.Errorf("firstHost(%q) = %q, %v; want %q", cidr, got, err, want)
+		}
+	}
+}
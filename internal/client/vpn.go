@@ -4,23 +4,32 @@ import (
 	"bufio"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
-	"net/http"
-	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"runtime"
 	"strconv"
 	"strings"
 	"syscall"
 	"time"
+
+	"github.com/gatekey-project/gatekey/internal/apiclient"
 )
 
 // VPNManager handles OpenVPN process management.
 type VPNManager struct {
 	config *Config
 	auth   *AuthManager
+
+	// TunnelMode is the tunnel mode to request for gateway configs, "full" or
+	// "split", or "" for the gateway's default
+	TunnelMode string
+
+	// Purpose labels generated configs so admins can tell them apart; the
+	// device name and OS are always sent
+	Purpose string
 }
 
 // ConnectionState holds the current VPN connection state.
@@ -43,13 +52,24 @@ type MultiConnectionState struct {
 }
 
 // Gateway represents a VPN gateway from the server.
-type Gateway struct {
-	ID          string `json:"id"`
-	Name        string `json:"name"`
-	Hostname    string `json:"hostname"`
-	Description string `json:"description,omitempty"`
-	Location    string `json:"location,omitempty"`
-	Status      string `json:"status"`
+type Gateway = apiclient.Gateway
+
+// apiClient returns a client for the server that authenticates as the logged-in
+// user, failing if they aren't logged in.
+func (v *VPNManager) apiClient() (*apiclient.Client, error) {
+	if _, err := v.auth.GetAuthHeader(); err != nil {
+		return nil, err
+	}
+	return apiclient.New(v.config.ServerURL, v.auth)
+}
+
+// loginExpired explains a rejected login, which the user can fix by logging in
+// again.
+func loginExpired(err error) error {
+	if errors.Is(err, apiclient.ErrUnauthorized) {
+		return fmt.Errorf("authentication expired. Run 'gatekey login' to re-authenticate")
+	}
+	return err
 }
 
 // NewVPNManager creates a new VPN manager.
@@ -80,18 +100,18 @@ func (v *VPNManager) Connect(ctx context.Context, gatewayName string) error {
 	v.cleanupStaleConnections(multiState)
 
 	// Ensure we're logged in
-	authHeader, err := v.auth.GetAuthHeader()
+	api, err := v.apiClient()
 	if err != nil {
 		return fmt.Errorf("authentication required: %w\nRun 'gatekey login' to authenticate", err)
 	}
 
 	// Check server FIPS requirements
-	if err := v.checkServerFIPSRequirement(ctx, authHeader); err != nil {
+	if err := v.checkServerFIPSRequirement(ctx, api); err != nil {
 		return err
 	}
 
 	// Get available gateways
-	gateways, err := v.fetchGateways(ctx, authHeader)
+	gateways, err := v.fetchGateways(ctx, api)
 	if err != nil {
 		return fmt.Errorf("failed to fetch gateways: %w", err)
 	}
@@ -101,23 +121,9 @@ func (v *VPNManager) Connect(ctx context.Context, gatewayName string) error {
 	}
 
 	// Select gateway
-	var selectedGateway *Gateway
-	if gatewayName == "" {
-		if len(gateways) == 1 {
-			selectedGateway = &gateways[0]
-		} else {
-			return v.promptGatewaySelection(gateways)
-		}
-	} else {
-		for i := range gateways {
-			if strings.EqualFold(gateways[i].Name, gatewayName) || gateways[i].ID == gatewayName {
-				selectedGateway = &gateways[i]
-				break
-			}
-		}
-		if selectedGateway == nil {
-			return fmt.Errorf("gateway '%s' not found", gatewayName)
-		}
+	selectedGateway, err := selectGateway(gateways, gatewayName)
+	if err != nil {
+		return err
 	}
 
 	// Check if already connected to this gateway (by name match after selection)
@@ -134,13 +140,14 @@ func (v *VPNManager) Connect(ctx context.Context, gatewayName string) error {
 	tunInterface := fmt.Sprintf("tun%d", tunNum)
 
 	// Download VPN configuration to gateway-specific path
-	configPath, err := v.downloadConfigForGateway(ctx, authHeader, selectedGateway.ID, selectedGateway.Name)
+	configPath, keyPassphrase, err := v.downloadConfigForGateway(ctx, api, selectedGateway.ID, selectedGateway.Name)
 	if err != nil {
 		return fmt.Errorf("failed to download VPN configuration: %w", err)
 	}
 
 	// Start OpenVPN with specific tun interface
-	pid, err := v.startOpenVPNForGateway(configPath, selectedGateway.Name, tunInterface)
+	startedAt := time.Now()
+	pid, err := v.startOpenVPNForGateway(configPath, selectedGateway.Name, tunInterface, keyPassphrase)
 	if err != nil {
 		return fmt.Errorf("failed to start OpenVPN: %w", err)
 	}
@@ -164,7 +171,16 @@ func (v *VPNManager) Connect(ctx context.Context, gatewayName string) error {
 		return fmt.Errorf("failed to save connection state: %w", err)
 	}
 
-	fmt.Printf("Connected to %s (PID: %d, Interface: %s)\n", selectedGateway.Name, pid, tunInterface)
+	fmt.Printf("OpenVPN started for %s (PID: %d, Interface: %s)\n", selectedGateway.Name, pid, tunInterface)
+
+	// Best effort: an older server may not give a summary, or even report
+	// reachable networks
+	if summary, err := v.fetchConnectSummary(ctx, api, selectedGateway.ID, startedAt); err == nil {
+		fmt.Println(formatConnectSummary(summary))
+	} else if targets, err := v.fetchReachable(ctx, api, selectedGateway.ID); err == nil {
+		printReachable(selectedGateway.Name, targets)
+	}
+
 	fmt.Println("VPN connection established. Use 'gatekey status' to check connection.")
 	return nil
 }
@@ -492,101 +508,40 @@ func (v *VPNManager) saveMultiState(state *MultiConnectionState) error {
 	return os.WriteFile(v.config.StateFilePath(), data, 0600)
 }
 
-// downloadConfigForGateway downloads the VPN config to a gateway-specific path.
-func (v *VPNManager) downloadConfigForGateway(ctx context.Context, authHeader, gatewayID, gatewayName string) (string, error) {
+// downloadConfigForGateway downloads the VPN config to a gateway-specific path. If the
+// gateway encrypts client keys, the key passphrase is also returned; it is only kept
+// in memory and handed to OpenVPN at start.
+func (v *VPNManager) downloadConfigForGateway(ctx context.Context, api *apiclient.Client, gatewayID, gatewayName string) (string, string, error) {
 	configPath := v.config.GatewayConfigPath(gatewayName)
-	client := &http.Client{Timeout: 60 * time.Second}
+	api.SetTimeout(60 * time.Second)
 
 	// Step 1: Generate config and get download URL
-	reqURL := fmt.Sprintf("%s/api/v1/configs/generate", v.config.ServerURL)
-	reqBody := fmt.Sprintf(`{"gateway_id": "%s"}`, gatewayID)
-
-	req, err := http.NewRequestWithContext(ctx, "POST", reqURL, strings.NewReader(reqBody))
+	req := &apiclient.GenerateConfigRequest{GatewayID: gatewayID, TunnelMode: v.TunnelMode}
+	labelConfigRequest(req, v.Purpose)
+	config, err := api.GenerateConfig(ctx, req)
 	if err != nil {
-		return "", err
-	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", authHeader)
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("server returned %d: %s", resp.StatusCode, string(body))
-	}
-
-	var configResp struct {
-		ID          string `json:"id"`
-		DownloadURL string `json:"downloadUrl"`
-		FileName    string `json:"fileName"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&configResp); err != nil {
-		return "", fmt.Errorf("failed to decode response: %w", err)
+		return "", "", loginExpired(err)
 	}
 
 	// Step 2: Download the actual config file
-	downloadURL := fmt.Sprintf("%s%s", v.config.ServerURL, configResp.DownloadURL)
-	downloadReq, err := http.NewRequestWithContext(ctx, "GET", downloadURL, nil)
-	if err != nil {
-		return "", err
-	}
-	downloadReq.Header.Set("Authorization", authHeader)
-
-	downloadResp, err := client.Do(downloadReq)
+	configData, err := api.DownloadConfig(ctx, config)
 	if err != nil {
-		return "", err
-	}
-	defer downloadResp.Body.Close()
-
-	if downloadResp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(downloadResp.Body)
-		return "", fmt.Errorf("download failed with %d: %s", downloadResp.StatusCode, string(body))
-	}
-
-	configData, err := io.ReadAll(downloadResp.Body)
-	if err != nil {
-		return "", fmt.Errorf("failed to read config: %w", err)
+		return "", "", fmt.Errorf("download failed: %w", err)
 	}
 
 	if err := os.WriteFile(configPath, configData, 0600); err != nil {
-		return "", fmt.Errorf("failed to write config: %w", err)
+		return "", "", fmt.Errorf("failed to write config: %w", err)
 	}
 
-	return configPath, nil
+	return configPath, config.KeyPassphrase, nil
 }
 
 // checkServerFIPSRequirement checks if the server requires FIPS mode and verifies compliance.
-func (v *VPNManager) checkServerFIPSRequirement(ctx context.Context, authHeader string) error {
-	reqURL := fmt.Sprintf("%s/api/v1/server/info", v.config.ServerURL)
-	req, err := http.NewRequestWithContext(ctx, "GET", reqURL, nil)
+func (v *VPNManager) checkServerFIPSRequirement(ctx context.Context, api *apiclient.Client) error {
+	serverInfo, err := api.GetServerInfo(ctx)
 	if err != nil {
-		return nil // Don't fail if we can't check
+		return nil // Old server version or unreachable, skip check
 	}
-	req.Header.Set("Authorization", authHeader)
-
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil // Don't fail if server doesn't support this endpoint
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil // Old server version, skip check
-	}
-
-	var serverInfo struct {
-		RequireFIPS bool   `json:"require_fips"`
-		Version     string `json:"version"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&serverInfo); err != nil {
-		return nil // Skip if we can't parse
-	}
-
 	if serverInfo.RequireFIPS {
 		if !IsFIPSCompliant() {
 			fmt.Println()
@@ -615,7 +570,9 @@ func (v *VPNManager) checkServerFIPSRequirement(ctx context.Context, authHeader
 }
 
 // startOpenVPNForGateway starts OpenVPN for a specific gateway with a specific tun interface.
-func (v *VPNManager) startOpenVPNForGateway(configPath, gatewayName, tunInterface string) (int, error) {
+// keyPassphrase, if set, decrypts the config's private key; OpenVPN reads it from a
+// temporary --askpass file that is removed once OpenVPN has started.
+func (v *VPNManager) startOpenVPNForGateway(configPath, gatewayName, tunInterface, keyPassphrase string) (int, error) {
 	openvpnPath, err := exec.LookPath(v.config.OpenVPNBinary)
 	if err != nil {
 		return 0, fmt.Errorf("OpenVPN not found. Please install OpenVPN and ensure it's in your PATH")
@@ -635,7 +592,18 @@ func (v *VPNManager) startOpenVPNForGateway(configPath, gatewayName, tunInterfac
 		"--writepid", pidPath,
 		"--log", logPath,
 		"--dev", tunInterface,
-		"--verb", "1",
+		"--verb", "3", // Logs the PUSH_REPLY that 'gatekey verify' checks against
+	}
+
+	if keyPassphrase != "" {
+		askpassPath := v.config.GatewayAskpassPath(gatewayName)
+		if err := os.WriteFile(askpassPath, []byte(keyPassphrase+"\n"), 0600); err != nil {
+			return 0, fmt.Errorf("failed to write key passphrase: %w", err)
+		}
+		// The key is loaded before OpenVPN daemonizes and kept across reconnects
+		// by persist-key, so the file isn't needed after start
+		defer os.Remove(askpassPath)
+		args = append(args, "--askpass", askpassPath)
 	}
 
 	needsSudo := os.Geteuid() != 0
@@ -791,6 +759,11 @@ func (v *VPNManager) showSingleConnectionStatus(conn *ConnectionState) {
 		fmt.Printf("Interface:    %s\n", conn.TunInterface)
 		fmt.Printf("PID:          %d\n", conn.PID)
 		logPath := v.config.GatewayLogPath(conn.Gateway)
+		if data, err := os.ReadFile(logPath); err == nil {
+			if reason := authFailureReason(string(data)); reason != "" {
+				fmt.Printf("Reason:       %s\n", reason)
+			}
+		}
 		fmt.Printf("\nCheck logs: sudo cat %s | tail -20\n", logPath)
 		return
 	}
@@ -839,6 +812,25 @@ func (v *VPNManager) updateStateFromLogForGateway(conn *ConnectionState) {
 	}
 }
 
+// authFailureReason returns the reason the gateway gave for the most recent
+// authentication failure in an OpenVPN log, or "" if it gave none. Gateways on
+// OpenVPN 2.6+ send it as AUTH_FAILED,<reason>.
+func authFailureReason(logContent string) string {
+	lines := strings.Split(logContent, "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		idx := strings.Index(lines[i], "AUTH_FAILED")
+		if idx < 0 {
+			continue
+		}
+		rest := lines[i][idx+len("AUTH_FAILED"):]
+		if !strings.HasPrefix(rest, ",") {
+			return ""
+		}
+		return strings.TrimSpace(rest[1:])
+	}
+	return ""
+}
+
 // checkTunnelStatusForGateway checks tunnel status for a specific gateway.
 func (v *VPNManager) checkTunnelStatusForGateway(gatewayName string) string {
 	logPath := v.config.GatewayLogPath(gatewayName)
@@ -970,18 +962,43 @@ func netmaskToCIDR(netmask string) string {
 	return fmt.Sprintf("%d", bits)
 }
 
-// ListGateways lists available gateways.
-func (v *VPNManager) ListGateways(ctx context.Context) error {
-	authHeader, err := v.auth.GetAuthHeader()
+// ListGateways lists available gateways. With jsonOutput the list is written as
+// stable machine-readable JSON for scripts.
+func (v *VPNManager) ListGateways(ctx context.Context, jsonOutput bool) error {
+	api, err := v.apiClient()
 	if err != nil {
 		return fmt.Errorf("authentication required: %w\nRun 'gatekey login' to authenticate", err)
 	}
 
-	gateways, err := v.fetchGateways(ctx, authHeader)
+	gateways, err := v.fetchGateways(ctx, api)
 	if err != nil {
 		return fmt.Errorf("failed to fetch gateways: %w", err)
 	}
 
+	if jsonOutput {
+		multiState := v.loadMultiState()
+		entries := make([]GatewayListEntry, 0, len(gateways))
+		for _, gw := range gateways {
+			conn, exists := multiState.Connections[gw.Name]
+			entries = append(entries, GatewayListEntry{
+				ID:            gw.ID,
+				Name:          gw.Name,
+				Hostname:      gw.Hostname,
+				PublicIP:      gw.PublicIP,
+				VPNPort:       gw.VPNPort,
+				VPNProtocol:   gw.VPNProtocol,
+				Status:        gw.Status,
+				LastHeartbeat: gw.LastHeartbeat,
+				Connected:     exists && conn.Connected && v.isProcessRunning(conn.PID),
+				TunnelMode:    gw.TunnelMode,
+				TunnelChoice:  gw.AllowTunnelChoice,
+			})
+		}
+		return json.NewEncoder(os.Stdout).Encode(map[string]interface{}{
+			"gateways": entries,
+		})
+	}
+
 	if len(gateways) == 0 {
 		fmt.Println("No gateways available.")
 		return nil
@@ -1003,6 +1020,13 @@ func (v *VPNManager) ListGateways(ctx context.Context) error {
 		}
 		fmt.Printf("  Hostname:    %s\n", gw.Hostname)
 		fmt.Printf("  Status:      %s\n", gw.Status)
+		if gw.TunnelMode != "" {
+			if gw.AllowTunnelChoice {
+				fmt.Printf("  Tunnel:      %s (--tunnel full|split)\n", gw.TunnelMode)
+			} else {
+				fmt.Printf("  Tunnel:      %s\n", gw.TunnelMode)
+			}
+		}
 		fmt.Println()
 	}
 
@@ -1010,130 +1034,9 @@ func (v *VPNManager) ListGateways(ctx context.Context) error {
 }
 
 // fetchGateways retrieves the list of available gateways from the server.
-func (v *VPNManager) fetchGateways(ctx context.Context, authHeader string) ([]Gateway, error) {
-	gatewaysURL, err := url.Parse(v.config.ServerURL)
-	if err != nil {
-		return nil, fmt.Errorf("invalid server URL: %w", err)
-	}
-	gatewaysURL.Path = "/api/v1/gateways"
-
-	client := &http.Client{Timeout: 30 * time.Second}
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, gatewaysURL.String(), nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
-	req.Header.Set("Authorization", authHeader)
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("request failed: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode == http.StatusUnauthorized {
-		return nil, fmt.Errorf("authentication expired. Run 'gatekey login' to re-authenticate")
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("server returned %d: %s", resp.StatusCode, string(body))
-	}
-
-	var response struct {
-		Gateways []Gateway `json:"gateways"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
-	}
-
-	return response.Gateways, nil
-}
-
-// downloadConfig downloads the VPN configuration for a gateway.
-func (v *VPNManager) downloadConfig(ctx context.Context, authHeader, gatewayID string) (string, error) {
-	configURL, err := url.Parse(v.config.ServerURL)
-	if err != nil {
-		return "", fmt.Errorf("invalid server URL: %w", err)
-	}
-	configURL.Path = "/api/v1/configs/generate"
-
-	client := &http.Client{Timeout: 60 * time.Second}
-
-	// Step 1: Generate config and get metadata
-	body := fmt.Sprintf(`{"gateway_id":"%s"}`, gatewayID)
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, configURL.String(), strings.NewReader(body))
-	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
-	}
-	req.Header.Set("Authorization", authHeader)
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("request failed: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode == http.StatusUnauthorized {
-		return "", fmt.Errorf("authentication expired. Run 'gatekey login' to re-authenticate")
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("server returned %d: %s", resp.StatusCode, string(body))
-	}
-
-	// Parse JSON response to get download URL
-	var configResp struct {
-		ID          string `json:"id"`
-		DownloadURL string `json:"downloadUrl"`
-		FileName    string `json:"fileName"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&configResp); err != nil {
-		return "", fmt.Errorf("failed to parse config response: %w", err)
-	}
-
-	// Step 2: Download the actual config file
-	downloadURL, err := url.Parse(v.config.ServerURL)
-	if err != nil {
-		return "", fmt.Errorf("invalid server URL: %w", err)
-	}
-	downloadURL.Path = configResp.DownloadURL
-
-	downloadReq, err := http.NewRequestWithContext(ctx, http.MethodGet, downloadURL.String(), nil)
-	if err != nil {
-		return "", fmt.Errorf("failed to create download request: %w", err)
-	}
-	downloadReq.Header.Set("Authorization", authHeader)
-
-	downloadResp, err := client.Do(downloadReq)
-	if err != nil {
-		return "", fmt.Errorf("download request failed: %w", err)
-	}
-	defer downloadResp.Body.Close()
-
-	if downloadResp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(downloadResp.Body)
-		return "", fmt.Errorf("download failed with %d: %s", downloadResp.StatusCode, string(body))
-	}
-
-	// Read config content
-	configData, err := io.ReadAll(downloadResp.Body)
-	if err != nil {
-		return "", fmt.Errorf("failed to read config: %w", err)
-	}
-
-	// Save to file
-	configPath := v.config.CurrentConfigPath()
-	if err := os.MkdirAll(filepath.Dir(configPath), 0700); err != nil {
-		return "", fmt.Errorf("failed to create config directory: %w", err)
-	}
-
-	if err := os.WriteFile(configPath, configData, 0600); err != nil {
-		return "", fmt.Errorf("failed to write config: %w", err)
-	}
-
-	return configPath, nil
+func (v *VPNManager) fetchGateways(ctx context.Context, api *apiclient.Client) ([]Gateway, error) {
+	gateways, err := api.ListGateways(ctx)
+	return gateways, loginExpired(err)
 }
 
 // startOpenVPN starts the OpenVPN process with the given configuration.
@@ -1368,44 +1271,42 @@ func (v *VPNManager) updateStateFromLog(state *ConnectionState) {
 	}
 }
 
-// promptGatewaySelection prompts the user to select a gateway.
-func (v *VPNManager) promptGatewaySelection(gateways []Gateway) error {
-	fmt.Println("Multiple gateways available. Please specify one:")
-	fmt.Println()
-	for i, gw := range gateways {
-		fmt.Printf("  %d. %s", i+1, gw.Name)
-		if gw.Location != "" {
-			fmt.Printf(" (%s)", gw.Location)
-		}
-		fmt.Println()
-	}
-	fmt.Println()
-	fmt.Println("Run: gatekey connect <gateway-name>")
-	return nil
-}
-
 // MeshHub represents a mesh VPN hub from the server.
-type MeshHub struct {
-	ID             string `json:"id"`
-	Name           string `json:"name"`
-	Description    string `json:"description,omitempty"`
-	PublicEndpoint string `json:"public_endpoint"`
-	Status         string `json:"status"`
-	SpokeCount     int    `json:"spoke_count"`
-}
+type MeshHub = apiclient.MeshHub
 
-// ListMeshHubs lists available mesh hubs.
-func (v *VPNManager) ListMeshHubs(ctx context.Context) error {
-	authHeader, err := v.auth.GetAuthHeader()
+// ListMeshHubs lists available mesh hubs. With jsonOutput the list is written as
+// stable machine-readable JSON for scripts.
+func (v *VPNManager) ListMeshHubs(ctx context.Context, jsonOutput bool) error {
+	api, err := v.apiClient()
 	if err != nil {
 		return fmt.Errorf("authentication required: %w\nRun 'gatekey login' to authenticate", err)
 	}
 
-	hubs, err := v.fetchMeshHubs(ctx, authHeader)
+	hubs, err := v.fetchMeshHubs(ctx, api)
 	if err != nil {
 		return fmt.Errorf("failed to fetch mesh hubs: %w", err)
 	}
 
+	if jsonOutput {
+		multiState := v.loadMultiState()
+		entries := make([]MeshHubListEntry, 0, len(hubs))
+		for _, hub := range hubs {
+			conn, exists := multiState.Connections["mesh:"+hub.Name]
+			entries = append(entries, MeshHubListEntry{
+				ID:             hub.ID,
+				Name:           hub.Name,
+				Description:    hub.Description,
+				PublicEndpoint: hub.PublicEndpoint,
+				Status:         hub.Status,
+				SpokeCount:     hub.SpokeCount,
+				Connected:      exists && conn.Connected && v.isProcessRunning(conn.PID),
+			})
+		}
+		return json.NewEncoder(os.Stdout).Encode(map[string]interface{}{
+			"hubs": entries,
+		})
+	}
+
 	if len(hubs) == 0 {
 		fmt.Println("No mesh hubs available.")
 		return nil
@@ -1432,43 +1333,9 @@ func (v *VPNManager) ListMeshHubs(ctx context.Context) error {
 }
 
 // fetchMeshHubs retrieves the list of available mesh hubs from the server.
-func (v *VPNManager) fetchMeshHubs(ctx context.Context, authHeader string) ([]MeshHub, error) {
-	hubsURL, err := url.Parse(v.config.ServerURL)
-	if err != nil {
-		return nil, fmt.Errorf("invalid server URL: %w", err)
-	}
-	hubsURL.Path = "/api/v1/mesh/hubs"
-
-	client := &http.Client{Timeout: 30 * time.Second}
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, hubsURL.String(), nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
-	req.Header.Set("Authorization", authHeader)
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("request failed: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode == http.StatusUnauthorized {
-		return nil, fmt.Errorf("authentication expired. Run 'gatekey login' to re-authenticate")
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("server returned %d: %s", resp.StatusCode, string(body))
-	}
-
-	var response struct {
-		Hubs []MeshHub `json:"hubs"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
-	}
-
-	return response.Hubs, nil
+func (v *VPNManager) fetchMeshHubs(ctx context.Context, api *apiclient.Client) ([]MeshHub, error) {
+	hubs, err := api.ListMeshHubs(ctx)
+	return hubs, loginExpired(err)
 }
 
 // ConnectMesh connects to a mesh VPN hub.
@@ -1492,13 +1359,13 @@ func (v *VPNManager) ConnectMesh(ctx context.Context, hubName string) error {
 	v.cleanupStaleConnections(multiState)
 
 	// Ensure we're logged in
-	authHeader, err := v.auth.GetAuthHeader()
+	api, err := v.apiClient()
 	if err != nil {
 		return fmt.Errorf("authentication required: %w\nRun 'gatekey login' to authenticate", err)
 	}
 
 	// Get available mesh hubs
-	hubs, err := v.fetchMeshHubs(ctx, authHeader)
+	hubs, err := v.fetchMeshHubs(ctx, api)
 	if err != nil {
 		return fmt.Errorf("failed to fetch mesh hubs: %w", err)
 	}
@@ -1508,23 +1375,9 @@ func (v *VPNManager) ConnectMesh(ctx context.Context, hubName string) error {
 	}
 
 	// Select hub
-	var selectedHub *MeshHub
-	if hubName == "" {
-		if len(hubs) == 1 {
-			selectedHub = &hubs[0]
-		} else {
-			return v.promptMeshHubSelection(hubs)
-		}
-	} else {
-		for i := range hubs {
-			if strings.EqualFold(hubs[i].Name, hubName) || hubs[i].ID == hubName {
-				selectedHub = &hubs[i]
-				break
-			}
-		}
-		if selectedHub == nil {
-			return fmt.Errorf("mesh hub '%s' not found", hubName)
-		}
+	selectedHub, err := selectMeshHub(hubs, hubName)
+	if err != nil {
+		return err
 	}
 
 	// Update meshKey with actual hub name
@@ -1549,13 +1402,13 @@ func (v *VPNManager) ConnectMesh(ctx context.Context, hubName string) error {
 	tunInterface := fmt.Sprintf("tun%d", tunNum)
 
 	// Download mesh VPN configuration
-	configPath, err := v.downloadMeshConfig(ctx, authHeader, selectedHub.ID, selectedHub.Name)
+	configPath, err := v.downloadMeshConfig(ctx, api, selectedHub.ID, selectedHub.Name)
 	if err != nil {
 		return fmt.Errorf("failed to download mesh VPN configuration: %w", err)
 	}
 
 	// Start OpenVPN with specific tun interface
-	pid, err := v.startOpenVPNForGateway(configPath, meshKey, tunInterface)
+	pid, err := v.startOpenVPNForGateway(configPath, meshKey, tunInterface, "")
 	if err != nil {
 		return fmt.Errorf("failed to start OpenVPN: %w", err)
 	}
@@ -1585,38 +1438,13 @@ func (v *VPNManager) ConnectMesh(ctx context.Context, hubName string) error {
 }
 
 // downloadMeshConfig downloads the mesh VPN config for a hub.
-func (v *VPNManager) downloadMeshConfig(ctx context.Context, authHeader, hubID, hubName string) (string, error) {
+func (v *VPNManager) downloadMeshConfig(ctx context.Context, api *apiclient.Client, hubID, hubName string) (string, error) {
 	configPath := v.config.GatewayConfigPath("mesh-" + hubName)
-	client := &http.Client{Timeout: 60 * time.Second}
-
-	// Generate mesh config
-	reqURL := fmt.Sprintf("%s/api/v1/mesh/generate-config", v.config.ServerURL)
-	reqBody := fmt.Sprintf(`{"hubid": "%s"}`, hubID)
+	api.SetTimeout(60 * time.Second)
 
-	req, err := http.NewRequestWithContext(ctx, "POST", reqURL, strings.NewReader(reqBody))
+	config, err := api.GenerateMeshConfig(ctx, hubID)
 	if err != nil {
-		return "", err
-	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", authHeader)
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("server returned %d: %s", resp.StatusCode, string(body))
-	}
-
-	var configResp struct {
-		HubName string `json:"hubname"`
-		Config  string `json:"config"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&configResp); err != nil {
-		return "", fmt.Errorf("failed to decode response: %w", err)
+		return "", loginExpired(err)
 	}
 
 	// Write config to file
@@ -1624,25 +1452,19 @@ func (v *VPNManager) downloadMeshConfig(ctx context.Context, authHeader, hubID,
 		return "", fmt.Errorf("failed to create config directory: %w", err)
 	}
 
-	if err := os.WriteFile(configPath, []byte(configResp.Config), 0600); err != nil {
+	if err := os.WriteFile(configPath, []byte(config.Config), 0600); err != nil {
 		return "", fmt.Errorf("failed to write config: %w", err)
 	}
 
 	return configPath, nil
 }
 
-// promptMeshHubSelection prompts the user to select a mesh hub.
-func (v *VPNManager) promptMeshHubSelection(hubs []MeshHub) error {
-	fmt.Println("Multiple mesh hubs available. Please specify one:")
-	fmt.Println()
-	for i, hub := range hubs {
-		fmt.Printf("  %d. %s", i+1, hub.Name)
-		if hub.Description != "" {
-			fmt.Printf(" - %s", hub.Description)
-		}
-		fmt.Println()
+// labelConfigRequest labels a config generation request with this device's
+// hostname and OS, and purpose if given.
+func labelConfigRequest(req *apiclient.GenerateConfigRequest, purpose string) {
+	req.DeviceOS = runtime.GOOS
+	if hostname, err := os.Hostname(); err == nil {
+		req.DeviceName = hostname
 	}
-	fmt.Println()
-	fmt.Println("Run: gatekey mesh connect <hub-name>")
-	return nil
+	req.Purpose = purpose
 }
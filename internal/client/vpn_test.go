@@ -0,0 +1,62 @@
+package client
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/gatekey-project/gatekey/internal/apiclient"
+)
+
+func TestAuthFailureReason(t *testing.T) {
+	tests := []struct {
+		log  string
+		want string
+	}{
+		{"Initialization Sequence Completed\n", ""},
+		{"AUTH: Received control message: AUTH_FAILED\n", ""},
+		{
+			"AUTH: Received control message: AUTH_FAILED,old reason\n" +
+				"AUTH: Received control message: AUTH_FAILED,this config has expired [config_expired]\n" +
+				"SIGTERM received\n",
+			"this config has expired [config_expired]",
+		},
+	}
+	for _, tt := range tests {
+		if got := authFailureReason(tt.log); got != tt.want {
+			t.Errorf("authFailureReason(%q) = %q, want %q", tt.log, got, tt.want)
+		}
+	}
+}
+
+func TestLabelConfigRequest(t *testing.T) {
+	req := &apiclient.GenerateConfigRequest{GatewayID: "gw"}
+	labelConfigRequest(req, "on-call")
+	if req.DeviceOS != runtime.GOOS {
+		t.Errorf("DeviceOS = %q, want %q", req.DeviceOS, runtime.GOOS)
+	}
+	if req.Purpose != "on-call" {
+		t.Errorf("Purpose = %q, want on-call", req.Purpose)
+	}
+}
+
+func TestFormatConnectSummary(t *testing.T) {
+	tests := []struct {
+		summary apiclient.ConnectSummary
+		want    string
+	}{
+		{
+			apiclient.ConnectSummary{GatewayName: "prod-gw", VPNIP: "10.8.0.6", TunnelMode: "split",
+				Reachable: []string{"10.1.0.0/16", "db.internal"}, DNSServers: []string{"10.1.0.2"}, Message: "Welcome to prod."},
+			"Connected to prod-gw as 10.8.0.6 (split tunnel). You can reach: 10.1.0.0/16, db.internal. DNS: 10.1.0.2.\nWelcome to prod.",
+		},
+		{
+			apiclient.ConnectSummary{GatewayName: "prod-gw", TunnelMode: "full"},
+			"Connected to prod-gw (full tunnel). You can't reach any networks yet; ask your administrator for access rules.",
+		},
+	}
+	for _, tt := range tests {
+		if got := formatConnectSummary(&tt.summary); got != tt.want {
+			t.Errorf("formatConnectSummary() = %q, want %q", got, tt.want)
+		}
+	}
+}
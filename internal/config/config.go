@@ -3,24 +3,40 @@ package config
 
 import (
 	"fmt"
+	"net"
+	"net/url"
 	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/spf13/viper"
+
+	"github.com/gatekey-project/gatekey/internal/secrets"
 )
 
 // Config holds all configuration for the GateKey server.
 type Config struct {
-	Server   ServerConfig   `mapstructure:"server"`
-	Database DatabaseConfig `mapstructure:"database"`
-	PKI      PKIConfig      `mapstructure:"pki"`
-	Auth     AuthConfig     `mapstructure:"auth"`
-	Gateway  GatewayConfig  `mapstructure:"gateway"`
-	Policy   PolicyConfig   `mapstructure:"policy"`
-	Logging  LoggingConfig  `mapstructure:"logging"`
-	Metrics  MetricsConfig  `mapstructure:"metrics"`
-	Audit    AuditConfig    `mapstructure:"audit"`
+	Server        ServerConfig        `mapstructure:"server"`
+	Database      DatabaseConfig      `mapstructure:"database"`
+	PKI           PKIConfig           `mapstructure:"pki"`
+	Auth          AuthConfig          `mapstructure:"auth"`
+	Gateway       GatewayConfig       `mapstructure:"gateway"`
+	Policy        PolicyConfig        `mapstructure:"policy"`
+	Logging       LoggingConfig       `mapstructure:"logging"`
+	Metrics       MetricsConfig       `mapstructure:"metrics"`
+	Audit         AuditConfig         `mapstructure:"audit"`
+	GeoIP         GeoIPConfig         `mapstructure:"geoip"`
+	SMTP          SMTPConfig          `mapstructure:"smtp"`
+	Tenancy       TenancyConfig       `mapstructure:"tenancy"`
+	Notifications NotificationsConfig `mapstructure:"notifications"`
+
+	// Files are the config files read, in the order they were applied, and
+	// EnvOverrides the GATEX_ environment variables that overrode them.
+	Files        []string `mapstructure:"-"`
+	EnvOverrides []string `mapstructure:"-"`
 }
 
 // ServerConfig holds HTTP server configuration.
@@ -32,6 +48,12 @@ type ServerConfig struct {
 	TLSKey         string   `mapstructure:"tls_key"`
 	TrustedProxies []string `mapstructure:"trusted_proxies"`
 	CORSOrigins    []string `mapstructure:"cors_origins"`
+	// BaseURL is the external URL clients reach the server on, e.g.
+	// https://vpn.example.com. Links, install scripts and callback URLs are built
+	// from it; when empty they are derived from each request.
+	BaseURL string `mapstructure:"base_url"`
+	// MaxRequestBody caps the size of API request bodies in bytes
+	MaxRequestBody int64 `mapstructure:"max_request_body"`
 }
 
 // DatabaseConfig holds database connection configuration.
@@ -40,6 +62,25 @@ type DatabaseConfig struct {
 	MaxOpenConns    int           `mapstructure:"max_open_conns"`
 	MaxIdleConns    int           `mapstructure:"max_idle_conns"`
 	ConnMaxLifetime time.Duration `mapstructure:"conn_max_lifetime"`
+	// Encryption encrypts secret columns, such as private keys and provider
+	// client secrets, at rest
+	Encryption EncryptionConfig `mapstructure:"encryption"`
+}
+
+// EncryptionConfig holds the keys that encrypt secret columns. Values are sealed
+// with the key named by KeyID; the other keys only decrypt values sealed before a
+// rotation. With no keys configured, secrets are stored as plaintext.
+type EncryptionConfig struct {
+	KeyID string            `mapstructure:"key_id"`
+	Keys  map[string]string `mapstructure:"keys"` // Base64-encoded 32-byte keys by ID
+}
+
+// Keyring builds the keyring for the configured keys, or nil if none are configured.
+func (e EncryptionConfig) Keyring() (*secrets.Keyring, error) {
+	if len(e.Keys) == 0 {
+		return nil, nil
+	}
+	return secrets.NewKeyring(e.Keys, e.KeyID)
 }
 
 // PKIConfig holds PKI/CA configuration.
@@ -54,9 +95,30 @@ type PKIConfig struct {
 
 // AuthConfig holds authentication configuration.
 type AuthConfig struct {
-	Session SessionConfig `mapstructure:"session"`
-	OIDC    OIDCConfig    `mapstructure:"oidc"`
-	SAML    SAMLConfig    `mapstructure:"saml"`
+	Session   SessionConfig   `mapstructure:"session"`
+	OIDC      OIDCConfig      `mapstructure:"oidc"`
+	SAML      SAMLConfig      `mapstructure:"saml"`
+	MagicLink MagicLinkConfig `mapstructure:"magic_link"`
+	// PostLoginRedirect is where browsers land after a web login; a path on this server
+	PostLoginRedirect string `mapstructure:"post_login_redirect"`
+	// CLICallbackHosts are hosts besides loopback the CLI login may redirect to over https
+	CLICallbackHosts []string `mapstructure:"cli_callback_hosts"`
+	// EmptyGroups is what an SSO login that returns no groups does to a user who
+	// had some: "retain" keeps their previous groups, "apply" clears them
+	EmptyGroups string `mapstructure:"empty_groups"`
+	// BreakGlassUsers are local users who may still log in when local auth is
+	// disabled, for recovering from an SSO outage
+	BreakGlassUsers []string `mapstructure:"break_glass_users"`
+	// NewSignInAlerts emails users when they log in from a device or location
+	// they haven't used before
+	NewSignInAlerts bool `mapstructure:"new_sign_in_alerts"`
+}
+
+// MagicLinkConfig holds passwordless email login configuration for local users.
+type MagicLinkConfig struct {
+	Enabled bool          `mapstructure:"enabled"`
+	TTL     time.Duration `mapstructure:"ttl"`    // How long an emailed link stays valid
+	Resend  time.Duration `mapstructure:"resend"` // Minimum time between links for the same user
 }
 
 // SessionConfig holds session management configuration.
@@ -84,6 +146,12 @@ type OIDCProvider struct {
 	RedirectURL  string            `mapstructure:"redirect_url"`
 	Scopes       []string          `mapstructure:"scopes"`
 	Claims       map[string]string `mapstructure:"claims"`
+	// AdditionalAudiences are other client IDs whose ID tokens are accepted, such
+	// as a mobile app sharing the IdP. The code exchange always uses ClientID.
+	AdditionalAudiences []string `mapstructure:"additional_audiences"`
+	// CNSource is where users' VPN certificate common name comes from: email
+	// (default), subject, or claim:<name>.
+	CNSource string `mapstructure:"cn_source"`
 }
 
 // SAMLConfig holds SAML provider configuration.
@@ -109,12 +177,22 @@ type GatewayConfig struct {
 	APIURL            string        `mapstructure:"api_url"`
 	Token             string        `mapstructure:"token"`
 	HeartbeatInterval time.Duration `mapstructure:"heartbeat_interval"`
+	// MinHeartbeatInterval is sent to gateways, hubs and spokes in heartbeat
+	// responses; agents configured to heartbeat more often slow down to it. 0 lets
+	// each agent use its own interval
+	MinHeartbeatInterval time.Duration `mapstructure:"min_heartbeat_interval"`
 }
 
 // PolicyConfig holds policy engine configuration.
 type PolicyConfig struct {
 	DefaultPolicy  string `mapstructure:"default_policy"`
 	EvaluationMode string `mapstructure:"evaluation_mode"`
+	// RequireApproval lists change categories that only take effect once a second
+	// admin approves them: access_rules and gateway_assignments
+	RequireApproval []string `mapstructure:"require_approval"`
+	// WildcardSingleLabel makes hostname_wildcard rules like *.example.com match
+	// a single label (a.example.com) instead of one or more (a.b.example.com)
+	WildcardSingleLabel bool `mapstructure:"wildcard_single_label"`
 }
 
 // LoggingConfig holds logging configuration.
@@ -137,20 +215,68 @@ type AuditConfig struct {
 	Destination string   `mapstructure:"destination"`
 	FilePath    string   `mapstructure:"file_path"`
 	Events      []string `mapstructure:"events"`
+	// AnchorInterval is how often the audit chain head is signed with the CA key; 0 disables
+	AnchorInterval time.Duration `mapstructure:"anchor_interval"`
 }
 
-// Load reads configuration from the specified file and environment variables.
-func Load(configPath string) (*Config, error) {
+// GeoIPConfig holds login geolocation configuration.
+type GeoIPConfig struct {
+	// Provider is auto, maxmind, ip-api, or none. auto uses the MaxMind database
+	// when database_path is set and falls back to ip-api.com otherwise.
+	Provider     string        `mapstructure:"provider"`
+	DatabasePath string        `mapstructure:"database_path"` // GeoLite2/GeoIP2 City or Country .mmdb file
+	CacheSize    int           `mapstructure:"cache_size"`
+	CacheTTL     time.Duration `mapstructure:"cache_ttl"`
+}
+
+// SMTPConfig holds the mail server used for login links and notifications.
+type SMTPConfig struct {
+	Host     string `mapstructure:"host"`
+	Port     int    `mapstructure:"port"`
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password"`
+	From     string `mapstructure:"from"`
+	TLS      string `mapstructure:"tls"` // starttls, tls, or none
+}
+
+// NotificationsConfig controls the queue that delivers email and other
+// notifications outside of request handlers.
+type NotificationsConfig struct {
+	Workers         int           `mapstructure:"workers"`          // Concurrent deliveries per server
+	MaxPending      int           `mapstructure:"max_pending"`      // Queue depth at which new notifications are dropped
+	MaxAttempts     int           `mapstructure:"max_attempts"`     // Attempts before a notification is given up on
+	DeliveryTimeout time.Duration `mapstructure:"delivery_timeout"` // Limit on one delivery attempt
+}
+
+// TenancyConfig controls multi-tenant scoping. When disabled, everything belongs
+// to the default tenant and behaves as a single organization.
+type TenancyConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+}
+
+// envRefPattern matches ${VAR} and ${VAR:-default} references in config values.
+var envRefPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(?::-([^}]*))?\}`)
+
+// Load reads configuration from the given paths and environment variables. Each
+// path is a YAML file or a directory whose .yaml and .yml files are read in name
+// order. Later files override earlier ones key by key, so a committed base config
+// can be followed by environment-specific and secrets overlays, and GATEX_
+// environment variables override every file. String values may reference
+// environment variables as ${VAR} or ${VAR:-default}.
+func Load(paths ...string) (*Config, error) {
 	v := viper.New()
 
 	// Set defaults
 	setDefaults(v)
 
-	// Read config file if specified
-	if configPath != "" {
-		v.SetConfigFile(configPath)
-		if err := v.ReadInConfig(); err != nil {
-			return nil, fmt.Errorf("failed to read config file: %w", err)
+	files, err := configFiles(paths)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		v.SetConfigFile(file)
+		if err := v.MergeInConfig(); err != nil {
+			return nil, fmt.Errorf("failed to read config file %s: %w", file, err)
 		}
 	}
 
@@ -159,19 +285,27 @@ func Load(configPath string) (*Config, error) {
 	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
 	v.AutomaticEnv()
 
-	// Expand environment variables in string values
+	var envOverrides []string
 	for _, key := range v.AllKeys() {
+		env := "GATEX_" + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+		if _, ok := os.LookupEnv(env); ok {
+			envOverrides = append(envOverrides, env)
+		}
+
+		// Expand environment variable references in string values
 		val := v.GetString(key)
-		if strings.HasPrefix(val, "${") && strings.HasSuffix(val, "}") {
-			envVar := strings.TrimSuffix(strings.TrimPrefix(val, "${"), "}")
-			v.Set(key, os.Getenv(envVar))
+		if strings.Contains(val, "${") {
+			v.Set(key, expandEnvRefs(val))
 		}
 	}
+	sort.Strings(envOverrides)
 
 	var cfg Config
 	if err := v.Unmarshal(&cfg); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
 	}
+	cfg.Files = files
+	cfg.EnvOverrides = envOverrides
 
 	if err := cfg.Validate(); err != nil {
 		return nil, fmt.Errorf("config validation failed: %w", err)
@@ -180,12 +314,63 @@ func Load(configPath string) (*Config, error) {
 	return &cfg, nil
 }
 
+// configFiles lists the files to read for paths, expanding directories to their
+// YAML files in name order. Empty paths are skipped.
+func configFiles(paths []string) ([]string, error) {
+	var files []string
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config file: %w", err)
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config directory: %w", err)
+		}
+		var dirFiles []string
+		for _, e := range entries {
+			ext := filepath.Ext(e.Name())
+			if e.IsDir() || strings.HasPrefix(e.Name(), ".") || (ext != ".yaml" && ext != ".yml") {
+				continue
+			}
+			dirFiles = append(dirFiles, filepath.Join(path, e.Name()))
+		}
+		if len(dirFiles) == 0 {
+			return nil, fmt.Errorf("config directory %s has no .yaml files", path)
+		}
+		files = append(files, dirFiles...) // ReadDir returns entries sorted by name
+	}
+	return files, nil
+}
+
+// expandEnvRefs replaces ${VAR} references in s with the variable's value, or
+// with the default in ${VAR:-default} when the variable is unset or empty.
+func expandEnvRefs(s string) string {
+	return envRefPattern.ReplaceAllStringFunc(s, func(ref string) string {
+		m := envRefPattern.FindStringSubmatch(ref)
+		if val := os.Getenv(m[1]); val != "" {
+			return val
+		}
+		return m[2]
+	})
+}
+
 // setDefaults sets default configuration values.
 func setDefaults(v *viper.Viper) {
 	// Server defaults
 	v.SetDefault("server.address", ":8080")
 	v.SetDefault("server.tls_address", ":8443")
 	v.SetDefault("server.tls_enabled", false)
+	v.SetDefault("server.base_url", "") // Registered so GATEX_SERVER_BASE_URL is read
+	v.SetDefault("server.max_request_body", 1<<20)
 
 	// Database defaults
 	v.SetDefault("database.max_open_conns", 25)
@@ -204,9 +389,15 @@ func setDefaults(v *viper.Viper) {
 	v.SetDefault("auth.session.secure", true)
 	v.SetDefault("auth.session.http_only", true)
 	v.SetDefault("auth.session.same_site", "lax")
+	v.SetDefault("auth.post_login_redirect", "/")
+	v.SetDefault("auth.empty_groups", "retain")
+	v.SetDefault("auth.magic_link.enabled", false)
+	v.SetDefault("auth.magic_link.ttl", "15m")
+	v.SetDefault("auth.magic_link.resend", "1m")
 
 	// Gateway defaults
 	v.SetDefault("gateway.heartbeat_interval", "30s")
+	v.SetDefault("gateway.min_heartbeat_interval", "0s")
 
 	// Policy defaults
 	v.SetDefault("policy.default_policy", "deny-all")
@@ -225,6 +416,25 @@ func setDefaults(v *viper.Viper) {
 	// Audit defaults
 	v.SetDefault("audit.enabled", true)
 	v.SetDefault("audit.destination", "database")
+	v.SetDefault("audit.anchor_interval", "1h")
+
+	// GeoIP defaults
+	v.SetDefault("geoip.provider", "auto")
+	v.SetDefault("geoip.cache_size", 10000)
+	v.SetDefault("geoip.cache_ttl", "24h")
+
+	// SMTP defaults
+	v.SetDefault("smtp.port", 587)
+	v.SetDefault("smtp.tls", "starttls")
+
+	// Notification queue defaults
+	v.SetDefault("notifications.workers", 4)
+	v.SetDefault("notifications.max_pending", 10000)
+	v.SetDefault("notifications.max_attempts", 8)
+	v.SetDefault("notifications.delivery_timeout", "30s")
+
+	// Tenancy defaults
+	v.SetDefault("tenancy.enabled", false)
 }
 
 // Validate checks the configuration for errors.
@@ -232,6 +442,25 @@ func (c *Config) Validate() error {
 	if c.Database.URL == "" {
 		return fmt.Errorf("database.url is required")
 	}
+	if _, err := c.Database.Encryption.Keyring(); err != nil {
+		return fmt.Errorf("invalid database.encryption: %w", err)
+	}
+
+	if c.Server.BaseURL != "" {
+		baseURL, err := normalizeBaseURL(c.Server.BaseURL)
+		if err != nil {
+			return fmt.Errorf("invalid server.base_url: %w", err)
+		}
+		c.Server.BaseURL = baseURL
+	}
+	for _, proxy := range c.Server.TrustedProxies {
+		if _, _, err := net.ParseCIDR(proxy); err != nil && net.ParseIP(proxy) == nil {
+			return fmt.Errorf("invalid server.trusted_proxies entry: %q (must be an IP address or CIDR)", proxy)
+		}
+	}
+	if c.Server.MaxRequestBody <= 0 {
+		return fmt.Errorf("server.max_request_body must be positive")
+	}
 
 	if c.Auth.OIDC.Enabled && len(c.Auth.OIDC.Providers) == 0 {
 		return fmt.Errorf("at least one OIDC provider must be configured when OIDC is enabled")
@@ -241,6 +470,48 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("at least one SAML provider must be configured when SAML is enabled")
 	}
 
+	if p := c.Auth.PostLoginRedirect; p != "" && (!strings.HasPrefix(p, "/") || strings.HasPrefix(p, "//") || strings.Contains(p, "\\")) {
+		return fmt.Errorf("invalid auth.post_login_redirect: %s (must be a path on this server, such as /dashboard)", p)
+	}
+	for _, host := range c.Auth.CLICallbackHosts {
+		if host == "" || strings.ContainsAny(host, "/:@ ") {
+			return fmt.Errorf("invalid auth.cli_callback_hosts entry: %q (must be a hostname)", host)
+		}
+	}
+
+	switch c.Auth.EmptyGroups {
+	case "", "retain", "apply":
+	default:
+		return fmt.Errorf("invalid auth.empty_groups: %s (must be retain or apply)", c.Auth.EmptyGroups)
+	}
+
+	if c.Auth.MagicLink.Enabled && (c.SMTP.Host == "" || c.SMTP.From == "") {
+		return fmt.Errorf("smtp.host and smtp.from are required when magic link login is enabled")
+	}
+	if c.Auth.NewSignInAlerts && (c.SMTP.Host == "" || c.SMTP.From == "") {
+		return fmt.Errorf("smtp.host and smtp.from are required when new sign-in alerts are enabled")
+	}
+	// Emailed links carry single-use tokens, so they're only built from the
+	// configured base URL: one taken from a request's Host header would let
+	// whoever sent the request choose where the token goes
+	if c.Auth.MagicLink.Enabled && c.Server.BaseURL == "" {
+		return fmt.Errorf("server.base_url is required when magic link login is enabled")
+	}
+	if c.Auth.NewSignInAlerts && c.Server.BaseURL == "" {
+		return fmt.Errorf("server.base_url is required when new sign-in alerts are enabled")
+	}
+	switch c.SMTP.TLS {
+	case "", "starttls", "tls", "none":
+	default:
+		return fmt.Errorf("invalid smtp.tls: %s (must be starttls, tls, or none)", c.SMTP.TLS)
+	}
+
+	for _, category := range c.Policy.RequireApproval {
+		if category != "access_rules" && category != "gateway_assignments" {
+			return fmt.Errorf("invalid policy.require_approval category: %s (must be access_rules or gateway_assignments)", category)
+		}
+	}
+
 	validKeyAlgorithms := map[string]bool{
 		"rsa2048":  true,
 		"rsa4096":  true,
@@ -253,3 +524,16 @@ func (c *Config) Validate() error {
 
 	return nil
 }
+
+// normalizeBaseURL checks that a base URL is an absolute http(s) URL with no path,
+// query or credentials, and returns it without a trailing slash.
+func normalizeBaseURL(raw string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("%q must be an absolute http(s) URL, such as https://vpn.example.com", raw)
+	}
+	if u.User != nil || u.RawQuery != "" || u.Fragment != "" || strings.Trim(u.Path, "/") != "" {
+		return "", fmt.Errorf("%q must be a scheme and host only, without a path, query or credentials", raw)
+	}
+	return u.Scheme + "://" + u.Host, nil
+}
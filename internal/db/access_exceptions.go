@@ -0,0 +1,274 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"strings"
+	"time"
+)
+
+var (
+	ErrAccessExceptionNotFound = errors.New("access exception not found")
+	ErrAccessExceptionExists   = errors.New("the user already has this exception")
+)
+
+// AccessException takes away access a user would otherwise have, directly or
+// through a group. It names either an access rule or a destination; a
+// destination excludes every rule whose destination falls within it: IPs and
+// CIDRs inside a CIDR, and hostnames and wildcards under a wildcard.
+type AccessException struct {
+	ID              string
+	UserID          string
+	RuleID          *string // Set for a rule exception
+	RuleName        string
+	DestinationType AccessRuleType // Set for a destination exception
+	Destination     string
+	Reason          string
+	CreatedBy       string
+	CreatedAt       time.Time
+}
+
+// userExceptionSQL is a condition that holds when one of the exceptions of the
+// user whose ID is in the given placeholder excludes the access rule ar.
+func userExceptionSQL(param string) string {
+	return `EXISTS (
+			SELECT 1 FROM user_access_exceptions uae
+			WHERE uae.user_id::text = ` + param + `::text AND (
+				uae.access_rule_id = ar.id
+				OR CASE
+					WHEN uae.destination_type IN ('ip', 'cidr') AND ar.rule_type IN ('ip', 'cidr')
+						THEN ar.value::inet <<= uae.destination::inet
+					WHEN uae.destination_type = 'hostname' AND ar.rule_type = 'hostname'
+						THEN lower(ar.value) = lower(uae.destination)
+					WHEN uae.destination_type = 'hostname_wildcard' AND ar.rule_type IN ('hostname', 'hostname_wildcard')
+						THEN right(lower(ar.value), length(uae.destination) - 1) = lower(substr(uae.destination, 2))
+					ELSE false
+				END
+			))`
+}
+
+// exceptDestinations applies a user's destination exceptions to their rules.
+// userExceptionSQL drops the rules that lie within an exception; a rule that
+// contains an exception instead gets it in Except, so it's taken out of the
+// rule wherever the rule is enforced.
+func (d *DB) exceptDestinations(ctx context.Context, userID string, rules []*AccessRule) error {
+	if len(rules) == 0 {
+		return nil
+	}
+	rows, err := d.Pool.Query(ctx, `
+		SELECT destination_type, destination FROM user_access_exceptions
+		WHERE user_id::text = $1 AND access_rule_id IS NULL
+		ORDER BY created_at
+	`, userID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var exceptions []*AccessException
+	for rows.Next() {
+		var e AccessException
+		var destinationType string
+		if err := rows.Scan(&destinationType, &e.Destination); err != nil {
+			return err
+		}
+		e.DestinationType = AccessRuleType(destinationType)
+		exceptions = append(exceptions, &e)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	applyDestinationExceptions(rules, exceptions)
+	return nil
+}
+
+// applyDestinationExceptions sets each rule's Except to the destination
+// exceptions lying strictly within it.
+func applyDestinationExceptions(rules []*AccessRule, exceptions []*AccessException) {
+	for _, rule := range rules {
+		rule.Except = nil
+		for _, e := range exceptions {
+			if e.RuleID == nil && containsDestination(rule, e.DestinationType, e.Destination) {
+				rule.Except = append(rule.Except, e.Destination)
+			}
+		}
+	}
+}
+
+// containsDestination reports whether a destination lies within a rule without
+// being all of it: an IP or CIDR inside a wider CIDR, or a hostname or narrower
+// wildcard under a wildcard. Hostnames and addresses are never compared.
+func containsDestination(rule *AccessRule, destinationType AccessRuleType, destination string) bool {
+	switch {
+	case rule.RuleType == AccessRuleTypeCIDR && (destinationType == AccessRuleTypeIP || destinationType == AccessRuleTypeCIDR):
+		outer, ok := parseDestinationPrefix(rule.RuleType, rule.Value)
+		inner, innerOK := parseDestinationPrefix(destinationType, destination)
+		return ok && innerOK && outer.Addr().BitLen() == inner.Addr().BitLen() &&
+			outer.Bits() < inner.Bits() && outer.Contains(inner.Addr())
+	case rule.RuleType == AccessRuleTypeHostnameWildcard && (destinationType == AccessRuleTypeHostname || destinationType == AccessRuleTypeHostnameWildcard):
+		suffix := strings.ToLower(strings.TrimPrefix(rule.Value, "*"))
+		host := strings.ToLower(strings.TrimSuffix(destination, "."))
+		if destinationType == AccessRuleTypeHostnameWildcard {
+			host = strings.TrimPrefix(host, "*")
+		}
+		return host != suffix && strings.HasSuffix(host, suffix)
+	default:
+		return false
+	}
+}
+
+// Destinations returns the values the rule allows once Except is applied. An IP
+// or CIDR rule becomes the CIDRs left after taking the excepted ones out;
+// hostname wildcard rules keep their value, and the gateway leaves out names
+// matching Except.
+func (r *AccessRule) Destinations() []string {
+	if len(r.Except) == 0 || r.RuleType != AccessRuleTypeCIDR {
+		return []string{r.Value}
+	}
+	prefix, ok := parseDestinationPrefix(r.RuleType, r.Value)
+	if !ok {
+		return []string{r.Value}
+	}
+	remaining := []netip.Prefix{prefix}
+	for _, e := range r.Except {
+		excepted, ok := parseDestinationPrefix(AccessRuleTypeCIDR, e)
+		if !ok {
+			excepted, ok = parseDestinationPrefix(AccessRuleTypeIP, e)
+		}
+		if !ok {
+			continue
+		}
+		var next []netip.Prefix
+		for _, p := range remaining {
+			next = append(next, subtractPrefix(p, excepted)...)
+		}
+		remaining = next
+	}
+	values := make([]string, 0, len(remaining))
+	for _, p := range remaining {
+		values = append(values, p.String())
+	}
+	return values
+}
+
+// parseDestinationPrefix parses an IP or CIDR destination as a masked prefix.
+func parseDestinationPrefix(destinationType AccessRuleType, value string) (netip.Prefix, bool) {
+	if destinationType == AccessRuleTypeIP {
+		addr, err := netip.ParseAddr(value)
+		if err != nil {
+			return netip.Prefix{}, false
+		}
+		addr = addr.Unmap()
+		return netip.PrefixFrom(addr, addr.BitLen()), true
+	}
+	prefix, err := netip.ParsePrefix(value)
+	if err != nil {
+		return netip.Prefix{}, false
+	}
+	return netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()).Masked(), true
+}
+
+// subtractPrefix returns the prefixes covering p without q.
+func subtractPrefix(p, q netip.Prefix) []netip.Prefix {
+	switch {
+	case !p.Overlaps(q):
+		return []netip.Prefix{p}
+	case q.Bits() <= p.Bits():
+		return nil
+	}
+	low := netip.PrefixFrom(p.Addr(), p.Bits()+1)
+	b := p.Addr().AsSlice()
+	b[p.Bits()/8] |= 0x80 >> (p.Bits() % 8)
+	highAddr, _ := netip.AddrFromSlice(b)
+	high := netip.PrefixFrom(highAddr, p.Bits()+1)
+	return append(subtractPrefix(low, q), subtractPrefix(high, q)...)
+}
+
+// CreateAccessException adds an exception for a user
+func (s *AccessRuleStore) CreateAccessException(ctx context.Context, e *AccessException) error {
+	if e.RuleID != nil {
+		if ok, err := s.db.inTenant(ctx, "access_rules", *e.RuleID); err != nil || !ok {
+			return notFoundOr(err, ErrAccessRuleNotFound)
+		}
+	}
+	err := s.db.Pool.QueryRow(ctx, `
+		INSERT INTO user_access_exceptions (user_id, access_rule_id, destination_type, destination, reason, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at
+	`, e.UserID, e.RuleID, string(e.DestinationType), e.Destination, e.Reason, e.CreatedBy).Scan(&e.ID, &e.CreatedAt)
+	if isUniqueViolation(err) {
+		return ErrAccessExceptionExists
+	}
+	if err != nil {
+		return err
+	}
+	s.cache.invalidate()
+	return nil
+}
+
+// ListUserAccessExceptions returns a user's exceptions, oldest first, if the
+// user is in the tenant in ctx
+func (s *AccessRuleStore) ListUserAccessExceptions(ctx context.Context, userID string) ([]*AccessException, error) {
+	tenant, args := tenantClause(ctx, "u.tenant_id", []interface{}{userID})
+	rows, err := s.db.Pool.Query(ctx, `
+		SELECT uae.id, uae.user_id, uae.access_rule_id, COALESCE(ar.name, ''), uae.destination_type, uae.destination,
+		       uae.reason, uae.created_by, uae.created_at
+		FROM user_access_exceptions uae
+		JOIN users u ON u.id = uae.user_id
+		LEFT JOIN access_rules ar ON ar.id = uae.access_rule_id
+		WHERE uae.user_id::text = $1 AND `+tenant+`
+		ORDER BY uae.created_at
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var exceptions []*AccessException
+	for rows.Next() {
+		var e AccessException
+		var destinationType string
+		if err := rows.Scan(&e.ID, &e.UserID, &e.RuleID, &e.RuleName, &destinationType, &e.Destination,
+			&e.Reason, &e.CreatedBy, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		e.DestinationType = AccessRuleType(destinationType)
+		exceptions = append(exceptions, &e)
+	}
+	return exceptions, rows.Err()
+}
+
+// DeleteAccessException removes one of a user's exceptions, if the user is in
+// the tenant in ctx
+func (s *AccessRuleStore) DeleteAccessException(ctx context.Context, userID, id string) error {
+	tenant, args := tenantClause(ctx, "u.tenant_id", []interface{}{id, userID})
+	result, err := s.db.Pool.Exec(ctx, `
+		DELETE FROM user_access_exceptions uae USING users u
+		WHERE uae.id::text = $1 AND uae.user_id::text = $2 AND u.id = uae.user_id AND `+tenant, args...)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return ErrAccessExceptionNotFound
+	}
+	s.cache.invalidate()
+	return nil
+}
+
+// GetUserExcludedAccessRules returns the rules granted to a user, directly or
+// through their groups, that their exceptions take away.
+func (s *AccessRuleStore) GetUserExcludedAccessRules(ctx context.Context, userID string, groups []string) ([]*AccessRule, error) {
+	return s.queryGrantedRules(ctx, userID, groups, userExceptionSQL("$1"))
+}
+
+// GetAccessExceptionFingerprint returns a fingerprint of all user exceptions,
+// which changes whenever one is added or removed.
+func (s *AccessRuleStore) GetAccessExceptionFingerprint(ctx context.Context) (string, error) {
+	var fingerprint string
+	err := s.db.Pool.QueryRow(ctx, `
+		SELECT COALESCE(md5(string_agg(id::text, ',' ORDER BY id)), '')
+		FROM user_access_exceptions
+	`).Scan(&fingerprint)
+	return fingerprint, err
+}
@@ -0,0 +1,64 @@
+package db
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestApplyDestinationExceptions(t *testing.T) {
+	rules := []*AccessRule{
+		{ID: "1", RuleType: AccessRuleTypeCIDR, Value: "10.0.0.0/16"},
+		{ID: "2", RuleType: AccessRuleTypeIP, Value: "10.0.5.9"},
+		{ID: "3", RuleType: AccessRuleTypeHostnameWildcard, Value: "*.example.com"},
+		{ID: "4", RuleType: AccessRuleTypeHostname, Value: "db.prod.example.com"},
+		{ID: "5", RuleType: AccessRuleTypeCIDR, Value: "10.0.5.0/24"},
+	}
+	ruleID := "5"
+	exceptions := []*AccessException{
+		{DestinationType: AccessRuleTypeCIDR, Destination: "10.0.5.0/24"},
+		{DestinationType: AccessRuleTypeHostnameWildcard, Destination: "*.prod.example.com"},
+		{DestinationType: AccessRuleTypeHostname, Destination: "wiki.example.org"},
+		{RuleID: &ruleID},
+	}
+	applyDestinationExceptions(rules, exceptions)
+
+	want := map[string][]string{
+		"1": {"10.0.5.0/24"},
+		"3": {"*.prod.example.com"},
+	}
+	for _, r := range rules {
+		if !slices.Equal(r.Except, want[r.ID]) {
+			t.Errorf("rule %s Except = %v, want %v", r.ID, r.Except, want[r.ID])
+		}
+	}
+}
+
+func TestAccessRuleDestinations(t *testing.T) {
+	tests := []struct {
+		rule AccessRule
+		want []string
+	}{
+		{AccessRule{RuleType: AccessRuleTypeCIDR, Value: "10.0.0.0/24"}, []string{"10.0.0.0/24"}},
+		{
+			AccessRule{RuleType: AccessRuleTypeCIDR, Value: "10.0.0.0/24", Except: []string{"10.0.0.128/25"}},
+			[]string{"10.0.0.0/25"},
+		},
+		{
+			AccessRule{RuleType: AccessRuleTypeCIDR, Value: "10.0.0.0/30", Except: []string{"10.0.0.1"}},
+			[]string{"10.0.0.0/32", "10.0.0.2/31"},
+		},
+		{
+			AccessRule{RuleType: AccessRuleTypeCIDR, Value: "10.0.0.0/24", Except: []string{"10.0.0.0/26", "10.0.0.192/26"}},
+			[]string{"10.0.0.64/26", "10.0.0.128/26"},
+		},
+		{
+			AccessRule{RuleType: AccessRuleTypeHostnameWildcard, Value: "*.example.com", Except: []string{"db.example.com"}},
+			[]string{"*.example.com"},
+		},
+	}
+	for _, tt := range tests {
+		if got := tt.rule.Destinations(); !slices.Equal(got, tt.want) {
+			t.Errorf("Destinations(%s except %v) = %v, want %v", tt.rule.Value, tt.rule.Except, got, tt.want)
+		}
+	}
+}
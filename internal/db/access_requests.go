@@ -0,0 +1,214 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	ErrAccessRequestNotFound   = errors.New("access request not found")
+	ErrAccessRequestExists     = errors.New("an access request for this resource is already pending")
+	ErrAccessRequestNotPending = errors.New("access request is not pending")
+	ErrAccessRequestSelfReview = errors.New("access requests must be reviewed by a different admin")
+)
+
+// Access request statuses
+const (
+	AccessRequestPending   = "pending"
+	AccessRequestApproved  = "approved" // Approved and granted
+	AccessRequestRejected  = "rejected"
+	AccessRequestCancelled = "cancelled" // Withdrawn by the user
+	AccessRequestExpired   = "expired"   // Time-bounded access that has ended
+	AccessRequestFailed    = "failed"    // Approved, but the assignment couldn't be made
+)
+
+// Resources access can be requested for
+const (
+	AccessRequestGateway = "gateway"
+	AccessRequestNetwork = "network"
+)
+
+// AccessRequest is a user's request for access to a gateway or network
+type AccessRequest struct {
+	ID              string
+	UserID          string
+	UserEmail       string
+	ResourceType    string
+	ResourceID      string
+	ResourceName    string
+	Justification   string
+	DurationHours   *int // Requested length of access; nil for no end
+	Status          string
+	ReviewedBy      *string
+	ReviewedByEmail *string
+	ReviewComment   string
+	GrantedRuleID   *string // Rule assigned for an approved network request
+	Granted         bool    // The approval created the assignment
+	AccessExpiresAt *time.Time
+	CreatedAt       time.Time
+	ReviewedAt      *time.Time
+}
+
+// AccessRequestStore handles access request persistence
+type AccessRequestStore struct {
+	db *DB
+}
+
+// NewAccessRequestStore creates a new access request store
+func NewAccessRequestStore(db *DB) *AccessRequestStore {
+	return &AccessRequestStore{db: db}
+}
+
+const accessRequestColumns = `id, user_id, user_email, resource_type, resource_id, resource_name, justification,
+		duration_hours, status, reviewed_by, reviewed_by_email, review_comment, granted_rule_id, granted,
+		access_expires_at, created_at, reviewed_at`
+
+func scanAccessRequest(row pgx.Row) (*AccessRequest, error) {
+	var r AccessRequest
+	err := row.Scan(&r.ID, &r.UserID, &r.UserEmail, &r.ResourceType, &r.ResourceID, &r.ResourceName, &r.Justification,
+		&r.DurationHours, &r.Status, &r.ReviewedBy, &r.ReviewedByEmail, &r.ReviewComment, &r.GrantedRuleID, &r.Granted,
+		&r.AccessExpiresAt, &r.CreatedAt, &r.ReviewedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// Create stores a new pending access request
+func (s *AccessRequestStore) Create(ctx context.Context, r *AccessRequest) error {
+	err := s.db.Pool.QueryRow(ctx, `
+		INSERT INTO access_requests (user_id, user_email, resource_type, resource_id, resource_name, justification, duration_hours, tenant_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id, status, created_at
+	`, r.UserID, r.UserEmail, r.ResourceType, r.ResourceID, r.ResourceName, r.Justification, r.DurationHours,
+		tenantForInsert(ctx)).Scan(&r.ID, &r.Status, &r.CreatedAt)
+	if isUniqueViolation(err) {
+		return ErrAccessRequestExists
+	}
+	return err
+}
+
+// Get retrieves an access request by ID
+func (s *AccessRequestStore) Get(ctx context.Context, id string) (*AccessRequest, error) {
+	tenant, args := tenantClause(ctx, "tenant_id", []interface{}{id})
+	r, err := scanAccessRequest(s.db.Pool.QueryRow(ctx, `
+		SELECT `+accessRequestColumns+`
+		FROM access_requests WHERE id::text = $1 AND `+tenant, args...))
+	if err == pgx.ErrNoRows {
+		return nil, ErrAccessRequestNotFound
+	}
+	return r, err
+}
+
+// List returns access requests, newest first, optionally only a user's or only
+// those with a status.
+func (s *AccessRequestStore) List(ctx context.Context, userID, status string, limit int) ([]*AccessRequest, error) {
+	tenant, args := tenantClause(ctx, "tenant_id", []interface{}{userID, status, limit})
+	rows, err := s.db.Pool.Query(ctx, `
+		SELECT `+accessRequestColumns+`
+		FROM access_requests
+		WHERE ($1 = '' OR user_id = $1) AND ($2 = '' OR status = $2) AND `+tenant+`
+		ORDER BY created_at DESC
+		LIMIT $3
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var requests []*AccessRequest
+	for rows.Next() {
+		r, err := scanAccessRequest(rows)
+		if err != nil {
+			return nil, err
+		}
+		requests = append(requests, r)
+	}
+	return requests, rows.Err()
+}
+
+// Cancel withdraws one of a user's pending requests
+func (s *AccessRequestStore) Cancel(ctx context.Context, id, userID string) (*AccessRequest, error) {
+	tenant, args := tenantClause(ctx, "tenant_id", []interface{}{id, userID})
+	r, err := scanAccessRequest(s.db.Pool.QueryRow(ctx, `
+		UPDATE access_requests SET status = 'cancelled'
+		WHERE id::text = $1 AND user_id = $2 AND status = 'pending' AND `+tenant+`
+		RETURNING `+accessRequestColumns, args...))
+	if err != pgx.ErrNoRows {
+		return r, err
+	}
+
+	existing, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if existing.UserID != userID {
+		return nil, ErrAccessRequestNotFound
+	}
+	return nil, ErrAccessRequestNotPending
+}
+
+// Review moves a pending request to approved or rejected. Like pending changes,
+// only requests made by someone else match, so a request can't be reviewed twice
+// or approved by the admin who made it.
+func (s *AccessRequestStore) Review(ctx context.Context, id, status, reviewerID, reviewerEmail, comment string) (*AccessRequest, error) {
+	tenant, args := tenantClause(ctx, "tenant_id", []interface{}{id, status, reviewerID, reviewerEmail, comment})
+	r, err := scanAccessRequest(s.db.Pool.QueryRow(ctx, `
+		UPDATE access_requests
+		SET status = $2, reviewed_by = $3, reviewed_by_email = $4, review_comment = $5, reviewed_at = NOW()
+		WHERE id::text = $1 AND status = 'pending' AND user_id <> $3 AND `+tenant+`
+		RETURNING `+accessRequestColumns, args...))
+	if err != pgx.ErrNoRows {
+		return r, err
+	}
+
+	existing, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if existing.Status != AccessRequestPending {
+		return nil, ErrAccessRequestNotPending
+	}
+	return nil, ErrAccessRequestSelfReview
+}
+
+// SetGrant records the assignment an approved request was granted and when it ends
+func (s *AccessRequestStore) SetGrant(ctx context.Context, r *AccessRequest) error {
+	_, err := s.db.Pool.Exec(ctx, `
+		UPDATE access_requests SET granted_rule_id = $2, granted = $3, access_expires_at = $4 WHERE id = $1
+	`, r.ID, r.GrantedRuleID, r.Granted, r.AccessExpiresAt)
+	return err
+}
+
+// SetStatus sets a request's status, for approvals that failed and grants that ended
+func (s *AccessRequestStore) SetStatus(ctx context.Context, id, status string) error {
+	_, err := s.db.Pool.Exec(ctx, `UPDATE access_requests SET status = $2 WHERE id = $1`, id, status)
+	return err
+}
+
+// ListExpiredGrants returns approved requests whose access ended before now
+func (s *AccessRequestStore) ListExpiredGrants(ctx context.Context, now time.Time) ([]*AccessRequest, error) {
+	rows, err := s.db.Pool.Query(ctx, `
+		SELECT `+accessRequestColumns+`
+		FROM access_requests
+		WHERE status = 'approved' AND access_expires_at < $1
+		ORDER BY access_expires_at
+	`, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var requests []*AccessRequest
+	for rows.Next() {
+		r, err := scanAccessRequest(rows)
+		if err != nil {
+			return nil, err
+		}
+		requests = append(requests, r)
+	}
+	return requests, rows.Err()
+}
@@ -0,0 +1,92 @@
+package db
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultAccessRuleCacheTTL bounds how long a cached rule set may be served.
+// Mutations made through this process invalidate the cache immediately; the
+// TTL covers changes made by other control plane replicas.
+const DefaultAccessRuleCacheTTL = 30 * time.Second
+
+// accessRuleCache caches the computed access rule set per user and group set.
+// Gateways poll client rules every few seconds for every connected client, so
+// serving repeated lookups from memory keeps the user/group join off the database.
+type accessRuleCache struct {
+	mu         sync.RWMutex
+	ttl        time.Duration
+	entries    map[string]accessRuleCacheEntry
+	generation uint64 // Incremented by every invalidation
+}
+
+type accessRuleCacheEntry struct {
+	rules     []*AccessRule
+	expiresAt time.Time
+}
+
+func newAccessRuleCache(ttl time.Duration) *accessRuleCache {
+	return &accessRuleCache{
+		ttl:     ttl,
+		entries: make(map[string]accessRuleCacheEntry),
+	}
+}
+
+// accessRuleCacheKey builds a cache key from a user ID and an order-independent group set.
+func accessRuleCacheKey(userID string, groups []string) string {
+	sorted := make([]string, len(groups))
+	copy(sorted, groups)
+	sort.Strings(sorted)
+	return userID + "|" + strings.Join(sorted, ",")
+}
+
+func (c *accessRuleCache) get(key string) ([]*AccessRule, bool) {
+	c.mu.RLock()
+	entry, ok := c.entries[key]
+	c.mu.RUnlock()
+	if !ok || time.Now().After(entry.expiresAt) {
+		return nil, false
+	}
+	rules := make([]*AccessRule, len(entry.rules))
+	copy(rules, entry.rules)
+	return rules, true
+}
+
+// set caches rules loaded while the cache was at generation, as read before the
+// query. If an invalidation has happened since, the rules may predate it, so they
+// aren't cached.
+func (c *accessRuleCache) set(key string, rules []*AccessRule, generation uint64) {
+	stored := make([]*AccessRule, len(rules))
+	copy(stored, rules)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.generation != generation {
+		return
+	}
+
+	// Drop expired entries opportunistically so the map doesn't grow without bound
+	now := time.Now()
+	for k, e := range c.entries {
+		if now.After(e.expiresAt) {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = accessRuleCacheEntry{rules: stored, expiresAt: now.Add(c.ttl)}
+}
+
+// invalidate drops all cached rule sets.
+func (c *accessRuleCache) invalidate() {
+	c.mu.Lock()
+	c.entries = make(map[string]accessRuleCacheEntry)
+	c.generation++
+	c.mu.Unlock()
+}
+
+func (c *accessRuleCache) currentGeneration() uint64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.generation
+}
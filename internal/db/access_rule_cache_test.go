@@ -0,0 +1,81 @@
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAccessRuleCacheKey(t *testing.T) {
+	groups := []string{"ops", "eng"}
+	if accessRuleCacheKey("u1", groups) != accessRuleCacheKey("u1", []string{"eng", "ops"}) {
+		t.Error("key depends on group order")
+	}
+	if groups[0] != "ops" {
+		t.Error("accessRuleCacheKey sorted the caller's groups")
+	}
+	if accessRuleCacheKey("u1", []string{"eng"}) == accessRuleCacheKey("u2", []string{"eng"}) {
+		t.Error("different users share a key")
+	}
+	if accessRuleCacheKey("u1", []string{"eng"}) == accessRuleCacheKey("u1", []string{"eng", "ops"}) {
+		t.Error("different group sets share a key")
+	}
+}
+
+func TestAccessRuleCache(t *testing.T) {
+	rules := []*AccessRule{{ID: "r1"}, {ID: "r2"}}
+	c := newAccessRuleCache(time.Minute)
+	key := accessRuleCacheKey("u1", []string{"eng"})
+
+	if _, ok := c.get(key); ok {
+		t.Fatal("empty cache returned rules")
+	}
+	c.set(key, rules, c.currentGeneration())
+	got, ok := c.get(key)
+	if !ok || len(got) != 2 || got[0].ID != "r1" {
+		t.Fatalf("get() = %v, %v, want the cached rules", got, ok)
+	}
+	got[0] = &AccessRule{ID: "changed"}
+	if again, _ := c.get(key); again[0].ID != "r1" {
+		t.Error("changing a returned slice changed the cache")
+	}
+
+	generation := c.currentGeneration()
+	c.invalidate()
+	if _, ok := c.get(key); ok {
+		t.Error("rules served after invalidation")
+	}
+	if c.currentGeneration() == generation {
+		t.Error("invalidation didn't change the generation")
+	}
+
+	expired := newAccessRuleCache(-time.Second)
+	expired.set(key, rules, expired.currentGeneration())
+	if _, ok := expired.get(key); ok {
+		t.Error("rules served after the TTL")
+	}
+	expired.set(accessRuleCacheKey("u2", nil), rules, expired.currentGeneration())
+	if len(expired.entries) != 1 {
+		t.Errorf("expired entries kept: %d entries, want 1", len(expired.entries))
+	}
+}
+
+func TestAccessRuleCacheInvalidatedDuringQuery(t *testing.T) {
+	c := newAccessRuleCache(time.Minute)
+	key := accessRuleCacheKey("u1", []string{"eng"})
+
+	// A lookup reads the generation, a rule is revoked and the cache invalidated
+	// while its query runs, then it stores what the query returned
+	generation := c.currentGeneration()
+	stale := []*AccessRule{{ID: "revoked"}}
+	c.invalidate()
+	c.set(key, stale, generation)
+	if got, ok := c.get(key); ok {
+		t.Errorf("rules loaded before an invalidation were cached: %v", got)
+	}
+
+	// The next lookup caches normally
+	c.set(key, []*AccessRule{{ID: "r1"}}, c.currentGeneration())
+	if _, ok := c.get(key); !ok {
+		t.Error("rules loaded after the invalidation weren't cached")
+	}
+}
@@ -28,45 +28,70 @@ type AccessRule struct {
 	Name        string
 	Description string
 	RuleType    AccessRuleType
-	Value       string  // IP, CIDR, or hostname
-	PortRange   *string // Optional: "80", "443", "8000-9000", "*"
-	Protocol    *string // Optional: tcp, udp, icmp, *
-	NetworkID   *string // Optional: restrict to specific network
+	Value       string   // IP, CIDR, or hostname
+	PortRange   *string  // Optional: "80", "443", "8000-9000", "*"
+	Protocol    *string  // Optional: tcp, udp, icmp, *
+	NetworkID   *string  // Optional: restrict to specific network
+	PushOptions []string // Allowlisted push options for users granted the rule
 	IsActive    bool
 	CreatedAt   time.Time
 	UpdatedAt   time.Time
+	// Except lists the destinations within the rule that the user's destination
+	// exceptions take away; only set on rules loaded for a user
+	Except []string
 }
 
 // AccessRuleStore handles access rule persistence
 type AccessRuleStore struct {
-	db *DB
+	db    *DB
+	cache *accessRuleCache
 }
 
 // NewAccessRuleStore creates a new access rule store
 func NewAccessRuleStore(db *DB) *AccessRuleStore {
-	return &AccessRuleStore{db: db}
+	return &AccessRuleStore{db: db, cache: newAccessRuleCache(DefaultAccessRuleCacheTTL)}
+}
+
+// InvalidateCache drops all cached per-user rule sets. Call this after changing
+// data that affects rule resolution outside of this store.
+func (s *AccessRuleStore) InvalidateCache() {
+	s.cache.invalidate()
+}
+
+// CacheGeneration changes whenever the cache is invalidated, so values derived
+// from rules, assignments and exceptions can be cached until they change. Like
+// the cache, it only sees changes made through this process.
+func (s *AccessRuleStore) CacheGeneration() uint64 {
+	return s.cache.currentGeneration()
 }
 
 // CreateAccessRule creates a new access rule
 func (s *AccessRuleStore) CreateAccessRule(ctx context.Context, rule *AccessRule) error {
+	pushOptions := rule.PushOptions
+	if pushOptions == nil {
+		pushOptions = []string{}
+	}
 	err := s.db.Pool.QueryRow(ctx, `
-		INSERT INTO access_rules (name, description, rule_type, value, port_range, protocol, network_id, is_active)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		INSERT INTO access_rules (name, description, rule_type, value, port_range, protocol, network_id, is_active, tenant_id, push_options)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
 		RETURNING id, created_at, updated_at
-	`, rule.Name, rule.Description, rule.RuleType, rule.Value, rule.PortRange, rule.Protocol, rule.NetworkID, rule.IsActive).Scan(
+	`, rule.Name, rule.Description, rule.RuleType, rule.Value, rule.PortRange, rule.Protocol, rule.NetworkID, rule.IsActive, tenantForInsert(ctx), pushOptions).Scan(
 		&rule.ID, &rule.CreatedAt, &rule.UpdatedAt,
 	)
+	if err == nil {
+		s.cache.invalidate()
+	}
 	return err
 }
 
 // GetAccessRule retrieves an access rule by ID
 func (s *AccessRuleStore) GetAccessRule(ctx context.Context, id string) (*AccessRule, error) {
 	var rule AccessRule
+	tenant, args := tenantClause(ctx, "tenant_id", []interface{}{id})
 	err := s.db.Pool.QueryRow(ctx, `
-		SELECT id, name, description, rule_type, value, port_range, protocol, network_id, is_active, created_at, updated_at
-		FROM access_rules WHERE id = $1
-	`, id).Scan(&rule.ID, &rule.Name, &rule.Description, &rule.RuleType, &rule.Value,
-		&rule.PortRange, &rule.Protocol, &rule.NetworkID, &rule.IsActive, &rule.CreatedAt, &rule.UpdatedAt)
+		SELECT id, name, description, rule_type, value, port_range, protocol, network_id, is_active, created_at, updated_at, push_options
+		FROM access_rules WHERE id = $1 AND `+tenant, args...).Scan(&rule.ID, &rule.Name, &rule.Description, &rule.RuleType, &rule.Value,
+		&rule.PortRange, &rule.Protocol, &rule.NetworkID, &rule.IsActive, &rule.CreatedAt, &rule.UpdatedAt, &rule.PushOptions)
 	if err == pgx.ErrNoRows {
 		return nil, ErrAccessRuleNotFound
 	}
@@ -75,10 +100,11 @@ func (s *AccessRuleStore) GetAccessRule(ctx context.Context, id string) (*Access
 
 // ListAccessRules retrieves all access rules
 func (s *AccessRuleStore) ListAccessRules(ctx context.Context) ([]*AccessRule, error) {
+	tenant, args := tenantClause(ctx, "tenant_id", nil)
 	rows, err := s.db.Pool.Query(ctx, `
-		SELECT id, name, description, rule_type, value, port_range, protocol, network_id, is_active, created_at, updated_at
-		FROM access_rules ORDER BY name
-	`)
+		SELECT id, name, description, rule_type, value, port_range, protocol, network_id, is_active, created_at, updated_at, push_options
+		FROM access_rules WHERE `+tenant+` ORDER BY name
+	`, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -88,7 +114,7 @@ func (s *AccessRuleStore) ListAccessRules(ctx context.Context) ([]*AccessRule, e
 	for rows.Next() {
 		var r AccessRule
 		if err := rows.Scan(&r.ID, &r.Name, &r.Description, &r.RuleType, &r.Value,
-			&r.PortRange, &r.Protocol, &r.NetworkID, &r.IsActive, &r.CreatedAt, &r.UpdatedAt); err != nil {
+			&r.PortRange, &r.Protocol, &r.NetworkID, &r.IsActive, &r.CreatedAt, &r.UpdatedAt, &r.PushOptions); err != nil {
 			return nil, err
 		}
 		rules = append(rules, &r)
@@ -98,11 +124,12 @@ func (s *AccessRuleStore) ListAccessRules(ctx context.Context) ([]*AccessRule, e
 
 // ListAccessRulesByNetwork retrieves access rules for a specific network
 func (s *AccessRuleStore) ListAccessRulesByNetwork(ctx context.Context, networkID string) ([]*AccessRule, error) {
+	tenant, args := tenantClause(ctx, "tenant_id", []interface{}{networkID})
 	rows, err := s.db.Pool.Query(ctx, `
-		SELECT id, name, description, rule_type, value, port_range, protocol, network_id, is_active, created_at, updated_at
-		FROM access_rules WHERE network_id = $1 OR network_id IS NULL
+		SELECT id, name, description, rule_type, value, port_range, protocol, network_id, is_active, created_at, updated_at, push_options
+		FROM access_rules WHERE (network_id = $1 OR network_id IS NULL) AND `+tenant+`
 		ORDER BY name
-	`, networkID)
+	`, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -112,7 +139,7 @@ func (s *AccessRuleStore) ListAccessRulesByNetwork(ctx context.Context, networkI
 	for rows.Next() {
 		var r AccessRule
 		if err := rows.Scan(&r.ID, &r.Name, &r.Description, &r.RuleType, &r.Value,
-			&r.PortRange, &r.Protocol, &r.NetworkID, &r.IsActive, &r.CreatedAt, &r.UpdatedAt); err != nil {
+			&r.PortRange, &r.Protocol, &r.NetworkID, &r.IsActive, &r.CreatedAt, &r.UpdatedAt, &r.PushOptions); err != nil {
 			return nil, err
 		}
 		rules = append(rules, &r)
@@ -122,79 +149,188 @@ func (s *AccessRuleStore) ListAccessRulesByNetwork(ctx context.Context, networkI
 
 // UpdateAccessRule updates an access rule
 func (s *AccessRuleStore) UpdateAccessRule(ctx context.Context, rule *AccessRule) error {
+	pushOptions := rule.PushOptions
+	if pushOptions == nil {
+		pushOptions = []string{}
+	}
+	tenant, args := tenantClause(ctx, "tenant_id", []interface{}{rule.ID, rule.Name, rule.Description, rule.RuleType, rule.Value,
+		rule.PortRange, rule.Protocol, rule.NetworkID, rule.IsActive, pushOptions})
 	result, err := s.db.Pool.Exec(ctx, `
 		UPDATE access_rules SET name = $2, description = $3, rule_type = $4, value = $5,
-		       port_range = $6, protocol = $7, network_id = $8, is_active = $9
-		WHERE id = $1
-	`, rule.ID, rule.Name, rule.Description, rule.RuleType, rule.Value,
-		rule.PortRange, rule.Protocol, rule.NetworkID, rule.IsActive)
+		       port_range = $6, protocol = $7, network_id = $8, is_active = $9, push_options = $10
+		WHERE id = $1 AND `+tenant, args...)
 	if err != nil {
 		return err
 	}
 	if result.RowsAffected() == 0 {
 		return ErrAccessRuleNotFound
 	}
+	s.cache.invalidate()
 	return nil
 }
 
 // DeleteAccessRule deletes an access rule
 func (s *AccessRuleStore) DeleteAccessRule(ctx context.Context, id string) error {
-	result, err := s.db.Pool.Exec(ctx, `DELETE FROM access_rules WHERE id = $1`, id)
+	tenant, args := tenantClause(ctx, "tenant_id", []interface{}{id})
+	result, err := s.db.Pool.Exec(ctx, `DELETE FROM access_rules WHERE id = $1 AND `+tenant, args...)
 	if err != nil {
 		return err
 	}
 	if result.RowsAffected() == 0 {
 		return ErrAccessRuleNotFound
 	}
+	s.cache.invalidate()
 	return nil
 }
 
-// AssignRuleToUser assigns an access rule to a user
-func (s *AccessRuleStore) AssignRuleToUser(ctx context.Context, userID, ruleID string) error {
-	_, err := s.db.Pool.Exec(ctx, `
+// AssignRuleToUser assigns an access rule to a user, reporting whether it wasn't already assigned
+func (s *AccessRuleStore) AssignRuleToUser(ctx context.Context, userID, ruleID string) (bool, error) {
+	if ok, err := s.db.inTenant(ctx, "access_rules", ruleID); err != nil || !ok {
+		return false, notFoundOr(err, ErrAccessRuleNotFound)
+	}
+	result, err := s.db.Pool.Exec(ctx, `
 		INSERT INTO user_access_rules (user_id, access_rule_id)
 		VALUES ($1, $2)
 		ON CONFLICT DO NOTHING
 	`, userID, ruleID)
-	return err
+	if err != nil {
+		return false, err
+	}
+	s.cache.invalidate()
+	return result.RowsAffected() > 0, nil
 }
 
 // RemoveRuleFromUser removes an access rule from a user
 func (s *AccessRuleStore) RemoveRuleFromUser(ctx context.Context, userID, ruleID string) error {
+	if ok, err := s.db.inTenant(ctx, "access_rules", ruleID); err != nil || !ok {
+		return notFoundOr(err, ErrAccessRuleNotFound)
+	}
 	_, err := s.db.Pool.Exec(ctx, `
 		DELETE FROM user_access_rules WHERE user_id = $1 AND access_rule_id = $2
 	`, userID, ruleID)
+	if err == nil {
+		s.cache.invalidate()
+	}
 	return err
 }
 
-// AssignRuleToGroup assigns an access rule to a group
-func (s *AccessRuleStore) AssignRuleToGroup(ctx context.Context, groupName, ruleID string) error {
-	_, err := s.db.Pool.Exec(ctx, `
+// AssignRuleToGroup assigns an access rule to a group, reporting whether it wasn't already assigned
+func (s *AccessRuleStore) AssignRuleToGroup(ctx context.Context, groupName, ruleID string) (bool, error) {
+	if ok, err := s.db.inTenant(ctx, "access_rules", ruleID); err != nil || !ok {
+		return false, notFoundOr(err, ErrAccessRuleNotFound)
+	}
+	result, err := s.db.Pool.Exec(ctx, `
 		INSERT INTO group_access_rules (group_name, access_rule_id)
 		VALUES ($1, $2)
 		ON CONFLICT DO NOTHING
 	`, groupName, ruleID)
-	return err
+	if err != nil {
+		return false, err
+	}
+	s.cache.invalidate()
+	return result.RowsAffected() > 0, nil
 }
 
 // RemoveRuleFromGroup removes an access rule from a group
 func (s *AccessRuleStore) RemoveRuleFromGroup(ctx context.Context, groupName, ruleID string) error {
+	if ok, err := s.db.inTenant(ctx, "access_rules", ruleID); err != nil || !ok {
+		return notFoundOr(err, ErrAccessRuleNotFound)
+	}
 	_, err := s.db.Pool.Exec(ctx, `
 		DELETE FROM group_access_rules WHERE group_name = $1 AND access_rule_id = $2
 	`, groupName, ruleID)
+	if err == nil {
+		s.cache.invalidate()
+	}
 	return err
 }
 
-// GetUserAccessRules gets all access rules assigned to a user (directly or via groups)
+// AssignRulesToGroup assigns several access rules to a group in one transaction,
+// so either all of them end up assigned or, if any rule doesn't exist, none are.
+// It returns the IDs of the rules that weren't already assigned.
+func (s *AccessRuleStore) AssignRulesToGroup(ctx context.Context, groupName string, ruleIDs []string) ([]string, error) {
+	tx, err := s.db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	created := []string{}
+	for _, ruleID := range ruleIDs {
+		tenant, args := tenantClause(ctx, "tenant_id", []interface{}{ruleID})
+		var exists bool
+		err := tx.QueryRow(ctx, `SELECT EXISTS(SELECT 1 FROM access_rules WHERE id::text = $1 AND `+tenant+`)`, args...).Scan(&exists)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			return nil, ErrAccessRuleNotFound
+		}
+
+		result, err := tx.Exec(ctx, `
+			INSERT INTO group_access_rules (group_name, access_rule_id)
+			VALUES ($1, $2)
+			ON CONFLICT DO NOTHING
+		`, groupName, ruleID)
+		if err != nil {
+			return nil, err
+		}
+		if result.RowsAffected() > 0 {
+			created = append(created, ruleID)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	s.cache.invalidate()
+	return created, nil
+}
+
+// GetUserAccessRules gets all access rules assigned to a user (directly or via groups).
+// Results are served from an in-memory cache keyed by user and group set when available.
 func (s *AccessRuleStore) GetUserAccessRules(ctx context.Context, userID string, groups []string) ([]*AccessRule, error) {
-	// Get rules assigned directly to the user and via their groups
+	key := accessRuleCacheKey(userID, groups)
+	if rules, ok := s.cache.get(key); ok {
+		return rules, nil
+	}
+
+	// Read the generation first, so rules loaded before a concurrent change
+	// aren't cached after its invalidation
+	generation := s.cache.currentGeneration()
+	rules, err := s.queryUserAccessRules(ctx, userID, groups)
+	if err != nil {
+		return nil, err
+	}
+	s.cache.set(key, rules, generation)
+	return rules, nil
+}
+
+// queryUserAccessRules loads a user's access rules from the database, bypassing the cache.
+// The user's exceptions take precedence over both direct and group grants.
+func (s *AccessRuleStore) queryUserAccessRules(ctx context.Context, userID string, groups []string) ([]*AccessRule, error) {
+	rules, err := s.queryGrantedRules(ctx, userID, groups, "NOT "+userExceptionSQL("$1"))
+	if err != nil {
+		return nil, err
+	}
+	if err := s.db.exceptDestinations(ctx, userID, rules); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// queryGrantedRules loads the active rules assigned to a user directly or via
+// their groups that also meet filter, a condition on ar.
+func (s *AccessRuleStore) queryGrantedRules(ctx context.Context, userID string, groups []string, filter string) ([]*AccessRule, error) {
 	query := `
 		SELECT DISTINCT ar.id, ar.name, ar.description, ar.rule_type, ar.value,
-		       ar.port_range, ar.protocol, ar.network_id, ar.is_active, ar.created_at, ar.updated_at
+		       ar.port_range, ar.protocol, ar.network_id, ar.is_active, ar.created_at, ar.updated_at, ar.push_options
 		FROM access_rules ar
 		LEFT JOIN user_access_rules uar ON ar.id = uar.access_rule_id AND uar.user_id = $1
 		LEFT JOIN group_access_rules gar ON ar.id = gar.access_rule_id
 		WHERE ar.is_active = true AND (uar.user_id IS NOT NULL OR gar.group_name = ANY($2))
+		AND ar.tenant_id = ` + userTenantSQL("$1") + `
+		AND ` + filter + `
 		ORDER BY ar.name
 	`
 	rows, err := s.db.Pool.Query(ctx, query, userID, groups)
@@ -207,7 +343,7 @@ func (s *AccessRuleStore) GetUserAccessRules(ctx context.Context, userID string,
 	for rows.Next() {
 		var r AccessRule
 		if err := rows.Scan(&r.ID, &r.Name, &r.Description, &r.RuleType, &r.Value,
-			&r.PortRange, &r.Protocol, &r.NetworkID, &r.IsActive, &r.CreatedAt, &r.UpdatedAt); err != nil {
+			&r.PortRange, &r.Protocol, &r.NetworkID, &r.IsActive, &r.CreatedAt, &r.UpdatedAt, &r.PushOptions); err != nil {
 			return nil, err
 		}
 		rules = append(rules, &r)
@@ -217,6 +353,9 @@ func (s *AccessRuleStore) GetUserAccessRules(ctx context.Context, userID string,
 
 // GetRuleUsers gets all users assigned to an access rule
 func (s *AccessRuleStore) GetRuleUsers(ctx context.Context, ruleID string) ([]string, error) {
+	if ok, err := s.db.inTenant(ctx, "access_rules", ruleID); err != nil || !ok {
+		return nil, notFoundOr(err, ErrAccessRuleNotFound)
+	}
 	rows, err := s.db.Pool.Query(ctx, `
 		SELECT user_id FROM user_access_rules WHERE access_rule_id = $1
 	`, ruleID)
@@ -238,6 +377,9 @@ func (s *AccessRuleStore) GetRuleUsers(ctx context.Context, ruleID string) ([]st
 
 // GetRuleGroups gets all groups assigned to an access rule
 func (s *AccessRuleStore) GetRuleGroups(ctx context.Context, ruleID string) ([]string, error) {
+	if ok, err := s.db.inTenant(ctx, "access_rules", ruleID); err != nil || !ok {
+		return nil, notFoundOr(err, ErrAccessRuleNotFound)
+	}
 	rows, err := s.db.Pool.Query(ctx, `
 		SELECT group_name FROM group_access_rules WHERE access_rule_id = $1
 	`, ruleID)
@@ -259,9 +401,11 @@ func (s *AccessRuleStore) GetRuleGroups(ctx context.Context, ruleID string) ([]s
 
 // GetAllUserAccessRuleAssignments returns all user-to-rule assignments as map[userID][]ruleID
 func (s *AccessRuleStore) GetAllUserAccessRuleAssignments(ctx context.Context) (map[string][]string, error) {
+	tenant, args := tenantClause(ctx, "ar.tenant_id", nil)
 	rows, err := s.db.Pool.Query(ctx, `
-		SELECT user_id, access_rule_id FROM user_access_rules
-	`)
+		SELECT uar.user_id, uar.access_rule_id FROM user_access_rules uar
+		JOIN access_rules ar ON ar.id = uar.access_rule_id
+		WHERE `+tenant, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -280,9 +424,11 @@ func (s *AccessRuleStore) GetAllUserAccessRuleAssignments(ctx context.Context) (
 
 // GetAllGroupAccessRuleAssignments returns all group-to-rule assignments as map[groupName][]ruleID
 func (s *AccessRuleStore) GetAllGroupAccessRuleAssignments(ctx context.Context) (map[string][]string, error) {
+	tenant, args := tenantClause(ctx, "ar.tenant_id", nil)
 	rows, err := s.db.Pool.Query(ctx, `
-		SELECT group_name, access_rule_id FROM group_access_rules
-	`)
+		SELECT gar.group_name, gar.access_rule_id FROM group_access_rules gar
+		JOIN access_rules ar ON ar.id = gar.access_rule_id
+		WHERE `+tenant, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -306,14 +452,17 @@ func (s *AccessRuleStore) GetUserAccessRulesForGateway(ctx context.Context, user
 	// assigned to this gateway via gateway_networks
 	query := `
 		SELECT DISTINCT ar.id, ar.name, ar.description, ar.rule_type, ar.value,
-		       ar.port_range, ar.protocol, ar.network_id, ar.is_active, ar.created_at, ar.updated_at
+		       ar.port_range, ar.protocol, ar.network_id, ar.is_active, ar.created_at, ar.updated_at, ar.push_options
 		FROM access_rules ar
 		JOIN gateway_networks gn ON ar.network_id = gn.network_id
+		JOIN networks n ON n.id = gn.network_id AND n.deleted_at IS NULL
 		LEFT JOIN user_access_rules uar ON ar.id = uar.access_rule_id AND uar.user_id = $1
 		LEFT JOIN group_access_rules gar ON ar.id = gar.access_rule_id
 		WHERE ar.is_active = true
 		AND gn.gateway_id = $3
 		AND (uar.user_id IS NOT NULL OR gar.group_name = ANY($2))
+		AND ar.tenant_id = ` + userTenantSQL("$1") + `
+		AND NOT ` + userExceptionSQL("$1") + `
 		ORDER BY ar.name
 	`
 	rows, err := s.db.Pool.Query(ctx, query, userID, groups, gatewayID)
@@ -326,10 +475,16 @@ func (s *AccessRuleStore) GetUserAccessRulesForGateway(ctx context.Context, user
 	for rows.Next() {
 		var r AccessRule
 		if err := rows.Scan(&r.ID, &r.Name, &r.Description, &r.RuleType, &r.Value,
-			&r.PortRange, &r.Protocol, &r.NetworkID, &r.IsActive, &r.CreatedAt, &r.UpdatedAt); err != nil {
+			&r.PortRange, &r.Protocol, &r.NetworkID, &r.IsActive, &r.CreatedAt, &r.UpdatedAt, &r.PushOptions); err != nil {
 			return nil, err
 		}
 		rules = append(rules, &r)
 	}
-	return rules, rows.Err()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if err := s.db.exceptDestinations(ctx, userID, rules); err != nil {
+		return nil, err
+	}
+	return rules, nil
 }
@@ -86,6 +86,12 @@ func HashAPIKey(rawKey string) string {
 	return hex.EncodeToString(hash[:])
 }
 
+// apiKeyTenantClause restricts API keys, in the table or alias given, to the
+// tenant ctx is scoped to. Keys belong to their user's tenant.
+func apiKeyTenantClause(ctx context.Context, table string, args []interface{}) (string, []interface{}) {
+	return tenantClause(ctx, userTenantSQL(table+".user_id"), args)
+}
+
 // Create creates a new API key
 func (s *APIKeyStore) Create(ctx context.Context, key *APIKey) error {
 	scopesJSON, err := json.Marshal(key.Scopes)
@@ -106,12 +112,12 @@ func (s *APIKeyStore) Create(ctx context.Context, key *APIKey) error {
 
 // GetByID retrieves an API key by ID
 func (s *APIKeyStore) GetByID(ctx context.Context, id string) (*APIKey, error) {
+	tenant, args := apiKeyTenantClause(ctx, "api_keys", []interface{}{id})
 	return s.scanAPIKey(s.db.Pool.QueryRow(ctx, `
 		SELECT id, user_id, name, description, key_hash, key_prefix, scopes,
 			is_admin_provisioned, provisioned_by, expires_at, last_used_at, last_used_ip::text,
 			is_revoked, revoked_at, revoked_by, revocation_reason, created_at, updated_at
-		FROM api_keys WHERE id = $1
-	`, id))
+		FROM api_keys WHERE id = $1 AND `+tenant, args...))
 }
 
 // GetByKeyHash retrieves an API key by its hash
@@ -148,11 +154,11 @@ func (s *APIKeyStore) ValidateKey(ctx context.Context, keyHash string) (*APIKey,
 	var user SSOUser
 	var groupsJSON []byte
 	err = s.db.Pool.QueryRow(ctx, `
-		SELECT id, external_id, provider, email, name, groups, is_admin, is_active, last_login_at, created_at, updated_at
+		SELECT id, external_id, provider, email, name, groups, is_admin, is_active, last_login_at, created_at, updated_at, COALESCE(common_name, '')
 		FROM users WHERE id = $1
 	`, key.UserID).Scan(
 		&user.ID, &user.ExternalID, &user.Provider, &user.Email, &user.Name,
-		&groupsJSON, &user.IsAdmin, &user.IsActive, &user.LastLoginAt, &user.CreatedAt, &user.UpdatedAt,
+		&groupsJSON, &user.IsAdmin, &user.IsActive, &user.LastLoginAt, &user.CreatedAt, &user.UpdatedAt, &user.CommonName,
 	)
 	if err == pgx.ErrNoRows {
 		return nil, nil, ErrUserNotFound
@@ -174,13 +180,14 @@ func (s *APIKeyStore) ValidateKey(ctx context.Context, keyHash string) (*APIKey,
 
 // ListByUser lists all API keys for a user
 func (s *APIKeyStore) ListByUser(ctx context.Context, userID string) ([]*APIKey, error) {
+	tenant, args := apiKeyTenantClause(ctx, "api_keys", []interface{}{userID})
 	rows, err := s.db.Pool.Query(ctx, `
 		SELECT id, user_id, name, description, key_hash, key_prefix, scopes,
 			is_admin_provisioned, provisioned_by, expires_at, last_used_at, last_used_ip::text,
 			is_revoked, revoked_at, revoked_by, revocation_reason, created_at, updated_at
-		FROM api_keys WHERE user_id = $1
+		FROM api_keys WHERE user_id = $1 AND `+tenant+`
 		ORDER BY created_at DESC
-	`, userID)
+	`, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -191,13 +198,15 @@ func (s *APIKeyStore) ListByUser(ctx context.Context, userID string) ([]*APIKey,
 
 // ListAll lists all API keys (admin function)
 func (s *APIKeyStore) ListAll(ctx context.Context) ([]*APIKey, error) {
+	tenant, args := apiKeyTenantClause(ctx, "api_keys", nil)
 	rows, err := s.db.Pool.Query(ctx, `
 		SELECT id, user_id, name, description, key_hash, key_prefix, scopes,
 			is_admin_provisioned, provisioned_by, expires_at, last_used_at, last_used_ip::text,
 			is_revoked, revoked_at, revoked_by, revocation_reason, created_at, updated_at
 		FROM api_keys
+		WHERE `+tenant+`
 		ORDER BY created_at DESC
-	`)
+	`, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -208,6 +217,7 @@ func (s *APIKeyStore) ListAll(ctx context.Context) ([]*APIKey, error) {
 
 // ListAllWithUserInfo lists all API keys with user information (for admin views)
 func (s *APIKeyStore) ListAllWithUserInfo(ctx context.Context) ([]*APIKeyWithUser, error) {
+	tenant, args := apiKeyTenantClause(ctx, "ak", nil)
 	rows, err := s.db.Pool.Query(ctx, `
 		SELECT ak.id, ak.user_id, ak.name, ak.description, ak.key_hash, ak.key_prefix, ak.scopes,
 			ak.is_admin_provisioned, ak.provisioned_by, ak.expires_at, ak.last_used_at, ak.last_used_ip::text,
@@ -217,8 +227,9 @@ func (s *APIKeyStore) ListAllWithUserInfo(ctx context.Context) ([]*APIKeyWithUse
 		FROM api_keys ak
 		LEFT JOIN users u ON ak.user_id = u.id
 		LEFT JOIN local_users lu ON ak.user_id = lu.id
+		WHERE `+tenant+`
 		ORDER BY ak.created_at DESC
-	`)
+	`, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -265,11 +276,11 @@ func (s *APIKeyStore) UpdateLastUsed(ctx context.Context, id, ip string) error {
 
 // Revoke revokes an API key
 func (s *APIKeyStore) Revoke(ctx context.Context, id, revokedBy, reason string) error {
+	tenant, args := apiKeyTenantClause(ctx, "api_keys", []interface{}{id, revokedBy, reason})
 	result, err := s.db.Pool.Exec(ctx, `
 		UPDATE api_keys
 		SET is_revoked = TRUE, revoked_at = NOW(), revoked_by = $2, revocation_reason = $3
-		WHERE id = $1 AND is_revoked = FALSE
-	`, id, revokedBy, reason)
+		WHERE id = $1 AND is_revoked = FALSE AND `+tenant, args...)
 	if err != nil {
 		return err
 	}
@@ -281,11 +292,11 @@ func (s *APIKeyStore) Revoke(ctx context.Context, id, revokedBy, reason string)
 
 // RevokeAllForUser revokes all API keys for a user
 func (s *APIKeyStore) RevokeAllForUser(ctx context.Context, userID, revokedBy, reason string) (int64, error) {
+	tenant, args := apiKeyTenantClause(ctx, "api_keys", []interface{}{userID, revokedBy, reason})
 	result, err := s.db.Pool.Exec(ctx, `
 		UPDATE api_keys
 		SET is_revoked = TRUE, revoked_at = NOW(), revoked_by = $2, revocation_reason = $3
-		WHERE user_id = $1 AND is_revoked = FALSE
-	`, userID, revokedBy, reason)
+		WHERE user_id = $1 AND is_revoked = FALSE AND `+tenant, args...)
 	if err != nil {
 		return 0, err
 	}
@@ -294,7 +305,8 @@ func (s *APIKeyStore) RevokeAllForUser(ctx context.Context, userID, revokedBy, r
 
 // Delete permanently deletes an API key
 func (s *APIKeyStore) Delete(ctx context.Context, id string) error {
-	result, err := s.db.Pool.Exec(ctx, `DELETE FROM api_keys WHERE id = $1`, id)
+	tenant, args := apiKeyTenantClause(ctx, "api_keys", []interface{}{id})
+	result, err := s.db.Pool.Exec(ctx, `DELETE FROM api_keys WHERE id = $1 AND `+tenant, args...)
 	if err != nil {
 		return err
 	}
@@ -330,7 +342,8 @@ func (s *APIKeyStore) DeleteRevokedKeys(ctx context.Context) (int64, error) {
 
 // DeleteAllForUser permanently deletes all API keys for a user
 func (s *APIKeyStore) DeleteAllForUser(ctx context.Context, userID string) (int64, error) {
-	result, err := s.db.Pool.Exec(ctx, `DELETE FROM api_keys WHERE user_id = $1`, userID)
+	tenant, args := apiKeyTenantClause(ctx, "api_keys", []interface{}{userID})
+	result, err := s.db.Pool.Exec(ctx, `DELETE FROM api_keys WHERE user_id = $1 AND `+tenant, args...)
 	if err != nil {
 		return 0, err
 	}
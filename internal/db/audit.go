@@ -0,0 +1,489 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/netip"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// auditChainLockKey serializes audit inserts so each record chains to the one
+// before it. It is an arbitrary constant for pg_advisory_xact_lock.
+const auditChainLockKey = 0x6761746b61756474
+
+// AuditEntry is an admin audit trail record. Hash covers every other field and
+// PrevHash, chaining the record to the one before it.
+type AuditEntry struct {
+	ID           string          `json:"id"`
+	Seq          int64           `json:"seq"`
+	TenantID     string          `json:"tenant_id,omitempty"`
+	Timestamp    time.Time       `json:"timestamp"`
+	Event        string          `json:"event"`
+	ActorID      string          `json:"actor_id,omitempty"`
+	ActorEmail   string          `json:"actor_email,omitempty"`
+	ActorIP      string          `json:"actor_ip,omitempty"`
+	ResourceType string          `json:"resource_type,omitempty"`
+	ResourceID   string          `json:"resource_id,omitempty"`
+	Details      json.RawMessage `json:"details,omitempty"`
+	Success      bool            `json:"success"`
+	PrevHash     string          `json:"prev_hash,omitempty"`
+	Hash         string          `json:"hash,omitempty"`
+}
+
+// AuditFilter provides filtering options for audit log queries
+type AuditFilter struct {
+	Event        string
+	ActorEmail   string
+	ResourceType string
+	StartTime    *time.Time
+	EndTime      *time.Time
+	Limit        int
+	Offset       int
+}
+
+// AuditAnchor is a CA-signed checkpoint of the chain head, so the chain up to it
+// can be trusted even if the database (and every hash in it) is rewritten.
+type AuditAnchor struct {
+	ID        string    `json:"id"`
+	Seq       int64     `json:"seq"`
+	Hash      string    `json:"hash"`
+	Signature string    `json:"signature"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AuditChainReport is the result of verifying the audit chain over a range.
+type AuditChainReport struct {
+	Valid     bool   `json:"valid"`
+	Checked   int    `json:"checked"`
+	Unchained int    `json:"unchained"` // Records written before chaining was enabled
+	FirstSeq  int64  `json:"first_seq,omitempty"`
+	LastSeq   int64  `json:"last_seq,omitempty"`
+	HeadHash  string `json:"head_hash,omitempty"`
+	BrokenAt  int64  `json:"broken_at,omitempty"` // Seq of the first record that fails
+	Reason    string `json:"reason,omitempty"`
+}
+
+// AuditStore handles audit log persistence
+type AuditStore struct {
+	db *DB
+}
+
+// NewAuditStore creates a new audit store
+func NewAuditStore(db *DB) *AuditStore {
+	return &AuditStore{db: db}
+}
+
+// Create appends an entry to the audit chain. Inserts are serialized with an
+// advisory lock so each one links to the current head.
+func (s *AuditStore) Create(ctx context.Context, entry *AuditEntry) error {
+	normalizeAuditEntry(entry)
+
+	tx, err := s.db.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock($1)`, int64(auditChainLockKey)); err != nil {
+		return err
+	}
+
+	var prevHash string
+	err = tx.QueryRow(ctx, `SELECT COALESCE(hash, '') FROM audit_logs ORDER BY seq DESC LIMIT 1`).Scan(&prevHash)
+	if err != nil && err != pgx.ErrNoRows {
+		return err
+	}
+
+	// The hash covers the seq and tenant, so both are settled before the insert.
+	// The record belongs to the tenant ctx is scoped to, or else the actor's.
+	tenantID, _ := TenantFromContext(ctx)
+	err = tx.QueryRow(ctx, `
+		SELECT nextval(pg_get_serial_sequence('audit_logs', 'seq')),
+		       COALESCE(NULLIF($1, '')::uuid, `+userTenantSQL("$2")+`)::text
+	`, tenantID, entry.ActorID).Scan(&entry.Seq, &entry.TenantID)
+	if err != nil {
+		return err
+	}
+	entry.PrevHash = prevHash
+	entry.Hash = AuditHash(prevHash, entry)
+
+	var details interface{}
+	if len(entry.Details) > 0 {
+		details = entry.Details
+	}
+	_, err = tx.Exec(ctx, `
+		INSERT INTO audit_logs (id, seq, timestamp, event, actor_id, actor_email, actor_ip, resource_type, resource_id, details, success, prev_hash, hash, tenant_id)
+		VALUES ($1, $2, $3, $4, NULLIF($5, '')::uuid, NULLIF($6, ''), NULLIF($7, '')::inet, NULLIF($8, ''), NULLIF($9, ''), $10, $11, NULLIF($12, ''), $13, $14::uuid)
+	`, entry.ID, entry.Seq, entry.Timestamp, entry.Event, entry.ActorID, entry.ActorEmail, entry.ActorIP,
+		entry.ResourceType, entry.ResourceID, details, entry.Success, entry.PrevHash, entry.Hash, entry.TenantID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// normalizeAuditEntry fills in the ID and timestamp and puts fields in the form
+// PostgreSQL returns them in, so the hash computed now matches the stored record.
+func normalizeAuditEntry(entry *AuditEntry) {
+	if entry.ID == "" {
+		entry.ID = uuid.New().String()
+	}
+	if entry.Timestamp.IsZero() {
+		entry.Timestamp = time.Now()
+	}
+	entry.Timestamp = entry.Timestamp.UTC().Truncate(time.Microsecond)
+	if _, err := uuid.Parse(entry.ActorID); err != nil {
+		entry.ActorID = ""
+	}
+	if addr, err := netip.ParseAddr(entry.ActorIP); err == nil {
+		entry.ActorIP = addr.Unmap().String()
+	} else {
+		entry.ActorIP = ""
+	}
+	entry.Details = canonicalJSON(entry.Details)
+}
+
+// canonicalJSON re-encodes JSON with sorted keys and no whitespace, since JSONB
+// doesn't preserve the original formatting.
+func canonicalJSON(raw json.RawMessage) json.RawMessage {
+	if len(bytes.TrimSpace(raw)) == 0 || bytes.Equal(bytes.TrimSpace(raw), []byte("null")) {
+		return nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil
+	}
+	out, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	return out
+}
+
+// AuditHash returns the chain hash of an entry: SHA-256 over the previous hash
+// and the entry's fields, each length-prefixed so field boundaries are
+// unambiguous. The hash covers the record's seq and tenant, so neither can be
+// changed without breaking the chain.
+func AuditHash(prevHash string, e *AuditEntry) string {
+	return auditHash(prevHash, e, true)
+}
+
+// legacyAuditHash is the chain hash of records written before hashes covered
+// seq and tenant.
+func legacyAuditHash(prevHash string, e *AuditEntry) string {
+	return auditHash(prevHash, e, false)
+}
+
+func auditHash(prevHash string, e *AuditEntry, withPlacement bool) string {
+	fields := []string{prevHash}
+	if withPlacement {
+		fields = append(fields, strconv.FormatInt(e.Seq, 10), e.TenantID)
+	}
+	h := sha256.New()
+	for _, field := range append(fields,
+		e.ID,
+		strconv.FormatInt(e.Timestamp.UnixMicro(), 10),
+		e.Event,
+		e.ActorID,
+		e.ActorEmail,
+		e.ActorIP,
+		e.ResourceType,
+		e.ResourceID,
+		string(canonicalJSON(e.Details)),
+		strconv.FormatBool(e.Success),
+	) {
+		h.Write([]byte(strconv.Itoa(len(field))))
+		h.Write([]byte{':'})
+		h.Write([]byte(field))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// List retrieves audit entries with optional filtering, newest first, within the
+// tenant in ctx if any
+func (s *AuditStore) List(ctx context.Context, filter *AuditFilter) ([]*AuditEntry, int, error) {
+	where := ""
+	args := []interface{}{}
+	argNum := 1
+
+	if filter.Event != "" {
+		where += ` AND event = $` + itoa(argNum)
+		args = append(args, filter.Event)
+		argNum++
+	}
+	if filter.ActorEmail != "" {
+		where += ` AND actor_email ILIKE $` + itoa(argNum)
+		args = append(args, "%"+filter.ActorEmail+"%")
+		argNum++
+	}
+	if filter.ResourceType != "" {
+		where += ` AND resource_type = $` + itoa(argNum)
+		args = append(args, filter.ResourceType)
+		argNum++
+	}
+	if filter.StartTime != nil {
+		where += ` AND timestamp >= $` + itoa(argNum)
+		args = append(args, *filter.StartTime)
+		argNum++
+	}
+	if filter.EndTime != nil {
+		where += ` AND timestamp <= $` + itoa(argNum)
+		args = append(args, *filter.EndTime)
+	}
+	tenant, args := tenantClause(ctx, "tenant_id", args)
+	where += ` AND ` + tenant
+	argNum = len(args) + 1
+
+	var total int
+	if err := s.db.Pool.QueryRow(ctx, `SELECT COUNT(*) FROM audit_logs WHERE 1=1`+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := auditSelect + where + ` ORDER BY seq DESC`
+	if filter.Limit > 0 {
+		query += ` LIMIT $` + itoa(argNum)
+		args = append(args, filter.Limit)
+		argNum++
+	}
+	if filter.Offset > 0 {
+		query += ` OFFSET $` + itoa(argNum)
+		args = append(args, filter.Offset)
+	}
+
+	var entries []*AuditEntry
+	err := s.query(ctx, query, args, func(e *AuditEntry) error {
+		entries = append(entries, e)
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return entries, total, nil
+}
+
+// ListEvents returns every audit entry with one of the given events, oldest
+// first, within the tenant in ctx if any
+func (s *AuditStore) ListEvents(ctx context.Context, events []string) ([]*AuditEntry, error) {
+	var entries []*AuditEntry
+	tenant, args := tenantClause(ctx, "tenant_id", []interface{}{events})
+	err := s.query(ctx, auditSelect+` AND event = ANY($1) AND `+tenant+` ORDER BY seq`, args, func(e *AuditEntry) error {
+		entries = append(entries, e)
+		return nil
+	})
+	return entries, err
+}
+
+// VerifyChain recomputes the hash of every record with seq in [fromSeq, toSeq]
+// (toSeq 0 means up to the head) and checks each links to the one before it.
+// The first record in the range is trusted to link correctly to its predecessor.
+func (s *AuditStore) VerifyChain(ctx context.Context, fromSeq, toSeq int64) (*AuditChainReport, error) {
+	query := auditSelect + ` AND seq >= $1`
+	args := []interface{}{fromSeq}
+	if toSeq > 0 {
+		query += ` AND seq <= $2`
+		args = append(args, toSeq)
+	}
+	query += ` ORDER BY seq`
+
+	v := NewAuditChainVerifier()
+	if err := s.query(ctx, query, args, func(e *AuditEntry) error {
+		v.Add(e)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return v.Report(), nil
+}
+
+// SeqRange returns the first and last seq of records in a time range (either
+// bound may be nil), or zeros if there are none.
+func (s *AuditStore) SeqRange(ctx context.Context, start, end *time.Time) (int64, int64, error) {
+	var first, last int64
+	err := s.db.Pool.QueryRow(ctx, `
+		SELECT COALESCE(MIN(seq), 0), COALESCE(MAX(seq), 0) FROM audit_logs
+		WHERE ($1::timestamptz IS NULL OR timestamp >= $1) AND ($2::timestamptz IS NULL OR timestamp <= $2)
+	`, start, end).Scan(&first, &last)
+	return first, last, err
+}
+
+// Head returns the latest chained record's seq and hash, or zero values if the
+// chain is empty.
+func (s *AuditStore) Head(ctx context.Context) (int64, string, error) {
+	var seq int64
+	var hash string
+	err := s.db.Pool.QueryRow(ctx, `
+		SELECT seq, hash FROM audit_logs WHERE hash IS NOT NULL ORDER BY seq DESC LIMIT 1
+	`).Scan(&seq, &hash)
+	if err == pgx.ErrNoRows {
+		return 0, "", nil
+	}
+	return seq, hash, err
+}
+
+// HashAt returns the stored hash of the record with the given seq.
+func (s *AuditStore) HashAt(ctx context.Context, seq int64) (string, error) {
+	var hash string
+	err := s.db.Pool.QueryRow(ctx, `SELECT COALESCE(hash, '') FROM audit_logs WHERE seq = $1`, seq).Scan(&hash)
+	if err == pgx.ErrNoRows {
+		return "", nil
+	}
+	return hash, err
+}
+
+// CreateAnchor stores a signed checkpoint of the chain head.
+func (s *AuditStore) CreateAnchor(ctx context.Context, anchor *AuditAnchor) error {
+	return s.db.Pool.QueryRow(ctx, `
+		INSERT INTO audit_anchors (seq, hash, signature) VALUES ($1, $2, $3)
+		RETURNING id, created_at
+	`, anchor.Seq, anchor.Hash, anchor.Signature).Scan(&anchor.ID, &anchor.CreatedAt)
+}
+
+// LatestAnchor returns the most recent anchor, or nil if there is none.
+func (s *AuditStore) LatestAnchor(ctx context.Context) (*AuditAnchor, error) {
+	var a AuditAnchor
+	err := s.db.Pool.QueryRow(ctx, `
+		SELECT id, seq, hash, signature, created_at FROM audit_anchors
+		ORDER BY seq DESC, created_at DESC LIMIT 1
+	`).Scan(&a.ID, &a.Seq, &a.Hash, &a.Signature, &a.CreatedAt)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// ListAnchors returns anchors with seq in [fromSeq, toSeq] (toSeq 0 means no upper
+// bound), oldest first.
+func (s *AuditStore) ListAnchors(ctx context.Context, fromSeq, toSeq int64) ([]*AuditAnchor, error) {
+	rows, err := s.db.Pool.Query(ctx, `
+		SELECT id, seq, hash, signature, created_at FROM audit_anchors
+		WHERE seq >= $1 AND ($2 = 0 OR seq <= $2)
+		ORDER BY seq, created_at
+	`, fromSeq, toSeq)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var anchors []*AuditAnchor
+	for rows.Next() {
+		var a AuditAnchor
+		if err := rows.Scan(&a.ID, &a.Seq, &a.Hash, &a.Signature, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		anchors = append(anchors, &a)
+	}
+	return anchors, rows.Err()
+}
+
+const auditSelect = `
+		SELECT id, seq, tenant_id::text, timestamp, event, COALESCE(actor_id::text, ''), COALESCE(actor_email, ''),
+		       COALESCE(host(actor_ip), ''), COALESCE(resource_type, ''), COALESCE(resource_id, ''),
+		       details, success, COALESCE(prev_hash, ''), COALESCE(hash, '')
+		FROM audit_logs
+		WHERE 1=1
+	`
+
+// query runs an audit query and calls fn for each row.
+func (s *AuditStore) query(ctx context.Context, query string, args []interface{}, fn func(*AuditEntry) error) error {
+	rows, err := s.db.Pool.Query(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e AuditEntry
+		var details []byte
+		if err := rows.Scan(
+			&e.ID, &e.Seq, &e.TenantID, &e.Timestamp, &e.Event, &e.ActorID, &e.ActorEmail,
+			&e.ActorIP, &e.ResourceType, &e.ResourceID, &details, &e.Success, &e.PrevHash, &e.Hash,
+		); err != nil {
+			return err
+		}
+		e.Timestamp = e.Timestamp.UTC()
+		e.Details = details
+		if err := fn(&e); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// AuditChainVerifier checks audit entries fed to it in seq order.
+type AuditChainVerifier struct {
+	report   AuditChainReport
+	prevHash string
+	started  bool
+	current  bool // A record hashed with AuditHash has been seen
+}
+
+// NewAuditChainVerifier creates a verifier for a run of consecutive entries.
+func NewAuditChainVerifier() *AuditChainVerifier {
+	return &AuditChainVerifier{report: AuditChainReport{Valid: true}}
+}
+
+// Add checks the next entry. After the first failure further entries are ignored.
+func (v *AuditChainVerifier) Add(e *AuditEntry) {
+	if !v.report.Valid {
+		return
+	}
+	if v.report.FirstSeq == 0 {
+		v.report.FirstSeq = e.Seq
+	}
+	v.report.LastSeq = e.Seq
+
+	if e.Hash == "" {
+		// Records from before chaining was enabled come first; a gap later on
+		// means a chained record was altered
+		if v.started {
+			v.fail(e.Seq, "record has no hash")
+			return
+		}
+		v.report.Unchained++
+		return
+	}
+
+	if v.started && e.PrevHash != v.prevHash {
+		v.fail(e.Seq, "previous hash does not match the preceding record")
+		return
+	}
+	// Records from before hashes covered seq and tenant come first too, and
+	// once one hashed with them is seen, every later one must be
+	switch {
+	case AuditHash(e.PrevHash, e) == e.Hash:
+		v.current = true
+	case v.current || legacyAuditHash(e.PrevHash, e) != e.Hash:
+		v.fail(e.Seq, "record contents do not match its hash")
+		return
+	}
+
+	v.started = true
+	v.prevHash = e.Hash
+	v.report.Checked++
+	v.report.HeadHash = e.Hash
+}
+
+func (v *AuditChainVerifier) fail(seq int64, reason string) {
+	v.report.Valid = false
+	v.report.BrokenAt = seq
+	v.report.Reason = reason
+}
+
+// Report returns the verification result so far.
+func (v *AuditChainVerifier) Report() *AuditChainReport {
+	report := v.report
+	return &report
+}
@@ -0,0 +1,120 @@
+package db
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestAuditChainVerifier(t *testing.T) {
+	var entries []*AuditEntry
+	prev := ""
+	for i, event := range []string{"gateway.create", "settings.update", "gateway.delete"} {
+		e := &AuditEntry{
+			Seq:        int64(i + 1),
+			TenantID:   DefaultTenantID,
+			Event:      event,
+			ActorEmail: "admin@example.com",
+			ActorIP:    "192.0.2.1",
+			Details:    json.RawMessage(`{"b": 2, "a": "x"}`),
+			Success:    true,
+			Timestamp:  time.Date(2026, 1, 1, 0, 0, i, 0, time.UTC),
+		}
+		normalizeAuditEntry(e)
+		e.PrevHash = prev
+		e.Hash = AuditHash(prev, e)
+		prev = e.Hash
+		entries = append(entries, e)
+	}
+
+	verify := func(entries []*AuditEntry) *AuditChainReport {
+		v := NewAuditChainVerifier()
+		for _, e := range entries {
+			v.Add(e)
+		}
+		return v.Report()
+	}
+
+	if r := verify(entries); !r.Valid || r.Checked != 3 || r.HeadHash != entries[2].Hash {
+		t.Fatalf("intact chain: got %+v", r)
+	}
+
+	// JSONB reformats details; the hash must not depend on formatting
+	reformatted := *entries[1]
+	reformatted.Details = json.RawMessage(`{"a":"x","b":2}`)
+	if r := verify([]*AuditEntry{entries[0], &reformatted, entries[2]}); !r.Valid {
+		t.Errorf("reformatted details: got %+v", r)
+	}
+
+	tampered := *entries[1]
+	tampered.ActorEmail = "someone@example.com"
+	if r := verify([]*AuditEntry{entries[0], &tampered, entries[2]}); r.Valid || r.BrokenAt != 2 {
+		t.Errorf("tampered record: got %+v", r)
+	}
+
+	if r := verify([]*AuditEntry{entries[0], entries[2]}); r.Valid || r.BrokenAt != 3 {
+		t.Errorf("deleted record: got %+v", r)
+	}
+
+	// A record can't be moved to another tenant or renumbered
+	moved := *entries[1]
+	moved.TenantID = "5f0c6a4e-8d2b-4c1e-9f3a-2b7d6e1c0a9f"
+	if r := verify([]*AuditEntry{entries[0], &moved, entries[2]}); r.Valid || r.BrokenAt != 2 {
+		t.Errorf("record moved to another tenant: got %+v", r)
+	}
+	renumbered := *entries[1]
+	renumbered.Seq = 7
+	if r := verify([]*AuditEntry{entries[0], &renumbered, entries[2]}); r.Valid || r.BrokenAt != 7 {
+		t.Errorf("renumbered record: got %+v", r)
+	}
+}
+
+func TestAuditChainVerifierLegacyHashes(t *testing.T) {
+	entry := func(seq int64, prev string, legacy bool) *AuditEntry {
+		e := &AuditEntry{
+			Seq:       seq,
+			TenantID:  DefaultTenantID,
+			Event:     "settings.update",
+			Success:   true,
+			Timestamp: time.Date(2026, 1, 1, 0, 0, int(seq), 0, time.UTC),
+		}
+		normalizeAuditEntry(e)
+		e.PrevHash = prev
+		if legacy {
+			e.Hash = legacyAuditHash(prev, e)
+		} else {
+			e.Hash = AuditHash(prev, e)
+		}
+		return e
+	}
+	verify := func(entries ...*AuditEntry) *AuditChainReport {
+		v := NewAuditChainVerifier()
+		for _, e := range entries {
+			v.Add(e)
+		}
+		return v.Report()
+	}
+
+	// Records hashed before seq and tenant were covered still verify
+	first := entry(1, "", true)
+	second := entry(2, first.Hash, false)
+	if r := verify(first, second); !r.Valid || r.Checked != 2 {
+		t.Errorf("legacy then current records: got %+v", r)
+	}
+
+	// but not after a record hashed with them
+	third := entry(3, second.Hash, true)
+	if r := verify(first, second, third); r.Valid || r.BrokenAt != 3 {
+		t.Errorf("legacy record after a current one: got %+v", r)
+	}
+}
+
+func TestNormalizeAuditEntryKeepsResourceIDs(t *testing.T) {
+	for _, id := range []string{"engineering", "ab:cd:ef:01", "5f0c6a4e-8d2b-4c1e-9f3a-2b7d6e1c0a9f"} {
+		e := &AuditEntry{Event: "group.update", ResourceType: "group", ResourceID: id}
+		normalizeAuditEntry(e)
+		if e.ResourceID != id {
+			t.Errorf("ResourceID %q normalized to %q", id, e.ResourceID)
+		}
+	}
+}
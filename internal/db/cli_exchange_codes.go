@@ -0,0 +1,53 @@
+package db
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrExchangeCodeInvalid is returned when a CLI exchange code is unknown, expired
+// or already used. The cases aren't distinguished to callers.
+var ErrExchangeCodeInvalid = errors.New("invalid or expired code")
+
+// hashExchangeCode returns the stored form of a CLI exchange code.
+func hashExchangeCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// SaveCLIExchangeCode stores a single-use code the CLI can exchange for a session
+// token until expiresAt.
+func (s *StateStore) SaveCLIExchangeCode(ctx context.Context, code, sessionToken string, expiresAt time.Time) error {
+	_, err := s.db.Pool.Exec(ctx, `
+		INSERT INTO cli_exchange_codes (code_hash, session_token, expires_at)
+		VALUES ($1, $2, $3)
+	`, hashExchangeCode(code), sessionToken, expiresAt)
+	return err
+}
+
+// RedeemCLIExchangeCode returns the session token for a code and deletes the
+// code, so it can only be redeemed once.
+func (s *StateStore) RedeemCLIExchangeCode(ctx context.Context, code string) (string, error) {
+	var sessionToken string
+	var expiresAt time.Time
+	err := s.db.Pool.QueryRow(ctx, `
+		DELETE FROM cli_exchange_codes
+		WHERE code_hash = $1
+		RETURNING session_token, expires_at
+	`, hashExchangeCode(code)).Scan(&sessionToken, &expiresAt)
+	if err == pgx.ErrNoRows {
+		return "", ErrExchangeCodeInvalid
+	}
+	if err != nil {
+		return "", err
+	}
+	if time.Now().After(expiresAt) {
+		return "", ErrExchangeCodeInvalid
+	}
+	return sessionToken, nil
+}
@@ -32,8 +32,19 @@ type GeneratedConfig struct {
 	ExpiresAt      time.Time
 	CreatedAt      time.Time
 	DownloadedAt   *time.Time
+	LastUsedAt     *time.Time // Last successful gateway verification
+	TunnelMode     string     // TunnelModeFull or TunnelModeSplit if the user chose one, otherwise ""
+	DeviceName     string     // Device the config is for, as given by the client
+	DeviceOS       string     // Operating system of that device
+	Purpose        string     // Why the config was generated, as given by the user
 }
 
+// Tunnel modes a user can choose for a config on gateways that allow it
+const (
+	TunnelModeFull  = "full"
+	TunnelModeSplit = "split"
+)
+
 // ConfigStore handles generated config persistence
 type ConfigStore struct {
 	db *DB
@@ -44,32 +55,49 @@ func NewConfigStore(db *DB) *ConfigStore {
 	return &ConfigStore{db: db}
 }
 
+// configTenantClause restricts configs, in the table or alias given, to the
+// tenant ctx is scoped to. Configs belong to their user's tenant.
+func configTenantClause(ctx context.Context, table string, args []interface{}) (string, []interface{}) {
+	return tenantClause(ctx, userTenantSQL(table+".user_id"), args)
+}
+
 // SaveConfig stores a generated config
 func (s *ConfigStore) SaveConfig(ctx context.Context, config *GeneratedConfig) error {
-	_, err := s.db.Pool.Exec(ctx, `
-		INSERT INTO generated_configs (id, user_id, gateway_id, gateway_name, file_name, config_data, serial_number, fingerprint, cli_callback_url, auth_token, expires_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
-	`, config.ID, config.UserID, config.GatewayID, config.GatewayName, config.FileName, config.ConfigData, config.SerialNumber, config.Fingerprint, config.CLICallbackURL, config.AuthToken, config.ExpiresAt)
+	configData, err := s.db.sealBytes(config.ConfigData)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Pool.Exec(ctx, `
+		INSERT INTO generated_configs (id, user_id, gateway_id, gateway_name, file_name, config_data, serial_number, fingerprint, cli_callback_url, auth_token, expires_at, tunnel_mode,
+		                               device_name, device_os, purpose)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NULLIF($10, ''), $11, $12, $13, $14, $15)
+	`, config.ID, config.UserID, config.GatewayID, config.GatewayName, config.FileName, configData, config.SerialNumber, config.Fingerprint, config.CLICallbackURL, config.AuthToken, config.ExpiresAt, config.TunnelMode,
+		config.DeviceName, config.DeviceOS, config.Purpose)
 	return err
 }
 
 // GetConfig retrieves a config by ID
 func (s *ConfigStore) GetConfig(ctx context.Context, id string) (*GeneratedConfig, error) {
 	var config GeneratedConfig
+	tenant, args := configTenantClause(ctx, "generated_configs", []interface{}{id})
 	err := s.db.Pool.QueryRow(ctx, `
 		SELECT id, user_id, gateway_id, gateway_name, file_name, config_data, serial_number, fingerprint, cli_callback_url,
-		       COALESCE(auth_token, ''), is_revoked, revoked_at, COALESCE(revoked_reason, ''), expires_at, created_at, downloaded_at
+		       COALESCE(auth_token, ''), is_revoked, revoked_at, COALESCE(revoked_reason, ''), expires_at, created_at, downloaded_at,
+		       device_name, device_os, purpose
 		FROM generated_configs
-		WHERE id = $1
-	`, id).Scan(&config.ID, &config.UserID, &config.GatewayID, &config.GatewayName, &config.FileName, &config.ConfigData,
+		WHERE id = $1 AND `+tenant, args...).Scan(&config.ID, &config.UserID, &config.GatewayID, &config.GatewayName, &config.FileName, &config.ConfigData,
 		&config.SerialNumber, &config.Fingerprint, &config.CLICallbackURL, &config.AuthToken, &config.IsRevoked,
-		&config.RevokedAt, &config.RevokedReason, &config.ExpiresAt, &config.CreatedAt, &config.DownloadedAt)
+		&config.RevokedAt, &config.RevokedReason, &config.ExpiresAt, &config.CreatedAt, &config.DownloadedAt,
+		&config.DeviceName, &config.DeviceOS, &config.Purpose)
 	if err == pgx.ErrNoRows {
 		return nil, ErrConfigNotFound
 	}
 	if err != nil {
 		return nil, err
 	}
+	if config.ConfigData, err = s.db.openBytes(config.ConfigData); err != nil {
+		return nil, err
+	}
 
 	// Check if expired
 	if time.Now().After(config.ExpiresAt) {
@@ -93,15 +121,63 @@ func (s *ConfigStore) MarkDownloaded(ctx context.Context, id string) error {
 	return nil
 }
 
+// usageWriteInterval is how stale a last-used timestamp must be before it is
+// updated again, so clients that reconnect often don't write on every verify.
+const usageWriteInterval = "5 minutes"
+
+// MarkUsed records that a config passed gateway verification.
+func (s *ConfigStore) MarkUsed(ctx context.Context, id string) error {
+	_, err := s.db.Pool.Exec(ctx, `
+		UPDATE generated_configs SET last_used_at = NOW()
+		WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '`+usageWriteInterval+`')
+	`, id)
+	return err
+}
+
+// ListUnusedConfigs returns unexpired, unrevoked configs created before cutoff
+// that haven't been used since, with user info, oldest first.
+func (s *ConfigStore) ListUnusedConfigs(ctx context.Context, cutoff time.Time) ([]*ConfigWithUser, error) {
+	tenant, args := configTenantClause(ctx, "gc", []interface{}{cutoff})
+	rows, err := s.db.Pool.Query(ctx, `
+		SELECT gc.id, gc.user_id, gc.gateway_id, gc.gateway_name, gc.file_name, gc.expires_at, gc.created_at, gc.downloaded_at, gc.last_used_at,
+		       COALESCE(u.email, lu.email, gc.user_id) as user_email,
+		       COALESCE(u.name, lu.username, '') as user_name
+		FROM generated_configs gc
+		LEFT JOIN users u ON gc.user_id = u.id::text
+		LEFT JOIN local_users lu ON gc.user_id = lu.id::text
+		WHERE NOT gc.is_revoked AND gc.expires_at > NOW() AND gc.created_at < $1
+		  AND (gc.last_used_at IS NULL OR gc.last_used_at < $1) AND `+tenant+`
+		ORDER BY COALESCE(gc.last_used_at, gc.created_at)
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var configs []*ConfigWithUser
+	for rows.Next() {
+		var config ConfigWithUser
+		if err := rows.Scan(&config.ID, &config.UserID, &config.GatewayID, &config.GatewayName, &config.FileName,
+			&config.ExpiresAt, &config.CreatedAt, &config.DownloadedAt, &config.LastUsedAt,
+			&config.UserEmail, &config.UserName); err != nil {
+			return nil, err
+		}
+		configs = append(configs, &config)
+	}
+	return configs, rows.Err()
+}
+
 // GetUserConfigs retrieves all configs for a user (including revoked ones)
 func (s *ConfigStore) GetUserConfigs(ctx context.Context, userID string) ([]*GeneratedConfig, error) {
+	tenant, args := configTenantClause(ctx, "generated_configs", []interface{}{userID})
 	rows, err := s.db.Pool.Query(ctx, `
 		SELECT id, user_id, gateway_id, gateway_name, file_name, serial_number, fingerprint, cli_callback_url,
-		       is_revoked, revoked_at, COALESCE(revoked_reason, ''), expires_at, created_at, downloaded_at
+		       is_revoked, revoked_at, COALESCE(revoked_reason, ''), expires_at, created_at, downloaded_at, last_used_at,
+		       device_name, device_os, purpose
 		FROM generated_configs
-		WHERE user_id = $1 AND expires_at > NOW()
+		WHERE user_id = $1 AND expires_at > NOW() AND `+tenant+`
 		ORDER BY created_at DESC
-	`, userID)
+	`, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -112,7 +188,8 @@ func (s *ConfigStore) GetUserConfigs(ctx context.Context, userID string) ([]*Gen
 		var config GeneratedConfig
 		if err := rows.Scan(&config.ID, &config.UserID, &config.GatewayID, &config.GatewayName, &config.FileName,
 			&config.SerialNumber, &config.Fingerprint, &config.CLICallbackURL, &config.IsRevoked,
-			&config.RevokedAt, &config.RevokedReason, &config.ExpiresAt, &config.CreatedAt, &config.DownloadedAt); err != nil {
+			&config.RevokedAt, &config.RevokedReason, &config.ExpiresAt, &config.CreatedAt, &config.DownloadedAt, &config.LastUsedAt,
+			&config.DeviceName, &config.DeviceOS, &config.Purpose); err != nil {
 			return nil, err
 		}
 		configs = append(configs, &config)
@@ -140,18 +217,23 @@ func (s *ConfigStore) GetConfigBySerial(ctx context.Context, serial string) (*Ge
 	var config GeneratedConfig
 	err := s.db.Pool.QueryRow(ctx, `
 		SELECT id, user_id, gateway_id, gateway_name, file_name, config_data, serial_number, fingerprint, cli_callback_url,
-		       COALESCE(auth_token, ''), is_revoked, revoked_at, COALESCE(revoked_reason, ''), expires_at, created_at, downloaded_at
+		       COALESCE(auth_token, ''), is_revoked, revoked_at, COALESCE(revoked_reason, ''), expires_at, created_at, downloaded_at, tunnel_mode,
+		       device_name, device_os, purpose
 		FROM generated_configs
 		WHERE serial_number = $1
 	`, serial).Scan(&config.ID, &config.UserID, &config.GatewayID, &config.GatewayName, &config.FileName, &config.ConfigData,
 		&config.SerialNumber, &config.Fingerprint, &config.CLICallbackURL, &config.AuthToken, &config.IsRevoked,
-		&config.RevokedAt, &config.RevokedReason, &config.ExpiresAt, &config.CreatedAt, &config.DownloadedAt)
+		&config.RevokedAt, &config.RevokedReason, &config.ExpiresAt, &config.CreatedAt, &config.DownloadedAt, &config.TunnelMode,
+		&config.DeviceName, &config.DeviceOS, &config.Purpose)
 	if err == pgx.ErrNoRows {
 		return nil, ErrConfigNotFound
 	}
 	if err != nil {
 		return nil, err
 	}
+	if config.ConfigData, err = s.db.openBytes(config.ConfigData); err != nil {
+		return nil, err
+	}
 	return &config, nil
 }
 
@@ -189,11 +271,11 @@ func (s *ConfigStore) GetConfigByAuthToken(ctx context.Context, authToken string
 
 // RevokeConfig revokes a config by ID
 func (s *ConfigStore) RevokeConfig(ctx context.Context, id string, reason string) error {
+	tenant, args := configTenantClause(ctx, "generated_configs", []interface{}{id, reason})
 	result, err := s.db.Pool.Exec(ctx, `
 		UPDATE generated_configs
 		SET is_revoked = TRUE, revoked_at = NOW(), revoked_reason = $2
-		WHERE id = $1 AND is_revoked = FALSE
-	`, id, reason)
+		WHERE id = $1 AND is_revoked = FALSE AND `+tenant, args...)
 	if err != nil {
 		return err
 	}
@@ -205,11 +287,11 @@ func (s *ConfigStore) RevokeConfig(ctx context.Context, id string, reason string
 
 // RevokeUserConfigs revokes all configs for a user
 func (s *ConfigStore) RevokeUserConfigs(ctx context.Context, userID string, reason string) (int64, error) {
+	tenant, args := configTenantClause(ctx, "generated_configs", []interface{}{userID, reason})
 	result, err := s.db.Pool.Exec(ctx, `
 		UPDATE generated_configs
 		SET is_revoked = TRUE, revoked_at = NOW(), revoked_reason = $2
-		WHERE user_id = $1 AND is_revoked = FALSE AND expires_at > NOW()
-	`, userID, reason)
+		WHERE user_id = $1 AND is_revoked = FALSE AND expires_at > NOW() AND `+tenant, args...)
 	if err != nil {
 		return 0, err
 	}
@@ -255,22 +337,26 @@ type ConfigWithUser struct {
 func (s *ConfigStore) GetAllConfigs(ctx context.Context, limit, offset int) ([]*ConfigWithUser, int, error) {
 	// Get total count
 	var total int
-	err := s.db.Pool.QueryRow(ctx, `SELECT COUNT(*) FROM generated_configs`).Scan(&total)
+	tenant, args := configTenantClause(ctx, "gc", nil)
+	err := s.db.Pool.QueryRow(ctx, `SELECT COUNT(*) FROM generated_configs gc WHERE `+tenant, args...).Scan(&total)
 	if err != nil {
 		return nil, 0, err
 	}
+	args = append(args, limit, offset)
 
 	rows, err := s.db.Pool.Query(ctx, `
 		SELECT gc.id, gc.user_id, gc.gateway_id, gc.gateway_name, gc.file_name, gc.serial_number, gc.fingerprint,
-		       gc.is_revoked, gc.revoked_at, COALESCE(gc.revoked_reason, ''), gc.expires_at, gc.created_at, gc.downloaded_at,
+		       gc.is_revoked, gc.revoked_at, COALESCE(gc.revoked_reason, ''), gc.expires_at, gc.created_at, gc.downloaded_at, gc.last_used_at,
+		       gc.device_name, gc.device_os, gc.purpose,
 		       COALESCE(u.email, lu.email, gc.user_id) as user_email,
 		       COALESCE(u.name, lu.username, '') as user_name
 		FROM generated_configs gc
 		LEFT JOIN users u ON gc.user_id = u.id::text
 		LEFT JOIN local_users lu ON gc.user_id = lu.id::text
+		WHERE `+tenant+`
 		ORDER BY gc.created_at DESC
-		LIMIT $1 OFFSET $2
-	`, limit, offset)
+		LIMIT $`+itoa(len(args)-1)+` OFFSET $`+itoa(len(args))+`
+	`, args...)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -281,7 +367,8 @@ func (s *ConfigStore) GetAllConfigs(ctx context.Context, limit, offset int) ([]*
 		var config ConfigWithUser
 		if err := rows.Scan(&config.ID, &config.UserID, &config.GatewayID, &config.GatewayName, &config.FileName,
 			&config.SerialNumber, &config.Fingerprint, &config.IsRevoked,
-			&config.RevokedAt, &config.RevokedReason, &config.ExpiresAt, &config.CreatedAt, &config.DownloadedAt,
+			&config.RevokedAt, &config.RevokedReason, &config.ExpiresAt, &config.CreatedAt, &config.DownloadedAt, &config.LastUsedAt,
+			&config.DeviceName, &config.DeviceOS, &config.Purpose,
 			&config.UserEmail, &config.UserName); err != nil {
 			return nil, 0, err
 		}
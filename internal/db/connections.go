@@ -0,0 +1,248 @@
+package db
+
+import (
+	"context"
+	"time"
+)
+
+// ConnectionRecord is a VPN connection reported by a gateway, with the user's email
+// and gateway name joined in.
+type ConnectionRecord struct {
+	ID               string     `json:"id"`
+	UserID           string     `json:"user_id"`
+	UserEmail        string     `json:"user_email"`
+	GatewayID        string     `json:"gateway_id"`
+	GatewayName      string     `json:"gateway_name"`
+	ClientIP         string     `json:"client_ip"`
+	VPNIPv4          string     `json:"vpn_ipv4"`
+	BytesSent        int64      `json:"bytes_sent"`
+	BytesReceived    int64      `json:"bytes_received"`
+	ConnectedAt      time.Time  `json:"connected_at"`
+	DisconnectedAt   *time.Time `json:"disconnected_at,omitempty"`
+	DisconnectReason string     `json:"disconnect_reason,omitempty"`
+	TunnelMode       string     `json:"tunnel_mode,omitempty"` // TunnelModeFull or TunnelModeSplit
+}
+
+// Duration returns how long the connection lasted, or has lasted so far if it's
+// still active.
+func (r *ConnectionRecord) Duration(now time.Time) time.Duration {
+	end := now
+	if r.DisconnectedAt != nil {
+		end = *r.DisconnectedAt
+	}
+	return end.Sub(r.ConnectedAt)
+}
+
+// ConnectionFilter provides filtering options for connection queries
+type ConnectionFilter struct {
+	GatewayID string
+	UserID    string
+	UserEmail string
+	Active    *bool // true for open connections, false for closed ones
+	StartTime *time.Time
+	EndTime   *time.Time
+	Limit     int
+	Offset    int
+}
+
+// ConnectionStore handles VPN connection history persistence
+type ConnectionStore struct {
+	db *DB
+}
+
+// NewConnectionStore creates a new connection store
+func NewConnectionStore(db *DB) *ConnectionStore {
+	return &ConnectionStore{db: db}
+}
+
+// RecordConnect records a new open connection, with the tunnel mode pushed to
+// it, and returns its ID.
+func (s *ConnectionStore) RecordConnect(ctx context.Context, userID, gatewayID, clientIP, vpnIPv4, vpnIPv6, tunnelMode string) (string, error) {
+	return recordConnect(ctx, s.db.Pool, userID, gatewayID, clientIP, vpnIPv4, vpnIPv6, tunnelMode)
+}
+
+func recordConnect(ctx context.Context, q querier, userID, gatewayID, clientIP, vpnIPv4, vpnIPv6, tunnelMode string) (string, error) {
+	var id string
+	err := q.QueryRow(ctx, `
+		INSERT INTO connections (user_id, gateway_id, client_ip, vpn_ipv4, vpn_ipv6, tunnel_mode)
+		VALUES ($1, $2, NULLIF($3, '')::inet, NULLIF($4, '')::inet, NULLIF($5, '')::inet, $6)
+		RETURNING id
+	`, userID, gatewayID, clientIP, vpnIPv4, vpnIPv6, tunnelMode).Scan(&id)
+	return id, err
+}
+
+// CountActive returns how many open connections a user has across all gateways.
+func (s *ConnectionStore) CountActive(ctx context.Context, userID string) (int, error) {
+	var count int
+	err := s.db.Pool.QueryRow(ctx, `
+		SELECT COUNT(*) FROM connections WHERE user_id = $1 AND disconnected_at IS NULL
+	`, userID).Scan(&count)
+	return count, err
+}
+
+// LastConnectedAt returns when each user last connected through any of the given
+// gateways, keyed by user ID.
+func (s *ConnectionStore) LastConnectedAt(ctx context.Context, gatewayIDs []string) (map[string]time.Time, error) {
+	rows, err := s.db.Pool.Query(ctx, `
+		SELECT user_id::text, MAX(connected_at) FROM connections
+		WHERE gateway_id::text = ANY($1) AND user_id IS NOT NULL
+		GROUP BY user_id
+	`, gatewayIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	last := make(map[string]time.Time)
+	for rows.Next() {
+		var userID string
+		var connectedAt time.Time
+		if err := rows.Scan(&userID, &connectedAt); err != nil {
+			return nil, err
+		}
+		last[userID] = connectedAt
+	}
+	return last, rows.Err()
+}
+
+// RecordDisconnect closes the most recent open connection for the user on the
+// gateway from the given client IP (any IP if empty).
+func (s *ConnectionStore) RecordDisconnect(ctx context.Context, userID, gatewayID, clientIP string, bytesSent, bytesReceived int64, reason string) error {
+	_, err := s.db.Pool.Exec(ctx, `
+		UPDATE connections SET
+			disconnected_at = NOW(),
+			bytes_sent = $4,
+			bytes_received = $5,
+			disconnect_reason = NULLIF($6, '')
+		WHERE id = (
+			SELECT id FROM connections
+			WHERE user_id = $1 AND gateway_id = $2 AND disconnected_at IS NULL
+			  AND ($3 = '' OR host(client_ip) = $3)
+			ORDER BY connected_at DESC
+			LIMIT 1
+		)
+	`, userID, gatewayID, clientIP, bytesSent, bytesReceived, reason)
+	return err
+}
+
+// List retrieves connections with optional filtering, newest first
+func (s *ConnectionStore) List(ctx context.Context, filter *ConnectionFilter) ([]*ConnectionRecord, int, error) {
+	where, args := connectionConditions(ctx, filter)
+	argNum := len(args) + 1
+
+	var total int
+	err := s.db.Pool.QueryRow(ctx, `
+		SELECT COUNT(*) FROM connections c
+		LEFT JOIN users u ON u.id = c.user_id
+		WHERE 1=1`+where, args...).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	query := connectionSelect + where + ` ORDER BY c.connected_at DESC`
+	if filter.Limit > 0 {
+		query += ` LIMIT $` + itoa(argNum)
+		args = append(args, filter.Limit)
+		argNum++
+	}
+	if filter.Offset > 0 {
+		query += ` OFFSET $` + itoa(argNum)
+		args = append(args, filter.Offset)
+	}
+
+	var records []*ConnectionRecord
+	err = s.query(ctx, query, args, func(r *ConnectionRecord) error {
+		records = append(records, r)
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return records, total, nil
+}
+
+// Each calls fn for every connection matching the filter, newest first, without
+// loading the whole result into memory. Limit and Offset are ignored.
+func (s *ConnectionStore) Each(ctx context.Context, filter *ConnectionFilter, fn func(*ConnectionRecord) error) error {
+	where, args := connectionConditions(ctx, filter)
+	return s.query(ctx, connectionSelect+where+` ORDER BY c.connected_at DESC`, args, fn)
+}
+
+const connectionSelect = `
+		SELECT c.id, COALESCE(c.user_id::text, ''), COALESCE(u.email, ''),
+		       COALESCE(c.gateway_id::text, ''), COALESCE(g.name, ''),
+		       COALESCE(host(c.client_ip), ''), COALESCE(host(c.vpn_ipv4), ''),
+		       c.bytes_sent, c.bytes_received, c.connected_at, c.disconnected_at,
+		       COALESCE(c.disconnect_reason, ''), c.tunnel_mode
+		FROM connections c
+		LEFT JOIN users u ON u.id = c.user_id
+		LEFT JOIN gateways g ON g.id = c.gateway_id
+		WHERE 1=1
+	`
+
+// connectionConditions builds the WHERE conditions for a filter, to be appended
+// after "WHERE 1=1". The users table is aliased u and connections c. Connections
+// are scoped to the tenant in ctx, if any, by their gateway's tenant.
+func connectionConditions(ctx context.Context, filter *ConnectionFilter) (string, []interface{}) {
+	where := ""
+	args := []interface{}{}
+	argNum := 1
+
+	if filter.GatewayID != "" {
+		where += ` AND c.gateway_id = $` + itoa(argNum)
+		args = append(args, filter.GatewayID)
+		argNum++
+	}
+	if filter.UserID != "" {
+		where += ` AND c.user_id = $` + itoa(argNum)
+		args = append(args, filter.UserID)
+		argNum++
+	}
+	if filter.UserEmail != "" {
+		where += ` AND u.email ILIKE $` + itoa(argNum)
+		args = append(args, "%"+filter.UserEmail+"%")
+		argNum++
+	}
+	if filter.Active != nil {
+		if *filter.Active {
+			where += ` AND c.disconnected_at IS NULL`
+		} else {
+			where += ` AND c.disconnected_at IS NOT NULL`
+		}
+	}
+	if filter.StartTime != nil {
+		where += ` AND c.connected_at >= $` + itoa(argNum)
+		args = append(args, *filter.StartTime)
+		argNum++
+	}
+	if filter.EndTime != nil {
+		where += ` AND c.connected_at <= $` + itoa(argNum)
+		args = append(args, *filter.EndTime)
+	}
+	tenant, args := tenantClause(ctx, "(SELECT tenant_id FROM gateways WHERE id = c.gateway_id)", args)
+	return where + ` AND ` + tenant, args
+}
+
+// query runs a connection query and calls fn for each row.
+func (s *ConnectionStore) query(ctx context.Context, query string, args []interface{}, fn func(*ConnectionRecord) error) error {
+	rows, err := s.db.Pool.Query(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var r ConnectionRecord
+		if err := rows.Scan(
+			&r.ID, &r.UserID, &r.UserEmail, &r.GatewayID, &r.GatewayName,
+			&r.ClientIP, &r.VPNIPv4, &r.BytesSent, &r.BytesReceived,
+			&r.ConnectedAt, &r.DisconnectedAt, &r.DisconnectReason, &r.TunnelMode,
+		); err != nil {
+			return err
+		}
+		if err := fn(&r); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -7,11 +7,15 @@ import (
 	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/gatekey-project/gatekey/internal/secrets"
 )
 
 // DB wraps a PostgreSQL connection pool
 type DB struct {
 	Pool *pgxpool.Pool
+	// Secrets encrypts secret columns at rest; nil stores them as plaintext
+	Secrets *secrets.Keyring
 }
 
 // New creates a new database connection pool
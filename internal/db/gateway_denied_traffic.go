@@ -0,0 +1,107 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// DeniedTraffic is traffic a gateway's default deny policy dropped, summed over
+// the reports for one user and destination.
+type DeniedTraffic struct {
+	GatewayID   string
+	GatewayName string
+	UserEmail   string
+	ClientIP    string
+	DestIP      string
+	Protocol    string
+	DestPort    int
+	Packets     int64
+	FirstSeen   time.Time
+	LastSeen    time.Time
+}
+
+// RecordDeniedTraffic adds a gateway's report of denied traffic to the totals.
+func (s *GatewayStore) RecordDeniedTraffic(ctx context.Context, gatewayID string, entries []*DeniedTraffic) error {
+	tx, err := s.db.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	for _, e := range entries {
+		if _, err := tx.Exec(ctx, `
+			INSERT INTO gateway_denied_traffic (gateway_id, user_email, client_ip, dest_ip, protocol, dest_port, packets, first_seen, last_seen)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+			ON CONFLICT (gateway_id, user_email, dest_ip, protocol, dest_port) DO UPDATE SET
+				client_ip = EXCLUDED.client_ip,
+				packets = gateway_denied_traffic.packets + EXCLUDED.packets,
+				first_seen = LEAST(gateway_denied_traffic.first_seen, EXCLUDED.first_seen),
+				last_seen = GREATEST(gateway_denied_traffic.last_seen, EXCLUDED.last_seen)
+		`, gatewayID, e.UserEmail, e.ClientIP, e.DestIP, e.Protocol, e.DestPort, e.Packets, e.FirstSeen, e.LastSeen); err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+// DeniedTrafficFilter selects denied traffic. Empty fields match everything.
+type DeniedTrafficFilter struct {
+	GatewayID string
+	UserEmail string
+	Since     time.Time
+	Limit     int
+}
+
+// ListDeniedTraffic returns denied traffic in the caller's tenant, most recent
+// first.
+func (s *GatewayStore) ListDeniedTraffic(ctx context.Context, filter DeniedTrafficFilter) ([]*DeniedTraffic, error) {
+	tenant, args := tenantClause(ctx, "g.tenant_id", nil)
+	query := `
+		SELECT t.gateway_id, g.name, t.user_email, t.client_ip, t.dest_ip, t.protocol, t.dest_port, t.packets, t.first_seen, t.last_seen
+		FROM gateway_denied_traffic t
+		JOIN gateways g ON g.id = t.gateway_id
+		WHERE ` + tenant
+	if filter.GatewayID != "" {
+		args = append(args, filter.GatewayID)
+		query += fmt.Sprintf(" AND t.gateway_id = $%d", len(args))
+	}
+	if filter.UserEmail != "" {
+		args = append(args, filter.UserEmail)
+		query += fmt.Sprintf(" AND LOWER(t.user_email) = LOWER($%d)", len(args))
+	}
+	if !filter.Since.IsZero() {
+		args = append(args, filter.Since)
+		query += fmt.Sprintf(" AND t.last_seen >= $%d", len(args))
+	}
+	query += " ORDER BY t.last_seen DESC"
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+
+	rows, err := s.db.Pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []*DeniedTraffic
+	for rows.Next() {
+		var e DeniedTraffic
+		if err := rows.Scan(&e.GatewayID, &e.GatewayName, &e.UserEmail, &e.ClientIP, &e.DestIP, &e.Protocol, &e.DestPort, &e.Packets, &e.FirstSeen, &e.LastSeen); err != nil {
+			return nil, err
+		}
+		entries = append(entries, &e)
+	}
+	return entries, rows.Err()
+}
+
+// DeleteDeniedTrafficBefore deletes denied traffic last seen before cutoff.
+func (s *GatewayStore) DeleteDeniedTrafficBefore(ctx context.Context, cutoff time.Time) (int64, error) {
+	tag, err := s.db.Pool.Exec(ctx, `DELETE FROM gateway_denied_traffic WHERE last_seen < $1`, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,85 @@
+package db
+
+import (
+	"context"
+	"time"
+)
+
+// Setting key for the number of consecutive reprovision signals before a gateway is
+// reported as failing to reprovision.
+const SettingReprovisionAlertThreshold = "reprovision_alert_threshold"
+
+// DefaultReprovisionAlertThreshold is ten heartbeats, about five minutes at the default interval.
+const DefaultReprovisionAlertThreshold = 10
+
+// GatewayReprovisionStatus tracks how long a gateway has been signaled to reprovision
+// without its config version converging.
+type GatewayReprovisionStatus struct {
+	GatewayID          string
+	ConsecutiveSignals int
+	FirstSignaledAt    time.Time
+	LastSignaledAt     time.Time
+	AlertedAt          *time.Time
+}
+
+// RecordReprovisionSignal increments the consecutive reprovision signal count for a
+// gateway and returns the updated status.
+func (s *GatewayStore) RecordReprovisionSignal(ctx context.Context, gatewayID string) (*GatewayReprovisionStatus, error) {
+	var st GatewayReprovisionStatus
+	err := s.db.Pool.QueryRow(ctx, `
+		INSERT INTO gateway_reprovision_status (gateway_id, consecutive_signals)
+		VALUES ($1, 1)
+		ON CONFLICT (gateway_id) DO UPDATE SET
+			consecutive_signals = gateway_reprovision_status.consecutive_signals + 1,
+			last_signaled_at = NOW()
+		RETURNING gateway_id, consecutive_signals, first_signaled_at, last_signaled_at, alerted_at
+	`, gatewayID).Scan(&st.GatewayID, &st.ConsecutiveSignals, &st.FirstSignaledAt, &st.LastSignaledAt, &st.AlertedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
+
+// MarkReprovisionAlerted records that an alert was raised for a stuck gateway, so it
+// is only raised once per failure episode.
+func (s *GatewayStore) MarkReprovisionAlerted(ctx context.Context, gatewayID string) error {
+	_, err := s.db.Pool.Exec(ctx, `
+		UPDATE gateway_reprovision_status SET alerted_at = NOW() WHERE gateway_id = $1
+	`, gatewayID)
+	return err
+}
+
+// ClearReprovisionSignals resets tracking once a gateway's config version converges.
+// Returns true if the gateway had been signaled to reprovision.
+func (s *GatewayStore) ClearReprovisionSignals(ctx context.Context, gatewayID string) (bool, error) {
+	result, err := s.db.Pool.Exec(ctx, `
+		DELETE FROM gateway_reprovision_status WHERE gateway_id = $1
+	`, gatewayID)
+	if err != nil {
+		return false, err
+	}
+	return result.RowsAffected() > 0, nil
+}
+
+// ListReprovisionStatuses returns reprovision tracking for all gateways currently
+// being signaled, keyed by gateway ID.
+func (s *GatewayStore) ListReprovisionStatuses(ctx context.Context) (map[string]*GatewayReprovisionStatus, error) {
+	rows, err := s.db.Pool.Query(ctx, `
+		SELECT gateway_id, consecutive_signals, first_signaled_at, last_signaled_at, alerted_at
+		FROM gateway_reprovision_status
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	statuses := make(map[string]*GatewayReprovisionStatus)
+	for rows.Next() {
+		var st GatewayReprovisionStatus
+		if err := rows.Scan(&st.GatewayID, &st.ConsecutiveSignals, &st.FirstSignaledAt, &st.LastSignaledAt, &st.AlertedAt); err != nil {
+			return nil, err
+		}
+		statuses[st.GatewayID] = &st
+	}
+	return statuses, rows.Err()
+}
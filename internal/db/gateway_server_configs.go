@@ -0,0 +1,60 @@
+package db
+
+import (
+	"context"
+	"time"
+)
+
+// GatewayServerConfig is an OpenVPN server config a gateway reported running.
+type GatewayServerConfig struct {
+	Instance   string
+	Config     string
+	ReportedAt time.Time
+}
+
+// SetGatewayServerConfigs replaces the server configs stored for a gateway with
+// configs, keyed by OpenVPN instance name.
+func (s *GatewayStore) SetGatewayServerConfigs(ctx context.Context, gatewayID string, configs map[string]string) error {
+	tx, err := s.db.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `DELETE FROM gateway_server_configs WHERE gateway_id = $1`, gatewayID); err != nil {
+		return err
+	}
+	for instance, config := range configs {
+		if _, err := tx.Exec(ctx, `
+			INSERT INTO gateway_server_configs (gateway_id, instance, config)
+			VALUES ($1, $2, $3)
+		`, gatewayID, instance, config); err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+// ListGatewayServerConfigs returns the server configs a gateway last reported,
+// primary instance first.
+func (s *GatewayStore) ListGatewayServerConfigs(ctx context.Context, gatewayID string) ([]*GatewayServerConfig, error) {
+	rows, err := s.db.Pool.Query(ctx, `
+		SELECT instance, config, reported_at FROM gateway_server_configs
+		WHERE gateway_id = $1
+		ORDER BY instance <> 'server', instance
+	`, gatewayID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var configs []*GatewayServerConfig
+	for rows.Next() {
+		var c GatewayServerConfig
+		if err := rows.Scan(&c.Instance, &c.Config, &c.ReportedAt); err != nil {
+			return nil, err
+		}
+		configs = append(configs, &c)
+	}
+	return configs, rows.Err()
+}
@@ -0,0 +1,71 @@
+package db
+
+import "context"
+
+// GatewayStateChange is what it takes to bring a gateway's assignments and
+// settings to a desired state.
+type GatewayStateChange struct {
+	AddUsers       []string
+	RemoveUsers    []string
+	AddGroups      []string
+	RemoveGroups   []string
+	AddNetworks    []string
+	RemoveNetworks []string
+	Gateway        *Gateway // Settings to write, or nil to keep the current ones
+}
+
+// ApplyGatewayState makes every change in one transaction, so a gateway is never
+// left half way between its old and desired state.
+func (s *GatewayStore) ApplyGatewayState(ctx context.Context, gatewayID string, change *GatewayStateChange) error {
+	if ok, err := s.db.inTenant(ctx, "gateways", gatewayID); err != nil || !ok {
+		return notFoundOr(err, ErrGatewayNotFound)
+	}
+	for _, networkID := range change.AddNetworks {
+		if ok, err := s.db.inTenant(ctx, "networks", networkID); err != nil || !ok {
+			return notFoundOr(err, ErrNetworkNotFound)
+		}
+	}
+
+	tx, err := s.db.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if change.Gateway != nil {
+		if err := updateGateway(ctx, tx, change.Gateway); err != nil {
+			return err
+		}
+	}
+	for _, userID := range change.AddUsers {
+		if _, err := assignUserToGateway(ctx, tx, userID, gatewayID); err != nil {
+			return err
+		}
+	}
+	for _, userID := range change.RemoveUsers {
+		if err := removeUserFromGateway(ctx, tx, userID, gatewayID); err != nil {
+			return err
+		}
+	}
+	for _, group := range change.AddGroups {
+		if _, err := assignGroupToGateway(ctx, tx, group, gatewayID); err != nil {
+			return err
+		}
+	}
+	for _, group := range change.RemoveGroups {
+		if err := removeGroupFromGateway(ctx, tx, group, gatewayID); err != nil {
+			return err
+		}
+	}
+	for _, networkID := range change.AddNetworks {
+		if _, err := assignGatewayToNetwork(ctx, tx, gatewayID, networkID); err != nil {
+			return err
+		}
+	}
+	for _, networkID := range change.RemoveNetworks {
+		if err := removeGatewayFromNetwork(ctx, tx, gatewayID, networkID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 )
 
 var (
@@ -24,25 +25,88 @@ type Gateway struct {
 	PublicIP       string
 	VPNPort        int
 	VPNProtocol    string
-	CryptoProfile  string   // "modern", "fips", or "compatible"
-	VPNSubnet      string   // VPN client subnet (e.g., "10.8.0.0/24")
-	TLSAuthEnabled bool     // Enable TLS-Auth for additional security
-	TLSAuthKey     string   // TLS-Auth static key (generated during provisioning)
-	FullTunnelMode bool     // When true, route all traffic through VPN (push 0.0.0.0/0)
-	PushDNS        bool     // When true, push DNS servers to VPN clients
-	DNSServers     []string // DNS server IPs to push to clients
-	ConfigVersion  string   // Hash of config settings - changes trigger gateway reprovision
-	Token          string
-	PublicKey      string
-	IsActive       bool
-	LastHeartbeat  *time.Time
-	CreatedAt      time.Time
-	UpdatedAt      time.Time
+	CryptoProfile  string // "modern", "fips", or "compatible"
+	VPNSubnet      string // VPN client subnet (e.g., "10.8.0.0/24")
+	TLSAuthEnabled bool   // Enable TLS-Auth for additional security
+	TLSAuthKey     string // TLS-Auth static key (generated during provisioning)
+	TLSMode        string // "auth" (tls-auth) or "crypt" (tls-crypt), used when TLSAuthEnabled
+	Compression    string // "none", "lz4" or "lzo"; applied to both server and client configs
+	// EncryptClientKeys encrypts the private key in generated client configs with a
+	// passphrase that is shown once at generation time and never stored
+	EncryptClientKeys bool
+	MinCryptoProfile  string   // Per-gateway minimum crypto profile, empty for none
+	FullTunnelMode    bool     // When true, route all traffic through VPN (push 0.0.0.0/0)
+	PushDNS           bool     // When true, push DNS servers to VPN clients
+	DNSServers        []string // DNS server IPs to push to clients
+	PushOptions       []string // Extra allowlisted push options (e.g. "block-outside-dns")
+	// AllowTunnelChoice lets users pick full or split tunnel per config, with
+	// FullTunnelMode as the default
+	AllowTunnelChoice bool
+	// LinkTuning overrides keepalive and MTU settings in both server and client configs
+	LinkTuning LinkTuning
+	// AdditionalEndpoints are extra protocol/port listeners, each served by its own OpenVPN instance
+	AdditionalEndpoints []ListenEndpoint
+	ConfigVersion       string // Hash of config settings - changes trigger gateway reprovision
+	Token               string
+	PublicKey           string
+	IsActive            bool
+	LastHeartbeat       *time.Time
+	CreatedAt           time.Time
+	UpdatedAt           time.Time
+	// TenantID is the tenant the gateway belongs to; see WithTenant
+	TenantID string
+}
+
+// ListenEndpoint is an additional protocol/port a gateway accepts VPN connections on.
+type ListenEndpoint struct {
+	Protocol string `json:"protocol"` // "udp" or "tcp"
+	Port     int    `json:"port"`
+	Subnet   string `json:"subnet"` // VPN client subnet for this endpoint's OpenVPN instance
+}
+
+// LinkTuning holds per-gateway keepalive and MTU settings. Zero values leave the
+// OpenVPN defaults in place.
+type LinkTuning struct {
+	KeepaliveInterval int `json:"keepalive_interval,omitempty"` // Seconds between pings
+	KeepaliveTimeout  int `json:"keepalive_timeout,omitempty"`  // Seconds without a ping before restarting
+	TunMTU            int `json:"tun_mtu,omitempty"`
+	MSSFix            int `json:"mssfix,omitempty"`
+	Fragment          int `json:"fragment,omitempty"` // UDP only
 }
 
 // Default VPN subnet if not specified
 const DefaultVPNSubnet = "172.31.255.0/24"
 
+// TLS control channel protection modes
+const (
+	TLSModeAuth  = "auth"  // tls-auth: HMAC-authenticated control channel
+	TLSModeCrypt = "crypt" // tls-crypt: authenticated and encrypted control channel
+)
+
+// tlsModeOrDefault returns mode, defaulting to tls-auth for compatibility.
+func tlsModeOrDefault(mode string) string {
+	if mode == "" {
+		return TLSModeAuth
+	}
+	return mode
+}
+
+// Data channel compression modes. Compression lets an attacker who can inject
+// traffic learn secrets from packet sizes (VORACLE), so new gateways use none.
+const (
+	CompressionNone = "none"
+	CompressionLZ4  = "lz4"
+	CompressionLZO  = "lzo"
+)
+
+// compressionOrDefault returns mode, defaulting to no compression.
+func compressionOrDefault(mode string) string {
+	if mode == "" {
+		return CompressionNone
+	}
+	return mode
+}
+
 // CryptoProfile constants
 const (
 	CryptoProfileModern     = "modern"     // Modern secure defaults (AES-256-GCM, CHACHA20-POLY1305)
@@ -81,11 +145,19 @@ func (s *GatewayStore) CreateGateway(ctx context.Context, gw *Gateway) error {
 	if vpnSubnet == "" {
 		vpnSubnet = DefaultVPNSubnet
 	}
+	pushOptions := gw.PushOptions
+	if pushOptions == nil {
+		pushOptions = []string{}
+	}
+	endpoints := gw.AdditionalEndpoints
+	if endpoints == nil {
+		endpoints = []ListenEndpoint{}
+	}
 	// Use NULLIF to convert empty string to NULL for hostname and inet type
 	_, err := s.db.Pool.Exec(ctx, `
-		INSERT INTO gateways (name, hostname, public_ip, vpn_port, vpn_protocol, crypto_profile, vpn_subnet, tls_auth_enabled, full_tunnel_mode, push_dns, dns_servers, token, public_key)
-		VALUES ($1, NULLIF($2, ''), NULLIF($3, '')::inet, $4, $5, $6, $7::cidr, $8, $9, $10, $11, $12, $13)
-	`, gw.Name, gw.Hostname, gw.PublicIP, gw.VPNPort, gw.VPNProtocol, cryptoProfile, vpnSubnet, gw.TLSAuthEnabled, gw.FullTunnelMode, gw.PushDNS, gw.DNSServers, gw.Token, gw.PublicKey)
+		INSERT INTO gateways (name, hostname, public_ip, vpn_port, vpn_protocol, crypto_profile, vpn_subnet, tls_auth_enabled, full_tunnel_mode, push_dns, dns_servers, token, public_key, push_options, additional_endpoints, tls_mode, encrypt_client_keys, min_crypto_profile, compression, link_tuning, allow_tunnel_choice, tenant_id)
+		VALUES ($1, NULLIF($2, ''), NULLIF($3, '')::inet, $4, $5, $6, $7::cidr, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22)
+	`, gw.Name, gw.Hostname, gw.PublicIP, gw.VPNPort, gw.VPNProtocol, cryptoProfile, vpnSubnet, gw.TLSAuthEnabled, gw.FullTunnelMode, gw.PushDNS, gw.DNSServers, gw.Token, gw.PublicKey, pushOptions, endpoints, tlsModeOrDefault(gw.TLSMode), gw.EncryptClientKeys, gw.MinCryptoProfile, compressionOrDefault(gw.Compression), gw.LinkTuning, gw.AllowTunnelChoice, tenantForInsert(ctx))
 	if err != nil && strings.Contains(err.Error(), "duplicate key") {
 		return ErrGatewayExists
 	}
@@ -96,10 +168,10 @@ func (s *GatewayStore) CreateGateway(ctx context.Context, gw *Gateway) error {
 func (s *GatewayStore) GetGateway(ctx context.Context, id string) (*Gateway, error) {
 	var gw Gateway
 	var hostname, publicIP, vpnSubnet, tlsAuthKey *string
+	tenant, args := tenantClause(ctx, "tenant_id", []interface{}{id})
 	err := s.db.Pool.QueryRow(ctx, `
-		SELECT id, name, hostname, host(public_ip), vpn_port, vpn_protocol, crypto_profile, vpn_subnet::text, tls_auth_enabled, COALESCE(tls_auth_key, ''), full_tunnel_mode, push_dns, dns_servers, COALESCE(config_version, ''), token, public_key, is_active, last_heartbeat, created_at, updated_at
-		FROM gateways WHERE id = $1
-	`, id).Scan(&gw.ID, &gw.Name, &hostname, &publicIP, &gw.VPNPort, &gw.VPNProtocol, &gw.CryptoProfile, &vpnSubnet, &gw.TLSAuthEnabled, &gw.TLSAuthKey, &gw.FullTunnelMode, &gw.PushDNS, &gw.DNSServers, &gw.ConfigVersion, &gw.Token, &gw.PublicKey, &gw.IsActive, &gw.LastHeartbeat, &gw.CreatedAt, &gw.UpdatedAt)
+		SELECT id, name, hostname, host(public_ip), vpn_port, vpn_protocol, crypto_profile, min_crypto_profile, vpn_subnet::text, tls_auth_enabled, COALESCE(tls_auth_key, ''), tls_mode, compression, encrypt_client_keys, full_tunnel_mode, allow_tunnel_choice, push_dns, dns_servers, push_options, additional_endpoints, link_tuning, COALESCE(config_version, ''), token, public_key, is_active, last_heartbeat, created_at, updated_at, tenant_id
+		FROM gateways WHERE id = $1 AND deleted_at IS NULL AND `+tenant, args...).Scan(&gw.ID, &gw.Name, &hostname, &publicIP, &gw.VPNPort, &gw.VPNProtocol, &gw.CryptoProfile, &gw.MinCryptoProfile, &vpnSubnet, &gw.TLSAuthEnabled, &gw.TLSAuthKey, &gw.TLSMode, &gw.Compression, &gw.EncryptClientKeys, &gw.FullTunnelMode, &gw.AllowTunnelChoice, &gw.PushDNS, &gw.DNSServers, &gw.PushOptions, &gw.AdditionalEndpoints, &gw.LinkTuning, &gw.ConfigVersion, &gw.Token, &gw.PublicKey, &gw.IsActive, &gw.LastHeartbeat, &gw.CreatedAt, &gw.UpdatedAt, &gw.TenantID)
 	if err == pgx.ErrNoRows {
 		return nil, ErrGatewayNotFound
 	}
@@ -118,6 +190,9 @@ func (s *GatewayStore) GetGateway(ctx context.Context, id string) (*Gateway, err
 		gw.VPNSubnet = DefaultVPNSubnet
 	}
 	_ = tlsAuthKey // unused, using COALESCE instead
+	if gw.TLSAuthKey, err = s.db.open(gw.TLSAuthKey); err != nil {
+		return nil, err
+	}
 	return &gw, nil
 }
 
@@ -125,10 +200,10 @@ func (s *GatewayStore) GetGateway(ctx context.Context, id string) (*Gateway, err
 func (s *GatewayStore) GetGatewayByName(ctx context.Context, name string) (*Gateway, error) {
 	var gw Gateway
 	var hostname, publicIP, vpnSubnet *string
+	tenant, args := tenantClause(ctx, "tenant_id", []interface{}{name})
 	err := s.db.Pool.QueryRow(ctx, `
-		SELECT id, name, hostname, host(public_ip), vpn_port, vpn_protocol, crypto_profile, vpn_subnet::text, tls_auth_enabled, COALESCE(tls_auth_key, ''), full_tunnel_mode, push_dns, dns_servers, COALESCE(config_version, ''), token, public_key, is_active, last_heartbeat, created_at, updated_at
-		FROM gateways WHERE name = $1
-	`, name).Scan(&gw.ID, &gw.Name, &hostname, &publicIP, &gw.VPNPort, &gw.VPNProtocol, &gw.CryptoProfile, &vpnSubnet, &gw.TLSAuthEnabled, &gw.TLSAuthKey, &gw.FullTunnelMode, &gw.PushDNS, &gw.DNSServers, &gw.ConfigVersion, &gw.Token, &gw.PublicKey, &gw.IsActive, &gw.LastHeartbeat, &gw.CreatedAt, &gw.UpdatedAt)
+		SELECT id, name, hostname, host(public_ip), vpn_port, vpn_protocol, crypto_profile, min_crypto_profile, vpn_subnet::text, tls_auth_enabled, COALESCE(tls_auth_key, ''), tls_mode, compression, encrypt_client_keys, full_tunnel_mode, allow_tunnel_choice, push_dns, dns_servers, push_options, additional_endpoints, link_tuning, COALESCE(config_version, ''), token, public_key, is_active, last_heartbeat, created_at, updated_at, tenant_id
+		FROM gateways WHERE name = $1 AND deleted_at IS NULL AND `+tenant, args...).Scan(&gw.ID, &gw.Name, &hostname, &publicIP, &gw.VPNPort, &gw.VPNProtocol, &gw.CryptoProfile, &gw.MinCryptoProfile, &vpnSubnet, &gw.TLSAuthEnabled, &gw.TLSAuthKey, &gw.TLSMode, &gw.Compression, &gw.EncryptClientKeys, &gw.FullTunnelMode, &gw.AllowTunnelChoice, &gw.PushDNS, &gw.DNSServers, &gw.PushOptions, &gw.AdditionalEndpoints, &gw.LinkTuning, &gw.ConfigVersion, &gw.Token, &gw.PublicKey, &gw.IsActive, &gw.LastHeartbeat, &gw.CreatedAt, &gw.UpdatedAt, &gw.TenantID)
 	if err == pgx.ErrNoRows {
 		return nil, ErrGatewayNotFound
 	}
@@ -146,6 +221,9 @@ func (s *GatewayStore) GetGatewayByName(ctx context.Context, name string) (*Gate
 	} else {
 		gw.VPNSubnet = DefaultVPNSubnet
 	}
+	if gw.TLSAuthKey, err = s.db.open(gw.TLSAuthKey); err != nil {
+		return nil, err
+	}
 	return &gw, nil
 }
 
@@ -154,9 +232,9 @@ func (s *GatewayStore) GetGatewayByToken(ctx context.Context, token string) (*Ga
 	var gw Gateway
 	var hostname, publicIP, vpnSubnet *string
 	err := s.db.Pool.QueryRow(ctx, `
-		SELECT id, name, hostname, host(public_ip), vpn_port, vpn_protocol, crypto_profile, vpn_subnet::text, tls_auth_enabled, COALESCE(tls_auth_key, ''), full_tunnel_mode, push_dns, dns_servers, COALESCE(config_version, ''), token, public_key, is_active, last_heartbeat, created_at, updated_at
-		FROM gateways WHERE token = $1
-	`, token).Scan(&gw.ID, &gw.Name, &hostname, &publicIP, &gw.VPNPort, &gw.VPNProtocol, &gw.CryptoProfile, &vpnSubnet, &gw.TLSAuthEnabled, &gw.TLSAuthKey, &gw.FullTunnelMode, &gw.PushDNS, &gw.DNSServers, &gw.ConfigVersion, &gw.Token, &gw.PublicKey, &gw.IsActive, &gw.LastHeartbeat, &gw.CreatedAt, &gw.UpdatedAt)
+		SELECT id, name, hostname, host(public_ip), vpn_port, vpn_protocol, crypto_profile, min_crypto_profile, vpn_subnet::text, tls_auth_enabled, COALESCE(tls_auth_key, ''), tls_mode, compression, encrypt_client_keys, full_tunnel_mode, allow_tunnel_choice, push_dns, dns_servers, push_options, additional_endpoints, link_tuning, COALESCE(config_version, ''), token, public_key, is_active, last_heartbeat, created_at, updated_at, tenant_id
+		FROM gateways WHERE token = $1 AND deleted_at IS NULL
+	`, token).Scan(&gw.ID, &gw.Name, &hostname, &publicIP, &gw.VPNPort, &gw.VPNProtocol, &gw.CryptoProfile, &gw.MinCryptoProfile, &vpnSubnet, &gw.TLSAuthEnabled, &gw.TLSAuthKey, &gw.TLSMode, &gw.Compression, &gw.EncryptClientKeys, &gw.FullTunnelMode, &gw.AllowTunnelChoice, &gw.PushDNS, &gw.DNSServers, &gw.PushOptions, &gw.AdditionalEndpoints, &gw.LinkTuning, &gw.ConfigVersion, &gw.Token, &gw.PublicKey, &gw.IsActive, &gw.LastHeartbeat, &gw.CreatedAt, &gw.UpdatedAt, &gw.TenantID)
 	if err == pgx.ErrNoRows {
 		return nil, ErrGatewayNotFound
 	}
@@ -174,24 +252,33 @@ func (s *GatewayStore) GetGatewayByToken(ctx context.Context, token string) (*Ga
 	} else {
 		gw.VPNSubnet = DefaultVPNSubnet
 	}
+	if gw.TLSAuthKey, err = s.db.open(gw.TLSAuthKey); err != nil {
+		return nil, err
+	}
 	return &gw, nil
 }
 
 // SetTLSAuthKey updates the TLS-Auth key for a gateway (used during provisioning)
 func (s *GatewayStore) SetTLSAuthKey(ctx context.Context, gatewayID, tlsAuthKey string) error {
-	_, err := s.db.Pool.Exec(ctx, `
+	sealed, err := s.db.seal(tlsAuthKey)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Pool.Exec(ctx, `
 		UPDATE gateways SET tls_auth_key = $2, updated_at = NOW() WHERE id = $1
-	`, gatewayID, tlsAuthKey)
+	`, gatewayID, sealed)
 	return err
 }
 
 // ListGateways retrieves all gateways
 func (s *GatewayStore) ListGateways(ctx context.Context) ([]*Gateway, error) {
+	tenant, args := tenantClause(ctx, "tenant_id", nil)
 	rows, err := s.db.Pool.Query(ctx, `
-		SELECT id, name, hostname, host(public_ip), vpn_port, vpn_protocol, crypto_profile, vpn_subnet::text, tls_auth_enabled, full_tunnel_mode, push_dns, dns_servers, is_active, last_heartbeat, created_at, updated_at
+		SELECT id, name, hostname, host(public_ip), vpn_port, vpn_protocol, crypto_profile, min_crypto_profile, vpn_subnet::text, tls_auth_enabled, tls_mode, compression, encrypt_client_keys, full_tunnel_mode, allow_tunnel_choice, push_dns, dns_servers, push_options, additional_endpoints, link_tuning, COALESCE(config_version, ''), is_active, last_heartbeat, created_at, updated_at, tenant_id
 		FROM gateways
+		WHERE deleted_at IS NULL AND `+tenant+`
 		ORDER BY name
-	`)
+	`, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -201,7 +288,7 @@ func (s *GatewayStore) ListGateways(ctx context.Context) ([]*Gateway, error) {
 	for rows.Next() {
 		var gw Gateway
 		var hostname, publicIP, vpnSubnet *string
-		if err := rows.Scan(&gw.ID, &gw.Name, &hostname, &publicIP, &gw.VPNPort, &gw.VPNProtocol, &gw.CryptoProfile, &vpnSubnet, &gw.TLSAuthEnabled, &gw.FullTunnelMode, &gw.PushDNS, &gw.DNSServers, &gw.IsActive, &gw.LastHeartbeat, &gw.CreatedAt, &gw.UpdatedAt); err != nil {
+		if err := rows.Scan(&gw.ID, &gw.Name, &hostname, &publicIP, &gw.VPNPort, &gw.VPNProtocol, &gw.CryptoProfile, &gw.MinCryptoProfile, &vpnSubnet, &gw.TLSAuthEnabled, &gw.TLSMode, &gw.Compression, &gw.EncryptClientKeys, &gw.FullTunnelMode, &gw.AllowTunnelChoice, &gw.PushDNS, &gw.DNSServers, &gw.PushOptions, &gw.AdditionalEndpoints, &gw.LinkTuning, &gw.ConfigVersion, &gw.IsActive, &gw.LastHeartbeat, &gw.CreatedAt, &gw.UpdatedAt, &gw.TenantID); err != nil {
 			return nil, err
 		}
 		if hostname != nil {
@@ -222,12 +309,13 @@ func (s *GatewayStore) ListGateways(ctx context.Context) ([]*Gateway, error) {
 
 // ListActiveGateways retrieves all active gateways
 func (s *GatewayStore) ListActiveGateways(ctx context.Context) ([]*Gateway, error) {
+	tenant, args := tenantClause(ctx, "tenant_id", nil)
 	rows, err := s.db.Pool.Query(ctx, `
-		SELECT id, name, hostname, host(public_ip), vpn_port, vpn_protocol, crypto_profile, vpn_subnet::text, tls_auth_enabled, full_tunnel_mode, push_dns, dns_servers, is_active, last_heartbeat, created_at, updated_at
+		SELECT id, name, hostname, host(public_ip), vpn_port, vpn_protocol, crypto_profile, min_crypto_profile, vpn_subnet::text, tls_auth_enabled, tls_mode, compression, encrypt_client_keys, full_tunnel_mode, allow_tunnel_choice, push_dns, dns_servers, push_options, additional_endpoints, link_tuning, is_active, last_heartbeat, created_at, updated_at, tenant_id
 		FROM gateways
-		WHERE is_active = true
+		WHERE is_active = true AND deleted_at IS NULL AND `+tenant+`
 		ORDER BY name
-	`)
+	`, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -237,7 +325,7 @@ func (s *GatewayStore) ListActiveGateways(ctx context.Context) ([]*Gateway, erro
 	for rows.Next() {
 		var gw Gateway
 		var hostname, publicIP, vpnSubnet *string
-		if err := rows.Scan(&gw.ID, &gw.Name, &hostname, &publicIP, &gw.VPNPort, &gw.VPNProtocol, &gw.CryptoProfile, &vpnSubnet, &gw.TLSAuthEnabled, &gw.FullTunnelMode, &gw.PushDNS, &gw.DNSServers, &gw.IsActive, &gw.LastHeartbeat, &gw.CreatedAt, &gw.UpdatedAt); err != nil {
+		if err := rows.Scan(&gw.ID, &gw.Name, &hostname, &publicIP, &gw.VPNPort, &gw.VPNProtocol, &gw.CryptoProfile, &gw.MinCryptoProfile, &vpnSubnet, &gw.TLSAuthEnabled, &gw.TLSMode, &gw.Compression, &gw.EncryptClientKeys, &gw.FullTunnelMode, &gw.AllowTunnelChoice, &gw.PushDNS, &gw.DNSServers, &gw.PushOptions, &gw.AdditionalEndpoints, &gw.LinkTuning, &gw.IsActive, &gw.LastHeartbeat, &gw.CreatedAt, &gw.UpdatedAt, &gw.TenantID); err != nil {
 			return nil, err
 		}
 		if hostname != nil {
@@ -284,9 +372,12 @@ func (s *GatewayStore) UpdateGatewayStatus(ctx context.Context, id, publicIP str
 	return nil
 }
 
-// DeleteGateway removes a gateway
+// DeleteGateway soft-deletes a gateway. Its user, group and network assignments
+// are kept so RestoreGateway can bring it back as it was.
 func (s *GatewayStore) DeleteGateway(ctx context.Context, id string) error {
-	result, err := s.db.Pool.Exec(ctx, `DELETE FROM gateways WHERE id = $1`, id)
+	tenant, args := tenantClause(ctx, "tenant_id", []interface{}{id})
+	result, err := s.db.Pool.Exec(ctx, `
+		UPDATE gateways SET deleted_at = NOW(), is_active = false WHERE id = $1 AND deleted_at IS NULL AND `+tenant, args...)
 	if err != nil {
 		return err
 	}
@@ -296,20 +387,41 @@ func (s *GatewayStore) DeleteGateway(ctx context.Context, id string) error {
 	return nil
 }
 
-// MarkInactiveGateways marks gateways as inactive if they haven't sent a heartbeat recently
-func (s *GatewayStore) MarkInactiveGateways(ctx context.Context, threshold time.Duration) (int64, error) {
-	result, err := s.db.Pool.Exec(ctx, `
+// MarkInactiveGateways marks gateways as inactive if they haven't sent a heartbeat
+// recently, and returns the ID, name and tenant of each gateway it marked
+func (s *GatewayStore) MarkInactiveGateways(ctx context.Context, threshold time.Duration) ([]*Gateway, error) {
+	rows, err := s.db.Pool.Query(ctx, `
 		UPDATE gateways SET is_active = false
 		WHERE is_active = true AND (last_heartbeat IS NULL OR last_heartbeat < NOW() - $1::interval)
+		RETURNING id, name, tenant_id
 	`, threshold.String())
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
-	return result.RowsAffected(), nil
+	defer rows.Close()
+
+	var gateways []*Gateway
+	for rows.Next() {
+		gw := &Gateway{}
+		if err := rows.Scan(&gw.ID, &gw.Name, &gw.TenantID); err != nil {
+			return nil, err
+		}
+		gateways = append(gateways, gw)
+	}
+	return gateways, rows.Err()
+}
+
+// execer runs a statement on the pool or inside a transaction.
+type execer interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
 }
 
 // UpdateGateway updates a gateway's properties
 func (s *GatewayStore) UpdateGateway(ctx context.Context, gw *Gateway) error {
+	return updateGateway(ctx, s.db.Pool, gw)
+}
+
+func updateGateway(ctx context.Context, q execer, gw *Gateway) error {
 	// Default to modern crypto profile if not specified
 	cryptoProfile := gw.CryptoProfile
 	if cryptoProfile == "" {
@@ -320,12 +432,20 @@ func (s *GatewayStore) UpdateGateway(ctx context.Context, gw *Gateway) error {
 	if vpnSubnet == "" {
 		vpnSubnet = DefaultVPNSubnet
 	}
-	result, err := s.db.Pool.Exec(ctx, `
+	pushOptions := gw.PushOptions
+	if pushOptions == nil {
+		pushOptions = []string{}
+	}
+	endpoints := gw.AdditionalEndpoints
+	if endpoints == nil {
+		endpoints = []ListenEndpoint{}
+	}
+	tenant, args := tenantClause(ctx, "tenant_id", []interface{}{gw.ID, gw.Name, gw.Hostname, gw.PublicIP, gw.VPNPort, gw.VPNProtocol, cryptoProfile, vpnSubnet, gw.TLSAuthEnabled, gw.FullTunnelMode, gw.PushDNS, gw.DNSServers, pushOptions, endpoints, tlsModeOrDefault(gw.TLSMode), gw.EncryptClientKeys, gw.MinCryptoProfile, compressionOrDefault(gw.Compression), gw.LinkTuning, gw.AllowTunnelChoice})
+	result, err := q.Exec(ctx, `
 		UPDATE gateways
 		SET name = $2, hostname = NULLIF($3, ''), public_ip = NULLIF($4, '')::inet,
-		    vpn_port = $5, vpn_protocol = $6, crypto_profile = $7, vpn_subnet = $8::cidr, tls_auth_enabled = $9, full_tunnel_mode = $10, push_dns = $11, dns_servers = $12, updated_at = NOW()
-		WHERE id = $1
-	`, gw.ID, gw.Name, gw.Hostname, gw.PublicIP, gw.VPNPort, gw.VPNProtocol, cryptoProfile, vpnSubnet, gw.TLSAuthEnabled, gw.FullTunnelMode, gw.PushDNS, gw.DNSServers)
+		    vpn_port = $5, vpn_protocol = $6, crypto_profile = $7, vpn_subnet = $8::cidr, tls_auth_enabled = $9, full_tunnel_mode = $10, push_dns = $11, dns_servers = $12, push_options = $13, additional_endpoints = $14, tls_mode = $15, encrypt_client_keys = $16, min_crypto_profile = $17, compression = $18, link_tuning = $19, allow_tunnel_choice = $20, updated_at = NOW()
+		WHERE id = $1 AND deleted_at IS NULL AND `+tenant, args...)
 	if err != nil {
 		if strings.Contains(err.Error(), "duplicate key") {
 			return ErrGatewayExists
@@ -343,7 +463,7 @@ func (s *GatewayStore) UpdateGatewayConfigVersion(ctx context.Context, id, confi
 	result, err := s.db.Pool.Exec(ctx, `
 		UPDATE gateways
 		SET config_version = $2, updated_at = NOW()
-		WHERE id = $1
+		WHERE id = $1 AND deleted_at IS NULL
 	`, id, configVersion)
 	if err != nil {
 		return err
@@ -354,37 +474,71 @@ func (s *GatewayStore) UpdateGatewayConfigVersion(ctx context.Context, id, confi
 	return nil
 }
 
-// AssignUserToGateway assigns a user to a gateway
-func (s *GatewayStore) AssignUserToGateway(ctx context.Context, userID, gatewayID string) error {
-	_, err := s.db.Pool.Exec(ctx, `
+// AssignUserToGateway assigns a user to a gateway, reporting whether it wasn't already assigned
+func (s *GatewayStore) AssignUserToGateway(ctx context.Context, userID, gatewayID string) (bool, error) {
+	if ok, err := s.db.inTenant(ctx, "gateways", gatewayID); err != nil || !ok {
+		return false, notFoundOr(err, ErrGatewayNotFound)
+	}
+	return assignUserToGateway(ctx, s.db.Pool, userID, gatewayID)
+}
+
+func assignUserToGateway(ctx context.Context, q execer, userID, gatewayID string) (bool, error) {
+	result, err := q.Exec(ctx, `
 		INSERT INTO user_gateways (user_id, gateway_id)
 		VALUES ($1, $2)
 		ON CONFLICT DO NOTHING
 	`, userID, gatewayID)
-	return err
+	if err != nil {
+		return false, err
+	}
+	return result.RowsAffected() > 0, nil
 }
 
 // RemoveUserFromGateway removes a user from a gateway
 func (s *GatewayStore) RemoveUserFromGateway(ctx context.Context, userID, gatewayID string) error {
-	_, err := s.db.Pool.Exec(ctx, `
+	if ok, err := s.db.inTenant(ctx, "gateways", gatewayID); err != nil || !ok {
+		return notFoundOr(err, ErrGatewayNotFound)
+	}
+	return removeUserFromGateway(ctx, s.db.Pool, userID, gatewayID)
+}
+
+func removeUserFromGateway(ctx context.Context, q execer, userID, gatewayID string) error {
+	_, err := q.Exec(ctx, `
 		DELETE FROM user_gateways WHERE user_id = $1 AND gateway_id = $2
 	`, userID, gatewayID)
 	return err
 }
 
-// AssignGroupToGateway assigns a group to a gateway
-func (s *GatewayStore) AssignGroupToGateway(ctx context.Context, groupName, gatewayID string) error {
-	_, err := s.db.Pool.Exec(ctx, `
+// AssignGroupToGateway assigns a group to a gateway, reporting whether it wasn't already assigned
+func (s *GatewayStore) AssignGroupToGateway(ctx context.Context, groupName, gatewayID string) (bool, error) {
+	if ok, err := s.db.inTenant(ctx, "gateways", gatewayID); err != nil || !ok {
+		return false, notFoundOr(err, ErrGatewayNotFound)
+	}
+	return assignGroupToGateway(ctx, s.db.Pool, groupName, gatewayID)
+}
+
+func assignGroupToGateway(ctx context.Context, q execer, groupName, gatewayID string) (bool, error) {
+	result, err := q.Exec(ctx, `
 		INSERT INTO group_gateways (group_name, gateway_id)
 		VALUES ($1, $2)
 		ON CONFLICT DO NOTHING
 	`, groupName, gatewayID)
-	return err
+	if err != nil {
+		return false, err
+	}
+	return result.RowsAffected() > 0, nil
 }
 
 // RemoveGroupFromGateway removes a group from a gateway
 func (s *GatewayStore) RemoveGroupFromGateway(ctx context.Context, groupName, gatewayID string) error {
-	_, err := s.db.Pool.Exec(ctx, `
+	if ok, err := s.db.inTenant(ctx, "gateways", gatewayID); err != nil || !ok {
+		return notFoundOr(err, ErrGatewayNotFound)
+	}
+	return removeGroupFromGateway(ctx, s.db.Pool, groupName, gatewayID)
+}
+
+func removeGroupFromGateway(ctx context.Context, q execer, groupName, gatewayID string) error {
+	_, err := q.Exec(ctx, `
 		DELETE FROM group_gateways WHERE group_name = $1 AND gateway_id = $2
 	`, groupName, gatewayID)
 	return err
@@ -400,6 +554,9 @@ type GatewayUser struct {
 
 // GetGatewayUsers returns all users assigned to a gateway
 func (s *GatewayStore) GetGatewayUsers(ctx context.Context, gatewayID string) ([]GatewayUser, error) {
+	if ok, err := s.db.inTenant(ctx, "gateways", gatewayID); err != nil || !ok {
+		return nil, notFoundOr(err, ErrGatewayNotFound)
+	}
 	rows, err := s.db.Pool.Query(ctx, `
 		SELECT ug.user_id, COALESCE(u.email, ''), COALESCE(u.name, ''), ug.created_at
 		FROM user_gateways ug
@@ -431,6 +588,9 @@ type GatewayGroup struct {
 
 // GetGatewayGroups returns all groups assigned to a gateway
 func (s *GatewayStore) GetGatewayGroups(ctx context.Context, gatewayID string) ([]GatewayGroup, error) {
+	if ok, err := s.db.inTenant(ctx, "gateways", gatewayID); err != nil || !ok {
+		return nil, notFoundOr(err, ErrGatewayNotFound)
+	}
 	rows, err := s.db.Pool.Query(ctx, `
 		SELECT group_name, created_at
 		FROM group_gateways
@@ -458,13 +618,13 @@ func (s *GatewayStore) ListUserGateways(ctx context.Context, userID string, grou
 	// Query gateways that the user can access via direct assignment or group membership
 	rows, err := s.db.Pool.Query(ctx, `
 		SELECT DISTINCT g.id, g.name, g.hostname, host(g.public_ip), g.vpn_port, g.vpn_protocol,
-		       g.crypto_profile, g.is_active, g.last_heartbeat, g.created_at, g.updated_at
+		       g.crypto_profile, g.full_tunnel_mode, g.allow_tunnel_choice, g.is_active, g.last_heartbeat, g.created_at, g.updated_at
 		FROM gateways g
 		WHERE g.id IN (
 			SELECT gateway_id FROM user_gateways WHERE user_id = $1
 			UNION
 			SELECT gateway_id FROM group_gateways WHERE group_name = ANY($2)
-		)
+		) AND g.deleted_at IS NULL AND g.tenant_id = `+userTenantSQL("$1")+`
 		ORDER BY g.name
 	`, userID, groups)
 	if err != nil {
@@ -476,7 +636,7 @@ func (s *GatewayStore) ListUserGateways(ctx context.Context, userID string, grou
 	for rows.Next() {
 		var gw Gateway
 		var hostname, publicIP *string
-		if err := rows.Scan(&gw.ID, &gw.Name, &hostname, &publicIP, &gw.VPNPort, &gw.VPNProtocol, &gw.CryptoProfile, &gw.IsActive, &gw.LastHeartbeat, &gw.CreatedAt, &gw.UpdatedAt); err != nil {
+		if err := rows.Scan(&gw.ID, &gw.Name, &hostname, &publicIP, &gw.VPNPort, &gw.VPNProtocol, &gw.CryptoProfile, &gw.FullTunnelMode, &gw.AllowTunnelChoice, &gw.IsActive, &gw.LastHeartbeat, &gw.CreatedAt, &gw.UpdatedAt); err != nil {
 			return nil, err
 		}
 		if hostname != nil {
@@ -498,7 +658,7 @@ func (s *GatewayStore) UserHasGatewayAccess(ctx context.Context, userID, gateway
 			SELECT 1 FROM user_gateways WHERE user_id = $1 AND gateway_id = $2
 			UNION
 			SELECT 1 FROM group_gateways WHERE gateway_id = $2 AND group_name = ANY($3)
-		)
+		) AND EXISTS(SELECT 1 FROM gateways WHERE id = $2 AND tenant_id = `+userTenantSQL("$1")+`)
 	`, userID, gatewayID, groups).Scan(&hasAccess)
 	return hasAccess, err
 }
@@ -510,7 +670,7 @@ func (s *GatewayStore) GetGatewaysForUser(ctx context.Context, userID string) ([
 		       g.crypto_profile, g.is_active, g.last_heartbeat, g.created_at, g.updated_at
 		FROM gateways g
 		INNER JOIN user_gateways ug ON g.id = ug.gateway_id
-		WHERE ug.user_id = $1
+		WHERE ug.user_id = $1 AND g.deleted_at IS NULL AND g.tenant_id = `+userTenantSQL("$1")+`
 		ORDER BY g.name
 	`, userID)
 	if err != nil {
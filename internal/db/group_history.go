@@ -0,0 +1,113 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// GroupHistoryLimit is how many group sets are kept per user.
+const GroupHistoryLimit = 10
+
+// GroupHistoryEntry is a group set reported for an SSO user at login.
+type GroupHistoryEntry struct {
+	ID string `json:"id"`
+	// Groups is what was stored for the user
+	Groups []string `json:"groups"`
+	// Received is what the identity provider sent, which differs from Groups
+	// when an empty set was ignored
+	Received []string `json:"received"`
+	// Anomaly marks an empty set received for a user who had groups
+	Anomaly   bool      `json:"anomaly"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// SSOUserGroups returns the groups stored for an SSO user. found is false if the
+// user hasn't logged in before.
+func (s *UserStore) SSOUserGroups(ctx context.Context, provider, externalID string) (groups []string, found bool, err error) {
+	var groupsJSON []byte
+	err = s.db.Pool.QueryRow(ctx, `
+		SELECT groups FROM users WHERE provider = $1 AND external_id = $2
+	`, provider, externalID).Scan(&groupsJSON)
+	if err == pgx.ErrNoRows {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if len(groupsJSON) > 0 {
+		json.Unmarshal(groupsJSON, &groups)
+	}
+	return groups, true, nil
+}
+
+// RecordGroupHistory stores a group set for a user and drops all but the newest
+// GroupHistoryLimit entries.
+func (s *UserStore) RecordGroupHistory(ctx context.Context, userID string, groups, received []string, anomaly bool) error {
+	if groups == nil {
+		groups = []string{}
+	}
+	if received == nil {
+		received = []string{}
+	}
+	groupsJSON, err := json.Marshal(groups)
+	if err != nil {
+		return err
+	}
+	receivedJSON, err := json.Marshal(received)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO user_group_history (user_id, groups, received, anomaly)
+		VALUES ($1, $2, $3, $4)
+	`, userID, groupsJSON, receivedJSON, anomaly); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `
+		DELETE FROM user_group_history
+		WHERE user_id = $1 AND id NOT IN (
+			SELECT id FROM user_group_history WHERE user_id = $1
+			ORDER BY created_at DESC LIMIT $2
+		)
+	`, userID, GroupHistoryLimit); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// ListGroupHistory returns a user's recorded group sets, newest first.
+func (s *UserStore) ListGroupHistory(ctx context.Context, userID string) ([]GroupHistoryEntry, error) {
+	rows, err := s.db.Pool.Query(ctx, `
+		SELECT id, groups, received, anomaly, created_at
+		FROM user_group_history
+		WHERE user_id = $1
+		ORDER BY created_at DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []GroupHistoryEntry{}
+	for rows.Next() {
+		var e GroupHistoryEntry
+		var groupsJSON, receivedJSON []byte
+		if err := rows.Scan(&e.ID, &groupsJSON, &receivedJSON, &e.Anomaly, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		json.Unmarshal(groupsJSON, &e.Groups)
+		json.Unmarshal(receivedJSON, &e.Received)
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
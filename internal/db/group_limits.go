@@ -0,0 +1,184 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrGroupLimitNotFound is returned when a group has no connection limit.
+var ErrGroupLimitNotFound = errors.New("group connection limit not found")
+
+// GroupConnectionLimit caps how many members of a group may be connected at once.
+type GroupConnectionLimit struct {
+	GroupName string    `json:"group_name"`
+	MaxUsers  int       `json:"max_users"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ListGroupConnectionLimits returns every group connection limit, by group name.
+func (s *UserStore) ListGroupConnectionLimits(ctx context.Context) ([]*GroupConnectionLimit, error) {
+	tenant, args := tenantClause(ctx, "tenant_id", nil)
+	rows, err := s.db.Pool.Query(ctx, `
+		SELECT group_name, max_users, created_at, updated_at
+		FROM group_connection_limits
+		WHERE `+tenant+`
+		ORDER BY group_name
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var limits []*GroupConnectionLimit
+	for rows.Next() {
+		var l GroupConnectionLimit
+		if err := rows.Scan(&l.GroupName, &l.MaxUsers, &l.CreatedAt, &l.UpdatedAt); err != nil {
+			return nil, err
+		}
+		limits = append(limits, &l)
+	}
+	return limits, rows.Err()
+}
+
+// GetGroupConnectionLimits returns the limits set on any of groups.
+func (s *UserStore) GetGroupConnectionLimits(ctx context.Context, groups []string) ([]*GroupConnectionLimit, error) {
+	return groupConnectionLimits(ctx, s.db.Pool, groups)
+}
+
+// querier runs queries on the pool or inside a transaction.
+type querier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+func groupConnectionLimits(ctx context.Context, q querier, groups []string) ([]*GroupConnectionLimit, error) {
+	if len(groups) == 0 {
+		return nil, nil
+	}
+	tenant, args := tenantClause(ctx, "tenant_id", []interface{}{groups})
+	rows, err := q.Query(ctx, `
+		SELECT group_name, max_users, created_at, updated_at
+		FROM group_connection_limits
+		WHERE group_name = ANY($1) AND `+tenant+`
+		ORDER BY group_name
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var limits []*GroupConnectionLimit
+	for rows.Next() {
+		var l GroupConnectionLimit
+		if err := rows.Scan(&l.GroupName, &l.MaxUsers, &l.CreatedAt, &l.UpdatedAt); err != nil {
+			return nil, err
+		}
+		limits = append(limits, &l)
+	}
+	return limits, rows.Err()
+}
+
+// SetGroupConnectionLimit creates or replaces a group's connection limit.
+func (s *UserStore) SetGroupConnectionLimit(ctx context.Context, groupName string, maxUsers int) (*GroupConnectionLimit, error) {
+	l := GroupConnectionLimit{GroupName: groupName, MaxUsers: maxUsers}
+	err := s.db.Pool.QueryRow(ctx, `
+		INSERT INTO group_connection_limits (group_name, max_users, tenant_id)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (tenant_id, group_name) DO UPDATE SET
+			max_users = EXCLUDED.max_users,
+			updated_at = NOW()
+		RETURNING created_at, updated_at
+	`, groupName, maxUsers, tenantForInsert(ctx)).Scan(&l.CreatedAt, &l.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+// DeleteGroupConnectionLimit removes a group's connection limit.
+func (s *UserStore) DeleteGroupConnectionLimit(ctx context.Context, groupName string) error {
+	tenant, args := tenantClause(ctx, "tenant_id", []interface{}{groupName})
+	result, err := s.db.Pool.Exec(ctx, `
+		DELETE FROM group_connection_limits WHERE group_name = $1 AND `+tenant, args...)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return ErrGroupLimitNotFound
+	}
+	return nil
+}
+
+// CountConnectedGroupUsers returns how many members of a group have an open
+// connection, not counting excludeUserID.
+func (s *UserStore) CountConnectedGroupUsers(ctx context.Context, groupName, excludeUserID string) (int, error) {
+	return countConnectedGroupUsers(ctx, s.db.Pool, groupName, excludeUserID)
+}
+
+func countConnectedGroupUsers(ctx context.Context, q querier, groupName, excludeUserID string) (int, error) {
+	tenant, args := tenantClause(ctx, "u.tenant_id", []interface{}{groupName, excludeUserID})
+	var count int
+	err := q.QueryRow(ctx, `
+		SELECT COUNT(DISTINCT c.user_id)
+		FROM connections c
+		JOIN users u ON u.id = c.user_id
+		WHERE c.disconnected_at IS NULL AND u.groups ? $1 AND c.user_id::text <> $2 AND `+tenant,
+		args...).Scan(&count)
+	return count, err
+}
+
+// GroupLimitError reports the group connection limit a connection would exceed.
+type GroupLimitError struct {
+	GroupName string
+	Connected int
+	MaxUsers  int
+}
+
+func (e *GroupLimitError) Error() string {
+	return fmt.Sprintf("group '%s' connection limit reached (%d of %d users connected)", e.GroupName, e.Connected, e.MaxUsers)
+}
+
+// RecordConnectWithinGroupLimits records a connection as
+// ConnectionStore.RecordConnect does, unless one of the user's groups already has
+// as many other members connected as its limit allows, in which case it returns
+// a *GroupLimitError and records nothing. Each limited group is locked from the
+// count until the insert commits, so concurrent connects can't both take a
+// group's last place.
+func (s *UserStore) RecordConnectWithinGroupLimits(ctx context.Context, userID string, groups []string, gatewayID, clientIP, vpnIPv4, vpnIPv6, tunnelMode string) (string, error) {
+	tx, err := s.db.Pool.Begin(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	// Limits come back ordered by group name, so concurrent connects take the
+	// locks in the same order
+	limits, err := groupConnectionLimits(ctx, tx, groups)
+	if err != nil {
+		return "", err
+	}
+	tenantID, _ := TenantFromContext(ctx)
+	for _, limit := range limits {
+		if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext($1))`, "group_connection_limit:"+tenantID+":"+limit.GroupName); err != nil {
+			return "", err
+		}
+		connected, err := countConnectedGroupUsers(ctx, tx, limit.GroupName, userID)
+		if err != nil {
+			return "", err
+		}
+		if connected >= limit.MaxUsers {
+			return "", &GroupLimitError{GroupName: limit.GroupName, Connected: connected, MaxUsers: limit.MaxUsers}
+		}
+	}
+
+	id, err := recordConnect(ctx, tx, userID, gatewayID, clientIP, vpnIPv4, vpnIPv6, tunnelMode)
+	if err != nil {
+		return "", err
+	}
+	return id, tx.Commit(ctx)
+}
@@ -0,0 +1,146 @@
+package db
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// LDAPProvider represents an LDAP or Active Directory provider configuration
+type LDAPProvider struct {
+	ID                 string `json:"id"`
+	Name               string `json:"name"`
+	DisplayName        string `json:"display_name"`
+	URL                string `json:"url"`
+	BindDN             string `json:"bind_dn"`
+	BindPassword       string `json:"bind_password,omitempty"`
+	BaseDN             string `json:"base_dn"`
+	UserFilter         string `json:"user_filter"`
+	GroupFilter        string `json:"group_filter"`
+	GroupAttribute     string `json:"group_attribute"`
+	EmailAttribute     string `json:"email_attribute"`
+	NameAttribute      string `json:"name_attribute"`
+	StartTLS           bool   `json:"start_tls"`
+	InsecureSkipVerify bool   `json:"insecure_skip_verify"`
+	CACert             string `json:"ca_cert"`
+	AdminGroup         string `json:"admin_group,omitempty"`
+	Enabled            bool   `json:"enabled"`
+	// TenantID is the tenant the provider's users belong to
+	TenantID string `json:"tenant_id,omitempty"`
+}
+
+const ldapProviderColumns = `id, name, display_name, url, bind_dn, base_dn, user_filter, group_filter,
+	group_attribute, email_attribute, name_attribute, start_tls, insecure_skip_verify, ca_cert,
+	COALESCE(admin_group, ''), is_enabled`
+
+func scanLDAPProvider(row pgx.Row, extra ...interface{}) (*LDAPProvider, error) {
+	var p LDAPProvider
+	dest := []interface{}{&p.ID, &p.Name, &p.DisplayName, &p.URL, &p.BindDN, &p.BaseDN, &p.UserFilter, &p.GroupFilter,
+		&p.GroupAttribute, &p.EmailAttribute, &p.NameAttribute, &p.StartTLS, &p.InsecureSkipVerify, &p.CACert,
+		&p.AdminGroup, &p.Enabled}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// GetLDAPProviders returns all LDAP providers, without bind passwords
+func (s *ProviderStore) GetLDAPProviders(ctx context.Context) ([]*LDAPProvider, error) {
+	tenant, args := tenantClause(ctx, "tenant_id", nil)
+	rows, err := s.db.Pool.Query(ctx, `SELECT `+ldapProviderColumns+` FROM ldap_providers WHERE `+tenant+` ORDER BY name`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var providers []*LDAPProvider
+	for rows.Next() {
+		p, err := scanLDAPProvider(rows)
+		if err != nil {
+			return nil, err
+		}
+		providers = append(providers, p)
+	}
+	return providers, rows.Err()
+}
+
+// GetLDAPProvider returns an LDAP provider by name, including its bind password
+func (s *ProviderStore) GetLDAPProvider(ctx context.Context, name string) (*LDAPProvider, error) {
+	var bindPassword, tenantID string
+	tenant, args := tenantClause(ctx, "tenant_id", []interface{}{name})
+	p, err := scanLDAPProvider(s.db.Pool.QueryRow(ctx, `
+		SELECT `+ldapProviderColumns+`, bind_password, tenant_id FROM ldap_providers WHERE name = $1 AND `+tenant,
+		args...), &bindPassword, &tenantID)
+	if err == pgx.ErrNoRows {
+		return nil, ErrProviderNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if p.BindPassword, err = s.db.open(bindPassword); err != nil {
+		return nil, err
+	}
+	p.TenantID = tenantID
+	return p, nil
+}
+
+func (s *ProviderStore) CreateLDAPProvider(ctx context.Context, p *LDAPProvider) error {
+	if taken, err := s.providerNameTaken(ctx, p.Name); err != nil {
+		return err
+	} else if taken {
+		return ErrProviderExists
+	}
+	bindPassword, err := s.db.seal(p.BindPassword)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Pool.Exec(ctx, `
+		INSERT INTO ldap_providers (name, display_name, url, bind_dn, bind_password, base_dn, user_filter, group_filter,
+			group_attribute, email_attribute, name_attribute, start_tls, insecure_skip_verify, ca_cert, admin_group, is_enabled, tenant_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, NULLIF($15, ''), $16, $17)
+	`, p.Name, p.DisplayName, p.URL, p.BindDN, bindPassword, p.BaseDN, p.UserFilter, p.GroupFilter,
+		p.GroupAttribute, p.EmailAttribute, p.NameAttribute, p.StartTLS, p.InsecureSkipVerify, p.CACert, p.AdminGroup, p.Enabled, tenantForInsert(ctx))
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return ErrProviderExists
+	}
+	return err
+}
+
+// UpdateLDAPProvider updates an LDAP provider; an empty bind password keeps the stored one
+func (s *ProviderStore) UpdateLDAPProvider(ctx context.Context, name string, p *LDAPProvider) error {
+	bindPassword, err := s.db.seal(p.BindPassword)
+	if err != nil {
+		return err
+	}
+	tenant, args := tenantClause(ctx, "tenant_id", []interface{}{name, p.DisplayName, p.URL, p.BindDN, bindPassword, p.BaseDN, p.UserFilter, p.GroupFilter,
+		p.GroupAttribute, p.EmailAttribute, p.NameAttribute, p.StartTLS, p.InsecureSkipVerify, p.CACert, p.AdminGroup, p.Enabled})
+	result, err := s.db.Pool.Exec(ctx, `
+		UPDATE ldap_providers
+		SET display_name = $2, url = $3, bind_dn = $4, bind_password = COALESCE(NULLIF($5, ''), bind_password),
+			base_dn = $6, user_filter = $7, group_filter = $8, group_attribute = $9, email_attribute = $10,
+			name_attribute = $11, start_tls = $12, insecure_skip_verify = $13, ca_cert = $14,
+			admin_group = NULLIF($15, ''), is_enabled = $16, updated_at = NOW()
+		WHERE name = $1 AND `+tenant, args...)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return ErrProviderNotFound
+	}
+	return nil
+}
+
+func (s *ProviderStore) DeleteLDAPProvider(ctx context.Context, name string) error {
+	tenant, args := tenantClause(ctx, "tenant_id", []interface{}{name})
+	result, err := s.db.Pool.Exec(ctx, `DELETE FROM ldap_providers WHERE name = $1 AND `+tenant, args...)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return ErrProviderNotFound
+	}
+	return nil
+}
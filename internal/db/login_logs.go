@@ -60,101 +60,134 @@ func NewLoginLogStore(db *DB) *LoginLogStore {
 	return &LoginLogStore{db: db}
 }
 
-// Create inserts a new login log entry
+// Create inserts a new login log entry, setting its ID and creation time. The
+// entry belongs to the user's tenant or, for unknown users, the provider's.
 func (s *LoginLogStore) Create(ctx context.Context, log *LoginLog) error {
-	_, err := s.db.Pool.Exec(ctx, `
+	return s.db.Pool.QueryRow(ctx, `
 		INSERT INTO login_logs (
 			user_id, user_email, user_name, provider, provider_name,
-			ip_address, user_agent, country, country_code, city, success, failure_reason, session_id
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+			ip_address, user_agent, country, country_code, city, success, failure_reason, session_id, tenant_id
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, COALESCE(
+			(SELECT tenant_id FROM users WHERE id::text = $1::text),
+			(SELECT tenant_id FROM local_users WHERE id::text = $1::text),
+			`+providerTenantSQL("$4", "$5")+`))
+		RETURNING id, created_at
 	`, log.UserID, log.UserEmail, log.UserName, log.Provider, log.ProviderName,
-		log.IPAddress, log.UserAgent, log.Country, log.CountryCode, log.City, log.Success, log.FailureReason, log.SessionID)
+		log.IPAddress, log.UserAgent, log.Country, log.CountryCode, log.City, log.Success, log.FailureReason, log.SessionID,
+	).Scan(&log.ID, &log.CreatedAt)
+}
+
+// UpdateLocation sets the geolocation of a login log entry after an asynchronous lookup
+func (s *LoginLogStore) UpdateLocation(ctx context.Context, id, country, countryCode, city string) error {
+	_, err := s.db.Pool.Exec(ctx, `
+		UPDATE login_logs SET country = $2, country_code = $3, city = $4 WHERE id = $1
+	`, id, country, countryCode, city)
 	return err
 }
 
 // List retrieves login logs with optional filtering
 func (s *LoginLogStore) List(ctx context.Context, filter *LoginLogFilter) ([]*LoginLog, int, error) {
-	// Build query with filters
-	baseQuery := `
+	where, args := loginLogConditions(ctx, filter)
+	argNum := len(args) + 1
+
+	// Get total count
+	var total int
+	err := s.db.Pool.QueryRow(ctx, "SELECT COUNT(*) FROM login_logs WHERE 1=1"+where, args...).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// Add ordering and pagination
+	baseQuery := loginLogSelect + where + ` ORDER BY created_at DESC`
+	if filter.Limit > 0 {
+		baseQuery += ` LIMIT $` + itoa(argNum)
+		args = append(args, filter.Limit)
+		argNum++
+	}
+	if filter.Offset > 0 {
+		baseQuery += ` OFFSET $` + itoa(argNum)
+		args = append(args, filter.Offset)
+	}
+
+	var logs []*LoginLog
+	err = s.query(ctx, baseQuery, args, func(log *LoginLog) error {
+		logs = append(logs, log)
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return logs, total, nil
+}
+
+// Each calls fn for every login log matching the filter, newest first, without
+// loading the whole result into memory. Limit and Offset are ignored.
+func (s *LoginLogStore) Each(ctx context.Context, filter *LoginLogFilter, fn func(*LoginLog) error) error {
+	where, args := loginLogConditions(ctx, filter)
+	return s.query(ctx, loginLogSelect+where+` ORDER BY created_at DESC`, args, fn)
+}
+
+const loginLogSelect = `
 		SELECT id, user_id, user_email, COALESCE(user_name, ''), provider, COALESCE(provider_name, ''),
 		       host(ip_address), COALESCE(user_agent, ''), COALESCE(country, ''), COALESCE(country_code, ''), COALESCE(city, ''),
 		       success, COALESCE(failure_reason, ''), COALESCE(session_id, ''), created_at
 		FROM login_logs
 		WHERE 1=1
 	`
-	countQuery := "SELECT COUNT(*) FROM login_logs WHERE 1=1"
+
+// loginLogConditions builds the WHERE conditions for a filter, to be appended after
+// "WHERE 1=1", scoped to the tenant in ctx if any.
+func loginLogConditions(ctx context.Context, filter *LoginLogFilter) (string, []interface{}) {
+	where := ""
 	args := []interface{}{}
 	argNum := 1
 
 	if filter.UserEmail != "" {
-		baseQuery += ` AND user_email ILIKE $` + itoa(argNum)
-		countQuery += ` AND user_email ILIKE $` + itoa(argNum)
+		where += ` AND user_email ILIKE $` + itoa(argNum)
 		args = append(args, "%"+filter.UserEmail+"%")
 		argNum++
 	}
 	if filter.UserID != "" {
-		baseQuery += ` AND user_id = $` + itoa(argNum)
-		countQuery += ` AND user_id = $` + itoa(argNum)
+		where += ` AND user_id = $` + itoa(argNum)
 		args = append(args, filter.UserID)
 		argNum++
 	}
 	if filter.IPAddress != "" {
-		baseQuery += ` AND host(ip_address) LIKE $` + itoa(argNum)
-		countQuery += ` AND host(ip_address) LIKE $` + itoa(argNum)
+		where += ` AND host(ip_address) LIKE $` + itoa(argNum)
 		args = append(args, "%"+filter.IPAddress+"%")
 		argNum++
 	}
 	if filter.Provider != "" {
-		baseQuery += ` AND provider = $` + itoa(argNum)
-		countQuery += ` AND provider = $` + itoa(argNum)
+		where += ` AND provider = $` + itoa(argNum)
 		args = append(args, filter.Provider)
 		argNum++
 	}
 	if filter.Success != nil {
-		baseQuery += ` AND success = $` + itoa(argNum)
-		countQuery += ` AND success = $` + itoa(argNum)
+		where += ` AND success = $` + itoa(argNum)
 		args = append(args, *filter.Success)
 		argNum++
 	}
 	if filter.StartTime != nil {
-		baseQuery += ` AND created_at >= $` + itoa(argNum)
-		countQuery += ` AND created_at >= $` + itoa(argNum)
+		where += ` AND created_at >= $` + itoa(argNum)
 		args = append(args, *filter.StartTime)
 		argNum++
 	}
 	if filter.EndTime != nil {
-		baseQuery += ` AND created_at <= $` + itoa(argNum)
-		countQuery += ` AND created_at <= $` + itoa(argNum)
+		where += ` AND created_at <= $` + itoa(argNum)
 		args = append(args, *filter.EndTime)
-		argNum++
-	}
-
-	// Get total count
-	var total int
-	err := s.db.Pool.QueryRow(ctx, countQuery, args...).Scan(&total)
-	if err != nil {
-		return nil, 0, err
-	}
-
-	// Add ordering and pagination
-	baseQuery += ` ORDER BY created_at DESC`
-	if filter.Limit > 0 {
-		baseQuery += ` LIMIT $` + itoa(argNum)
-		args = append(args, filter.Limit)
-		argNum++
-	}
-	if filter.Offset > 0 {
-		baseQuery += ` OFFSET $` + itoa(argNum)
-		args = append(args, filter.Offset)
 	}
+	tenant, args := tenantClause(ctx, "tenant_id", args)
+	return where + ` AND ` + tenant, args
+}
 
-	rows, err := s.db.Pool.Query(ctx, baseQuery, args...)
+// query runs a login log query and calls fn for each row.
+func (s *LoginLogStore) query(ctx context.Context, query string, args []interface{}, fn func(*LoginLog) error) error {
+	rows, err := s.db.Pool.Query(ctx, query, args...)
 	if err != nil {
-		return nil, 0, err
+		return err
 	}
 	defer rows.Close()
 
-	var logs []*LoginLog
 	for rows.Next() {
 		var log LoginLog
 		if err := rows.Scan(
@@ -162,11 +195,13 @@ func (s *LoginLogStore) List(ctx context.Context, filter *LoginLogFilter) ([]*Lo
 			&log.IPAddress, &log.UserAgent, &log.Country, &log.CountryCode, &log.City,
 			&log.Success, &log.FailureReason, &log.SessionID, &log.CreatedAt,
 		); err != nil {
-			return nil, 0, err
+			return err
+		}
+		if err := fn(&log); err != nil {
+			return err
 		}
-		logs = append(logs, &log)
 	}
-	return logs, total, rows.Err()
+	return rows.Err()
 }
 
 // GetStats retrieves aggregated login statistics
@@ -177,6 +212,7 @@ func (s *LoginLogStore) GetStats(ctx context.Context, days int) (*LoginLogStats,
 	}
 
 	since := time.Now().AddDate(0, 0, -days)
+	tenant, args := tenantClause(ctx, "tenant_id", []interface{}{since})
 
 	// Get total counts
 	err := s.db.Pool.QueryRow(ctx, `
@@ -187,8 +223,7 @@ func (s *LoginLogStore) GetStats(ctx context.Context, days int) (*LoginLogStats,
 			COUNT(DISTINCT user_email) as unique_users,
 			COUNT(DISTINCT ip_address) as unique_ips
 		FROM login_logs
-		WHERE created_at >= $1
-	`, since).Scan(&stats.TotalLogins, &stats.SuccessfulLogins, &stats.FailedLogins, &stats.UniqueUsers, &stats.UniqueIPs)
+		WHERE created_at >= $1 AND `+tenant, args...).Scan(&stats.TotalLogins, &stats.SuccessfulLogins, &stats.FailedLogins, &stats.UniqueUsers, &stats.UniqueIPs)
 	if err != nil {
 		return nil, err
 	}
@@ -197,9 +232,9 @@ func (s *LoginLogStore) GetStats(ctx context.Context, days int) (*LoginLogStats,
 	rows, err := s.db.Pool.Query(ctx, `
 		SELECT provider, COUNT(*)
 		FROM login_logs
-		WHERE created_at >= $1
+		WHERE created_at >= $1 AND `+tenant+`
 		GROUP BY provider
-	`, since)
+	`, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -218,11 +253,11 @@ func (s *LoginLogStore) GetStats(ctx context.Context, days int) (*LoginLogStats,
 	rows, err = s.db.Pool.Query(ctx, `
 		SELECT COALESCE(country, 'Unknown'), COUNT(*)
 		FROM login_logs
-		WHERE created_at >= $1
+		WHERE created_at >= $1 AND `+tenant+`
 		GROUP BY country
 		ORDER BY COUNT(*) DESC
 		LIMIT 10
-	`, since)
+	`, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -243,10 +278,10 @@ func (s *LoginLogStore) GetStats(ctx context.Context, days int) (*LoginLogStats,
 		       host(ip_address), COALESCE(user_agent, ''), COALESCE(country, ''), COALESCE(country_code, ''), COALESCE(city, ''),
 		       success, COALESCE(failure_reason, ''), COALESCE(session_id, ''), created_at
 		FROM login_logs
-		WHERE success = false AND created_at >= $1
+		WHERE success = false AND created_at >= $1 AND `+tenant+`
 		ORDER BY created_at DESC
 		LIMIT 10
-	`, since)
+	`, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -267,12 +302,13 @@ func (s *LoginLogStore) GetStats(ctx context.Context, days int) (*LoginLogStats,
 	return stats, nil
 }
 
-// DeleteOlderThan removes login logs older than the specified duration
+// DeleteOlderThan removes login logs older than the specified duration, within
+// the tenant in ctx if any
 func (s *LoginLogStore) DeleteOlderThan(ctx context.Context, days int) (int64, error) {
 	cutoff := time.Now().AddDate(0, 0, -days)
+	tenant, args := tenantClause(ctx, "tenant_id", []interface{}{cutoff})
 	result, err := s.db.Pool.Exec(ctx, `
-		DELETE FROM login_logs WHERE created_at < $1
-	`, cutoff)
+		DELETE FROM login_logs WHERE created_at < $1 AND `+tenant, args...)
 	if err != nil {
 		return 0, err
 	}
@@ -284,15 +320,16 @@ func (s *LoginLogStore) GetUserLoginHistory(ctx context.Context, userEmail strin
 	if limit <= 0 {
 		limit = 50
 	}
+	tenant, args := tenantClause(ctx, "tenant_id", []interface{}{userEmail, limit})
 	rows, err := s.db.Pool.Query(ctx, `
 		SELECT id, user_id, user_email, COALESCE(user_name, ''), provider, COALESCE(provider_name, ''),
 		       host(ip_address), COALESCE(user_agent, ''), COALESCE(country, ''), COALESCE(country_code, ''), COALESCE(city, ''),
 		       success, COALESCE(failure_reason, ''), COALESCE(session_id, ''), created_at
 		FROM login_logs
-		WHERE user_email = $1
+		WHERE user_email = $1 AND `+tenant+`
 		ORDER BY created_at DESC
 		LIMIT $2
-	`, userEmail, limit)
+	`, args...)
 	if err != nil {
 		return nil, err
 	}
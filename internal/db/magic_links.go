@@ -0,0 +1,63 @@
+package db
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrMagicLinkInvalid is returned when a magic-link token is unknown, expired or
+// already used. The cases aren't distinguished to callers.
+var ErrMagicLinkInvalid = errors.New("invalid or expired link")
+
+// hashMagicLinkToken returns the stored form of a magic-link token.
+func hashMagicLinkToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateMagicLinkToken stores a one-time login token for a local user. Expired
+// tokens are pruned at the same time.
+func (s *UserStore) CreateMagicLinkToken(ctx context.Context, userID, token, ipAddress string, expiresAt time.Time) error {
+	if _, err := s.db.Pool.Exec(ctx, `DELETE FROM magic_link_tokens WHERE expires_at < NOW()`); err != nil {
+		return err
+	}
+	_, err := s.db.Pool.Exec(ctx, `
+		INSERT INTO magic_link_tokens (user_id, token_hash, ip_address, expires_at)
+		VALUES ($1, $2, $3, $4)
+	`, userID, hashMagicLinkToken(token), ipAddress, expiresAt)
+	return err
+}
+
+// LastMagicLinkSent returns when the most recent magic link for a user was
+// created, or nil if none is outstanding.
+func (s *UserStore) LastMagicLinkSent(ctx context.Context, userID string) (*time.Time, error) {
+	var createdAt *time.Time
+	err := s.db.Pool.QueryRow(ctx, `
+		SELECT MAX(created_at) FROM magic_link_tokens
+		WHERE user_id = $1 AND expires_at > NOW()
+	`, userID).Scan(&createdAt)
+	return createdAt, err
+}
+
+// ConsumeMagicLinkToken marks a token used and returns its user. The update only
+// matches unused, unexpired tokens, so concurrent requests can't both succeed.
+func (s *UserStore) ConsumeMagicLinkToken(ctx context.Context, token string) (*LocalUser, error) {
+	var userID string
+	err := s.db.Pool.QueryRow(ctx, `
+		UPDATE magic_link_tokens SET used_at = NOW()
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+		RETURNING user_id
+	`, hashMagicLinkToken(token)).Scan(&userID)
+	if err == pgx.ErrNoRows {
+		return nil, ErrMagicLinkInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.GetUserByID(ctx, userID)
+}
@@ -0,0 +1,163 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	ErrMaintenanceWindowNotFound = errors.New("maintenance window not found")
+	ErrMaintenanceWindowExists   = errors.New("another maintenance window is already scheduled or running")
+)
+
+// Maintenance window statuses
+const (
+	MaintenanceScheduled  = "scheduled"
+	MaintenanceRunning    = "running"     // CA activated; waiting for components to converge
+	MaintenanceCompleted  = "completed"   // Enough components converged
+	MaintenanceRolledBack = "rolled_back" // Too few converged, so the previous CA was re-activated
+	MaintenanceFailed     = "failed"      // The CA couldn't be activated, or the rollback failed
+	MaintenanceCancelled  = "cancelled"
+)
+
+// MaintenanceWindow is a CA activation and fleet reprovision scheduled for a
+// maintenance window.
+type MaintenanceWindow struct {
+	ID               string
+	CAID             string // Pending CA to activate
+	Description      string
+	ScheduledAt      time.Time
+	ConvergeMinutes  int // How long components have to converge after activation
+	MaxFailedPercent int // Roll back if more than this share hasn't converged by then
+	Status           string
+	PreviousCAID     string // Active CA before the window; what a rollback re-activates
+	Outcome          string // What happened, once the window has finished
+	CreatedBy        string
+	CreatedAt        time.Time
+	StartedAt        *time.Time
+	FinishedAt       *time.Time
+}
+
+// ConvergeDeadline is when components must have converged by.
+func (w *MaintenanceWindow) ConvergeDeadline() time.Time {
+	start := w.ScheduledAt
+	if w.StartedAt != nil {
+		start = *w.StartedAt
+	}
+	return start.Add(time.Duration(w.ConvergeMinutes) * time.Minute)
+}
+
+// MaintenanceStore handles maintenance window persistence
+type MaintenanceStore struct {
+	db *DB
+}
+
+// NewMaintenanceStore creates a new maintenance window store
+func NewMaintenanceStore(db *DB) *MaintenanceStore {
+	return &MaintenanceStore{db: db}
+}
+
+const maintenanceWindowColumns = `id, ca_id, description, scheduled_at, converge_minutes, max_failed_percent, status,
+		previous_ca_id, outcome, created_by, created_at, started_at, finished_at`
+
+func scanMaintenanceWindow(row pgx.Row) (*MaintenanceWindow, error) {
+	var w MaintenanceWindow
+	err := row.Scan(&w.ID, &w.CAID, &w.Description, &w.ScheduledAt, &w.ConvergeMinutes, &w.MaxFailedPercent, &w.Status,
+		&w.PreviousCAID, &w.Outcome, &w.CreatedBy, &w.CreatedAt, &w.StartedAt, &w.FinishedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &w, nil
+}
+
+func (s *MaintenanceStore) query(ctx context.Context, sql string, args ...interface{}) ([]*MaintenanceWindow, error) {
+	rows, err := s.db.Pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var windows []*MaintenanceWindow
+	for rows.Next() {
+		w, err := scanMaintenanceWindow(rows)
+		if err != nil {
+			return nil, err
+		}
+		windows = append(windows, w)
+	}
+	return windows, rows.Err()
+}
+
+// Create schedules a maintenance window
+func (s *MaintenanceStore) Create(ctx context.Context, w *MaintenanceWindow) error {
+	err := s.db.Pool.QueryRow(ctx, `
+		INSERT INTO maintenance_windows (ca_id, description, scheduled_at, converge_minutes, max_failed_percent, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, status, created_at
+	`, w.CAID, w.Description, w.ScheduledAt, w.ConvergeMinutes, w.MaxFailedPercent, w.CreatedBy).Scan(&w.ID, &w.Status, &w.CreatedAt)
+	if isUniqueViolation(err) {
+		return ErrMaintenanceWindowExists
+	}
+	return err
+}
+
+// Get retrieves a maintenance window by ID
+func (s *MaintenanceStore) Get(ctx context.Context, id string) (*MaintenanceWindow, error) {
+	w, err := scanMaintenanceWindow(s.db.Pool.QueryRow(ctx, `
+		SELECT `+maintenanceWindowColumns+` FROM maintenance_windows WHERE id::text = $1
+	`, id))
+	if err == pgx.ErrNoRows {
+		return nil, ErrMaintenanceWindowNotFound
+	}
+	return w, err
+}
+
+// List returns maintenance windows, most recently scheduled first
+func (s *MaintenanceStore) List(ctx context.Context, limit int) ([]*MaintenanceWindow, error) {
+	return s.query(ctx, `
+		SELECT `+maintenanceWindowColumns+` FROM maintenance_windows
+		ORDER BY scheduled_at DESC
+		LIMIT $1
+	`, limit)
+}
+
+// ListRunning returns the windows waiting for components to converge
+func (s *MaintenanceStore) ListRunning(ctx context.Context) ([]*MaintenanceWindow, error) {
+	return s.query(ctx, `
+		SELECT `+maintenanceWindowColumns+` FROM maintenance_windows WHERE status = 'running'
+	`)
+}
+
+// ClaimDue marks scheduled windows whose time has come as running and returns
+// them. Each window is returned to only one caller, so with several servers
+// only one carries it out.
+func (s *MaintenanceStore) ClaimDue(ctx context.Context) ([]*MaintenanceWindow, error) {
+	return s.query(ctx, `
+		UPDATE maintenance_windows SET status = 'running', started_at = NOW()
+		WHERE status = 'scheduled' AND scheduled_at <= NOW()
+		RETURNING `+maintenanceWindowColumns)
+}
+
+// SetPreviousCA records the CA that was active when a window started
+func (s *MaintenanceStore) SetPreviousCA(ctx context.Context, id, caID string) error {
+	_, err := s.db.Pool.Exec(ctx, `
+		UPDATE maintenance_windows SET previous_ca_id = $2 WHERE id::text = $1
+	`, id, caID)
+	return err
+}
+
+// Finish moves a window from one status to a final one. It returns false if the
+// window wasn't in that status, such as when another server finished it first.
+func (s *MaintenanceStore) Finish(ctx context.Context, id, from, status, outcome string) (bool, error) {
+	result, err := s.db.Pool.Exec(ctx, `
+		UPDATE maintenance_windows SET status = $3, outcome = $4, finished_at = NOW()
+		WHERE id::text = $1 AND status = $2
+	`, id, from, status, outcome)
+	if err != nil {
+		return false, err
+	}
+	return result.RowsAffected() > 0, nil
+}
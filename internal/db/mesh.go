@@ -54,6 +54,7 @@ type MeshHub struct {
 	CryptoProfile  string
 	TLSAuthEnabled bool
 	TLSAuthKey     string
+	TLSMode        string // "auth" (tls-auth) or "crypt" (tls-crypt), used when TLSAuthEnabled
 
 	// VPN client configuration
 	FullTunnelMode bool     // Route all client traffic through hub
@@ -177,23 +178,28 @@ func (s *MeshStore) CreateHub(ctx context.Context, hub *MeshHub) error {
 	if hub.Status == "" {
 		hub.Status = MeshHubStatusPending
 	}
+	hub.TLSMode = tlsModeOrDefault(hub.TLSMode)
+	tlsAuthKey, caKey, serverKey, err := s.sealHubSecrets(hub.TLSAuthKey, hub.CAKey, hub.ServerKey)
+	if err != nil {
+		return err
+	}
 
-	_, err := s.db.Pool.Exec(ctx, `
+	_, err = s.db.Pool.Exec(ctx, `
 		INSERT INTO mesh_hubs (
 			name, description, public_endpoint, vpn_port, vpn_protocol, vpn_subnet,
-			crypto_profile, tls_auth_enabled, tls_auth_key,
+			crypto_profile, tls_auth_enabled, tls_auth_key, tls_mode,
 			ca_cert, ca_key, server_cert, server_key, dh_params,
 			api_token, control_plane_url, status, status_message
 		) VALUES (
 			$1, $2, $3, $4, $5, $6::cidr,
-			$7, $8, $9,
+			$7, $8, $9, $19,
 			$10, $11, $12, $13, $14,
 			$15, $16, $17, $18
 		)
 	`, hub.Name, hub.Description, hub.PublicEndpoint, hub.VPNPort, hub.VPNProtocol, hub.VPNSubnet,
-		hub.CryptoProfile, hub.TLSAuthEnabled, hub.TLSAuthKey,
-		hub.CACert, hub.CAKey, hub.ServerCert, hub.ServerKey, hub.DHParams,
-		hub.APIToken, hub.ControlPlaneURL, hub.Status, hub.StatusMessage)
+		hub.CryptoProfile, hub.TLSAuthEnabled, tlsAuthKey,
+		hub.CACert, caKey, hub.ServerCert, serverKey, hub.DHParams,
+		hub.APIToken, hub.ControlPlaneURL, hub.Status, hub.StatusMessage, hub.TLSMode)
 
 	if err != nil && strings.Contains(err.Error(), "duplicate key") {
 		return ErrMeshHubExists
@@ -209,7 +215,7 @@ func (s *MeshStore) GetHub(ctx context.Context, id string) (*MeshHub, error) {
 		SELECT id, name, description,
 			public_endpoint, vpn_port, vpn_protocol, vpn_subnet::text,
 			COALESCE(local_networks, '{}'),
-			crypto_profile, tls_auth_enabled, COALESCE(tls_auth_key, ''),
+			crypto_profile, tls_auth_enabled, COALESCE(tls_auth_key, ''), tls_mode,
 			COALESCE(full_tunnel_mode, false), COALESCE(push_dns, false), COALESCE(dns_servers, '{}'),
 			COALESCE(ca_cert, ''), COALESCE(ca_key, ''), COALESCE(server_cert, ''), COALESCE(server_key, ''), COALESCE(dh_params, ''),
 			api_token, control_plane_url,
@@ -221,7 +227,7 @@ func (s *MeshStore) GetHub(ctx context.Context, id string) (*MeshHub, error) {
 		&hub.ID, &hub.Name, &hub.Description,
 		&hub.PublicEndpoint, &hub.VPNPort, &hub.VPNProtocol, &vpnSubnet,
 		&hub.LocalNetworks,
-		&hub.CryptoProfile, &hub.TLSAuthEnabled, &hub.TLSAuthKey,
+		&hub.CryptoProfile, &hub.TLSAuthEnabled, &hub.TLSAuthKey, &hub.TLSMode,
 		&hub.FullTunnelMode, &hub.PushDNS, &hub.DNSServers,
 		&hub.CACert, &hub.CAKey, &hub.ServerCert, &hub.ServerKey, &hub.DHParams,
 		&hub.APIToken, &hub.ControlPlaneURL,
@@ -239,6 +245,9 @@ func (s *MeshStore) GetHub(ctx context.Context, id string) (*MeshHub, error) {
 	if vpnSubnet != nil {
 		hub.VPNSubnet = *vpnSubnet
 	}
+	if err := s.openHubSecrets(&hub); err != nil {
+		return nil, err
+	}
 	return &hub, nil
 }
 
@@ -250,7 +259,7 @@ func (s *MeshStore) GetHubByToken(ctx context.Context, token string) (*MeshHub,
 		SELECT id, name, description,
 			public_endpoint, vpn_port, vpn_protocol, vpn_subnet::text,
 			COALESCE(local_networks, '{}'),
-			crypto_profile, tls_auth_enabled, COALESCE(tls_auth_key, ''),
+			crypto_profile, tls_auth_enabled, COALESCE(tls_auth_key, ''), tls_mode,
 			COALESCE(full_tunnel_mode, false), COALESCE(push_dns, false), COALESCE(dns_servers, '{}'),
 			COALESCE(ca_cert, ''), COALESCE(ca_key, ''), COALESCE(server_cert, ''), COALESCE(server_key, ''), COALESCE(dh_params, ''),
 			api_token, control_plane_url,
@@ -262,7 +271,7 @@ func (s *MeshStore) GetHubByToken(ctx context.Context, token string) (*MeshHub,
 		&hub.ID, &hub.Name, &hub.Description,
 		&hub.PublicEndpoint, &hub.VPNPort, &hub.VPNProtocol, &vpnSubnet,
 		&hub.LocalNetworks,
-		&hub.CryptoProfile, &hub.TLSAuthEnabled, &hub.TLSAuthKey,
+		&hub.CryptoProfile, &hub.TLSAuthEnabled, &hub.TLSAuthKey, &hub.TLSMode,
 		&hub.FullTunnelMode, &hub.PushDNS, &hub.DNSServers,
 		&hub.CACert, &hub.CAKey, &hub.ServerCert, &hub.ServerKey, &hub.DHParams,
 		&hub.APIToken, &hub.ControlPlaneURL,
@@ -280,6 +289,9 @@ func (s *MeshStore) GetHubByToken(ctx context.Context, token string) (*MeshHub,
 	if vpnSubnet != nil {
 		hub.VPNSubnet = *vpnSubnet
 	}
+	if err := s.openHubSecrets(&hub); err != nil {
+		return nil, err
+	}
 	return &hub, nil
 }
 
@@ -292,7 +304,7 @@ func (s *MeshStore) GetHubByName(name string) (*MeshHub, error) {
 		SELECT id, name, description,
 			public_endpoint, vpn_port, vpn_protocol, vpn_subnet::text,
 			COALESCE(local_networks, '{}'),
-			crypto_profile, tls_auth_enabled, COALESCE(tls_auth_key, ''),
+			crypto_profile, tls_auth_enabled, COALESCE(tls_auth_key, ''), tls_mode,
 			COALESCE(full_tunnel_mode, false), COALESCE(push_dns, false), COALESCE(dns_servers, '{}'),
 			COALESCE(ca_cert, ''), COALESCE(ca_key, ''), COALESCE(server_cert, ''), COALESCE(server_key, ''), COALESCE(dh_params, ''),
 			api_token, control_plane_url,
@@ -304,7 +316,7 @@ func (s *MeshStore) GetHubByName(name string) (*MeshHub, error) {
 		&hub.ID, &hub.Name, &hub.Description,
 		&hub.PublicEndpoint, &hub.VPNPort, &hub.VPNProtocol, &vpnSubnet,
 		&hub.LocalNetworks,
-		&hub.CryptoProfile, &hub.TLSAuthEnabled, &hub.TLSAuthKey,
+		&hub.CryptoProfile, &hub.TLSAuthEnabled, &hub.TLSAuthKey, &hub.TLSMode,
 		&hub.FullTunnelMode, &hub.PushDNS, &hub.DNSServers,
 		&hub.CACert, &hub.CAKey, &hub.ServerCert, &hub.ServerKey, &hub.DHParams,
 		&hub.APIToken, &hub.ControlPlaneURL,
@@ -322,6 +334,9 @@ func (s *MeshStore) GetHubByName(name string) (*MeshHub, error) {
 	if vpnSubnet != nil {
 		hub.VPNSubnet = *vpnSubnet
 	}
+	if err := s.openHubSecrets(&hub); err != nil {
+		return nil, err
+	}
 	return &hub, nil
 }
 
@@ -330,7 +345,7 @@ func (s *MeshStore) ListHubs(ctx context.Context) ([]*MeshHub, error) {
 	rows, err := s.db.Pool.Query(ctx, `
 		SELECT id, name, description,
 			public_endpoint, vpn_port, vpn_protocol, vpn_subnet::text,
-			crypto_profile, tls_auth_enabled,
+			crypto_profile, tls_auth_enabled, tls_mode,
 			COALESCE(full_tunnel_mode, false), COALESCE(push_dns, false), COALESCE(dns_servers, '{}'),
 			status, COALESCE(status_message, ''), last_heartbeat, connected_gateways, connected_clients,
 			created_at, updated_at
@@ -349,7 +364,7 @@ func (s *MeshStore) ListHubs(ctx context.Context) ([]*MeshHub, error) {
 		if err := rows.Scan(
 			&hub.ID, &hub.Name, &hub.Description,
 			&hub.PublicEndpoint, &hub.VPNPort, &hub.VPNProtocol, &vpnSubnet,
-			&hub.CryptoProfile, &hub.TLSAuthEnabled,
+			&hub.CryptoProfile, &hub.TLSAuthEnabled, &hub.TLSMode,
 			&hub.FullTunnelMode, &hub.PushDNS, &hub.DNSServers,
 			&hub.Status, &hub.StatusMessage, &hub.LastHeartbeat, &hub.ConnectedSpokes, &hub.ConnectedClients,
 			&hub.CreatedAt, &hub.UpdatedAt,
@@ -371,12 +386,12 @@ func (s *MeshStore) UpdateHub(ctx context.Context, hub *MeshHub) error {
 			name = $2, description = $3,
 			public_endpoint = $4, vpn_port = $5, vpn_protocol = $6, vpn_subnet = $7::cidr,
 			crypto_profile = $8, tls_auth_enabled = $9, local_networks = $10,
-			full_tunnel_mode = $11, push_dns = $12, dns_servers = $13
+			full_tunnel_mode = $11, push_dns = $12, dns_servers = $13, tls_mode = $14
 		WHERE id = $1
 	`, hub.ID, hub.Name, hub.Description,
 		hub.PublicEndpoint, hub.VPNPort, hub.VPNProtocol, hub.VPNSubnet,
 		hub.CryptoProfile, hub.TLSAuthEnabled, hub.LocalNetworks,
-		hub.FullTunnelMode, hub.PushDNS, hub.DNSServers)
+		hub.FullTunnelMode, hub.PushDNS, hub.DNSServers, tlsModeOrDefault(hub.TLSMode))
 
 	if err != nil {
 		if strings.Contains(err.Error(), "duplicate key") {
@@ -392,7 +407,11 @@ func (s *MeshStore) UpdateHub(ctx context.Context, hub *MeshHub) error {
 
 // UpdateHubPKI updates the PKI certificates for a hub
 func (s *MeshStore) UpdateHubPKI(ctx context.Context, hubID string, caCert, caKey, serverCert, serverKey, dhParams, tlsAuthKey string) error {
-	_, err := s.db.Pool.Exec(ctx, `
+	tlsAuthKey, caKey, serverKey, err := s.sealHubSecrets(tlsAuthKey, caKey, serverKey)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Pool.Exec(ctx, `
 		UPDATE mesh_hubs SET
 			ca_cert = $2, ca_key = $3, server_cert = $4, server_key = $5, dh_params = $6, tls_auth_key = $7,
 			updated_at = NOW()
@@ -401,6 +420,34 @@ func (s *MeshStore) UpdateHubPKI(ctx context.Context, hubID string, caCert, caKe
 	return err
 }
 
+// sealHubSecrets encrypts a hub's TLS-Auth key, CA key and server key for storage.
+func (s *MeshStore) sealHubSecrets(tlsAuthKey, caKey, serverKey string) (string, string, string, error) {
+	var err error
+	if tlsAuthKey, err = s.db.seal(tlsAuthKey); err != nil {
+		return "", "", "", err
+	}
+	if caKey, err = s.db.seal(caKey); err != nil {
+		return "", "", "", err
+	}
+	if serverKey, err = s.db.seal(serverKey); err != nil {
+		return "", "", "", err
+	}
+	return tlsAuthKey, caKey, serverKey, nil
+}
+
+// openHubSecrets decrypts the secrets sealed by sealHubSecrets.
+func (s *MeshStore) openHubSecrets(hub *MeshHub) error {
+	var err error
+	if hub.TLSAuthKey, err = s.db.open(hub.TLSAuthKey); err != nil {
+		return err
+	}
+	if hub.CAKey, err = s.db.open(hub.CAKey); err != nil {
+		return err
+	}
+	hub.ServerKey, err = s.db.open(hub.ServerKey)
+	return err
+}
+
 // UpdateHubStatus updates the status of a mesh hub (from heartbeat)
 func (s *MeshStore) UpdateHubStatus(ctx context.Context, hubID string, status, statusMessage string, connectedGateways, connectedClients int) error {
 	_, err := s.db.Pool.Exec(ctx, `
@@ -443,8 +490,12 @@ func (s *MeshStore) CreateMeshSpoke(ctx context.Context, gw *MeshSpoke) error {
 	if gw.Status == "" {
 		gw.Status = MeshSpokeStatusPending
 	}
+	clientKey, err := s.db.seal(gw.ClientKey)
+	if err != nil {
+		return err
+	}
 
-	_, err := s.db.Pool.Exec(ctx, `
+	_, err = s.db.Pool.Exec(ctx, `
 		INSERT INTO mesh_gateways (
 			hub_id, name, description, local_networks,
 			client_cert, client_key, token,
@@ -455,7 +506,7 @@ func (s *MeshStore) CreateMeshSpoke(ctx context.Context, gw *MeshSpoke) error {
 			$8, $9
 		)
 	`, gw.HubID, gw.Name, gw.Description, gw.LocalNetworks,
-		gw.ClientCert, gw.ClientKey, gw.Token,
+		gw.ClientCert, clientKey, gw.Token,
 		gw.Status, gw.StatusMessage)
 
 	if err != nil && strings.Contains(err.Error(), "duplicate key") {
@@ -497,6 +548,9 @@ func (s *MeshStore) GetMeshSpoke(ctx context.Context, id string) (*MeshSpoke, er
 	if remoteIP != nil {
 		gw.RemoteIP = *remoteIP
 	}
+	if gw.ClientKey, err = s.db.open(gw.ClientKey); err != nil {
+		return nil, err
+	}
 	return &gw, nil
 }
 
@@ -533,6 +587,9 @@ func (s *MeshStore) GetMeshSpokeByToken(ctx context.Context, token string) (*Mes
 	if remoteIP != nil {
 		gw.RemoteIP = *remoteIP
 	}
+	if gw.ClientKey, err = s.db.open(gw.ClientKey); err != nil {
+		return nil, err
+	}
 	return &gw, nil
 }
 
@@ -570,6 +627,9 @@ func (s *MeshStore) GetMeshSpokeByName(name string) (*MeshSpoke, error) {
 	if remoteIP != nil {
 		gw.RemoteIP = *remoteIP
 	}
+	if gw.ClientKey, err = s.db.open(gw.ClientKey); err != nil {
+		return nil, err
+	}
 	return &gw, nil
 }
 
@@ -638,7 +698,11 @@ func (s *MeshStore) UpdateMeshSpoke(ctx context.Context, gw *MeshSpoke) error {
 
 // UpdateMeshSpokePKI updates the client certificates for a mesh gateway
 func (s *MeshStore) UpdateMeshSpokePKI(ctx context.Context, gwID, clientCert, clientKey, tunnelIP string) error {
-	_, err := s.db.Pool.Exec(ctx, `
+	clientKey, err := s.db.seal(clientKey)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Pool.Exec(ctx, `
 		UPDATE mesh_gateways SET
 			client_cert = $2, client_key = $3, tunnel_ip = NULLIF($4, '')::inet,
 			updated_at = NOW()
@@ -684,14 +748,17 @@ func (s *MeshStore) MarkInactiveMeshSpokes(ctx context.Context, threshold time.D
 
 // ==================== Access Control Operations ====================
 
-// AssignUserToHub assigns a user to a mesh hub
-func (s *MeshStore) AssignUserToHub(ctx context.Context, hubID, userID string) error {
-	_, err := s.db.Pool.Exec(ctx, `
+// AssignUserToHub assigns a user to a mesh hub, reporting whether it wasn't already assigned
+func (s *MeshStore) AssignUserToHub(ctx context.Context, hubID, userID string) (bool, error) {
+	result, err := s.db.Pool.Exec(ctx, `
 		INSERT INTO mesh_hub_users (hub_id, user_id)
 		VALUES ($1, $2)
 		ON CONFLICT DO NOTHING
 	`, hubID, userID)
-	return err
+	if err != nil {
+		return false, err
+	}
+	return result.RowsAffected() > 0, nil
 }
 
 // RemoveUserFromHub removes a user from a mesh hub
@@ -702,14 +769,17 @@ func (s *MeshStore) RemoveUserFromHub(ctx context.Context, hubID, userID string)
 	return err
 }
 
-// AssignGroupToHub assigns a group to a mesh hub
-func (s *MeshStore) AssignGroupToHub(ctx context.Context, hubID, groupName string) error {
-	_, err := s.db.Pool.Exec(ctx, `
+// AssignGroupToHub assigns a group to a mesh hub, reporting whether it wasn't already assigned
+func (s *MeshStore) AssignGroupToHub(ctx context.Context, hubID, groupName string) (bool, error) {
+	result, err := s.db.Pool.Exec(ctx, `
 		INSERT INTO mesh_hub_groups (hub_id, group_name)
 		VALUES ($1, $2)
 		ON CONFLICT DO NOTHING
 	`, hubID, groupName)
-	return err
+	if err != nil {
+		return false, err
+	}
+	return result.RowsAffected() > 0, nil
 }
 
 // RemoveGroupFromHub removes a group from a mesh hub
@@ -780,7 +850,7 @@ func (s *MeshStore) GetHubsForUser(ctx context.Context, userID string, groups []
 	rows, err := s.db.Pool.Query(ctx, `
 		SELECT DISTINCT h.id, h.name, h.description,
 			h.public_endpoint, h.vpn_port, h.vpn_protocol, h.vpn_subnet::text,
-			h.crypto_profile, h.tls_auth_enabled,
+			h.crypto_profile, h.tls_auth_enabled, h.tls_mode,
 			h.status, COALESCE(h.status_message, ''), h.last_heartbeat, h.connected_gateways, h.connected_clients,
 			h.created_at, h.updated_at
 		FROM mesh_hubs h
@@ -803,7 +873,7 @@ func (s *MeshStore) GetHubsForUser(ctx context.Context, userID string, groups []
 		if err := rows.Scan(
 			&hub.ID, &hub.Name, &hub.Description,
 			&hub.PublicEndpoint, &hub.VPNPort, &hub.VPNProtocol, &vpnSubnet,
-			&hub.CryptoProfile, &hub.TLSAuthEnabled,
+			&hub.CryptoProfile, &hub.TLSAuthEnabled, &hub.TLSMode,
 			&hub.Status, &hub.StatusMessage, &hub.LastHeartbeat, &hub.ConnectedSpokes, &hub.ConnectedClients,
 			&hub.CreatedAt, &hub.UpdatedAt,
 		); err != nil {
@@ -883,14 +953,17 @@ func (s *MeshStore) GetUserMeshRoutes(ctx context.Context, hubID, userID string,
 
 // ==================== Spoke User/Group Access ====================
 
-// AddUserToSpoke assigns a user to a mesh spoke
-func (s *MeshStore) AddUserToSpoke(ctx context.Context, spokeID, userID string) error {
-	_, err := s.db.Pool.Exec(ctx, `
+// AddUserToSpoke assigns a user to a mesh spoke, reporting whether it wasn't already assigned
+func (s *MeshStore) AddUserToSpoke(ctx context.Context, spokeID, userID string) (bool, error) {
+	result, err := s.db.Pool.Exec(ctx, `
 		INSERT INTO mesh_gateway_users (gateway_id, user_id)
 		VALUES ($1, $2)
 		ON CONFLICT DO NOTHING
 	`, spokeID, userID)
-	return err
+	if err != nil {
+		return false, err
+	}
+	return result.RowsAffected() > 0, nil
 }
 
 // RemoveUserFromSpoke removes a user from a mesh spoke
@@ -922,14 +995,17 @@ func (s *MeshStore) GetSpokeUsers(ctx context.Context, spokeID string) ([]string
 	return users, rows.Err()
 }
 
-// AddGroupToSpoke assigns a group to a mesh spoke
-func (s *MeshStore) AddGroupToSpoke(ctx context.Context, spokeID, groupName string) error {
-	_, err := s.db.Pool.Exec(ctx, `
+// AddGroupToSpoke assigns a group to a mesh spoke, reporting whether it wasn't already assigned
+func (s *MeshStore) AddGroupToSpoke(ctx context.Context, spokeID, groupName string) (bool, error) {
+	result, err := s.db.Pool.Exec(ctx, `
 		INSERT INTO mesh_gateway_groups (gateway_id, group_name)
 		VALUES ($1, $2)
 		ON CONFLICT DO NOTHING
 	`, spokeID, groupName)
-	return err
+	if err != nil {
+		return false, err
+	}
+	return result.RowsAffected() > 0, nil
 }
 
 // RemoveGroupFromSpoke removes a group from a mesh spoke
@@ -963,14 +1039,17 @@ func (s *MeshStore) GetSpokeGroups(ctx context.Context, spokeID string) ([]strin
 
 // ==================== Hub Network Assignment ====================
 
-// AssignNetworkToHub assigns a network to a mesh hub
-func (s *MeshStore) AssignNetworkToHub(ctx context.Context, hubID, networkID string) error {
-	_, err := s.db.Pool.Exec(ctx, `
+// AssignNetworkToHub assigns a network to a mesh hub, reporting whether it wasn't already assigned
+func (s *MeshStore) AssignNetworkToHub(ctx context.Context, hubID, networkID string) (bool, error) {
+	result, err := s.db.Pool.Exec(ctx, `
 		INSERT INTO mesh_hub_networks (hub_id, network_id)
 		VALUES ($1, $2)
 		ON CONFLICT DO NOTHING
 	`, hubID, networkID)
-	return err
+	if err != nil {
+		return false, err
+	}
+	return result.RowsAffected() > 0, nil
 }
 
 // RemoveNetworkFromHub removes a network from a mesh hub
@@ -987,7 +1066,7 @@ func (s *MeshStore) GetHubNetworks(ctx context.Context, hubID string) ([]*Networ
 		SELECT n.id, n.name, n.description, n.cidr::text, n.is_active, n.created_at, n.updated_at
 		FROM networks n
 		JOIN mesh_hub_networks hn ON n.id = hn.network_id
-		WHERE hn.hub_id = $1
+		WHERE hn.hub_id = $1 AND n.deleted_at IS NULL
 		ORDER BY n.name
 	`, hubID)
 	if err != nil {
@@ -1028,6 +1107,8 @@ func (s *MeshStore) GetUserMeshAccessRules(ctx context.Context, hubID, userID st
 			-- Or user's group has access to the rule
 			OR EXISTS (SELECT 1 FROM group_access_rules gar WHERE gar.access_rule_id = ar.id AND gar.group_name = ANY($3))
 		)
+		-- Unless one of the user's exceptions takes it away
+		AND NOT `+userExceptionSQL("$2")+`
 		ORDER BY route
 	`, hubID, userID, groups)
 	if err != nil {
@@ -1087,6 +1168,8 @@ func (s *MeshStore) GetUserMeshAccessRulesDetailed(ctx context.Context, hubID, u
 			-- Or user's group has access to the rule
 			OR EXISTS (SELECT 1 FROM group_access_rules gar WHERE gar.access_rule_id = ar.id AND gar.group_name = ANY($3))
 		)
+		-- Unless one of the user's exceptions takes it away
+		AND NOT `+userExceptionSQL("$2")+`
 		ORDER BY ar.rule_type, ar.value
 	`, hubID, userID, groups)
 	if err != nil {
@@ -1102,7 +1185,26 @@ func (s *MeshStore) GetUserMeshAccessRulesDetailed(ctx context.Context, hubID, u
 		}
 		rules = append(rules, rule)
 	}
-	return rules, rows.Err()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Take destination exceptions out of the CIDRs containing them
+	granted := make([]*AccessRule, len(rules))
+	for i, rule := range rules {
+		granted[i] = &AccessRule{RuleType: AccessRuleType(rule.Type), Value: rule.Value}
+	}
+	if err := s.db.exceptDestinations(ctx, userID, granted); err != nil {
+		return nil, err
+	}
+	var narrowed []MeshAccessRule
+	for i, rule := range rules {
+		for _, value := range granted[i].Destinations() {
+			rule.Value = value
+			narrowed = append(narrowed, rule)
+		}
+	}
+	return narrowed, nil
 }
 
 // GetUserMeshAccessRulesDetailedByEmail returns detailed access rules for a user by email
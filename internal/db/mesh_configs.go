@@ -55,10 +55,14 @@ func NewMeshConfigStore(db *DB) *MeshConfigStore {
 
 // SaveConfig stores a generated mesh config
 func (s *MeshConfigStore) SaveConfig(ctx context.Context, config *MeshGeneratedConfig) error {
-	_, err := s.db.Pool.Exec(ctx, `
+	configData, err := s.db.sealBytes(config.ConfigData)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Pool.Exec(ctx, `
 		INSERT INTO mesh_generated_configs (id, user_id, hub_id, hub_name, file_name, config_data, serial_number, fingerprint, expires_at)
 		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
-	`, config.ID, config.UserID, config.HubID, config.HubName, config.FileName, config.ConfigData, config.SerialNumber, config.Fingerprint, config.ExpiresAt)
+	`, config.ID, config.UserID, config.HubID, config.HubName, config.FileName, configData, config.SerialNumber, config.Fingerprint, config.ExpiresAt)
 	return err
 }
 
@@ -79,6 +83,9 @@ func (s *MeshConfigStore) GetConfig(ctx context.Context, id string) (*MeshGenera
 	if err != nil {
 		return nil, err
 	}
+	if config.ConfigData, err = s.db.openBytes(config.ConfigData); err != nil {
+		return nil, err
+	}
 
 	// Check if expired
 	if time.Now().After(config.ExpiresAt) {
@@ -222,6 +229,9 @@ func (s *MeshConfigStore) GetConfigBySerial(ctx context.Context, serial string)
 	if err != nil {
 		return nil, err
 	}
+	if config.ConfigData, err = s.db.openBytes(config.ConfigData); err != nil {
+		return nil, err
+	}
 	return &config, nil
 }
 
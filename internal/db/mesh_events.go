@@ -0,0 +1,179 @@
+package db
+
+import (
+	"context"
+	"time"
+)
+
+// Mesh lifecycle event types
+const (
+	MeshEventProvisioned         = "provisioned"
+	MeshEventReprovisionSignaled = "reprovision_signaled"
+	MeshEventStatusChanged       = "status_changed"
+	MeshEventSpokeConnected      = "spoke_connected"
+	MeshEventSpokeDisconnected   = "spoke_disconnected"
+	MeshEventRoutesChanged       = "routes_changed"
+)
+
+// Mesh event outcomes
+const (
+	MeshEventSuccess = "success"
+	MeshEventFailure = "failure"
+)
+
+// MeshEvent is a lifecycle event of a mesh hub or spoke.
+type MeshEvent struct {
+	ID            string    `json:"id"`
+	ComponentType string    `json:"componentType"` // ComponentHub or ComponentSpoke
+	ComponentID   string    `json:"componentId"`
+	ComponentName string    `json:"componentName"`
+	HubID         string    `json:"hubId"` // The hub itself, or the spoke's hub
+	EventType     string    `json:"eventType"`
+	Outcome       string    `json:"outcome"`
+	Message       string    `json:"message,omitempty"`
+	RemoteIP      string    `json:"remoteIp,omitempty"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+// MeshEventFilter provides filtering options for mesh event queries
+type MeshEventFilter struct {
+	HubID         string
+	ComponentType string
+	ComponentID   string
+	EventType     string
+	Outcome       string
+	StartTime     *time.Time
+	EndTime       *time.Time
+	Limit         int
+	Offset        int
+}
+
+// MeshEventStore handles mesh event persistence
+type MeshEventStore struct {
+	db *DB
+}
+
+// NewMeshEventStore creates a new mesh event store
+func NewMeshEventStore(db *DB) *MeshEventStore {
+	return &MeshEventStore{db: db}
+}
+
+// Record inserts a mesh event, setting its ID and creation time.
+func (s *MeshEventStore) Record(ctx context.Context, e *MeshEvent) error {
+	return s.db.Pool.QueryRow(ctx, `
+		INSERT INTO mesh_events (component_type, component_id, component_name, hub_id, event_type, outcome, message, remote_ip)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id, created_at
+	`, e.ComponentType, e.ComponentID, e.ComponentName, e.HubID, e.EventType, e.Outcome, e.Message, e.RemoteIP,
+	).Scan(&e.ID, &e.CreatedAt)
+}
+
+// RecordUnlessRepeated inserts a mesh event unless the component's latest event
+// has the same type, outcome and message. It's for conditions reported on every
+// heartbeat, so they're recorded once each time they start rather than once per
+// heartbeat. It reports whether the event was recorded.
+func (s *MeshEventStore) RecordUnlessRepeated(ctx context.Context, e *MeshEvent) (bool, error) {
+	tag, err := s.db.Pool.Exec(ctx, `
+		INSERT INTO mesh_events (component_type, component_id, component_name, hub_id, event_type, outcome, message, remote_ip)
+		SELECT $1, $2, $3, $4, $5, $6, $7, $8
+		WHERE NOT EXISTS (
+			SELECT 1 FROM (
+				SELECT event_type, outcome, message FROM mesh_events
+				WHERE component_id = $2
+				ORDER BY created_at DESC
+				LIMIT 1
+			) latest
+			WHERE latest.event_type = $5 AND latest.outcome = $6 AND latest.message = $7
+		)
+	`, e.ComponentType, e.ComponentID, e.ComponentName, e.HubID, e.EventType, e.Outcome, e.Message, e.RemoteIP)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// List retrieves mesh events, newest first, with optional filtering
+func (s *MeshEventStore) List(ctx context.Context, filter *MeshEventFilter) ([]*MeshEvent, int, error) {
+	where, args := meshEventConditions(filter)
+	argNum := len(args) + 1
+
+	var total int
+	err := s.db.Pool.QueryRow(ctx, "SELECT COUNT(*) FROM mesh_events WHERE 1=1"+where, args...).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	query := `
+		SELECT id, component_type, component_id, component_name, hub_id, event_type, outcome, message, remote_ip, created_at
+		FROM mesh_events
+		WHERE 1=1` + where + ` ORDER BY created_at DESC`
+	if filter.Limit > 0 {
+		query += ` LIMIT $` + itoa(argNum)
+		args = append(args, filter.Limit)
+		argNum++
+	}
+	if filter.Offset > 0 {
+		query += ` OFFSET $` + itoa(argNum)
+		args = append(args, filter.Offset)
+	}
+
+	rows, err := s.db.Pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	events := []*MeshEvent{}
+	for rows.Next() {
+		var e MeshEvent
+		if err := rows.Scan(&e.ID, &e.ComponentType, &e.ComponentID, &e.ComponentName, &e.HubID,
+			&e.EventType, &e.Outcome, &e.Message, &e.RemoteIP, &e.CreatedAt); err != nil {
+			return nil, 0, err
+		}
+		events = append(events, &e)
+	}
+	return events, total, rows.Err()
+}
+
+// meshEventConditions builds the WHERE conditions for a filter, to be appended after "WHERE 1=1".
+func meshEventConditions(filter *MeshEventFilter) (string, []interface{}) {
+	where := ""
+	args := []interface{}{}
+	add := func(condition string, value interface{}) {
+		args = append(args, value)
+		where += " AND " + condition + " $" + itoa(len(args))
+	}
+
+	if filter.HubID != "" {
+		add("hub_id::text =", filter.HubID)
+	}
+	if filter.ComponentType != "" {
+		add("component_type =", filter.ComponentType)
+	}
+	if filter.ComponentID != "" {
+		add("component_id::text =", filter.ComponentID)
+	}
+	if filter.EventType != "" {
+		add("event_type =", filter.EventType)
+	}
+	if filter.Outcome != "" {
+		add("outcome =", filter.Outcome)
+	}
+	if filter.StartTime != nil {
+		add("created_at >=", *filter.StartTime)
+	}
+	if filter.EndTime != nil {
+		add("created_at <=", *filter.EndTime)
+	}
+	return where, args
+}
+
+// DeleteOlderThan deletes mesh events older than the given number of days
+func (s *MeshEventStore) DeleteOlderThan(ctx context.Context, days int) (int64, error) {
+	cutoff := time.Now().AddDate(0, 0, -days)
+	result, err := s.db.Pool.Exec(ctx, `DELETE FROM mesh_events WHERE created_at < $1`, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
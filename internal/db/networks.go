@@ -37,10 +37,10 @@ func NewNetworkStore(db *DB) *NetworkStore {
 // CreateNetwork creates a new network
 func (s *NetworkStore) CreateNetwork(ctx context.Context, network *Network) error {
 	err := s.db.Pool.QueryRow(ctx, `
-		INSERT INTO networks (name, description, cidr, is_active)
-		VALUES ($1, $2, $3::cidr, $4)
+		INSERT INTO networks (name, description, cidr, is_active, tenant_id)
+		VALUES ($1, $2, $3::cidr, $4, $5)
 		RETURNING id, created_at, updated_at
-	`, network.Name, network.Description, network.CIDR, network.IsActive).Scan(
+	`, network.Name, network.Description, network.CIDR, network.IsActive, tenantForInsert(ctx)).Scan(
 		&network.ID, &network.CreatedAt, &network.UpdatedAt,
 	)
 	if err != nil && err.Error() == "ERROR: duplicate key value violates unique constraint \"networks_name_key\" (SQLSTATE 23505)" {
@@ -52,10 +52,10 @@ func (s *NetworkStore) CreateNetwork(ctx context.Context, network *Network) erro
 // GetNetwork retrieves a network by ID
 func (s *NetworkStore) GetNetwork(ctx context.Context, id string) (*Network, error) {
 	var network Network
+	tenant, args := tenantClause(ctx, "tenant_id", []interface{}{id})
 	err := s.db.Pool.QueryRow(ctx, `
 		SELECT id, name, description, cidr::text, is_active, created_at, updated_at
-		FROM networks WHERE id = $1
-	`, id).Scan(&network.ID, &network.Name, &network.Description, &network.CIDR,
+		FROM networks WHERE id = $1 AND deleted_at IS NULL AND `+tenant, args...).Scan(&network.ID, &network.Name, &network.Description, &network.CIDR,
 		&network.IsActive, &network.CreatedAt, &network.UpdatedAt)
 	if err == pgx.ErrNoRows {
 		return nil, ErrNetworkNotFound
@@ -65,10 +65,11 @@ func (s *NetworkStore) GetNetwork(ctx context.Context, id string) (*Network, err
 
 // ListNetworks retrieves all networks
 func (s *NetworkStore) ListNetworks(ctx context.Context) ([]*Network, error) {
+	tenant, args := tenantClause(ctx, "tenant_id", nil)
 	rows, err := s.db.Pool.Query(ctx, `
 		SELECT id, name, description, cidr::text, is_active, created_at, updated_at
-		FROM networks ORDER BY name
-	`)
+		FROM networks WHERE deleted_at IS NULL AND `+tenant+` ORDER BY name
+	`, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -88,10 +89,10 @@ func (s *NetworkStore) ListNetworks(ctx context.Context) ([]*Network, error) {
 
 // UpdateNetwork updates a network
 func (s *NetworkStore) UpdateNetwork(ctx context.Context, network *Network) error {
+	tenant, args := tenantClause(ctx, "tenant_id", []interface{}{network.ID, network.Name, network.Description, network.CIDR, network.IsActive})
 	result, err := s.db.Pool.Exec(ctx, `
 		UPDATE networks SET name = $2, description = $3, cidr = $4::cidr, is_active = $5
-		WHERE id = $1
-	`, network.ID, network.Name, network.Description, network.CIDR, network.IsActive)
+		WHERE id = $1 AND deleted_at IS NULL AND `+tenant, args...)
 	if err != nil {
 		return err
 	}
@@ -101,9 +102,12 @@ func (s *NetworkStore) UpdateNetwork(ctx context.Context, network *Network) erro
 	return nil
 }
 
-// DeleteNetwork deletes a network
+// DeleteNetwork soft-deletes a network, keeping its gateway assignments for
+// RestoreNetwork
 func (s *NetworkStore) DeleteNetwork(ctx context.Context, id string) error {
-	result, err := s.db.Pool.Exec(ctx, `DELETE FROM networks WHERE id = $1`, id)
+	tenant, args := tenantClause(ctx, "tenant_id", []interface{}{id})
+	result, err := s.db.Pool.Exec(ctx, `
+		UPDATE networks SET deleted_at = NOW() WHERE id = $1 AND deleted_at IS NULL AND `+tenant, args...)
 	if err != nil {
 		return err
 	}
@@ -113,19 +117,36 @@ func (s *NetworkStore) DeleteNetwork(ctx context.Context, id string) error {
 	return nil
 }
 
-// AssignGatewayToNetwork assigns a gateway to a network
-func (s *NetworkStore) AssignGatewayToNetwork(ctx context.Context, gatewayID, networkID string) error {
-	_, err := s.db.Pool.Exec(ctx, `
+// AssignGatewayToNetwork assigns a gateway to a network, reporting whether it wasn't already assigned
+func (s *NetworkStore) AssignGatewayToNetwork(ctx context.Context, gatewayID, networkID string) (bool, error) {
+	if err := s.checkGatewayAndNetwork(ctx, gatewayID, networkID); err != nil {
+		return false, err
+	}
+	return assignGatewayToNetwork(ctx, s.db.Pool, gatewayID, networkID)
+}
+
+func assignGatewayToNetwork(ctx context.Context, q execer, gatewayID, networkID string) (bool, error) {
+	result, err := q.Exec(ctx, `
 		INSERT INTO gateway_networks (gateway_id, network_id)
 		VALUES ($1, $2)
 		ON CONFLICT DO NOTHING
 	`, gatewayID, networkID)
-	return err
+	if err != nil {
+		return false, err
+	}
+	return result.RowsAffected() > 0, nil
 }
 
 // RemoveGatewayFromNetwork removes a gateway from a network
 func (s *NetworkStore) RemoveGatewayFromNetwork(ctx context.Context, gatewayID, networkID string) error {
-	_, err := s.db.Pool.Exec(ctx, `
+	if err := s.checkGatewayAndNetwork(ctx, gatewayID, networkID); err != nil {
+		return err
+	}
+	return removeGatewayFromNetwork(ctx, s.db.Pool, gatewayID, networkID)
+}
+
+func removeGatewayFromNetwork(ctx context.Context, q execer, gatewayID, networkID string) error {
+	_, err := q.Exec(ctx, `
 		DELETE FROM gateway_networks WHERE gateway_id = $1 AND network_id = $2
 	`, gatewayID, networkID)
 	return err
@@ -133,13 +154,14 @@ func (s *NetworkStore) RemoveGatewayFromNetwork(ctx context.Context, gatewayID,
 
 // GetGatewayNetworks gets all networks assigned to a gateway
 func (s *NetworkStore) GetGatewayNetworks(ctx context.Context, gatewayID string) ([]*Network, error) {
+	tenant, args := tenantClause(ctx, "n.tenant_id", []interface{}{gatewayID})
 	rows, err := s.db.Pool.Query(ctx, `
 		SELECT n.id, n.name, n.description, n.cidr::text, n.is_active, n.created_at, n.updated_at
 		FROM networks n
 		JOIN gateway_networks gn ON n.id = gn.network_id
-		WHERE gn.gateway_id = $1
+		WHERE gn.gateway_id = $1 AND n.deleted_at IS NULL AND `+tenant+`
 		ORDER BY n.name
-	`, gatewayID)
+	`, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -159,14 +181,15 @@ func (s *NetworkStore) GetGatewayNetworks(ctx context.Context, gatewayID string)
 
 // GetNetworkGateways gets all gateways assigned to a network
 func (s *NetworkStore) GetNetworkGateways(ctx context.Context, networkID string) ([]*Gateway, error) {
+	tenant, args := tenantClause(ctx, "g.tenant_id", []interface{}{networkID})
 	rows, err := s.db.Pool.Query(ctx, `
 		SELECT g.id, g.name, g.hostname, host(g.public_ip), g.vpn_port, g.vpn_protocol,
 		       g.is_active, g.last_heartbeat, g.created_at, g.updated_at
 		FROM gateways g
 		JOIN gateway_networks gn ON g.id = gn.gateway_id
-		WHERE gn.network_id = $1
+		WHERE gn.network_id = $1 AND g.deleted_at IS NULL AND `+tenant+`
 		ORDER BY g.name
-	`, networkID)
+	`, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -190,3 +213,15 @@ func (s *NetworkStore) GetNetworkGateways(ctx context.Context, networkID string)
 	}
 	return gateways, rows.Err()
 }
+
+// checkGatewayAndNetwork checks that a gateway and network both belong to the
+// tenant ctx is scoped to, so they can't be linked across tenants.
+func (s *NetworkStore) checkGatewayAndNetwork(ctx context.Context, gatewayID, networkID string) error {
+	if ok, err := s.db.inTenant(ctx, "gateways", gatewayID); err != nil || !ok {
+		return notFoundOr(err, ErrGatewayNotFound)
+	}
+	if ok, err := s.db.inTenant(ctx, "networks", networkID); err != nil || !ok {
+		return notFoundOr(err, ErrNetworkNotFound)
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package db
+
+import (
+	"context"
+	"time"
+)
+
+// QueuedNotification is a notification waiting to be delivered.
+type QueuedNotification struct {
+	ID       string
+	Kind     string
+	Payload  []byte
+	Attempts int // Including the delivery it was just claimed for
+}
+
+// NotificationStore persists the notification delivery queue
+type NotificationStore struct {
+	db *DB
+}
+
+// NewNotificationStore creates a new notification store
+func NewNotificationStore(db *DB) *NotificationStore {
+	return &NotificationStore{db: db}
+}
+
+// EnqueueNotification adds a notification to be delivered as soon as possible.
+func (s *NotificationStore) EnqueueNotification(ctx context.Context, kind string, payload []byte, maxAttempts int) error {
+	_, err := s.db.Pool.Exec(ctx, `
+		INSERT INTO notification_queue (kind, payload, max_attempts) VALUES ($1, $2, $3)
+	`, kind, payload, maxAttempts)
+	return err
+}
+
+// ClaimNotifications leases up to limit due notifications for delivery and counts
+// the attempt. Rows another server holds are skipped, and a lease that runs out
+// (the server died mid-delivery) makes the notification due again.
+func (s *NotificationStore) ClaimNotifications(ctx context.Context, limit int, lease time.Duration) ([]*QueuedNotification, error) {
+	rows, err := s.db.Pool.Query(ctx, `
+		UPDATE notification_queue SET attempts = attempts + 1, locked_until = NOW() + $2::interval
+		WHERE id IN (
+			SELECT id FROM notification_queue
+			WHERE failed_at IS NULL AND next_attempt_at <= NOW()
+				AND (locked_until IS NULL OR locked_until < NOW())
+			ORDER BY next_attempt_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id::text, kind, payload, attempts
+	`, limit, lease.String())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var notifications []*QueuedNotification
+	for rows.Next() {
+		n := &QueuedNotification{}
+		if err := rows.Scan(&n.ID, &n.Kind, &n.Payload, &n.Attempts); err != nil {
+			return nil, err
+		}
+		notifications = append(notifications, n)
+	}
+	return notifications, rows.Err()
+}
+
+// CompleteNotification removes a delivered notification.
+func (s *NotificationStore) CompleteNotification(ctx context.Context, id string) error {
+	_, err := s.db.Pool.Exec(ctx, `DELETE FROM notification_queue WHERE id = $1`, id)
+	return err
+}
+
+// RetryNotification releases a notification whose delivery failed to be tried
+// again at the given time.
+func (s *NotificationStore) RetryNotification(ctx context.Context, id string, at time.Time, lastError string) error {
+	_, err := s.db.Pool.Exec(ctx, `
+		UPDATE notification_queue SET next_attempt_at = $2, locked_until = NULL, last_error = $3
+		WHERE id = $1
+	`, id, at, lastError)
+	return err
+}
+
+// FailNotification gives up on a notification.
+func (s *NotificationStore) FailNotification(ctx context.Context, id string, lastError string) error {
+	_, err := s.db.Pool.Exec(ctx, `
+		UPDATE notification_queue SET failed_at = NOW(), locked_until = NULL, last_error = $2
+		WHERE id = $1
+	`, id, lastError)
+	return err
+}
+
+// CountNotifications returns how many notifications are waiting to be delivered
+// and how many were given up on.
+func (s *NotificationStore) CountNotifications(ctx context.Context) (pending, failed int64, err error) {
+	err = s.db.Pool.QueryRow(ctx, `
+		SELECT COUNT(*) FILTER (WHERE failed_at IS NULL), COUNT(*) FILTER (WHERE failed_at IS NOT NULL)
+		FROM notification_queue
+	`).Scan(&pending, &failed)
+	return pending, failed, err
+}
+
+// PurgeFailedNotifications deletes notifications given up on before the cutoff.
+func (s *NotificationStore) PurgeFailedNotifications(ctx context.Context, before time.Time) (int64, error) {
+	result, err := s.db.Pool.Exec(ctx, `DELETE FROM notification_queue WHERE failed_at < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
@@ -0,0 +1,152 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	ErrChangeNotFound   = errors.New("change not found")
+	ErrChangeNotPending = errors.New("change is not pending")
+	ErrSelfApproval     = errors.New("changes must be reviewed by a different admin")
+)
+
+// Pending change statuses
+const (
+	ChangeStatusPending  = "pending"
+	ChangeStatusApproved = "approved" // Approved and being applied
+	ChangeStatusApplied  = "applied"
+	ChangeStatusFailed   = "failed" // Approved, but the change was rejected when applied
+	ChangeStatusRejected = "rejected"
+)
+
+// PendingChange is an admin request held until a second admin approves it
+type PendingChange struct {
+	ID               string
+	Category         string
+	Method           string
+	Path             string
+	Body             string
+	Status           string
+	RequestedBy      string
+	RequestedByEmail string
+	ReviewedBy       *string
+	ReviewedByEmail  *string
+	ReviewComment    string
+	ResultStatus     *int
+	ResultBody       *string
+	TenantID         string // The tenant the change was requested in
+	CreatedAt        time.Time
+	ReviewedAt       *time.Time
+}
+
+// ChangeStore handles pending change persistence
+type ChangeStore struct {
+	db *DB
+}
+
+// NewChangeStore creates a new change store
+func NewChangeStore(db *DB) *ChangeStore {
+	return &ChangeStore{db: db}
+}
+
+const pendingChangeColumns = `id, category, method, path, body, status, requested_by, requested_by_email,
+		reviewed_by, reviewed_by_email, review_comment, result_status, result_body, tenant_id, created_at, reviewed_at`
+
+func scanPendingChange(row pgx.Row) (*PendingChange, error) {
+	var ch PendingChange
+	err := row.Scan(&ch.ID, &ch.Category, &ch.Method, &ch.Path, &ch.Body, &ch.Status, &ch.RequestedBy, &ch.RequestedByEmail,
+		&ch.ReviewedBy, &ch.ReviewedByEmail, &ch.ReviewComment, &ch.ResultStatus, &ch.ResultBody, &ch.TenantID, &ch.CreatedAt, &ch.ReviewedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &ch, nil
+}
+
+// Create stores a new pending change in the request's tenant
+func (s *ChangeStore) Create(ctx context.Context, ch *PendingChange) error {
+	return s.db.Pool.QueryRow(ctx, `
+		INSERT INTO pending_changes (category, method, path, body, requested_by, requested_by_email, tenant_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, status, tenant_id, created_at
+	`, ch.Category, ch.Method, ch.Path, ch.Body, ch.RequestedBy, ch.RequestedByEmail,
+		tenantForInsert(ctx)).Scan(&ch.ID, &ch.Status, &ch.TenantID, &ch.CreatedAt)
+}
+
+// Get retrieves a change by ID
+func (s *ChangeStore) Get(ctx context.Context, id string) (*PendingChange, error) {
+	tenant, args := tenantClause(ctx, "tenant_id", []interface{}{id})
+	ch, err := scanPendingChange(s.db.Pool.QueryRow(ctx, `
+		SELECT `+pendingChangeColumns+`
+		FROM pending_changes WHERE id::text = $1 AND `+tenant, args...))
+	if err == pgx.ErrNoRows {
+		return nil, ErrChangeNotFound
+	}
+	return ch, err
+}
+
+// List returns changes with the given status, or all changes if status is empty, newest first
+func (s *ChangeStore) List(ctx context.Context, status string, limit int) ([]*PendingChange, error) {
+	tenant, args := tenantClause(ctx, "tenant_id", []interface{}{status, limit})
+	rows, err := s.db.Pool.Query(ctx, `
+		SELECT `+pendingChangeColumns+`
+		FROM pending_changes
+		WHERE ($1 = '' OR status = $1) AND `+tenant+`
+		ORDER BY created_at DESC
+		LIMIT $2
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var changes []*PendingChange
+	for rows.Next() {
+		ch, err := scanPendingChange(rows)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, ch)
+	}
+	return changes, rows.Err()
+}
+
+// Review moves a pending change to approved or rejected. The update only matches
+// pending changes requested by someone else, so a change can't be reviewed twice
+// or by the admin who made it.
+func (s *ChangeStore) Review(ctx context.Context, id, status, reviewerID, reviewerEmail, comment string) (*PendingChange, error) {
+	tenant, args := tenantClause(ctx, "tenant_id", []interface{}{id, status, reviewerID, reviewerEmail, comment})
+	ch, err := scanPendingChange(s.db.Pool.QueryRow(ctx, `
+		UPDATE pending_changes
+		SET status = $2, reviewed_by = $3, reviewed_by_email = $4, review_comment = $5, reviewed_at = NOW()
+		WHERE id::text = $1 AND status = 'pending' AND requested_by <> $3 AND `+tenant+`
+		RETURNING `+pendingChangeColumns, args...))
+	if err != pgx.ErrNoRows {
+		return ch, err
+	}
+
+	// Work out why nothing matched
+	existing, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if existing.Status != ChangeStatusPending {
+		return nil, ErrChangeNotPending
+	}
+	return nil, ErrSelfApproval
+}
+
+// SetResult records the outcome of applying an approved change
+func (s *ChangeStore) SetResult(ctx context.Context, id string, applied bool, resultStatus int, resultBody string) error {
+	status := ChangeStatusApplied
+	if !applied {
+		status = ChangeStatusFailed
+	}
+	_, err := s.db.Pool.Exec(ctx, `
+		UPDATE pending_changes SET status = $2, result_status = $3, result_body = $4 WHERE id = $1
+	`, id, status, resultStatus, resultBody)
+	return err
+}
@@ -79,6 +79,9 @@ func (s *PKIStore) GetCA(ctx context.Context) (*StoredCA, error) {
 	if err != nil {
 		return nil, err
 	}
+	if ca.PrivateKeyPEM, err = s.db.open(ca.PrivateKeyPEM); err != nil {
+		return nil, err
+	}
 	if status != nil {
 		ca.Status = *status
 	}
@@ -108,6 +111,9 @@ func (s *PKIStore) GetCAByID(ctx context.Context, id string) (*StoredCA, error)
 	if err != nil {
 		return nil, err
 	}
+	if ca.PrivateKeyPEM, err = s.db.open(ca.PrivateKeyPEM); err != nil {
+		return nil, err
+	}
 	if status != nil {
 		ca.Status = *status
 	}
@@ -141,6 +147,9 @@ func (s *PKIStore) ListCAs(ctx context.Context) ([]*StoredCA, error) {
 			&ca.NotBefore, &ca.NotAfter, &status, &fingerprint, &description, &ca.CreatedAt, &ca.UpdatedAt); err != nil {
 			return nil, err
 		}
+		if ca.PrivateKeyPEM, err = s.db.open(ca.PrivateKeyPEM); err != nil {
+			return nil, err
+		}
 		if status != nil {
 			ca.Status = *status
 		}
@@ -177,6 +186,9 @@ func (s *PKIStore) GetTrustedCAs(ctx context.Context) ([]*StoredCA, error) {
 			&ca.NotBefore, &ca.NotAfter, &status, &fingerprint, &description, &ca.CreatedAt, &ca.UpdatedAt); err != nil {
 			return nil, err
 		}
+		if ca.PrivateKeyPEM, err = s.db.open(ca.PrivateKeyPEM); err != nil {
+			return nil, err
+		}
 		if status != nil {
 			ca.Status = *status
 		}
@@ -200,8 +212,12 @@ func (s *PKIStore) SaveCA(ctx context.Context, ca *StoredCA) error {
 	if status == "" {
 		status = CAStatusActive
 	}
+	privateKey, err := s.db.seal(ca.PrivateKeyPEM)
+	if err != nil {
+		return err
+	}
 
-	_, err := s.db.Pool.Exec(ctx, `
+	_, err = s.db.Pool.Exec(ctx, `
 		INSERT INTO pki_ca (id, certificate_pem, private_key_pem, serial_number, not_before, not_after, status, fingerprint, description)
 		VALUES ('default', $1, $2, $3, $4, $5, $6, $7, $8)
 		ON CONFLICT (id) DO UPDATE SET
@@ -214,7 +230,7 @@ func (s *PKIStore) SaveCA(ctx context.Context, ca *StoredCA) error {
 			fingerprint = EXCLUDED.fingerprint,
 			description = EXCLUDED.description,
 			updated_at = NOW()
-	`, ca.CertificatePEM, ca.PrivateKeyPEM, ca.SerialNumber, ca.NotBefore, ca.NotAfter, status, fingerprint, ca.Description)
+	`, ca.CertificatePEM, privateKey, ca.SerialNumber, ca.NotBefore, ca.NotAfter, status, fingerprint, ca.Description)
 	return err
 }
 
@@ -226,8 +242,12 @@ func (s *PKIStore) SaveCAWithID(ctx context.Context, ca *StoredCA) error {
 	if status == "" {
 		status = CAStatusPending
 	}
+	privateKey, err := s.db.seal(ca.PrivateKeyPEM)
+	if err != nil {
+		return err
+	}
 
-	_, err := s.db.Pool.Exec(ctx, `
+	_, err = s.db.Pool.Exec(ctx, `
 		INSERT INTO pki_ca (id, certificate_pem, private_key_pem, serial_number, not_before, not_after, status, fingerprint, description)
 		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
 		ON CONFLICT (id) DO UPDATE SET
@@ -240,7 +260,7 @@ func (s *PKIStore) SaveCAWithID(ctx context.Context, ca *StoredCA) error {
 			fingerprint = EXCLUDED.fingerprint,
 			description = EXCLUDED.description,
 			updated_at = NOW()
-	`, ca.ID, ca.CertificatePEM, ca.PrivateKeyPEM, ca.SerialNumber, ca.NotBefore, ca.NotAfter, status, fingerprint, ca.Description)
+	`, ca.ID, ca.CertificatePEM, privateKey, ca.SerialNumber, ca.NotBefore, ca.NotAfter, status, fingerprint, ca.Description)
 	return err
 }
 
@@ -0,0 +1,228 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/gatekey-project/gatekey/internal/models"
+)
+
+var (
+	ErrPolicyNotFound = errors.New("policy not found")
+	ErrPolicyExists   = errors.New("policy already exists")
+)
+
+// PolicyStore handles policy persistence. It implements policy.PolicyRepository.
+type PolicyStore struct {
+	db *DB
+}
+
+// NewPolicyStore creates a new policy store
+func NewPolicyStore(db *DB) *PolicyStore {
+	return &PolicyStore{db: db}
+}
+
+const policyColumns = `id, name, COALESCE(description, ''), priority, is_enabled,
+		COALESCE(created_by, '00000000-0000-0000-0000-000000000000'), created_at, updated_at, constraints`
+
+func scanPolicy(row pgx.Row) (*models.Policy, error) {
+	var p models.Policy
+	var constraints []byte
+	if err := row.Scan(&p.ID, &p.Name, &p.Description, &p.Priority, &p.IsEnabled,
+		&p.CreatedBy, &p.CreatedAt, &p.UpdatedAt, &constraints); err != nil {
+		return nil, err
+	}
+	if len(constraints) > 0 {
+		if err := json.Unmarshal(constraints, &p.Constraints); err != nil {
+			return nil, err
+		}
+	}
+	return &p, nil
+}
+
+// constraintsJSON encodes a policy's constraints for storage, NULL if it has none.
+func constraintsJSON(p *models.Policy) ([]byte, error) {
+	if p.Constraints == nil {
+		return nil, nil
+	}
+	return json.Marshal(p.Constraints)
+}
+
+// List returns all policies, highest priority first
+func (s *PolicyStore) List(ctx context.Context) ([]models.Policy, error) {
+	tenant, args := tenantClause(ctx, "tenant_id", nil)
+	rows, err := s.db.Pool.Query(ctx, `
+		SELECT `+policyColumns+`
+		FROM policies WHERE `+tenant+` ORDER BY priority, name
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var policies []models.Policy
+	for rows.Next() {
+		p, err := scanPolicy(rows)
+		if err != nil {
+			return nil, err
+		}
+		policies = append(policies, *p)
+	}
+	return policies, rows.Err()
+}
+
+// Get retrieves a policy by ID
+func (s *PolicyStore) Get(ctx context.Context, id string) (*models.Policy, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrPolicyNotFound
+	}
+	tenant, args := tenantClause(ctx, "tenant_id", []interface{}{id})
+	p, err := scanPolicy(s.db.Pool.QueryRow(ctx, `
+		SELECT `+policyColumns+`
+		FROM policies WHERE id = $1 AND `+tenant, args...))
+	if err == pgx.ErrNoRows {
+		return nil, ErrPolicyNotFound
+	}
+	return p, err
+}
+
+// GetRules returns a policy's rules in priority order
+func (s *PolicyStore) GetRules(ctx context.Context, policyID uuid.UUID) ([]models.PolicyRule, error) {
+	rows, err := s.db.Pool.Query(ctx, `
+		SELECT id, policy_id, action, COALESCE(subject, '{}'), COALESCE(resource, '{}'), COALESCE(conditions, '{}'), priority, created_at
+		FROM policy_rules WHERE policy_id = $1 ORDER BY priority, created_at
+	`, policyID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rules := []models.PolicyRule{}
+	for rows.Next() {
+		var r models.PolicyRule
+		if err := rows.Scan(&r.ID, &r.PolicyID, &r.Action, &r.Subject, &r.Resource, &r.Conditions, &r.Priority, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		rules = append(rules, r)
+	}
+	return rules, rows.Err()
+}
+
+// Create stores a new policy and its rules. createdBy is recorded if it is an SSO
+// user's ID.
+func (s *PolicyStore) Create(ctx context.Context, p *models.Policy, rules []models.PolicyRule, createdBy string) error {
+	constraints, err := constraintsJSON(p)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	err = tx.QueryRow(ctx, `
+		INSERT INTO policies (name, description, priority, is_enabled, created_by, constraints, tenant_id)
+		VALUES ($1, $2, $3, $4, (SELECT id FROM users WHERE id::text = $5), $6, $7)
+		RETURNING id, COALESCE(created_by, '00000000-0000-0000-0000-000000000000'), created_at, updated_at
+	`, p.Name, p.Description, p.Priority, p.IsEnabled, createdBy, constraints, tenantForInsert(ctx)).Scan(
+		&p.ID, &p.CreatedBy, &p.CreatedAt, &p.UpdatedAt,
+	)
+	if isUniqueViolation(err) {
+		return ErrPolicyExists
+	}
+	if err != nil {
+		return err
+	}
+	if err := insertPolicyRules(ctx, tx, p.ID, rules); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// Update updates a policy, replacing its rules unless rules is nil
+func (s *PolicyStore) Update(ctx context.Context, p *models.Policy, rules []models.PolicyRule) error {
+	constraints, err := constraintsJSON(p)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	tenant, args := tenantClause(ctx, "tenant_id", []interface{}{p.ID, p.Name, p.Description, p.Priority, p.IsEnabled, constraints})
+	err = tx.QueryRow(ctx, `
+		UPDATE policies SET name = $2, description = $3, priority = $4, is_enabled = $5, constraints = $6, updated_at = NOW()
+		WHERE id = $1 AND `+tenant+`
+		RETURNING updated_at
+	`, args...).Scan(&p.UpdatedAt)
+	if err == pgx.ErrNoRows {
+		return ErrPolicyNotFound
+	}
+	if isUniqueViolation(err) {
+		return ErrPolicyExists
+	}
+	if err != nil {
+		return err
+	}
+
+	if rules != nil {
+		if _, err := tx.Exec(ctx, `DELETE FROM policy_rules WHERE policy_id = $1`, p.ID); err != nil {
+			return err
+		}
+		if err := insertPolicyRules(ctx, tx, p.ID, rules); err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+func insertPolicyRules(ctx context.Context, tx pgx.Tx, policyID uuid.UUID, rules []models.PolicyRule) error {
+	for i := range rules {
+		r := &rules[i]
+		r.PolicyID = policyID
+		if err := tx.QueryRow(ctx, `
+			INSERT INTO policy_rules (policy_id, action, subject, resource, conditions, priority)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			RETURNING id, created_at
+		`, policyID, r.Action, []byte(r.Subject), []byte(r.Resource), []byte(r.Conditions), r.Priority).Scan(&r.ID, &r.CreatedAt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete deletes a policy and its rules
+func (s *PolicyStore) Delete(ctx context.Context, id string) error {
+	if _, err := uuid.Parse(id); err != nil {
+		return ErrPolicyNotFound
+	}
+	tx, err := s.db.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	tenant, args := tenantClause(ctx, "tenant_id", []interface{}{id})
+	if _, err := tx.Exec(ctx, `
+		DELETE FROM policy_rules WHERE policy_id IN (SELECT id FROM policies WHERE id = $1 AND `+tenant+`)
+	`, args...); err != nil {
+		return err
+	}
+	result, err := tx.Exec(ctx, `DELETE FROM policies WHERE id = $1 AND `+tenant, args...)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return ErrPolicyNotFound
+	}
+	return tx.Commit(ctx)
+}
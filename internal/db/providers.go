@@ -25,6 +25,13 @@ type OIDCProvider struct {
 	Scopes       []string `json:"scopes"`
 	AdminGroup   string   `json:"admin_group,omitempty"`
 	Enabled      bool     `json:"enabled"`
+	// AdditionalAudiences are other client IDs whose ID tokens are accepted
+	AdditionalAudiences []string `json:"additional_audiences"`
+	// CNSource is where users' VPN certificate common name comes from: email,
+	// subject, or claim:<name>
+	CNSource string `json:"cn_source"`
+	// TenantID is the tenant the provider's users belong to
+	TenantID string `json:"tenant_id,omitempty"`
 }
 
 // SAMLProvider represents a SAML provider configuration
@@ -37,6 +44,19 @@ type SAMLProvider struct {
 	ACSURL         string `json:"acs_url"`
 	AdminGroup     string `json:"admin_group,omitempty"`
 	Enabled        bool   `json:"enabled"`
+	// SignRequests signs AuthnRequests with the SP key, for IdPs that require it
+	SignRequests bool `json:"sign_requests"`
+	// NameIDFormat is the NameID format requested from the IdP; empty lets the IdP choose
+	NameIDFormat string `json:"name_id_format,omitempty"`
+	// AllowIDPInitiated accepts responses the IdP sends without an AuthnRequest,
+	// and doesn't check InResponseTo on any response
+	AllowIDPInitiated bool `json:"allow_idp_initiated"`
+	// SPCertificate is the PEM SP certificate published in the metadata, generated
+	// with SPPrivateKey on first use
+	SPCertificate string `json:"sp_certificate,omitempty"`
+	SPPrivateKey  string `json:"-"`
+	// TenantID is the tenant the provider's users belong to
+	TenantID string `json:"tenant_id,omitempty"`
 }
 
 // ProviderStore handles OIDC and SAML provider persistence
@@ -52,11 +72,13 @@ func NewProviderStore(db *DB) *ProviderStore {
 // OIDC Provider operations
 
 func (s *ProviderStore) GetOIDCProviders(ctx context.Context) ([]*OIDCProvider, error) {
+	tenant, args := tenantClause(ctx, "tenant_id", nil)
 	rows, err := s.db.Pool.Query(ctx, `
-		SELECT id, name, display_name, issuer, client_id, redirect_url, scopes, admin_group, is_enabled
+		SELECT id, name, display_name, issuer, client_id, redirect_url, scopes, admin_group, is_enabled, additional_audiences, cn_source
 		FROM oidc_providers
+		WHERE `+tenant+`
 		ORDER BY name
-	`)
+	`, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -65,12 +87,13 @@ func (s *ProviderStore) GetOIDCProviders(ctx context.Context) ([]*OIDCProvider,
 	var providers []*OIDCProvider
 	for rows.Next() {
 		var p OIDCProvider
-		var scopesJSON []byte
+		var scopesJSON, audiencesJSON []byte
 		var adminGroup *string
-		if err := rows.Scan(&p.ID, &p.Name, &p.DisplayName, &p.Issuer, &p.ClientID, &p.RedirectURL, &scopesJSON, &adminGroup, &p.Enabled); err != nil {
+		if err := rows.Scan(&p.ID, &p.Name, &p.DisplayName, &p.Issuer, &p.ClientID, &p.RedirectURL, &scopesJSON, &adminGroup, &p.Enabled, &audiencesJSON, &p.CNSource); err != nil {
 			return nil, err
 		}
 		json.Unmarshal(scopesJSON, &p.Scopes)
+		json.Unmarshal(audiencesJSON, &p.AdditionalAudiences)
 		if adminGroup != nil {
 			p.AdminGroup = *adminGroup
 		}
@@ -81,35 +104,62 @@ func (s *ProviderStore) GetOIDCProviders(ctx context.Context) ([]*OIDCProvider,
 
 func (s *ProviderStore) GetOIDCProvider(ctx context.Context, name string) (*OIDCProvider, error) {
 	var p OIDCProvider
-	var scopesJSON []byte
+	var scopesJSON, audiencesJSON []byte
 	var adminGroup *string
+	tenant, args := tenantClause(ctx, "tenant_id", []interface{}{name})
 	err := s.db.Pool.QueryRow(ctx, `
-		SELECT id, name, display_name, issuer, client_id, client_secret, redirect_url, scopes, admin_group, is_enabled
-		FROM oidc_providers WHERE name = $1
-	`, name).Scan(&p.ID, &p.Name, &p.DisplayName, &p.Issuer, &p.ClientID, &p.ClientSecret, &p.RedirectURL, &scopesJSON, &adminGroup, &p.Enabled)
+		SELECT id, name, display_name, issuer, client_id, client_secret, redirect_url, scopes, admin_group, is_enabled, additional_audiences, cn_source, tenant_id
+		FROM oidc_providers WHERE name = $1 AND `+tenant, args...).Scan(&p.ID, &p.Name, &p.DisplayName, &p.Issuer, &p.ClientID, &p.ClientSecret, &p.RedirectURL, &scopesJSON, &adminGroup, &p.Enabled, &audiencesJSON, &p.CNSource, &p.TenantID)
 	if err == pgx.ErrNoRows {
 		return nil, ErrProviderNotFound
 	}
 	if err != nil {
 		return nil, err
 	}
+	if p.ClientSecret, err = s.db.open(p.ClientSecret); err != nil {
+		return nil, err
+	}
 	json.Unmarshal(scopesJSON, &p.Scopes)
+	json.Unmarshal(audiencesJSON, &p.AdditionalAudiences)
 	if adminGroup != nil {
 		p.AdminGroup = *adminGroup
 	}
 	return &p, nil
 }
 
+// providerNameTaken reports whether an OIDC, SAML or LDAP provider already has
+// the name. SSO users are keyed by provider name, so names are unique across all
+// three types.
+func (s *ProviderStore) providerNameTaken(ctx context.Context, name string) (bool, error) {
+	var taken bool
+	err := s.db.Pool.QueryRow(ctx, `
+		SELECT EXISTS (SELECT 1 FROM oidc_providers WHERE name = $1)
+		    OR EXISTS (SELECT 1 FROM saml_providers WHERE name = $1)
+		    OR EXISTS (SELECT 1 FROM ldap_providers WHERE name = $1)
+	`, name).Scan(&taken)
+	return taken, err
+}
+
 func (s *ProviderStore) CreateOIDCProvider(ctx context.Context, p *OIDCProvider) error {
+	if taken, err := s.providerNameTaken(ctx, p.Name); err != nil {
+		return err
+	} else if taken {
+		return ErrProviderExists
+	}
 	scopesJSON, _ := json.Marshal(p.Scopes)
+	audiencesJSON := audiencesJSON(p.AdditionalAudiences)
 	var adminGroup *string
 	if p.AdminGroup != "" {
 		adminGroup = &p.AdminGroup
 	}
-	_, err := s.db.Pool.Exec(ctx, `
-		INSERT INTO oidc_providers (name, display_name, issuer, client_id, client_secret, redirect_url, scopes, admin_group, is_enabled)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
-	`, p.Name, p.DisplayName, p.Issuer, p.ClientID, p.ClientSecret, p.RedirectURL, scopesJSON, adminGroup, p.Enabled)
+	clientSecret, err := s.db.seal(p.ClientSecret)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Pool.Exec(ctx, `
+		INSERT INTO oidc_providers (name, display_name, issuer, client_id, client_secret, redirect_url, scopes, admin_group, is_enabled, additional_audiences, cn_source, tenant_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+	`, p.Name, p.DisplayName, p.Issuer, p.ClientID, clientSecret, p.RedirectURL, scopesJSON, adminGroup, p.Enabled, audiencesJSON, cnSourceOrDefault(p.CNSource), tenantForInsert(ctx))
 	if err != nil && err.Error() == `ERROR: duplicate key value violates unique constraint "oidc_providers_name_key" (SQLSTATE 23505)` {
 		return ErrProviderExists
 	}
@@ -118,6 +168,7 @@ func (s *ProviderStore) CreateOIDCProvider(ctx context.Context, p *OIDCProvider)
 
 func (s *ProviderStore) UpdateOIDCProvider(ctx context.Context, name string, p *OIDCProvider) error {
 	scopesJSON, _ := json.Marshal(p.Scopes)
+	audiencesJSON := audiencesJSON(p.AdditionalAudiences)
 	var adminGroup *string
 	if p.AdminGroup != "" {
 		adminGroup = &p.AdminGroup
@@ -128,19 +179,25 @@ func (s *ProviderStore) UpdateOIDCProvider(ctx context.Context, name string, p *
 
 	if p.ClientSecret == "" {
 		// Don't update the secret if not provided
+		tenant, args := tenantClause(ctx, "tenant_id", []interface{}{name, p.DisplayName, p.Issuer, p.ClientID, p.RedirectURL, scopesJSON, adminGroup, p.Enabled, audiencesJSON, cnSourceOrDefault(p.CNSource)})
 		result, err = s.db.Pool.Query(ctx, `
 			UPDATE oidc_providers
-			SET display_name = $2, issuer = $3, client_id = $4, redirect_url = $5, scopes = $6, admin_group = $7, is_enabled = $8
-			WHERE name = $1
+			SET display_name = $2, issuer = $3, client_id = $4, redirect_url = $5, scopes = $6, admin_group = $7, is_enabled = $8, additional_audiences = $9, cn_source = $10
+			WHERE name = $1 AND `+tenant+`
 			RETURNING id
-		`, name, p.DisplayName, p.Issuer, p.ClientID, p.RedirectURL, scopesJSON, adminGroup, p.Enabled)
+		`, args...)
 	} else {
+		clientSecret, sealErr := s.db.seal(p.ClientSecret)
+		if sealErr != nil {
+			return sealErr
+		}
+		tenant, args := tenantClause(ctx, "tenant_id", []interface{}{name, p.DisplayName, p.Issuer, p.ClientID, clientSecret, p.RedirectURL, scopesJSON, adminGroup, p.Enabled, audiencesJSON, cnSourceOrDefault(p.CNSource)})
 		result, err = s.db.Pool.Query(ctx, `
 			UPDATE oidc_providers
-			SET display_name = $2, issuer = $3, client_id = $4, client_secret = $5, redirect_url = $6, scopes = $7, admin_group = $8, is_enabled = $9
-			WHERE name = $1
+			SET display_name = $2, issuer = $3, client_id = $4, client_secret = $5, redirect_url = $6, scopes = $7, admin_group = $8, is_enabled = $9, additional_audiences = $10, cn_source = $11
+			WHERE name = $1 AND `+tenant+`
 			RETURNING id
-		`, name, p.DisplayName, p.Issuer, p.ClientID, p.ClientSecret, p.RedirectURL, scopesJSON, adminGroup, p.Enabled)
+		`, args...)
 	}
 	if err != nil {
 		return err
@@ -153,8 +210,26 @@ func (s *ProviderStore) UpdateOIDCProvider(ctx context.Context, name string, p *
 	return nil
 }
 
+// cnSourceOrDefault returns the common name source to store, email if unset.
+func cnSourceOrDefault(source string) string {
+	if source == "" {
+		return "email"
+	}
+	return source
+}
+
+// audiencesJSON encodes additional audiences, storing none as an empty array.
+func audiencesJSON(audiences []string) []byte {
+	if len(audiences) == 0 {
+		return []byte("[]")
+	}
+	data, _ := json.Marshal(audiences)
+	return data
+}
+
 func (s *ProviderStore) DeleteOIDCProvider(ctx context.Context, name string) error {
-	result, err := s.db.Pool.Exec(ctx, `DELETE FROM oidc_providers WHERE name = $1`, name)
+	tenant, args := tenantClause(ctx, "tenant_id", []interface{}{name})
+	result, err := s.db.Pool.Exec(ctx, `DELETE FROM oidc_providers WHERE name = $1 AND `+tenant, args...)
 	if err != nil {
 		return err
 	}
@@ -167,11 +242,14 @@ func (s *ProviderStore) DeleteOIDCProvider(ctx context.Context, name string) err
 // SAML Provider operations
 
 func (s *ProviderStore) GetSAMLProviders(ctx context.Context) ([]*SAMLProvider, error) {
+	tenant, args := tenantClause(ctx, "tenant_id", nil)
 	rows, err := s.db.Pool.Query(ctx, `
-		SELECT id, name, display_name, idp_metadata_url, entity_id, acs_url, admin_group, is_enabled
+		SELECT id, name, display_name, idp_metadata_url, entity_id, acs_url, admin_group, is_enabled,
+		       sign_requests, name_id_format, allow_idp_initiated, COALESCE(sp_certificate, '')
 		FROM saml_providers
+		WHERE `+tenant+`
 		ORDER BY name
-	`)
+	`, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -181,7 +259,8 @@ func (s *ProviderStore) GetSAMLProviders(ctx context.Context) ([]*SAMLProvider,
 	for rows.Next() {
 		var p SAMLProvider
 		var adminGroup *string
-		if err := rows.Scan(&p.ID, &p.Name, &p.DisplayName, &p.IDPMetadataURL, &p.EntityID, &p.ACSURL, &adminGroup, &p.Enabled); err != nil {
+		if err := rows.Scan(&p.ID, &p.Name, &p.DisplayName, &p.IDPMetadataURL, &p.EntityID, &p.ACSURL, &adminGroup, &p.Enabled,
+			&p.SignRequests, &p.NameIDFormat, &p.AllowIDPInitiated, &p.SPCertificate); err != nil {
 			return nil, err
 		}
 		if adminGroup != nil {
@@ -195,16 +274,21 @@ func (s *ProviderStore) GetSAMLProviders(ctx context.Context) ([]*SAMLProvider,
 func (s *ProviderStore) GetSAMLProvider(ctx context.Context, name string) (*SAMLProvider, error) {
 	var p SAMLProvider
 	var adminGroup *string
+	tenant, args := tenantClause(ctx, "tenant_id", []interface{}{name})
 	err := s.db.Pool.QueryRow(ctx, `
-		SELECT id, name, display_name, idp_metadata_url, entity_id, acs_url, admin_group, is_enabled
-		FROM saml_providers WHERE name = $1
-	`, name).Scan(&p.ID, &p.Name, &p.DisplayName, &p.IDPMetadataURL, &p.EntityID, &p.ACSURL, &adminGroup, &p.Enabled)
+		SELECT id, name, display_name, idp_metadata_url, entity_id, acs_url, admin_group, is_enabled, tenant_id,
+		       sign_requests, name_id_format, allow_idp_initiated, COALESCE(sp_certificate, ''), COALESCE(sp_private_key, '')
+		FROM saml_providers WHERE name = $1 AND `+tenant, args...).Scan(&p.ID, &p.Name, &p.DisplayName, &p.IDPMetadataURL, &p.EntityID, &p.ACSURL, &adminGroup, &p.Enabled, &p.TenantID,
+		&p.SignRequests, &p.NameIDFormat, &p.AllowIDPInitiated, &p.SPCertificate, &p.SPPrivateKey)
 	if err == pgx.ErrNoRows {
 		return nil, ErrProviderNotFound
 	}
 	if err != nil {
 		return nil, err
 	}
+	if p.SPPrivateKey, err = s.db.open(p.SPPrivateKey); err != nil {
+		return nil, err
+	}
 	if adminGroup != nil {
 		p.AdminGroup = *adminGroup
 	}
@@ -212,14 +296,19 @@ func (s *ProviderStore) GetSAMLProvider(ctx context.Context, name string) (*SAML
 }
 
 func (s *ProviderStore) CreateSAMLProvider(ctx context.Context, p *SAMLProvider) error {
+	if taken, err := s.providerNameTaken(ctx, p.Name); err != nil {
+		return err
+	} else if taken {
+		return ErrProviderExists
+	}
 	var adminGroup *string
 	if p.AdminGroup != "" {
 		adminGroup = &p.AdminGroup
 	}
 	_, err := s.db.Pool.Exec(ctx, `
-		INSERT INTO saml_providers (name, display_name, idp_metadata_url, entity_id, acs_url, admin_group, is_enabled)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
-	`, p.Name, p.DisplayName, p.IDPMetadataURL, p.EntityID, p.ACSURL, adminGroup, p.Enabled)
+		INSERT INTO saml_providers (name, display_name, idp_metadata_url, entity_id, acs_url, admin_group, is_enabled, sign_requests, name_id_format, allow_idp_initiated, tenant_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+	`, p.Name, p.DisplayName, p.IDPMetadataURL, p.EntityID, p.ACSURL, adminGroup, p.Enabled, p.SignRequests, p.NameIDFormat, p.AllowIDPInitiated, tenantForInsert(ctx))
 	if err != nil && err.Error() == `ERROR: duplicate key value violates unique constraint "saml_providers_name_key" (SQLSTATE 23505)` {
 		return ErrProviderExists
 	}
@@ -231,11 +320,12 @@ func (s *ProviderStore) UpdateSAMLProvider(ctx context.Context, name string, p *
 	if p.AdminGroup != "" {
 		adminGroup = &p.AdminGroup
 	}
+	tenant, args := tenantClause(ctx, "tenant_id", []interface{}{name, p.DisplayName, p.IDPMetadataURL, p.EntityID, p.ACSURL, adminGroup, p.Enabled, p.SignRequests, p.NameIDFormat, p.AllowIDPInitiated})
 	result, err := s.db.Pool.Exec(ctx, `
 		UPDATE saml_providers
-		SET display_name = $2, idp_metadata_url = $3, entity_id = $4, acs_url = $5, admin_group = $6, is_enabled = $7
-		WHERE name = $1
-	`, name, p.DisplayName, p.IDPMetadataURL, p.EntityID, p.ACSURL, adminGroup, p.Enabled)
+		SET display_name = $2, idp_metadata_url = $3, entity_id = $4, acs_url = $5, admin_group = $6, is_enabled = $7,
+		    sign_requests = $8, name_id_format = $9, allow_idp_initiated = $10
+		WHERE name = $1 AND `+tenant, args...)
 	if err != nil {
 		return err
 	}
@@ -245,8 +335,27 @@ func (s *ProviderStore) UpdateSAMLProvider(ctx context.Context, name string, p *
 	return nil
 }
 
+// SetSAMLSigningKey stores a provider's SP certificate and private key unless it
+// already has them, and reports whether they were stored. Callers that lose a
+// race to generate the key pair re-read the provider to use the winner's.
+func (s *ProviderStore) SetSAMLSigningKey(ctx context.Context, id, certificatePEM, privateKeyPEM string) (bool, error) {
+	privateKey, err := s.db.seal(privateKeyPEM)
+	if err != nil {
+		return false, err
+	}
+	result, err := s.db.Pool.Exec(ctx, `
+		UPDATE saml_providers SET sp_certificate = $2, sp_private_key = $3
+		WHERE id = $1 AND COALESCE(sp_certificate, '') = ''
+	`, id, certificatePEM, privateKey)
+	if err != nil {
+		return false, err
+	}
+	return result.RowsAffected() == 1, nil
+}
+
 func (s *ProviderStore) DeleteSAMLProvider(ctx context.Context, name string) error {
-	result, err := s.db.Pool.Exec(ctx, `DELETE FROM saml_providers WHERE name = $1`, name)
+	tenant, args := tenantClause(ctx, "tenant_id", []interface{}{name})
+	result, err := s.db.Pool.Exec(ctx, `DELETE FROM saml_providers WHERE name = $1 AND `+tenant, args...)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,141 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Provisioned component types
+const (
+	ComponentGateway = "gateway"
+	ComponentHub     = "hub"
+	ComponentSpoke   = "spoke"
+)
+
+// ProvisioningStatus is what a gateway, hub or spoke last reported in its heartbeat
+// and was last provisioned with.
+type ProvisioningStatus struct {
+	ComponentType            string
+	ComponentID              string
+	ReportedConfigVersion    string
+	ReportedAt               *time.Time
+	ProvisionedCAFingerprint string // Root CA the component was last provisioned with
+	ProvisionedAt            *time.Time
+	ReprovisionRequestedAt   *time.Time
+}
+
+// ReprovisionPending reports whether an admin requested a reprovision that the
+// component hasn't yet picked up.
+func (p *ProvisioningStatus) ReprovisionPending() bool {
+	if p == nil || p.ReprovisionRequestedAt == nil {
+		return false
+	}
+	return p.ProvisionedAt == nil || p.ProvisionedAt.Before(*p.ReprovisionRequestedAt)
+}
+
+// ProvisioningStore tracks provisioning state across gateways, hubs and spokes
+type ProvisioningStore struct {
+	db *DB
+}
+
+// NewProvisioningStore creates a new provisioning store
+func NewProvisioningStore(db *DB) *ProvisioningStore {
+	return &ProvisioningStore{db: db}
+}
+
+// RecordReport stores the config version a component reported in its heartbeat.
+// The row is only written when the version changes, so heartbeats stay cheap.
+func (s *ProvisioningStore) RecordReport(ctx context.Context, componentType, componentID, configVersion string) error {
+	_, err := s.db.Pool.Exec(ctx, `
+		INSERT INTO component_provisioning (component_type, component_id, reported_config_version, reported_at)
+		VALUES ($1, $2, $3, NOW())
+		ON CONFLICT (component_type, component_id) DO UPDATE SET
+			reported_config_version = EXCLUDED.reported_config_version,
+			reported_at = NOW()
+		WHERE component_provisioning.reported_config_version <> EXCLUDED.reported_config_version
+			OR component_provisioning.reported_at IS NULL
+	`, componentType, componentID, configVersion)
+	return err
+}
+
+// RecordProvisioned stores the root CA a component was just provisioned with
+func (s *ProvisioningStore) RecordProvisioned(ctx context.Context, componentType, componentID, caFingerprint string) error {
+	_, err := s.db.Pool.Exec(ctx, `
+		INSERT INTO component_provisioning (component_type, component_id, provisioned_ca_fingerprint, provisioned_at)
+		VALUES ($1, $2, $3, NOW())
+		ON CONFLICT (component_type, component_id) DO UPDATE SET
+			provisioned_ca_fingerprint = EXCLUDED.provisioned_ca_fingerprint,
+			provisioned_at = NOW()
+	`, componentType, componentID, caFingerprint)
+	return err
+}
+
+// RequestReprovision marks a component as asked to reprovision. Hubs and spokes
+// are signaled on their next heartbeat until they provision again.
+func (s *ProvisioningStore) RequestReprovision(ctx context.Context, componentType, componentID string) error {
+	_, err := s.db.Pool.Exec(ctx, `
+		INSERT INTO component_provisioning (component_type, component_id, reprovision_requested_at)
+		VALUES ($1, $2, NOW())
+		ON CONFLICT (component_type, component_id) DO UPDATE SET reprovision_requested_at = NOW()
+	`, componentType, componentID)
+	return err
+}
+
+// Get returns a component's provisioning status, or nil if nothing was recorded yet
+func (s *ProvisioningStore) Get(ctx context.Context, componentType, componentID string) (*ProvisioningStatus, error) {
+	var p ProvisioningStatus
+	err := s.db.Pool.QueryRow(ctx, `
+		SELECT component_type, component_id, reported_config_version, reported_at,
+			provisioned_ca_fingerprint, provisioned_at, reprovision_requested_at
+		FROM component_provisioning WHERE component_type = $1 AND component_id::text = $2
+	`, componentType, componentID).Scan(&p.ComponentType, &p.ComponentID, &p.ReportedConfigVersion, &p.ReportedAt,
+		&p.ProvisionedCAFingerprint, &p.ProvisionedAt, &p.ReprovisionRequestedAt)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// List returns the provisioning status of every component of a type, keyed by ID
+func (s *ProvisioningStore) List(ctx context.Context, componentType string) (map[string]*ProvisioningStatus, error) {
+	rows, err := s.db.Pool.Query(ctx, `
+		SELECT component_type, component_id, reported_config_version, reported_at,
+			provisioned_ca_fingerprint, provisioned_at, reprovision_requested_at
+		FROM component_provisioning WHERE component_type = $1
+	`, componentType)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	statuses := make(map[string]*ProvisioningStatus)
+	for rows.Next() {
+		var p ProvisioningStatus
+		if err := rows.Scan(&p.ComponentType, &p.ComponentID, &p.ReportedConfigVersion, &p.ReportedAt,
+			&p.ProvisionedCAFingerprint, &p.ProvisionedAt, &p.ReprovisionRequestedAt); err != nil {
+			return nil, err
+		}
+		statuses[p.ComponentID] = &p
+	}
+	return statuses, rows.Err()
+}
+
+// CountProvisionedWithCA returns how many existing components were last
+// provisioned with the root CA that has the given fingerprint.
+func (s *ProvisioningStore) CountProvisionedWithCA(ctx context.Context, caFingerprint string) (int, error) {
+	var count int
+	err := s.db.Pool.QueryRow(ctx, `
+		SELECT COUNT(*) FROM component_provisioning p
+		WHERE p.provisioned_ca_fingerprint = $1 AND (
+			(p.component_type = 'gateway' AND EXISTS (SELECT 1 FROM gateways g WHERE g.id = p.component_id AND g.deleted_at IS NULL))
+			OR (p.component_type = 'hub' AND EXISTS (SELECT 1 FROM mesh_hubs h WHERE h.id = p.component_id))
+			OR (p.component_type = 'spoke' AND EXISTS (SELECT 1 FROM mesh_gateways m WHERE m.id = p.component_id))
+		)
+	`, caFingerprint).Scan(&count)
+	return count, err
+}
@@ -231,14 +231,17 @@ func (s *ProxyApplicationStore) DeleteProxyApplication(ctx context.Context, id s
 
 // ---- User Assignment Methods ----
 
-// AssignAppToUser assigns a proxy application to a user
-func (s *ProxyApplicationStore) AssignAppToUser(ctx context.Context, userID, appID string) error {
-	_, err := s.db.Pool.Exec(ctx, `
+// AssignAppToUser assigns a proxy application to a user, reporting whether it wasn't already assigned
+func (s *ProxyApplicationStore) AssignAppToUser(ctx context.Context, userID, appID string) (bool, error) {
+	result, err := s.db.Pool.Exec(ctx, `
 		INSERT INTO user_proxy_applications (user_id, proxy_app_id)
 		VALUES ($1, $2)
 		ON CONFLICT DO NOTHING
 	`, userID, appID)
-	return err
+	if err != nil {
+		return false, err
+	}
+	return result.RowsAffected() > 0, nil
 }
 
 // RemoveAppFromUser removes a proxy application from a user
@@ -272,14 +275,17 @@ func (s *ProxyApplicationStore) GetAppUsers(ctx context.Context, appID string) (
 
 // ---- Group Assignment Methods ----
 
-// AssignAppToGroup assigns a proxy application to a group
-func (s *ProxyApplicationStore) AssignAppToGroup(ctx context.Context, groupName, appID string) error {
-	_, err := s.db.Pool.Exec(ctx, `
+// AssignAppToGroup assigns a proxy application to a group, reporting whether it wasn't already assigned
+func (s *ProxyApplicationStore) AssignAppToGroup(ctx context.Context, groupName, appID string) (bool, error) {
+	result, err := s.db.Pool.Exec(ctx, `
 		INSERT INTO group_proxy_applications (group_name, proxy_app_id)
 		VALUES ($1, $2)
 		ON CONFLICT DO NOTHING
 	`, groupName, appID)
-	return err
+	if err != nil {
+		return false, err
+	}
+	return result.RowsAffected() > 0, nil
 }
 
 // RemoveAppFromGroup removes a proxy application from a group
@@ -0,0 +1,185 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/gatekey-project/gatekey/internal/secrets"
+)
+
+// secretColumn is a column holding a secret that's encrypted at rest with the
+// DB's keyring.
+type secretColumn struct {
+	Table  string
+	Column string
+	Binary bool // BYTEA rather than TEXT
+}
+
+// secretColumns lists every column encrypted at rest.
+var secretColumns = []secretColumn{
+	{Table: "oidc_providers", Column: "client_secret"},
+	{Table: "ldap_providers", Column: "bind_password"},
+	{Table: "saml_providers", Column: "sp_private_key"},
+	{Table: "pki_ca", Column: "private_key_pem"},
+	{Table: "gateways", Column: "tls_auth_key"},
+	{Table: "mesh_hubs", Column: "ca_key"},
+	{Table: "mesh_hubs", Column: "server_key"},
+	{Table: "mesh_hubs", Column: "tls_auth_key"},
+	{Table: "mesh_gateways", Column: "client_key"},
+	{Table: "generated_configs", Column: "config_data", Binary: true},
+	{Table: "mesh_generated_configs", Column: "config_data", Binary: true},
+}
+
+// seal encrypts a secret column value for storage. Without a keyring it's
+// stored as plaintext.
+func (db *DB) seal(value string) (string, error) {
+	sealed, err := db.Secrets.SealString(value)
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt secret: %w", err)
+	}
+	return sealed, nil
+}
+
+// open decrypts a secret column value read from the database.
+func (db *DB) open(value string) (string, error) {
+	plaintext, err := db.Secrets.OpenString(value)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt secret: %w", err)
+	}
+	return plaintext, nil
+}
+
+// sealBytes is seal for BYTEA columns.
+func (db *DB) sealBytes(value []byte) ([]byte, error) {
+	sealed, err := db.Secrets.Seal(value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt secret: %w", err)
+	}
+	return sealed, nil
+}
+
+// openBytes is open for BYTEA columns.
+func (db *DB) openBytes(value []byte) ([]byte, error) {
+	plaintext, err := db.Secrets.Open(value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt secret: %w", err)
+	}
+	return plaintext, nil
+}
+
+// SecretColumnStatus counts how a secret column's values are stored.
+type SecretColumnStatus struct {
+	Table     string
+	Column    string
+	Plaintext int            // Values not yet encrypted
+	ByKey     map[string]int // Encrypted values by key ID
+}
+
+// SecretStatus reports, for every secret column, how many values are plaintext
+// and how many are encrypted with each key. Empty values aren't counted.
+func (db *DB) SecretStatus(ctx context.Context) ([]SecretColumnStatus, error) {
+	statuses := make([]SecretColumnStatus, 0, len(secretColumns))
+	for _, col := range secretColumns {
+		status := SecretColumnStatus{Table: col.Table, Column: col.Column, ByKey: make(map[string]int)}
+		rows, err := db.Pool.Query(ctx, fmt.Sprintf(`SELECT %s FROM %s WHERE %s IS NOT NULL`, col.Column, col.Table, col.Column))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s.%s: %w", col.Table, col.Column, err)
+		}
+		for rows.Next() {
+			var value []byte
+			if err := rows.Scan(&value); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			if len(value) == 0 {
+				continue
+			}
+			if id, ok := secrets.KeyID(value); ok {
+				status.ByKey[id]++
+			} else {
+				status.Plaintext++
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// RekeySecrets re-encrypts every secret column value with the keyring's primary
+// key, decrypting it with whichever key sealed it, or encrypting it for the first
+// time if it's plaintext. It runs in one transaction, so either every value is
+// rekeyed or none is. It returns how many values were rewritten.
+func (db *DB) RekeySecrets(ctx context.Context) (int, error) {
+	if db.Secrets == nil {
+		return 0, fmt.Errorf("no encryption keys are configured")
+	}
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	rekeyed := 0
+	for _, col := range secretColumns {
+		n, err := db.rekeyColumn(ctx, tx, col)
+		if err != nil {
+			return 0, fmt.Errorf("failed to rekey %s.%s: %w", col.Table, col.Column, err)
+		}
+		rekeyed += n
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+	return rekeyed, nil
+}
+
+func (db *DB) rekeyColumn(ctx context.Context, tx pgx.Tx, col secretColumn) (int, error) {
+	rows, err := tx.Query(ctx, fmt.Sprintf(`SELECT ctid::text, %s FROM %s WHERE %s IS NOT NULL FOR UPDATE`, col.Column, col.Table, col.Column))
+	if err != nil {
+		return 0, err
+	}
+	type row struct {
+		ctid  string
+		value []byte
+	}
+	var pending []row
+	for rows.Next() {
+		var r row
+		if err := rows.Scan(&r.ctid, &r.value); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		if id, _ := secrets.KeyID(r.value); len(r.value) > 0 && id != db.Secrets.Primary() {
+			pending = append(pending, r)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, r := range pending {
+		plaintext, err := db.Secrets.Open(r.value)
+		if err != nil {
+			return 0, err
+		}
+		sealed, err := db.Secrets.Seal(plaintext)
+		if err != nil {
+			return 0, err
+		}
+		var arg interface{} = string(sealed)
+		if col.Binary {
+			arg = sealed
+		}
+		if _, err := tx.Exec(ctx, fmt.Sprintf(`UPDATE %s SET %s = $1 WHERE ctid = $2::tid`, col.Table, col.Column), arg, r.ctid); err != nil {
+			return 0, err
+		}
+	}
+	return len(pending), nil
+}
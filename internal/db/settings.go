@@ -98,15 +98,23 @@ func (s *SettingsStore) GetBool(ctx context.Context, key string, defaultVal bool
 
 // Common setting keys
 const (
-	SettingSessionDurationHours  = "session_duration_hours"
-	SettingSecureCookies         = "secure_cookies"
-	SettingVPNCertValidityHours  = "vpn_cert_validity_hours"
-	SettingRequireFIPS           = "require_fips"
-	SettingAllowedCryptoProfiles = "allowed_crypto_profiles" // Comma-separated: modern,fips,compatible
-	SettingMinTLSVersion         = "min_tls_version"         // 1.0, 1.1, 1.2, 1.3
-	SettingAllowedCiphers        = "allowed_ciphers"         // Comma-separated cipher list
+	SettingSessionDurationHours     = "session_duration_hours"
+	SettingSecureCookies            = "secure_cookies"
+	SettingVPNCertValidityHours     = "vpn_cert_validity_hours"
+	SettingRequireFIPS              = "require_fips"
+	SettingAllowedCryptoProfiles    = "allowed_crypto_profiles"     // Comma-separated: modern,fips,compatible
+	SettingMinTLSVersion            = "min_tls_version"             // 1.0, 1.1, 1.2, 1.3
+	SettingAllowedCiphers           = "allowed_ciphers"             // Comma-separated cipher list
+	SettingAuthTokenLifetimeMinutes = "auth_token_lifetime_minutes" // OpenVPN auth-gen-token lifetime; 0 disables
+	SettingRevocationEpoch          = "revocation_epoch"            // Bumped on revocation so gateways drop cached verify results
+	SettingLocalAuthEnabled         = "local_auth_enabled"          // false for SSO-only deployments; break-glass users can still log in
+	SettingAdminAllowedCIDRs        = "admin_allowed_cidrs"         // Comma-separated networks allowed to use the admin API; empty allows all
+	SettingConnectMessage           = "connect_message"             // Shown by the CLI after connecting; empty for none
 )
 
+// DefaultAuthTokenLifetimeMinutes is the auth-gen-token lifetime used when the setting is unset.
+const DefaultAuthTokenLifetimeMinutes = 60
+
 // Default crypto profiles (all enabled by default)
 const DefaultAllowedCryptoProfiles = "modern,fips,compatible"
 
@@ -0,0 +1,67 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrSignInAlertInvalid is returned when a "this wasn't me" token is unknown,
+// expired or already used.
+var ErrSignInAlertInvalid = errors.New("invalid or expired link")
+
+// SignInAlert is a new sign-in a user was emailed about.
+type SignInAlert struct {
+	UserID    string
+	UserEmail string
+	Provider  string
+	IPAddress string
+	CreatedAt time.Time
+}
+
+// CreateSignInAlert stores the token for reporting a sign-in. Expired tokens are
+// pruned at the same time.
+func (s *LoginLogStore) CreateSignInAlert(ctx context.Context, alert *SignInAlert, token string, expiresAt time.Time) error {
+	if _, err := s.db.Pool.Exec(ctx, `DELETE FROM sign_in_alerts WHERE expires_at < NOW()`); err != nil {
+		return err
+	}
+	_, err := s.db.Pool.Exec(ctx, `
+		INSERT INTO sign_in_alerts (user_id, user_email, provider, ip_address, token_hash, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, alert.UserID, alert.UserEmail, alert.Provider, alert.IPAddress, hashMagicLinkToken(token), expiresAt)
+	return err
+}
+
+// GetSignInAlert returns the sign-in an unused, unexpired token reports.
+func (s *LoginLogStore) GetSignInAlert(ctx context.Context, token string) (*SignInAlert, error) {
+	return s.signInAlert(ctx, `
+		SELECT user_id, user_email, provider, COALESCE(ip_address, ''), created_at
+		FROM sign_in_alerts
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+	`, token)
+}
+
+// ConsumeSignInAlert marks a token used and returns the sign-in it reports. The
+// update only matches unused, unexpired tokens, so it succeeds once.
+func (s *LoginLogStore) ConsumeSignInAlert(ctx context.Context, token string) (*SignInAlert, error) {
+	return s.signInAlert(ctx, `
+		UPDATE sign_in_alerts SET used_at = NOW()
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+		RETURNING user_id, user_email, provider, COALESCE(ip_address, ''), created_at
+	`, token)
+}
+
+func (s *LoginLogStore) signInAlert(ctx context.Context, query, token string) (*SignInAlert, error) {
+	var a SignInAlert
+	err := s.db.Pool.QueryRow(ctx, query, hashMagicLinkToken(token)).
+		Scan(&a.UserID, &a.UserEmail, &a.Provider, &a.IPAddress, &a.CreatedAt)
+	if err == pgx.ErrNoRows {
+		return nil, ErrSignInAlertInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
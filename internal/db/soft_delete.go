@@ -0,0 +1,170 @@
+package db
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Setting key for how long deleted gateways, networks and local users can be
+// restored before they are purged
+const SettingDeletedRetentionDays = "deleted_retention_days"
+
+// Deleted item types
+const (
+	DeletedTypeGateway   = "gateway"
+	DeletedTypeNetwork   = "network"
+	DeletedTypeLocalUser = "local_user"
+)
+
+// DeletedItem is a soft-deleted gateway, network or local user
+type DeletedItem struct {
+	Type      string
+	ID        string
+	Name      string
+	DeletedAt time.Time
+}
+
+func scanDeletedItems(rows pgx.Rows, itemType string) ([]*DeletedItem, error) {
+	defer rows.Close()
+
+	var items []*DeletedItem
+	for rows.Next() {
+		item := &DeletedItem{Type: itemType}
+		if err := rows.Scan(&item.ID, &item.Name, &item.DeletedAt); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// ListDeletedGateways returns gateways deleted after the given time, newest first
+func (s *GatewayStore) ListDeletedGateways(ctx context.Context, since time.Time) ([]*DeletedItem, error) {
+	tenant, args := tenantClause(ctx, "tenant_id", []interface{}{since})
+	rows, err := s.db.Pool.Query(ctx, `
+		SELECT id, name, deleted_at FROM gateways
+		WHERE deleted_at IS NOT NULL AND deleted_at >= $1 AND `+tenant+`
+		ORDER BY deleted_at DESC
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanDeletedItems(rows, DeletedTypeGateway)
+}
+
+// RestoreGateway undeletes a gateway deleted after the given time. Its user, group
+// and network assignments were kept, so it comes back as it was. The gateway stays
+// inactive until its next heartbeat.
+func (s *GatewayStore) RestoreGateway(ctx context.Context, id string, since time.Time) error {
+	tenant, args := tenantClause(ctx, "tenant_id", []interface{}{id, since})
+	result, err := s.db.Pool.Exec(ctx, `
+		UPDATE gateways SET deleted_at = NULL, updated_at = NOW()
+		WHERE id = $1 AND deleted_at IS NOT NULL AND deleted_at >= $2 AND `+tenant, args...)
+	if err != nil {
+		if strings.Contains(err.Error(), "duplicate key") {
+			return ErrGatewayExists
+		}
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return ErrGatewayNotFound
+	}
+	return nil
+}
+
+// PurgeDeletedGateways permanently removes gateways deleted before the given time,
+// along with their assignments
+func (s *GatewayStore) PurgeDeletedGateways(ctx context.Context, before time.Time) (int64, error) {
+	result, err := s.db.Pool.Exec(ctx, `DELETE FROM gateways WHERE deleted_at < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+// ListDeletedNetworks returns networks deleted after the given time, newest first
+func (s *NetworkStore) ListDeletedNetworks(ctx context.Context, since time.Time) ([]*DeletedItem, error) {
+	tenant, args := tenantClause(ctx, "tenant_id", []interface{}{since})
+	rows, err := s.db.Pool.Query(ctx, `
+		SELECT id, name, deleted_at FROM networks
+		WHERE deleted_at IS NOT NULL AND deleted_at >= $1 AND `+tenant+`
+		ORDER BY deleted_at DESC
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanDeletedItems(rows, DeletedTypeNetwork)
+}
+
+// RestoreNetwork undeletes a network deleted after the given time, along with its
+// gateway assignments
+func (s *NetworkStore) RestoreNetwork(ctx context.Context, id string, since time.Time) error {
+	tenant, args := tenantClause(ctx, "tenant_id", []interface{}{id, since})
+	result, err := s.db.Pool.Exec(ctx, `
+		UPDATE networks SET deleted_at = NULL
+		WHERE id = $1 AND deleted_at IS NOT NULL AND deleted_at >= $2 AND `+tenant, args...)
+	if err != nil {
+		if strings.Contains(err.Error(), "duplicate key") {
+			return ErrNetworkExists
+		}
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return ErrNetworkNotFound
+	}
+	return nil
+}
+
+// PurgeDeletedNetworks permanently removes networks deleted before the given time
+func (s *NetworkStore) PurgeDeletedNetworks(ctx context.Context, before time.Time) (int64, error) {
+	result, err := s.db.Pool.Exec(ctx, `DELETE FROM networks WHERE deleted_at < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+// ListDeletedLocalUsers returns local users deleted after the given time, newest first
+func (s *UserStore) ListDeletedLocalUsers(ctx context.Context, since time.Time) ([]*DeletedItem, error) {
+	tenant, args := tenantClause(ctx, "tenant_id", []interface{}{since})
+	rows, err := s.db.Pool.Query(ctx, `
+		SELECT id, username, deleted_at FROM local_users
+		WHERE deleted_at IS NOT NULL AND deleted_at >= $1 AND `+tenant+`
+		ORDER BY deleted_at DESC
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanDeletedItems(rows, DeletedTypeLocalUser)
+}
+
+// RestoreLocalUser undeletes a local user deleted after the given time. Their
+// sessions were ended on deletion, so they have to log in again.
+func (s *UserStore) RestoreLocalUser(ctx context.Context, id string, since time.Time) error {
+	tenant, args := tenantClause(ctx, "tenant_id", []interface{}{id, since})
+	result, err := s.db.Pool.Exec(ctx, `
+		UPDATE local_users SET deleted_at = NULL
+		WHERE id = $1 AND deleted_at IS NOT NULL AND deleted_at >= $2 AND `+tenant, args...)
+	if err != nil {
+		if strings.Contains(err.Error(), "duplicate key") {
+			return ErrUserExists
+		}
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// PurgeDeletedLocalUsers permanently removes local users deleted before the given time
+func (s *UserStore) PurgeDeletedLocalUsers(ctx context.Context, before time.Time) (int64, error) {
+	result, err := s.db.Pool.Exec(ctx, `DELETE FROM local_users WHERE deleted_at < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
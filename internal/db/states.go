@@ -13,9 +13,10 @@ type OAuthState struct {
 	State          string
 	Provider       string
 	ProviderType   string // "oidc" or "saml"
-	Nonce          string
+	Nonce          string // OIDC nonce, or the ID of the SAML AuthnRequest
 	RelayState     string
 	CLICallbackURL string // For CLI login flow
+	CodeVerifier   string // PKCE verifier for OIDC; empty for states saved before PKCE
 	ExpiresAt      time.Time
 	CreatedAt      time.Time
 }
@@ -33,21 +34,23 @@ func NewStateStore(db *DB) *StateStore {
 // SaveState stores an OAuth state
 func (s *StateStore) SaveState(ctx context.Context, state *OAuthState) error {
 	_, err := s.db.Pool.Exec(ctx, `
-		INSERT INTO oauth_states (state, provider, provider_type, nonce, relay_state, cli_callback_url, expires_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
-	`, state.State, state.Provider, state.ProviderType, state.Nonce, state.RelayState, state.CLICallbackURL, state.ExpiresAt)
+		INSERT INTO oauth_states (state, provider, provider_type, nonce, relay_state, cli_callback_url, code_verifier, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`, state.State, state.Provider, state.ProviderType, state.Nonce, state.RelayState, state.CLICallbackURL, state.CodeVerifier, state.ExpiresAt)
 	return err
 }
 
-// GetState retrieves and deletes an OAuth state (one-time use)
-func (s *StateStore) GetState(ctx context.Context, state string) (*OAuthState, error) {
+// GetState retrieves and deletes an OAuth state (one-time use). Only a state
+// saved for providerType is returned, so a state from one login flow can't
+// complete another.
+func (s *StateStore) GetState(ctx context.Context, state, providerType string) (*OAuthState, error) {
 	var st OAuthState
 	var cliCallbackURL *string
 	err := s.db.Pool.QueryRow(ctx, `
 		DELETE FROM oauth_states
-		WHERE state = $1
-		RETURNING state, provider, provider_type, nonce, relay_state, cli_callback_url, expires_at, created_at
-	`, state).Scan(&st.State, &st.Provider, &st.ProviderType, &st.Nonce, &st.RelayState, &cliCallbackURL, &st.ExpiresAt, &st.CreatedAt)
+		WHERE state = $1 AND provider_type = $2
+		RETURNING state, provider, provider_type, nonce, relay_state, cli_callback_url, code_verifier, expires_at, created_at
+	`, state, providerType).Scan(&st.State, &st.Provider, &st.ProviderType, &st.Nonce, &st.RelayState, &cliCallbackURL, &st.CodeVerifier, &st.ExpiresAt, &st.CreatedAt)
 	if err == pgx.ErrNoRows {
 		return nil, ErrSessionNotFound
 	}
@@ -75,26 +78,33 @@ func (s *StateStore) SaveCLICallback(ctx context.Context, state, callbackURL str
 	return err
 }
 
-// GetCLICallback retrieves and deletes a CLI callback URL
+// GetCLICallback retrieves and deletes a CLI callback URL (one-time use)
 func (s *StateStore) GetCLICallback(ctx context.Context, state string) (string, error) {
 	var callbackURL string
+	var expiresAt time.Time
 	err := s.db.Pool.QueryRow(ctx, `
 		DELETE FROM oauth_states
 		WHERE state = $1 AND provider_type = 'cli'
-		RETURNING cli_callback_url
-	`, state).Scan(&callbackURL)
+		RETURNING cli_callback_url, expires_at
+	`, state).Scan(&callbackURL, &expiresAt)
 	if err == pgx.ErrNoRows {
 		return "", ErrSessionNotFound
 	}
 	if err != nil {
 		return "", err
 	}
+	if time.Now().After(expiresAt) {
+		return "", ErrSessionExpired
+	}
 	return callbackURL, nil
 }
 
-// CleanupExpiredStates removes expired states
+// CleanupExpiredStates removes expired states and CLI exchange codes
 func (s *StateStore) CleanupExpiredStates(ctx context.Context) error {
-	_, err := s.db.Pool.Exec(ctx, `DELETE FROM oauth_states WHERE expires_at < NOW()`)
+	if _, err := s.db.Pool.Exec(ctx, `DELETE FROM oauth_states WHERE expires_at < NOW()`); err != nil {
+		return err
+	}
+	_, err := s.db.Pool.Exec(ctx, `DELETE FROM cli_exchange_codes WHERE expires_at < NOW()`)
 	return err
 }
 
@@ -163,6 +173,16 @@ func (s *StateStore) DeleteSSOSession(ctx context.Context, token string) error {
 	return err
 }
 
+// DeleteUserSSOSessions removes every SSO session of a user, signing them out
+// everywhere.
+func (s *StateStore) DeleteUserSSOSessions(ctx context.Context, userID string) (int64, error) {
+	result, err := s.db.Pool.Exec(ctx, `DELETE FROM sso_sessions WHERE user_id = $1`, userID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
 // CleanupExpiredSSOSessions removes expired SSO sessions
 func (s *StateStore) CleanupExpiredSSOSessions(ctx context.Context) error {
 	_, err := s.db.Pool.Exec(ctx, `DELETE FROM sso_sessions WHERE expires_at < NOW()`)
@@ -0,0 +1,144 @@
+package db
+
+import (
+	"context"
+	"time"
+)
+
+// AdminStats is a summary of the deployment for the admin dashboard
+type AdminStats struct {
+	Gateways        GatewayStats    `json:"gateways"`
+	Connections     ConnectionStats `json:"connections"`
+	ConfigsToday    int             `json:"configsToday"`
+	ConfigsThisWeek int             `json:"configsThisWeek"`
+	TopUsers        []UserConnCount `json:"topUsers"`
+	Logins          LoginStats      `json:"logins"`
+	GeneratedAt     time.Time       `json:"generatedAt"`
+}
+
+// GatewayStats counts gateways. Online gateways have sent a heartbeat within the
+// online threshold.
+type GatewayStats struct {
+	Total  int `json:"total"`
+	Active int `json:"active"`
+	Online int `json:"online"`
+}
+
+// ConnectionStats counts recorded VPN connections
+type ConnectionStats struct {
+	Total  int `json:"total"`
+	Active int `json:"active"`
+}
+
+// UserConnCount is a user's number of connections over the stats window
+type UserConnCount struct {
+	UserID      string `json:"userId"`
+	Email       string `json:"email"`
+	Connections int    `json:"connections"`
+}
+
+// LoginStats counts logins over the stats window
+type LoginStats struct {
+	Total       int     `json:"total"`
+	Successful  int     `json:"successful"`
+	Failed      int     `json:"failed"`
+	SuccessRate float64 `json:"successRate"` // 0 to 1; 0 when there were no logins
+}
+
+// StatsStore computes dashboard statistics with aggregate queries
+type StatsStore struct {
+	db *DB
+}
+
+// NewStatsStore creates a new stats store
+func NewStatsStore(db *DB) *StatsStore {
+	return &StatsStore{db: db}
+}
+
+// AdminStats summarizes gateways, connections, configs and logins. Top users and
+// login counts cover the given window; gateways heartbeating within onlineWithin
+// count as online. Queries are scoped to the tenant in ctx, if any.
+func (s *StatsStore) AdminStats(ctx context.Context, window, onlineWithin time.Duration, topUsers int) (*AdminStats, error) {
+	now := time.Now()
+	stats := &AdminStats{GeneratedAt: now, TopUsers: []UserConnCount{}}
+
+	tenant, args := tenantClause(ctx, "tenant_id", []interface{}{now.Add(-onlineWithin)})
+	err := s.db.Pool.QueryRow(ctx, `
+		SELECT
+			COUNT(*),
+			COUNT(*) FILTER (WHERE is_active),
+			COUNT(*) FILTER (WHERE is_active AND last_heartbeat >= $1)
+		FROM gateways
+		WHERE deleted_at IS NULL AND `+tenant,
+		args...).Scan(&stats.Gateways.Total, &stats.Gateways.Active, &stats.Gateways.Online)
+	if err != nil {
+		return nil, err
+	}
+
+	tenant, args = tenantClause(ctx, "g.tenant_id", nil)
+	err = s.db.Pool.QueryRow(ctx, `
+		SELECT COUNT(*), COUNT(*) FILTER (WHERE c.disconnected_at IS NULL)
+		FROM connections c
+		JOIN gateways g ON g.id = c.gateway_id
+		WHERE `+tenant,
+		args...).Scan(&stats.Connections.Total, &stats.Connections.Active)
+	if err != nil {
+		return nil, err
+	}
+
+	startOfDay := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	tenant, args = tenantClause(ctx, "g.tenant_id", []interface{}{startOfDay, now.AddDate(0, 0, -7)})
+	err = s.db.Pool.QueryRow(ctx, `
+		SELECT
+			COUNT(*) FILTER (WHERE gc.created_at >= $1),
+			COUNT(*)
+		FROM generated_configs gc
+		JOIN gateways g ON g.id = gc.gateway_id
+		WHERE gc.created_at >= $2 AND `+tenant,
+		args...).Scan(&stats.ConfigsToday, &stats.ConfigsThisWeek)
+	if err != nil {
+		return nil, err
+	}
+
+	since := now.Add(-window)
+	tenant, args = tenantClause(ctx, "g.tenant_id", []interface{}{since, topUsers})
+	rows, err := s.db.Pool.Query(ctx, `
+		SELECT c.user_id::text, COALESCE(u.email, ''), COUNT(*)
+		FROM connections c
+		JOIN gateways g ON g.id = c.gateway_id
+		LEFT JOIN users u ON u.id = c.user_id
+		WHERE c.connected_at >= $1 AND c.user_id IS NOT NULL AND `+tenant+`
+		GROUP BY c.user_id, u.email
+		ORDER BY COUNT(*) DESC, u.email
+		LIMIT $2
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var u UserConnCount
+		if err := rows.Scan(&u.UserID, &u.Email, &u.Connections); err != nil {
+			return nil, err
+		}
+		stats.TopUsers = append(stats.TopUsers, u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	loginTenant, loginArgs := tenantClause(ctx, "tenant_id", []interface{}{since})
+	err = s.db.Pool.QueryRow(ctx, `
+		SELECT COUNT(*), COUNT(*) FILTER (WHERE success), COUNT(*) FILTER (WHERE NOT success)
+		FROM login_logs
+		WHERE created_at >= $1 AND `+loginTenant,
+		loginArgs...).Scan(&stats.Logins.Total, &stats.Logins.Successful, &stats.Logins.Failed)
+	if err != nil {
+		return nil, err
+	}
+	if stats.Logins.Total > 0 {
+		stats.Logins.SuccessRate = float64(stats.Logins.Successful) / float64(stats.Logins.Total)
+	}
+
+	return stats, nil
+}
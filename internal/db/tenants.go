@@ -0,0 +1,216 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// DefaultTenantID is the tenant that existing data, and everything in a
+// deployment without tenancy enabled, belongs to.
+const DefaultTenantID = "00000000-0000-0000-0000-000000000001"
+
+var (
+	ErrTenantNotFound = errors.New("tenant not found")
+	ErrTenantExists   = errors.New("tenant already exists")
+	ErrTenantInUse    = errors.New("tenant still has gateways, networks, rules, providers or users")
+)
+
+// Tenant is an isolated organization sharing the control plane
+type Tenant struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Slug      string    `json:"slug"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type tenantContextKey struct{}
+
+// WithTenant returns a context that scopes store queries to a tenant. Store
+// methods called with a context that carries no tenant see every tenant, which is
+// how single-tenant deployments and background jobs run.
+func WithTenant(ctx context.Context, tenantID string) context.Context {
+	return context.WithValue(ctx, tenantContextKey{}, tenantID)
+}
+
+// TenantFromContext returns the tenant a context is scoped to, if any.
+func TenantFromContext(ctx context.Context) (string, bool) {
+	tenantID, ok := ctx.Value(tenantContextKey{}).(string)
+	return tenantID, ok && tenantID != ""
+}
+
+// tenantForInsert returns the tenant new rows created with ctx belong to.
+func tenantForInsert(ctx context.Context) string {
+	if tenantID, ok := TenantFromContext(ctx); ok {
+		return tenantID
+	}
+	return DefaultTenantID
+}
+
+// tenantClause returns a condition restricting column to the tenant ctx is scoped
+// to, numbering its placeholder after args and appending the tenant to them. It
+// returns "TRUE" and args unchanged when ctx isn't scoped.
+func tenantClause(ctx context.Context, column string, args []interface{}) (string, []interface{}) {
+	tenantID, ok := TenantFromContext(ctx)
+	if !ok {
+		return "TRUE", args
+	}
+	args = append(args, tenantID)
+	return fmt.Sprintf("%s = $%d", column, len(args)), args
+}
+
+// TenantStore handles tenant persistence
+type TenantStore struct {
+	db *DB
+}
+
+// NewTenantStore creates a new tenant store
+func NewTenantStore(db *DB) *TenantStore {
+	return &TenantStore{db: db}
+}
+
+// ListTenants returns all tenants
+func (s *TenantStore) ListTenants(ctx context.Context) ([]*Tenant, error) {
+	rows, err := s.db.Pool.Query(ctx, `SELECT id, name, slug, created_at FROM tenants ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tenants []*Tenant
+	for rows.Next() {
+		var t Tenant
+		if err := rows.Scan(&t.ID, &t.Name, &t.Slug, &t.CreatedAt); err != nil {
+			return nil, err
+		}
+		tenants = append(tenants, &t)
+	}
+	return tenants, rows.Err()
+}
+
+// GetTenant returns a tenant by ID or slug
+func (s *TenantStore) GetTenant(ctx context.Context, idOrSlug string) (*Tenant, error) {
+	var t Tenant
+	err := s.db.Pool.QueryRow(ctx, `
+		SELECT id, name, slug, created_at FROM tenants
+		WHERE id::text = $1 OR slug = $1
+	`, idOrSlug).Scan(&t.ID, &t.Name, &t.Slug, &t.CreatedAt)
+	if err == pgx.ErrNoRows {
+		return nil, ErrTenantNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// CreateTenant creates a tenant
+func (s *TenantStore) CreateTenant(ctx context.Context, t *Tenant) error {
+	err := s.db.Pool.QueryRow(ctx, `
+		INSERT INTO tenants (name, slug) VALUES ($1, $2)
+		RETURNING id, created_at
+	`, t.Name, t.Slug).Scan(&t.ID, &t.CreatedAt)
+	if err != nil && strings.Contains(err.Error(), "duplicate key") {
+		return ErrTenantExists
+	}
+	return err
+}
+
+// DeleteTenant deletes a tenant that no longer owns anything. The default tenant
+// can't be deleted.
+func (s *TenantStore) DeleteTenant(ctx context.Context, id string) error {
+	if id == DefaultTenantID {
+		return errors.New("the default tenant can't be deleted")
+	}
+	result, err := s.db.Pool.Exec(ctx, `DELETE FROM tenants WHERE id = $1`, id)
+	if err != nil {
+		if strings.Contains(err.Error(), "foreign key") {
+			return ErrTenantInUse
+		}
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return ErrTenantNotFound
+	}
+	return nil
+}
+
+// UserTenant returns the tenant an SSO or local user belongs to.
+func (s *TenantStore) UserTenant(ctx context.Context, userID string) (string, error) {
+	var tenantID string
+	err := s.db.Pool.QueryRow(ctx, `
+		SELECT tenant_id FROM users WHERE id::text = $1
+		UNION ALL
+		SELECT tenant_id FROM local_users WHERE id::text = $1
+		LIMIT 1
+	`, userID).Scan(&tenantID)
+	if err == pgx.ErrNoRows {
+		return "", ErrUserNotFound
+	}
+	return tenantID, err
+}
+
+// SetLocalUserTenant moves a local user to a tenant.
+func (s *TenantStore) SetLocalUserTenant(ctx context.Context, userID, tenantID string) error {
+	result, err := s.db.Pool.Exec(ctx, `
+		UPDATE local_users SET tenant_id = $2 WHERE id = $1 AND deleted_at IS NULL
+	`, userID, tenantID)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// inTenant reports whether the row with the given ID in table belongs to the
+// tenant ctx is scoped to. It's for statements on join tables such as
+// user_gateways, which have no tenant of their own. Always true when ctx isn't
+// scoped.
+func (db *DB) inTenant(ctx context.Context, table, id string) (bool, error) {
+	tenantID, ok := TenantFromContext(ctx)
+	if !ok {
+		return true, nil
+	}
+	var exists bool
+	err := db.Pool.QueryRow(ctx, `SELECT EXISTS(SELECT 1 FROM `+table+` WHERE id::text = $1 AND tenant_id = $2)`, id, tenantID).Scan(&exists)
+	return exists, err
+}
+
+// notFoundOr returns err if it's set, or notFound for a row outside the tenant.
+func notFoundOr(err, notFound error) error {
+	if err != nil {
+		return err
+	}
+	return notFound
+}
+
+// userTenantSQL is an expression for the tenant of the SSO or local user whose ID
+// is in the given placeholder. Users that aren't stored belong to the default
+// tenant. Rule and gateway access checks compare against it unconditionally, so
+// a group name shared by two tenants never grants access across them.
+func userTenantSQL(param string) string {
+	return `COALESCE(
+			(SELECT tenant_id FROM users WHERE id::text = ` + param + `::text),
+			(SELECT tenant_id FROM local_users WHERE id::text = ` + param + `::text),
+			'` + DefaultTenantID + `'::uuid)`
+}
+
+// providerTenantSQL is an expression for the tenant of the provider whose type
+// ("oidc", "saml" or "ldap") and name are in the given placeholders, or the
+// default tenant. Only the table for that type is searched, so a same-named
+// provider of another type can't claim the login.
+func providerTenantSQL(typeParam, nameParam string) string {
+	return `COALESCE(
+			CASE ` + typeParam + `::text
+				WHEN 'oidc' THEN (SELECT tenant_id FROM oidc_providers WHERE name = ` + nameParam + `)
+				WHEN 'saml' THEN (SELECT tenant_id FROM saml_providers WHERE name = ` + nameParam + `)
+				WHEN 'ldap' THEN (SELECT tenant_id FROM ldap_providers WHERE name = ` + nameParam + `)
+			END,
+			'` + DefaultTenantID + `'::uuid)`
+}
@@ -0,0 +1,66 @@
+package db
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestTenantClause(t *testing.T) {
+	ctx := context.Background()
+
+	clause, args := tenantClause(ctx, "tenant_id", []interface{}{"gw-1"})
+	if clause != "TRUE" || len(args) != 1 {
+		t.Fatalf("unscoped: got %q %v", clause, args)
+	}
+	if got := tenantForInsert(ctx); got != DefaultTenantID {
+		t.Fatalf("unscoped insert tenant = %q, want default", got)
+	}
+
+	ctx = WithTenant(ctx, "tenant-a")
+	clause, args = tenantClause(ctx, "g.tenant_id", []interface{}{"gw-1", "eng"})
+	if clause != "g.tenant_id = $3" || len(args) != 3 || args[2] != "tenant-a" {
+		t.Fatalf("scoped: got %q %v", clause, args)
+	}
+	if got := tenantForInsert(ctx); got != "tenant-a" {
+		t.Fatalf("scoped insert tenant = %q, want tenant-a", got)
+	}
+
+	if _, ok := TenantFromContext(WithTenant(context.Background(), "")); ok {
+		t.Fatal("empty tenant should leave the context unscoped")
+	}
+}
+
+func TestLogConditionsTenant(t *testing.T) {
+	success := true
+	ctx := WithTenant(context.Background(), "tenant-a")
+
+	where, args := loginLogConditions(ctx, &LoginLogFilter{UserID: "u-1", Success: &success})
+	if !strings.HasSuffix(where, " AND tenant_id = $3") || len(args) != 3 || args[2] != "tenant-a" {
+		t.Errorf("login logs: got %q %v", where, args)
+	}
+
+	where, args = connectionConditions(ctx, &ConnectionFilter{GatewayID: "gw-1"})
+	if !strings.HasSuffix(where, " AND (SELECT tenant_id FROM gateways WHERE id = c.gateway_id) = $2") || len(args) != 2 {
+		t.Errorf("connections: got %q %v", where, args)
+	}
+
+	where, args = loginLogConditions(context.Background(), &LoginLogFilter{UserID: "u-1"})
+	if !strings.HasSuffix(where, " AND TRUE") || len(args) != 1 {
+		t.Errorf("unscoped login logs: got %q %v", where, args)
+	}
+}
+
+func TestProviderTenantSQL(t *testing.T) {
+	sql := providerTenantSQL("$4", "$5")
+	for _, want := range []string{
+		"CASE $4::text",
+		"WHEN 'oidc' THEN (SELECT tenant_id FROM oidc_providers WHERE name = $5)",
+		"WHEN 'saml' THEN (SELECT tenant_id FROM saml_providers WHERE name = $5)",
+		"WHEN 'ldap' THEN (SELECT tenant_id FROM ldap_providers WHERE name = $5)",
+	} {
+		if !strings.Contains(sql, want) {
+			t.Errorf("providerTenantSQL missing %q:\n%s", want, sql)
+		}
+	}
+}
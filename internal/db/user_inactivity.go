@@ -0,0 +1,166 @@
+package db
+
+import (
+	"context"
+	"time"
+)
+
+// Settings for deactivating users who haven't been active for a while
+const (
+	SettingUserInactivityDays        = "user_inactivity_days"         // 0 turns deactivation off
+	SettingUserInactivityWarningDays = "user_inactivity_warning_days" // Warning sent this many days before; 0 sends none
+	SettingUserInactivityReactivate  = "user_inactivity_reactivation" // "auto" or "approval"
+)
+
+// Ways a user deactivated for inactivity gets access back
+const (
+	ReactivationAuto     = "auto"     // Their next successful SSO login
+	ReactivationApproval = "approval" // An admin reactivates them
+)
+
+// DeactivationReasonInactivity marks users deactivated for inactivity, the only
+// ones a login can reactivate.
+const DeactivationReasonInactivity = "inactivity"
+
+// Kinds of inactive user
+const (
+	InactiveUserSSO   = "sso"
+	InactiveUserLocal = "local"
+)
+
+// Last activity of an SSO or local user. Being reactivated counts, so a user an
+// admin brings back has the full period to use their account again.
+const (
+	ssoUserActivitySQL   = "GREATEST(created_at, last_login_at, last_vpn_auth_at, reactivated_at)"
+	localUserActivitySQL = "GREATEST(created_at, last_login_at, reactivated_at)"
+)
+
+// InactiveUser is an active SSO or local user who hasn't logged in or, for SSO
+// users, connected to a gateway recently.
+type InactiveUser struct {
+	Kind         string
+	ID           string
+	Username     string // Local users only
+	Email        string
+	Name         string
+	LastActiveAt time.Time
+	WarnedAt     *time.Time // When they were warned, if it was since they were last active
+}
+
+// ListInactiveUsers returns active users across all tenants who haven't been
+// active since cutoff, least recently active first.
+func (s *UserStore) ListInactiveUsers(ctx context.Context, cutoff time.Time) ([]*InactiveUser, error) {
+	rows, err := s.db.Pool.Query(ctx, `
+		SELECT kind, id, username, email, name, activity,
+			CASE WHEN inactivity_warned_at >= activity THEN inactivity_warned_at END
+		FROM (
+			SELECT 'sso' AS kind, id::text, '' AS username, email, name, inactivity_warned_at,
+				`+ssoUserActivitySQL+` AS activity
+			FROM users WHERE is_active
+			UNION ALL
+			SELECT 'local', id::text, username, email, username, inactivity_warned_at,
+				`+localUserActivitySQL+`
+			FROM local_users WHERE deleted_at IS NULL AND deactivated_at IS NULL
+		) u
+		WHERE activity < $1
+		ORDER BY activity, email
+	`, cutoff)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []*InactiveUser
+	for rows.Next() {
+		var u InactiveUser
+		if err := rows.Scan(&u.Kind, &u.ID, &u.Username, &u.Email, &u.Name, &u.LastActiveAt, &u.WarnedAt); err != nil {
+			return nil, err
+		}
+		users = append(users, &u)
+	}
+	return users, rows.Err()
+}
+
+// MarkInactivityWarned records that a user was warned about deactivation. It
+// returns false if they were already warned since they were last active, so
+// each warning is only sent by one server.
+func (s *UserStore) MarkInactivityWarned(ctx context.Context, kind, id string) (bool, error) {
+	table, activity := "users", ssoUserActivitySQL
+	if kind == InactiveUserLocal {
+		table, activity = "local_users", localUserActivitySQL
+	}
+	result, err := s.db.Pool.Exec(ctx, `
+		UPDATE `+table+` SET inactivity_warned_at = NOW()
+		WHERE id = $1 AND (inactivity_warned_at IS NULL OR inactivity_warned_at < `+activity+`)
+	`, id)
+	if err != nil {
+		return false, err
+	}
+	return result.RowsAffected() > 0, nil
+}
+
+// DeactivateInactiveUser deactivates a user who still hasn't been active since
+// cutoff. It returns false if they were active in the meantime or are already
+// deactivated.
+func (s *UserStore) DeactivateInactiveUser(ctx context.Context, kind, id string, cutoff time.Time) (bool, error) {
+	query := `
+		UPDATE users SET is_active = false, deactivated_at = NOW(), deactivation_reason = $3, updated_at = NOW()
+		WHERE id = $1 AND is_active AND ` + ssoUserActivitySQL + ` < $2`
+	args := []interface{}{id, cutoff, DeactivationReasonInactivity}
+	if kind == InactiveUserLocal {
+		query = `
+			UPDATE local_users SET deactivated_at = NOW()
+			WHERE id = $1 AND deleted_at IS NULL AND deactivated_at IS NULL AND ` + localUserActivitySQL + ` < $2`
+		args = args[:2]
+	}
+	result, err := s.db.Pool.Exec(ctx, query, args...)
+	if err != nil {
+		return false, err
+	}
+	return result.RowsAffected() > 0, nil
+}
+
+// ReactivateInactiveUser reactivates an SSO user deactivated for inactivity. It
+// returns false if they weren't, including if an admin deactivated them.
+func (s *UserStore) ReactivateInactiveUser(ctx context.Context, id string) (bool, error) {
+	result, err := s.db.Pool.Exec(ctx, `
+		UPDATE users SET is_active = true, deactivated_at = NULL, deactivation_reason = NULL,
+			reactivated_at = NOW(), updated_at = NOW()
+		WHERE id = $1 AND NOT is_active AND deactivation_reason = $2
+	`, id, DeactivationReasonInactivity)
+	if err != nil {
+		return false, err
+	}
+	return result.RowsAffected() > 0, nil
+}
+
+// ReactivateUser reactivates a deactivated SSO user.
+func (s *UserStore) ReactivateUser(ctx context.Context, id string) error {
+	tenant, args := tenantClause(ctx, "tenant_id", []interface{}{id})
+	result, err := s.db.Pool.Exec(ctx, `
+		UPDATE users SET is_active = true, deactivated_at = NULL, deactivation_reason = NULL,
+			reactivated_at = NOW(), updated_at = NOW()
+		WHERE id = $1 AND `+tenant, args...)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// ReactivateLocalUser reactivates a deactivated local user.
+func (s *UserStore) ReactivateLocalUser(ctx context.Context, id string) error {
+	tenant, args := tenantClause(ctx, "tenant_id", []interface{}{id})
+	result, err := s.db.Pool.Exec(ctx, `
+		UPDATE local_users SET deactivated_at = NULL, reactivated_at = NOW()
+		WHERE id = $1 AND deleted_at IS NULL AND `+tenant, args...)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
@@ -22,6 +22,7 @@ var (
 	ErrInvalidCredentials = errors.New("invalid credentials")
 	ErrSessionNotFound    = errors.New("session not found")
 	ErrSessionExpired     = errors.New("session expired")
+	ErrUserDeactivated    = errors.New("user is deactivated")
 )
 
 // SSOUser represents a user synced from an identity provider (OIDC/SAML)
@@ -37,6 +38,18 @@ type SSOUser struct {
 	LastLoginAt *time.Time `json:"last_login_at,omitempty"`
 	CreatedAt   time.Time  `json:"created_at"`
 	UpdatedAt   time.Time  `json:"updated_at"`
+	// CommonName is the identifier put in VPN certificates when the user's
+	// provider takes it from somewhere other than the email; empty means email
+	CommonName string `json:"common_name,omitempty"`
+}
+
+// VPNCommonName returns the identifier used as the common name and auth-user-pass
+// username in the user's VPN configs, which gateways use to look the user up.
+func (u *SSOUser) VPNCommonName() string {
+	if u.CommonName != "" {
+		return u.CommonName
+	}
+	return u.Email
 }
 
 // LocalUser represents a local admin user
@@ -48,6 +61,8 @@ type LocalUser struct {
 	IsAdmin      bool       `json:"is_admin"`
 	LastLoginAt  *time.Time `json:"last_login_at,omitempty"`
 	CreatedAt    time.Time  `json:"created_at"`
+	// DeactivatedAt is set while the user is deactivated for inactivity
+	DeactivatedAt *time.Time `json:"deactivated_at,omitempty"`
 }
 
 // AdminSession represents an admin session
@@ -83,7 +98,7 @@ func NewUserStore(db *DB) *UserStore {
 // HasUsers returns true if any local users exist
 func (s *UserStore) HasUsers(ctx context.Context) (bool, error) {
 	var count int
-	err := s.db.Pool.QueryRow(ctx, `SELECT COUNT(*) FROM local_users`).Scan(&count)
+	err := s.db.Pool.QueryRow(ctx, `SELECT COUNT(*) FROM local_users WHERE deleted_at IS NULL`).Scan(&count)
 	if err != nil {
 		return false, err
 	}
@@ -98,9 +113,9 @@ func (s *UserStore) CreateUser(ctx context.Context, username, password, email st
 	}
 
 	_, err = s.db.Pool.Exec(ctx, `
-		INSERT INTO local_users (username, password_hash, email, is_admin)
-		VALUES ($1, $2, $3, $4)
-	`, username, hash, email, isAdmin)
+		INSERT INTO local_users (username, password_hash, email, is_admin, tenant_id)
+		VALUES ($1, $2, $3, $4, $5)
+	`, username, hash, email, isAdmin, tenantForInsert(ctx))
 	if err != nil && strings.Contains(err.Error(), "duplicate key") {
 		return ErrUserExists
 	}
@@ -111,9 +126,9 @@ func (s *UserStore) CreateUser(ctx context.Context, username, password, email st
 func (s *UserStore) GetUser(ctx context.Context, username string) (*LocalUser, error) {
 	var u LocalUser
 	err := s.db.Pool.QueryRow(ctx, `
-		SELECT id, username, password_hash, email, is_admin, last_login_at, created_at
-		FROM local_users WHERE username = $1
-	`, username).Scan(&u.ID, &u.Username, &u.PasswordHash, &u.Email, &u.IsAdmin, &u.LastLoginAt, &u.CreatedAt)
+		SELECT id, username, password_hash, email, is_admin, last_login_at, created_at, deactivated_at
+		FROM local_users WHERE username = $1 AND deleted_at IS NULL
+	`, username).Scan(&u.ID, &u.Username, &u.PasswordHash, &u.Email, &u.IsAdmin, &u.LastLoginAt, &u.CreatedAt, &u.DeactivatedAt)
 	if err == pgx.ErrNoRows {
 		return nil, ErrUserNotFound
 	}
@@ -123,13 +138,13 @@ func (s *UserStore) GetUser(ctx context.Context, username string) (*LocalUser, e
 	return &u, nil
 }
 
-// GetUserByID retrieves a local user by ID
+// GetUserByID retrieves a local user by ID, within the tenant in ctx if any
 func (s *UserStore) GetUserByID(ctx context.Context, id string) (*LocalUser, error) {
 	var user LocalUser
+	tenant, args := tenantClause(ctx, "tenant_id", []interface{}{id})
 	err := s.db.Pool.QueryRow(ctx, `
 		SELECT id, username, password_hash, email, is_admin, last_login_at, created_at
-		FROM local_users WHERE id = $1
-	`, id).Scan(&user.ID, &user.Username, &user.PasswordHash, &user.Email, &user.IsAdmin, &user.LastLoginAt, &user.CreatedAt)
+		FROM local_users WHERE id = $1 AND deleted_at IS NULL AND `+tenant, args...).Scan(&user.ID, &user.Username, &user.PasswordHash, &user.Email, &user.IsAdmin, &user.LastLoginAt, &user.CreatedAt)
 	if err == pgx.ErrNoRows {
 		return nil, ErrUserNotFound
 	}
@@ -139,16 +154,19 @@ func (s *UserStore) GetUserByID(ctx context.Context, id string) (*LocalUser, err
 	return &user, nil
 }
 
-// DeleteLocalUser deletes a local user by ID
+// DeleteLocalUser soft-deletes a local user by ID and ends their sessions
 func (s *UserStore) DeleteLocalUser(ctx context.Context, id string) error {
-	result, err := s.db.Pool.Exec(ctx, `DELETE FROM local_users WHERE id = $1`, id)
+	tenant, args := tenantClause(ctx, "tenant_id", []interface{}{id})
+	result, err := s.db.Pool.Exec(ctx, `
+		UPDATE local_users SET deleted_at = NOW() WHERE id = $1 AND deleted_at IS NULL AND `+tenant, args...)
 	if err != nil {
 		return err
 	}
 	if result.RowsAffected() == 0 {
 		return ErrUserNotFound
 	}
-	return nil
+	_, err = s.db.Pool.Exec(ctx, `DELETE FROM admin_sessions WHERE user_id = $1`, id)
+	return err
 }
 
 // Authenticate validates username and password
@@ -166,6 +184,9 @@ func (s *UserStore) Authenticate(ctx context.Context, username, password string)
 	if !s.verifyPassword(password, user.PasswordHash) {
 		return nil, ErrInvalidCredentials
 	}
+	if user.DeactivatedAt != nil {
+		return nil, ErrUserDeactivated
+	}
 
 	// Update last login (best effort, don't fail auth if this fails)
 	_, _ = s.db.Pool.Exec(ctx, `UPDATE local_users SET last_login_at = NOW() WHERE id = $1`, user.ID)
@@ -181,7 +202,7 @@ func (s *UserStore) UpdatePassword(ctx context.Context, username, newPassword st
 	}
 
 	result, err := s.db.Pool.Exec(ctx, `
-		UPDATE local_users SET password_hash = $2 WHERE username = $1
+		UPDATE local_users SET password_hash = $2 WHERE username = $1 AND deleted_at IS NULL
 	`, username, hash)
 	if err != nil {
 		return err
@@ -241,7 +262,7 @@ func (s *UserStore) GetSession(ctx context.Context, token string) (*AdminSession
 		       u.id, u.username, u.email, u.is_admin, u.last_login_at, u.created_at
 		FROM admin_sessions s
 		JOIN local_users u ON s.user_id = u.id
-		WHERE s.token = $1
+		WHERE s.token = $1 AND u.deleted_at IS NULL AND u.deactivated_at IS NULL
 	`, token).Scan(
 		&session.ID, &session.UserID, &session.Token, &session.ExpiresAt, &session.CreatedAt,
 		&user.ID, &user.Username, &user.Email, &user.IsAdmin, &user.LastLoginAt, &user.CreatedAt,
@@ -268,6 +289,15 @@ func (s *UserStore) DeleteSession(ctx context.Context, token string) error {
 	return err
 }
 
+// DeleteUserSessions removes every session of a local user.
+func (s *UserStore) DeleteUserSessions(ctx context.Context, userID string) (int64, error) {
+	result, err := s.db.Pool.Exec(ctx, `DELETE FROM admin_sessions WHERE user_id = $1`, userID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
 // CleanupExpiredSessions removes all expired sessions
 func (s *UserStore) CleanupExpiredSessions(ctx context.Context) error {
 	_, err := s.db.Pool.Exec(ctx, `DELETE FROM admin_sessions WHERE expires_at < NOW()`)
@@ -330,11 +360,13 @@ func (s *UserStore) verifyPassword(password, encodedHash string) bool {
 
 // ListSSOUsers returns all SSO users
 func (s *UserStore) ListSSOUsers(ctx context.Context) ([]*SSOUser, error) {
+	tenant, args := tenantClause(ctx, "tenant_id", nil)
 	rows, err := s.db.Pool.Query(ctx, `
-		SELECT id, external_id, provider, email, name, groups, is_admin, is_active, last_login_at, created_at, updated_at
+		SELECT id, external_id, provider, email, name, groups, is_admin, is_active, last_login_at, created_at, updated_at, COALESCE(common_name, '')
 		FROM users
+		WHERE `+tenant+`
 		ORDER BY email
-	`)
+	`, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -345,7 +377,7 @@ func (s *UserStore) ListSSOUsers(ctx context.Context) ([]*SSOUser, error) {
 		var u SSOUser
 		var groupsJSON []byte
 		if err := rows.Scan(&u.ID, &u.ExternalID, &u.Provider, &u.Email, &u.Name,
-			&groupsJSON, &u.IsAdmin, &u.IsActive, &u.LastLoginAt, &u.CreatedAt, &u.UpdatedAt); err != nil {
+			&groupsJSON, &u.IsAdmin, &u.IsActive, &u.LastLoginAt, &u.CreatedAt, &u.UpdatedAt, &u.CommonName); err != nil {
 			return nil, err
 		}
 		if len(groupsJSON) > 0 {
@@ -356,15 +388,74 @@ func (s *UserStore) ListSSOUsers(ctx context.Context) ([]*SSOUser, error) {
 	return users, rows.Err()
 }
 
-// GetSSOUser returns an SSO user by ID
+// DormantUser is an active SSO user who hasn't passed gateway verification recently.
+type DormantUser struct {
+	ID            string
+	Email         string
+	Name          string
+	Groups        []string
+	LastLoginAt   *time.Time
+	LastVPNAuthAt *time.Time // nil if the user never connected
+	CreatedAt     time.Time
+}
+
+// RecordVPNAuth records that a user passed gateway verification.
+func (s *UserStore) RecordVPNAuth(ctx context.Context, userID string) error {
+	_, err := s.db.Pool.Exec(ctx, `
+		UPDATE users SET last_vpn_auth_at = NOW()
+		WHERE id = $1 AND (last_vpn_auth_at IS NULL OR last_vpn_auth_at < NOW() - INTERVAL '`+usageWriteInterval+`')
+	`, userID)
+	return err
+}
+
+// ListDormantUsers returns active SSO users created before cutoff who haven't
+// passed gateway verification since, least recently used first.
+func (s *UserStore) ListDormantUsers(ctx context.Context, cutoff time.Time) ([]*DormantUser, error) {
+	tenant, args := tenantClause(ctx, "tenant_id", []interface{}{cutoff})
+	rows, err := s.db.Pool.Query(ctx, `
+		SELECT id, email, name, groups, last_login_at, last_vpn_auth_at, created_at
+		FROM users
+		WHERE is_active AND created_at < $1 AND (last_vpn_auth_at IS NULL OR last_vpn_auth_at < $1) AND `+tenant+`
+		ORDER BY last_vpn_auth_at NULLS FIRST, email
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []*DormantUser
+	for rows.Next() {
+		var u DormantUser
+		var groupsJSON []byte
+		if err := rows.Scan(&u.ID, &u.Email, &u.Name, &groupsJSON, &u.LastLoginAt, &u.LastVPNAuthAt, &u.CreatedAt); err != nil {
+			return nil, err
+		}
+		if len(groupsJSON) > 0 {
+			json.Unmarshal(groupsJSON, &u.Groups)
+		}
+		users = append(users, &u)
+	}
+	return users, rows.Err()
+}
+
+// CountSSOAdmins returns how many active SSO users are admins, across all tenants.
+func (s *UserStore) CountSSOAdmins(ctx context.Context) (int, error) {
+	var count int
+	err := s.db.Pool.QueryRow(ctx, `
+		SELECT COUNT(*) FROM users WHERE is_admin AND is_active
+	`).Scan(&count)
+	return count, err
+}
+
+// GetSSOUser returns an SSO user by ID, within the tenant in ctx if any
 func (s *UserStore) GetSSOUser(ctx context.Context, id string) (*SSOUser, error) {
 	var u SSOUser
 	var groupsJSON []byte
+	tenant, args := tenantClause(ctx, "tenant_id", []interface{}{id})
 	err := s.db.Pool.QueryRow(ctx, `
-		SELECT id, external_id, provider, email, name, groups, is_admin, is_active, last_login_at, created_at, updated_at
-		FROM users WHERE id = $1
-	`, id).Scan(&u.ID, &u.ExternalID, &u.Provider, &u.Email, &u.Name,
-		&groupsJSON, &u.IsAdmin, &u.IsActive, &u.LastLoginAt, &u.CreatedAt, &u.UpdatedAt)
+		SELECT id, external_id, provider, email, name, groups, is_admin, is_active, last_login_at, created_at, updated_at, COALESCE(common_name, '')
+		FROM users WHERE id = $1 AND `+tenant, args...).Scan(&u.ID, &u.ExternalID, &u.Provider, &u.Email, &u.Name,
+		&groupsJSON, &u.IsAdmin, &u.IsActive, &u.LastLoginAt, &u.CreatedAt, &u.UpdatedAt, &u.CommonName)
 	if err == pgx.ErrNoRows {
 		return nil, ErrUserNotFound
 	}
@@ -377,15 +468,15 @@ func (s *UserStore) GetSSOUser(ctx context.Context, id string) (*SSOUser, error)
 	return &u, nil
 }
 
-// GetSSOUserByEmail returns an SSO user by email
+// GetSSOUserByEmail returns an SSO user by email, within the tenant in ctx if any
 func (s *UserStore) GetSSOUserByEmail(ctx context.Context, email string) (*SSOUser, error) {
 	var u SSOUser
 	var groupsJSON []byte
+	tenant, args := tenantClause(ctx, "tenant_id", []interface{}{email})
 	err := s.db.Pool.QueryRow(ctx, `
-		SELECT id, external_id, provider, email, name, groups, is_admin, is_active, last_login_at, created_at, updated_at
-		FROM users WHERE email = $1
-	`, email).Scan(&u.ID, &u.ExternalID, &u.Provider, &u.Email, &u.Name,
-		&groupsJSON, &u.IsAdmin, &u.IsActive, &u.LastLoginAt, &u.CreatedAt, &u.UpdatedAt)
+		SELECT id, external_id, provider, email, name, groups, is_admin, is_active, last_login_at, created_at, updated_at, COALESCE(common_name, '')
+		FROM users WHERE email = $1 AND `+tenant, args...).Scan(&u.ID, &u.ExternalID, &u.Provider, &u.Email, &u.Name,
+		&groupsJSON, &u.IsAdmin, &u.IsActive, &u.LastLoginAt, &u.CreatedAt, &u.UpdatedAt, &u.CommonName)
 	if err == pgx.ErrNoRows {
 		return nil, ErrUserNotFound
 	}
@@ -398,13 +489,67 @@ func (s *UserStore) GetSSOUserByEmail(ctx context.Context, email string) (*SSOUs
 	return &u, nil
 }
 
+// GetSSOUserByCommonName returns the SSO user a VPN certificate common name
+// identifies. Users whose provider sets a common name are matched on it first;
+// otherwise, and for configs issued before the provider changed, the common name
+// is the email.
+func (s *UserStore) GetSSOUserByCommonName(ctx context.Context, commonName string) (*SSOUser, error) {
+	var u SSOUser
+	var groupsJSON []byte
+	tenant, args := tenantClause(ctx, "tenant_id", []interface{}{commonName})
+	err := s.db.Pool.QueryRow(ctx, `
+		SELECT id, external_id, provider, email, name, groups, is_admin, is_active, last_login_at, created_at, updated_at, COALESCE(common_name, '')
+		FROM users WHERE (common_name = $1 OR email = $1) AND `+tenant+`
+		ORDER BY common_name = $1 DESC NULLS LAST
+		LIMIT 1
+	`, args...).Scan(&u.ID, &u.ExternalID, &u.Provider, &u.Email, &u.Name,
+		&groupsJSON, &u.IsAdmin, &u.IsActive, &u.LastLoginAt, &u.CreatedAt, &u.UpdatedAt, &u.CommonName)
+	if err == pgx.ErrNoRows {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(groupsJSON) > 0 {
+		json.Unmarshal(groupsJSON, &u.Groups)
+	}
+	return &u, nil
+}
+
+// SetSSOUserCommonName records the VPN common name for a provider's user, or
+// clears it when commonName is empty so the email is used.
+func (s *UserStore) SetSSOUserCommonName(ctx context.Context, provider, externalID, commonName string) error {
+	var value *string
+	if commonName != "" {
+		value = &commonName
+	}
+	_, err := s.db.Pool.Exec(ctx, `
+		UPDATE users SET common_name = $3 WHERE provider = $1 AND external_id = $2
+	`, provider, externalID, value)
+	if err != nil && strings.Contains(err.Error(), "duplicate key") {
+		return fmt.Errorf("common name %q is already used by another user", commonName)
+	}
+	return err
+}
+
+// GetGroupMembershipFingerprint returns a digest of every SSO user's group memberships.
+// It changes whenever any user's groups change and is used for rule change detection.
+func (s *UserStore) GetGroupMembershipFingerprint(ctx context.Context) (string, error) {
+	var fingerprint string
+	err := s.db.Pool.QueryRow(ctx, `
+		SELECT COALESCE(md5(string_agg(id::text || ':' || COALESCE(groups::text, '[]'), ',' ORDER BY id)), '')
+		FROM users
+	`).Scan(&fingerprint)
+	return fingerprint, err
+}
+
 // GetLocalUserByEmail retrieves a local user by email
 func (s *UserStore) GetLocalUserByEmail(ctx context.Context, email string) (*LocalUser, error) {
 	var u LocalUser
 	err := s.db.Pool.QueryRow(ctx, `
-		SELECT id, username, email, is_admin, last_login_at, created_at
-		FROM local_users WHERE email = $1
-	`, email).Scan(&u.ID, &u.Username, &u.Email, &u.IsAdmin, &u.LastLoginAt, &u.CreatedAt)
+		SELECT id, username, email, is_admin, last_login_at, created_at, deactivated_at
+		FROM local_users WHERE email = $1 AND deleted_at IS NULL
+	`, email).Scan(&u.ID, &u.Username, &u.Email, &u.IsAdmin, &u.LastLoginAt, &u.CreatedAt, &u.DeactivatedAt)
 	if err == pgx.ErrNoRows {
 		return nil, ErrUserNotFound
 	}
@@ -419,7 +564,7 @@ func (s *UserStore) GetLocalUserByUsername(ctx context.Context, username string)
 	var u LocalUser
 	err := s.db.Pool.QueryRow(ctx, `
 		SELECT id, username, email, is_admin, last_login_at, created_at
-		FROM local_users WHERE username = $1
+		FROM local_users WHERE username = $1 AND deleted_at IS NULL
 	`, username).Scan(&u.ID, &u.Username, &u.Email, &u.IsAdmin, &u.LastLoginAt, &u.CreatedAt)
 	if err == pgx.ErrNoRows {
 		return nil, ErrUserNotFound
@@ -432,11 +577,13 @@ func (s *UserStore) GetLocalUserByUsername(ctx context.Context, username string)
 
 // ListLocalUsers returns all local admin users
 func (s *UserStore) ListLocalUsers(ctx context.Context) ([]*LocalUser, error) {
+	tenant, args := tenantClause(ctx, "tenant_id", nil)
 	rows, err := s.db.Pool.Query(ctx, `
-		SELECT id, username, email, is_admin, last_login_at, created_at
+		SELECT id, username, email, is_admin, last_login_at, created_at, deactivated_at
 		FROM local_users
+		WHERE deleted_at IS NULL AND `+tenant+`
 		ORDER BY username
-	`)
+	`, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -445,7 +592,7 @@ func (s *UserStore) ListLocalUsers(ctx context.Context) ([]*LocalUser, error) {
 	var users []*LocalUser
 	for rows.Next() {
 		var u LocalUser
-		if err := rows.Scan(&u.ID, &u.Username, &u.Email, &u.IsAdmin, &u.LastLoginAt, &u.CreatedAt); err != nil {
+		if err := rows.Scan(&u.ID, &u.Username, &u.Email, &u.IsAdmin, &u.LastLoginAt, &u.CreatedAt, &u.DeactivatedAt); err != nil {
 			return nil, err
 		}
 		users = append(users, &u)
@@ -485,12 +632,13 @@ func (s *UserStore) ListAllGroups(ctx context.Context) ([]string, error) {
 
 // GetGroupMembers returns all SSO users that belong to a specific group
 func (s *UserStore) GetGroupMembers(ctx context.Context, groupName string) ([]*SSOUser, error) {
+	tenant, args := tenantClause(ctx, "tenant_id", []interface{}{groupName})
 	rows, err := s.db.Pool.Query(ctx, `
-		SELECT id, external_id, provider, email, name, groups, is_admin, is_active, last_login_at, created_at, updated_at
+		SELECT id, external_id, provider, email, name, groups, is_admin, is_active, last_login_at, created_at, updated_at, COALESCE(common_name, '')
 		FROM users
-		WHERE groups ? $1
+		WHERE groups ? $1 AND `+tenant+`
 		ORDER BY email
-	`, groupName)
+	`, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -501,7 +649,7 @@ func (s *UserStore) GetGroupMembers(ctx context.Context, groupName string) ([]*S
 		var u SSOUser
 		var groupsJSON []byte
 		if err := rows.Scan(&u.ID, &u.ExternalID, &u.Provider, &u.Email, &u.Name,
-			&groupsJSON, &u.IsAdmin, &u.IsActive, &u.LastLoginAt, &u.CreatedAt, &u.UpdatedAt); err != nil {
+			&groupsJSON, &u.IsAdmin, &u.IsActive, &u.LastLoginAt, &u.CreatedAt, &u.UpdatedAt, &u.CommonName); err != nil {
 			return nil, err
 		}
 		if len(groupsJSON) > 0 {
@@ -513,8 +661,10 @@ func (s *UserStore) GetGroupMembers(ctx context.Context, groupName string) ([]*S
 }
 
 // UpsertSSOUser creates or updates an SSO user in the database
-// This is called during SSO login to persist user information
-func (s *UserStore) UpsertSSOUser(ctx context.Context, externalID, provider, email, name string, groups []string, isAdmin bool) (*SSOUser, error) {
+// This is called during SSO login to persist user information. New users join
+// the tenant of the provider with the given type ("oidc", "saml" or "ldap") and
+// name.
+func (s *UserStore) UpsertSSOUser(ctx context.Context, externalID, providerType, provider, email, name string, groups []string, isAdmin bool) (*SSOUser, error) {
 	groupsJSON, err := json.Marshal(groups)
 	if err != nil {
 		return nil, err
@@ -523,8 +673,8 @@ func (s *UserStore) UpsertSSOUser(ctx context.Context, externalID, provider, ema
 	var u SSOUser
 	var groupsOut []byte
 	err = s.db.Pool.QueryRow(ctx, `
-		INSERT INTO users (external_id, provider, email, name, groups, is_admin, is_active, last_login_at)
-		VALUES ($1, $2, $3, $4, $5, $6, true, NOW())
+		INSERT INTO users (external_id, provider, email, name, groups, is_admin, is_active, last_login_at, tenant_id)
+		VALUES ($1, $2, $3, $4, $5, $6, true, NOW(), `+providerTenantSQL("$7", "$2")+`)
 		ON CONFLICT (provider, external_id) DO UPDATE SET
 			email = EXCLUDED.email,
 			name = EXCLUDED.name,
@@ -532,10 +682,10 @@ func (s *UserStore) UpsertSSOUser(ctx context.Context, externalID, provider, ema
 			is_admin = COALESCE(users.is_admin, EXCLUDED.is_admin),
 			last_login_at = NOW(),
 			updated_at = NOW()
-		RETURNING id, external_id, provider, email, name, groups, is_admin, is_active, last_login_at, created_at, updated_at
-	`, externalID, provider, email, name, groupsJSON, isAdmin).Scan(
+		RETURNING id, external_id, provider, email, name, groups, is_admin, is_active, last_login_at, created_at, updated_at, COALESCE(common_name, '')
+	`, externalID, provider, email, name, groupsJSON, isAdmin, providerType).Scan(
 		&u.ID, &u.ExternalID, &u.Provider, &u.Email, &u.Name,
-		&groupsOut, &u.IsAdmin, &u.IsActive, &u.LastLoginAt, &u.CreatedAt, &u.UpdatedAt,
+		&groupsOut, &u.IsAdmin, &u.IsActive, &u.LastLoginAt, &u.CreatedAt, &u.UpdatedAt, &u.CommonName,
 	)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,61 @@
+package firewall
+
+import (
+	"net"
+	"strconv"
+	"strings"
+)
+
+// DenyLogPrefix starts the kernel log entry for each packet a client's default
+// drop rule logs.
+const DenyLogPrefix = "gatekey-deny: "
+
+// DefaultDenyLogRate is how many denied packets per second are logged for each
+// client when no rate is configured.
+const DefaultDenyLogRate = 5
+
+// DenyLogConfig controls logging of the packets a client's default drop rule
+// denies, so blocked destinations can be reported instead of silently dropped.
+type DenyLogConfig struct {
+	Enabled bool
+	Rate    int // Packets logged per second per client; DefaultDenyLogRate if unset
+}
+
+// DeniedPacket is a packet a client's default drop rule denied, as logged.
+type DeniedPacket struct {
+	SourceIP net.IP
+	DestIP   net.IP
+	Protocol string // tcp, udp, icmp, or the kernel's protocol name or number
+	DestPort int    // 0 for protocols without ports
+}
+
+// ParseDenyLog parses a kernel log line written for a denied packet, such as a
+// /dev/kmsg record or a dmesg line. Lines without the deny log prefix report false.
+func ParseDenyLog(line string) (DeniedPacket, bool) {
+	_, fields, ok := strings.Cut(line, DenyLogPrefix)
+	if !ok {
+		return DeniedPacket{}, false
+	}
+
+	var pkt DeniedPacket
+	for _, field := range strings.Fields(fields) {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "SRC":
+			pkt.SourceIP = net.ParseIP(value)
+		case "DST":
+			pkt.DestIP = net.ParseIP(value)
+		case "PROTO":
+			pkt.Protocol = strings.ToLower(value)
+		case "DPT":
+			pkt.DestPort, _ = strconv.Atoi(value)
+		}
+	}
+	if pkt.SourceIP == nil || pkt.DestIP == nil {
+		return DeniedPacket{}, false
+	}
+	return pkt, true
+}
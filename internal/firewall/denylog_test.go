@@ -0,0 +1,39 @@
+package firewall
+
+import "testing"
+
+func TestParseDenyLog(t *testing.T) {
+	tests := []struct {
+		line  string
+		ok    bool
+		src   string
+		dst   string
+		proto string
+		port  int
+	}{
+		{
+			"6,1042,98765432,-;gatekey-deny: IN=tun0 OUT=eth0 MAC= SRC=10.8.0.6 DST=10.2.0.5 LEN=60 TOS=0x00 PREC=0x00 TTL=63 ID=4242 DF PROTO=TCP SPT=51514 DPT=5432 WINDOW=64240 RES=0x00 SYN URGP=0",
+			true, "10.8.0.6", "10.2.0.5", "tcp", 5432,
+		},
+		{
+			"[12345.678] gatekey-deny: IN=tun0 OUT=eth0 SRC=10.8.0.7 DST=192.0.2.1 LEN=84 PROTO=ICMP TYPE=8 CODE=0 ID=7 SEQ=1",
+			true, "10.8.0.7", "192.0.2.1", "icmp", 0,
+		},
+		{"6,1043,98765433,-;eth0: link up", false, "", "", "", 0},
+		{"gatekey-deny: IN=tun0 OUT=eth0 PROTO=UDP", false, "", "", "", 0},
+	}
+
+	for _, tt := range tests {
+		pkt, ok := ParseDenyLog(tt.line)
+		if ok != tt.ok {
+			t.Errorf("ParseDenyLog(%q) ok = %v, want %v", tt.line, ok, tt.ok)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if pkt.SourceIP.String() != tt.src || pkt.DestIP.String() != tt.dst || pkt.Protocol != tt.proto || pkt.DestPort != tt.port {
+			t.Errorf("ParseDenyLog(%q) = %+v, want %s -> %s %s/%d", tt.line, pkt, tt.src, tt.dst, tt.proto, tt.port)
+		}
+	}
+}
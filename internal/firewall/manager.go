@@ -19,15 +19,18 @@ type Backend interface {
 	AddRules(ctx context.Context, rules []Rule) error
 
 	// AddDefaultDropRule adds a drop rule for all traffic from a source IP
-	AddDefaultDropRule(ctx context.Context, sourceIP net.IP) error
+	AddDefaultDropRule(ctx context.Context, connectionID string, sourceIP net.IP) error
 
-	// RemoveRules removes firewall rules for a connection.
+	// RemoveRules removes firewall rules for a connection. An empty connectionID
+	// removes rules in the gatekey chain that gatekey didn't create.
 	RemoveRules(ctx context.Context, connectionID string) error
 
 	// FlushAllRules removes all rules from the firewall
 	FlushAllRules(ctx context.Context) error
 
-	// ListRules lists all rules managed by gatekey.
+	// ListRules reads back the rules actually present in the firewall. Each rule
+	// has its ConnectionID and its fingerprint as ID; rules gatekey didn't create
+	// have an empty ConnectionID.
 	ListRules(ctx context.Context) ([]Rule, error)
 
 	// Cleanup removes all gatekey-managed rules.
@@ -74,7 +77,8 @@ const (
 type Manager struct {
 	backend Backend
 	mu      sync.RWMutex
-	rules   map[string][]Rule // connectionID -> rules
+	rules   map[string][]Rule // connectionID -> allow rules
+	sources map[string]net.IP // connectionID -> source IP covered by the default drop rule
 }
 
 // NewManager creates a new firewall manager.
@@ -82,25 +86,32 @@ func NewManager(backend Backend) *Manager {
 	return &Manager{
 		backend: backend,
 		rules:   make(map[string][]Rule),
+		sources: make(map[string]net.IP),
 	}
 }
 
-// Initialize initializes the firewall manager.
+// Initialize initializes the firewall manager and removes rules left over from a
+// previous run, since connected clients are re-applied from scratch.
 func (m *Manager) Initialize(ctx context.Context) error {
-	return m.backend.Initialize(ctx)
+	if err := m.backend.Initialize(ctx); err != nil {
+		return err
+	}
+	return m.backend.FlushAllRules(ctx)
 }
 
-// ApplyRules applies firewall rules for a connection.
+// ApplyRules applies firewall rules for a connection, replacing any it already has.
+// The connection's allow rules are always followed by its default drop rule.
 func (m *Manager) ApplyRules(ctx context.Context, connectionID string, userID uuid.UUID, sourceIP net.IP, networks []net.IPNet, ports []PortRange) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	// Flush all existing rules to start fresh
-	// This ensures no stale rules remain and DROP is always at the end
-	if err := m.backend.FlushAllRules(ctx); err != nil {
-		// Log but continue - rules might not exist yet
+	// Replace only this connection's rules; its drop rule is re-added after the
+	// new allow rules so it stays last for this source
+	if err := m.backend.RemoveRules(ctx, connectionID); err != nil {
+		return fmt.Errorf("failed to remove existing rules: %w", err)
 	}
-	m.rules = make(map[string][]Rule)
+	delete(m.rules, connectionID)
+	delete(m.sources, connectionID)
 
 	// Build new rules
 	var rules []Rule
@@ -140,22 +151,27 @@ func (m *Manager) ApplyRules(ctx context.Context, connectionID string, userID uu
 		}
 	}
 
-	if len(rules) == 0 {
-		return nil // No rules to apply
+	if err := m.addConnectionRules(ctx, connectionID, sourceIP, rules); err != nil {
+		return err
 	}
 
-	// Apply rules
+	m.rules[connectionID] = rules
+	m.sources[connectionID] = sourceIP
+	return nil
+}
+
+// addConnectionRules adds a connection's allow rules followed by its default drop rule.
+// A connection with no allow rules still gets the drop rule, so it reaches nothing.
+func (m *Manager) addConnectionRules(ctx context.Context, connectionID string, sourceIP net.IP, rules []Rule) error {
 	if err := m.backend.AddRules(ctx, rules); err != nil {
 		return fmt.Errorf("failed to add rules: %w", err)
 	}
 
 	// Add default drop rule for all traffic from this VPN client
 	// This creates a whitelist - only explicitly allowed destinations are reachable
-	if err := m.backend.AddDefaultDropRule(ctx, sourceIP); err != nil {
+	if err := m.backend.AddDefaultDropRule(ctx, connectionID, sourceIP); err != nil {
 		return fmt.Errorf("failed to add default drop rule: %w", err)
 	}
-
-	m.rules[connectionID] = rules
 	return nil
 }
 
@@ -164,7 +180,7 @@ func (m *Manager) RemoveRules(ctx context.Context, connectionID string) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	if _, exists := m.rules[connectionID]; !exists {
+	if _, exists := m.sources[connectionID]; !exists {
 		return nil // No rules to remove
 	}
 
@@ -173,6 +189,7 @@ func (m *Manager) RemoveRules(ctx context.Context, connectionID string) error {
 	}
 
 	delete(m.rules, connectionID)
+	delete(m.sources, connectionID)
 	return nil
 }
 
@@ -191,6 +208,7 @@ func (m *Manager) Cleanup(ctx context.Context) error {
 	}
 
 	m.rules = make(map[string][]Rule)
+	m.sources = make(map[string]net.IP)
 	return nil
 }
 
@@ -213,6 +231,18 @@ func (m *Manager) ConnectionRules(connectionID string) []Rule {
 	return m.rules[connectionID]
 }
 
+// RuleCount returns the number of allow rules applied across all connections.
+func (m *Manager) RuleCount() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	count := 0
+	for _, rules := range m.rules {
+		count += len(rules)
+	}
+	return count
+}
+
 // UserConnections returns all connection IDs for a user.
 func (m *Manager) UserConnections(userID uuid.UUID) []string {
 	m.mu.RLock()
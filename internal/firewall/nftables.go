@@ -11,6 +11,8 @@ import (
 
 	"github.com/google/nftables"
 	"github.com/google/nftables/expr"
+	"github.com/google/nftables/userdata"
+	"golang.org/x/sys/unix"
 )
 
 // NFTablesBackend implements the firewall backend using nftables.
@@ -20,7 +22,7 @@ type NFTablesBackend struct {
 	chain     *nftables.Chain
 	tableName string
 	chainName string
-	rules     map[string][]*nftables.Rule // connectionID -> nftables rules
+	denyLog   DenyLogConfig
 	mu        sync.Mutex
 }
 
@@ -28,6 +30,7 @@ type NFTablesBackend struct {
 type NFTablesConfig struct {
 	TableName string
 	ChainName string
+	DenyLog   DenyLogConfig
 }
 
 // NewNFTablesBackend creates a new nftables backend.
@@ -44,11 +47,15 @@ func NewNFTablesBackend(cfg NFTablesConfig) (*NFTablesBackend, error) {
 		cfg.ChainName = "forward"
 	}
 
+	if cfg.DenyLog.Enabled && cfg.DenyLog.Rate <= 0 {
+		cfg.DenyLog.Rate = DefaultDenyLogRate
+	}
+
 	return &NFTablesBackend{
 		conn:      conn,
 		tableName: cfg.TableName,
 		chainName: cfg.ChainName,
-		rules:     make(map[string][]*nftables.Rule),
+		denyLog:   cfg.DenyLog,
 	}, nil
 }
 
@@ -85,15 +92,53 @@ func (b *NFTablesBackend) Initialize(ctx context.Context) error {
 
 // AddDefaultDropRule adds a rule to drop all traffic from a VPN client IP
 // This should be called after adding allow rules to create a whitelist
-// The rule is tracked with connectionID so it can be removed later
-func (b *NFTablesBackend) AddDefaultDropRule(ctx context.Context, sourceIP net.IP) error {
+// The rule is tagged with connectionID so it can be removed later
+func (b *NFTablesBackend) AddDefaultDropRule(ctx context.Context, connectionID string, sourceIP net.IP) error {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
+	tag := userdata.AppendString(nil, userdata.TypeComment, ruleTag(dropRule(connectionID, sourceIP)))
+
+	// Log what is about to be dropped, rate limited per client. The limit is a
+	// match, so it sits in a rule of its own: packets over it skip the log but
+	// still reach the drop rule.
+	if b.denyLog.Enabled {
+		b.conn.AddRule(&nftables.Rule{
+			Table:    b.table,
+			Chain:    b.chain,
+			UserData: tag,
+			Exprs: []expr.Any{
+				&expr.Payload{
+					DestRegister: 1,
+					Base:         expr.PayloadBaseNetworkHeader,
+					Offset:       12,
+					Len:          4,
+				},
+				&expr.Cmp{
+					Op:       expr.CmpOpEq,
+					Register: 1,
+					Data:     sourceIP.To4(),
+				},
+				&expr.Limit{
+					Type:  expr.LimitTypePkts,
+					Rate:  uint64(b.denyLog.Rate),
+					Unit:  expr.LimitTimeSecond,
+					Burst: uint32(b.denyLog.Rate),
+				},
+				&expr.Log{
+					Key:   1<<unix.NFTA_LOG_PREFIX | 1<<unix.NFTA_LOG_LEVEL,
+					Level: expr.LogLevelInfo,
+					Data:  []byte(DenyLogPrefix),
+				},
+			},
+		})
+	}
+
 	// Create a drop rule for all traffic from this VPN client
 	rule := &nftables.Rule{
-		Table: b.table,
-		Chain: b.chain,
+		Table:    b.table,
+		Chain:    b.chain,
+		UserData: tag,
 		Exprs: []expr.Any{
 			// Match source IP (VPN client)
 			&expr.Payload{
@@ -119,10 +164,6 @@ func (b *NFTablesBackend) AddDefaultDropRule(ctx context.Context, sourceIP net.I
 		return fmt.Errorf("failed to add default drop rule: %w", err)
 	}
 
-	// Track this rule with a special key so it gets removed on cleanup
-	dropKey := fmt.Sprintf("drop-%s", sourceIP.String())
-	b.rules[dropKey] = []*nftables.Rule{rule}
-
 	return nil
 }
 
@@ -146,8 +187,6 @@ func (b *NFTablesBackend) FlushAllRules(ctx context.Context) error {
 		return fmt.Errorf("failed to flush rules: %w", err)
 	}
 
-	// Clear our tracking
-	b.rules = make(map[string][]*nftables.Rule)
 	return nil
 }
 
@@ -160,14 +199,10 @@ func (b *NFTablesBackend) AddRules(ctx context.Context, rules []Rule) error {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
-	connectionID := rules[0].ConnectionID
-	var nftRules []*nftables.Rule
-
 	for _, rule := range rules {
 		nftRule := b.buildRule(rule)
 		if nftRule != nil {
 			b.conn.AddRule(nftRule)
-			nftRules = append(nftRules, nftRule)
 		}
 	}
 
@@ -175,69 +210,89 @@ func (b *NFTablesBackend) AddRules(ctx context.Context, rules []Rule) error {
 		return fmt.Errorf("failed to add nftables rules: %w", err)
 	}
 
-	b.rules[connectionID] = nftRules
 	return nil
 }
 
-// RemoveRules removes firewall rules for a connection.
+// RemoveRules removes firewall rules for a connection, found by reading back the
+// chain so rules are removed even if the backend lost track of them.
 func (b *NFTablesBackend) RemoveRules(ctx context.Context, connectionID string) error {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
-	rules, exists := b.rules[connectionID]
-	if !exists {
-		return nil
+	rules, err := b.conn.GetRules(b.table, b.chain)
+	if err != nil {
+		return fmt.Errorf("failed to get rules: %w", err)
 	}
 
+	deleted := 0
 	for _, rule := range rules {
+		if ruleConnectionID(rule) != connectionID {
+			continue
+		}
 		if err := b.conn.DelRule(rule); err != nil {
 			// Log but continue
 			continue
 		}
+		deleted++
+	}
+	if deleted == 0 {
+		return nil
 	}
 
 	if err := b.conn.Flush(); err != nil {
 		return fmt.Errorf("failed to remove nftables rules: %w", err)
 	}
 
-	delete(b.rules, connectionID)
 	return nil
 }
 
-// ListRules lists all rules managed by gatekey.
+// ListRules reads back the rules in the gatekey chain, identified by their tags.
 func (b *NFTablesBackend) ListRules(ctx context.Context) ([]Rule, error) {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
-	var allRules []Rule
-	for _, rules := range b.rules {
-		for range rules {
-			// Note: Converting back from nftables rules to our Rule struct
-			// is complex and typically not needed. This is a placeholder.
-			allRules = append(allRules, Rule{})
+	rules, err := b.conn.GetRules(b.table, b.chain)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get rules: %w", err)
+	}
+
+	allRules := make([]Rule, 0, len(rules))
+	for _, rule := range rules {
+		// A deny log rule belongs to the drop rule after it
+		if isLogRule(rule) {
+			continue
 		}
+		comment, _ := userdata.GetString(rule.UserData, userdata.TypeComment)
+		connectionID, fingerprint, _ := parseRuleTag(comment)
+		allRules = append(allRules, Rule{
+			ID:           fingerprint,
+			ConnectionID: connectionID,
+			Comment:      comment,
+		})
 	}
 	return allRules, nil
 }
 
-// Cleanup removes all gatekey-managed rules.
-func (b *NFTablesBackend) Cleanup(ctx context.Context) error {
-	b.mu.Lock()
-	defer b.mu.Unlock()
+// ruleConnectionID returns the connection a rule was tagged with, or "" if the rule
+// wasn't created by gatekey.
+func ruleConnectionID(rule *nftables.Rule) string {
+	comment, _ := userdata.GetString(rule.UserData, userdata.TypeComment)
+	connectionID, _, _ := parseRuleTag(comment)
+	return connectionID
+}
 
-	// Delete all tracked rules
-	for connectionID := range b.rules {
-		for _, rule := range b.rules[connectionID] {
-			b.conn.DelRule(rule)
+func isLogRule(rule *nftables.Rule) bool {
+	for _, e := range rule.Exprs {
+		if _, ok := e.(*expr.Log); ok {
+			return true
 		}
 	}
+	return false
+}
 
-	if err := b.conn.Flush(); err != nil {
-		return fmt.Errorf("failed to cleanup nftables rules: %w", err)
-	}
-
-	b.rules = make(map[string][]*nftables.Rule)
-	return nil
+// Cleanup removes all gatekey-managed rules.
+func (b *NFTablesBackend) Cleanup(ctx context.Context) error {
+	return b.FlushAllRules(ctx)
 }
 
 // Close closes the nftables connection.
@@ -381,8 +436,9 @@ func (b *NFTablesBackend) buildRule(rule Rule) *nftables.Rule {
 	exprs = append(exprs, verdict)
 
 	return &nftables.Rule{
-		Table: b.table,
-		Chain: b.chain,
-		Exprs: exprs,
+		Table:    b.table,
+		Chain:    b.chain,
+		Exprs:    exprs,
+		UserData: userdata.AppendString(nil, userdata.TypeComment, ruleTag(rule)),
 	}
 }
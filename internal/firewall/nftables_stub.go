@@ -18,6 +18,7 @@ type NFTablesBackend struct{}
 type NFTablesConfig struct {
 	TableName string
 	ChainName string
+	DenyLog   DenyLogConfig
 }
 
 // NewNFTablesBackend returns an error on non-Linux platforms.
@@ -31,7 +32,7 @@ func (b *NFTablesBackend) Initialize(ctx context.Context) error {
 }
 
 // AddDefaultDropRule returns an error on non-Linux platforms.
-func (b *NFTablesBackend) AddDefaultDropRule(ctx context.Context, sourceIP net.IP) error {
+func (b *NFTablesBackend) AddDefaultDropRule(ctx context.Context, connectionID string, sourceIP net.IP) error {
 	return errNotSupported
 }
 
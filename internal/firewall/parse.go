@@ -0,0 +1,48 @@
+package firewall
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ParsePortRange parses an access rule port range of the form "*", "80", or
+// "8000-9000". An empty value or "*" means all ports and returns 0, 0.
+func ParsePortRange(s string) (start, end int, err error) {
+	if s == "" || s == "*" {
+		return 0, 0, nil
+	}
+
+	startStr, endStr, isRange := strings.Cut(s, "-")
+	start, err = strconv.Atoi(startStr)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid port range %q: must be *, a port, or a range like 8000-9000", s)
+	}
+	end = start
+	if isRange {
+		if end, err = strconv.Atoi(endStr); err != nil {
+			return 0, 0, fmt.Errorf("invalid port range %q: must be *, a port, or a range like 8000-9000", s)
+		}
+	}
+	if start < 1 || end > 65535 || start > end {
+		return 0, 0, fmt.Errorf("invalid port range %q: ports must be 1-65535 with start <= end", s)
+	}
+	return start, end, nil
+}
+
+// ParseProtocol parses an access rule protocol. An empty value, "*" or "any"
+// means any protocol.
+func ParseProtocol(s string) (Protocol, error) {
+	switch s {
+	case "", "*", "any":
+		return ProtocolAny, nil
+	case "tcp":
+		return ProtocolTCP, nil
+	case "udp":
+		return ProtocolUDP, nil
+	case "icmp":
+		return ProtocolICMP, nil
+	default:
+		return "", fmt.Errorf("invalid protocol %q: must be tcp, udp, icmp, or empty for any", s)
+	}
+}
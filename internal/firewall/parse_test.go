@@ -0,0 +1,51 @@
+package firewall
+
+import "testing"
+
+func TestParsePortRange(t *testing.T) {
+	tests := []struct {
+		input     string
+		wantStart int
+		wantEnd   int
+		wantErr   bool
+	}{
+		{"", 0, 0, false},
+		{"*", 0, 0, false},
+		{"443", 443, 443, false},
+		{"8000-9000", 8000, 9000, false},
+		{"1-65535", 1, 65535, false},
+		{"0", 0, 0, true},
+		{"65536", 0, 0, true},
+		{"9000-8000", 0, 0, true},
+		{"80-", 0, 0, true},
+		{"http", 0, 0, true},
+		{"80,443", 0, 0, true},
+	}
+
+	for _, tt := range tests {
+		start, end, err := ParsePortRange(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParsePortRange(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if start != tt.wantStart || end != tt.wantEnd {
+			t.Errorf("ParsePortRange(%q) = %d, %d, want %d, %d", tt.input, start, end, tt.wantStart, tt.wantEnd)
+		}
+	}
+}
+
+func TestParseProtocol(t *testing.T) {
+	valid := map[string]Protocol{"": ProtocolAny, "*": ProtocolAny, "any": ProtocolAny, "tcp": ProtocolTCP, "udp": ProtocolUDP, "icmp": ProtocolICMP}
+	for input, want := range valid {
+		got, err := ParseProtocol(input)
+		if err != nil || got != want {
+			t.Errorf("ParseProtocol(%q) = %q, %v, want %q", input, got, err, want)
+		}
+	}
+
+	for _, input := range []string{"TCP", "sctp", "icmpv6"} {
+		if _, err := ParseProtocol(input); err == nil {
+			t.Errorf("ParseProtocol(%q) expected error", input)
+		}
+	}
+}
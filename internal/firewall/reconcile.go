@@ -0,0 +1,146 @@
+package firewall
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+)
+
+// ruleTagPrefix starts the comment gatekey attaches to every rule it creates, in the
+// form "gatekey/<connectionID>/<fingerprint>", so rules can be read back and matched
+// against the desired state.
+const ruleTagPrefix = "gatekey/"
+
+// ruleFingerprint returns a short digest of the parts of a rule that affect matching.
+func ruleFingerprint(rule Rule) string {
+	dest := ""
+	if rule.DestNetwork.IP != nil {
+		dest = rule.DestNetwork.String()
+	}
+	data := fmt.Sprintf("%s|%s|%s|%s|%d|%d", rule.SourceIP, rule.Action, rule.Protocol, dest, rule.DestPort, rule.DestPortEnd)
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:8])
+}
+
+// ruleTag returns the comment that identifies a rule in the firewall.
+func ruleTag(rule Rule) string {
+	return ruleTagPrefix + rule.ConnectionID + "/" + ruleFingerprint(rule)
+}
+
+// parseRuleTag extracts the connection ID and fingerprint from a rule comment.
+func parseRuleTag(tag string) (connectionID, fingerprint string, ok bool) {
+	if !strings.HasPrefix(tag, ruleTagPrefix) {
+		return "", "", false
+	}
+	parts := strings.SplitN(strings.TrimPrefix(tag, ruleTagPrefix), "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+// dropRule returns the default drop rule for a connection's source IP.
+func dropRule(connectionID string, sourceIP net.IP) Rule {
+	return Rule{
+		ID:           connectionID + "-drop",
+		ConnectionID: connectionID,
+		SourceIP:     sourceIP,
+		Action:       ActionDrop,
+		Protocol:     ProtocolAny,
+	}
+}
+
+// Drift describes differences found between the firewall and the desired state.
+type Drift struct {
+	// Repaired lists connections whose rules were missing or altered and were re-applied.
+	Repaired []string
+	// Orphaned lists connections that had rules in the firewall but no longer should.
+	Orphaned []string
+	// Unknown counts rules in the gatekey chain that gatekey didn't create.
+	Unknown int
+}
+
+// Empty reports whether no drift was found.
+func (d *Drift) Empty() bool {
+	return len(d.Repaired) == 0 && len(d.Orphaned) == 0 && d.Unknown == 0
+}
+
+// Reconcile reads back the rules in the firewall, compares them with the rules the
+// manager has applied, and repairs any difference: connections with missing or extra
+// rules are re-applied, and rules for unknown connections are removed.
+func (m *Manager) Reconcile(ctx context.Context) (*Drift, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	actualRules, err := m.backend.ListRules(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read firewall rules: %w", err)
+	}
+
+	actual := make(map[string][]string)
+	drift := &Drift{}
+	for _, r := range actualRules {
+		if r.ConnectionID == "" {
+			drift.Unknown++
+			continue
+		}
+		actual[r.ConnectionID] = append(actual[r.ConnectionID], r.ID)
+	}
+
+	for connectionID, sourceIP := range m.sources {
+		want := make([]string, 0, len(m.rules[connectionID])+1)
+		for _, r := range m.rules[connectionID] {
+			want = append(want, ruleFingerprint(r))
+		}
+		want = append(want, ruleFingerprint(dropRule(connectionID, sourceIP)))
+
+		if sameFingerprints(want, actual[connectionID]) {
+			continue
+		}
+		if err := m.backend.RemoveRules(ctx, connectionID); err != nil {
+			return drift, fmt.Errorf("failed to remove drifted rules for %s: %w", connectionID, err)
+		}
+		if err := m.addConnectionRules(ctx, connectionID, sourceIP, m.rules[connectionID]); err != nil {
+			return drift, fmt.Errorf("failed to repair rules for %s: %w", connectionID, err)
+		}
+		drift.Repaired = append(drift.Repaired, connectionID)
+	}
+
+	for connectionID := range actual {
+		if _, ok := m.sources[connectionID]; ok {
+			continue
+		}
+		if err := m.backend.RemoveRules(ctx, connectionID); err != nil {
+			return drift, fmt.Errorf("failed to remove orphaned rules for %s: %w", connectionID, err)
+		}
+		drift.Orphaned = append(drift.Orphaned, connectionID)
+	}
+
+	if drift.Unknown > 0 {
+		if err := m.backend.RemoveRules(ctx, ""); err != nil {
+			return drift, fmt.Errorf("failed to remove unknown rules: %w", err)
+		}
+	}
+
+	sort.Strings(drift.Repaired)
+	sort.Strings(drift.Orphaned)
+	return drift, nil
+}
+
+// sameFingerprints reports whether a and b contain the same fingerprints in the
+// same order. Order matters because the drop rule must come last.
+func sameFingerprints(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,112 @@
+package firewall
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// memoryBackend keeps rules in order, tagged the same way as the nftables backend.
+type memoryBackend struct {
+	rules []Rule
+}
+
+func (b *memoryBackend) Initialize(ctx context.Context) error { return nil }
+
+func (b *memoryBackend) AddRules(ctx context.Context, rules []Rule) error {
+	for _, r := range rules {
+		b.rules = append(b.rules, Rule{ID: ruleFingerprint(r), ConnectionID: r.ConnectionID, Comment: ruleTag(r)})
+	}
+	return nil
+}
+
+func (b *memoryBackend) AddDefaultDropRule(ctx context.Context, connectionID string, sourceIP net.IP) error {
+	return b.AddRules(ctx, []Rule{dropRule(connectionID, sourceIP)})
+}
+
+func (b *memoryBackend) RemoveRules(ctx context.Context, connectionID string) error {
+	kept := b.rules[:0]
+	for _, r := range b.rules {
+		if r.ConnectionID != connectionID {
+			kept = append(kept, r)
+		}
+	}
+	b.rules = kept
+	return nil
+}
+
+func (b *memoryBackend) FlushAllRules(ctx context.Context) error {
+	b.rules = nil
+	return nil
+}
+
+func (b *memoryBackend) ListRules(ctx context.Context) ([]Rule, error) {
+	return append([]Rule(nil), b.rules...), nil
+}
+
+func (b *memoryBackend) Cleanup(ctx context.Context) error { return b.FlushAllRules(ctx) }
+
+func (b *memoryBackend) Close() error { return nil }
+
+func TestReconcile(t *testing.T) {
+	ctx := context.Background()
+	backend := &memoryBackend{}
+	m := NewManager(backend)
+	if err := m.Initialize(ctx); err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+
+	_, network, _ := net.ParseCIDR("10.0.0.0/24")
+	ports := []PortRange{{Protocol: ProtocolTCP, Port: 443}}
+	if err := m.ApplyRules(ctx, "alice", uuid.New(), net.ParseIP("172.31.255.2"), []net.IPNet{*network}, ports); err != nil {
+		t.Fatalf("ApplyRules alice: %v", err)
+	}
+	if err := m.ApplyRules(ctx, "bob", uuid.New(), net.ParseIP("172.31.255.3"), nil, nil); err != nil {
+		t.Fatalf("ApplyRules bob: %v", err)
+	}
+	want := len(backend.rules)
+	if want != 3 {
+		t.Fatalf("expected 3 rules (alice allow+drop, bob drop), got %d", want)
+	}
+
+	drift, err := m.Reconcile(ctx)
+	if err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if !drift.Empty() {
+		t.Fatalf("expected no drift, got %+v", drift)
+	}
+
+	// Someone deletes alice's allow rule, leaves rules for a disconnected client,
+	// and adds a rule of their own
+	backend.rules = backend.rules[1:]
+	backend.AddDefaultDropRule(ctx, "carol", net.ParseIP("172.31.255.4"))
+	backend.rules = append(backend.rules, Rule{ID: "handmade"})
+
+	drift, err = m.Reconcile(ctx)
+	if err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if len(drift.Repaired) != 1 || drift.Repaired[0] != "alice" {
+		t.Errorf("Repaired = %v, want [alice]", drift.Repaired)
+	}
+	if len(drift.Orphaned) != 1 || drift.Orphaned[0] != "carol" {
+		t.Errorf("Orphaned = %v, want [carol]", drift.Orphaned)
+	}
+	if drift.Unknown != 1 {
+		t.Errorf("Unknown = %d, want 1", drift.Unknown)
+	}
+	if len(backend.rules) != want {
+		t.Errorf("expected %d rules after repair, got %d", want, len(backend.rules))
+	}
+
+	drift, err = m.Reconcile(ctx)
+	if err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if !drift.Empty() {
+		t.Errorf("expected no drift after repair, got %+v", drift)
+	}
+}
@@ -0,0 +1,71 @@
+package firewall
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Hostname wildcard rules are written as *.example.com. By default the * stands
+// for one or more labels, so the pattern matches a.example.com and
+// a.b.example.com; with single-label matching it only matches a.example.com. A
+// wildcard never matches the bare domain (example.com), which needs its own
+// hostname rule.
+
+// hostnameLabelRegex matches a single RFC 1123 hostname label.
+var hostnameLabelRegex = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?$`)
+
+// ValidHostname reports whether name is a valid RFC 1123 hostname.
+func ValidHostname(name string) bool {
+	name = strings.TrimSuffix(name, ".")
+	if name == "" || len(name) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(name, ".") {
+		if !hostnameLabelRegex.MatchString(label) {
+			return false
+		}
+	}
+	return true
+}
+
+// ValidateHostnameWildcard checks a hostname_wildcard pattern: a leading "*."
+// followed by a valid hostname.
+func ValidateHostnameWildcard(pattern string) error {
+	suffix, ok := strings.CutPrefix(pattern, "*.")
+	if !ok {
+		return fmt.Errorf("%q must start with \"*.\"", pattern)
+	}
+	if strings.Contains(suffix, "*") {
+		return fmt.Errorf("%q may only have a single leading \"*\"", pattern)
+	}
+	if !ValidHostname(suffix) {
+		return fmt.Errorf("%q is not a valid wildcard pattern", pattern)
+	}
+	return nil
+}
+
+// MatchHostnameWildcard reports whether host matches a hostname wildcard pattern.
+// Matching is case-insensitive and ignores a trailing dot. With singleLabel the
+// wildcard matches exactly one label instead of one or more.
+func MatchHostnameWildcard(pattern, host string, singleLabel bool) bool {
+	suffix, ok := strings.CutPrefix(normalizeHostname(pattern), "*")
+	if !ok {
+		return false
+	}
+	host = normalizeHostname(host)
+
+	prefix, ok := strings.CutSuffix(host, suffix)
+	if !ok || prefix == "" {
+		return false
+	}
+	if singleLabel && strings.Contains(prefix, ".") {
+		return false
+	}
+	return true
+}
+
+// normalizeHostname lowercases a hostname and strips its trailing dot.
+func normalizeHostname(name string) string {
+	return strings.ToLower(strings.TrimSuffix(name, "."))
+}
@@ -0,0 +1,47 @@
+package firewall
+
+import "testing"
+
+func TestValidateHostnameWildcard(t *testing.T) {
+	tests := []struct {
+		pattern string
+		wantErr bool
+	}{
+		{"*.example.com", false},
+		{"*.internal", false},
+		{"example.com", true},
+		{"*example.com", true},
+		{"*.*.example.com", true},
+		{"a.*.example.com", true},
+		{"*.", true},
+		{"*.exa_mple.com", true},
+	}
+	for _, tt := range tests {
+		err := ValidateHostnameWildcard(tt.pattern)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ValidateHostnameWildcard(%q) error = %v, wantErr %v", tt.pattern, err, tt.wantErr)
+		}
+	}
+}
+
+func TestMatchHostnameWildcard(t *testing.T) {
+	tests := []struct {
+		host        string
+		singleLabel bool
+		want        bool
+	}{
+		{"api.example.com", false, true},
+		{"API.Example.com.", false, true},
+		{"a.b.example.com", false, true},
+		{"a.b.example.com", true, false},
+		{"api.example.com", true, true},
+		{"example.com", false, false},
+		{"badexample.com", false, false},
+		{"api.example.org", false, false},
+	}
+	for _, tt := range tests {
+		if got := MatchHostnameWildcard("*.example.com", tt.host, tt.singleLabel); got != tt.want {
+			t.Errorf("MatchHostnameWildcard(%q, singleLabel=%v) = %v, want %v", tt.host, tt.singleLabel, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,310 @@
+// Package geoip resolves client IP addresses to a country and city for login
+// logs. Lookups use a local MaxMind GeoLite2/GeoIP2 database when one is
+// configured, or the ip-api.com service otherwise, and results are cached in
+// memory so repeat logins from the same address don't need another lookup.
+package geoip
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Provider names accepted in Config.Provider.
+const (
+	ProviderAuto    = "auto"    // MaxMind database if configured, otherwise ip-api.com
+	ProviderMaxMind = "maxmind" // Local MaxMind database only
+	ProviderIPAPI   = "ip-api"  // ip-api.com only
+	ProviderNone    = "none"    // Lookups disabled
+)
+
+// ipAPIRateLimit is ip-api.com's free tier limit of requests per minute.
+const ipAPIRateLimit = 45
+
+// errRateLimited is returned when a lookup is skipped to stay under the
+// ip-api.com rate limit.
+var errRateLimited = errors.New("geoip rate limit reached")
+
+// Config configures a Resolver.
+type Config struct {
+	Provider     string
+	DatabasePath string
+	CacheSize    int
+	CacheTTL     time.Duration
+}
+
+// Location is the geolocation of an IP address. Fields are empty when unknown.
+type Location struct {
+	Country     string
+	CountryCode string
+	City        string
+}
+
+// IsZero reports whether no location data is known.
+func (l Location) IsZero() bool {
+	return l == Location{}
+}
+
+// Resolver looks up IP locations with an in-memory LRU cache in front.
+type Resolver struct {
+	lookup func(ctx context.Context, addr netip.Addr) (Location, error)
+	source string
+	cache  *lruCache
+}
+
+// New creates a Resolver. A MaxMind database that fails to load is logged and,
+// unless the provider is "auto", leaves lookups disabled rather than falling back
+// to sending client IPs to a third party.
+func New(cfg Config, logger *zap.Logger) *Resolver {
+	r := &Resolver{
+		source: ProviderNone,
+		cache:  newLRUCache(cfg.CacheSize, cfg.CacheTTL),
+	}
+
+	provider := strings.ToLower(strings.TrimSpace(cfg.Provider))
+	if provider == "" {
+		provider = ProviderAuto
+	}
+
+	if (provider == ProviderAuto || provider == ProviderMaxMind) && cfg.DatabasePath != "" {
+		db, err := openMMDB(cfg.DatabasePath)
+		if err == nil {
+			logger.Info("Using MaxMind database for GeoIP lookups",
+				zap.String("path", cfg.DatabasePath), zap.String("type", db.dbType))
+			r.lookup = db.lookupLocation
+			r.source = ProviderMaxMind
+			return r
+		}
+		logger.Warn("Failed to load MaxMind database", zap.String("path", cfg.DatabasePath), zap.Error(err))
+	}
+
+	switch provider {
+	case ProviderAuto, ProviderIPAPI:
+		r.lookup = newIPAPIClient().lookup
+		r.source = ProviderIPAPI
+	case ProviderMaxMind:
+		logger.Warn("GeoIP lookups disabled: provider is maxmind but no database is available")
+	case ProviderNone:
+	default:
+		logger.Warn("Unknown GeoIP provider, lookups disabled", zap.String("provider", cfg.Provider))
+	}
+	return r
+}
+
+// Source returns the provider in use: maxmind, ip-api, or none.
+func (r *Resolver) Source() string {
+	return r.source
+}
+
+// Cached returns the cached location for an IP. The second result is false when
+// the IP needs a lookup; addresses that can't be located, such as private ones,
+// are reported as cached with an empty location.
+func (r *Resolver) Cached(ip string) (Location, bool) {
+	addr, ok := publicAddr(ip)
+	if !ok || r.lookup == nil {
+		return Location{}, true
+	}
+	return r.cache.get(addr)
+}
+
+// Lookup returns the location of an IP, from the cache if possible. Failed
+// lookups return an empty location and are not cached, so they're retried later.
+func (r *Resolver) Lookup(ctx context.Context, ip string) (Location, error) {
+	if loc, ok := r.Cached(ip); ok {
+		return loc, nil
+	}
+	addr, _ := publicAddr(ip)
+
+	loc, err := r.lookup(ctx, addr)
+	if err != nil {
+		return Location{}, err
+	}
+	r.cache.put(addr, loc)
+	return loc, nil
+}
+
+// publicAddr parses ip and reports whether it is a globally routable address
+// worth looking up.
+func publicAddr(ip string) (netip.Addr, bool) {
+	addr, err := netip.ParseAddr(strings.TrimSpace(ip))
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	addr = addr.Unmap().WithZone("")
+	if addr.IsPrivate() || addr.IsLoopback() || addr.IsLinkLocalUnicast() ||
+		addr.IsUnspecified() || addr.IsMulticast() || !addr.IsGlobalUnicast() {
+		return netip.Addr{}, false
+	}
+	return addr, true
+}
+
+// lookupLocation extracts a Location from a GeoLite2/GeoIP2 City or Country record.
+func (r *mmdbReader) lookupLocation(_ context.Context, addr netip.Addr) (Location, error) {
+	record, err := r.lookup(addr)
+	if err != nil || record == nil {
+		return Location{}, err
+	}
+	m, _ := record.(map[string]interface{})
+
+	var loc Location
+	country, _ := m["country"].(map[string]interface{})
+	loc.CountryCode, _ = country["iso_code"].(string)
+	loc.Country = englishName(country)
+	city, _ := m["city"].(map[string]interface{})
+	loc.City = englishName(city)
+	return loc, nil
+}
+
+func englishName(m map[string]interface{}) string {
+	names, _ := m["names"].(map[string]interface{})
+	name, _ := names["en"].(string)
+	return name
+}
+
+// ipAPIClient queries ip-api.com, staying under its free tier rate limit.
+type ipAPIClient struct {
+	httpClient *http.Client
+	baseURL    string
+
+	mu          sync.Mutex
+	windowStart time.Time
+	count       int
+}
+
+func newIPAPIClient() *ipAPIClient {
+	return &ipAPIClient{
+		httpClient: &http.Client{Timeout: 2 * time.Second},
+		baseURL:    "http://ip-api.com/json/",
+	}
+}
+
+// allow reports whether another request fits in the current one-minute window.
+func (c *ipAPIClient) allow() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(c.windowStart) >= time.Minute {
+		c.windowStart = now
+		c.count = 0
+	}
+	if c.count >= ipAPIRateLimit {
+		return false
+	}
+	c.count++
+	return true
+}
+
+func (c *ipAPIClient) lookup(ctx context.Context, addr netip.Addr) (Location, error) {
+	if !c.allow() {
+		return Location{}, errRateLimited
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+addr.String()+"?fields=status,country,countryCode,city", nil)
+	if err != nil {
+		return Location{}, err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return Location{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return Location{}, fmt.Errorf("ip-api.com returned status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Status      string `json:"status"`
+		Country     string `json:"country"`
+		CountryCode string `json:"countryCode"`
+		City        string `json:"city"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return Location{}, err
+	}
+	if result.Status != "" && result.Status != "success" {
+		// Reserved or unknown ranges; cache the empty result
+		return Location{}, nil
+	}
+	return Location{Country: result.Country, CountryCode: result.CountryCode, City: result.City}, nil
+}
+
+// lruCache is a fixed-size, concurrency-safe LRU cache of locations by IP.
+type lruCache struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	order   *list.List
+	entries map[netip.Addr]*list.Element
+}
+
+type cacheEntry struct {
+	addr    netip.Addr
+	loc     Location
+	expires time.Time
+}
+
+func newLRUCache(size int, ttl time.Duration) *lruCache {
+	if size <= 0 {
+		size = 10000
+	}
+	return &lruCache{
+		size:    size,
+		ttl:     ttl,
+		order:   list.New(),
+		entries: make(map[netip.Addr]*list.Element),
+	}
+}
+
+func (c *lruCache) get(addr netip.Addr) (Location, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[addr]
+	if !ok {
+		return Location{}, false
+	}
+	entry := el.Value.(*cacheEntry)
+	if !entry.expires.IsZero() && time.Now().After(entry.expires) {
+		c.order.Remove(el)
+		delete(c.entries, addr)
+		return Location{}, false
+	}
+	c.order.MoveToFront(el)
+	return entry.loc, true
+}
+
+func (c *lruCache) put(addr netip.Addr, loc Location) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var expires time.Time
+	if c.ttl > 0 {
+		expires = time.Now().Add(c.ttl)
+	}
+
+	if el, ok := c.entries[addr]; ok {
+		entry := el.Value.(*cacheEntry)
+		entry.loc = loc
+		entry.expires = expires
+		c.order.MoveToFront(el)
+		return
+	}
+
+	c.entries[addr] = c.order.PushFront(&cacheEntry{addr: addr, loc: loc, expires: expires})
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).addr)
+	}
+}
@@ -0,0 +1,127 @@
+package geoip
+
+import (
+	"bytes"
+	"context"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+// Minimal MaxMind DB encoder for building test databases
+func encString(s string) []byte {
+	return append([]byte{byte(mmdbString<<5 | len(s))}, s...)
+}
+
+func encUint16(n uint16) []byte {
+	return []byte{byte(mmdbUint16<<5 | 2), byte(n >> 8), byte(n)}
+}
+
+func encMap(pairs ...[]byte) []byte {
+	out := []byte{byte(mmdbMap<<5 | len(pairs)/2)}
+	for _, p := range pairs {
+		out = append(out, p...)
+	}
+	return out
+}
+
+// buildTestDB returns an IPv4 database with a single node: addresses in 0.0.0.0/1
+// map to New Zealand, the rest are not found.
+func buildTestDB() []byte {
+	data := encMap(
+		encString("city"), encMap(encString("names"), encMap(encString("en"), encString("Wellington"))),
+		encString("country"), encMap(
+			encString("iso_code"), encString("NZ"),
+			encString("names"), encMap(encString("en"), encString("New Zealand")),
+		),
+	)
+
+	const nodeCount = 1
+	left := nodeCount + 16 // data section offset 0
+	right := nodeCount     // not found
+	var buf bytes.Buffer
+	buf.Write([]byte{byte(left >> 16), byte(left >> 8), byte(left)})
+	buf.Write([]byte{byte(right >> 16), byte(right >> 8), byte(right)})
+	buf.Write(make([]byte, 16))
+	buf.Write(data)
+	buf.Write(metadataMarker)
+	buf.Write(encMap(
+		encString("node_count"), encUint16(nodeCount),
+		encString("record_size"), encUint16(24),
+		encString("ip_version"), encUint16(4),
+		encString("database_type"), encString("GeoLite2-City"),
+	))
+	return buf.Bytes()
+}
+
+func TestMaxMindLookup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.mmdb")
+	if err := os.WriteFile(path, buildTestDB(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	r := New(Config{Provider: ProviderMaxMind, DatabasePath: path}, zap.NewNop())
+	if r.Source() != ProviderMaxMind {
+		t.Fatalf("source = %q, want maxmind", r.Source())
+	}
+
+	loc, err := r.Lookup(context.Background(), "8.8.8.8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Location{Country: "New Zealand", CountryCode: "NZ", City: "Wellington"}
+	if loc != want {
+		t.Errorf("Lookup(8.8.8.8) = %+v, want %+v", loc, want)
+	}
+	if cached, ok := r.Cached("8.8.8.8"); !ok || cached != want {
+		t.Errorf("Cached(8.8.8.8) = %+v, %v; want cached result", cached, ok)
+	}
+
+	loc, err = r.Lookup(context.Background(), "200.1.1.1")
+	if err != nil || !loc.IsZero() {
+		t.Errorf("Lookup(200.1.1.1) = %+v, %v; want empty location", loc, err)
+	}
+}
+
+func TestMaxMindMissingDatabaseDisablesLookups(t *testing.T) {
+	r := New(Config{Provider: ProviderMaxMind, DatabasePath: "/nonexistent.mmdb"}, zap.NewNop())
+	if r.Source() != ProviderNone {
+		t.Fatalf("source = %q, want none", r.Source())
+	}
+	if loc, ok := r.Cached("8.8.8.8"); !ok || !loc.IsZero() {
+		t.Errorf("Cached = %+v, %v; want empty cached result", loc, ok)
+	}
+}
+
+func TestPrivateAddressesSkipped(t *testing.T) {
+	for _, ip := range []string{"10.1.2.3", "172.20.0.1", "192.168.1.1", "127.0.0.1", "::1", "fe80::1", "localhost"} {
+		if _, ok := publicAddr(ip); ok {
+			t.Errorf("publicAddr(%q) = true, want false", ip)
+		}
+	}
+	if _, ok := publicAddr("172.2.0.1"); !ok {
+		t.Error("publicAddr(172.2.0.1) = false, want true")
+	}
+}
+
+func TestLRUCacheEviction(t *testing.T) {
+	c := newLRUCache(2, 0)
+	a := netip.MustParseAddr("1.1.1.1")
+	b := netip.MustParseAddr("2.2.2.2")
+	d := netip.MustParseAddr("3.3.3.3")
+
+	c.put(a, Location{City: "a"})
+	c.put(b, Location{City: "b"})
+	c.get(a) // a is now most recently used
+	c.put(d, Location{City: "d"})
+
+	if _, ok := c.get(b); ok {
+		t.Error("expected least recently used entry to be evicted")
+	}
+	if _, ok := c.get(a); !ok {
+		t.Error("expected recently used entry to be kept")
+	}
+}
@@ -0,0 +1,342 @@
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net/netip"
+	"os"
+)
+
+// metadataMarker precedes the metadata map at the end of a MaxMind DB file.
+var metadataMarker = []byte("\xab\xcd\xefMaxMind.com")
+
+// errInvalidDatabase is returned for MaxMind DB files that can't be decoded.
+var errInvalidDatabase = errors.New("invalid MaxMind database")
+
+// mmdbReader is a minimal reader for the MaxMind DB format used by the GeoLite2
+// and GeoIP2 databases. It loads the whole file into memory and supports only
+// what a lookup needs: the search tree and the data section decoder.
+type mmdbReader struct {
+	buf        []byte
+	nodeCount  uint
+	recordSize uint
+	ipVersion  uint
+	dbType     string
+	treeSize   uint
+	data       []byte
+	ipv4Start  uint
+}
+
+// openMMDB reads and validates a MaxMind DB file.
+func openMMDB(path string) (*mmdbReader, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return newMMDBReader(buf)
+}
+
+func newMMDBReader(buf []byte) (*mmdbReader, error) {
+	idx := bytes.LastIndex(buf, metadataMarker)
+	if idx < 0 {
+		return nil, fmt.Errorf("%w: metadata not found", errInvalidDatabase)
+	}
+	metaStart := idx + len(metadataMarker)
+	meta, _, err := (&mmdbDecoder{buf: buf[metaStart:]}).decode(0)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidDatabase, err)
+	}
+	metadata, ok := meta.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%w: metadata is not a map", errInvalidDatabase)
+	}
+
+	r := &mmdbReader{buf: buf}
+	r.nodeCount = uint(asUint(metadata["node_count"]))
+	r.recordSize = uint(asUint(metadata["record_size"]))
+	r.ipVersion = uint(asUint(metadata["ip_version"]))
+	r.dbType, _ = metadata["database_type"].(string)
+
+	switch r.recordSize {
+	case 24, 28, 32:
+	default:
+		return nil, fmt.Errorf("%w: unsupported record size %d", errInvalidDatabase, r.recordSize)
+	}
+	if r.ipVersion != 4 && r.ipVersion != 6 {
+		return nil, fmt.Errorf("%w: unsupported IP version %d", errInvalidDatabase, r.ipVersion)
+	}
+
+	r.treeSize = r.nodeCount * r.recordSize / 4
+	// The search tree is followed by 16 zero bytes, then the data section
+	if r.treeSize+16 > uint(idx) {
+		return nil, fmt.Errorf("%w: search tree exceeds file size", errInvalidDatabase)
+	}
+	r.data = buf[r.treeSize+16 : idx]
+
+	// IPv4 addresses live under ::/96 in an IPv6 tree
+	if r.ipVersion == 6 {
+		node := uint(0)
+		for i := 0; i < 96 && node < r.nodeCount; i++ {
+			node = r.readRecord(node, 0)
+		}
+		r.ipv4Start = node
+	}
+
+	return r, nil
+}
+
+// lookup returns the decoded record for an address, or nil if it isn't in the
+// database.
+func (r *mmdbReader) lookup(addr netip.Addr) (interface{}, error) {
+	addr = addr.Unmap()
+
+	var ip []byte
+	node := uint(0)
+	if addr.Is4() {
+		b := addr.As4()
+		ip = b[:]
+		if r.ipVersion == 6 {
+			node = r.ipv4Start
+		}
+	} else {
+		if r.ipVersion == 4 {
+			return nil, nil
+		}
+		b := addr.As16()
+		ip = b[:]
+	}
+
+	for i := 0; i < len(ip)*8 && node < r.nodeCount; i++ {
+		bit := (ip[i/8] >> (7 - uint(i%8))) & 1
+		node = r.readRecord(node, uint(bit))
+	}
+
+	if node == r.nodeCount {
+		return nil, nil
+	}
+	if node < r.nodeCount {
+		return nil, fmt.Errorf("%w: search tree too deep", errInvalidDatabase)
+	}
+
+	offset := node - r.nodeCount - 16
+	if offset >= uint(len(r.data)) {
+		return nil, fmt.Errorf("%w: data pointer out of range", errInvalidDatabase)
+	}
+	value, _, err := (&mmdbDecoder{buf: r.data}).decode(offset)
+	return value, err
+}
+
+// readRecord returns the left (bit 0) or right (bit 1) record of a node.
+func (r *mmdbReader) readRecord(node, bit uint) uint {
+	nodeBytes := r.recordSize / 4
+	b := r.buf[node*nodeBytes : (node+1)*nodeBytes]
+
+	switch r.recordSize {
+	case 24:
+		b = b[bit*3:]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		if bit == 0 {
+			return uint(b[3]&0xF0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0F)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		return uint(binary.BigEndian.Uint32(b[bit*4:]))
+	}
+}
+
+// MaxMind DB data section types
+const (
+	mmdbExtended = iota
+	mmdbPointer
+	mmdbString
+	mmdbDouble
+	mmdbBytes
+	mmdbUint16
+	mmdbUint32
+	mmdbMap
+	mmdbInt32
+	mmdbUint64
+	mmdbUint128
+	mmdbArray
+	mmdbContainer
+	mmdbEndMarker
+	mmdbBool
+	mmdbFloat
+)
+
+// mmdbDecoder decodes values from a MaxMind DB data section.
+type mmdbDecoder struct {
+	buf []byte
+}
+
+// decode decodes the value at offset and returns it along with the offset just
+// past it. Maps decode to map[string]interface{}, arrays to []interface{},
+// unsigned integers to uint64 and signed ones to int64.
+func (d *mmdbDecoder) decode(offset uint) (interface{}, uint, error) {
+	typ, size, offset, err := d.decodeControl(offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if typ == mmdbPointer {
+		target, next, err := d.decodePointer(size, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		value, _, err := d.decode(target)
+		return value, next, err
+	}
+
+	return d.decodeValue(typ, size, offset)
+}
+
+func (d *mmdbDecoder) decodeControl(offset uint) (typ int, size uint, next uint, err error) {
+	if offset >= uint(len(d.buf)) {
+		return 0, 0, 0, errInvalidDatabase
+	}
+	ctrl := d.buf[offset]
+	offset++
+
+	typ = int(ctrl >> 5)
+	if typ == mmdbExtended {
+		if offset >= uint(len(d.buf)) {
+			return 0, 0, 0, errInvalidDatabase
+		}
+		typ = 7 + int(d.buf[offset])
+		offset++
+	}
+
+	size = uint(ctrl & 0x1f)
+	if typ == mmdbPointer || size < 29 {
+		return typ, size, offset, nil
+	}
+
+	extra := size - 28
+	if offset+extra > uint(len(d.buf)) {
+		return 0, 0, 0, errInvalidDatabase
+	}
+	n := uint(0)
+	for _, b := range d.buf[offset : offset+extra] {
+		n = n<<8 | uint(b)
+	}
+	switch extra {
+	case 1:
+		size = 29 + n
+	case 2:
+		size = 285 + n
+	default:
+		size = 65821 + n
+	}
+	return typ, size, offset + extra, nil
+}
+
+func (d *mmdbDecoder) decodePointer(ctrlSize, offset uint) (target, next uint, err error) {
+	pointerSize := ((ctrlSize >> 3) & 0x3) + 1
+	if offset+pointerSize > uint(len(d.buf)) {
+		return 0, 0, errInvalidDatabase
+	}
+	b := d.buf[offset : offset+pointerSize]
+	next = offset + pointerSize
+
+	n := uint(0)
+	for _, v := range b {
+		n = n<<8 | uint(v)
+	}
+	switch pointerSize {
+	case 1:
+		target = (ctrlSize&0x7)<<8 | n
+	case 2:
+		target = ((ctrlSize&0x7)<<16 | n) + 2048
+	case 3:
+		target = ((ctrlSize&0x7)<<24 | n) + 526336
+	default:
+		target = n
+	}
+	return target, next, nil
+}
+
+func (d *mmdbDecoder) decodeValue(typ int, size, offset uint) (interface{}, uint, error) {
+	switch typ {
+	case mmdbMap:
+		m := make(map[string]interface{}, size)
+		for i := uint(0); i < size; i++ {
+			key, next, err := d.decode(offset)
+			if err != nil {
+				return nil, 0, err
+			}
+			k, ok := key.(string)
+			if !ok {
+				return nil, 0, fmt.Errorf("%w: map key is not a string", errInvalidDatabase)
+			}
+			value, next, err := d.decode(next)
+			if err != nil {
+				return nil, 0, err
+			}
+			m[k] = value
+			offset = next
+		}
+		return m, offset, nil
+	case mmdbArray:
+		a := make([]interface{}, 0, size)
+		for i := uint(0); i < size; i++ {
+			value, next, err := d.decode(offset)
+			if err != nil {
+				return nil, 0, err
+			}
+			a = append(a, value)
+			offset = next
+		}
+		return a, offset, nil
+	case mmdbBool:
+		return size != 0, offset, nil
+	}
+
+	if offset+size > uint(len(d.buf)) {
+		return nil, 0, errInvalidDatabase
+	}
+	b := d.buf[offset : offset+size]
+	next := offset + size
+
+	switch typ {
+	case mmdbString:
+		return string(b), next, nil
+	case mmdbBytes:
+		return append([]byte{}, b...), next, nil
+	case mmdbDouble:
+		if size != 8 {
+			return nil, 0, errInvalidDatabase
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), next, nil
+	case mmdbFloat:
+		if size != 4 {
+			return nil, 0, errInvalidDatabase
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), next, nil
+	case mmdbUint16, mmdbUint32, mmdbUint64:
+		n := uint64(0)
+		for _, v := range b {
+			n = n<<8 | uint64(v)
+		}
+		return n, next, nil
+	case mmdbInt32:
+		n := uint32(0)
+		for _, v := range b {
+			n = n<<8 | uint32(v)
+		}
+		return int64(int32(n)), next, nil
+	case mmdbUint128:
+		// Not used by the geolocation databases; keep the raw bytes
+		return append([]byte{}, b...), next, nil
+	}
+
+	return nil, 0, fmt.Errorf("%w: unsupported data type %d", errInvalidDatabase, typ)
+}
+
+func asUint(v interface{}) uint64 {
+	n, _ := v.(uint64)
+	return n
+}
@@ -0,0 +1,367 @@
+// Package ldap authenticates users against an LDAP directory or Active Directory.
+//
+// Users are found with a search as a service account and then authenticated by
+// binding as their own DN. Group membership is read from an attribute on the user
+// entry (memberOf on Active Directory) or found with a separate group search.
+package ldap
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	goldap "github.com/go-ldap/ldap/v3"
+)
+
+// ErrInvalidCredentials is returned when the user doesn't exist or the password
+// is wrong. The two aren't distinguished so usernames can't be probed.
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// Default search settings, matching Active Directory.
+const (
+	DefaultUserFilter     = "(&(objectClass=person)(|(sAMAccountName={username})(uid={username})(mail={username})))"
+	DefaultGroupAttribute = "memberOf"
+	DefaultEmailAttribute = "mail"
+	DefaultNameAttribute  = "displayName"
+	DefaultPoolSize       = 4
+	DefaultTimeout        = 10 * time.Second
+)
+
+// Config configures a Client.
+type Config struct {
+	URL          string // ldap:// or ldaps://
+	BindDN       string // Service account used to search for users
+	BindPassword string
+	BaseDN       string
+	// UserFilter finds the user logging in; {username} is replaced with the
+	// escaped username.
+	UserFilter string
+	// GroupFilter, if set, searches for the user's groups; {dn} and {username}
+	// are replaced with the escaped user DN and username. Otherwise groups are
+	// read from GroupAttribute on the user entry.
+	GroupFilter        string
+	GroupAttribute     string
+	EmailAttribute     string
+	NameAttribute      string
+	StartTLS           bool   // Upgrade ldap:// connections with StartTLS
+	InsecureSkipVerify bool   // Skip server certificate verification (testing only)
+	CACert             string // PEM CA bundle for the server certificate; system roots if empty
+	PoolSize           int    // Service account connections kept open
+	Timeout            time.Duration
+}
+
+// User is an authenticated directory user.
+type User struct {
+	DN       string
+	Username string
+	Email    string
+	Name     string
+	Groups   []string
+}
+
+// Client authenticates users against a directory. Connections bound as the
+// service account are pooled and reused across logins.
+type Client struct {
+	cfg       Config
+	tlsConfig *tls.Config
+	pool      chan *goldap.Conn
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// New creates a Client. No connection is made until the first login.
+func New(cfg Config) (*Client, error) {
+	if cfg.URL == "" || cfg.BaseDN == "" {
+		return nil, fmt.Errorf("url and base_dn are required")
+	}
+	if !strings.HasPrefix(cfg.URL, "ldap://") && !strings.HasPrefix(cfg.URL, "ldaps://") {
+		return nil, fmt.Errorf("url must start with ldap:// or ldaps://")
+	}
+	if cfg.UserFilter == "" {
+		cfg.UserFilter = DefaultUserFilter
+	}
+	if !strings.Contains(cfg.UserFilter, "{username}") {
+		return nil, fmt.Errorf("user_filter must contain {username}")
+	}
+	if cfg.GroupAttribute == "" {
+		cfg.GroupAttribute = DefaultGroupAttribute
+	}
+	if cfg.EmailAttribute == "" {
+		cfg.EmailAttribute = DefaultEmailAttribute
+	}
+	if cfg.NameAttribute == "" {
+		cfg.NameAttribute = DefaultNameAttribute
+	}
+	if cfg.PoolSize <= 0 {
+		cfg.PoolSize = DefaultPoolSize
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: cfg.InsecureSkipVerify, // #nosec G402 -- opt-in for test directories
+	}
+	if host, err := hostFromURL(cfg.URL); err == nil {
+		tlsConfig.ServerName = host
+	}
+	if cfg.CACert != "" {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM([]byte(cfg.CACert)) {
+			return nil, fmt.Errorf("ca_cert contains no valid certificates")
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	return &Client{
+		cfg:       cfg,
+		tlsConfig: tlsConfig,
+		pool:      make(chan *goldap.Conn, cfg.PoolSize),
+	}, nil
+}
+
+// Close closes all pooled connections.
+func (c *Client) Close() {
+	c.mu.Lock()
+	c.closed = true
+	c.mu.Unlock()
+
+	for {
+		select {
+		case conn := <-c.pool:
+			conn.Close()
+		default:
+			return
+		}
+	}
+}
+
+// Authenticate checks a username and password and returns the user's details
+// and groups.
+func (c *Client) Authenticate(ctx context.Context, username, password string) (*User, error) {
+	// An empty password would be an unauthenticated bind, which most servers accept
+	if username == "" || password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	conn, err := c.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := c.findUser(conn, username)
+	if err != nil {
+		c.release(conn, err)
+		return nil, err
+	}
+	if user.Groups == nil && c.cfg.GroupFilter != "" {
+		user.Groups, err = c.searchGroups(conn, user)
+		if err != nil {
+			c.release(conn, err)
+			return nil, err
+		}
+	}
+	c.release(conn, nil)
+
+	// Bind as the user on a separate connection so pooled ones stay bound as the
+	// service account
+	userConn, err := c.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer userConn.Close()
+	if err := userConn.Bind(user.DN, password); err != nil {
+		if goldap.IsErrorWithCode(err, goldap.LDAPResultInvalidCredentials) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("user bind failed: %w", err)
+	}
+
+	return user, nil
+}
+
+// Test checks that the server is reachable and the service account can bind and
+// search the base DN.
+func (c *Client) Test(ctx context.Context) error {
+	conn, err := c.get(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = conn.Search(goldap.NewSearchRequest(
+		c.cfg.BaseDN, goldap.ScopeBaseObject, goldap.NeverDerefAliases, 1, int(c.cfg.Timeout.Seconds()), false,
+		"(objectClass=*)", []string{"dn"}, nil,
+	))
+	c.release(conn, err)
+	if err != nil {
+		return fmt.Errorf("failed to search base DN: %w", err)
+	}
+	return nil
+}
+
+func (c *Client) findUser(conn *goldap.Conn, username string) (*User, error) {
+	filter := strings.ReplaceAll(c.cfg.UserFilter, "{username}", goldap.EscapeFilter(username))
+	attrs := []string{c.cfg.EmailAttribute, c.cfg.NameAttribute, "cn"}
+	if c.cfg.GroupFilter == "" {
+		attrs = append(attrs, c.cfg.GroupAttribute)
+	}
+
+	result, err := conn.Search(goldap.NewSearchRequest(
+		c.cfg.BaseDN, goldap.ScopeWholeSubtree, goldap.NeverDerefAliases, 2, int(c.cfg.Timeout.Seconds()), false,
+		filter, attrs, nil,
+	))
+	if err != nil && !goldap.IsErrorWithCode(err, goldap.LDAPResultSizeLimitExceeded) {
+		return nil, fmt.Errorf("user search failed: %w", err)
+	}
+	// No match, or an ambiguous filter matching more than one entry
+	if result == nil || len(result.Entries) != 1 {
+		return nil, ErrInvalidCredentials
+	}
+
+	entry := result.Entries[0]
+	user := &User{
+		DN:       entry.DN,
+		Username: username,
+		Email:    entry.GetAttributeValue(c.cfg.EmailAttribute),
+		Name:     entry.GetAttributeValue(c.cfg.NameAttribute),
+	}
+	if user.Name == "" {
+		user.Name = entry.GetAttributeValue("cn")
+	}
+	if c.cfg.GroupFilter == "" {
+		user.Groups = groupNames(entry.GetAttributeValues(c.cfg.GroupAttribute))
+	}
+	return user, nil
+}
+
+func (c *Client) searchGroups(conn *goldap.Conn, user *User) ([]string, error) {
+	filter := strings.NewReplacer(
+		"{dn}", goldap.EscapeFilter(user.DN),
+		"{username}", goldap.EscapeFilter(user.Username),
+	).Replace(c.cfg.GroupFilter)
+
+	result, err := conn.Search(goldap.NewSearchRequest(
+		c.cfg.BaseDN, goldap.ScopeWholeSubtree, goldap.NeverDerefAliases, 0, int(c.cfg.Timeout.Seconds()), false,
+		filter, []string{"cn"}, nil,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("group search failed: %w", err)
+	}
+
+	groups := make([]string, 0, len(result.Entries))
+	for _, entry := range result.Entries {
+		if cn := entry.GetAttributeValue("cn"); cn != "" {
+			groups = append(groups, cn)
+		}
+	}
+	return groups, nil
+}
+
+// groupNames turns group DNs, as found in memberOf, into their common names.
+// Values that aren't DNs are kept as they are.
+func groupNames(values []string) []string {
+	groups := make([]string, 0, len(values))
+	for _, value := range values {
+		dn, err := goldap.ParseDN(value)
+		if err != nil || len(dn.RDNs) == 0 || len(dn.RDNs[0].Attributes) == 0 {
+			groups = append(groups, value)
+			continue
+		}
+		groups = append(groups, dn.RDNs[0].Attributes[0].Value)
+	}
+	return groups
+}
+
+// get returns a pooled service account connection, or opens and binds a new one.
+func (c *Client) get(ctx context.Context) (*goldap.Conn, error) {
+	for pooled := true; pooled; {
+		select {
+		case conn := <-c.pool:
+			if !conn.IsClosing() {
+				return conn, nil
+			}
+			conn.Close()
+		default:
+			pooled = false
+		}
+	}
+
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if c.cfg.BindDN != "" {
+		err = conn.Bind(c.cfg.BindDN, c.cfg.BindPassword)
+	} else {
+		err = conn.UnauthenticatedBind("")
+	}
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("service account bind failed: %w", err)
+	}
+	return conn, nil
+}
+
+// release returns a connection to the pool, or closes it if the operation failed
+// with something other than an LDAP result (a broken connection) or the pool is full.
+func (c *Client) release(conn *goldap.Conn, opErr error) {
+	var ldapErr *goldap.Error
+	if opErr != nil && !errors.Is(opErr, ErrInvalidCredentials) && (!errors.As(opErr, &ldapErr) || ldapErr.ResultCode >= goldap.ErrorNetwork) {
+		conn.Close()
+		return
+	}
+
+	c.mu.Lock()
+	closed := c.closed
+	c.mu.Unlock()
+	if closed {
+		conn.Close()
+		return
+	}
+
+	select {
+	case c.pool <- conn:
+	default:
+		conn.Close()
+	}
+}
+
+func (c *Client) dial(ctx context.Context) (*goldap.Conn, error) {
+	dialer := &net.Dialer{Timeout: c.cfg.Timeout}
+	if deadline, ok := ctx.Deadline(); ok {
+		dialer.Deadline = deadline
+	}
+
+	conn, err := goldap.DialURL(c.cfg.URL, goldap.DialWithDialer(dialer), goldap.DialWithTLSConfig(c.tlsConfig))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", c.cfg.URL, err)
+	}
+	conn.SetTimeout(c.cfg.Timeout)
+
+	if c.cfg.StartTLS && strings.HasPrefix(c.cfg.URL, "ldap://") {
+		if err := conn.StartTLS(c.tlsConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("StartTLS failed: %w", err)
+		}
+	}
+	return conn, nil
+}
+
+func hostFromURL(raw string) (string, error) {
+	rest := raw[strings.Index(raw, "://")+3:]
+	if i := strings.IndexAny(rest, "/?"); i >= 0 {
+		rest = rest[:i]
+	}
+	host, _, err := net.SplitHostPort(rest)
+	if err != nil {
+		return rest, nil
+	}
+	return host, nil
+}
@@ -0,0 +1,39 @@
+package ldap
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGroupNames(t *testing.T) {
+	got := groupNames([]string{
+		"CN=VPN Users,OU=Groups,DC=example,DC=com",
+		"cn=admins,ou=groups,dc=example,dc=com",
+		"developers",
+	})
+	want := []string{"VPN Users", "admins", "developers"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("groupNames = %v, want %v", got, want)
+	}
+}
+
+func TestNewValidatesConfig(t *testing.T) {
+	for _, cfg := range []Config{
+		{BaseDN: "dc=example,dc=com"},
+		{URL: "ldap://dc.example.com"},
+		{URL: "http://dc.example.com", BaseDN: "dc=example,dc=com"},
+		{URL: "ldap://dc.example.com", BaseDN: "dc=example,dc=com", UserFilter: "(uid=alice)"},
+	} {
+		if _, err := New(cfg); err == nil {
+			t.Errorf("New(%+v) succeeded, want error", cfg)
+		}
+	}
+
+	c, err := New(Config{URL: "ldaps://dc.example.com:636", BaseDN: "dc=example,dc=com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.cfg.UserFilter != DefaultUserFilter || c.tlsConfig.ServerName != "dc.example.com" {
+		t.Errorf("defaults not applied: filter %q, server name %q", c.cfg.UserFilter, c.tlsConfig.ServerName)
+	}
+}
@@ -0,0 +1,182 @@
+// Package mail sends notification email over SMTP.
+package mail
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TLS modes for Config.TLS.
+const (
+	TLSStartTLS = "starttls" // Plain connection upgraded with STARTTLS (port 587)
+	TLSImplicit = "tls"      // TLS from the start (port 465)
+	TLSNone     = "none"     // No encryption; only for local relays
+)
+
+// ErrNotConfigured is returned by senders when no SMTP server is configured.
+var ErrNotConfigured = errors.New("email is not configured")
+
+// Config holds SMTP settings.
+type Config struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+	TLS      string
+	Timeout  time.Duration
+}
+
+// Message is a plain text email.
+type Message struct {
+	To      []string
+	Subject string
+	Body    string
+}
+
+// Sender sends email.
+type Sender interface {
+	Send(ctx context.Context, msg *Message) error
+}
+
+// New returns a Sender for cfg. Without a host, the sender returns
+// ErrNotConfigured so callers can tell users email isn't available.
+func New(cfg Config) Sender {
+	if cfg.Host == "" {
+		return disabledSender{}
+	}
+	if cfg.Port == 0 {
+		cfg.Port = 587
+	}
+	if cfg.TLS == "" {
+		cfg.TLS = TLSStartTLS
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	return &smtpSender{cfg: cfg}
+}
+
+// Enabled reports whether s actually delivers email.
+func Enabled(s Sender) bool {
+	_, disabled := s.(disabledSender)
+	return s != nil && !disabled
+}
+
+type disabledSender struct{}
+
+func (disabledSender) Send(context.Context, *Message) error {
+	return ErrNotConfigured
+}
+
+type smtpSender struct {
+	cfg Config
+}
+
+func (s *smtpSender) Send(ctx context.Context, msg *Message) error {
+	from, err := mail.ParseAddress(s.cfg.From)
+	if err != nil {
+		return fmt.Errorf("invalid from address %q: %w", s.cfg.From, err)
+	}
+	to := make([]string, 0, len(msg.To))
+	for _, addr := range msg.To {
+		parsed, err := mail.ParseAddress(addr)
+		if err != nil {
+			return fmt.Errorf("invalid recipient %q: %w", addr, err)
+		}
+		to = append(to, parsed.Address)
+	}
+	if len(to) == 0 {
+		return fmt.Errorf("no recipients")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.Timeout)
+	defer cancel()
+
+	addr := net.JoinHostPort(s.cfg.Host, strconv.Itoa(s.cfg.Port))
+	tlsConfig := &tls.Config{ServerName: s.cfg.Host, MinVersion: tls.VersionTLS12}
+
+	var conn net.Conn
+	dialer := &net.Dialer{}
+	if s.cfg.TLS == TLSImplicit {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: tlsConfig}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", addr, err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, s.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("SMTP handshake failed: %w", err)
+	}
+	defer client.Close()
+
+	if s.cfg.TLS == TLSStartTLS {
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("STARTTLS failed: %w", err)
+		}
+	}
+	if s.cfg.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", s.cfg.Username, s.cfg.Password, s.cfg.Host)); err != nil {
+			return fmt.Errorf("SMTP authentication failed: %w", err)
+		}
+	}
+
+	if err := client.Mail(from.Address); err != nil {
+		return err
+	}
+	for _, rcpt := range to {
+		if err := client.Rcpt(rcpt); err != nil {
+			return err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(buildMessage(from, to, msg, time.Now())); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// buildMessage renders the headers and body of a message. Header values are
+// stripped of line breaks so user input can't inject headers.
+func buildMessage(from *mail.Address, to []string, msg *Message, now time.Time) []byte {
+	var buf bytes.Buffer
+	header := func(name, value string) {
+		value = strings.NewReplacer("\r", "", "\n", "").Replace(value)
+		fmt.Fprintf(&buf, "%s: %s\r\n", name, value)
+	}
+	header("From", from.String())
+	header("To", strings.Join(to, ", "))
+	header("Subject", mime.QEncoding.Encode("utf-8", msg.Subject))
+	header("Date", now.Format(time.RFC1123Z))
+	header("MIME-Version", "1.0")
+	header("Content-Type", "text/plain; charset=utf-8")
+	header("Content-Transfer-Encoding", "8bit")
+	buf.WriteString("\r\n")
+
+	body := strings.ReplaceAll(msg.Body, "\r\n", "\n")
+	buf.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	return buf.Bytes()
+}
@@ -0,0 +1,35 @@
+package mail
+
+import (
+	"context"
+	"errors"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuildMessageStripsHeaderInjection(t *testing.T) {
+	from := &mail.Address{Name: "GateKey", Address: "gatekey@example.com"}
+	msg := &Message{Subject: "Hello\r\nBcc: attacker@example.com", Body: "line one\nline two"}
+
+	out := string(buildMessage(from, []string{"user@example.com"}, msg, time.Unix(0, 0)))
+	header, body, _ := strings.Cut(out, "\r\n\r\n")
+
+	if strings.Contains(header, "\r\nBcc:") {
+		t.Errorf("subject injected a header:\n%s", header)
+	}
+	if body != "line one\r\nline two" {
+		t.Errorf("body = %q", body)
+	}
+}
+
+func TestDisabledSender(t *testing.T) {
+	s := New(Config{})
+	if Enabled(s) {
+		t.Error("sender without a host should be disabled")
+	}
+	if err := s.Send(context.Background(), &Message{To: []string{"a@example.com"}}); !errors.Is(err, ErrNotConfigured) {
+		t.Errorf("Send = %v, want ErrNotConfigured", err)
+	}
+}
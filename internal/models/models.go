@@ -82,6 +82,18 @@ type Policy struct {
 	CreatedAt   time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
 	CreatedBy   uuid.UUID `json:"created_by" db:"created_by"`
+
+	Constraints *PolicyConstraints `json:"constraints,omitempty" db:"constraints"`
+}
+
+// PolicyConstraints are connection settings a policy sets for its subjects. Zero
+// values leave the setting to other policies and the system-wide defaults.
+type PolicyConstraints struct {
+	Subject           PolicySubject `json:"subject"`                       // Who the constraints apply to
+	CertValidityHours int           `json:"cert_validity_hours,omitempty"` // Maximum client certificate validity
+	TimeWindows       []TimeWindow  `json:"time_windows,omitempty"`        // When subjects may connect
+	MaxSessions       int           `json:"max_sessions,omitempty"`        // Concurrent VPN sessions across gateways
+	CryptoProfile     string        `json:"crypto_profile,omitempty"`      // Weakest crypto profile subjects may use
 }
 
 // PolicyRule represents a single rule within a policy.
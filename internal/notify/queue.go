@@ -0,0 +1,281 @@
+// Package notify delivers email and other notifications in the background.
+//
+// Request handlers only record a notification; a pool of workers delivers it
+// later, so a slow or unreachable destination never adds to login or connect
+// latency. Notifications are stored (in the database, in production) until they
+// are delivered, and a delivery cut short by a crash is tried again once its lease
+// runs out, so delivery is at least once: handlers must tolerate duplicates.
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ErrQueueFull is returned by Enqueue when MaxPending notifications are already
+// waiting. Callers drop the notification rather than wait.
+var ErrQueueFull = errors.New("notification queue is full")
+
+// pollInterval is how often workers look for due notifications when nothing was
+// enqueued on this server; a variable so tests can shorten it.
+var pollInterval = 2 * time.Second
+
+const (
+	// maxBackoff caps the wait between delivery attempts.
+	maxBackoff = time.Hour
+	// failedRetention is how long notifications that ran out of attempts are kept.
+	failedRetention = 7 * 24 * time.Hour
+)
+
+// Job is a notification claimed for delivery.
+type Job struct {
+	ID       string
+	Kind     string
+	Payload  []byte
+	Attempts int // Including this one
+}
+
+// Store persists queued notifications.
+type Store interface {
+	Enqueue(ctx context.Context, kind string, payload []byte, maxAttempts int) error
+	// Claim leases up to limit due jobs and counts an attempt for each.
+	Claim(ctx context.Context, limit int, lease time.Duration) ([]Job, error)
+	Complete(ctx context.Context, id string) error
+	Retry(ctx context.Context, id string, at time.Time, lastError string) error
+	Fail(ctx context.Context, id string, lastError string) error
+	Count(ctx context.Context) (pending, failed int64, err error)
+	PurgeFailed(ctx context.Context, before time.Time) (int64, error)
+}
+
+// Handler delivers one kind of notification. It must give up when ctx is done.
+type Handler func(ctx context.Context, payload []byte) error
+
+// Config tunes a Queue. Zero values use the defaults.
+type Config struct {
+	Workers         int           // Concurrent deliveries (default 4)
+	MaxPending      int           // Waiting notifications at which Enqueue refuses more (default 10000)
+	MaxAttempts     int           // Attempts before a notification is given up on (default 8)
+	DeliveryTimeout time.Duration // Limit on one delivery attempt (default 30s)
+}
+
+// Stats describes the queue. Pending and Failed are across all servers; the
+// counters are this server's since it started.
+type Stats struct {
+	Pending   int64  `json:"pending"`
+	Failed    int64  `json:"failed"` // Ran out of attempts, kept for failedRetention
+	Delivered uint64 `json:"delivered"`
+	Retried   uint64 `json:"retried"` // Failed attempts that will be tried again
+	GaveUp    uint64 `json:"gaveUp"`  // Notifications that ran out of attempts
+	Dropped   uint64 `json:"dropped"` // Refused because the queue was full
+}
+
+// Queue records notifications and delivers them with a bounded pool of workers.
+type Queue struct {
+	store  Store
+	cfg    Config
+	logger *zap.Logger
+
+	mu       sync.RWMutex
+	handlers map[string]Handler
+
+	wake    chan struct{}
+	pending atomic.Int64 // Last known depth, so Enqueue doesn't count rows
+
+	delivered, retried, gaveUp, dropped atomic.Uint64
+}
+
+// New returns a queue backed by store. Call Run to start delivering.
+func New(store Store, cfg Config, logger *zap.Logger) *Queue {
+	if cfg.Workers <= 0 {
+		cfg.Workers = 4
+	}
+	if cfg.MaxPending <= 0 {
+		cfg.MaxPending = 10000
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 8
+	}
+	if cfg.DeliveryTimeout <= 0 {
+		cfg.DeliveryTimeout = 30 * time.Second
+	}
+	return &Queue{
+		store:    store,
+		cfg:      cfg,
+		logger:   logger,
+		handlers: make(map[string]Handler),
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+// Handle registers the handler that delivers kind.
+func (q *Queue) Handle(kind string, h Handler) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.handlers[kind] = h
+}
+
+func (q *Queue) handler(kind string) Handler {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	return q.handlers[kind]
+}
+
+// Enqueue records a notification of kind with v, encoded as JSON, as its payload.
+// It never waits for delivery, and returns ErrQueueFull instead of growing the
+// queue past MaxPending.
+func (q *Queue) Enqueue(ctx context.Context, kind string, v any) error {
+	if q.handler(kind) == nil {
+		return fmt.Errorf("no handler for %s notifications", kind)
+	}
+	if q.pending.Load() >= int64(q.cfg.MaxPending) {
+		q.dropped.Add(1)
+		return ErrQueueFull
+	}
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s notification: %w", kind, err)
+	}
+	if err := q.store.Enqueue(ctx, kind, payload, q.cfg.MaxAttempts); err != nil {
+		return err
+	}
+	q.pending.Add(1)
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Stats returns the queue's depth and delivery counters.
+func (q *Queue) Stats(ctx context.Context) (Stats, error) {
+	pending, failed, err := q.store.Count(ctx)
+	if err != nil {
+		return Stats{}, err
+	}
+	q.pending.Store(pending)
+	return Stats{
+		Pending:   pending,
+		Failed:    failed,
+		Delivered: q.delivered.Load(),
+		Retried:   q.retried.Load(),
+		GaveUp:    q.gaveUp.Load(),
+		Dropped:   q.dropped.Load(),
+	}, nil
+}
+
+// Run delivers notifications until ctx is done. Deliveries in flight when it
+// returns are left leased and tried again once the lease runs out.
+func (q *Queue) Run(ctx context.Context) {
+	q.logger.Info("Started notification delivery background task", zap.Int("workers", q.cfg.Workers))
+
+	// A lease outlasts any delivery attempt, so it only runs out when the server
+	// holding it is gone
+	lease := 2 * q.cfg.DeliveryTimeout
+	slots := make(chan struct{}, q.cfg.Workers)
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	lastPurge := time.Time{}
+
+	for {
+		if time.Since(lastPurge) > time.Hour {
+			q.purge(ctx)
+			lastPurge = time.Now()
+		}
+		if _, err := q.Stats(ctx); err != nil && ctx.Err() == nil {
+			q.logger.Warn("Failed to count queued notifications", zap.Error(err))
+		}
+
+		// Only claim what there are free workers for, so a backlog stays in the
+		// store where other servers can pick it up
+		if free := q.cfg.Workers - len(slots); free > 0 {
+			jobs, err := q.store.Claim(ctx, free, lease)
+			if err != nil && ctx.Err() == nil {
+				q.logger.Warn("Failed to claim notifications", zap.Error(err))
+			}
+			for _, job := range jobs {
+				slots <- struct{}{}
+				go func(job Job) {
+					defer func() { <-slots }()
+					q.deliver(ctx, job)
+				}(job)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			q.logger.Info("Notification delivery stopped")
+			return
+		case <-q.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// deliver makes one delivery attempt and records its outcome.
+func (q *Queue) deliver(ctx context.Context, job Job) {
+	h := q.handler(job.Kind)
+	if h == nil {
+		q.gaveUp.Add(1)
+		if err := q.store.Fail(ctx, job.ID, "no handler for "+job.Kind); err != nil {
+			q.logger.Warn("Failed to record notification failure", zap.String("id", job.ID), zap.Error(err))
+		}
+		return
+	}
+
+	deliverCtx, cancel := context.WithTimeout(ctx, q.cfg.DeliveryTimeout)
+	err := h(deliverCtx, job.Payload)
+	cancel()
+	if ctx.Err() != nil {
+		// Shutting down; the lease runs out and another attempt follows
+		return
+	}
+
+	switch {
+	case err == nil:
+		q.delivered.Add(1)
+		err = q.store.Complete(ctx, job.ID)
+	case job.Attempts >= q.cfg.MaxAttempts:
+		q.gaveUp.Add(1)
+		q.logger.Error("Giving up on notification",
+			zap.String("kind", job.Kind), zap.Int("attempts", job.Attempts), zap.Error(err))
+		err = q.store.Fail(ctx, job.ID, err.Error())
+	default:
+		q.retried.Add(1)
+		q.logger.Warn("Notification delivery failed, will retry",
+			zap.String("kind", job.Kind), zap.Int("attempt", job.Attempts), zap.Error(err))
+		err = q.store.Retry(ctx, job.ID, time.Now().Add(Backoff(job.Attempts)), err.Error())
+	}
+	if err != nil {
+		q.logger.Warn("Failed to record notification delivery", zap.String("id", job.ID), zap.Error(err))
+	}
+}
+
+func (q *Queue) purge(ctx context.Context) {
+	n, err := q.store.PurgeFailed(ctx, time.Now().Add(-failedRetention))
+	if err != nil {
+		if ctx.Err() == nil {
+			q.logger.Warn("Failed to purge failed notifications", zap.Error(err))
+		}
+		return
+	}
+	if n > 0 {
+		q.logger.Info("Purged failed notifications", zap.Int64("count", n))
+	}
+}
+
+// Backoff returns how long to wait after a notification's attempt-th failed
+// delivery: 30 seconds, doubling each time up to an hour.
+func Backoff(attempt int) time.Duration {
+	d := 30 * time.Second
+	for i := 1; i < attempt && d < maxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, maxBackoff)
+}
@@ -0,0 +1,270 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// memStore is an in-memory Store. Every job is due as soon as it isn't leased.
+type memStore struct {
+	mu   sync.Mutex
+	next int
+	jobs map[string]*memJob
+}
+
+type memJob struct {
+	Job
+	maxAttempts int
+	leased      bool
+	failed      bool
+	lastError   string
+}
+
+func newMemStore() *memStore {
+	return &memStore{jobs: make(map[string]*memJob)}
+}
+
+func (s *memStore) Enqueue(_ context.Context, kind string, payload []byte, maxAttempts int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.next++
+	id := strconv.Itoa(s.next)
+	s.jobs[id] = &memJob{Job: Job{ID: id, Kind: kind, Payload: payload}, maxAttempts: maxAttempts}
+	return nil
+}
+
+func (s *memStore) Claim(_ context.Context, limit int, _ time.Duration) ([]Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var jobs []Job
+	for _, j := range s.jobs {
+		if len(jobs) == limit {
+			break
+		}
+		if j.leased || j.failed {
+			continue
+		}
+		j.leased = true
+		j.Attempts++
+		jobs = append(jobs, j.Job)
+	}
+	return jobs, nil
+}
+
+func (s *memStore) Complete(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.jobs, id)
+	return nil
+}
+
+func (s *memStore) Retry(_ context.Context, id string, _ time.Time, lastError string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs[id].leased = false
+	s.jobs[id].lastError = lastError
+	return nil
+}
+
+func (s *memStore) Fail(_ context.Context, id string, lastError string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs[id].leased = false
+	s.jobs[id].failed = true
+	s.jobs[id].lastError = lastError
+	return nil
+}
+
+func (s *memStore) Count(context.Context) (pending, failed int64, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, j := range s.jobs {
+		if j.failed {
+			failed++
+		} else {
+			pending++
+		}
+	}
+	return pending, failed, nil
+}
+
+func (s *memStore) PurgeFailed(context.Context, time.Time) (int64, error) {
+	return 0, nil
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestMain(m *testing.M) {
+	pollInterval = 10 * time.Millisecond
+	os.Exit(m.Run())
+}
+
+func TestQueueDelivery(t *testing.T) {
+	store := newMemStore()
+	q := New(store, Config{MaxAttempts: 3}, zap.NewNop())
+
+	var mu sync.Mutex
+	var got []string
+	flaky := 0
+	q.Handle("email", func(_ context.Context, payload []byte) error {
+		mu.Lock()
+		defer mu.Unlock()
+		got = append(got, string(payload))
+		return nil
+	})
+	q.Handle("flaky", func(context.Context, []byte) error {
+		mu.Lock()
+		defer mu.Unlock()
+		flaky++
+		if flaky < 2 {
+			return errors.New("temporarily unavailable")
+		}
+		return nil
+	})
+	q.Handle("dead", func(context.Context, []byte) error {
+		return errors.New("connection refused")
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go q.Run(ctx)
+
+	for _, kind := range []string{"email", "flaky", "dead"} {
+		if err := q.Enqueue(ctx, kind, map[string]string{"to": "alice@example.com"}); err != nil {
+			t.Fatalf("Enqueue(%s) error = %v", kind, err)
+		}
+	}
+	if err := q.Enqueue(ctx, "unknown", nil); err == nil {
+		t.Error("Enqueue accepted a kind without a handler")
+	}
+
+	waitFor(t, "deliveries", func() bool {
+		stats, _ := q.Stats(ctx)
+		return stats.Delivered == 2 && stats.GaveUp == 1
+	})
+
+	stats, _ := q.Stats(ctx)
+	if stats.Pending != 0 || stats.Failed != 1 || stats.Retried != 3 {
+		t.Errorf("Stats() = %+v, want 0 pending, 1 failed, 3 retried", stats)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(got) != 1 || got[0] != `{"to":"alice@example.com"}` {
+		t.Errorf("email handler got %q", got)
+	}
+}
+
+func TestQueueBackpressure(t *testing.T) {
+	store := newMemStore()
+	q := New(store, Config{MaxPending: 2}, zap.NewNop())
+	block := make(chan struct{})
+	q.Handle("webhook", func(ctx context.Context, _ []byte) error {
+		select {
+		case <-block:
+		case <-ctx.Done():
+		}
+		return nil
+	})
+
+	// Nothing is delivering, so the queue fills up and refuses instead of waiting
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		if err := q.Enqueue(ctx, "webhook", i); err != nil {
+			t.Fatalf("Enqueue() error = %v", err)
+		}
+	}
+	if err := q.Enqueue(ctx, "webhook", 3); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("Enqueue() on a full queue error = %v, want ErrQueueFull", err)
+	}
+	if stats, _ := q.Stats(ctx); stats.Dropped != 1 || stats.Pending != 2 {
+		t.Errorf("Stats() = %+v, want 1 dropped, 2 pending", stats)
+	}
+	close(block)
+}
+
+func TestQueueWorkerLimit(t *testing.T) {
+	store := newMemStore()
+	q := New(store, Config{Workers: 2}, zap.NewNop())
+
+	var mu sync.Mutex
+	running, peak := 0, 0
+	release := make(chan struct{})
+	q.Handle("webhook", func(ctx context.Context, _ []byte) error {
+		mu.Lock()
+		running++
+		peak = max(peak, running)
+		mu.Unlock()
+		defer func() {
+			mu.Lock()
+			running--
+			mu.Unlock()
+		}()
+		select {
+		case <-release:
+		case <-ctx.Done():
+		}
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	for i := 0; i < 5; i++ {
+		if err := q.Enqueue(ctx, "webhook", i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	go q.Run(ctx)
+
+	waitFor(t, "workers to start", func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return running == 2
+	})
+	// A stuck destination holds its workers, but the rest stay queued
+	if pending, _, _ := store.Count(ctx); pending != 5 {
+		t.Errorf("pending = %d, want 5", pending)
+	}
+	close(release)
+	waitFor(t, "queue to drain", func() bool {
+		stats, _ := q.Stats(ctx)
+		return stats.Delivered == 5
+	})
+	mu.Lock()
+	defer mu.Unlock()
+	if peak != 2 {
+		t.Errorf("peak concurrent deliveries = %d, want 2", peak)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{4, 4 * time.Minute},
+		{20, time.Hour},
+	}
+	for _, tt := range tests {
+		if got := Backoff(tt.attempt); got != tt.want {
+			t.Errorf("Backoff(%d) = %v, want %v", tt.attempt, got, tt.want)
+		}
+	}
+}
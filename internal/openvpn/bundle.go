@@ -0,0 +1,107 @@
+package openvpn
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// bundleFiles maps the inline blocks of a client config to the files a bundle
+// writes them to.
+var bundleFiles = map[string]string{
+	"ca":             "ca.crt",
+	"cert":           "client.crt",
+	"key":            "client.key",
+	"tls-auth":       "ta.key",
+	"tls-crypt":      "ta.key",
+	"auth-user-pass": "auth.txt",
+}
+
+// SplitInlineConfig moves the inline blocks of a client config into separate
+// files, replacing each block with a directive that references its file by a
+// relative path. It returns the rewritten config and the files by name.
+func SplitInlineConfig(conf []byte) ([]byte, map[string][]byte, error) {
+	var out bytes.Buffer
+	files := make(map[string][]byte)
+
+	var block string // Inline block being read, if any
+	var content bytes.Buffer
+	scanner := bufio.NewScanner(bytes.NewReader(conf))
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+
+		if block != "" {
+			if trimmed == "</"+block+">" {
+				files[bundleFiles[block]] = append([]byte(nil), content.Bytes()...)
+				fmt.Fprintf(&out, "%s %s\n", block, bundleFiles[block])
+				block = ""
+				content.Reset()
+				continue
+			}
+			content.WriteString(line + "\n")
+			continue
+		}
+
+		if strings.HasPrefix(trimmed, "<") && strings.HasSuffix(trimmed, ">") && !strings.HasPrefix(trimmed, "</") {
+			name := strings.Trim(trimmed, "<>")
+			if _, ok := bundleFiles[name]; !ok {
+				return nil, nil, fmt.Errorf("unsupported inline block <%s>", name)
+			}
+			block = name
+			continue
+		}
+		out.WriteString(line + "\n")
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+	if block != "" {
+		return nil, nil, fmt.Errorf("unterminated inline block <%s>", block)
+	}
+	return out.Bytes(), files, nil
+}
+
+// ConfigBundle returns a zip archive of a client config split into separate
+// files, for clients that don't handle inline blocks. The config keeps its name
+// and references the other files relative to the directory it is extracted to.
+func ConfigBundle(fileName string, conf []byte) ([]byte, error) {
+	config, files, err := SplitInlineConfig(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	write := func(name string, data []byte) error {
+		header := &zip.FileHeader{Name: name, Method: zip.Deflate}
+		header.SetMode(0600)
+		w, err := zw.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	}
+	if err := write(fileName, config); err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		if err := write(name, files[name]); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
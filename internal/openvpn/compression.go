@@ -0,0 +1,110 @@
+package openvpn
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// Data channel compression modes.
+const (
+	CompressionNone = "none"
+	CompressionLZ4  = "lz4" // compress lz4-v2, OpenVPN 2.4+
+	CompressionLZO  = "lzo" // comp-lzo, understood by all OpenVPN versions
+)
+
+// compressionRisk explains why compression is off by default. It is included in
+// validation messages so admins see the tradeoff when choosing a mode.
+const compressionRisk = "compression lets an attacker who can inject traffic into the tunnel recover secrets from packet sizes (VORACLE), so use none unless old clients require it"
+
+// ValidateCompression checks a gateway compression mode against its crypto profile.
+// lz4 needs OpenVPN 2.4+ on both ends, which the compatible profile doesn't assume.
+func ValidateCompression(mode, cryptoProfile string) error {
+	switch mode {
+	case "", CompressionNone, CompressionLZO:
+		return nil
+	case CompressionLZ4:
+		if cryptoProfile == CryptoProfileCompatible {
+			return fmt.Errorf("compression lz4 requires OpenVPN 2.4+ clients, but the compatible crypto profile supports older ones that would fail with a compression mismatch; use lzo or none (%s)", compressionRisk)
+		}
+		return nil
+	default:
+		return fmt.Errorf("invalid compression %q: must be 'none', 'lz4', or 'lzo' (%s)", mode, compressionRisk)
+	}
+}
+
+// CompressionWarning returns a warning to show when compression is enabled, or ""
+// for none.
+func CompressionWarning(mode string) string {
+	if mode == "" || mode == CompressionNone {
+		return ""
+	}
+	return "Compression is enabled: " + compressionRisk
+}
+
+// compressionDirectives returns the directives enabling mode, shared by server and
+// client configs so both ends always agree. OpenVPN 2.6 refuses compression unless
+// allow-compression is set; older versions don't know the option, so it is
+// marked ignorable.
+func compressionDirectives(mode string) []string {
+	var directive string
+	switch mode {
+	case CompressionLZ4:
+		directive = "compress lz4-v2"
+	case CompressionLZO:
+		directive = "comp-lzo yes"
+	default:
+		return nil
+	}
+	return []string{
+		"ignore-unknown-option allow-compression",
+		"allow-compression yes",
+		directive,
+	}
+}
+
+// serverCompressionDirectives returns the server config directives for mode. The
+// setting is also pushed so clients with an older config still match.
+func serverCompressionDirectives(mode string) []string {
+	directives := compressionDirectives(mode)
+	if len(directives) == 0 {
+		return nil
+	}
+	return append(directives, fmt.Sprintf("push %q", directives[len(directives)-1]))
+}
+
+// isCompressionDirective reports whether a config line configures compression.
+func isCompressionDirective(fields []string) bool {
+	if len(fields) == 0 {
+		return false
+	}
+	switch fields[0] {
+	case "comp-lzo", "compress", "allow-compression":
+		return true
+	case "ignore-unknown-option":
+		return len(fields) == 2 && fields[1] == "allow-compression"
+	case "push":
+		pushed := strings.Fields(strings.Trim(strings.Join(fields[1:], " "), `"`))
+		return len(pushed) > 0 && (pushed[0] == "comp-lzo" || pushed[0] == "compress")
+	}
+	return false
+}
+
+// SetServerCompression rewrites the compression directives in a server config to
+// match mode, removing any existing ones.
+func SetServerCompression(conf []byte, mode string) []byte {
+	var out bytes.Buffer
+	scanner := bufio.NewScanner(bytes.NewReader(conf))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if isCompressionDirective(strings.Fields(line)) {
+			continue
+		}
+		out.WriteString(line + "\n")
+	}
+	for _, directive := range serverCompressionDirectives(mode) {
+		out.WriteString(directive + "\n")
+	}
+	return out.Bytes()
+}
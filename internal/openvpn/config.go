@@ -2,6 +2,7 @@
 package openvpn
 
 import (
+	"bufio"
 	"bytes"
 	cryptoRand "crypto/rand"
 	"fmt"
@@ -10,6 +11,7 @@ import (
 	"text/template"
 	"time"
 
+	"github.com/gatekey-project/gatekey/internal/db"
 	"github.com/gatekey-project/gatekey/internal/models"
 	"github.com/gatekey-project/gatekey/internal/pki"
 )
@@ -55,10 +57,27 @@ type GenerateRequest struct {
 	ExpiresAt     time.Time
 	Routes        []Route
 	DNS           []string
-	Options       map[string]string
 	CryptoProfile string // "modern", "fips", or "compatible"
 	TLSAuthKey    string // Gateway-specific TLS-Auth key (overrides generator's default)
+	TLSMode       string // "auth" (default) or "crypt"; selects tls-auth or tls-crypt for the key
+	Compression   string // "none" (default), "lz4", or "lzo"; must match the gateway's server config
 	AuthToken     string // Unique token for password authentication (embedded in config)
+	// KeyPassphrase, when set, encrypts the embedded private key so the config alone
+	// can't be used to connect; the passphrase must be delivered separately
+	KeyPassphrase string
+	// AdditionalRemotes are fallback endpoints tried in order after the primary one
+	AdditionalRemotes []Remote
+	// LinkTuning sets keepalive and MTU; it must match the gateway's server config
+	LinkTuning LinkTuning
+	// AuthUsername is the auth-user-pass username, which must match the
+	// certificate's common name; defaults to the user's email
+	AuthUsername string
+}
+
+// Remote is an additional protocol/port a gateway accepts connections on.
+type Remote struct {
+	Protocol string
+	Port     int
 }
 
 // Route represents a route to push to the client.
@@ -84,6 +103,13 @@ type CryptoSettings struct {
 	CryptoProfile string // For display in config
 }
 
+// AuthGenTokenSupported reports whether gateways using the crypto profile issue
+// auth-gen-token session tokens. The compatible profile targets clients older than
+// OpenVPN 2.4, which don't handle server-generated tokens.
+func AuthGenTokenSupported(profile string) bool {
+	return profile != CryptoProfileCompatible
+}
+
 // GetCryptoSettings returns the crypto settings for a given profile.
 func GetCryptoSettings(profile string) CryptoSettings {
 	switch profile {
@@ -126,11 +152,14 @@ type configData struct {
 	GatewayHostname  string
 	GatewayPort      int
 	Protocol         string
+	Remotes          []Remote // Additional fallback remotes
 	CACert           string
 	ClientCert       string
 	ClientKey        string
+	KeyEncrypted     bool // ClientKey is passphrase-protected
 	TLSAuth          string
 	TLSAuthDirection string
+	TLSCrypt         bool   // Emit the key as tls-crypt instead of tls-auth
 	AuthUsername     string // Username for auth-user-pass (user email)
 	AuthPassword     string // Password for auth-user-pass (auth token)
 	Routes           []Route
@@ -138,8 +167,9 @@ type configData struct {
 	ExpiresAt        string
 	UserEmail        string
 	GatewayName      string
-	Options          map[string]string
 	Crypto           CryptoSettings
+	Compression      []string // Compression directives, empty for none
+	LinkTuning       []string // Keepalive and MTU directives
 }
 
 // Generate generates an OpenVPN configuration file.
@@ -162,22 +192,38 @@ func (g *ConfigGenerator) Generate(req GenerateRequest) (*GeneratedConfig, error
 	}
 	crypto := GetCryptoSettings(cryptoProfile)
 
+	authUsername := req.AuthUsername
+	if authUsername == "" {
+		authUsername = req.User.Email
+	}
+
 	data := configData{
 		GatewayHostname: gatewayAddress,
 		GatewayPort:     req.Gateway.VPNPort,
 		Protocol:        protocol,
+		Remotes:         req.AdditionalRemotes,
 		CACert:          string(g.caPEM),
 		ClientCert:      string(req.Certificate.CertificatePEM),
 		ClientKey:       string(req.Certificate.PrivateKeyPEM),
-		AuthUsername:    req.User.Email, // Use email as username
-		AuthPassword:    req.AuthToken,  // Use unique token as password
+		AuthUsername:    authUsername,
+		AuthPassword:    req.AuthToken, // Use unique token as password
 		Routes:          req.Routes,
 		DNS:             req.DNS,
 		ExpiresAt:       req.ExpiresAt.UTC().Format(time.RFC3339),
 		UserEmail:       req.User.Email,
 		GatewayName:     req.Gateway.Name,
-		Options:         req.Options,
 		Crypto:          crypto,
+		Compression:     compressionDirectives(req.Compression),
+		LinkTuning:      linkTuningDirectives(req.LinkTuning),
+	}
+
+	if req.KeyPassphrase != "" {
+		encrypted, err := pki.EncryptPrivateKeyPEM(req.Certificate.PrivateKeyPEM, req.KeyPassphrase)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encrypt private key: %w", err)
+		}
+		data.ClientKey = string(encrypted)
+		data.KeyEncrypted = true
 	}
 
 	// Only include TLS-Auth if enabled for this gateway
@@ -190,6 +236,7 @@ func (g *ConfigGenerator) Generate(req GenerateRequest) (*GeneratedConfig, error
 		if tlsKey != "" {
 			data.TLSAuth = tlsKey
 			data.TLSAuthDirection = "1" // Client direction
+			data.TLSCrypt = req.TLSMode == db.TLSModeCrypt
 		}
 	}
 
@@ -241,6 +288,9 @@ client
 dev tun
 proto {{ .Protocol }}
 remote {{ .GatewayHostname }} {{ .GatewayPort }}
+{{- range .Remotes }}
+remote {{ $.GatewayHostname }} {{ .Port }} {{ .Protocol }}
+{{- end }}
 resolv-retry infinite
 nobind
 persist-key
@@ -260,6 +310,7 @@ tls-cipher {{ .Crypto.TLSCipher }}
 {{- end }}
 
 # Connection settings
+# server-poll-timeout moves on to the next remote (e.g. TCP fallback) when one doesn't answer
 connect-retry 5 30
 connect-timeout 30
 server-poll-timeout 10
@@ -268,10 +319,9 @@ server-poll-timeout 10
 verb 1
 mute 10
 
-{{- if .Options.keepalive }}
-keepalive {{ .Options.keepalive }}
-{{- else }}
-keepalive 10 60
+# Keepalive and MTU (must match the gateway)
+{{- range .LinkTuning }}
+{{ . }}
 {{- end }}
 
 {{- range .Routes }}
@@ -282,12 +332,12 @@ route {{ .Network }} {{ .Netmask }}
 dhcp-option DNS {{ . }}
 {{- end }}
 
-{{- if .Options.compLzo }}
-comp-lzo {{ .Options.compLzo }}
-{{- end }}
+{{- if .Compression }}
 
-{{- if .Options.mtu }}
-tun-mtu {{ .Options.mtu }}
+# Compression (must match the gateway)
+{{- range .Compression }}
+{{ . }}
+{{- end }}
 {{- end }}
 
 # Embedded CA Certificate
@@ -300,12 +350,25 @@ tun-mtu {{ .Options.mtu }}
 {{ .ClientCert -}}
 </cert>
 
+{{- if .KeyEncrypted }}
+
+# The private key is encrypted. OpenVPN prompts for its passphrase on connect, or
+# reads it from the file given with --askpass; auth-nocache keeps it out of memory.
+auth-nocache
+{{- end }}
+
 # Embedded Client Private Key
 <key>
 {{ .ClientKey -}}
 </key>
 
-{{- if .TLSAuth }}
+{{- if and .TLSAuth .TLSCrypt }}
+
+# TLS Crypt (authenticated and encrypted control channel)
+<tls-crypt>
+{{ .TLSAuth -}}
+</tls-crypt>
+{{- else if .TLSAuth }}
 
 # TLS Authentication
 key-direction {{ .TLSAuthDirection }}
@@ -366,12 +429,17 @@ type ServerConfig struct {
 	ServerKeyPath   string
 	DHPath          string
 	TLSAuthPath     string
+	TLSCryptPath    string // Used instead of TLSAuthPath when set
 	CRLPath         string
 	StatusLog       string
 	ClientConfigDir string
 	ManagementAddr  string
 	PushOptions     []string
+	Compression     string // "none" (default), "lz4", or "lzo"
+	LinkTuning      LinkTuning
 	Scripts         ScriptPaths
+	// AuthGenTokenLifetime enables auth-gen-token with this lifetime in seconds; 0 disables
+	AuthGenTokenLifetime int
 }
 
 // ScriptPaths contains paths to hook scripts.
@@ -394,7 +462,7 @@ func GenerateServerConfig(cfg ServerConfig) ([]byte, error) {
 		return nil, fmt.Errorf("failed to execute template: %w", err)
 	}
 
-	return buf.Bytes(), nil
+	return SetServerLinkTuning(SetServerCompression(buf.Bytes(), cfg.Compression), cfg.LinkTuning), nil
 }
 
 const serverConfigTemplate = `# GateKey OpenVPN Server Configuration
@@ -411,7 +479,9 @@ cert {{ .ServerCertPath }}
 key {{ .ServerKeyPath }}
 dh {{ .DHPath }}
 
-{{- if .TLSAuthPath }}
+{{- if .TLSCryptPath }}
+tls-crypt {{ .TLSCryptPath }}
+{{- else if .TLSAuthPath }}
 tls-auth {{ .TLSAuthPath }} 0
 {{- end }}
 
@@ -425,7 +495,6 @@ auth SHA256
 tls-version-min 1.2
 
 # Connection
-keepalive 10 60
 persist-key
 persist-tun
 
@@ -453,6 +522,10 @@ auth-user-pass-verify {{ .Scripts.AuthUserPassVerify }} via-file
 script-security 2
 {{- end }}
 
+{{- if .AuthGenTokenLifetime }}
+auth-gen-token {{ .AuthGenTokenLifetime }}
+{{- end }}
+
 {{- if .Scripts.TLSVerify }}
 tls-verify {{ .Scripts.TLSVerify }}
 {{- end }}
@@ -471,3 +544,56 @@ verify-client-cert require
 # Topology
 topology subnet
 `
+
+// SetServerTLSMode rewrites the control channel protection directive in a server
+// config to use keyPath with the given mode, replacing any existing tls-auth or
+// tls-crypt line. Configs without either directive are returned unchanged.
+func SetServerTLSMode(conf []byte, mode, keyPath string) []byte {
+	directive := fmt.Sprintf("tls-auth %s 0", keyPath)
+	if mode == db.TLSModeCrypt {
+		directive = fmt.Sprintf("tls-crypt %s", keyPath)
+	}
+
+	var out bytes.Buffer
+	scanner := bufio.NewScanner(bytes.NewReader(conf))
+	for scanner.Scan() {
+		line := scanner.Text()
+		fields := strings.Fields(line)
+		if len(fields) > 0 && (fields[0] == "tls-auth" || fields[0] == "tls-crypt") {
+			out.WriteString(directive + "\n")
+			continue
+		}
+		if len(fields) > 0 && fields[0] == "key-direction" && mode == db.TLSModeCrypt {
+			continue // tls-crypt takes no direction
+		}
+		out.WriteString(line + "\n")
+	}
+	return out.Bytes()
+}
+
+// SetServerAuthGenToken sets the auth-gen-token directive in a server config to the
+// given lifetime in seconds, or removes it when lifetime is 0. The directive is
+// placed after auth-user-pass-verify, since tokens only replace password auth.
+func SetServerAuthGenToken(conf []byte, lifetime int) []byte {
+	directive := fmt.Sprintf("auth-gen-token %d", lifetime)
+
+	var out bytes.Buffer
+	written := lifetime <= 0
+	scanner := bufio.NewScanner(bytes.NewReader(conf))
+	for scanner.Scan() {
+		line := scanner.Text()
+		fields := strings.Fields(line)
+		if len(fields) > 0 && fields[0] == "auth-gen-token" {
+			continue
+		}
+		out.WriteString(line + "\n")
+		if !written && len(fields) > 0 && fields[0] == "auth-user-pass-verify" {
+			out.WriteString(directive + "\n")
+			written = true
+		}
+	}
+	if !written {
+		out.WriteString(directive + "\n")
+	}
+	return out.Bytes()
+}
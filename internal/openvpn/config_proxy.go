@@ -0,0 +1,68 @@
+package openvpn
+
+import (
+	"net/http"
+	"path"
+	"strings"
+)
+
+// GatewayProxyHeader carries the gateway's token on client requests the gateway
+// forwards to the control plane. The user's own Authorization header or session
+// cookie is forwarded unchanged and still decides what the request may do.
+const GatewayProxyHeader = "X-GateKey-Gateway-Token"
+
+// configProxyRoutes are the requests a gateway may forward for clients that can't
+// reach the control plane: what the CLI needs to list gateways and fetch configs.
+// "*" matches one path segment.
+var configProxyRoutes = []struct {
+	method  string
+	pattern string
+}{
+	{http.MethodGet, "/api/v1/server/info"},
+	{http.MethodGet, "/api/v1/gateways"},
+	{http.MethodGet, "/api/v1/auth/api-key/validate"},
+	{http.MethodPost, "/api/v1/auth/refresh"},
+	{http.MethodGet, "/api/v1/configs"},
+	{http.MethodPost, "/api/v1/configs/generate"},
+	{http.MethodGet, "/api/v1/configs/download/*"},
+	{http.MethodGet, "/api/v1/configs/*"},
+	{http.MethodGet, "/api/v1/configs/*/raw"},
+}
+
+// ConfigProxyGeneratePath is the config generation endpoint. The control plane
+// only accepts proxied requests for configs on the proxying gateway.
+const ConfigProxyGeneratePath = "/api/v1/configs/generate"
+
+// ConfigProxyAllowed reports whether a gateway may forward a request with this
+// method and path to the control plane.
+func ConfigProxyAllowed(method, urlPath string) bool {
+	if urlPath == "" || path.Clean(urlPath) != urlPath {
+		return false
+	}
+	for _, route := range configProxyRoutes {
+		if route.method == method && matchProxyPattern(route.pattern, urlPath) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchProxyPattern(pattern, urlPath string) bool {
+	want := strings.Split(pattern, "/")
+	got := strings.Split(urlPath, "/")
+	if len(want) != len(got) {
+		return false
+	}
+	for i := range want {
+		if want[i] == "*" {
+			if got[i] == "" {
+				return false
+			}
+			continue
+		}
+		if want[i] != got[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,31 @@
+package openvpn
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestConfigProxyAllowed(t *testing.T) {
+	tests := []struct {
+		method string
+		path   string
+		want   bool
+	}{
+		{http.MethodGet, "/api/v1/gateways", true},
+		{http.MethodPost, "/api/v1/configs/generate", true},
+		{http.MethodGet, "/api/v1/configs/download/abc", true},
+		{http.MethodGet, "/api/v1/configs/abc/raw", true},
+		{http.MethodGet, "/api/v1/configs/generate", true}, // Matches configs/{id}; the handler rejects it
+		{http.MethodDelete, "/api/v1/configs/abc", false},
+		{http.MethodGet, "/api/v1/admin/users", false},
+		{http.MethodGet, "/api/v1/configs/../admin/users", false},
+		{http.MethodGet, "/api/v1/configs//raw", false},
+		{http.MethodGet, "/api/v1/configs/a/b/raw", false},
+		{http.MethodPost, "/api/v1/auth/login", false},
+	}
+	for _, tt := range tests {
+		if got := ConfigProxyAllowed(tt.method, tt.path); got != tt.want {
+			t.Errorf("ConfigProxyAllowed(%s, %s) = %v, want %v", tt.method, tt.path, got, tt.want)
+		}
+	}
+}
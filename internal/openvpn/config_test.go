@@ -8,6 +8,7 @@ import (
 	"github.com/google/uuid"
 
 	"github.com/gatekey-project/gatekey/internal/config"
+	"github.com/gatekey-project/gatekey/internal/db"
 	"github.com/gatekey-project/gatekey/internal/models"
 	"github.com/gatekey-project/gatekey/internal/pki"
 )
@@ -207,3 +208,143 @@ func TestSanitizeFileName(t *testing.T) {
 		}
 	}
 }
+
+func TestDeriveEndpointServerConfig(t *testing.T) {
+	base := []byte(`port 1194
+proto udp
+dev tun
+server 172.31.255.0 255.255.255.0
+status /var/log/openvpn/status.log 10
+management 127.0.0.1 7505
+explicit-exit-notify 1
+`)
+
+	content := string(DeriveEndpointServerConfig(base, "tcp", 443, "172.31.254.0", "255.255.255.0", 7506))
+
+	for _, want := range []string{
+		"port 443\n",
+		"proto tcp\n",
+		"dev tun\n",
+		"server 172.31.254.0 255.255.255.0\n",
+		"status /var/log/openvpn/server-tcp-443-status.log 10\n",
+		"management 127.0.0.1 7506\n",
+	} {
+		if !strings.Contains(content, want) {
+			t.Errorf("derived config missing %q:\n%s", want, content)
+		}
+	}
+	if strings.Contains(content, "explicit-exit-notify") {
+		t.Error("explicit-exit-notify should be dropped for TCP endpoints")
+	}
+	if strings.Contains(content, "port 1194") || strings.Contains(content, "proto udp") {
+		t.Error("primary port/proto should be replaced")
+	}
+}
+
+func TestSetServerTLSMode(t *testing.T) {
+	base := []byte("dev tun\ntls-auth /etc/openvpn/server/ta.key 0\nkey-direction 0\n")
+
+	crypt := string(SetServerTLSMode(base, db.TLSModeCrypt, "/etc/openvpn/server/ta.key"))
+	if !strings.Contains(crypt, "tls-crypt /etc/openvpn/server/ta.key\n") {
+		t.Errorf("expected tls-crypt directive:\n%s", crypt)
+	}
+	if strings.Contains(crypt, "tls-auth") || strings.Contains(crypt, "key-direction") {
+		t.Errorf("tls-auth and key-direction should be removed for tls-crypt:\n%s", crypt)
+	}
+
+	back := string(SetServerTLSMode([]byte(crypt), db.TLSModeAuth, "/etc/openvpn/server/ta.key"))
+	if !strings.Contains(back, "tls-auth /etc/openvpn/server/ta.key 0\n") || strings.Contains(back, "tls-crypt") {
+		t.Errorf("expected tls-auth directive restored:\n%s", back)
+	}
+}
+
+func TestSetServerAuthGenToken(t *testing.T) {
+	base := []byte("dev tun\nauth-user-pass-verify /usr/local/bin/auth.sh via-file\nscript-security 2\n")
+
+	enabled := string(SetServerAuthGenToken(base, 3600))
+	if !strings.Contains(enabled, "via-file\nauth-gen-token 3600\nscript-security 2\n") {
+		t.Errorf("expected auth-gen-token after auth-user-pass-verify:\n%s", enabled)
+	}
+
+	changed := string(SetServerAuthGenToken([]byte(enabled), 600))
+	if strings.Count(changed, "auth-gen-token") != 1 || !strings.Contains(changed, "auth-gen-token 600\n") {
+		t.Errorf("expected a single updated auth-gen-token directive:\n%s", changed)
+	}
+
+	if disabled := SetServerAuthGenToken([]byte(changed), 0); string(disabled) != string(base) {
+		t.Errorf("expected auth-gen-token removed:\n%s", disabled)
+	}
+}
+
+func TestSetServerCompression(t *testing.T) {
+	base := []byte("dev tun\ncomp-lzo\npush \"comp-lzo yes\"\nverb 1\n")
+
+	lz4 := string(SetServerCompression(base, CompressionLZ4))
+	if strings.Contains(lz4, "comp-lzo") {
+		t.Errorf("existing comp-lzo directives should be removed:\n%s", lz4)
+	}
+	if !strings.Contains(lz4, "allow-compression yes\ncompress lz4-v2\npush \"compress lz4-v2\"\n") {
+		t.Errorf("expected lz4 directives and push:\n%s", lz4)
+	}
+
+	if none := string(SetServerCompression([]byte(lz4), CompressionNone)); none != "dev tun\nverb 1\n" {
+		t.Errorf("expected all compression directives removed:\n%s", none)
+	}
+
+	// Client configs get the same directive the server pushes
+	for _, mode := range []string{CompressionLZ4, CompressionLZO} {
+		client := compressionDirectives(mode)
+		server := serverCompressionDirectives(mode)
+		if server[len(server)-1] != "push \""+client[len(client)-1]+"\"" {
+			t.Errorf("%s: server pushes %q, client uses %q", mode, server[len(server)-1], client[len(client)-1])
+		}
+	}
+}
+
+func TestValidateCompression(t *testing.T) {
+	if err := ValidateCompression(CompressionLZ4, CryptoProfileModern); err != nil {
+		t.Errorf("lz4 with modern profile: %v", err)
+	}
+	if err := ValidateCompression(CompressionLZ4, CryptoProfileCompatible); err == nil {
+		t.Error("lz4 with compatible profile: expected error")
+	}
+	if err := ValidateCompression("lz4-v2", CryptoProfileModern); err == nil || !strings.Contains(err.Error(), "VORACLE") {
+		t.Errorf("unknown mode: expected error explaining the risk, got %v", err)
+	}
+}
+
+func TestSetServerLinkTuning(t *testing.T) {
+	base := []byte("dev tun\nkeepalive 10 60\ntun-mtu 1500\nverb 1\n")
+
+	tuned := string(SetServerLinkTuning(base, LinkTuning{KeepaliveInterval: 20, TunMTU: 1400, MSSFix: 1360}))
+	if tuned != "dev tun\nverb 1\nkeepalive 20 60\ntun-mtu 1400\nmssfix 1360\n" {
+		t.Errorf("unexpected tuned config:\n%s", tuned)
+	}
+
+	if reset := string(SetServerLinkTuning([]byte(tuned), LinkTuning{})); reset != "dev tun\nverb 1\nkeepalive 10 60\n" {
+		t.Errorf("expected default keepalive only:\n%s", reset)
+	}
+}
+
+func TestValidateLinkTuning(t *testing.T) {
+	tests := []struct {
+		name      string
+		tuning    LinkTuning
+		protocols []string
+		wantErr   bool
+	}{
+		{"defaults", LinkTuning{}, []string{"udp"}, false},
+		{"tuned", LinkTuning{KeepaliveInterval: 15, KeepaliveTimeout: 90, TunMTU: 1400, MSSFix: 1360, Fragment: 1300}, []string{"udp"}, false},
+		{"long interval raises default timeout", LinkTuning{KeepaliveInterval: 60}, []string{"udp"}, false},
+		{"timeout under twice interval", LinkTuning{KeepaliveInterval: 30, KeepaliveTimeout: 50}, []string{"udp"}, true},
+		{"interval too long", LinkTuning{KeepaliveInterval: 301}, []string{"udp"}, true},
+		{"mtu too small", LinkTuning{TunMTU: 500}, []string{"udp"}, true},
+		{"mssfix too large", LinkTuning{MSSFix: 9001}, []string{"udp"}, true},
+		{"fragment over tcp", LinkTuning{Fragment: 1300}, []string{"udp", "tcp"}, true},
+	}
+	for _, tt := range tests {
+		if err := ValidateLinkTuning(tt.tuning, tt.protocols...); (err != nil) != tt.wantErr {
+			t.Errorf("%s: ValidateLinkTuning = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package openvpn
+
+import (
+	"fmt"
+	"os"
+)
+
+// Reason codes returned with gateway verify and connect denials. They are stable,
+// so agents, clients and log queries can rely on them; the reason text may change.
+const (
+	DenyInvalidGatewayToken = "invalid_gateway_token"
+	DenyConfigRevoked       = "config_revoked"
+	DenyConfigExpired       = "config_expired"
+	DenyInvalidCredentials  = "invalid_credentials"
+	DenyUsernameMismatch    = "username_mismatch"
+	DenyWrongGateway        = "wrong_gateway"
+	DenyCertNotFound        = "cert_not_found"
+	DenyCertExpired         = "cert_expired"
+	DenyUserNotFound        = "user_not_found"
+	DenyUserDisabled        = "user_disabled"
+	DenyNoGatewayAccess     = "no_gateway_access"
+	DenyAccessCheckFailed   = "access_check_failed"
+	DenyOutsideTimeWindow   = "outside_time_window"
+	DenySessionLimit        = "session_limit"
+	DenyCryptoProfile       = "crypto_profile"
+	DenyGroupLimit          = "group_connection_limit"
+)
+
+// denialGuidance tells the user what to do about each denial.
+var denialGuidance = map[string]string{
+	DenyInvalidGatewayToken: "the gateway is not registered with GateKey; contact your administrator",
+	DenyConfigRevoked:       "this config was revoked; download a new one with 'gatekey connect'",
+	DenyConfigExpired:       "this config has expired; download a new one with 'gatekey connect'",
+	DenyInvalidCredentials:  "the config's credentials are not recognised; download a new one with 'gatekey connect'",
+	DenyUsernameMismatch:    "the config belongs to a different user; log in as yourself and download your own config",
+	DenyWrongGateway:        "the config was issued for a different gateway; download one for this gateway",
+	DenyCertNotFound:        "the config's certificate is unknown or revoked; download a new one with 'gatekey connect'",
+	DenyCertExpired:         "the config's certificate has expired; download a new one with 'gatekey connect'",
+	DenyUserNotFound:        "your account was not found; log in again or contact your administrator",
+	DenyUserDisabled:        "your account is disabled; contact your administrator",
+	DenyNoGatewayAccess:     "you don't have access to this gateway; ask your administrator for access",
+	DenyAccessCheckFailed:   "the access check failed on the server; try again shortly",
+	DenyOutsideTimeWindow:   "your access policy doesn't allow connecting at this time; try again during your allowed hours",
+	DenySessionLimit:        "you have reached your limit of concurrent VPN sessions; disconnect another session first",
+	DenyCryptoProfile:       "this gateway doesn't meet the crypto profile your access policy requires; use another gateway or contact your administrator",
+	DenyGroupLimit:          "your group has reached its limit of concurrently connected users; try again later or contact your administrator",
+}
+
+// DenialGuidance returns what the user can do about a denial with code, or "" for
+// an unknown code.
+func DenialGuidance(code string) string {
+	return denialGuidance[code]
+}
+
+// DenialMessage formats a denial for the user, preferring the guidance for code
+// over the server's reason text.
+func DenialMessage(code, reason string) string {
+	if guidance := DenialGuidance(code); guidance != "" {
+		return fmt.Sprintf("%s [%s]", guidance, code)
+	}
+	if code != "" {
+		return fmt.Sprintf("%s [%s]", reason, code)
+	}
+	return reason
+}
+
+// WriteAuthFailedReason passes a denial message back to the connecting client.
+// OpenVPN 2.6 sets auth_failed_reason_file for auth-user-pass-verify scripts and
+// sends what is written there to the client as AUTH_FAILED,<message>. Older
+// versions don't set it, and the client just sees AUTH_FAILED.
+func WriteAuthFailedReason(message string) error {
+	path := os.Getenv("auth_failed_reason_file")
+	if path == "" {
+		return nil
+	}
+	return os.WriteFile(path, []byte(message), 0600)
+}
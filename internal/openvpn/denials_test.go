@@ -0,0 +1,39 @@
+package openvpn
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDenialMessage(t *testing.T) {
+	tests := []struct {
+		code, reason, want string
+	}{
+		{DenyConfigExpired, "config expired", "this config has expired; download a new one with 'gatekey connect' [config_expired]"},
+		{"new_code", "something new", "something new [new_code]"},
+		{"", "invalid gateway token", "invalid gateway token"},
+	}
+	for _, tt := range tests {
+		if got := DenialMessage(tt.code, tt.reason); got != tt.want {
+			t.Errorf("DenialMessage(%q, %q) = %q, want %q", tt.code, tt.reason, got, tt.want)
+		}
+	}
+}
+
+func TestWriteAuthFailedReason(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "reason")
+	t.Setenv("auth_failed_reason_file", path)
+	if err := WriteAuthFailedReason("denied [user_disabled]"); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || string(data) != "denied [user_disabled]" {
+		t.Errorf("reason file = %q, %v", data, err)
+	}
+
+	t.Setenv("auth_failed_reason_file", "")
+	if err := WriteAuthFailedReason("ignored"); err != nil {
+		t.Errorf("expected no error without a reason file: %v", err)
+	}
+}
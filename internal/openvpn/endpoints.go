@@ -0,0 +1,65 @@
+package openvpn
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// EndpointConfigHeader starts every server config derived for an additional endpoint,
+// so the gateway agent can tell which configs it manages.
+const EndpointConfigHeader = "# GateKey additional endpoint"
+
+// EndpointInstanceName returns the OpenVPN instance name used for an additional
+// listen endpoint, e.g. "server-tcp-443" for openvpn-server@server-tcp-443.
+func EndpointInstanceName(protocol string, port int) string {
+	return fmt.Sprintf("server-%s-%d", strings.ToLower(protocol), port)
+}
+
+// DeriveEndpointServerConfig builds the server config for an additional listen
+// endpoint from the primary server config. OpenVPN listens on a single
+// protocol/port per process, so each endpoint runs as its own instance with its own
+// client subnet, status file, and management port.
+func DeriveEndpointServerConfig(base []byte, protocol string, port int, network, netmask string, managementPort int) []byte {
+	protocol = strings.ToLower(protocol)
+	name := EndpointInstanceName(protocol, port)
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "%s %s/%d (derived from primary server config)\n", EndpointConfigHeader, protocol, port)
+
+	scanner := bufio.NewScanner(bytes.NewReader(base))
+	for scanner.Scan() {
+		line := scanner.Text()
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			out.WriteString(line + "\n")
+			continue
+		}
+
+		switch fields[0] {
+		case "port":
+			fmt.Fprintf(&out, "port %d\n", port)
+		case "proto":
+			fmt.Fprintf(&out, "proto %s\n", protocol)
+		case "server":
+			fmt.Fprintf(&out, "server %s %s\n", network, netmask)
+		case "status":
+			fmt.Fprintf(&out, "status /var/log/openvpn/%s-status.log 10\n", name)
+		case "ifconfig-pool-persist":
+			fmt.Fprintf(&out, "ifconfig-pool-persist /var/log/openvpn/%s-ipp.txt\n", name)
+		case "management":
+			if len(fields) >= 2 {
+				fmt.Fprintf(&out, "management %s %d\n", fields[1], managementPort)
+			}
+		case "explicit-exit-notify", "fragment":
+			// Only valid for UDP servers
+			if protocol == "udp" {
+				out.WriteString(line + "\n")
+			}
+		default:
+			out.WriteString(line + "\n")
+		}
+	}
+	return out.Bytes()
+}
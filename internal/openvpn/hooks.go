@@ -3,13 +3,21 @@ package openvpn
 
 import (
 	"bufio"
+	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"os"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
+
+	"github.com/gatekey-project/gatekey/internal/agent"
 )
 
 // HookType represents the type of OpenVPN hook.
@@ -46,6 +54,7 @@ type HookRequest struct {
 type HookResponse struct {
 	Allow        bool     `json:"allow"`
 	Message      string   `json:"message,omitempty"`
+	ReasonCode   string   `json:"reason_code,omitempty"` // Stable code for a denial, see the Deny constants
 	ClientConfig []string `json:"client_config,omitempty"`
 }
 
@@ -53,20 +62,30 @@ type HookResponse struct {
 type HookClient struct {
 	baseURL    string
 	token      string
-	httpClient *http.Client
+	httpClient *agent.ControlPlaneClient
 }
 
 // NewHookClient creates a new hook client.
 func NewHookClient(baseURL, token string) *HookClient {
 	return &HookClient{
-		baseURL: strings.TrimSuffix(baseURL, "/"),
-		token:   token,
-		httpClient: &http.Client{
-			Timeout: 10 * time.Second,
-		},
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		token:      token,
+		httpClient: agent.NewControlPlaneClient(10 * time.Second),
 	}
 }
 
+// SetTimeout sets how long requests to the control plane may take.
+func (c *HookClient) SetTimeout(timeout time.Duration) {
+	c.httpClient.SetTimeout(timeout)
+}
+
+// IsTimeout reports whether a HookClient error was caused by the control plane
+// not responding in time.
+func IsTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
 // Verify sends a verification request to the control plane.
 func (c *HookClient) Verify(req HookRequest) (*HookResponse, error) {
 	// Add token to request
@@ -107,6 +126,7 @@ func (c *HookClient) Verify(req HookRequest) (*HookResponse, error) {
 	var apiResp struct {
 		Allowed     bool   `json:"allowed"`
 		Reason      string `json:"reason,omitempty"`
+		ReasonCode  string `json:"reason_code,omitempty"`
 		GatewayID   string `json:"gateway_id,omitempty"`
 		GatewayName string `json:"gateway_name,omitempty"`
 		Error       string `json:"error,omitempty"`
@@ -115,9 +135,14 @@ func (c *HookClient) Verify(req HookRequest) (*HookResponse, error) {
 		return nil, fmt.Errorf("failed to decode response: %w", err)
 	}
 
+	message := apiResp.Reason
+	if message == "" {
+		message = apiResp.Error
+	}
 	return &HookResponse{
-		Allow:   apiResp.Allowed,
-		Message: apiResp.Reason,
+		Allow:      apiResp.Allowed,
+		Message:    message,
+		ReasonCode: apiResp.ReasonCode,
 	}, nil
 }
 
@@ -156,30 +181,43 @@ func (c *HookClient) Connect(req HookRequest) (*HookResponse, error) {
 	}
 	defer resp.Body.Close()
 
-	var hookResp HookResponse
-	if err := json.NewDecoder(resp.Body).Decode(&hookResp); err != nil {
+	var apiResp struct {
+		HookResponse
+		Reason string `json:"reason,omitempty"`
+		Error  string `json:"error,omitempty"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&apiResp); err != nil {
 		return nil, fmt.Errorf("failed to decode response: %w", err)
 	}
 
+	hookResp := apiResp.HookResponse
+	if hookResp.Message == "" {
+		hookResp.Message = apiResp.Reason
+	}
+	if hookResp.Message == "" {
+		hookResp.Message = apiResp.Error
+	}
 	return &hookResp, nil
 }
 
 // Disconnect sends a disconnect notification to the control plane.
 func (c *HookClient) Disconnect(req HookRequest) error {
 	disconnectReq := struct {
-		Token      string `json:"token"`
-		CommonName string `json:"common_name"`
-		ClientIP   string `json:"client_ip,omitempty"`
-		Duration   int64  `json:"duration_seconds,omitempty"`
-		BytesSent  int64  `json:"bytes_sent,omitempty"`
-		BytesRecv  int64  `json:"bytes_received,omitempty"`
+		Token        string `json:"token"`
+		CommonName   string `json:"common_name"`
+		ClientIP     string `json:"client_ip,omitempty"`
+		Duration     int64  `json:"duration_seconds,omitempty"`
+		BytesSent    int64  `json:"bytes_sent,omitempty"`
+		BytesRecv    int64  `json:"bytes_received,omitempty"`
+		SerialNumber string `json:"serial_number,omitempty"`
 	}{
-		Token:      c.token,
-		CommonName: req.CommonName,
-		ClientIP:   req.UntrustedIP,
-		Duration:   req.TimeConnected,
-		BytesSent:  req.BytesSent,
-		BytesRecv:  req.BytesReceived,
+		Token:        c.token,
+		CommonName:   req.CommonName,
+		ClientIP:     req.UntrustedIP,
+		Duration:     req.TimeConnected,
+		BytesSent:    req.BytesSent,
+		BytesRecv:    req.BytesReceived,
+		SerialNumber: req.TLSSerial,
 	}
 
 	body, err := json.Marshal(disconnectReq)
@@ -207,6 +245,12 @@ func (c *HookClient) Disconnect(req HookRequest) error {
 	return nil
 }
 
+// ReprovisionVersionPrefix starts the config version set when an admin asks a
+// gateway to reprovision. The gateway then rewrites its certificates and restarts
+// OpenVPN even if no provisioning fingerprint changed, so a reprovision can
+// replace an expiring or damaged server certificate.
+const ReprovisionVersionPrefix = "reprovision-"
+
 // HeartbeatResponse contains the response from a heartbeat request.
 type HeartbeatResponse struct {
 	Status           string `json:"status"`
@@ -214,23 +258,41 @@ type HeartbeatResponse struct {
 	GatewayName      string `json:"gateway_name"`
 	ConfigVersion    string `json:"config_version"`
 	NeedsReprovision bool   `json:"needs_reprovision"`
+	RulesHash        string `json:"rules_hash,omitempty"`       // Content hash of access rules; empty if unsupported
+	RevocationEpoch  string `json:"revocation_epoch,omitempty"` // Changes whenever configs are revoked
+	CAFingerprint    string `json:"ca_fingerprint,omitempty"`   // Active CA, which signs provisioning responses
+	// MinHeartbeatInterval is the shortest heartbeat interval in seconds the control
+	// plane wants agents to use; 0 leaves it to the agent
+	MinHeartbeatInterval int `json:"min_heartbeat_interval,omitempty"`
+}
+
+// HeartbeatMetrics reports the gateway agent's rule enforcement state.
+type HeartbeatMetrics struct {
+	FirewallRules       int        `json:"firewall_rules"`           // Allow rules currently applied
+	LastRuleSync        *time.Time `json:"last_rule_sync,omitempty"` // Last time the firewall was confirmed current
+	RuleRefreshFailures int64      `json:"rule_refresh_failures"`    // Failed rule refreshes since the agent started
+	Reprovisions        int64      `json:"reprovisions"`             // Successful reprovisions since the agent started
+
+	IPPools []PoolUsage `json:"ip_pools,omitempty"` // Address pool usage of each OpenVPN server on the gateway
 }
 
 // Heartbeat sends a heartbeat to the control plane.
 // Returns the server's config version and whether reprovision is needed.
-func (c *HookClient) Heartbeat(publicIP string, activeClients int, openvpnRunning bool, configVersion string) (*HeartbeatResponse, error) {
+func (c *HookClient) Heartbeat(publicIP string, activeClients int, openvpnRunning bool, configVersion string, metrics *HeartbeatMetrics) (*HeartbeatResponse, error) {
 	heartbeatReq := struct {
-		Token          string `json:"token"`
-		PublicIP       string `json:"public_ip,omitempty"`
-		ActiveClients  int    `json:"active_clients"`
-		OpenVPNRunning bool   `json:"openvpn_running"`
-		ConfigVersion  string `json:"config_version,omitempty"`
+		Token          string            `json:"token"`
+		PublicIP       string            `json:"public_ip,omitempty"`
+		ActiveClients  int               `json:"active_clients"`
+		OpenVPNRunning bool              `json:"openvpn_running"`
+		ConfigVersion  string            `json:"config_version,omitempty"`
+		Metrics        *HeartbeatMetrics `json:"metrics,omitempty"`
 	}{
 		Token:          c.token,
 		PublicIP:       publicIP,
 		ActiveClients:  activeClients,
 		OpenVPNRunning: openvpnRunning,
 		ConfigVersion:  configVersion,
+		Metrics:        metrics,
 	}
 
 	body, err := json.Marshal(heartbeatReq)
@@ -238,14 +300,8 @@ func (c *HookClient) Heartbeat(publicIP string, activeClients int, openvpnRunnin
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	httpReq, err := http.NewRequest("POST", c.baseURL+"/api/v1/gateway/heartbeat", strings.NewReader(string(body)))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
-
-	httpReq.Header.Set("Content-Type", "application/json")
-
-	resp, err := c.httpClient.Do(httpReq)
+	// Safe to repeat, so retried if the control plane is briefly unavailable
+	resp, err := c.httpClient.PostIdempotent(context.Background(), c.baseURL+"/api/v1/gateway/heartbeat", body)
 	if err != nil {
 		return nil, fmt.Errorf("failed to send request: %w", err)
 	}
@@ -278,6 +334,32 @@ type ProvisionResponse struct {
 	CryptoProfile  string `json:"crypto_profile"`
 	TLSAuthEnabled bool   `json:"tls_auth_enabled"`
 	TLSAuthKey     string `json:"tls_auth_key,omitempty"`
+	TLSMode        string `json:"tls_mode,omitempty"`
+	Compression    string `json:"compression,omitempty"`
+	// LinkTuning is nil from control planes that predate per-gateway link tuning
+	LinkTuning *LinkTuning `json:"link_tuning,omitempty"`
+
+	// AuthGenTokenLifetime is the auth-gen-token lifetime in seconds; 0 disables session tokens
+	AuthGenTokenLifetime int `json:"auth_gen_token_lifetime"`
+
+	AdditionalEndpoints []ProvisionEndpoint `json:"additional_endpoints,omitempty"`
+	Fingerprints        map[string]string   `json:"fingerprints,omitempty"` // Per-artifact fingerprints of this provision
+
+	// Payload is the raw response body and Signature the control plane's signature
+	// over it, empty from control planes that don't sign; Endorsements are its
+	// other trusted CAs' signatures, keyed by fingerprint. See VerifyProvision
+	Payload      []byte            `json:"-"`
+	Signature    []byte            `json:"-"`
+	Endorsements map[string][]byte `json:"-"`
+}
+
+// ProvisionEndpoint is an additional listen endpoint served by its own OpenVPN instance.
+type ProvisionEndpoint struct {
+	Protocol   string `json:"protocol"`
+	Port       int    `json:"port"`
+	VPNSubnet  string `json:"vpn_subnet"`
+	VPNNetwork string `json:"vpn_network"`
+	VPNNetmask string `json:"vpn_netmask"`
 }
 
 // Provision requests new certificates and configuration from the control plane.
@@ -311,7 +393,142 @@ func (c *HookClient) Provision() (*ProvisionResponse, error) {
 		return nil, fmt.Errorf("provision failed with status %d: %s", resp.StatusCode, string(respBody))
 	}
 
+	payload, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
 	var result ProvisionResponse
+	if err := json.Unmarshal(payload, &result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	result.Payload = payload
+	if sig := resp.Header.Get(ProvisionSignatureHeader); sig != "" {
+		if result.Signature, err = base64.StdEncoding.DecodeString(sig); err != nil {
+			return nil, fmt.Errorf("failed to decode provisioning signature: %w", err)
+		}
+	}
+	if result.Endorsements, err = parseEndorsements(resp.Header.Values(ProvisionEndorsementHeader)); err != nil {
+		return nil, fmt.Errorf("failed to decode provisioning endorsements: %w", err)
+	}
+
+	return &result, nil
+}
+
+// ReportServerConfigs sends the OpenVPN server configs the gateway is running,
+// keyed by instance name, so admins can inspect them. Callers redact key
+// material first.
+func (c *HookClient) ReportServerConfigs(configs map[string]string) error {
+	reportReq := struct {
+		Token   string            `json:"token"`
+		Configs map[string]string `json:"configs"`
+	}{
+		Token:   c.token,
+		Configs: configs,
+	}
+
+	body, err := json.Marshal(reportReq)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	// Safe to repeat, so retried if the control plane is briefly unavailable
+	resp, err := c.httpClient.PostIdempotent(context.Background(), c.baseURL+"/api/v1/gateway/server-config", body)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("server config report failed with status: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// DeniedTraffic is traffic a client sent to a destination its rules don't
+// allow, counted over one reporting period.
+type DeniedTraffic struct {
+	UserEmail string    `json:"user_email,omitempty"`
+	ClientIP  string    `json:"client_ip"`
+	DestIP    string    `json:"dest_ip"`
+	Protocol  string    `json:"protocol"`
+	DestPort  int       `json:"dest_port,omitempty"`
+	Packets   int64     `json:"packets"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// Destination formats the destination as host:port, or just the host for
+// protocols without ports.
+func (d DeniedTraffic) Destination() string {
+	if d.DestPort == 0 {
+		return d.DestIP
+	}
+	return net.JoinHostPort(d.DestIP, strconv.Itoa(d.DestPort))
+}
+
+// ReportDeniedTraffic sends the traffic the gateway's firewall denied since the
+// last report.
+func (c *HookClient) ReportDeniedTraffic(entries []DeniedTraffic) error {
+	reportReq := struct {
+		Token   string          `json:"token"`
+		Entries []DeniedTraffic `json:"entries"`
+	}{
+		Token:   c.token,
+		Entries: entries,
+	}
+
+	body, err := json.Marshal(reportReq)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	// Counts are added up, so a report isn't retried
+	resp, err := c.httpClient.Post(context.Background(), c.baseURL+"/api/v1/gateway/denied-traffic", body)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("denied traffic report failed with status: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// ConfigVersionResponse contains the expected config version and per-artifact
+// fingerprints of the gateway's provisioning inputs.
+type ConfigVersionResponse struct {
+	ConfigVersion string            `json:"config_version"`
+	Fingerprints  map[string]string `json:"fingerprints"`
+}
+
+// ConfigVersion fetches the expected config version and provisioning fingerprints
+// without issuing new certificates.
+func (c *HookClient) ConfigVersion() (*ConfigVersionResponse, error) {
+	versionReq := struct {
+		Token string `json:"token"`
+	}{
+		Token: c.token,
+	}
+
+	body, err := json.Marshal(versionReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	// Safe to repeat, so retried if the control plane is briefly unavailable
+	resp, err := c.httpClient.PostIdempotent(context.Background(), c.baseURL+"/api/v1/gateway/config-version", body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("config version request failed with status: %d", resp.StatusCode)
+	}
+
+	var result ConfigVersionResponse
 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
 		return nil, fmt.Errorf("failed to decode response: %w", err)
 	}
@@ -319,6 +536,24 @@ func (c *HookClient) Provision() (*ProvisionResponse, error) {
 	return &result, nil
 }
 
+// ChangedArtifacts returns the sorted names of artifacts whose fingerprints differ
+// between previous and current. Every artifact counts as changed when previous is empty.
+func ChangedArtifacts(previous, current map[string]string) []string {
+	var changed []string
+	for name, fp := range current {
+		if previous[name] != fp {
+			changed = append(changed, name)
+		}
+	}
+	for name := range previous {
+		if _, ok := current[name]; !ok {
+			changed = append(changed, name)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
 // ParseEnvFile parses the environment file passed by OpenVPN's via-file method.
 func ParseEnvFile(path string) (map[string]string, error) {
 	file, err := os.Open(path)
@@ -0,0 +1,172 @@
+package openvpn
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gatekey-project/gatekey/internal/agent/agenttest"
+	"github.com/gatekey-project/gatekey/internal/config"
+	"github.com/gatekey-project/gatekey/internal/pki"
+)
+
+func TestHookClientHeartbeat(t *testing.T) {
+	tests := []struct {
+		name     string
+		response agenttest.Response
+		wantErr  string
+	}{
+		{"reprovision signaled", agenttest.JSON(HeartbeatResponse{Status: "ok", ConfigVersion: "v2", NeedsReprovision: true, RulesHash: "abc"}), ""},
+		{"rejected token", agenttest.Response{Status: http.StatusUnauthorized, Body: `{"error":"invalid token"}`}, "status: 401"},
+		{"malformed JSON", agenttest.Response{Body: `{"status":`}, "failed to decode"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cp := agenttest.NewControlPlane(t)
+			cp.Handle("/api/v1/gateway/heartbeat", tt.response)
+
+			client := NewHookClient(cp.URL+"/", "gw-token")
+			resp, err := client.Heartbeat("203.0.113.1", 3, true, "v1", &HeartbeatMetrics{FirewallRules: 7})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Heartbeat() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Heartbeat() error = %v", err)
+			}
+			if !resp.NeedsReprovision || resp.ConfigVersion != "v2" || resp.RulesHash != "abc" {
+				t.Errorf("Heartbeat() = %+v", resp)
+			}
+
+			var sent struct {
+				Token         string            `json:"token"`
+				ActiveClients int               `json:"active_clients"`
+				ConfigVersion string            `json:"config_version"`
+				Metrics       *HeartbeatMetrics `json:"metrics"`
+			}
+			requests := cp.Requests("/api/v1/gateway/heartbeat")
+			if len(requests) != 1 {
+				t.Fatalf("control plane got %d heartbeats, want 1", len(requests))
+			}
+			if err := requests[0].Decode(&sent); err != nil {
+				t.Fatal(err)
+			}
+			if sent.Token != "gw-token" || sent.ActiveClients != 3 || sent.ConfigVersion != "v1" || sent.Metrics == nil || sent.Metrics.FirewallRules != 7 {
+				t.Errorf("heartbeat request = %+v", sent)
+			}
+		})
+	}
+}
+
+func TestHookClientProvision(t *testing.T) {
+	ca, err := pki.NewCA(config.PKIConfig{
+		KeyAlgorithm: "ecdsa256",
+		Organization: "Test Org",
+		CertValidity: time.Hour,
+		CAValidity:   24 * time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create CA: %v", err)
+	}
+	signed := agenttest.JSON(ProvisionResponse{GatewayID: "gw-1", CACert: string(ca.CertificatePEM()), ServerKey: "key"})
+	signature, err := ca.Sign([]byte(signed.Body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed.Header = http.Header{ProvisionSignatureHeader: {base64.StdEncoding.EncodeToString(signature)}}
+
+	tests := []struct {
+		name       string
+		response   agenttest.Response
+		wantErr    string
+		wantSigned bool
+	}{
+		{"signed", signed, "", true},
+		{"unsigned", agenttest.JSON(ProvisionResponse{GatewayID: "gw-1"}), "", false},
+		{"server error", agenttest.Response{Status: http.StatusInternalServerError, Body: "no active CA"}, "status 500: no active CA", false},
+		{"malformed JSON", agenttest.Response{Body: "<html>"}, "failed to decode", false},
+		{"bad signature header", agenttest.Response{Body: `{}`, Header: http.Header{ProvisionSignatureHeader: {"not base64!"}}}, "provisioning signature", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cp := agenttest.NewControlPlane(t)
+			cp.Handle("/api/v1/gateway/provision", tt.response)
+
+			resp, err := NewHookClient(cp.URL, "gw-token").Provision()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Provision() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Provision() error = %v", err)
+			}
+			if resp.GatewayID != "gw-1" || string(resp.Payload) != tt.response.Body {
+				t.Errorf("Provision() = %+v", resp)
+			}
+			verifyErr := VerifyProvision(resp, ProvisionTrust{Pinned: []string{pki.Fingerprint(ca.Certificate())}})
+			if tt.wantSigned && verifyErr != nil {
+				t.Errorf("VerifyProvision() error = %v", verifyErr)
+			}
+			if !tt.wantSigned && !errors.Is(verifyErr, ErrProvisionUnsigned) {
+				t.Errorf("VerifyProvision() error = %v, want ErrProvisionUnsigned", verifyErr)
+			}
+		})
+	}
+}
+
+func TestHookClientTimeout(t *testing.T) {
+	cp := agenttest.NewControlPlane(t)
+	cp.Handle("/api/v1/gateway/provision", agenttest.Response{Body: `{}`, Delay: 5 * time.Second})
+	cp.Handle("/api/v1/gateway/disconnect", agenttest.Response{Body: `{}`, Delay: 5 * time.Second})
+
+	client := NewHookClient(cp.URL, "gw-token")
+	client.SetTimeout(50 * time.Millisecond)
+
+	if _, err := client.Provision(); !IsTimeout(err) {
+		t.Errorf("Provision() error = %v, want a timeout", err)
+	}
+	if err := client.Disconnect(HookRequest{CommonName: "alice"}); !IsTimeout(err) {
+		t.Errorf("Disconnect() error = %v, want a timeout", err)
+	}
+	// State-changing calls aren't retried
+	if n := cp.Calls("/api/v1/gateway/disconnect"); n != 1 {
+		t.Errorf("disconnect sent %d times, want 1", n)
+	}
+}
+
+func TestHookClientDisconnect(t *testing.T) {
+	cp := agenttest.NewControlPlane(t)
+	cp.Handle("/api/v1/gateway/disconnect",
+		agenttest.Response{Body: `{"status":"ok"}`},
+		agenttest.Response{Status: http.StatusNotFound, Body: `{"error":"no active connection"}`})
+
+	client := NewHookClient(cp.URL, "gw-token")
+	req := HookRequest{CommonName: "alice", UntrustedIP: "198.51.100.7", TimeConnected: 90, BytesSent: 1024, TLSSerial: "0a1b"}
+	if err := client.Disconnect(req); err != nil {
+		t.Fatalf("Disconnect() error = %v", err)
+	}
+	if err := client.Disconnect(req); err == nil {
+		t.Error("Disconnect() accepted a 404")
+	}
+
+	var sent struct {
+		Token        string `json:"token"`
+		CommonName   string `json:"common_name"`
+		Duration     int64  `json:"duration_seconds"`
+		BytesSent    int64  `json:"bytes_sent"`
+		SerialNumber string `json:"serial_number"`
+	}
+	if err := cp.Requests("/api/v1/gateway/disconnect")[0].Decode(&sent); err != nil {
+		t.Fatal(err)
+	}
+	if sent.Token != "gw-token" || sent.CommonName != "alice" || sent.Duration != 90 || sent.BytesSent != 1024 || sent.SerialNumber != "0a1b" {
+		t.Errorf("disconnect request = %+v", sent)
+	}
+}
@@ -0,0 +1,125 @@
+package openvpn
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// Keepalive used when a gateway doesn't set its own.
+const (
+	DefaultKeepaliveInterval = 10
+	DefaultKeepaliveTimeout  = 60
+)
+
+// Limits for link tuning values. MTU-related values below 576 (the minimum IPv4
+// datagram every host must accept) or above jumbo frame sizes are mistakes.
+const (
+	maxKeepaliveInterval = 300
+	maxKeepaliveTimeout  = 3600
+	minLinkMTU           = 576
+	maxLinkMTU           = 9000
+)
+
+// LinkTuning holds keepalive and MTU settings that must match on the gateway and
+// its clients. Zero values keep the defaults: keepalive 10 60 and OpenVPN's own
+// MTU handling.
+type LinkTuning struct {
+	KeepaliveInterval int `json:"keepalive_interval,omitempty"`
+	KeepaliveTimeout  int `json:"keepalive_timeout,omitempty"`
+	TunMTU            int `json:"tun_mtu,omitempty"`
+	MSSFix            int `json:"mssfix,omitempty"`
+	Fragment          int `json:"fragment,omitempty"`
+}
+
+// ValidateLinkTuning checks link tuning values for a gateway listening on the
+// given protocols. fragment only works over UDP, and clients fail to start if any
+// of their remotes is TCP, so it is rejected when any listener is TCP.
+func ValidateLinkTuning(t LinkTuning, protocols ...string) error {
+	if t.KeepaliveInterval < 0 || t.KeepaliveInterval > maxKeepaliveInterval {
+		return fmt.Errorf("keepalive_interval must be between 1 and %d seconds", maxKeepaliveInterval)
+	}
+	interval, timeout := t.keepalive()
+	if t.KeepaliveTimeout < 0 || t.KeepaliveTimeout > maxKeepaliveTimeout {
+		return fmt.Errorf("keepalive_timeout must be between 2 and %d seconds", maxKeepaliveTimeout)
+	}
+	if timeout < 2*interval {
+		return fmt.Errorf("keepalive_timeout (%d) must be at least twice keepalive_interval (%d)", timeout, interval)
+	}
+	for _, v := range []struct {
+		name  string
+		value int
+	}{{"tun_mtu", t.TunMTU}, {"mssfix", t.MSSFix}, {"fragment", t.Fragment}} {
+		if v.value != 0 && (v.value < minLinkMTU || v.value > maxLinkMTU) {
+			return fmt.Errorf("%s must be between %d and %d, or 0 for the default", v.name, minLinkMTU, maxLinkMTU)
+		}
+	}
+	if t.Fragment != 0 {
+		for _, protocol := range protocols {
+			if !strings.EqualFold(protocol, "udp") {
+				return fmt.Errorf("fragment only works over UDP, but the gateway listens on %s; use mssfix instead", strings.ToLower(protocol))
+			}
+		}
+	}
+	return nil
+}
+
+// keepalive returns the keepalive interval and timeout, with defaults applied.
+func (t LinkTuning) keepalive() (int, int) {
+	interval, timeout := t.KeepaliveInterval, t.KeepaliveTimeout
+	if interval == 0 {
+		interval = DefaultKeepaliveInterval
+	}
+	if timeout == 0 {
+		timeout = max(DefaultKeepaliveTimeout, 2*interval)
+	}
+	return interval, timeout
+}
+
+// linkTuningDirectives returns the directives for t, shared by server and client
+// configs so both ends agree.
+func linkTuningDirectives(t LinkTuning) []string {
+	interval, timeout := t.keepalive()
+	directives := []string{fmt.Sprintf("keepalive %d %d", interval, timeout)}
+	if t.TunMTU != 0 {
+		directives = append(directives, fmt.Sprintf("tun-mtu %d", t.TunMTU))
+	}
+	if t.Fragment != 0 {
+		directives = append(directives, fmt.Sprintf("fragment %d", t.Fragment))
+	}
+	if t.MSSFix != 0 {
+		directives = append(directives, fmt.Sprintf("mssfix %d", t.MSSFix))
+	}
+	return directives
+}
+
+// isLinkTuningDirective reports whether a config line sets keepalive or MTU.
+func isLinkTuningDirective(fields []string) bool {
+	if len(fields) == 0 {
+		return false
+	}
+	switch fields[0] {
+	case "keepalive", "tun-mtu", "mssfix", "fragment":
+		return true
+	}
+	return false
+}
+
+// SetServerLinkTuning rewrites the keepalive and MTU directives in a server config
+// to match t, removing any existing ones.
+func SetServerLinkTuning(conf []byte, t LinkTuning) []byte {
+	var out bytes.Buffer
+	scanner := bufio.NewScanner(bytes.NewReader(conf))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if isLinkTuningDirective(strings.Fields(line)) {
+			continue
+		}
+		out.WriteString(line + "\n")
+	}
+	for _, directive := range linkTuningDirectives(t) {
+		out.WriteString(directive + "\n")
+	}
+	return out.Bytes()
+}
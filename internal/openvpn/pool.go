@@ -0,0 +1,137 @@
+package openvpn
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// PoolUsage is how much of an OpenVPN server's client address pool is taken,
+// either by connected clients or by static addresses in its client-config-dir.
+type PoolUsage struct {
+	Subnet string `json:"subnet"`
+	Size   int    `json:"size"` // Addresses the pool can hand out
+	Used   int    `json:"used"`
+}
+
+// ServerPoolUsage works out pool usage for a server config from its "server"
+// directive, the client addresses in its status file and the ifconfig-push
+// addresses in its client-config-dir. It returns nil for configs without a
+// "server" directive.
+func ServerPoolUsage(conf []byte) *PoolUsage {
+	var subnet *net.IPNet
+	var statusPath, ccdDir string
+	scanner := bufio.NewScanner(bytes.NewReader(conf))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		switch fields[0] {
+		case "server":
+			if len(fields) >= 3 {
+				if ip, mask := net.ParseIP(fields[1]).To4(), net.ParseIP(fields[2]).To4(); ip != nil && mask != nil {
+					subnet = &net.IPNet{IP: ip.Mask(net.IPMask(mask)), Mask: net.IPMask(mask)}
+				}
+			}
+		case "status":
+			statusPath = fields[1]
+		case "client-config-dir":
+			ccdDir = fields[1]
+		}
+	}
+	if subnet == nil {
+		return nil
+	}
+
+	used := make(map[string]bool)
+	if statusPath != "" {
+		if data, err := os.ReadFile(statusPath); err == nil {
+			for _, addr := range StatusClientAddresses(data) {
+				used[addr] = true
+			}
+		}
+	}
+	if ccdDir != "" {
+		for _, addr := range ccdStaticAddresses(ccdDir) {
+			used[addr] = true
+		}
+	}
+
+	usage := &PoolUsage{Subnet: subnet.String(), Size: PoolSize(subnet)}
+	for addr := range used {
+		if ip := net.ParseIP(addr); ip != nil && subnet.Contains(ip) {
+			usage.Used++
+		}
+	}
+	return usage
+}
+
+// PoolSize returns how many client addresses "server" with topology subnet hands
+// out for a subnet: all but the network and broadcast addresses, the server's own
+// address and the one OpenVPN keeps back at the top of the pool.
+func PoolSize(subnet *net.IPNet) int {
+	ones, bits := subnet.Mask.Size()
+	if bits-ones >= 31 {
+		return 1<<31 - 1
+	}
+	return max(1<<(bits-ones)-4, 0)
+}
+
+// StatusClientAddresses returns the client virtual addresses in an OpenVPN
+// status file, in either the version 1 format or the comma separated version 2.
+func StatusClientAddresses(data []byte) []string {
+	var addrs []string
+	inRoutingTable := false
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "ROUTING_TABLE,"):
+			// Version 2: ROUTING_TABLE,Virtual Address,Common Name,...
+			if parts := strings.Split(line, ","); len(parts) > 1 {
+				addrs = append(addrs, parts[1])
+			}
+		case strings.HasPrefix(line, "ROUTING TABLE"):
+			inRoutingTable = true
+		case strings.HasPrefix(line, "GLOBAL STATS"), strings.HasPrefix(line, "END"):
+			inRoutingTable = false
+		case inRoutingTable && !strings.HasPrefix(line, "Virtual Address,"):
+			if parts := strings.Split(line, ","); len(parts) > 1 {
+				addrs = append(addrs, parts[0])
+			}
+		}
+	}
+	return addrs
+}
+
+// ccdStaticAddresses returns the addresses assigned with ifconfig-push in a
+// client-config-dir, which the pool can't hand out even while those clients are
+// disconnected.
+func ccdStaticAddresses(dir string) []string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var addrs []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			continue
+		}
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) >= 2 && fields[0] == "ifconfig-push" {
+				addrs = append(addrs, fields[1])
+			}
+		}
+	}
+	return addrs
+}
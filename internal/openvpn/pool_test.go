@@ -0,0 +1,65 @@
+package openvpn
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestServerPoolUsage(t *testing.T) {
+	dir := t.TempDir()
+	status := filepath.Join(dir, "status.log")
+	ccd := filepath.Join(dir, "ccd")
+	if err := os.Mkdir(ccd, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// Version 2 status: two clients, one of which also has a static address
+	statusData := "TITLE,OpenVPN 2.6\n" +
+		"CLIENT_LIST,alice,198.51.100.7:51234,10.8.0.2,,1,2,Mon Jan 1 00:00:00 2024,0,UNDEF,0,0,AES-256-GCM\n" +
+		"ROUTING_TABLE,10.8.0.2,alice,198.51.100.7:51234,Mon Jan 1 00:00:00 2024,0\n" +
+		"ROUTING_TABLE,10.8.0.3,bob,198.51.100.8:51234,Mon Jan 1 00:00:00 2024,0\n" +
+		"GLOBAL_STATS,Max bcast/mcast queue length,0\nEND\n"
+	if err := os.WriteFile(status, []byte(statusData), 0644); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"bob":     "ifconfig-push 10.8.0.3 255.255.255.0\n",
+		"carol":   "ifconfig-push 10.8.0.10 255.255.255.0\n",
+		"outside": "ifconfig-push 10.9.0.10 255.255.255.0\n",
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(ccd, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	conf := fmt.Sprintf("port 1194\nserver 10.8.0.0 255.255.255.0\nstatus %s\nclient-config-dir %s\n", status, ccd)
+	usage := ServerPoolUsage([]byte(conf))
+	if usage == nil {
+		t.Fatal("expected pool usage")
+	}
+	want := PoolUsage{Subnet: "10.8.0.0/24", Size: 252, Used: 3}
+	if *usage != want {
+		t.Errorf("ServerPoolUsage = %+v, want %+v", *usage, want)
+	}
+
+	if usage := ServerPoolUsage([]byte("client\nremote vpn.example.com 1194\n")); usage != nil {
+		t.Errorf("expected nil for a config without a server directive, got %+v", usage)
+	}
+}
+
+func TestStatusClientAddressesVersion1(t *testing.T) {
+	data := "OpenVPN CLIENT LIST\n" +
+		"Common Name,Real Address,Bytes Received,Bytes Sent,Connected Since\n" +
+		"alice,198.51.100.7:51234,100,200,Mon Jan 1 00:00:00 2024\n" +
+		"ROUTING TABLE\n" +
+		"Virtual Address,Common Name,Real Address,Last Ref\n" +
+		"10.8.0.2,alice,198.51.100.7:51234,Mon Jan 1 00:00:00 2024\n" +
+		"GLOBAL STATS\nMax bcast/mcast queue length,0\nEND\n"
+	got := StatusClientAddresses([]byte(data))
+	if len(got) != 1 || got[0] != "10.8.0.2" {
+		t.Errorf("StatusClientAddresses = %v, want [10.8.0.2]", got)
+	}
+}
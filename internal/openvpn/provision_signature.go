@@ -0,0 +1,120 @@
+package openvpn
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/gatekey-project/gatekey/internal/pki"
+)
+
+// ProvisionSignatureHeader carries the base64 signature over a provisioning
+// response body, made with the control plane's active CA key.
+const ProvisionSignatureHeader = "X-GateKey-Provision-Signature"
+
+// ProvisionEndorsementHeader carries signatures over the same body made with the
+// control plane's other trusted CAs, one "<fingerprint>=<base64 signature>" per
+// value. After a CA rotation they let a gateway that trusts only the CA it was
+// provisioned with accept a response issued with the new one.
+const ProvisionEndorsementHeader = "X-GateKey-Provision-Endorsement"
+
+// ErrProvisionUnsigned is returned by VerifyProvision for responses from control
+// planes that predate signed provisioning.
+var ErrProvisionUnsigned = errors.New("provisioning response is not signed")
+
+// ProvisionTrust is what a gateway trusts provisioning responses to be issued
+// with, in order of precedence.
+type ProvisionTrust struct {
+	// Pinned CA fingerprints; when set, only these CAs are trusted
+	Pinned []string
+	// Current is the CA the gateway was last provisioned with. It's trusted
+	// directly, and a rotated CA is trusted when Current endorsed the response.
+	Current *x509.Certificate
+	// Bootstrap is a CA fingerprint trusted only when there are no pins and no
+	// current CA, on the gateway's first provision
+	Bootstrap string
+}
+
+// VerifyProvision checks that a provisioning response was signed by the CA it
+// carries and that the CA is trusted, so a tampered response can't install a CA
+// or server key the control plane didn't issue.
+func VerifyProvision(resp *ProvisionResponse, trust ProvisionTrust) error {
+	if len(resp.Signature) == 0 {
+		return ErrProvisionUnsigned
+	}
+
+	block, _ := pem.Decode([]byte(resp.CACert))
+	if block == nil {
+		return fmt.Errorf("provisioning response has no CA certificate")
+	}
+	ca, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("failed to parse CA certificate: %w", err)
+	}
+	if err := pki.VerifySignature(ca, resp.Payload, resp.Signature); err != nil {
+		return fmt.Errorf("provisioning signature is invalid: %w", err)
+	}
+
+	fingerprint := pki.Fingerprint(ca)
+	switch {
+	case len(trust.Pinned) > 0:
+		for _, fp := range trust.Pinned {
+			if normalizeFingerprint(fp) == fingerprint {
+				return nil
+			}
+		}
+		return fmt.Errorf("provisioning CA %s is not pinned", fingerprint)
+
+	case trust.Current != nil:
+		current := pki.Fingerprint(trust.Current)
+		if fingerprint == current {
+			return nil
+		}
+		endorsement, ok := resp.Endorsements[current]
+		if !ok {
+			return fmt.Errorf("provisioning CA %s is not endorsed by the current CA %s", fingerprint, current)
+		}
+		if err := pki.VerifySignature(trust.Current, resp.Payload, endorsement); err != nil {
+			return fmt.Errorf("endorsement by the current CA %s is invalid: %w", current, err)
+		}
+		return nil
+
+	case trust.Bootstrap != "":
+		if normalizeFingerprint(trust.Bootstrap) != fingerprint {
+			return fmt.Errorf("provisioning CA %s is not trusted", fingerprint)
+		}
+		return nil
+
+	default:
+		return fmt.Errorf("no trusted CA to verify the provisioning response against")
+	}
+}
+
+// parseEndorsements decodes ProvisionEndorsementHeader values into signatures
+// keyed by normalized CA fingerprint.
+func parseEndorsements(values []string) (map[string][]byte, error) {
+	endorsements := make(map[string][]byte, len(values))
+	for _, v := range values {
+		fp, sig, ok := strings.Cut(v, "=")
+		if !ok {
+			return nil, fmt.Errorf("malformed endorsement %q", v)
+		}
+		signature, err := base64.StdEncoding.DecodeString(sig)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode endorsement: %w", err)
+		}
+		endorsements[normalizeFingerprint(fp)] = signature
+	}
+	return endorsements, nil
+}
+
+// normalizeFingerprint accepts fingerprints as hex with or without a "sha256:"
+// prefix and colon separators, in either case.
+func normalizeFingerprint(fp string) string {
+	fp = strings.ToLower(strings.TrimSpace(fp))
+	fp = strings.TrimPrefix(fp, "sha256:")
+	return strings.ReplaceAll(fp, ":", "")
+}
@@ -0,0 +1,127 @@
+package openvpn
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gatekey-project/gatekey/internal/config"
+	"github.com/gatekey-project/gatekey/internal/pki"
+)
+
+func newTestCA(t *testing.T) *pki.CA {
+	t.Helper()
+	ca, err := pki.NewCA(config.PKIConfig{
+		KeyAlgorithm: "ecdsa256",
+		Organization: "Test Org",
+		CertValidity: time.Hour,
+		CAValidity:   24 * time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create CA: %v", err)
+	}
+	return ca
+}
+
+func TestVerifyProvision(t *testing.T) {
+	ca := newTestCA(t)
+	fingerprint := pki.Fingerprint(ca.Certificate())
+
+	signed := func(body map[string]string) *ProvisionResponse {
+		payload, _ := json.Marshal(body)
+		signature, err := ca.Sign(payload)
+		if err != nil {
+			t.Fatalf("Sign() error = %v", err)
+		}
+		var resp ProvisionResponse
+		if err := json.Unmarshal(payload, &resp); err != nil {
+			t.Fatal(err)
+		}
+		resp.Payload = payload
+		resp.Signature = signature
+		return &resp
+	}
+	body := map[string]string{"gateway_id": "gw-1", "ca_cert": string(ca.CertificatePEM()), "server_key": "key"}
+	pinned := ProvisionTrust{Pinned: []string{fingerprint}}
+
+	if err := VerifyProvision(signed(body), pinned); err != nil {
+		t.Errorf("VerifyProvision() error = %v", err)
+	}
+	if err := VerifyProvision(signed(body), ProvisionTrust{Pinned: []string{"SHA256:" + strings.ToUpper(fingerprint)}}); err != nil {
+		t.Errorf("VerifyProvision() with formatted fingerprint error = %v", err)
+	}
+	if err := VerifyProvision(signed(body), ProvisionTrust{Current: ca.Certificate()}); err != nil {
+		t.Errorf("VerifyProvision() with the current CA error = %v", err)
+	}
+	if err := VerifyProvision(signed(body), ProvisionTrust{Bootstrap: fingerprint}); err != nil {
+		t.Errorf("VerifyProvision() on first provision error = %v", err)
+	}
+
+	tampered := signed(body)
+	tampered.Payload = []byte(strings.Replace(string(tampered.Payload), `"key"`, `"evil"`, 1))
+	if err := VerifyProvision(tampered, pinned); err == nil {
+		t.Error("VerifyProvision() accepted a tampered payload")
+	}
+
+	if err := VerifyProvision(signed(body), ProvisionTrust{Pinned: []string{strings.Repeat("0", 64)}}); err == nil {
+		t.Error("VerifyProvision() accepted an untrusted CA")
+	}
+	if err := VerifyProvision(signed(body), ProvisionTrust{}); err == nil {
+		t.Error("VerifyProvision() accepted a payload with no trust anchor")
+	}
+
+	// The heartbeat's fingerprint isn't trusted once the gateway has a CA, so a
+	// forged heartbeat can't introduce a CA of the attacker's
+	other := newTestCA(t)
+	if err := VerifyProvision(signed(body), ProvisionTrust{Current: other.Certificate(), Bootstrap: fingerprint}); err == nil {
+		t.Error("VerifyProvision() accepted a CA the current CA didn't endorse")
+	}
+
+	unsigned := signed(body)
+	unsigned.Signature = nil
+	if err := VerifyProvision(unsigned, pinned); !errors.Is(err, ErrProvisionUnsigned) {
+		t.Errorf("VerifyProvision() unsigned error = %v, want ErrProvisionUnsigned", err)
+	}
+}
+
+// TestVerifyProvisionRotation checks that a response issued with a rotated CA is
+// trusted when the gateway's current CA endorsed it.
+func TestVerifyProvisionRotation(t *testing.T) {
+	oldCA, newCA := newTestCA(t), newTestCA(t)
+	payload, _ := json.Marshal(map[string]string{"gateway_id": "gw-1", "ca_cert": string(newCA.CertificatePEM())})
+	signature, err := newCA.Sign(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	endorsement, err := pki.SignWithPEM(string(oldCA.CertificatePEM()), string(oldCA.PrivateKeyPEM()), payload)
+	if err != nil {
+		t.Fatalf("SignWithPEM() error = %v", err)
+	}
+	endorsements, err := parseEndorsements([]string{
+		"sha256:" + pki.Fingerprint(oldCA.Certificate()) + "=" + base64.StdEncoding.EncodeToString(endorsement),
+	})
+	if err != nil {
+		t.Fatalf("parseEndorsements() error = %v", err)
+	}
+	resp := &ProvisionResponse{CACert: string(newCA.CertificatePEM()), Payload: payload, Signature: signature}
+	trust := ProvisionTrust{Current: oldCA.Certificate()}
+
+	if err := VerifyProvision(resp, trust); err == nil {
+		t.Error("VerifyProvision() accepted a rotated CA without an endorsement")
+	}
+	resp.Endorsements = endorsements
+	if err := VerifyProvision(resp, trust); err != nil {
+		t.Errorf("VerifyProvision() endorsed rotation error = %v", err)
+	}
+	resp.Endorsements = map[string][]byte{pki.Fingerprint(oldCA.Certificate()): signature}
+	if err := VerifyProvision(resp, trust); err == nil {
+		t.Error("VerifyProvision() accepted an endorsement the current CA didn't make")
+	}
+
+	if _, err := parseEndorsements([]string{"no-separator"}); err == nil {
+		t.Error("parseEndorsements() accepted a malformed value")
+	}
+}
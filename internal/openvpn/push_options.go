@@ -0,0 +1,92 @@
+package openvpn
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+)
+
+// domainRegex matches a DNS domain name used in dhcp-option DOMAIN/DOMAIN-SEARCH.
+var domainRegex = regexp.MustCompile(`^([a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?\.)*[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?$`)
+
+// pushOptionValidators lists the options a gateway may push to clients beyond routes
+// and DNS servers, keyed by directive. Anything not listed here is rejected so admins
+// can't push directives that execute scripts or redirect traffic unexpectedly.
+var pushOptionValidators = map[string]func(args []string) error{
+	// Windows: block DNS on non-VPN interfaces to prevent DNS leaks
+	"block-outside-dns": noArgs,
+	// Windows: re-register DNS after connecting
+	"register-dns": noArgs,
+	"dhcp-option":  validateDHCPOption,
+}
+
+// AllowedPushOptions returns the directives that may be used in custom push options.
+func AllowedPushOptions() []string {
+	return []string{
+		"block-outside-dns",
+		"register-dns",
+		"dhcp-option DOMAIN <domain>",
+		"dhcp-option DOMAIN-SEARCH <domain>",
+		"dhcp-option NTP <ip>",
+		"dhcp-option WINS <ip>",
+		"dhcp-option DISABLE-NBT",
+	}
+}
+
+// ValidatePushOption checks a custom push option (without the surrounding push "...")
+// against the allowlist.
+func ValidatePushOption(option string) error {
+	if strings.ContainsAny(option, "\"'\\\n\r") {
+		return fmt.Errorf("push option %q contains invalid characters", option)
+	}
+	fields := strings.Fields(option)
+	if len(fields) == 0 {
+		return fmt.Errorf("push option is empty")
+	}
+	validate, ok := pushOptionValidators[fields[0]]
+	if !ok {
+		return fmt.Errorf("push option %q is not allowed, allowed options: %s", fields[0], strings.Join(AllowedPushOptions(), ", "))
+	}
+	if err := validate(fields[1:]); err != nil {
+		return fmt.Errorf("push option %q: %w", option, err)
+	}
+	return nil
+}
+
+// FormatPushOption renders a validated option as a client-connect config line.
+func FormatPushOption(option string) string {
+	return fmt.Sprintf("push \"%s\"", strings.Join(strings.Fields(option), " "))
+}
+
+func noArgs(args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("takes no arguments")
+	}
+	return nil
+}
+
+func validateDHCPOption(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing dhcp-option type")
+	}
+	switch args[0] {
+	case "DOMAIN", "DOMAIN-SEARCH":
+		if len(args) != 2 || !domainRegex.MatchString(args[1]) {
+			return fmt.Errorf("%s requires a single domain name", args[0])
+		}
+	case "NTP", "WINS":
+		if len(args) != 2 || net.ParseIP(args[1]) == nil {
+			return fmt.Errorf("%s requires a single IP address", args[0])
+		}
+	case "DISABLE-NBT":
+		if len(args) != 1 {
+			return fmt.Errorf("DISABLE-NBT takes no arguments")
+		}
+	case "DNS":
+		return fmt.Errorf("use dns_servers to push DNS servers")
+	default:
+		return fmt.Errorf("dhcp-option %s is not allowed", args[0])
+	}
+	return nil
+}
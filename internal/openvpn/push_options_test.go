@@ -0,0 +1,42 @@
+package openvpn
+
+import "testing"
+
+func TestValidatePushOption(t *testing.T) {
+	valid := []string{
+		"block-outside-dns",
+		"register-dns",
+		"dhcp-option DOMAIN corp.example.com",
+		"dhcp-option DOMAIN-SEARCH example.com",
+		"dhcp-option NTP 10.0.0.1",
+		"dhcp-option DISABLE-NBT",
+	}
+	for _, opt := range valid {
+		if err := ValidatePushOption(opt); err != nil {
+			t.Errorf("ValidatePushOption(%q) unexpected error: %v", opt, err)
+		}
+	}
+
+	invalid := []string{
+		"",
+		"up /tmp/evil.sh",
+		"route-up /bin/sh",
+		"redirect-gateway def1",
+		"block-outside-dns extra",
+		"dhcp-option DNS 1.1.1.1",
+		"dhcp-option NTP not-an-ip",
+		"dhcp-option DOMAIN bad_domain!",
+		"register-dns\" \"up /bin/sh",
+	}
+	for _, opt := range invalid {
+		if err := ValidatePushOption(opt); err == nil {
+			t.Errorf("ValidatePushOption(%q) expected error", opt)
+		}
+	}
+}
+
+func TestFormatPushOption(t *testing.T) {
+	if got := FormatPushOption("dhcp-option  DOMAIN   corp.example.com"); got != `push "dhcp-option DOMAIN corp.example.com"` {
+		t.Errorf("FormatPushOption() = %s", got)
+	}
+}
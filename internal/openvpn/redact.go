@@ -0,0 +1,51 @@
+package openvpn
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+)
+
+// secretBlocks are inline config blocks that hold private keys or credentials.
+var secretBlocks = map[string]bool{
+	"key":                  true,
+	"tls-auth":             true,
+	"tls-crypt":            true,
+	"tls-crypt-v2":         true,
+	"secret":               true,
+	"pkcs12":               true,
+	"auth-user-pass":       true,
+	"http-proxy-user-pass": true,
+}
+
+// RedactedMarker replaces the contents of secret blocks in redacted configs.
+const RedactedMarker = "[redacted]"
+
+// RedactConfig replaces the contents of inline key and credential blocks, such
+// as <key> and <tls-crypt>, so a config can be shown without its secrets.
+// Certificates and file paths are kept.
+func RedactConfig(conf []byte) []byte {
+	var out bytes.Buffer
+	scanner := bufio.NewScanner(bytes.NewReader(conf))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	inSecret := ""
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		if inSecret != "" {
+			if trimmed == "</"+inSecret+">" {
+				out.WriteString(line + "\n")
+				inSecret = ""
+			}
+			continue
+		}
+		out.WriteString(line + "\n")
+		if strings.HasPrefix(trimmed, "<") && strings.HasSuffix(trimmed, ">") && !strings.HasPrefix(trimmed, "</") {
+			if tag := strings.Trim(trimmed, "<>"); secretBlocks[tag] {
+				out.WriteString(RedactedMarker + "\n")
+				inSecret = tag
+			}
+		}
+	}
+	return out.Bytes()
+}
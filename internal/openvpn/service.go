@@ -0,0 +1,106 @@
+package openvpn
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// ServiceConfig says how an agent runs OpenVPN, for hosts whose packaging differs
+// from the usual openvpn-server@ and openvpn@ systemd units. Empty values keep the
+// agent's defaults.
+type ServiceConfig struct {
+	Unit       string `mapstructure:"openvpn_unit"`        // systemd unit, e.g. openvpn-server@server; empty picks a known one
+	PIDFile    string `mapstructure:"openvpn_pid_file"`    // exists while OpenVPN runs; empty asks systemd instead
+	ConfigFile string `mapstructure:"openvpn_config_file"` // config the unit runs
+}
+
+// Service controls an agent's OpenVPN instance through systemd.
+type Service struct {
+	ServiceConfig
+	found bool
+}
+
+// systemctl runs systemctl with args; tests replace it.
+var systemctl = func(args ...string) error {
+	return exec.Command("systemctl", args...).Run()
+}
+
+// NewService resolves the systemd unit an agent controls. A configured unit must
+// exist. Otherwise the first of candidates that systemd knows is used, falling back
+// to the first candidate so hosts without systemd only fail once OpenVPN is started.
+func NewService(cfg ServiceConfig, candidates ...string) (*Service, error) {
+	svc := &Service{ServiceConfig: cfg}
+	if cfg.Unit != "" {
+		if !unitExists(cfg.Unit) {
+			return nil, fmt.Errorf("openvpn_unit %q is not a systemd unit on this host", cfg.Unit)
+		}
+		svc.found = true
+		return svc, nil
+	}
+	for _, unit := range candidates {
+		if unitExists(unit) {
+			svc.Unit, svc.found = unit, true
+			return svc, nil
+		}
+	}
+	if len(candidates) > 0 {
+		svc.Unit = candidates[0]
+	}
+	return svc, nil
+}
+
+func unitExists(unit string) bool {
+	return systemctl("cat", "--", unit) == nil
+}
+
+// Found reports whether systemd knows the unit.
+func (s *Service) Found() bool {
+	return s.found
+}
+
+// InstanceUnit returns the unit for another instance of the same template, e.g.
+// openvpn-server@server-tcp-443 for openvpn-server@server.
+func (s *Service) InstanceUnit(instance string) string {
+	template, _, ok := strings.Cut(s.Unit, "@")
+	if !ok {
+		template = "openvpn-server"
+	}
+	return template + "@" + instance
+}
+
+// Running reports whether OpenVPN is running, from its pid file if one is
+// configured and systemd otherwise.
+func (s *Service) Running() bool {
+	if s.PIDFile != "" {
+		_, err := os.Stat(s.PIDFile)
+		return err == nil
+	}
+	return systemctl("is-active", "--quiet", "--", s.Unit) == nil
+}
+
+// Start starts the unit.
+func (s *Service) Start() error {
+	if err := systemctl("start", "--", s.Unit); err != nil {
+		return fmt.Errorf("failed to start %s: %w", s.Unit, err)
+	}
+	return nil
+}
+
+// Restart restarts the unit.
+func (s *Service) Restart() error {
+	if err := systemctl("restart", "--", s.Unit); err != nil {
+		return fmt.Errorf("failed to restart %s: %w", s.Unit, err)
+	}
+	return nil
+}
+
+// Reload sends SIGHUP to the unit so OpenVPN re-reads its config, certificates,
+// and keys without the process restarting.
+func (s *Service) Reload() error {
+	if err := systemctl("kill", "--signal=HUP", "--", s.Unit); err != nil {
+		return fmt.Errorf("failed to reload %s: %w", s.Unit, err)
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package openvpn
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNewService(t *testing.T) {
+	known := map[string]bool{"openvpn@server": true, "custom-vpn": true}
+	orig := systemctl
+	systemctl = func(args ...string) error {
+		if args[0] == "cat" && known[args[len(args)-1]] {
+			return nil
+		}
+		return errors.New("not found")
+	}
+	defer func() { systemctl = orig }()
+
+	tests := []struct {
+		unit       string
+		candidates []string
+		want       string
+		found      bool
+		wantErr    bool
+	}{
+		{"", []string{"openvpn-server@server", "openvpn@server"}, "openvpn@server", true, false},
+		{"", []string{"openvpn-server@hub", "openvpn@hub"}, "openvpn-server@hub", false, false},
+		{"custom-vpn", []string{"openvpn-server@server"}, "custom-vpn", true, false},
+		{"openvpn-server@missing", []string{"openvpn@server"}, "", false, true},
+	}
+	for _, tt := range tests {
+		svc, err := NewService(ServiceConfig{Unit: tt.unit}, tt.candidates...)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("NewService(%q) error = %v, want error %v", tt.unit, err, tt.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if svc.Unit != tt.want || svc.Found() != tt.found {
+			t.Errorf("NewService(%q) = %q (found %v), want %q (found %v)", tt.unit, svc.Unit, svc.Found(), tt.want, tt.found)
+		}
+	}
+}
+
+func TestInstanceUnit(t *testing.T) {
+	tests := []struct{ unit, want string }{
+		{"openvpn-server@server", "openvpn-server@server-tcp-443"},
+		{"openvpn@server.service", "openvpn@server-tcp-443"},
+		{"openvpn", "openvpn-server@server-tcp-443"},
+	}
+	for _, tt := range tests {
+		svc := &Service{ServiceConfig: ServiceConfig{Unit: tt.unit}}
+		if got := svc.InstanceUnit("server-tcp-443"); got != tt.want {
+			t.Errorf("InstanceUnit for %q = %q, want %q", tt.unit, got, tt.want)
+		}
+	}
+}
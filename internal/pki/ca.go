@@ -443,6 +443,22 @@ func (ca *CA) UpdateFromPEM(ctx context.Context, certPEM, keyPEM string) error {
 	return nil
 }
 
+// LoadFromPEM replaces the CA in memory with a certificate and private key that
+// are already stored, such as a CA activated in the database. Unlike
+// UpdateFromPEM it doesn't save them, so it can't overwrite another stored CA.
+func (ca *CA) LoadFromPEM(certPEM, keyPEM string) error {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+
+	if err := ca.loadFromPEM(certPEM, keyPEM); err != nil {
+		return fmt.Errorf("invalid certificate/key: %w", err)
+	}
+	if !ca.certificate.IsCA {
+		return fmt.Errorf("certificate is not a CA certificate")
+	}
+	return nil
+}
+
 // nextSerial generates the next serial number.
 func (ca *CA) nextSerial() (*big.Int, error) {
 	ca.serialMu.Lock()
@@ -0,0 +1,104 @@
+package pki
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// CAExpiryWarning is how close to expiry an imported CA gets a warning, since
+// every config it signed stops working when it expires.
+const CAExpiryWarning = 90 * 24 * time.Hour
+
+// ValidateImportCA checks that an existing CA certificate and key can be
+// imported: the certificate must be a currently valid CA and the key must be
+// its own. It returns the certificate and warnings about anything that doesn't
+// stop the import, such as an expiry within CAExpiryWarning or a weak key.
+func ValidateImportCA(certPEM, keyPEM string, now time.Time) (*x509.Certificate, []string, error) {
+	var parsed CA
+	if err := parsed.loadFromPEM(certPEM, keyPEM); err != nil {
+		return nil, nil, err
+	}
+	cert := parsed.certificate
+
+	if !cert.IsCA {
+		return nil, nil, fmt.Errorf("certificate is not a CA certificate")
+	}
+	pub, ok := parsed.privateKey.Public().(interface{ Equal(crypto.PublicKey) bool })
+	if !ok || !pub.Equal(cert.PublicKey) {
+		return nil, nil, fmt.Errorf("private key does not match the CA certificate")
+	}
+	if now.Before(cert.NotBefore) {
+		return nil, nil, fmt.Errorf("CA certificate is not valid until %s", cert.NotBefore.Format(time.RFC3339))
+	}
+	if now.After(cert.NotAfter) {
+		return nil, nil, fmt.Errorf("CA certificate expired on %s", cert.NotAfter.Format(time.RFC3339))
+	}
+
+	var warnings []string
+	if left := cert.NotAfter.Sub(now); left < CAExpiryWarning {
+		warnings = append(warnings, fmt.Sprintf("CA certificate expires in %d days, on %s; plan a CA rotation",
+			int(left.Hours()/24), cert.NotAfter.Format("2006-01-02")))
+	}
+	if key, ok := cert.PublicKey.(*rsa.PublicKey); ok && key.N.BitLen() < 2048 {
+		warnings = append(warnings, fmt.Sprintf("CA key is RSA %d, weaker than the 2048 bits OpenVPN requires by default", key.N.BitLen()))
+	}
+	switch cert.SignatureAlgorithm {
+	case x509.MD5WithRSA, x509.SHA1WithRSA, x509.ECDSAWithSHA1:
+		warnings = append(warnings, fmt.Sprintf("CA certificate is signed with %s, which current OpenSSL rejects", cert.SignatureAlgorithm))
+	}
+	return cert, warnings, nil
+}
+
+// ImportedCert is an existing client certificate to keep accepting.
+type ImportedCert struct {
+	SerialNumber string // As GateKey stores serials; see NormalizeSerial
+	Fingerprint  string
+	CommonName   string
+	Email        string // The first email address in the certificate, if any
+	NotAfter     time.Time
+}
+
+// ParseImportClientCert parses an existing client certificate and checks that
+// ca issued it.
+func ParseImportClientCert(certPEM string, ca *x509.Certificate) (*ImportedCert, error) {
+	block, _ := pem.Decode([]byte(certPEM))
+	if block == nil {
+		return nil, fmt.Errorf("failed to decode certificate PEM")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate: %w", err)
+	}
+	if err := cert.CheckSignatureFrom(ca); err != nil {
+		return nil, fmt.Errorf("certificate was not issued by the imported CA: %w", err)
+	}
+
+	imported := &ImportedCert{
+		SerialNumber: cert.SerialNumber.Text(16),
+		Fingerprint:  Fingerprint(cert),
+		CommonName:   cert.Subject.CommonName,
+		NotAfter:     cert.NotAfter,
+	}
+	if len(cert.EmailAddresses) > 0 {
+		imported.Email = cert.EmailAddresses[0]
+	}
+	return imported, nil
+}
+
+// NormalizeSerial converts a certificate serial in hex, as openssl prints it or
+// as OpenVPN reports it in tls_serial_hex_0 ("0a:1b:..."), to the form GateKey
+// stores: lowercase hex without separators or leading zeros.
+func NormalizeSerial(serial string) (string, error) {
+	hexDigits := strings.NewReplacer(":", "", " ", "").Replace(strings.TrimPrefix(strings.ToLower(serial), "0x"))
+	n, ok := new(big.Int).SetString(hexDigits, 16)
+	if !ok || n.Sign() < 0 {
+		return "", fmt.Errorf("invalid serial number %q", serial)
+	}
+	return n.Text(16), nil
+}
@@ -0,0 +1,96 @@
+package pki
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gatekey-project/gatekey/internal/config"
+)
+
+func newTestCA(t *testing.T, validity time.Duration) *CA {
+	t.Helper()
+	ca, err := NewCA(config.PKIConfig{
+		KeyAlgorithm: "ecdsa256",
+		Organization: "Test Org",
+		CertValidity: time.Hour,
+		CAValidity:   validity,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create CA: %v", err)
+	}
+	return ca
+}
+
+func TestValidateImportCA(t *testing.T) {
+	year := 365 * 24 * time.Hour
+	ca := newTestCA(t, year)
+	other := newTestCA(t, year)
+	issued, err := ca.IssueClientCertificate(CertificateRequest{CommonName: "alice", ValidFor: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, warnings, err := ValidateImportCA(string(ca.CertificatePEM()), string(ca.PrivateKeyPEM()), time.Now())
+	if err != nil || cert.SerialNumber.Cmp(ca.Certificate().SerialNumber) != 0 || len(warnings) != 0 {
+		t.Errorf("valid CA: cert = %v, warnings = %v, err = %v", cert, warnings, err)
+	}
+
+	tests := []struct {
+		name, certPEM, keyPEM, wantErr string
+	}{
+		{"not a CA", string(issued.CertificatePEM), string(issued.PrivateKeyPEM), "not a CA certificate"},
+		{"wrong key", string(ca.CertificatePEM()), string(other.PrivateKeyPEM()), "does not match"},
+		{"not PEM", "junk", string(ca.PrivateKeyPEM()), "failed to decode"},
+	}
+	for _, tt := range tests {
+		if _, _, err := ValidateImportCA(tt.certPEM, tt.keyPEM, time.Now()); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: err = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+
+	if _, _, err := ValidateImportCA(string(ca.CertificatePEM()), string(ca.PrivateKeyPEM()), time.Now().Add(2*year)); err == nil {
+		t.Error("expired CA was accepted")
+	}
+	_, warnings, err = ValidateImportCA(string(ca.CertificatePEM()), string(ca.PrivateKeyPEM()), time.Now().Add(year-30*24*time.Hour))
+	if err != nil || len(warnings) != 1 || !strings.Contains(warnings[0], "expires in") {
+		t.Errorf("expiring CA: warnings = %v, err = %v", warnings, err)
+	}
+}
+
+func TestParseImportClientCert(t *testing.T) {
+	ca := newTestCA(t, 365*24*time.Hour)
+	other := newTestCA(t, 365*24*time.Hour)
+	issued, err := ca.IssueClientCertificate(CertificateRequest{CommonName: "alice", Email: "alice@example.com", ValidFor: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := ParseImportClientCert(string(issued.CertificatePEM), ca.Certificate())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert.SerialNumber != issued.SerialNumber || cert.Fingerprint != issued.Fingerprint || cert.CommonName != "alice" {
+		t.Errorf("parsed %+v, want serial %s and fingerprint %s", cert, issued.SerialNumber, issued.Fingerprint)
+	}
+	if _, err := ParseImportClientCert(string(issued.CertificatePEM), other.Certificate()); err == nil {
+		t.Error("certificate from another CA was accepted")
+	}
+}
+
+func TestNormalizeSerial(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"0a:1b:2c", "a1b2c"},
+		{"0A1B2C", "a1b2c"},
+		{"a1b2c", "a1b2c"},
+		{"0x0A", "a"},
+	}
+	for _, tt := range tests {
+		if got, err := NormalizeSerial(tt.in); err != nil || got != tt.want {
+			t.Errorf("NormalizeSerial(%q) = %q, %v; want %q", tt.in, got, err, tt.want)
+		}
+	}
+	if _, err := NormalizeSerial("not hex"); err == nil {
+		t.Error("invalid serial was accepted")
+	}
+}
@@ -0,0 +1,50 @@
+package pki
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/gatekey-project/gatekey/internal/config"
+)
+
+func TestEncryptPrivateKeyPEM(t *testing.T) {
+	ca, err := NewCA(config.PKIConfig{
+		KeyAlgorithm: "ecdsa256",
+		Organization: "Test Org",
+		CertValidity: 24 * time.Hour,
+		CAValidity:   365 * 24 * time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create CA: %v", err)
+	}
+	issued, err := ca.IssueClientCertificate(CertificateRequest{CommonName: "test-user", ValidFor: time.Hour})
+	if err != nil {
+		t.Fatalf("Failed to issue certificate: %v", err)
+	}
+
+	passphrase, err := GenerateKeyPassphrase()
+	if err != nil {
+		t.Fatalf("Failed to generate passphrase: %v", err)
+	}
+
+	encrypted, err := EncryptPrivateKeyPEM(issued.PrivateKeyPEM, passphrase)
+	if err != nil {
+		t.Fatalf("Failed to encrypt key: %v", err)
+	}
+	if !bytes.Contains(encrypted, []byte("BEGIN ENCRYPTED PRIVATE KEY")) {
+		t.Errorf("Expected an encrypted PKCS#8 block, got:\n%s", encrypted)
+	}
+
+	decrypted, err := DecryptPrivateKeyPEM(encrypted, passphrase)
+	if err != nil {
+		t.Fatalf("Failed to decrypt key: %v", err)
+	}
+	if !bytes.Equal(decrypted, issued.PrivateKeyPEM) {
+		t.Error("Decrypted key does not match the original")
+	}
+
+	if _, err := DecryptPrivateKeyPEM(encrypted, "wrong-passphrase"); err != ErrIncorrectPassphrase {
+		t.Errorf("Expected ErrIncorrectPassphrase, got %v", err)
+	}
+}
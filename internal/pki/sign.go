@@ -0,0 +1,50 @@
+package pki
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"fmt"
+)
+
+// Sign signs data with the CA private key (SHA-256, PKCS#1 v1.5 for RSA keys),
+// for attesting to values other than certificates.
+func (ca *CA) Sign(data []byte) ([]byte, error) {
+	ca.mu.RLock()
+	defer ca.mu.RUnlock()
+
+	if ca.privateKey == nil {
+		return nil, fmt.Errorf("CA private key not loaded")
+	}
+	digest := sha256.Sum256(data)
+	return ca.privateKey.Sign(rand.Reader, digest[:], crypto.SHA256)
+}
+
+// SignWithPEM signs data like Sign with a CA given as PEM, such as a pending or
+// retired CA from the store.
+func SignWithPEM(certPEM, keyPEM string, data []byte) ([]byte, error) {
+	var ca CA
+	if err := ca.loadFromPEM(certPEM, keyPEM); err != nil {
+		return nil, err
+	}
+	return ca.Sign(data)
+}
+
+// VerifySignature checks a signature made by Sign against the given CA certificate.
+func VerifySignature(cert *x509.Certificate, data, signature []byte) error {
+	digest := sha256.Sum256(data)
+	switch pub := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], signature)
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(pub, digest[:], signature) {
+			return fmt.Errorf("invalid signature")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported CA key type %T", cert.PublicKey)
+	}
+}
@@ -0,0 +1,121 @@
+package policy
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gatekey-project/gatekey/internal/models"
+)
+
+// Constraints are the connection constraints the enabled policies set for a user.
+// When several policies apply, the most restrictive value of each wins, and
+// constraints only ever tighten the system-wide and per-gateway settings.
+type Constraints struct {
+	// Policies are the names of the policies that apply, in priority order.
+	Policies []string
+	// CertValidity is the shortest certificate validity, or 0 if no policy sets one.
+	CertValidity time.Duration
+	// MaxSessions is the lowest concurrent session limit, or 0 for no limit.
+	MaxSessions int
+	// CryptoProfiles are the crypto profiles the policies require; the strictest
+	// of them applies.
+	CryptoProfiles []string
+
+	timeWindows []policyWindows
+}
+
+// policyWindows are one policy's time windows.
+type policyWindows struct {
+	policy  string
+	windows []models.TimeWindow
+}
+
+// EffectiveConstraints combines the constraints of the enabled policies whose
+// subject matches user.
+func EffectiveConstraints(policies []models.Policy, user *models.User) Constraints {
+	var c Constraints
+	for _, p := range policies {
+		if !p.IsEnabled || p.Constraints == nil || !matchSubject(p.Constraints.Subject, user) {
+			continue
+		}
+		pc := p.Constraints
+		c.Policies = append(c.Policies, p.Name)
+
+		if pc.CertValidityHours > 0 {
+			validity := time.Duration(pc.CertValidityHours) * time.Hour
+			if c.CertValidity == 0 || validity < c.CertValidity {
+				c.CertValidity = validity
+			}
+		}
+		if pc.MaxSessions > 0 && (c.MaxSessions == 0 || pc.MaxSessions < c.MaxSessions) {
+			c.MaxSessions = pc.MaxSessions
+		}
+		if pc.CryptoProfile != "" {
+			c.CryptoProfiles = append(c.CryptoProfiles, pc.CryptoProfile)
+		}
+		if len(pc.TimeWindows) > 0 {
+			c.timeWindows = append(c.timeWindows, policyWindows{policy: p.Name, windows: pc.TimeWindows})
+		}
+	}
+	return c
+}
+
+// CapValidity returns validity, shortened to the policies' certificate validity.
+func (c Constraints) CapValidity(validity time.Duration) time.Duration {
+	if c.CertValidity > 0 && (validity <= 0 || c.CertValidity < validity) {
+		return c.CertValidity
+	}
+	return validity
+}
+
+// AllowsTime reports whether t falls inside one of the time windows of every
+// policy that sets them. If not, it returns the name of a policy that excludes t.
+func (c Constraints) AllowsTime(t time.Time) (bool, string) {
+	for _, pw := range c.timeWindows {
+		allowed := false
+		for _, tw := range pw.windows {
+			if matchTimeWindow(tw, t) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return false, pw.policy
+		}
+	}
+	return true, ""
+}
+
+var weekdays = map[string]bool{"mon": true, "tue": true, "wed": true, "thu": true, "fri": true, "sat": true, "sun": true}
+
+// ValidateTimeWindow checks that a time window's days, times and timezone parse.
+func ValidateTimeWindow(tw models.TimeWindow) error {
+	for _, d := range tw.Days {
+		if !weekdays[strings.ToLower(d)] {
+			return fmt.Errorf("invalid day %q: must be one of mon, tue, wed, thu, fri, sat, sun", d)
+		}
+	}
+	if (tw.StartTime == "") != (tw.EndTime == "") {
+		return fmt.Errorf("start_time and end_time must be set together")
+	}
+	if tw.StartTime != "" {
+		start, err := time.Parse("15:04", tw.StartTime)
+		if err != nil {
+			return fmt.Errorf("invalid start_time %q: must be HH:MM", tw.StartTime)
+		}
+		end, err := time.Parse("15:04", tw.EndTime)
+		if err != nil {
+			return fmt.Errorf("invalid end_time %q: must be HH:MM", tw.EndTime)
+		}
+		if end.Before(start) {
+			return fmt.Errorf("end_time %s is before start_time %s; use two windows to cross midnight", tw.EndTime, tw.StartTime)
+		}
+	}
+	if tw.Timezone != "" {
+		if _, err := time.LoadLocation(tw.Timezone); err != nil {
+			return fmt.Errorf("invalid timezone %q", tw.Timezone)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package policy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gatekey-project/gatekey/internal/models"
+)
+
+func TestEffectiveConstraints(t *testing.T) {
+	policies := []models.Policy{
+		{
+			Name:      "contractors",
+			IsEnabled: true,
+			Constraints: &models.PolicyConstraints{
+				Subject:           models.PolicySubject{Groups: []string{"contractors"}},
+				CertValidityHours: 4,
+				MaxSessions:       1,
+				CryptoProfile:     "fips",
+				TimeWindows: []models.TimeWindow{
+					{Days: []string{"mon", "tue", "wed", "thu", "fri"}, StartTime: "09:00", EndTime: "17:00", Timezone: "UTC"},
+				},
+			},
+		},
+		{
+			Name:      "everyone",
+			IsEnabled: true,
+			Constraints: &models.PolicyConstraints{
+				Subject:           models.PolicySubject{Everyone: true},
+				CertValidityHours: 12,
+				MaxSessions:       3,
+				CryptoProfile:     "modern",
+			},
+		},
+		{
+			Name:        "disabled",
+			IsEnabled:   false,
+			Constraints: &models.PolicyConstraints{Subject: models.PolicySubject{Everyone: true}, MaxSessions: 0, CertValidityHours: 1},
+		},
+		{Name: "no-constraints", IsEnabled: true},
+	}
+
+	contractor := &models.User{Email: "c@example.com", Groups: []string{"Contractors"}}
+	c := EffectiveConstraints(policies, contractor)
+	if len(c.Policies) != 2 || c.CertValidity != 4*time.Hour || c.MaxSessions != 1 || len(c.CryptoProfiles) != 2 {
+		t.Errorf("contractor constraints = %+v, want contractors and everyone combined", c)
+	}
+	if got := c.CapValidity(24 * time.Hour); got != 4*time.Hour {
+		t.Errorf("CapValidity(24h) = %v, want 4h", got)
+	}
+
+	monday := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	if ok, _ := c.AllowsTime(monday); !ok {
+		t.Error("AllowsTime(Monday 10:00) = false, want true")
+	}
+	if ok, policy := c.AllowsTime(monday.Add(10 * time.Hour)); ok || policy != "contractors" {
+		t.Errorf("AllowsTime(Monday 20:00) = %v, %q; want false, contractors", ok, policy)
+	}
+
+	employee := &models.User{Email: "e@example.com", Groups: []string{"engineering"}}
+	c = EffectiveConstraints(policies, employee)
+	if c.CertValidity != 12*time.Hour || c.MaxSessions != 3 {
+		t.Errorf("employee constraints = %+v, want 12h and 3 sessions", c)
+	}
+	if got := c.CapValidity(4 * time.Hour); got != 4*time.Hour {
+		t.Errorf("CapValidity(4h) = %v, want 4h unchanged", got)
+	}
+	if ok, _ := c.AllowsTime(monday.Add(10 * time.Hour)); !ok {
+		t.Error("AllowsTime without windows = false, want true")
+	}
+}
+
+func TestValidateTimeWindow(t *testing.T) {
+	valid := models.TimeWindow{Days: []string{"Mon"}, StartTime: "09:00", EndTime: "17:30", Timezone: "Europe/London"}
+	if err := ValidateTimeWindow(valid); err != nil {
+		t.Errorf("ValidateTimeWindow(%+v) = %v", valid, err)
+	}
+	for _, tw := range []models.TimeWindow{
+		{Days: []string{"monday"}},
+		{StartTime: "09:00"},
+		{StartTime: "9am", EndTime: "17:00"},
+		{StartTime: "22:00", EndTime: "06:00"},
+		{Timezone: "Mars/Olympus"},
+	} {
+		if err := ValidateTimeWindow(tw); err == nil {
+			t.Errorf("ValidateTimeWindow(%+v) = nil, want error", tw)
+		}
+	}
+}
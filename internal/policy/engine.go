@@ -177,7 +177,7 @@ func (e *Engine) matchRule(rule models.PolicyRule, req EvaluationRequest) (bool,
 	}
 
 	// Check subject match
-	if !e.matchSubject(subject, req.User) {
+	if !matchSubject(subject, req.User) {
 		return false, nil
 	}
 
@@ -206,7 +206,7 @@ func (e *Engine) matchRule(rule models.PolicyRule, req EvaluationRequest) (bool,
 }
 
 // matchSubject checks if the user matches the subject criteria.
-func (e *Engine) matchSubject(subject models.PolicySubject, user *models.User) bool {
+func matchSubject(subject models.PolicySubject, user *models.User) bool {
 	if subject.Everyone {
 		return true
 	}
@@ -329,7 +329,7 @@ func (e *Engine) matchConditions(conditions models.PolicyCondition, req Evaluati
 	if len(conditions.TimeWindows) > 0 {
 		matched := false
 		for _, tw := range conditions.TimeWindows {
-			if e.matchTimeWindow(tw, req.Time) {
+			if matchTimeWindow(tw, req.Time) {
 				matched = true
 				break
 			}
@@ -366,7 +366,7 @@ func (e *Engine) matchConditions(conditions models.PolicyCondition, req Evaluati
 }
 
 // matchTimeWindow checks if the time falls within a time window.
-func (e *Engine) matchTimeWindow(tw models.TimeWindow, t time.Time) bool {
+func matchTimeWindow(tw models.TimeWindow, t time.Time) bool {
 	// Load timezone
 	loc, err := time.LoadLocation(tw.Timezone)
 	if err != nil {
@@ -417,7 +417,7 @@ func (e *Engine) GetAllowedNetworks(ctx context.Context, user *models.User, gate
 				continue
 			}
 
-			if !e.matchSubject(subject, user) {
+			if !matchSubject(subject, user) {
 				continue
 			}
 
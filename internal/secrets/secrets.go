@@ -0,0 +1,164 @@
+// Package secrets encrypts sensitive database columns at rest.
+//
+// Values are sealed with AES-256-GCM under the keyring's primary key and stored
+// as "gkenc:v1:<key id>:<base64 nonce and ciphertext>", so every value records
+// which key it needs. Older keys stay in the keyring to read values sealed before
+// a rotation until they are rekeyed. Values without the prefix are plaintext from
+// before encryption was turned on and are returned as they are.
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const prefix = "gkenc:v1:"
+
+// KeySize is the length of an encryption key in bytes.
+const KeySize = 32
+
+var (
+	// ErrUnknownKey is returned when a value was sealed with a key the keyring
+	// doesn't have.
+	ErrUnknownKey = errors.New("value was encrypted with a key that isn't configured")
+	// ErrMalformed is returned for a value with the prefix that can't be decrypted.
+	ErrMalformed = errors.New("malformed encrypted value")
+)
+
+// Keyring holds the keys that encrypt secrets. A nil Keyring stores secrets as
+// plaintext.
+type Keyring struct {
+	primary string
+	keys    map[string]cipher.AEAD
+}
+
+// NewKeyring returns a keyring with keys, base64-encoded 32-byte keys by ID, that
+// seals new values with the primary key.
+func NewKeyring(keys map[string]string, primary string) (*Keyring, error) {
+	if _, ok := keys[primary]; !ok {
+		return nil, fmt.Errorf("primary key %q is not one of the configured keys", primary)
+	}
+	k := &Keyring{primary: primary, keys: make(map[string]cipher.AEAD, len(keys))}
+	for id, encoded := range keys {
+		if id == "" || strings.Contains(id, ":") {
+			return nil, fmt.Errorf("invalid key ID %q", id)
+		}
+		raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil {
+			return nil, fmt.Errorf("key %q is not valid base64: %w", id, err)
+		}
+		if len(raw) != KeySize {
+			return nil, fmt.Errorf("key %q is %d bytes, want %d", id, len(raw), KeySize)
+		}
+		block, err := aes.NewCipher(raw)
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		k.keys[id] = aead
+	}
+	return k, nil
+}
+
+// GenerateKey returns a new random key, base64-encoded for the config file.
+func GenerateKey() (string, error) {
+	raw := make([]byte, KeySize)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(raw), nil
+}
+
+// Primary returns the ID of the key new values are sealed with, or "" for a nil
+// keyring.
+func (k *Keyring) Primary() string {
+	if k == nil {
+		return ""
+	}
+	return k.primary
+}
+
+// KeyIDs returns the IDs of the keys in the keyring, sorted.
+func (k *Keyring) KeyIDs() []string {
+	if k == nil {
+		return nil
+	}
+	ids := make([]string, 0, len(k.keys))
+	for id := range k.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Seal encrypts a value with the primary key. Empty values stay empty, and a nil
+// keyring returns the value as it is.
+func (k *Keyring) Seal(plaintext []byte) ([]byte, error) {
+	if k == nil || len(plaintext) == 0 {
+		return plaintext, nil
+	}
+	aead := k.keys[k.primary]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	sealed := aead.Seal(nonce, nonce, plaintext, nil)
+	return []byte(prefix + k.primary + ":" + base64.StdEncoding.EncodeToString(sealed)), nil
+}
+
+// Open decrypts a value sealed with any key in the keyring. Plaintext values are
+// returned as they are.
+func (k *Keyring) Open(stored []byte) ([]byte, error) {
+	id, ok := KeyID(stored)
+	if !ok {
+		return stored, nil
+	}
+	if k == nil {
+		return nil, fmt.Errorf("%w (%s): no encryption keys are configured", ErrUnknownKey, id)
+	}
+	aead, found := k.keys[id]
+	if !found {
+		return nil, fmt.Errorf("%w (%s)", ErrUnknownKey, id)
+	}
+	sealed, err := base64.StdEncoding.DecodeString(string(stored[len(prefix)+len(id)+1:]))
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return nil, ErrMalformed
+	}
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	return plaintext, nil
+}
+
+// SealString is Seal for text columns.
+func (k *Keyring) SealString(plaintext string) (string, error) {
+	sealed, err := k.Seal([]byte(plaintext))
+	return string(sealed), err
+}
+
+// OpenString is Open for text columns.
+func (k *Keyring) OpenString(stored string) (string, error) {
+	plaintext, err := k.Open([]byte(stored))
+	return string(plaintext), err
+}
+
+// KeyID returns the ID of the key a stored value was sealed with, and false for
+// a plaintext value.
+func KeyID(stored []byte) (string, bool) {
+	rest, ok := strings.CutPrefix(string(stored), prefix)
+	if !ok {
+		return "", false
+	}
+	id, _, ok := strings.Cut(rest, ":")
+	return id, ok
+}
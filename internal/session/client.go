@@ -3,6 +3,7 @@ package session
 import (
 	"bufio"
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -23,6 +24,7 @@ type AgentClient struct {
 	nodeID          string
 	nodeName        string
 	logger          *zap.Logger
+	tlsConfig       *tls.Config
 
 	conn      *websocket.Conn
 	send      chan []byte
@@ -45,6 +47,7 @@ type AgentClientConfig struct {
 	NodeID          string
 	NodeName        string
 	Logger          *zap.Logger
+	TLSConfig       *tls.Config // For wss control plane URLs; nil uses the defaults
 }
 
 // NewAgentClient creates a new agent client for remote sessions
@@ -56,6 +59,7 @@ func NewAgentClient(cfg *AgentClientConfig) *AgentClient {
 		nodeID:          cfg.NodeID,
 		nodeName:        cfg.NodeName,
 		logger:          cfg.Logger,
+		tlsConfig:       cfg.TLSConfig,
 		send:            make(chan []byte, 256),
 		done:            make(chan struct{}),
 	}
@@ -157,6 +161,7 @@ func (c *AgentClient) connect(ctx context.Context) error {
 	// Connect with timeout
 	dialer := websocket.Dialer{
 		HandshakeTimeout: 30 * time.Second,
+		TLSClientConfig:  c.tlsConfig,
 	}
 
 	conn, httpResp, err := dialer.DialContext(ctx, u.String(), nil)